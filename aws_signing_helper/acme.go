@@ -0,0 +1,342 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/acme"
+)
+
+// How long an enrollment may take, from the registration of the account to
+// the issuance of the certificate
+var acmeEnrollmentTimeout = 5 * time.Minute
+
+// How long failed renewals wait before they're retried
+var acmeRetryInterval = 10 * time.Minute
+
+// Address that the http-01 challenges are served on by default
+const acmeDefaultHTTPAddress = ":80"
+
+// Configuration of the enrollment (and renewal) of the certificate with an
+// ACME server, such as that of a private CA (step-ca, AD CS with an ACME
+// gateway, or Vault's PKI secrets engine)
+type ACMEOptions struct {
+	// URL of the directory of the ACME server (such as
+	// https://ca.example.com/acme/acme/directory)
+	DirectoryURL string
+	// DNS names (or IP addresses) that the certificate is issued for, which
+	// are validated with http-01 challenges
+	Identifiers []string
+	// Contact address of the account, if any
+	Email string
+	// File of the private key of the account, which is created (and the
+	// account registered) if it doesn't exist
+	AccountKeyFile string
+	// External account binding that the ACME server requires to register
+	// accounts, if any: its key ID and (decoded) HMAC key
+	EABKeyId   string
+	EABHMACKey []byte
+	// Address that the http-01 challenges are served on (:80 by default)
+	HTTPAddress string
+	// CAs that the certificate of the ACME server is verified against (by
+	// default, those of the system)
+	RootCAs *x509.CertPool
+	// How long before the certificate expires it's renewed. By default, it's
+	// renewed once two thirds of its validity period have passed.
+	RenewBefore time.Duration
+	// Whether requests are sent through the proxy of the environment
+	WithProxy bool
+}
+
+// Returns when the certificate is due to be renewed
+func ACMERenewalTime(certificate *x509.Certificate, renewBefore time.Duration) time.Time {
+	if renewBefore <= 0 {
+		renewBefore = certificate.NotAfter.Sub(certificate.NotBefore) / 3
+	}
+	return certificate.NotAfter.Add(-renewBefore)
+}
+
+// Obtains a certificate for a new private key from the ACME server, after
+// the identifiers are validated with http-01 challenges, and writes the
+// certificate (followed by its intermediates) and the private key to the
+// files. The account is registered with the account key first, unless it
+// was registered before.
+func EnrollACME(ctx context.Context, options ACMEOptions, certificateFile string, privateKeyFile string) (*x509.Certificate, error) {
+	if options.DirectoryURL == "" {
+		return nil, errors.New("the directory URL of the ACME server is required")
+	}
+	if len(options.Identifiers) == 0 {
+		return nil, errors.New("the identifiers of the certificate are required")
+	}
+	accountKey, err := readACMEAccountKey(options.AccountKeyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizePrivateKey(accountKey)
+	transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: options.RootCAs, MinVersion: tls.VersionTLS12}}
+	if options.WithProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	client := &acme.Client{
+		Key:          accountKey,
+		DirectoryURL: options.DirectoryURL,
+		HTTPClient:   &http.Client{Transport: transport},
+		UserAgent:    "rolesanywhere-credential-helper",
+	}
+	ctx, cancel := context.WithTimeout(ctx, acmeEnrollmentTimeout)
+	defer cancel()
+
+	account := &acme.Account{}
+	if options.Email != "" {
+		account.Contact = []string{"mailto:" + options.Email}
+	}
+	if options.EABKeyId != "" {
+		account.ExternalAccountBinding = &acme.ExternalAccountBinding{KID: options.EABKeyId, Key: options.EABHMACKey}
+	}
+	if _, err = client.Register(ctx, account, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return nil, fmt.Errorf("unable to register the ACME account: %w", err)
+	}
+
+	var ids []acme.AuthzID
+	var template x509.CertificateRequest
+	for _, identifier := range options.Identifiers {
+		if ip := net.ParseIP(identifier); ip != nil {
+			ids = append(ids, acme.AuthzID{Type: "ip", Value: identifier})
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			ids = append(ids, acme.AuthzID{Type: "dns", Value: identifier})
+			template.DNSNames = append(template.DNSNames, identifier)
+		}
+	}
+	template.Subject = pkix.Name{CommonName: options.Identifiers[0]}
+	order, err := client.AuthorizeOrder(ctx, ids)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the ACME order: %w", err)
+	}
+	if err = solveACMEAuthorizations(ctx, client, order.AuthzURLs, options.HTTPAddress); err != nil {
+		return nil, err
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return nil, fmt.Errorf("the ACME order wasn't authorized: %w", err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizePrivateKey(key)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &template, key)
+	if err != nil {
+		return nil, err
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("unable to finalize the ACME order: %w", err)
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("the ACME server returned no certificate")
+	}
+	certificate, err := x509.ParseCertificate(chain[0])
+	if err != nil {
+		return nil, fmt.Errorf("the ACME server returned an invalid certificate: %w", err)
+	}
+	if err = checkKeyMatchesCertificate(key.Public(), certificate); err != nil {
+		return nil, err
+	}
+
+	// The private key is written first, so that the certificate of the
+	// previous key is only replaced once the new key is in place
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizeBytes(der)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	defer zeroizeBytes(keyPEM)
+	var certificatePEM []byte
+	for _, der := range chain {
+		certificatePEM = append(certificatePEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	if err = writeFileAtomic(privateKeyFile, keyPEM); err != nil {
+		return nil, fmt.Errorf("unable to write the private key: %w", err)
+	}
+	if err = writeFileAtomic(certificateFile, certificatePEM); err != nil {
+		return nil, fmt.Errorf("unable to write the certificate: %w", err)
+	}
+	return certificate, nil
+}
+
+// Validates the pending authorizations of the order with their http-01
+// challenges, whose responses are served on the address until they're valid
+func solveACMEAuthorizations(ctx context.Context, client *acme.Client, urls []string, address string) error {
+	var pending []*acme.Authorization
+	for _, url := range urls {
+		authorization, err := client.GetAuthorization(ctx, url)
+		if err != nil {
+			return fmt.Errorf("unable to get the ACME authorization: %w", err)
+		}
+		if authorization.Status == acme.StatusPending {
+			pending = append(pending, authorization)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if address == "" {
+		address = acmeDefaultHTTPAddress
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("unable to serve the ACME challenges on %s: %w", address, err)
+	}
+	mux := http.NewServeMux()
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go server.Serve(listener)
+	defer server.Close()
+
+	var challenges []*acme.Challenge
+	for _, authorization := range pending {
+		var challenge *acme.Challenge
+		for _, c := range authorization.Challenges {
+			if c.Type == "http-01" {
+				challenge = c
+			}
+		}
+		if challenge == nil {
+			return fmt.Errorf("the ACME server offers no http-01 challenge for %s", authorization.Identifier.Value)
+		}
+		response, err := client.HTTP01ChallengeResponse(challenge.Token)
+		if err != nil {
+			return err
+		}
+		mux.HandleFunc(client.HTTP01ChallengePath(challenge.Token), func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(response))
+		})
+		challenges = append(challenges, challenge)
+	}
+	for i, challenge := range challenges {
+		if _, err = client.Accept(ctx, challenge); err != nil {
+			return fmt.Errorf("unable to accept the ACME challenge: %w", err)
+		}
+		if _, err = client.WaitAuthorization(ctx, pending[i].URI); err != nil {
+			return fmt.Errorf("%s wasn't validated: %w", pending[i].Identifier.Value, err)
+		}
+	}
+	return nil
+}
+
+// Reads the private key of the ACME account from the file, or generates it
+// (and writes it to the file) if the file doesn't exist
+func readACMEAccountKey(path string) (*ecdsa.PrivateKey, error) {
+	if path == "" {
+		return nil, errors.New("the file of the ACME account key is required")
+	}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		defer zeroizeBytes(data)
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid ACME account key %s", path)
+		}
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if ecdsaKey, ok := key.(*ecdsa.PrivateKey); err == nil && ok {
+			return ecdsaKey, nil
+		}
+		return nil, fmt.Errorf("invalid ACME account key %s", path)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizeBytes(der)
+	if err = writeFileAtomic(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})); err != nil {
+		return nil, fmt.Errorf("unable to write the ACME account key: %w", err)
+	}
+	return key, nil
+}
+
+// Enrolls the certificate with the ACME option if it doesn't exist, or if
+// it's due to be renewed. A certificate that couldn't be renewed is still
+// used while it's valid.
+func enrollACMEIfDue(opts *CredentialsOpts) error {
+	if err := requireIdentityFiles(opts, "ACME enrollment"); err != nil {
+		return err
+	}
+	_, certificate, err := ReadCertificateData(opts.CertificateId)
+	if err == nil && time.Now().Before(ACMERenewalTime(certificate, opts.ACME.RenewBefore)) {
+		return nil
+	}
+	renewed, enrollErr := EnrollACME(context.Background(), *opts.ACME, opts.CertificateId, opts.PrivateKeyId)
+	if enrollErr != nil {
+		if err == nil && time.Now().Before(certificate.NotAfter) {
+			signerLog.warnf("unable to renew the certificate with %s (it's still used until it expires at %s): %s",
+				opts.ACME.DirectoryURL, certificate.NotAfter.UTC().Format(time.RFC3339), enrollErr)
+			return nil
+		}
+		return fmt.Errorf("ACME enrollment failed: %w", enrollErr)
+	}
+	signerLog.infof("obtained the certificate %s from %s (expires at %s)", renewed.SerialNumber,
+		opts.ACME.DirectoryURL, renewed.NotAfter.UTC().Format(time.RFC3339))
+	return nil
+}
+
+// Renews the certificate with the ACME option whenever it's due, until the
+// context is done, and calls renewed (if it isn't nil) after each renewal.
+// Failed renewals are retried every acmeRetryInterval.
+func renewACMECertificate(ctx context.Context, opts *CredentialsOpts, renewed func()) {
+	for {
+		var wait time.Duration
+		if _, certificate, err := ReadCertificateData(opts.CertificateId); err == nil {
+			wait = time.Until(ACMERenewalTime(certificate, opts.ACME.RenewBefore))
+		}
+		if wait > 0 {
+			signerLog.debugf("the certificate is renewed in %s", wait)
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return
+			case <-timer.C:
+			}
+		}
+		certificate, err := EnrollACME(ctx, *opts.ACME, opts.CertificateId, opts.PrivateKeyId)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			signerLog.warnf("unable to renew the certificate with %s (retrying in %s): %s", opts.ACME.DirectoryURL,
+				acmeRetryInterval, err)
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(acmeRetryInterval):
+			}
+			continue
+		}
+		signerLog.infof("renewed the certificate with %s: %s (expires at %s)", opts.ACME.DirectoryURL,
+			certificate.SerialNumber, certificate.NotAfter.UTC().Format(time.RFC3339))
+		if renewed != nil {
+			renewed()
+		}
+	}
+}
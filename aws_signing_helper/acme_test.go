@@ -0,0 +1,247 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestACMEEnrollment(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ACME CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	// The challenges are served on a port that's known in advance, which
+	// the fake ACME server validates them on
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	challengeAddress := listener.Addr().String()
+	listener.Close()
+
+	// Fake ACME server, which validates the http-01 challenge of a single
+	// authorization, and issues certificates for the CSRs of valid orders
+	var mu sync.Mutex
+	var accounts, orders int
+	var serial int64 = 1
+	var issued *x509.Certificate
+	authorizationStatus := "pending"
+	var acmeServer *httptest.Server
+	acmeServer = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		w.Header().Set("Replay-Nonce", strconv.FormatInt(time.Now().UnixNano(), 36))
+		var request struct {
+			Payload string `json:"payload"`
+		}
+		if r.Method == http.MethodPost {
+			json.NewDecoder(r.Body).Decode(&request)
+		}
+		payload, _ := base64.RawURLEncoding.DecodeString(request.Payload)
+		order := func() map[string]interface{} {
+			status := "pending"
+			if authorizationStatus == "valid" {
+				status = "ready"
+			}
+			response := map[string]interface{}{
+				"status":         status,
+				"identifiers":    []map[string]string{{"type": "dns", "value": "device.example.com"}},
+				"authorizations": []string{acmeServer.URL + "/authz"},
+				"finalize":       acmeServer.URL + "/finalize",
+			}
+			if issued != nil {
+				response["status"] = "valid"
+				response["certificate"] = acmeServer.URL + "/certificate"
+			}
+			w.Header().Set("Location", acmeServer.URL+"/order")
+			return response
+		}
+		var response interface{}
+		switch r.URL.Path {
+		case "/directory":
+			response = map[string]string{
+				"newNonce":   acmeServer.URL + "/nonce",
+				"newAccount": acmeServer.URL + "/account",
+				"newOrder":   acmeServer.URL + "/new-order",
+			}
+		case "/nonce":
+			return
+		case "/account":
+			w.Header().Set("Location", acmeServer.URL+"/account/1")
+			if accounts == 0 {
+				w.WriteHeader(http.StatusCreated)
+			}
+			accounts++
+			response = map[string]string{"status": "valid"}
+		case "/new-order":
+			orders++
+			authorizationStatus, issued = "pending", nil
+			response = order()
+			w.WriteHeader(http.StatusCreated)
+		case "/order":
+			response = order()
+		case "/authz":
+			response = map[string]interface{}{
+				"status":     authorizationStatus,
+				"identifier": map[string]string{"type": "dns", "value": "device.example.com"},
+				"challenges": []map[string]string{{"type": "http-01", "url": acmeServer.URL + "/challenge",
+					"token": "challenge-token", "status": authorizationStatus}},
+			}
+		case "/challenge":
+			validation, err := http.Get("http://" + challengeAddress + "/.well-known/acme-challenge/challenge-token")
+			if err != nil {
+				t.Error("unable to validate the challenge:", err)
+			} else {
+				body, _ := io.ReadAll(validation.Body)
+				validation.Body.Close()
+				if strings.HasPrefix(string(body), "challenge-token.") {
+					authorizationStatus = "valid"
+				}
+			}
+			response = map[string]string{"type": "http-01", "url": acmeServer.URL + "/challenge",
+				"token": "challenge-token", "status": authorizationStatus}
+		case "/finalize":
+			var finalize struct {
+				CSR string `json:"csr"`
+			}
+			json.Unmarshal(payload, &finalize)
+			der, _ := base64.RawURLEncoding.DecodeString(finalize.CSR)
+			csr, err := x509.ParseCertificateRequest(der)
+			if err != nil || !slices.Equal(csr.DNSNames, []string{"device.example.com"}) {
+				t.Errorf("unexpected CSR: %v", err)
+			}
+			serial++
+			certificateDER, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+				SerialNumber: big.NewInt(serial),
+				Subject:      pkix.Name{CommonName: "device.example.com"},
+				DNSNames:     csr.DNSNames,
+				NotBefore:    time.Now().Add(-time.Minute),
+				NotAfter:     time.Now().Add(6 * time.Hour),
+				KeyUsage:     x509.KeyUsageDigitalSignature,
+				ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			}, ca, csr.PublicKey, caKey)
+			issued, _ = x509.ParseCertificate(certificateDER)
+			response = order()
+		case "/certificate":
+			w.Header().Set("Content-Type", "application/pem-certificate-chain")
+			w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issued.Raw}))
+			w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw}))
+			return
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(response)
+	}))
+	defer acmeServer.Close()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(acmeServer.Certificate())
+	dir := t.TempDir()
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	opts := CredentialsOpts{
+		CertificateId: filepath.Join(dir, "device.pem"),
+		PrivateKeyId:  filepath.Join(dir, "device.key"),
+		ACME: &ACMEOptions{
+			DirectoryURL:   acmeServer.URL + "/directory",
+			Identifiers:    []string{"device.example.com"},
+			AccountKeyFile: filepath.Join(dir, "acme-account.key"),
+			HTTPAddress:    challengeAddress,
+			RootCAs:        rootCAs,
+		},
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+
+	// The certificate is enrolled the first time a signer is made, and only
+	// renewed once it's due
+	for i := 0; i < 2; i++ {
+		signer, _, err := GetSigner(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate, err := signer.Certificate()
+		signer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certificate.SerialNumber.Int64() != 2 || certificate.Issuer.CommonName != "ACME CA" {
+			t.Errorf("unexpected certificate %s issued by %s", certificate.SerialNumber, certificate.Issuer.CommonName)
+		}
+	}
+	mu.Lock()
+	if orders != 1 {
+		t.Errorf("expected one order, got %d", orders)
+	}
+	mu.Unlock()
+	if _, err = os.Stat(opts.ACME.AccountKeyFile); err != nil {
+		t.Error("expected the account key to be written:", err)
+	}
+
+	// Certificates that are due to be renewed are renewed with the same
+	// account
+	opts.ACME.RenewBefore = 12 * time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		renewACMECertificate(ctx, &opts, cancel)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(30 * time.Second):
+		t.Fatal("the certificate wasn't renewed")
+	}
+	_, certificate, err := ReadCertificateData(opts.CertificateId)
+	if err != nil || certificate.SerialNumber.Int64() != 3 {
+		t.Errorf("expected the renewed certificate, got %v (%v)", certificate, err)
+	}
+	if _, err = tls.LoadX509KeyPair(opts.CertificateId, opts.PrivateKeyId); err != nil {
+		t.Error("invalid renewed certificate and private key:", err)
+	}
+	mu.Lock()
+	if accounts != 2 {
+		t.Errorf("expected the account to be registered once and then found, got %d registrations", accounts)
+	}
+	mu.Unlock()
+
+	opts.PrivateKeyId = "pkcs11:object=key"
+	if _, _, err = GetSigner(&opts); err == nil {
+		t.Error("expected ACME enrollment to require files")
+	}
+}
@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Writes data to the file at the specified path, such that readers either
+// observe the previous contents of the file or the new contents, but never a
+// partially written file. The data is written to a temporary file in the same
+// directory (that only the current user can access), flushed to disk, and then
+// renamed over the destination. If the destination is a symbolic link, the
+// file that it points to is replaced instead.
+func writeFileAtomic(path string, data []byte) (err error) {
+	if resolvedPath, evalErr := filepath.EvalSymlinks(path); evalErr == nil {
+		path = resolvedPath
+	}
+	dir := filepath.Dir(path)
+
+	tmpFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmpFile.Name()
+	defer func() {
+		if err != nil {
+			tmpFile.Close()
+			os.Remove(tmpPath)
+		}
+	}()
+
+	if err = setOwnerOnlyPermissions(tmpPath); err != nil {
+		return err
+	}
+	if _, err = tmpFile.Write(data); err != nil {
+		return err
+	}
+	if err = tmpFile.Sync(); err != nil {
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(dir)
+}
@@ -0,0 +1,49 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdateReplacesFileAtomically(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	credentialsDir := t.TempDir()
+	credentialsPath := filepath.Join(credentialsDir, "credentials")
+	t.Setenv(AwsSharedCredentialsFileEnvVarName, credentialsPath)
+
+	// An existing file that other users can read should be tightened up
+	if err := os.WriteFile(credentialsPath, []byte("[other]\naws_access_key_id = other\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	Update(credentialsOpts, "test", true)
+
+	if runtime.GOOS != "windows" {
+		info, err := os.Stat(credentialsPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Log("unexpected file mode:", info.Mode().Perm())
+			t.Fail()
+		}
+	}
+
+	entries, _ := os.ReadDir(credentialsDir)
+	if len(entries) != 1 {
+		t.Log("temporary files were left behind in the credentials directory")
+		t.Fail()
+	}
+}
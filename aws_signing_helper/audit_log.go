@@ -0,0 +1,302 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// Events that are recorded in the audit log
+const (
+	auditEventSign        = "Sign"
+	auditEventCredentials = "Credentials"
+)
+
+// Outcomes of the events that are recorded in the audit log
+const (
+	auditOutcomeSuccess = "Success"
+	auditOutcomeFailure = "Failure"
+)
+
+// Line of the audit log
+type auditRecord struct {
+	Time  time.Time `json:"Time"`
+	Event string    `json:"Event"`
+	// Hex-encoded SHA-256 hash of the DER-encoded public key (the KeyId of
+	// the sign-string command)
+	KeyFingerprint          string `json:"KeyFingerprint,omitempty"`
+	CertificateSerialNumber string `json:"CertificateSerialNumber,omitempty"`
+	// Hash function and hex-encoded digest that was signed
+	DigestAlgorithm string `json:"DigestAlgorithm,omitempty"`
+	Digest          string `json:"Digest,omitempty"`
+	// Role and credentials that were obtained from CreateSession
+	RoleArn     string `json:"RoleArn,omitempty"`
+	AccessKeyId string `json:"AccessKeyId,omitempty"`
+	Expiration  string `json:"Expiration,omitempty"`
+	// ID of the CreateSession request, and correlation ID of the credential
+	// request
+	RequestId     string      `json:"RequestId,omitempty"`
+	CorrelationId string      `json:"CorrelationId,omitempty"`
+	Caller        auditCaller `json:"Caller"`
+	Outcome       string      `json:"Outcome"`
+	Error         string      `json:"Error,omitempty"`
+}
+
+// Process that signed or obtained credentials and, for credentials that
+// were vended through the local endpoint of the serve command, the address
+// of the client that requested them
+type auditCaller struct {
+	PID        int    `json:"PID"`
+	User       string `json:"User,omitempty"`
+	Executable string `json:"Executable,omitempty"`
+	RemoteAddr string `json:"RemoteAddr,omitempty"`
+}
+
+// Audit log file, which is appended to by every signer and Credentialer of
+// the process that's configured with it
+type auditLog struct {
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	maxSize    int64
+	maxBackups int
+}
+
+// Number of rotated audit log files that are kept, if the options don't say
+const defaultAuditLogMaxBackups = 5
+
+// Audit logs that are open, by path
+var auditLogs struct {
+	sync.Mutex
+	logs map[string]*auditLog
+}
+
+// Caller of the process, which doesn't change
+var processCaller = sync.OnceValue(func() auditCaller {
+	caller := auditCaller{PID: os.Getpid()}
+	if current, err := user.Current(); err == nil {
+		caller.User = current.Username
+	}
+	if executable, err := os.Executable(); err == nil {
+		caller.Executable = executable
+	}
+	return caller
+})
+
+type auditRemoteAddrKey struct{}
+
+// Adds the address of the client that credentials are obtained for to the
+// context, so that it's recorded in the audit log
+func withAuditRemoteAddr(ctx context.Context, remoteAddr string) context.Context {
+	return context.WithValue(ctx, auditRemoteAddrKey{}, remoteAddr)
+}
+
+// Opens the audit log at the path of the options (or returns it, if it's
+// already open). It returns nil if the options don't have an audit log.
+func openAuditLog(opts *CredentialsOpts) (*auditLog, error) {
+	if opts == nil || opts.AuditLogFile == "" {
+		return nil, nil
+	}
+
+	auditLogs.Lock()
+	defer auditLogs.Unlock()
+	if log, ok := auditLogs.logs[opts.AuditLogFile]; ok {
+		return log, nil
+	}
+	file, err := openAuditLogFile(opts.AuditLogFile)
+	if err != nil {
+		return nil, err
+	}
+	if auditLogs.logs == nil {
+		auditLogs.logs = make(map[string]*auditLog)
+	}
+	log := &auditLog{path: opts.AuditLogFile, file: file, maxSize: opts.AuditLogMaxSize,
+		maxBackups: opts.AuditLogMaxBackups}
+	if log.maxBackups <= 0 {
+		log.maxBackups = defaultAuditLogMaxBackups
+	}
+	auditLogs.logs[opts.AuditLogFile] = log
+	return log, nil
+}
+
+// Synchronizes the signer (if it isn't already), and records its signatures
+// in the audit log of the options
+func auditSigner(opts *CredentialsOpts, signer Signer) (Signer, error) {
+	signer = synchronizeSigner(signer)
+	audit, err := openAuditLog(opts)
+	if err != nil || audit == nil {
+		return signer, err
+	}
+	if synchronized, ok := signer.(*synchronizedSigner); ok {
+		synchronized.mu.Lock()
+		synchronized.audit = audit
+		synchronized.mu.Unlock()
+	}
+	return signer, nil
+}
+
+// Appends the record to the audit log, as a JSON line. Failures are logged,
+// rather than returned, since the operation that's recorded already happened.
+func (log *auditLog) record(record auditRecord) {
+	if log == nil {
+		return
+	}
+	if record.Time.IsZero() {
+		record.Time = time.Now().UTC()
+	}
+	if record.Caller.PID == 0 {
+		record.Caller = processCaller()
+	}
+	if record.Outcome == "" {
+		record.Outcome = auditOutcomeSuccess
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		LogWarnf("unable to write to the audit log: %s", err)
+		return
+	}
+
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	if err = log.rotate(int64(len(line)) + 1); err != nil {
+		LogWarnf("unable to rotate the audit log: %s", err)
+	}
+	if _, err = log.file.Write(append(line, '\n')); err != nil {
+		LogWarnf("unable to write to the audit log: %s", err)
+	}
+}
+
+// Opens the audit log file for appending, with owner-only permissions
+func openAuditLogFile(path string) (*os.File, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	RepairOwnerOnlyPermissions(path)
+	return file, nil
+}
+
+// Rotates the audit log, if writing the bytes would grow it beyond its
+// maximum size. If another process (that appends to the same file) rotated
+// it already, the new file is opened instead.
+func (log *auditLog) rotate(n int64) error {
+	if log.maxSize <= 0 {
+		return nil
+	}
+	info, err := log.file.Stat()
+	if err != nil {
+		// The file couldn't be opened again after it was last rotated
+		return log.reopen()
+	}
+	if current, err := os.Stat(log.path); err != nil || !os.SameFile(info, current) {
+		return log.reopen()
+	}
+	if info.Size() == 0 || info.Size()+n <= log.maxSize {
+		return nil
+	}
+
+	os.Remove(fmt.Sprintf("%s.%d", log.path, log.maxBackups))
+	for i := log.maxBackups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", log.path, i), fmt.Sprintf("%s.%d", log.path, i+1))
+	}
+	// Open files can't be renamed on Windows, so there the file is closed
+	// first, and opened again if it still can't be renamed. Elsewhere, it's
+	// only replaced once it was renamed.
+	if runtime.GOOS == "windows" {
+		log.file.Close()
+		if err = os.Rename(log.path, log.path+".1"); err != nil {
+			log.file, _ = openAuditLogFile(log.path)
+			return err
+		}
+	} else if err = os.Rename(log.path, log.path+".1"); err != nil {
+		return err
+	}
+	return log.reopen()
+}
+
+// Opens the audit log file again (after it was rotated), and closes the
+// previous file once it was opened. If it can't be opened, records are still
+// appended to the previous file.
+func (log *auditLog) reopen() error {
+	file, err := openAuditLogFile(log.path)
+	if err != nil {
+		return err
+	}
+	log.file.Close()
+	log.file = file
+	return nil
+}
+
+// Records a signature (or a failure to sign) in the audit log
+func (log *auditLog) recordSignature(signer Signer, data []byte, opts crypto.SignerOpts, err error) {
+	if log == nil {
+		return
+	}
+	record := auditRecord{Event: auditEventSign}
+	describeAuditSigner(&record, signer)
+	if opts != nil {
+		record.DigestAlgorithm = opts.HashFunc().String()
+		if digest, digestErr := signatureDigest(data, opts); digestErr == nil {
+			record.Digest = hex.EncodeToString(digest)
+		}
+	}
+	if err != nil {
+		record.Outcome = auditOutcomeFailure
+		record.Error = err.Error()
+	}
+	log.record(record)
+}
+
+// Records credentials that were obtained from CreateSession (or a failure to
+// obtain them) in the audit log
+func (log *auditLog) recordCredentials(ctx context.Context, opts *CredentialsOpts, signer Signer, output CredentialProcessOutput, err error) {
+	if log == nil {
+		return
+	}
+	record := auditRecord{
+		Event:       auditEventCredentials,
+		RoleArn:     opts.RoleArn,
+		AccessKeyId: output.AccessKeyId,
+		Expiration:  output.Expiration,
+		Caller:      processCaller(),
+	}
+	if remoteAddr, ok := ctx.Value(auditRemoteAddrKey{}).(string); ok {
+		record.Caller.RemoteAddr = remoteAddr
+	}
+	record.CorrelationId = CorrelationIdFromContext(ctx)
+	if output.Metadata != nil {
+		record.RequestId = output.Metadata.RequestId
+	} else {
+		record.RequestId = ErrorRequestId(err)
+	}
+	describeAuditSigner(&record, signer)
+	if err != nil {
+		record.Outcome = auditOutcomeFailure
+		record.Error = err.Error()
+	}
+	log.record(record)
+}
+
+// Adds the fingerprint of the key and the serial number of the certificate of
+// the signer to the record
+func describeAuditSigner(record *auditRecord, signer Signer) {
+	if signer == nil {
+		return
+	}
+	if publicKeyDer, err := x509.MarshalPKIXPublicKey(signer.Public()); err == nil {
+		fingerprint := sha256.Sum256(publicKeyDer)
+		record.KeyFingerprint = hex.EncodeToString(fingerprint[:])
+	}
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		record.CertificateSerialNumber = certificate.SerialNumber.String()
+	}
+}
@@ -0,0 +1,131 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestAuditLog(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	auditLogFile := filepath.Join(t.TempDir(), "audit.log")
+	opts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		AuditLogFile:      auditLogFile,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(auditLogFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []auditRecord
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		var record auditRecord
+		if err = json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatal("unable to parse audit log line:", err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 2 || records[0].Event != auditEventSign || records[1].Event != auditEventCredentials {
+		t.Fatal("unexpected audit log records:", string(data))
+	}
+	certificate, _ := signer.Certificate()
+	for _, record := range records {
+		if record.Outcome != auditOutcomeSuccess || len(record.KeyFingerprint) != 64 ||
+			record.CertificateSerialNumber != certificate.SerialNumber.String() || record.Caller.PID != os.Getpid() {
+			t.Error("unexpected audit log record:", record)
+		}
+	}
+	if records[0].DigestAlgorithm != "SHA-256" || len(records[0].Digest) != 64 {
+		t.Error("unexpected digest in audit log record:", records[0])
+	}
+	if records[1].AccessKeyId != "accessKeyId" || records[1].RoleArn != opts.RoleArn {
+		t.Error("unexpected credentials in audit log record:", records[1])
+	}
+}
+
+func TestAuditLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := openAuditLog(&CredentialsOpts{AuditLogFile: path, AuditLogMaxSize: 300, AuditLogMaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		log.record(auditRecord{Event: auditEventCredentials, RoleArn: fmt.Sprintf("arn:aws:iam::000000000000:role/Role%d", i)})
+	}
+
+	var roles []string
+	for _, name := range []string{path + ".2", path + ".1", path} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(data) > 300 {
+			t.Errorf("%s wasn't rotated: %d bytes", name, len(data))
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var record auditRecord
+			if err = json.Unmarshal([]byte(line), &record); err != nil {
+				t.Fatal("unable to parse audit log line:", err)
+			}
+			roles = append(roles, strings.TrimPrefix(record.RoleArn, "arn:aws:iam::000000000000:role/"))
+		}
+	}
+	if _, err = os.Stat(path + ".3"); err == nil {
+		t.Error("more rotated files than AuditLogMaxBackups were kept")
+	}
+	// The latest records are kept, in order
+	if len(roles) == 0 || roles[len(roles)-1] != "Role9" || !sort.StringsAreSorted(roles) {
+		t.Errorf("unexpected records: %v", roles)
+	}
+
+	// Files that another process rotated are opened again
+	os.Rename(path, path+".other")
+	log.record(auditRecord{Event: auditEventCredentials, RoleArn: "arn:aws:iam::000000000000:role/Other"})
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "role/Other") {
+		t.Errorf("the file wasn't opened again: %q, %v", data, err)
+	}
+}
+
+func TestAuditLogRotationFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	log, err := openAuditLog(&CredentialsOpts{AuditLogFile: path, AuditLogMaxSize: 100, AuditLogMaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The file can't be renamed onto a directory that isn't empty
+	if err = os.MkdirAll(filepath.Join(path+".1", "dir"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		log.record(auditRecord{Event: auditEventCredentials, RoleArn: fmt.Sprintf("arn:aws:iam::000000000000:role/Role%d", i)})
+	}
+
+	// Records are still appended to the file that couldn't be rotated
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "role/Role0") || !strings.Contains(string(data), "role/Role2") {
+		t.Errorf("records were lost: %q", data)
+	}
+}
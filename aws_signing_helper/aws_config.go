@@ -0,0 +1,249 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+const AwsConfigFileEnvVarName = "AWS_CONFIG_FILE"
+
+// Prefix of the keys that hold settings of the credential helper in profiles
+// of the AWS config file (such as `rolesanywhere_trust_anchor_arn`). The rest
+// of the key is the name of the corresponding flag, with dashes replaced by
+// underscores.
+const ConfigFileSettingPrefix = "rolesanywhere_"
+
+// Returns the path to the AWS config file, which is either specified through
+// the environment or located in the default path: `~/.aws/config`
+func GetConfigFilePath() (string, error) {
+	awsConfigPath := os.Getenv(AwsConfigFileEnvVarName)
+	if awsConfigPath != "" {
+		return awsConfigPath, nil
+	}
+
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".aws", "config"), nil
+}
+
+// Returns the name of the section for the profile in the AWS config file.
+// Unlike the credentials file, named profiles in the config file have to be
+// prefixed with `profile`.
+func GetConfigFileSectionName(profileName string) string {
+	if profileName == "default" {
+		return profileName
+	}
+	return "profile " + profileName
+}
+
+// Builds the `credential_process` command line for the executable and its
+// arguments, quoting each of them so that the command line is split back into
+// the same arguments by the SDKs and the CLI on the current platform.
+func BuildCredentialProcessCommand(executable string, args []string) string {
+	if runtime.GOOS == "windows" {
+		return joinQuotedArgs(quoteWindowsArg, executable, args)
+	}
+	return joinQuotedArgs(quotePOSIXArg, executable, args)
+}
+
+// Builds a command line for a POSIX shell, regardless of the current
+// platform, for integrations that only exist on Unix-like systems (such as
+// systemd units)
+func BuildPOSIXCommand(executable string, args []string) string {
+	return joinQuotedArgs(quotePOSIXArg, executable, args)
+}
+
+func joinQuotedArgs(quote func(string) string, executable string, args []string) string {
+	quoted := make([]string, 0, len(args)+1)
+	quoted = append(quoted, quote(executable))
+	for _, arg := range args {
+		quoted = append(quoted, quote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Quotes the argument for a POSIX shell (and `shlex.split`, which the AWS CLI
+// uses). Arguments that only contain safe characters are left as-is, and all
+// others are wrapped in single quotes, within which nothing is special except
+// for the single quote itself.
+func quotePOSIXArg(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:=@,+%") == "" {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'"'"'`) + "'"
+}
+
+// Quotes the argument according to the rules that the Microsoft C runtime
+// uses to split command lines (which are also implemented by the AWS CLI on
+// Windows): backslashes are only special when they precede a double quote,
+// so those are doubled, as are any trailing backslashes before the closing
+// quote.
+func quoteWindowsArg(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n\v\"") {
+		return arg
+	}
+
+	var b strings.Builder
+	b.WriteByte('"')
+	backslashes := 0
+	for i := 0; i < len(arg); i++ {
+		c := arg[i]
+		switch c {
+		case '\\':
+			backslashes++
+			continue
+		case '"':
+			b.WriteString(strings.Repeat(`\`, backslashes*2+1))
+		default:
+			b.WriteString(strings.Repeat(`\`, backslashes))
+		}
+		backslashes = 0
+		b.WriteByte(c)
+	}
+	b.WriteString(strings.Repeat(`\`, backslashes*2))
+	b.WriteByte('"')
+	return b.String()
+}
+
+// Writes the `credential_process` command line into the profile's section of
+// the AWS config file, creating the file and the profile if they don't exist.
+// Other profiles, comments, and settings within the profile are preserved.
+// Returns the path to the config file that was written.
+func WriteCredentialProcessProfile(profileName string, command string) (string, error) {
+	return writeConfigFileProfile(profileName, []iniKeyValue{
+		{"credential_process", command},
+	})
+}
+
+// Writes the settings through which the AWS CLI reads the cache entries for a
+// session into the profile's section of the AWS config file, in the same way
+// as WriteCredentialProcessProfile. Returns the path to the config file that
+// was written.
+func WriteCLICacheProfile(profileName string, cacheProfile CLICacheProfile) (string, error) {
+	return writeConfigFileProfile(profileName, []iniKeyValue{
+		{"sso_start_url", cacheProfile.StartURL},
+		{"sso_region", cacheProfile.Region},
+		{"sso_account_id", cacheProfile.AccountId},
+		{"sso_role_name", cacheProfile.RoleName},
+	})
+}
+
+// Sets the keys within the profile's section of the AWS config file, creating
+// the file and the profile if they don't exist
+func writeConfigFileProfile(profileName string, keyValues []iniKeyValue) (string, error) {
+	awsConfigPath, err := GetConfigFilePath()
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(awsConfigPath), 0700); err != nil {
+		return "", err
+	}
+
+	var lines []string
+	contents, err := os.ReadFile(awsConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if len(contents) > 0 {
+		lines = strings.Split(strings.TrimSuffix(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n"), "\n")
+	}
+
+	newLines := setINISectionKeys(lines, GetConfigFileSectionName(profileName), keyValues)
+	newContents := strings.Join(newLines, "\n")
+	if !strings.HasSuffix(newContents, "\n") {
+		newContents += "\n"
+	}
+
+	if err = writeFileAtomic(awsConfigPath, []byte(newContents)); err != nil {
+		return "", err
+	}
+	return awsConfigPath, nil
+}
+
+// Reads the settings of the credential helper from the profile in the AWS
+// config file, keyed by their names without the prefix (such as
+// `trust_anchor_arn`). Other settings of the profile are ignored.
+func ReadConfigFileProfileSettings(profileName string) (map[string]string, error) {
+	awsConfigPath, err := GetConfigFilePath()
+	if err != nil {
+		return nil, err
+	}
+	contents, err := os.ReadFile(awsConfigPath)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read AWS config file: %w", err)
+	}
+	lines := strings.Split(strings.ReplaceAll(string(contents), "\r\n", "\n"), "\n")
+
+	values, ok := getINISectionValues(lines, GetConfigFileSectionName(profileName))
+	if !ok {
+		return nil, fmt.Errorf("profile %s not found in the AWS config file %s", profileName, awsConfigPath)
+	}
+	settings := make(map[string]string)
+	for key, value := range values {
+		if name, ok := strings.CutPrefix(key, ConfigFileSettingPrefix); ok && name != "" {
+			settings[name] = value
+		}
+	}
+	return settings, nil
+}
+
+// Creates the options for a Credentialer from the settings of the profile in
+// the AWS config file, as in:
+//
+//	[profile edge-router]
+//	rolesanywhere_trust_anchor_arn = arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/...
+//	rolesanywhere_profile_arn = arn:aws:rolesanywhere:us-east-1:000000000000:profile/...
+//	rolesanywhere_role_arn = arn:aws:iam::000000000000:role/EdgeRouter
+//	rolesanywhere_certificate = /etc/rolesanywhere/cert.pem
+//	rolesanywhere_private_key = /etc/rolesanywhere/key.pem
+//
+// Settings that only apply to commands of the credential helper (such as
+// `rolesanywhere_cert_selector` or `rolesanywhere_port`) are ignored.
+func LoadCredentialsOptsFromConfigFileProfile(profileName string) (*CredentialsOpts, error) {
+	settings, err := ReadConfigFileProfileSettings(profileName)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := CredentialsOpts{SessionDuration: 3600}
+	stringSettings := map[string]*string{
+		"trust_anchor_arn":       &opts.TrustAnchorArnStr,
+		"profile_arn":            &opts.ProfileArnStr,
+		"role_arn":               &opts.RoleArn,
+		"role_session_name":      &opts.RoleSessionName,
+		"region":                 &opts.Region,
+		"endpoint":               &opts.Endpoint,
+		"certificate":            &opts.CertificateId,
+		"private_key":            &opts.PrivateKeyId,
+		"intermediates":          &opts.CertificateBundleId,
+		"pkcs11_lib":             &opts.LibPkcs11,
+		"spiffe_endpoint_socket": &opts.SpiffeEndpointSocket,
+		"spiffe_id":              &opts.SpiffeId,
+		"kubernetes_secret":      &opts.KubernetesSecret,
+	}
+	boolSettings := map[string]*bool{
+		"no_verify_ssl": &opts.NoVerifySSL,
+		"with_proxy":    &opts.WithProxy,
+		"reuse_pin":     &opts.ReusePin,
+	}
+	for name, value := range settings {
+		if field, ok := stringSettings[name]; ok {
+			*field = value
+		} else if field, ok := boolSettings[name]; ok {
+			if *field, err = strconv.ParseBool(value); err != nil {
+				return nil, fmt.Errorf("invalid value for %s%s in profile %s: %w", ConfigFileSettingPrefix, name, profileName, err)
+			}
+		} else if name == "session_duration" {
+			if opts.SessionDuration, err = strconv.Atoi(value); err != nil {
+				return nil, fmt.Errorf("invalid value for %s%s in profile %s: %w", ConfigFileSettingPrefix, name, profileName, err)
+			}
+		}
+	}
+	return &opts, nil
+}
@@ -0,0 +1,125 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestQuoteCredentialProcessArgs(t *testing.T) {
+	testTable := []struct {
+		arg           string
+		expectedPOSIX string
+		expectedWin   string
+	}{
+		{"arn:aws:iam::000000000000:role/Role", "arn:aws:iam::000000000000:role/Role", "arn:aws:iam::000000000000:role/Role"},
+		{"/path with spaces/cert.pem", "'/path with spaces/cert.pem'", `"/path with spaces/cert.pem"`},
+		{`C:\Program Files\helper\`, `'C:\Program Files\helper\'`, `"C:\Program Files\helper\\"`},
+		{`it's "quoted"`, `'it'"'"'s "quoted"'`, `"it's \"quoted\""`},
+		{`a\"b`, `'a\"b'`, `"a\\\"b"`},
+		{"", "''", `""`},
+	}
+	for _, tc := range testTable {
+		if quoted := quotePOSIXArg(tc.arg); quoted != tc.expectedPOSIX {
+			t.Logf("unexpected POSIX quoting of %q: %s", tc.arg, quoted)
+			t.Fail()
+		}
+		if quoted := quoteWindowsArg(tc.arg); quoted != tc.expectedWin {
+			t.Logf("unexpected Windows quoting of %q: %s", tc.arg, quoted)
+			t.Fail()
+		}
+	}
+}
+
+func TestWriteCredentialProcessProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config")
+	t.Setenv(AwsConfigFileEnvVarName, configPath)
+
+	inputFileContents := `# managed by hand
+[default]
+region = us-east-1
+
+[profile test]
+region = us-west-2
+credential_process = old
+`
+	if err := os.WriteFile(configPath, []byte(inputFileContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := WriteCredentialProcessProfile("test", "helper credential-process"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := WriteCredentialProcessProfile("new", "helper credential-process --role-arn role"); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedFileContents := `# managed by hand
+[default]
+region = us-east-1
+
+[profile test]
+region = us-west-2
+credential_process = helper credential-process
+[profile new]
+credential_process = helper credential-process --role-arn role
+`
+	fileByteContents, _ := os.ReadFile(configPath)
+	if string(fileByteContents) != expectedFileContents {
+		t.Log("unexpected config file contents:", string(fileByteContents))
+		t.Fail()
+	}
+}
+
+func TestLoadCredentialsOptsFromConfigFileProfile(t *testing.T) {
+	awsConfigPath := filepath.Join(t.TempDir(), "config")
+	awsConfigContents := `[default]
+rolesanywhere_role_arn = arn:aws:iam::000000000000:role/DefaultRole
+
+[profile edge-router]
+region = eu-west-1
+rolesanywhere_trust_anchor_arn = arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68
+rolesanywhere_profile_arn = arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380
+rolesanywhere_role_arn = arn:aws:iam::000000000000:role/ExampleS3WriteRole
+rolesanywhere_certificate = ../tst/certs/rsa-2048-sha256-cert.pem
+rolesanywhere_private_key = ../tst/certs/rsa-2048-key.pem
+rolesanywhere_session_duration = 900
+rolesanywhere_with_proxy = true
+rolesanywhere_port = 9912
+
+[profile invalid]
+rolesanywhere_session_duration = an hour
+`
+	if err := os.WriteFile(awsConfigPath, []byte(awsConfigContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(AwsConfigFileEnvVarName, awsConfigPath)
+
+	opts, err := LoadCredentialsOptsFromConfigFileProfile("edge-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedOpts := CredentialsOpts{
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		SessionDuration:   900,
+		WithProxy:         true,
+	}
+	if !reflect.DeepEqual(*opts, expectedOpts) {
+		t.Errorf("unexpected options: %+v", *opts)
+	}
+
+	if opts, err = LoadCredentialsOptsFromConfigFileProfile("default"); err != nil ||
+		opts.RoleArn != "arn:aws:iam::000000000000:role/DefaultRole" || opts.SessionDuration != 3600 {
+		t.Errorf("unexpected options for the default profile: %+v, %v", opts, err)
+	}
+	for _, profileName := range []string{"invalid", "does-not-exist"} {
+		if _, err = LoadCredentialsOptsFromConfigFileProfile(profileName); err == nil {
+			t.Errorf("loaded options from profile %s", profileName)
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package aws_signing_helper
+
+import (
+	"sort"
+)
+
+// Names of the signing backends that are compiled into the binary
+var backends []string
+
+// Registers a signing backend as being compiled into the binary. Backends call
+// this from their init function, so that it reflects the build configuration
+// (such as the target OS) that the binary was built with.
+func registerBackend(name string) {
+	backends = append(backends, name)
+}
+
+// Returns the names of the signing backends that are compiled into the binary
+func Backends() []string {
+	names := append([]string{}, backends...)
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,32 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUnavailableBackends(t *testing.T) {
+	backends := map[string]bool{}
+	for _, backend := range Backends() {
+		backends[backend] = true
+	}
+	if !backends["file"] {
+		t.Error("file backend isn't compiled in")
+	}
+
+	optsByBackend := map[string]CredentialsOpts{
+		"pkcs11": {CertificateId: "pkcs11:token=credential-helper-test;object=rsa-2048?pin-value=1234"},
+		"tpm": {
+			CertificateId: "../tst/certs/rsa-2048-sha256-cert.pem",
+			PrivateKeyId:  "handle:0x81000001",
+		},
+	}
+	for backend, opts := range optsByBackend {
+		if backends[backend] {
+			continue
+		}
+		if _, _, err := GetSigner(&opts); !errors.Is(err, ErrBackendUnavailable) {
+			t.Errorf("unexpected error for the %s backend, which isn't compiled in: %v", backend, err)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Largest buffer that's returned to the pool. Larger ones (such as those of
+// requests with unusually long certificate chains) are left to the garbage
+// collector, so that the pool doesn't hold on to them.
+const maxPooledBufferSize = 64 << 10
+
+// Buffers that requests of the local endpoint, and the signing of
+// CreateSession requests, serialize and hash into, so that a busy endpoint
+// doesn't allocate new ones for each request
+var bufferPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// Returns an empty buffer from the pool
+func getBuffer() *bytes.Buffer {
+	buffer := bufferPool.Get().(*bytes.Buffer)
+	buffer.Reset()
+	return buffer
+}
+
+// Returns the buffer to the pool. It can't be used afterwards (and neither can
+// slices of its contents). Its whole capacity is zeroed first, since buffers
+// hold serialized credentials and tokens that mustn't outlive the request.
+func putBuffer(buffer *bytes.Buffer) {
+	if buffer.Cap() > maxPooledBufferSize {
+		return
+	}
+	buffer.Reset()
+	clear(buffer.Bytes()[:buffer.Cap()])
+	bufferPool.Put(buffer)
+}
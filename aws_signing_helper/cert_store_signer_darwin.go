@@ -1,4 +1,4 @@
-//go:build darwin
+//go:build darwin && cgo && !nocertstore
 
 package aws_signing_helper
 
@@ -16,16 +16,20 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"unsafe"
 )
 
+// Name of the backend, as returned by Backends
+const darwinKeychainBackend = "darwin-keychain"
+
+func init() {
+	registerBackend(darwinKeychainBackend)
+}
+
 type DarwinCertStoreSigner struct {
 	identRef  C.SecIdentityRef
 	keyRef    C.SecKeyRef
@@ -81,9 +85,7 @@ func GetMatchingCertsAndIdentity(certIdentifier CertIdentifier) (C.SecIdentityRe
 		}
 		curCert, err := exportCertRef(curCertRef)
 		if err != nil {
-			if Debug {
-				log.Printf("unable to parse certificate with error (%s) - skipping\n", err)
-			}
+			signerLog.debugf("unable to parse certificate with error (%s) - skipping", err)
 			goto nextIteration
 		}
 
@@ -103,9 +105,7 @@ func GetMatchingCertsAndIdentity(certIdentifier CertIdentifier) (C.SecIdentityRe
 	nextIteration:
 	}
 
-	if Debug {
-		log.Printf("found %d matching identities\n", len(certContainers))
-	}
+	signerLog.debugf("found %d matching identities", len(certContainers))
 
 	// Only retain the SecIdentityRef if it should be used later on
 	// Note that only the SecIdentityRef needs to be retained since it was neither created nor copied
@@ -148,7 +148,7 @@ func GetCertStoreSigner(certIdentifier CertIdentifier) (signer Signer, signingAl
 	case *rsa.PublicKey:
 		signingAlgorithm = aws4_x509_rsa_sha256
 	default:
-		return nil, "", errors.New("unsupported algorithm")
+		return nil, "", ErrUnsupportedAlgorithm
 	}
 
 	keyRef, err := getKeyRef(identRef)
@@ -241,6 +241,10 @@ func (signer *DarwinCertStoreSigner) Public() crypto.PublicKey {
 	return cert.PublicKey
 }
 
+func (signer *DarwinCertStoreSigner) backendName() string {
+	return darwinKeychainBackend
+}
+
 // Closes the DarwinCertStoreSigner
 func (signer *DarwinCertStoreSigner) Close() {
 	if signer.identRef != 0 {
@@ -261,19 +265,9 @@ func (signer *DarwinCertStoreSigner) Close() {
 
 // Sign implements the crypto.Signer interface and signs the digest
 func (signer *DarwinCertStoreSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	var hash []byte
-	switch opts.HashFunc() {
-	case crypto.SHA256:
-		sum := sha256.Sum256(digest)
-		hash = sum[:]
-	case crypto.SHA384:
-		sum := sha512.Sum384(digest)
-		hash = sum[:]
-	case crypto.SHA512:
-		sum := sha512.Sum512(digest)
-		hash = sum[:]
-	default:
-		return nil, ErrUnsupportedHash
+	hash, err := signatureDigest(digest, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	keyRef, err := signer.getKeyRef()
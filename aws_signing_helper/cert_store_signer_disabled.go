@@ -0,0 +1,19 @@
+//go:build !(darwin || windows) || !cgo || nocertstore
+
+package aws_signing_helper
+
+import (
+	"fmt"
+)
+
+// Certificate stores are only supported on macOS and Windows, in binaries that
+// are built with cgo and without the nocertstore tag
+var errCertStoreUnavailable = fmt.Errorf("%w: unable to use cert store signer in this build", ErrBackendUnavailable)
+
+func GetMatchingCerts(certIdentifier CertIdentifier) ([]CertificateContainer, error) {
+	return nil, errCertStoreUnavailable
+}
+
+func GetCertStoreSigner(certIdentifier CertIdentifier) (signer Signer, signingAlgorithm string, err error) {
+	return nil, "", errCertStoreUnavailable
+}
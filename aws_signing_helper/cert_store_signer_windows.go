@@ -1,4 +1,4 @@
-//go:build windows
+//go:build windows && cgo && !nocertstore
 
 package aws_signing_helper
 
@@ -33,19 +33,23 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"golang.org/x/sys/windows"
 	"io"
-	"log"
 	"strconv"
 	"strings"
 	"unsafe"
 )
 
+// Name of the backend, as returned by Backends
+const windowsCertStoreBackend = "windows-cert-store"
+
+func init() {
+	registerBackend(windowsCertStoreBackend)
+}
+
 // winPrivateKey is a wrapper around a HCRYPTPROV_OR_NCRYPT_KEY_HANDLE.
 type winPrivateKey struct {
 	publicKey crypto.PublicKey
@@ -203,9 +207,7 @@ func GetMatchingCertsAndChain(certIdentifier CertIdentifier) (store windows.Hand
 			curCertCtx = chainElts[j].CertContext
 			x509CertChain[j], err = exportCertContext(curCertCtx)
 			if err != nil {
-				if Debug {
-					log.Printf("unable to parse certificate with error (%s) - skipping\n", err)
-				}
+				signerLog.debugf("unable to parse certificate with error (%s) - skipping", err)
 				goto nextIteration
 			}
 		}
@@ -230,9 +232,7 @@ func GetMatchingCertsAndChain(certIdentifier CertIdentifier) (store windows.Hand
 	nextIteration:
 	}
 
-	if Debug {
-		log.Printf("found %d matching identities\n", len(certContainers))
-	}
+	signerLog.debugf("found %d matching identities", len(certContainers))
 
 	return store, certCtx, certChain, certContainers, nil
 
@@ -289,7 +289,7 @@ func GetCertStoreSigner(certIdentifier CertIdentifier) (signer Signer, signingAl
 	case *rsa.PublicKey:
 		signingAlgorithm = aws4_x509_rsa_sha256
 	default:
-		err = errors.New("unsupported algorithm")
+		err = ErrUnsupportedAlgorithm
 		goto fail
 	}
 
@@ -321,6 +321,10 @@ func (signer *WindowsCertStoreSigner) CertificateChain() ([]*x509.Certificate, e
 	return signer.certChain, nil
 }
 
+func (signer *WindowsCertStoreSigner) backendName() string {
+	return windowsCertStoreBackend
+}
+
 // Close implements the aws_signing_helper.Signer interface and closes the signer
 func (signer *WindowsCertStoreSigner) Close() {
 	if signer.privateKey != nil && signer.privateKey.mustFree {
@@ -410,19 +414,9 @@ func (signer *WindowsCertStoreSigner) Public() crypto.PublicKey {
 
 // Sign implements the crypto.Signer interface and signs the digest
 func (signer *WindowsCertStoreSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
-	var hash []byte
-	switch opts.HashFunc() {
-	case crypto.SHA256:
-		sum := sha256.Sum256(digest)
-		hash = sum[:]
-	case crypto.SHA384:
-		sum := sha512.Sum384(digest)
-		hash = sum[:]
-	case crypto.SHA512:
-		sum := sha512.Sum512(digest)
-		hash = sum[:]
-	default:
-		return nil, ErrUnsupportedHash
+	hash, err := signatureDigest(digest, opts)
+	if err != nil {
+		return nil, err
 	}
 
 	privateKey, err := signer.getPrivateKey()
@@ -0,0 +1,133 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checks that the certificate of the signer and its chain are valid at the
+// signing time, so that CreateSession isn't called with a certificate that
+// Roles Anywhere would reject. If the certificate expires within the warning
+// window of the options, a warning is logged and reported through the hooks.
+// Signers whose certificate can't be read are left for the call to fail.
+func checkCertificateValidity(opts *CredentialsOpts, signer Signer, now time.Time) error {
+	if opts.NoCertificateValidityCheck {
+		return nil
+	}
+	certificate, err := signer.Certificate()
+	if err != nil || certificate == nil {
+		return nil
+	}
+	chain, _ := signer.CertificateChain()
+	for _, cert := range append([]*x509.Certificate{certificate}, chain...) {
+		if cert == nil {
+			continue
+		}
+		if now.Before(cert.NotBefore) {
+			return fmt.Errorf("%w: the certificate with serial number %s, issued to %s, isn't valid until %s "+
+				"(the system clock may be wrong; check that it's synchronized, for example through NTP)",
+				ErrCertificateExpired, cert.SerialNumber, cert.Subject, cert.NotBefore.UTC().Format(time.RFC3339))
+		}
+		if now.After(cert.NotAfter) {
+			return fmt.Errorf("%w: the certificate with serial number %s, issued to %s, expired at %s",
+				ErrCertificateExpired, cert.SerialNumber, cert.Subject, cert.NotAfter.UTC().Format(time.RFC3339))
+		}
+	}
+
+	remaining := certificate.NotAfter.Sub(now)
+	if opts.CertificateExpiryWarningWindow > 0 && remaining < opts.CertificateExpiryWarningWindow {
+		LogWarnf("the certificate with serial number %s, issued to %s, expires in %s (at %s); it should be renewed",
+			certificate.SerialNumber, certificate.Subject, remaining.Truncate(time.Minute),
+			certificate.NotAfter.UTC().Format(time.RFC3339))
+		opts.Hooks.certificateExpiring(CertificateExpiryEvent{certificate, certificate.NotAfter, remaining})
+	}
+	return nil
+}
+
+// Extended key usages that certificates have to allow by default
+var defaultRequiredExtKeyUsages = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+
+// Returns the required extended key usages that the certificate doesn't
+// allow. Certificates without an extended key usage extension (or with the
+// anyExtendedKeyUsage purpose) allow all of them.
+func missingExtKeyUsages(certificate *x509.Certificate, required []x509.ExtKeyUsage) []x509.ExtKeyUsage {
+	if len(certificate.ExtKeyUsage) == 0 && len(certificate.UnknownExtKeyUsage) == 0 {
+		return nil
+	}
+	var missing []x509.ExtKeyUsage
+	for _, usage := range required {
+		found := false
+		for _, allowed := range certificate.ExtKeyUsage {
+			if allowed == usage || allowed == x509.ExtKeyUsageAny {
+				found = true
+			}
+		}
+		if !found {
+			missing = append(missing, usage)
+		}
+	}
+	return missing
+}
+
+// Checks that the key usage extension of the certificate (if it has one)
+// includes digitalSignature, and that its extended key usage extension (if
+// it has one) includes the required extended key usages (by default,
+// clientAuth), so that misprovisioned certificates are diagnosed before
+// Roles Anywhere rejects them
+func checkCertificateKeyUsage(certificate *x509.Certificate, required []x509.ExtKeyUsage) error {
+	if certificate.KeyUsage != 0 && certificate.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		return fmt.Errorf("%w: the key usage extension of the certificate with serial number %s, issued to %s, "+
+			"doesn't include digitalSignature", ErrCertificateKeyUsage, certificate.SerialNumber, certificate.Subject)
+	}
+	if required == nil {
+		required = defaultRequiredExtKeyUsages
+	}
+	if missing := missingExtKeyUsages(certificate, required); len(missing) > 0 {
+		return fmt.Errorf("%w: the extended key usage extension of the certificate with serial number %s, issued to %s, "+
+			"doesn't include %s", ErrCertificateKeyUsage, certificate.SerialNumber, certificate.Subject,
+			formatExtKeyUsages(missing))
+	}
+	return nil
+}
+
+// Names of extended key usages, as used by OpenSSL
+var extKeyUsageNames = map[x509.ExtKeyUsage]string{
+	x509.ExtKeyUsageAny:             "anyExtendedKeyUsage",
+	x509.ExtKeyUsageServerAuth:      "serverAuth",
+	x509.ExtKeyUsageClientAuth:      "clientAuth",
+	x509.ExtKeyUsageCodeSigning:     "codeSigning",
+	x509.ExtKeyUsageEmailProtection: "emailProtection",
+	x509.ExtKeyUsageTimeStamping:    "timeStamping",
+	x509.ExtKeyUsageOCSPSigning:     "OCSPSigning",
+}
+
+// Parses the name of an extended key usage (such as clientAuth), as used by
+// OpenSSL
+func ParseExtKeyUsage(name string) (x509.ExtKeyUsage, error) {
+	for usage, usageName := range extKeyUsageNames {
+		if strings.EqualFold(name, usageName) {
+			return usage, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown extended key usage %q (one of %s)", name, formatExtKeyUsages(sortedExtKeyUsages()))
+}
+
+func sortedExtKeyUsages() []x509.ExtKeyUsage {
+	usages := make([]x509.ExtKeyUsage, 0, len(extKeyUsageNames))
+	for usage := range extKeyUsageNames {
+		usages = append(usages, usage)
+	}
+	sort.Slice(usages, func(i, j int) bool { return usages[i] < usages[j] })
+	return usages
+}
+
+func formatExtKeyUsages(usages []x509.ExtKeyUsage) string {
+	names := make([]string, len(usages))
+	for i, usage := range usages {
+		names[i] = extKeyUsageNames[usage]
+	}
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,156 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCertificateValidity(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newSigner := func(notBefore, notAfter time.Time) Signer {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    notBefore,
+			NotAfter:     notAfter,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate, _ := x509.ParseCertificate(der)
+		signer, _, err := NewCryptoSigner(key, certificate, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+
+	now := time.Now()
+	for _, tc := range []struct {
+		name      string
+		notBefore time.Time
+		notAfter  time.Time
+		noCheck   bool
+		expired   bool
+		warned    bool
+	}{
+		{"valid", now.Add(-time.Hour), now.Add(90 * 24 * time.Hour), false, false, false},
+		{"expiring", now.Add(-time.Hour), now.Add(24 * time.Hour), false, false, true},
+		{"expired", now.Add(-2 * time.Hour), now.Add(-time.Hour), false, true, false},
+		{"not-yet-valid", now.Add(time.Hour), now.Add(2 * time.Hour), false, true, false},
+		{"expired-unchecked", now.Add(-2 * time.Hour), now.Add(-time.Hour), true, false, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var warnings []CertificateExpiryEvent
+			opts := CredentialsOpts{
+				TrustAnchorArnStr:              "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+				ProfileArnStr:                  "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+				RoleArn:                        "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				SessionDuration:                900,
+				Endpoint:                       server.URL,
+				CertificateExpiryWarningWindow: 30 * 24 * time.Hour,
+				NoCertificateValidityCheck:     tc.noCheck,
+				Hooks: Hooks{
+					OnCertificateExpiring: func(event CertificateExpiryEvent) { warnings = append(warnings, event) },
+				},
+			}
+			signer := newSigner(tc.notBefore, tc.notAfter)
+			defer signer.Close()
+
+			sent := requests.Load()
+			_, err := GenerateCredentials(&opts, signer, "SHA256")
+			if errors.Is(err, ErrCertificateExpired) != tc.expired {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if (requests.Load() == sent) != tc.expired {
+				t.Errorf("expected CreateSession to be called only with a valid certificate")
+			}
+			if (len(warnings) == 1) != tc.warned || (tc.warned && warnings[0].Remaining > 24*time.Hour) {
+				t.Errorf("unexpected expiry warnings: %v", warnings)
+			}
+		})
+	}
+}
+
+func TestCertificateKeyUsage(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	keyDer, _ := x509.MarshalPKCS8PrivateKey(key)
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.pem")
+	os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0600)
+
+	for _, tc := range []struct {
+		name        string
+		keyUsage    x509.KeyUsage
+		extKeyUsage []x509.ExtKeyUsage
+		required    []x509.ExtKeyUsage
+		noCheck     bool
+		rejected    bool
+	}{
+		{"no-extensions", 0, nil, nil, false, false},
+		{"client-auth", x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil, false, false},
+		{"any", x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageAny}, nil, false, false},
+		{"no-digital-signature", x509.KeyUsageKeyEncipherment, nil, nil, false, true},
+		{"server-auth", x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil, false, true},
+		{"required", x509.KeyUsageDigitalSignature, []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageCodeSigning}, false, true},
+		{"unchecked", x509.KeyUsageKeyEncipherment, []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, nil, true, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			template := &x509.Certificate{
+				SerialNumber: big.NewInt(1),
+				Subject:      pkix.Name{CommonName: "test"},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				KeyUsage:     tc.keyUsage,
+				ExtKeyUsage:  tc.extKeyUsage,
+			}
+			der, _ := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+			certPath := filepath.Join(dir, tc.name+".pem")
+			os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+
+			opts := CredentialsOpts{
+				PrivateKeyId:         keyPath,
+				CertificateId:        certPath,
+				RequiredExtKeyUsages: tc.required,
+				NoKeyUsageCheck:      tc.noCheck,
+			}
+			signer, _, err := GetSigner(&opts)
+			if errors.Is(err, ErrCertificateKeyUsage) != tc.rejected {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err == nil {
+				signer.Close()
+			}
+		})
+	}
+
+	if usage, err := ParseExtKeyUsage("clientauth"); err != nil || usage != x509.ExtKeyUsageClientAuth {
+		t.Errorf("unexpected extended key usage %v: %v", usage, err)
+	}
+	if _, err := ParseExtKeyUsage("signing"); err == nil {
+		t.Error("expected an unknown extended key usage to be rejected")
+	}
+}
@@ -0,0 +1,150 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+const (
+	// Update targets supported by the `update` command
+	UpdateTargetCredentialsFile = "credentials-file"
+	UpdateTargetCLICache        = "cli-cache"
+
+	CLICacheProviderType = "rolesanywhere"
+)
+
+// How long before they expire the AWS CLI stops using cached credentials, so
+// that entries are refreshed at least this long before they expire
+const cliCacheExpiryWindow = 15 * time.Minute
+
+// Structure of an entry in the AWS CLI's JSON credential cache, in the format
+// that its SSO credential provider writes for the role credentials that it
+// obtains, and reads back while they haven't expired.
+type CLICacheEntry struct {
+	ProviderType string             `json:"ProviderType"`
+	Credentials  CLICacheCredential `json:"Credentials"`
+}
+
+type CLICacheCredential struct {
+	AccessKeyId     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	SessionToken    string `json:"SessionToken"`
+	Expiration      string `json:"Expiration"`
+	AccountId       string `json:"AccountId,omitempty"`
+}
+
+// Settings of a profile in the AWS config file whose SSO credential provider
+// looks up the cache entries for a session. The AWS CLI reads the cache entry
+// that's named after these settings before it calls IAM Identity Center, so as
+// long as the entry is kept fresh, it uses the Roles Anywhere credentials in it.
+type CLICacheProfile struct {
+	StartURL  string // sso_start_url, which is the Roles Anywhere profile ARN
+	Region    string // sso_region
+	AccountId string // sso_account_id
+	RoleName  string // sso_role_name
+}
+
+// Returns the settings of the profile in the AWS config file through which
+// the AWS CLI reads the cache entries for the session
+func GetCLICacheProfile(opts *CredentialsOpts) (CLICacheProfile, error) {
+	profileArn, err := arn.Parse(opts.ProfileArnStr)
+	if err != nil {
+		return CLICacheProfile{}, fmt.Errorf("%w %q for the profile: %s", ErrInvalidArn, opts.ProfileArnStr, err)
+	}
+	roleArn, err := arn.Parse(opts.RoleArn)
+	if err != nil || !strings.HasPrefix(roleArn.Resource, "role/") {
+		return CLICacheProfile{}, fmt.Errorf("%w %q for the role", ErrInvalidArn, opts.RoleArn)
+	}
+	return CLICacheProfile{
+		StartURL:  opts.ProfileArnStr,
+		Region:    profileArn.Region,
+		AccountId: roleArn.AccountID,
+		RoleName:  strings.TrimPrefix(roleArn.Resource, "role/"),
+	}, nil
+}
+
+// Derives the cache key in the same way as the AWS CLI's SSO credential
+// provider: a SHA-1 hash of the start URL, role name, and account ID, encoded
+// as JSON with sorted keys and without whitespace.
+func (p CLICacheProfile) CacheKey() string {
+	var keyData bytes.Buffer
+	encoder := json.NewEncoder(&keyData)
+	encoder.SetEscapeHTML(false)
+	// Map keys are sorted by encoding/json
+	_ = encoder.Encode(map[string]string{
+		"accountId": p.AccountId,
+		"roleName":  p.RoleName,
+		"startUrl":  p.StartURL,
+	})
+	sum := sha1.Sum(bytes.TrimSuffix(keyData.Bytes(), []byte("\n"))) // nosemgrep
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns the cache key of the session's entry, which is either the one that
+// was specified or the one that the AWS CLI looks up for the session's profile
+func GetCLICacheKey(opts *CredentialsOpts) (string, error) {
+	if opts.CLICacheKey != "" {
+		return opts.CLICacheKey, nil
+	}
+	cacheProfile, err := GetCLICacheProfile(opts)
+	if err != nil {
+		return "", err
+	}
+	return cacheProfile.CacheKey(), nil
+}
+
+// Returns the directory that the AWS CLI uses for its JSON credential cache
+func GetCLICacheDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".aws", "cli", "cache"), nil
+}
+
+// Writes the temporary credential to the AWS CLI's JSON credential cache,
+// returning the path of the cache entry.
+func WriteCLICacheEntry(cacheKey string, accountId string, cred *TemporaryCredential) (string, error) {
+	if cacheKey == "" || cacheKey != filepath.Base(cacheKey) {
+		return "", errors.New("invalid AWS CLI cache key")
+	}
+
+	cacheDir, err := GetCLICacheDir()
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(cacheDir, 0700); err != nil {
+		return "", err
+	}
+
+	entry := CLICacheEntry{
+		ProviderType: CLICacheProviderType,
+		Credentials: CLICacheCredential{
+			AccessKeyId:     cred.AccessKeyId,
+			SecretAccessKey: cred.SecretAccessKey,
+			SessionToken:    cred.SessionToken, // nosemgrep
+			Expiration:      cred.Expiration.UTC().Format(time.RFC3339),
+			AccountId:       accountId,
+		},
+	}
+	buf, err := json.Marshal(entry)
+	if err != nil {
+		return "", err
+	}
+
+	cachePath := filepath.Join(cacheDir, cacheKey+".json")
+	if err = writeFileAtomic(cachePath, buf); err != nil {
+		return "", err
+	}
+	return cachePath, nil
+}
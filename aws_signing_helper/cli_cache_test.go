@@ -0,0 +1,113 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCLICacheKey(t *testing.T) {
+	cacheProfile, err := GetCLICacheProfile(&CredentialsOpts{
+		RoleArn:       "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedProfile := CLICacheProfile{
+		StartURL:  "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Region:    "us-east-1",
+		AccountId: "000000000000",
+		RoleName:  "ExampleS3WriteRole",
+	}
+	if cacheProfile != expectedProfile {
+		t.Errorf("unexpected profile settings: %+v", cacheProfile)
+	}
+
+	// Computed as the AWS CLI's SSO credential provider does:
+	// sha1(json.dumps(args, sort_keys=True, separators=(',', ':')))
+	if key := cacheProfile.CacheKey(); key != "2be088d2c320f2775e2982ce32c10de1542e6d8e" {
+		t.Errorf("unexpected cache key: %s", key)
+	}
+
+	if _, err = GetCLICacheProfile(&CredentialsOpts{
+		RoleArn:       "arn:aws:iam::000000000000:user/Example",
+		ProfileArnStr: expectedProfile.StartURL,
+	}); err == nil {
+		t.Error("expected an error for an ARN that isn't a role")
+	}
+}
+
+func TestUpdateCLICache(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		UpdateTarget:      UpdateTargetCLICache,
+		CLICacheKey:       "test-cache-key",
+	}
+	homeDir := t.TempDir()
+	t.Setenv("HOME", homeDir)
+	t.Setenv("USERPROFILE", homeDir)
+
+	Update(credentialsOpts, "", true)
+
+	cacheDir, _ := GetCLICacheDir()
+	fileByteContents, err := os.ReadFile(filepath.Join(cacheDir, "test-cache-key.json"))
+	if err != nil {
+		t.Log("unable to read AWS CLI cache entry")
+		t.Fail()
+		return
+	}
+	var entry CLICacheEntry
+	if err = json.Unmarshal(fileByteContents, &entry); err != nil {
+		t.Log("unable to parse AWS CLI cache entry")
+		t.Fail()
+		return
+	}
+	if entry.Credentials.AccessKeyId != "accessKeyId" ||
+		entry.Credentials.SecretAccessKey != "secretAccessKey" ||
+		entry.Credentials.SessionToken != "sessionToken" ||
+		entry.Credentials.Expiration != "2022-07-27T04:36:55Z" {
+		t.Log("unexpected AWS CLI cache entry contents")
+		t.Fail()
+	}
+
+	// Without a cache key, the entry is named after the SSO settings that are
+	// written into the profile
+	configPath := filepath.Join(homeDir, "config")
+	t.Setenv(AwsConfigFileEnvVarName, configPath)
+	credentialsOpts.CLICacheKey = ""
+	if err = Update(credentialsOpts, "rolesanywhere", true); err != nil {
+		t.Fatal(err)
+	}
+	fileByteContents, err = os.ReadFile(filepath.Join(cacheDir, "2be088d2c320f2775e2982ce32c10de1542e6d8e.json"))
+	if err != nil {
+		t.Fatal("unable to read AWS CLI cache entry:", err)
+	}
+	entry = CLICacheEntry{}
+	if err = json.Unmarshal(fileByteContents, &entry); err != nil || entry.Credentials.AccountId != "000000000000" {
+		t.Errorf("unexpected AWS CLI cache entry contents: %s", fileByteContents)
+	}
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedConfig := `[profile rolesanywhere]
+sso_start_url = arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45
+sso_region = us-east-1
+sso_account_id = 000000000000
+sso_role_name = ExampleS3WriteRole
+`
+	if strings.ReplaceAll(string(config), "\r\n", "\n") != expectedConfig {
+		t.Errorf("unexpected AWS config file contents:\n%s", config)
+	}
+}
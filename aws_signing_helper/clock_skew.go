@@ -0,0 +1,54 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Difference between the system clock and the clock of Roles Anywhere below
+// which signatures aren't rejected, so smaller differences aren't compensated
+// for
+const clockSkewThreshold = 5 * time.Minute
+
+// Offset (in nanoseconds) that's added to the system clock to determine the
+// signing time, once the system clock has been found to be skewed. It's kept
+// for the lifetime of the process, so that long-running commands (such as
+// serve and update) don't run into the same failure on each refresh.
+var clockSkew atomic.Int64
+
+// Returns the time at which requests are signed
+func signingTime() time.Time {
+	return time.Now().Add(time.Duration(clockSkew.Load()))
+}
+
+// Determines whether the error is a rejection of the request that may have
+// been caused by the system clock being skewed, based on the Date header of
+// the response. If it is, the offset between the clock of Roles Anywhere and
+// the system clock is returned.
+func detectClockSkew(err error, now time.Time) (time.Duration, bool) {
+	var responseErr *smithyhttp.ResponseError
+	if !errors.As(err, &responseErr) || responseErr.Response == nil || responseErr.Response.Response == nil {
+		return 0, false
+	}
+	switch responseErr.HTTPStatusCode() {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+	default:
+		return 0, false
+	}
+	serverTime, parseErr := http.ParseTime(responseErr.Response.Header.Get("Date"))
+	if parseErr != nil {
+		return 0, false
+	}
+
+	// The Date header only has a resolution of seconds
+	skew := serverTime.Sub(now).Round(time.Second)
+	difference := skew - time.Duration(clockSkew.Load())
+	if difference < clockSkewThreshold && difference > -clockSkewThreshold {
+		return 0, false
+	}
+	return skew, true
+}
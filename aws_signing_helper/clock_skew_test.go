@@ -0,0 +1,67 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestClockSkewCompensation(t *testing.T) {
+	defer clockSkew.Store(0)
+
+	// The clock of the server is an hour ahead of the system clock, and it
+	// rejects requests whose signing time is more than five minutes off
+	serverOffset := time.Hour
+	requests := 0
+	mockedServer := GetMockedCreateSessionResponseServer()
+	defer mockedServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		serverTime := time.Now().Add(serverOffset)
+		w.Header().Set("Date", serverTime.UTC().Format(http.TimeFormat))
+		requestTime, _ := time.Parse(timeFormat, r.Header.Get(x_amz_date))
+		if requestTime.Sub(serverTime) > 5*time.Minute || serverTime.Sub(requestTime) > 5*time.Minute {
+			w.Header().Set("X-Amzn-ErrorType", "AccessDeniedException")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"message":"Signature expired"}`))
+			return
+		}
+		mockedServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Log("expected the request to be retried once; requests sent:", requests)
+		t.Fail()
+	}
+	if skew := time.Duration(clockSkew.Load()); skew < serverOffset-time.Minute || skew > serverOffset+time.Minute {
+		t.Log("unexpected clock skew:", skew)
+		t.Fail()
+	}
+
+	// Once the skew has been compensated for, requests aren't retried again
+	requests = 0
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil || requests != 1 {
+		t.Log("unexpected retry once the clock skew was compensated for:", err, requests)
+		t.Fail()
+	}
+}
@@ -0,0 +1,83 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"regexp"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+)
+
+// Header with the correlation ID of requests to the local endpoint of the
+// serve command, which is also set on their responses
+const CorrelationIdHeader = "X-Correlation-Id"
+
+// Correlation IDs that clients may pass in (so that their own IDs show up
+// in the logs), which are limited so that they can't forge log lines
+var correlationIdPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+type correlationIdKey struct{}
+
+// Returns the context with the correlation ID, which the log messages,
+// audit log records, credential metadata, and errors of the credential
+// request that's made with it include. Requests without one are given a
+// new one.
+func WithCorrelationId(ctx context.Context, correlationId string) context.Context {
+	return context.WithValue(ctx, correlationIdKey{}, correlationId)
+}
+
+// Returns the correlation ID of the context, if it has one
+func CorrelationIdFromContext(ctx context.Context) string {
+	correlationId, _ := ctx.Value(correlationIdKey{}).(string)
+	return correlationId
+}
+
+// Returns a random correlation ID, formatted as a UUID (version 4)
+func NewCorrelationId() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	id := hex.EncodeToString(b)
+	return id[0:8] + "-" + id[8:12] + "-" + id[12:16] + "-" + id[16:20] + "-" + id[20:]
+}
+
+// Returns the correlation ID that a client passed in, or a new one if it
+// didn't pass in a valid one
+func requestCorrelationId(id string) string {
+	if correlationIdPattern.MatchString(id) {
+		return id
+	}
+	return NewCorrelationId()
+}
+
+// Error of a credential request, with its correlation ID
+type correlatedError struct {
+	err           error
+	correlationId string
+}
+
+func (e *correlatedError) Error() string { return e.err.Error() }
+func (e *correlatedError) Unwrap() error { return e.err }
+
+// Returns the correlation ID of the credential request that returned the
+// error, if it's known
+func ErrorCorrelationId(err error) string {
+	var correlated *correlatedError
+	if errors.As(err, &correlated) {
+		return correlated.correlationId
+	}
+	return ""
+}
+
+// Returns the ID of the Roles Anywhere request that returned the error, if
+// one did
+func ErrorRequestId(err error) string {
+	var responseErr *awshttp.ResponseError
+	if errors.As(err, &responseErr) {
+		return responseErr.ServiceRequestID()
+	}
+	return ""
+}
@@ -0,0 +1,73 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestCorrelationIds(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer clear(componentLogLevels)
+	SetComponentLogLevel(LogComponentTransport, LogLevelDebug)
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/ec-prime256v1-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/ec-prime256v1-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	ctx := WithCorrelationId(context.Background(), "client-request-1")
+	output, err := GenerateCredentialsWithContext(ctx, &opts, signer, signatureAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Metadata.CorrelationId != "client-request-1" {
+		t.Error("unexpected correlation ID of the credentials:", output.Metadata.CorrelationId)
+	}
+	if !strings.Contains(buf.String(), "[client-request-1] ") {
+		t.Errorf("the log messages of the request don't have its correlation ID: %s", buf.String())
+	}
+	buf.Reset()
+	LogInfof("unrelated")
+	if strings.Contains(buf.String(), "client-request-1") {
+		t.Error("the correlation ID wasn't cleared:", buf.String())
+	}
+
+	// Requests without a correlation ID are given one, which their errors
+	// have
+	server.Close()
+	_, err = GenerateCredentials(&opts, signer, signatureAlgorithm)
+	if err == nil {
+		t.Fatal("expected CreateSession to fail")
+	}
+	if id := ErrorCorrelationId(err); !regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`).MatchString(id) {
+		t.Errorf("unexpected correlation ID of the error: %q", id)
+	}
+	if !errors.Is(err, ErrEndpointUnreachable) {
+		t.Error("the error doesn't wrap ErrEndpointUnreachable:", err)
+	}
+
+	if requestCorrelationId("client-request-1") != "client-request-1" || requestCorrelationId("forged\nline") == "forged\nline" {
+		t.Error("correlation IDs of clients weren't validated")
+	}
+}
@@ -0,0 +1,186 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Stores credentials that were obtained from CreateSession, so that they can
+// be reused until shortly before they expire (including by other processes,
+// if the cache is shared). Implementations must be safe for concurrent use.
+// Applications can supply their own (for example, one that's backed by Redis,
+// or by an encrypted store) through CredentialsOpts.Cache.
+type CredentialCache interface {
+	// Returns the credentials that are stored under the key, and whether
+	// there are any
+	Get(ctx context.Context, key string) (CredentialProcessOutput, bool, error)
+	// Stores the credentials under the key, replacing any that are stored
+	// already
+	Put(ctx context.Context, key string, credentials CredentialProcessOutput) error
+	// Removes the credentials that are stored under the key, if there are any
+	Invalidate(ctx context.Context, key string) error
+}
+
+// Derives the key under which the credentials for the options are cached,
+// from the Roles Anywhere resources, the role, and the certificate
+func CredentialCacheKey(opts *CredentialsOpts) string {
+	// Map keys are sorted by encoding/json
+	keyData, _ := json.Marshal(map[string]interface{}{
+		"CertificateId":   opts.CertificateId,
+		"ProfileArn":      opts.ProfileArnStr,
+		"RoleArn":         opts.RoleArn,
+		"RoleSessionName": opts.RoleSessionName,
+		"SessionDuration": opts.SessionDuration,
+		"TrustAnchorArn":  opts.TrustAnchorArnStr,
+	})
+	sum := sha256.Sum256(keyData)
+	return hex.EncodeToString(sum[:])
+}
+
+// Returns whether cached credentials can still be used: they have to be valid
+// for at least RefreshTime, as with the credentials that the serve command
+// serves
+func usableCachedCredentials(credentials CredentialProcessOutput, now time.Time) bool {
+	expiration, err := time.Parse(time.RFC3339, credentials.Expiration)
+	return err == nil && expiration.Sub(now) > RefreshTime
+}
+
+// Cache that keeps credentials in the memory of the process
+type memoryCredentialCache struct {
+	mu          sync.Mutex
+	credentials map[string]CredentialProcessOutput
+}
+
+// Creates a cache that keeps credentials in memory, so that they're shared
+// between the Credentialers of the process that use it
+func NewMemoryCredentialCache() CredentialCache {
+	return &memoryCredentialCache{credentials: map[string]CredentialProcessOutput{}}
+}
+
+func (c *memoryCredentialCache) Get(ctx context.Context, key string) (CredentialProcessOutput, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	credentials, ok := c.credentials[key]
+	return credentials, ok, nil
+}
+
+func (c *memoryCredentialCache) Put(ctx context.Context, key string, credentials CredentialProcessOutput) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.credentials[key] = credentials
+	return nil
+}
+
+func (c *memoryCredentialCache) Invalidate(ctx context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.credentials, key)
+	return nil
+}
+
+// Cache that keeps credentials in JSON files in a directory
+type fileCredentialCache struct {
+	dir string
+}
+
+// Creates a cache that keeps credentials in JSON files (one per key) in the
+// directory, which is created if it doesn't exist, so that they're shared
+// between processes. Only the current user can access the files, and they're
+// replaced atomically (the permissions of the directory and of existing
+// files are repaired, if other users can access them).
+func NewFileCredentialCache(dir string) CredentialCache {
+	cache := &fileCredentialCache{dir}
+	cache.repairPermissions()
+	return cache
+}
+
+// Contents of a file of the cache. The metadata of the credentials is left
+// out of their JSON encoding, so it's stored alongside them.
+type fileCredentialCacheEntry struct {
+	CredentialProcessOutput
+	Metadata *CredentialMetadata `json:"Metadata,omitempty"`
+}
+
+// Returns the path of the file for the key
+func (c *fileCredentialCache) path(key string) (string, error) {
+	if key == "" || key != filepath.Base(key) {
+		return "", errors.New("invalid credential cache key")
+	}
+	return filepath.Join(c.dir, key+".json"), nil
+}
+
+func (c *fileCredentialCache) Get(ctx context.Context, key string) (CredentialProcessOutput, bool, error) {
+	var credentials CredentialProcessOutput
+	path, err := c.path(key)
+	if err != nil {
+		return credentials, false, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return credentials, false, nil
+	} else if err != nil {
+		return credentials, false, err
+	}
+	var entry fileCredentialCacheEntry
+	if err = json.Unmarshal(data, &entry); err != nil {
+		return credentials, false, fmt.Errorf("invalid credential cache file %s: %w", path, err)
+	}
+	credentials = entry.CredentialProcessOutput
+	credentials.Metadata = entry.Metadata
+	return credentials, true, nil
+}
+
+func (c *fileCredentialCache) Put(ctx context.Context, key string, credentials CredentialProcessOutput) error {
+	path, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.dir, 0700); err != nil {
+		return err
+	}
+	data, err := json.Marshal(fileCredentialCacheEntry{credentials, credentials.Metadata})
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data)
+}
+
+func (c *fileCredentialCache) Invalidate(ctx context.Context, key string) error {
+	path, err := c.path(key)
+	if err != nil {
+		return err
+	}
+	if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// Cache that doesn't store anything
+type noCredentialCache struct{}
+
+// Creates a cache that doesn't store anything, so that each call of a
+// Credentialer calls CreateSession (as when no cache is set)
+func NewNoCredentialCache() CredentialCache {
+	return noCredentialCache{}
+}
+
+func (noCredentialCache) Get(ctx context.Context, key string) (CredentialProcessOutput, bool, error) {
+	return CredentialProcessOutput{}, false, nil
+}
+
+func (noCredentialCache) Put(ctx context.Context, key string, credentials CredentialProcessOutput) error {
+	return nil
+}
+
+func (noCredentialCache) Invalidate(ctx context.Context, key string) error {
+	return nil
+}
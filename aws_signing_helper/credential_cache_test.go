@@ -0,0 +1,104 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCredentialCache(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	var calls atomic.Int32
+	mockServer := GetMockedCreateSessionResponseServer()
+	defer mockServer.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		mockServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	fresh := CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     "cachedAccessKeyId",
+		SecretAccessKey: "cachedSecretAccessKey",
+		SessionToken:    "cachedSessionToken",
+		Expiration:      time.Now().Add(time.Hour).UTC().Format(time.RFC3339),
+	}
+	for name, cache := range map[string]CredentialCache{
+		"memory": NewMemoryCredentialCache(),
+		"file":   NewFileCredentialCache(filepath.Join(t.TempDir(), "cache")),
+	} {
+		t.Run(name, func(t *testing.T) {
+			calls.Store(0)
+			cacheHits := 0
+			opts := CredentialsOpts{
+				CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+				PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+				TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+				ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+				RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				SessionDuration:   900,
+				Endpoint:          server.URL,
+				Cache:             cache,
+				Hooks:             Hooks{OnCacheHit: func(CacheHitEvent) { cacheHits++ }},
+			}
+			key := CredentialCacheKey(&opts)
+			credentialer, err := NewCredentialer(&opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer credentialer.Close()
+
+			// Credentials that are valid long enough are reused
+			if err = cache.Put(context.Background(), key, fresh); err != nil {
+				t.Fatal(err)
+			}
+			credentials, err := credentialer.Credentials(context.Background())
+			if err != nil || credentials != fresh || calls.Load() != 0 || cacheHits != 1 {
+				t.Errorf("cached credentials weren't used: %v, %d calls, %d cache hits", err, calls.Load(), cacheHits)
+			}
+
+			// Others are replaced with credentials from CreateSession (which
+			// have expired already, and so are replaced on the next call too)
+			if err = cache.Invalidate(context.Background(), key); err != nil {
+				t.Fatal(err)
+			}
+			for i := 1; i <= 2; i++ {
+				credentials, err = credentialer.Credentials(context.Background())
+				if err != nil || credentials.AccessKeyId != "accessKeyId" || calls.Load() != int32(i) {
+					t.Errorf("credentials weren't obtained from CreateSession: %v, %d calls", err, calls.Load())
+				}
+			}
+			cached, ok, err := cache.Get(context.Background(), key)
+			if ok && cached.Metadata != nil && credentials.Metadata != nil && *cached.Metadata == *credentials.Metadata {
+				// Compare the metadata by value, since files hold copies
+				cached.Metadata = credentials.Metadata
+			}
+			if err != nil || !ok || cached != credentials {
+				t.Errorf("credentials weren't cached: %v, %v", err, ok)
+			}
+			if err = cache.Invalidate(context.Background(), key); err != nil {
+				t.Error(err)
+			}
+			if _, ok, err = cache.Get(context.Background(), key); err != nil || ok {
+				t.Errorf("credentials weren't invalidated: %v, %v", err, ok)
+			}
+		})
+	}
+
+	// Keys can't be used to escape the directory of a file cache
+	cache := NewFileCredentialCache(t.TempDir())
+	if err := cache.Put(context.Background(), "../key", fresh); err == nil {
+		t.Error("cached credentials under an invalid key")
+	}
+
+	cache = NewNoCredentialCache()
+	cache.Put(context.Background(), "key", fresh)
+	if _, ok, _ := cache.Get(context.Background(), "key"); ok {
+		t.Error("no-op cache returned credentials")
+	}
+}
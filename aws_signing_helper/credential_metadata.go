@@ -0,0 +1,79 @@
+package aws_signing_helper
+
+import (
+	"time"
+
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+)
+
+// Backend name of signers that aren't built into the package (such as those
+// of registered backends, and signers that are passed to
+// NewCredentialerWithSigner)
+const CustomBackend = "custom"
+
+// Describes the session that credentials were obtained for, so that callers
+// can log them, label metrics, and choose caches per identity. It doesn't
+// include the credentials themselves.
+type CredentialMetadata struct {
+	// Role that was assumed, and the ARN and ID of the assumed-role user
+	RoleArn        string `json:"RoleArn,omitempty"`
+	AssumedRoleArn string `json:"AssumedRoleArn,omitempty"`
+	AssumedRoleId  string `json:"AssumedRoleId,omitempty"`
+	// Source identity of the session, which Roles Anywhere derives from the
+	// certificate
+	SourceIdentity string `json:"SourceIdentity,omitempty"`
+	// Subject and serial number (in decimal) of the certificate that the
+	// request was signed with
+	CertificateSubject      string `json:"CertificateSubject,omitempty"`
+	CertificateSerialNumber string `json:"CertificateSerialNumber,omitempty"`
+	// Time at which the credentials were obtained from CreateSession
+	IssuedAt time.Time `json:"IssuedAt"`
+	// Signing backend that holds the private key, as returned by Backends
+	// (or CustomBackend)
+	Backend string `json:"Backend,omitempty"`
+	// ID of the CreateSession request, and correlation ID of the credential
+	// request (see WithCorrelationId)
+	RequestId     string `json:"RequestId,omitempty"`
+	CorrelationId string `json:"CorrelationId,omitempty"`
+}
+
+// Returns the name of the backend of the signer
+func signerBackendName(signer Signer) string {
+	if synchronized, ok := signer.(*synchronizedSigner); ok {
+		signer = synchronized.signer
+	}
+	if named, ok := signer.(interface{ backendName() string }); ok {
+		return named.backendName()
+	}
+	return CustomBackend
+}
+
+// Builds the metadata of the credentials in the response to CreateSession
+func credentialResponseMetadata(response types.CredentialResponse, issuedAt time.Time) *CredentialMetadata {
+	metadata := &CredentialMetadata{IssuedAt: issuedAt}
+	if response.RoleArn != nil {
+		metadata.RoleArn = *response.RoleArn
+	}
+	if response.AssumedRoleUser != nil {
+		if response.AssumedRoleUser.Arn != nil {
+			metadata.AssumedRoleArn = *response.AssumedRoleUser.Arn
+		}
+		if response.AssumedRoleUser.AssumedRoleId != nil {
+			metadata.AssumedRoleId = *response.AssumedRoleUser.AssumedRoleId
+		}
+	}
+	if response.SourceIdentity != nil {
+		metadata.SourceIdentity = *response.SourceIdentity
+	}
+	return metadata
+}
+
+// Adds the backend and the certificate of the signer that the request was
+// signed with
+func (metadata *CredentialMetadata) describeSigner(signer Signer) {
+	metadata.Backend = signerBackendName(signer)
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		metadata.CertificateSubject = certificate.Subject.String()
+		metadata.CertificateSerialNumber = certificate.SerialNumber.String()
+	}
+}
@@ -0,0 +1,68 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCredentialMetadata(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	credentialer, err := NewCredentialer(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+	start := time.Now()
+	credentials, err := credentialer.Credentials(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, certificate, _ := ReadCertificateData(opts.CertificateId)
+	metadata := credentials.Metadata
+	if metadata == nil {
+		t.Fatal("credentials have no metadata")
+	}
+	if metadata.RoleArn != opts.RoleArn || metadata.AssumedRoleId != "assumedRoleId" ||
+		metadata.AssumedRoleArn != "arn:aws:sts::000000000000:assumed-role/ExampleS3WriteRole" ||
+		metadata.SourceIdentity != "sourceIdentity" || metadata.Backend != "file" ||
+		metadata.CertificateSubject != certificate.Subject.String() ||
+		metadata.CertificateSerialNumber != certificate.SerialNumber.String() ||
+		metadata.IssuedAt.Before(start.Add(-time.Second)) || metadata.IssuedAt.After(time.Now()) {
+		t.Errorf("unexpected metadata: %+v", metadata)
+	}
+
+	// The metadata isn't part of the credential-process output, but it's
+	// kept by file caches
+	data, _ := json.Marshal(credentials)
+	if strings.Contains(string(data), "Metadata") {
+		t.Errorf("metadata is included in the JSON output: %s", data)
+	}
+	cache := NewFileCredentialCache(t.TempDir())
+	if err = cache.Put(context.Background(), "key", credentials); err != nil {
+		t.Fatal(err)
+	}
+	cached, _, err := cache.Get(context.Background(), "key")
+	if err != nil || cached.Metadata == nil || *cached.Metadata != *metadata {
+		t.Errorf("metadata wasn't cached: %+v, %v", cached.Metadata, err)
+	}
+
+	if backend := signerBackendName(synchronizeSigner(&cryptoSigner{certificate: certificate})); backend != CustomBackend {
+		t.Errorf("unexpected backend of a custom signer: %s", backend)
+	}
+}
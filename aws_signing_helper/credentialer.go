@@ -0,0 +1,179 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
+	"github.com/aws/smithy-go/middleware"
+)
+
+// Obtains temporary credentials from Roles Anywhere for an identity (a
+// certificate and its private key). It's safe for concurrent use; calls are
+// serialized, since not all signers (such as PKCS#11 modules) are.
+type Credentialer interface {
+	// Calls CreateSession, and returns the credentials for the role (unless
+	// credentials that are valid long enough are in CredentialsOpts.Cache,
+	// in which case they're returned instead). The call
+	// is canceled when the context is done, including while waiting for
+	// other calls to finish.
+	Credentials(ctx context.Context) (CredentialProcessOutput, error)
+	// Releases the resources held by the signer (such as PKCS#11 sessions or
+	// TPM handles). The Credentialer can't be used afterwards.
+	Close()
+}
+
+// Options of a Credentialer that customize the Roles Anywhere client, so that
+// embedders can apply the same proxy, tracing, and retry policies as in the
+// rest of their stack
+type CredentialerOptions struct {
+	// Client that CreateSession calls are sent with. It replaces the client
+	// that's built from the NoVerifySSL and WithProxy options.
+	HTTPClient aws.HTTPClient
+	// Middleware that wraps the transport of CreateSession calls (for
+	// example, for logging, tracing, or injecting headers), whether it's the
+	// built-in client or HTTPClient. The first one is the outermost, so it
+	// sees requests first and responses last. Requests have already been
+	// signed when they reach the transport, so headers that are added are
+	// sent without being signed.
+	TransportMiddleware []func(next http.RoundTripper) http.RoundTripper
+	// Resolves the endpoint of Roles Anywhere. It's passed the Endpoint
+	// option (if it's set) in its parameters.
+	EndpointResolver rolesanywhere.EndpointResolverV2
+	// Creates the retryer for CreateSession calls. Defaults to the standard
+	// retryer of the SDK, as configured by the environment.
+	Retryer func() aws.Retryer
+	// Additional middleware for CreateSession calls (for example, for
+	// tracing)
+	APIOptions []func(*middleware.Stack) error
+}
+
+// Implements http.RoundTripper with a function, for writing transport
+// middleware
+type RoundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(request *http.Request) (*http.Response, error) {
+	return f(request)
+}
+
+// Wraps the client in the transport middleware, if there is any
+func wrapHTTPClient(client aws.HTTPClient, middleware []func(http.RoundTripper) http.RoundTripper) aws.HTTPClient {
+	if len(middleware) == 0 {
+		return client
+	}
+	var transport http.RoundTripper = RoundTripperFunc(client.Do)
+	for i := len(middleware) - 1; i >= 0; i-- {
+		transport = middleware[i](transport)
+	}
+	// Redirects are left to the wrapped client
+	return &http.Client{Transport: transport, CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+}
+
+type credentialer struct {
+	// Holds a value while a call is in progress
+	lock               chan struct{}
+	opts               CredentialsOpts
+	clientOptions      CredentialerOptions
+	signer             Signer
+	signatureAlgorithm string
+}
+
+// Creates a Credentialer for the identity and role described by the options,
+// finding the private key and certificate in the same way as the
+// credential-process command. The options are copied, so later changes to
+// them have no effect.
+func NewCredentialer(opts *CredentialsOpts, optFns ...func(*CredentialerOptions)) (Credentialer, error) {
+	signer, signatureAlgorithm, err := GetSigner(opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewCredentialerWithSigner(opts, signer, signatureAlgorithm, optFns...), nil
+}
+
+// Creates a Credentialer that signs requests with the specified signer (for
+// example, one for a key in a custom key store). The signature algorithm is
+// either AWS4-X509-RSA-SHA256 or AWS4-X509-ECDSA-SHA256. The Credentialer
+// takes ownership of the signer, and closes it when it's closed.
+func NewCredentialerWithSigner(opts *CredentialsOpts, signer Signer, signatureAlgorithm string, optFns ...func(*CredentialerOptions)) Credentialer {
+	var clientOptions CredentialerOptions
+	for _, fn := range optFns {
+		fn(&clientOptions)
+	}
+	signer, err := auditSigner(opts, signer)
+	if err != nil {
+		LogWarnf("unable to open the audit log: %s", err)
+	}
+	return &credentialer{lock: make(chan struct{}, 1), opts: *opts, clientOptions: clientOptions, signer: signer,
+		signatureAlgorithm: signatureAlgorithm}
+}
+
+func (c *credentialer) Credentials(ctx context.Context) (CredentialProcessOutput, error) {
+	select {
+	case c.lock <- struct{}{}:
+	case <-ctx.Done():
+		return CredentialProcessOutput{}, ctx.Err()
+	}
+	defer func() { <-c.lock }()
+	if c.opts.Cache == nil {
+		return generateCredentials(ctx, &c.opts, c.signer, c.signatureAlgorithm, c.clientOptions)
+	}
+
+	// The cache operations and the CreateSession call (if there is one) are
+	// children of the span of the call
+	ctx, span := startSpan(ctx, &c.opts, "Credentialer.Credentials")
+	credentials, err := c.cachedCredentials(ctx)
+	endSpan(span, err)
+	return credentials, err
+}
+
+// Returns cached credentials, or obtains (and caches) new ones
+func (c *credentialer) cachedCredentials(ctx context.Context) (CredentialProcessOutput, error) {
+	// Failures of the cache are reported, but credentials are still obtained
+	// from CreateSession
+	key := CredentialCacheKey(&c.opts)
+	getCtx, span := startSpan(ctx, &c.opts, "CredentialCache.Get")
+	credentials, ok, err := c.opts.Cache.Get(getCtx, key)
+	span.SetProperty("aws.rolesanywhere.cache_hit", ok)
+	endSpan(span, err)
+	if err != nil {
+		c.cacheFailed(fmt.Errorf("unable to read cached credentials: %w", err))
+	} else if ok && usableCachedCredentials(credentials, time.Now()) {
+		expiration, _ := time.Parse(time.RFC3339, credentials.Expiration)
+		cacheLog.debugf("using cached credentials that expire at %s", credentials.Expiration)
+		c.opts.Hooks.cacheHit(CacheHitEvent{expiration})
+		return credentials, nil
+	} else if ok {
+		if err = c.opts.Cache.Invalidate(ctx, key); err != nil {
+			c.cacheFailed(fmt.Errorf("unable to invalidate cached credentials: %w", err))
+		}
+	}
+
+	credentials, err = generateCredentials(ctx, &c.opts, c.signer, c.signatureAlgorithm, c.clientOptions)
+	if err != nil {
+		return CredentialProcessOutput{}, err
+	}
+	putCtx, span := startSpan(ctx, &c.opts, "CredentialCache.Put")
+	err = c.opts.Cache.Put(putCtx, key, credentials)
+	endSpan(span, err)
+	if err != nil {
+		c.cacheFailed(fmt.Errorf("unable to cache credentials: %w", err))
+	}
+	return credentials, nil
+}
+
+// Reports a failure of the credential cache
+func (c *credentialer) cacheFailed(err error) {
+	cacheLog.warnf("%s", err)
+	c.opts.Hooks.failed(ErrorEvent{OperationCredentialCache, err})
+}
+
+func (c *credentialer) Close() {
+	c.lock <- struct{}{}
+	defer func() { <-c.lock }()
+	c.signer.Close()
+}
@@ -0,0 +1,250 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
+	smithyendpoints "github.com/aws/smithy-go/endpoints"
+	"github.com/aws/smithy-go/middleware"
+)
+
+func TestCredentialer(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	credentialer, err := NewCredentialer(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			credentials, err := credentialer.Credentials(context.Background())
+			if err == nil && credentials.AccessKeyId == "" {
+				err = errors.New("no access key ID")
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Log("unable to obtain credentials:", err)
+			t.Fail()
+		}
+	}
+
+	// The options of the caller aren't modified
+	if opts.Region != "" {
+		t.Log("the options passed to NewCredentialer were modified")
+		t.Fail()
+	}
+
+	opts.PrivateKeyId = "../tst/certs/does-not-exist.pem"
+	if _, err = NewCredentialer(&opts); err == nil {
+		t.Log("created a Credentialer for a private key that doesn't exist")
+		t.Fail()
+	}
+}
+
+func TestCredentialsContext(t *testing.T) {
+	requests := 0
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		select {
+		case <-r.Context().Done():
+		case <-done:
+		}
+	}))
+	defer server.Close()
+	defer close(done)
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	credentials, err := NewCredentialer(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentials.Close()
+
+	// Requests aren't signed or sent once the context is canceled
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err = credentials.Credentials(ctx); !errors.Is(err, context.Canceled) || requests != 0 {
+		t.Log("unexpected result for a canceled context:", err, requests)
+		t.Fail()
+	}
+
+	start := time.Now()
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err = credentials.Credentials(ctx); !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 5*time.Second {
+		t.Log("unexpected result for a context whose deadline was exceeded:", err, time.Since(start))
+		t.Fail()
+	}
+
+	// Calls that are waiting for another call to finish are canceled as well
+	c := credentials.(*credentialer)
+	c.lock <- struct{}{}
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	_, err = credentials.Credentials(ctx)
+	<-c.lock
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Log("unexpected result while waiting for another call:", err)
+		t.Fail()
+	}
+}
+
+// Counts the requests that are sent through it
+type countingTransport struct {
+	requests atomic.Int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Resolves every endpoint to the same URL
+type staticEndpointResolver struct {
+	endpoint string
+}
+
+func (r staticEndpointResolver) ResolveEndpoint(ctx context.Context, params rolesanywhere.EndpointParameters) (smithyendpoints.Endpoint, error) {
+	endpoint, err := url.Parse(r.endpoint)
+	if err != nil {
+		return smithyendpoints.Endpoint{}, err
+	}
+	return smithyendpoints.Endpoint{URI: *endpoint}, nil
+}
+
+func TestCredentialerOptions(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	transport := &countingTransport{}
+	retryers, middlewareCalls := 0, 0
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+	}
+	credentialer, err := NewCredentialer(&opts, func(options *CredentialerOptions) {
+		options.HTTPClient = &http.Client{Transport: transport}
+		options.EndpointResolver = staticEndpointResolver{server.URL}
+		options.Retryer = func() aws.Retryer {
+			retryers++
+			return aws.NopRetryer{}
+		}
+		options.APIOptions = append(options.APIOptions, func(stack *middleware.Stack) error {
+			return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("CountCalls", func(
+				ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler,
+			) (middleware.InitializeOutput, middleware.Metadata, error) {
+				middlewareCalls++
+				return next.HandleInitialize(ctx, in)
+			}), middleware.After)
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+
+	if _, err = credentialer.Credentials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if transport.requests.Load() != 1 || retryers == 0 || middlewareCalls != 1 {
+		t.Errorf("options weren't applied: %d requests, %d retryers, %d middleware calls",
+			transport.requests.Load(), retryers, middlewareCalls)
+	}
+}
+
+func TestTransportMiddleware(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	mockServer := GetMockedCreateSessionResponseServer()
+	defer mockServer.Close()
+	var injectedHeader atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		injectedHeader.Store(r.Header.Get("X-Test-Trace"))
+		mockServer.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	var order []string
+	record := func(name string) func(http.RoundTripper) http.RoundTripper {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(request *http.Request) (*http.Response, error) {
+				order = append(order, name+" request")
+				request.Header.Set("X-Test-Trace", strings.TrimSpace(request.Header.Get("X-Test-Trace")+" "+name))
+				response, err := next.RoundTrip(request)
+				order = append(order, name+" response")
+				return response, err
+			})
+		}
+	}
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	credentialer, err := NewCredentialer(&opts, func(options *CredentialerOptions) {
+		options.TransportMiddleware = append(options.TransportMiddleware, record("outer"), record("inner"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+
+	if _, err = credentialer.Credentials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	expectedOrder := []string{"outer request", "inner request", "inner response", "outer response"}
+	if !reflect.DeepEqual(order, expectedOrder) {
+		t.Errorf("unexpected order of middleware: %v", order)
+	}
+	if injectedHeader.Load() != "outer inner" {
+		t.Errorf("unexpected injected header: %v", injectedHeader.Load())
+	}
+}
@@ -3,44 +3,194 @@ package aws_signing_helper
 import (
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"encoding/base64"
 	"errors"
 	"fmt"
-	"log"
-	"net/http"
 	"runtime"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
 	"github.com/aws/smithy-go/middleware"
+	"github.com/aws/smithy-go/tracing"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
 )
 
+// Options that describe the identity (the private key and certificate), the
+// Roles Anywhere resources, and the role that credentials are obtained for
 type CredentialsOpts struct {
-	PrivateKeyId        string
-	CertificateId       string
+	// Private key: a file path, a PKCS#11 URI, or a TPM handle (such as
+	// handle:0x81000001). If it's empty, the private key is found through the
+	// certificate (in a PKCS#12 file, a PKCS#11 module, or a certificate store).
+	PrivateKeyId string
+	// Certificate: a file path (PEM, DER, or PKCS#12) or a PKCS#11 URI
+	CertificateId string
+	// File with the intermediate certificates of the chain
 	CertificateBundleId string
-	CertIdentifier      CertIdentifier
-	RoleArn             string
-	ProfileArnStr       string
-	TrustAnchorArnStr   string
-	SessionDuration     int
-	Region              string
-	Endpoint            string
-	NoVerifySSL         bool
-	WithProxy           bool
-	Debug               bool
-	Version             string
-	LibPkcs11           string
-	ReusePin            bool
-	TpmKeyPassword      string
-	NoTpmKeyPassword    bool
-	ServerTTL           int
-	RoleSessionName     string
+	// Certificate to use from a platform certificate store (when neither
+	// PrivateKeyId nor CertificateId is set)
+	CertIdentifier CertIdentifier
+	// Address of the SPIFFE Workload API (unix:///path/to/socket or
+	// tcp://IP:port). If it's set, the X.509-SVID of the workload is the
+	// identity, instead of PrivateKeyId and CertificateId, and rotated SVIDs
+	// are picked up as they're issued. SpiffeId selects the X.509-SVID of
+	// workloads that have more than one.
+	SpiffeEndpointSocket string
+	SpiffeId             string
+	// Kubernetes secret of type kubernetes.io/tls (<namespace>/<name>, or
+	// the name of a secret in the namespace of the pod), such as the secret
+	// of a cert-manager Certificate. If it's set, its tls.crt and tls.key
+	// are the identity, which is read through the API server of the cluster
+	// that the pod runs in, and watched for renewals. The chain is verified
+	// against its ca.crt, unless TrustAnchorCertificate is set.
+	KubernetesSecret string
+	// If it's set, and the file of CertificateId doesn't exist, the device
+	// is provisioned through fleet provisioning first, which writes its
+	// certificate and private key to CertificateId and PrivateKeyId
+	FleetProvisioning *FleetProvisioningOptions
+	// If it's set, the certificate is enrolled with the ACME server when
+	// the file of CertificateId doesn't exist or is due to be renewed, and
+	// the serve, update, and sidecar commands renew it while they run
+	ACME              *ACMEOptions
+	RoleArn           string
+	ProfileArnStr     string
+	TrustAnchorArnStr string
+	// Duration of the session, in seconds: between 900 and 43200
+	SessionDuration int
+	// Region and endpoint of Roles Anywhere. By default, they're derived from
+	// the trust anchor ARN.
+	Region      string
+	Endpoint    string
+	NoVerifySSL bool
+	WithProxy   bool
+	Debug       bool
+	// TLS policy of outbound connections: the minimum version (TLS 1.2 by
+	// default, or TLS 1.3), and the TLS 1.2 cipher suites and key exchange
+	// curves that are offered (by default, those of crypto/tls)
+	TLSMinVersion       uint16
+	TLSCipherSuites     []uint16
+	TLSCurvePreferences []tls.CurveID
+	// Pins of the Roles Anywhere endpoint (see ParseEndpointPin). If any are
+	// set, connections fail unless a certificate of the chain of the
+	// endpoint matches one of them.
+	EndpointPins []string
+	// HTTP version of the connections to Roles Anywhere: HTTPVersionAuto (by
+	// default), HTTPVersion1, or HTTPVersion2
+	HTTPVersion string
+	// Version of the calling program, which is sent in the user agent
+	Version string
+	// PKCS#11 module and whether the PIN of the first private key that's
+	// used is reused for later ones
+	LibPkcs11 string
+	ReusePin  bool
+	// Passwords of TPM and encrypted private keys
+	TpmKeyPassword   string
+	NoTpmKeyPassword bool
+	KeyPassword      string
+	RoleSessionName  string
+	// Callbacks for refreshes, signatures, errors, cache hits, and
+	// certificates that expire soon
+	Hooks Hooks
+	// Tracer provider of the spans of key loads, signatures, CreateSession
+	// calls, and credential cache operations (which OpenTelemetry tracer
+	// providers can be adapted to, with the smithy-go otel adapter). Spans
+	// aren't recorded without one.
+	TracerProvider tracing.TracerProvider
+	// Before CreateSession is called, a warning is logged if the certificate
+	// expires within this window (by default, it's not), and an error is
+	// returned if the certificate or its chain has expired or isn't valid
+	// yet, unless NoCertificateValidityCheck is set (for devices whose
+	// clock can't be trusted)
+	CertificateExpiryWarningWindow time.Duration
+	NoCertificateValidityCheck     bool
+	// Extended key usages that the certificate has to allow, if it has an
+	// extended key usage extension (by default, clientAuth). GetSigner
+	// checks them (and that the key usage allows digital signatures), unless
+	// NoKeyUsageCheck is set.
+	RequiredExtKeyUsages []x509.ExtKeyUsage
+	NoKeyUsageCheck      bool
+	// GetSigner rejects RSA keys under 2048 bits and keys on deprecated
+	// elliptic curves, unless this is set (and not in FIPS mode)
+	AllowWeakKeys bool
+	// GetSigner logs a warning if a private key file (or PKCS#12 file) can
+	// be accessed by users other than its owner, or fails if this is set
+	StrictPermissions bool
+	// Whether the OCSP responder of the certificate is queried before
+	// CreateSession is called (one of OCSPCheckOff, OCSPCheckWarn, and
+	// OCSPCheckEnforce)
+	OCSPCheck string
+	// Whether the CRL of the certificate is checked before CreateSession is
+	// called (one of CRLCheckOff, CRLCheckWarn, and CRLCheckEnforce). The CRL
+	// is read from CRLFile, if it's set, or downloaded from the CRL
+	// distribution points of the certificate, and kept in CRLCacheDir (if
+	// it's set) until its next update.
+	CRLCheck    string
+	CRLFile     string
+	CRLCacheDir string
+	// CA certificate (or bundle) of the trust anchor, as a PEM or DER file
+	// or an HTTP(S) URL to download it from. If it's set, the certificate
+	// chain is verified against it before CreateSession is called.
+	TrustAnchorCertificate string
+	// File that signatures made with the private key, and credentials
+	// obtained from CreateSession, are appended to as JSON lines (by
+	// default, they aren't recorded)
+	AuditLogFile string
+	// Size (in bytes) beyond which the audit log is rotated: it's renamed to
+	// AuditLogFile.1 (and earlier rotated files are renamed to .2 and so on,
+	// up to AuditLogMaxBackups, beyond which they're deleted), and a new
+	// file is started. By default, it's never rotated.
+	AuditLogMaxSize    int64
+	AuditLogMaxBackups int
+	// Cache that a Credentialer reuses credentials from, until shortly
+	// before they expire. By default, nothing is cached.
+	Cache CredentialCache
+
+	// Only used by the serve command. With Sandbox, the process is confined
+	// once the local server is listening (see enterSandbox). The server
+	// listens on ServerBindAddress (LocalHostAddress by default); addresses
+	// that aren't loopback addresses expose credentials to other hosts.
+	ServerTTL         int
+	Sandbox           bool
+	ServerBindAddress string
+	// Only used by the sidecar: how often the identity files are checked
+	// for rotations (DefaultCertificateWatchInterval if it isn't set)
+	CertificateWatchInterval time.Duration
+	// Only used by the serve, update, and credential-process commands. With
+	// Preconnect, a connection to Roles Anywhere is established shortly
+	// before credentials are refreshed (and, by Preload, while the signer is
+	// initialized), so that the refresh doesn't wait for the TCP and TLS
+	// handshakes.
+	Preconnect bool
+	// Only used by the serve and update commands. With SkipRevalidation, the
+	// certificate chain isn't verified against TrustAnchorCertificate again
+	// when the certificate, chain, and trust anchor certificate are unchanged
+	// since credentials were last obtained with them (see
+	// revalidationFingerprint).
+	SkipRevalidation bool
+	// Only used by the serve and update commands. PprofAddress is a loopback
+	// address and port, or a Unix domain socket (unix:/path), on which the
+	// net/http/pprof endpoints are served, apart from the local server of the
+	// serve command. Heap and CPU profiles are written to PprofDir when the
+	// process receives SIGUSR2 (which isn't supported on Windows).
+	PprofAddress string
+	PprofDir     string
+	// Only used by the update command. With a PrewarmTimeout, failures to
+	// initialize the signer and to first obtain credentials that are
+	// transient while a host boots are retried until it passes.
+	UpdateTarget   string
+	CLICacheKey    string
+	OnRefresh      string
+	RefreshBuffer  time.Duration
+	PrewarmTimeout time.Duration
 }
 
+// Returned (wrapped) when the trust anchor or profile ARN is invalid
+var ErrInvalidArn = errors.New("invalid ARN")
+
 // Middleware to set a custom user agent header
 func createCredHelperUserAgentMiddleware(userAgent string) middleware.BuildMiddleware {
 	return middleware.BuildMiddlewareFunc("UserAgent", func(
@@ -53,20 +203,137 @@ func createCredHelperUserAgentMiddleware(userAgent string) middleware.BuildMiddl
 	})
 }
 
-// Function to create session and generate credentials
+// Calls CreateSession, signed by the signer, and returns the credentials for
+// the role. Library callers should use a Credentialer instead.
 func GenerateCredentials(opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (CredentialProcessOutput, error) {
+	return GenerateCredentialsWithContext(context.Background(), opts, signer, signatureAlgorithm)
+}
+
+// Same as GenerateCredentials, but the CreateSession call (including signing
+// the request) is canceled when the context is done
+func GenerateCredentialsWithContext(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (CredentialProcessOutput, error) {
+	return generateCredentials(ctx, opts, signer, signatureAlgorithm, CredentialerOptions{})
+}
+
+// Same as GenerateCredentialsWithContext, with options for the Roles Anywhere
+// client
+func generateCredentials(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string, clientOptions CredentialerOptions) (CredentialProcessOutput, error) {
+	start := time.Now()
+	correlationId := CorrelationIdFromContext(ctx)
+	if correlationId == "" {
+		correlationId = NewCorrelationId()
+		ctx = WithCorrelationId(ctx, correlationId)
+	}
+	setLogIdentity(opts, signer, correlationId)
+	defer clearLogCorrelationId()
+	var err error
+	ctx, span := startSpan(ctx, opts, "RolesAnywhere.Credentials")
+	span.SetProperty(spanAttributeRoleArn, opts.RoleArn)
+	defer func() { endSpan(span, err) }()
+	var output *rolesanywhere.CreateSessionOutput
+	// The clock isn't checked if it can't be trusted, since the signing time
+	// is then compensated for the skew that Roles Anywhere reports
+	if !opts.NoCertificateValidityCheck {
+		err = checkSystemClock(signingTime())
+	}
+	if err == nil {
+		err = checkCertificateValidity(opts, signer, signingTime())
+	}
+	fingerprint, revalidate := "", true
+	if err == nil && opts.SkipRevalidation {
+		fingerprint, revalidate = revalidationFingerprint(opts, signer)
+	}
+	if err == nil {
+		// Both may have to download (OCSP responses or CRLs, and the trust
+		// anchor certificate), so they're run concurrently. The revocation
+		// check's error is reported first, as when they were run in turn.
+		trustAnchorErr := make(chan error, 1)
+		go func() {
+			if !revalidate {
+				LogDebugf("the certificate chain is unchanged since it was last verified; not verifying it again")
+				trustAnchorErr <- nil
+				return
+			}
+			trustAnchorErr <- checkTrustAnchorChain(ctx, opts, signer, signingTime())
+		}()
+		err = checkRevocation(ctx, opts, signer, signingTime())
+		if chainErr := <-trustAnchorErr; err == nil {
+			err = chainErr
+		}
+	}
+	if err == nil {
+		output, err = createSession(ctx, opts, signer, signatureAlgorithm, clientOptions)
+	}
+	if err == nil && len(output.CredentialSet) == 0 {
+		err = errors.New("unable to obtain temporary security credentials from CreateSession")
+	}
+	audit, auditErr := openAuditLog(opts)
+	if auditErr != nil {
+		LogWarnf("unable to open the audit log: %s", auditErr)
+	}
+	if err != nil {
+		opts.Hooks.failed(ErrorEvent{OperationCreateSession, err})
+		audit.recordCredentials(ctx, opts, signer, CredentialProcessOutput{}, err)
+		return CredentialProcessOutput{}, &correlatedError{err, correlationId}
+	}
+
+	if fingerprint != "" {
+		validatedIdentities.Store(fingerprint, struct{}{})
+	}
+	credentials := output.CredentialSet[0].Credentials
+	credentialProcessOutput := CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     *credentials.AccessKeyId,
+		SecretAccessKey: *credentials.SecretAccessKey,
+		SessionToken:    *credentials.SessionToken,
+		Expiration:      *credentials.Expiration,
+		Metadata:        credentialResponseMetadata(output.CredentialSet[0], start.UTC()),
+	}
+	credentialProcessOutput.Metadata.describeSigner(signer)
+	requestId, _ := awsmiddleware.GetRequestIDMetadata(output.ResultMetadata)
+	credentialProcessOutput.Metadata.RequestId = requestId
+	credentialProcessOutput.Metadata.CorrelationId = correlationId
+	logFieldsf(LogLevelDebug, logFields{RequestId: requestId}, "obtained credentials for %s that expire at %s",
+		opts.RoleArn, credentialProcessOutput.Expiration)
+	expiration, _ := time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+	refresh := RefreshEvent{RoleArn: opts.RoleArn, Expiration: expiration, Duration: time.Since(start)}
+	refresh.Certificate, _ = signer.Certificate()
+	opts.Hooks.refreshed(refresh)
+	audit.recordCredentials(ctx, opts, signer, credentialProcessOutput, nil)
+	return credentialProcessOutput, nil
+}
+
+// Makes the CreateSession call, signed with SigV4-X509. The client options
+// can customize the HTTP client, the endpoint, the retryer, and the
+// middleware stack of the call. If
+// the call is rejected, and the Date header of the response shows that the
+// system clock is skewed, the call is retried once with a signing time that
+// compensates for the skew (edge devices frequently have drifting clocks).
+func createSession(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string, clientOptions CredentialerOptions) (*rolesanywhere.CreateSessionOutput, error) {
+	output, err := sendCreateSession(ctx, opts, signer, signatureAlgorithm, clientOptions)
+	if skew, ok := detectClockSkew(err, time.Now()); ok {
+		LogWarnf("the system clock differs from the clock of Roles Anywhere by %s; retrying with a signing time that "+
+			"compensates for it (the system clock should be synchronized, for example through NTP)", skew)
+		clockSkew.Store(int64(skew))
+		output, err = sendCreateSession(ctx, opts, signer, signatureAlgorithm, clientOptions)
+	}
+	return output, wrapCreateSessionError(err)
+}
+
+// Sends a single CreateSession call
+func sendCreateSession(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string, clientOptions CredentialerOptions) (*rolesanywhere.CreateSessionOutput, error) {
 	// Assign values to region and endpoint if they haven't already been assigned
 	trustAnchorArn, err := arn.Parse(opts.TrustAnchorArnStr)
 	if err != nil {
-		return CredentialProcessOutput{}, err
+		return nil, fmt.Errorf("%w %q for the trust anchor: %s", ErrInvalidArn, opts.TrustAnchorArnStr, err)
 	}
 	profileArn, err := arn.Parse(opts.ProfileArnStr)
 	if err != nil {
-		return CredentialProcessOutput{}, err
+		return nil, fmt.Errorf("%w %q for the profile: %s", ErrInvalidArn, opts.ProfileArnStr, err)
 	}
 
 	if trustAnchorArn.Region != profileArn.Region {
-		return CredentialProcessOutput{}, errors.New("trust anchor and profile regions don't match")
+		return nil, fmt.Errorf("%w: trust anchor and profile regions don't match", ErrInvalidArn)
 	}
 
 	if opts.Region == "" {
@@ -74,27 +341,27 @@ func GenerateCredentials(opts *CredentialsOpts, signer Signer, signatureAlgorith
 	}
 
 	var logMode aws.ClientLogMode = 0
-	if Debug {
+	if transportLog.enabled(LogLevelDebug) {
 		logMode = aws.LogSigning | aws.LogRetries | aws.LogRequestWithBody | aws.LogResponseWithBody | aws.LogRequestEventMessage | aws.LogResponseEventMessage
 	}
 
-	// Custom HTTP client with proxy and TLS settings
-	var tr *http.Transport
-	if opts.WithProxy {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.NoVerifySSL},
-			Proxy:           http.ProxyFromEnvironment,
-		}
-	} else {
-		tr = &http.Transport{
-			TLSClientConfig: &tls.Config{MinVersion: tls.VersionTLS12, InsecureSkipVerify: opts.NoVerifySSL},
+	// Shared HTTP client with proxy and TLS settings, unless the caller
+	// supplied one
+	httpClient := clientOptions.HTTPClient
+	if httpClient == nil {
+		if httpClient, err = createSessionClient(opts); err != nil {
+			return nil, err
 		}
 	}
-	httpClient := &http.Client{Transport: tr}
-	ctx := context.TODO()
-	cfg, err := config.LoadDefaultConfig(ctx, config.WithRegion(opts.Region), config.WithHTTPClient(httpClient), config.WithClientLogMode(logMode))
+	httpClient = wrapHTTPClient(httpClient, clientOptions.TransportMiddleware)
+	configOptions := []func(*config.LoadOptions) error{config.WithRegion(opts.Region), config.WithHTTPClient(httpClient),
+		config.WithClientLogMode(logMode), config.WithLogger(redactingLogger{})}
+	if clientOptions.Retryer != nil {
+		configOptions = append(configOptions, config.WithRetryer(clientOptions.Retryer))
+	}
+	cfg, err := config.LoadDefaultConfig(ctx, configOptions...)
 	if err != nil {
-		return CredentialProcessOutput{}, err
+		return nil, err
 	}
 
 	// Override endpoint if specified
@@ -112,14 +379,12 @@ func GenerateCredentials(opts *CredentialsOpts, signer Signer, signatureAlgorith
 	// Add custom request signer, implementing SigV4-X509
 	certificate, err := signer.Certificate()
 	if err != nil {
-		return CredentialProcessOutput{}, errors.New("unable to find certificate")
+		return nil, errors.New("unable to find certificate")
 	}
 	certificateChain, err := signer.CertificateChain()
 	if err != nil {
 		// If the chain couldn't be found, don't include it in the request
-		if Debug {
-			log.Println(err)
-		}
+		transportLog.debugf("%s", err)
 	}
 	cfg.APIOptions = append(cfg.APIOptions, func(stack *middleware.Stack) error {
 		// Remove middleware related to SigV4 signing
@@ -127,12 +392,20 @@ func GenerateCredentials(opts *CredentialsOpts, signer Signer, signatureAlgorith
 		stack.Finalize.Remove("setLegacyContextSigningOptions")
 		stack.Finalize.Remove("GetIdentity")
 		// Add middleware for SigV4-X509 signing
-		stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("Signing", CreateRequestSignFinalizeFunction(signer, opts.Region, signatureAlgorithm, certificate, certificateChain)), middleware.After)
+		stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("Signing", createRequestSignFinalizeFunction(signer, opts.Region, signatureAlgorithm, certificate, certificateChain, opts.Hooks.OnSign)), middleware.After)
 		return nil
 	})
+	cfg.APIOptions = append(cfg.APIOptions, clientOptions.APIOptions...)
 
 	// Create the Roles Anywhere client using the above-constructed Config
-	rolesAnywhereClient := rolesanywhere.NewFromConfig(cfg)
+	rolesAnywhereClient := rolesanywhere.NewFromConfig(cfg, func(o *rolesanywhere.Options) {
+		if clientOptions.EndpointResolver != nil {
+			o.EndpointResolverV2 = clientOptions.EndpointResolver
+		}
+		if opts.TracerProvider != nil {
+			o.TracerProvider = opts.TracerProvider
+		}
+	})
 
 	certificateStr := base64.StdEncoding.EncodeToString(certificate.Raw)
 	durationSeconds := int32(opts.SessionDuration)
@@ -148,22 +421,5 @@ func GenerateCredentials(opts *CredentialsOpts, signer Signer, signatureAlgorith
 	if opts.RoleSessionName != "" {
 		createSessionRequest.RoleSessionName = &opts.RoleSessionName
 	}
-	output, err := rolesAnywhereClient.CreateSession(ctx, &createSessionRequest)
-	if err != nil {
-		return CredentialProcessOutput{}, err
-	}
-
-	if len(output.CredentialSet) == 0 {
-		msg := "unable to obtain temporary security credentials from CreateSession"
-		return CredentialProcessOutput{}, errors.New(msg)
-	}
-	credentials := output.CredentialSet[0].Credentials
-	credentialProcessOutput := CredentialProcessOutput{
-		Version:         1,
-		AccessKeyId:     *credentials.AccessKeyId,
-		SecretAccessKey: *credentials.SecretAccessKey,
-		SessionToken:    *credentials.SessionToken,
-		Expiration:      *credentials.Expiration,
-	}
-	return credentialProcessOutput, nil
+	return rolesAnywhereClient.CreateSession(ctx, &createSessionRequest)
 }
@@ -0,0 +1,158 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Whether the CRL of the certificate is checked before CreateSession is
+// called, and what happens if the certificate is revoked
+const (
+	// The CRL isn't checked
+	CRLCheckOff = revocationCheckOff
+	// A warning is logged if the certificate is revoked
+	CRLCheckWarn = revocationCheckWarn
+	// An error is returned if the certificate is revoked
+	CRLCheckEnforce = revocationCheckEnforce
+)
+
+// Largest CRL that's downloaded
+const maxCRLSize = 32 << 20
+
+// CRLs that were downloaded, by their URL, which are reused until their
+// NextUpdate time
+var revocationLists struct {
+	sync.Mutex
+	lists map[string]*x509.RevocationList
+}
+
+// Checks whether the certificate is on the CRL of its issuer (from the CRL
+// file of the options, or otherwise from the CRL distribution points of the
+// certificate), and returns an error that wraps ErrCertificateRevoked if it
+// is. As with OCSP, a warning is logged and the certificate is used if the
+// CRL can't be obtained.
+func checkCRL(ctx context.Context, opts *CredentialsOpts, certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) error {
+	list, err := revocationList(ctx, opts, certificate, issuer, now)
+	if err != nil {
+		LogWarnf("unable to determine through a CRL whether the certificate with serial number %s has been revoked: %s",
+			certificate.SerialNumber, err)
+		return nil
+	}
+	for _, entry := range list.RevokedCertificateEntries {
+		if entry.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+			return revokedCertificateError(certificate, entry.RevocationTime)
+		}
+	}
+	return nil
+}
+
+// Returns the CRL that the certificate is checked against
+func revocationList(ctx context.Context, opts *CredentialsOpts, certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) (*x509.RevocationList, error) {
+	if opts.CRLFile != "" {
+		data, err := os.ReadFile(opts.CRLFile)
+		if err != nil {
+			return nil, err
+		}
+		return parseRevocationList(data, issuer, now)
+	}
+
+	err := errors.New("the certificate doesn't name an HTTP CRL distribution point")
+	for _, url := range certificate.CRLDistributionPoints {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			continue
+		}
+		var list *x509.RevocationList
+		if list, err = cachedRevocationList(ctx, opts, url, issuer, now); err == nil {
+			return list, nil
+		}
+	}
+	return nil, err
+}
+
+// Returns the CRL at the URL, from memory, from the CRL cache directory of
+// the options, or by downloading it (in which case it's written to the cache
+// directory, so that other processes can reuse it)
+func cachedRevocationList(ctx context.Context, opts *CredentialsOpts, url string, issuer *x509.Certificate, now time.Time) (*x509.RevocationList, error) {
+	current := func(list *x509.RevocationList) bool {
+		return !list.NextUpdate.IsZero() && now.Before(list.NextUpdate)
+	}
+
+	revocationLists.Lock()
+	list, ok := revocationLists.lists[url]
+	revocationLists.Unlock()
+	if ok && current(list) && list.CheckSignatureFrom(issuer) == nil {
+		return list, nil
+	}
+
+	var path string
+	if opts.CRLCacheDir != "" {
+		hash := sha256.Sum256([]byte(url))
+		path = filepath.Join(opts.CRLCacheDir, hex.EncodeToString(hash[:])+".crl")
+		if data, err := os.ReadFile(path); err == nil {
+			if list, err = parseRevocationList(data, issuer, now); err == nil && current(list) {
+				storeRevocationList(url, list)
+				return list, nil
+			}
+		}
+	}
+
+	transportLog.debugf("downloading the CRL at %s", url)
+	data, err := fetchRevocationData(ctx, opts, http.MethodGet, url, "", nil, maxCRLSize)
+	if err != nil {
+		return nil, err
+	}
+	if list, err = parseRevocationList(data, issuer, now); err != nil {
+		return nil, err
+	}
+	if current(list) {
+		storeRevocationList(url, list)
+		if path != "" {
+			if err = os.MkdirAll(opts.CRLCacheDir, 0700); err == nil {
+				err = writeFileAtomic(path, data)
+			}
+			if err != nil {
+				cacheLog.warnf("unable to cache the CRL at %s: %s", url, err)
+			}
+		}
+	}
+	return list, nil
+}
+
+func storeRevocationList(url string, list *x509.RevocationList) {
+	revocationLists.Lock()
+	defer revocationLists.Unlock()
+	if revocationLists.lists == nil {
+		revocationLists.lists = make(map[string]*x509.RevocationList)
+	}
+	revocationLists.lists[url] = list
+}
+
+// Parses a CRL (DER or PEM), and checks that it's signed by the issuer and
+// hasn't expired
+func parseRevocationList(data []byte, issuer *x509.Certificate, now time.Time) (*x509.RevocationList, error) {
+	if block, _ := pem.Decode(data); block != nil && block.Type == "X509 CRL" {
+		data = block.Bytes
+	}
+	list, err := x509.ParseRevocationList(data)
+	if err != nil {
+		return nil, err
+	}
+	if err = list.CheckSignatureFrom(issuer); err != nil {
+		return nil, fmt.Errorf("the CRL isn't signed by the issuer of the certificate: %w", err)
+	}
+	if !list.NextUpdate.IsZero() && now.After(list.NextUpdate) {
+		return nil, fmt.Errorf("the CRL expired at %s", list.NextUpdate.UTC().Format(time.RFC3339))
+	}
+	return list, nil
+}
@@ -0,0 +1,136 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCRLCheck(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	caDer, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	ca, _ := x509.ParseCertificate(caDer)
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now().Add(-time.Minute),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: big.NewInt(2), RevocationTime: time.Now().Add(-time.Minute)},
+		},
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	crlFile := filepath.Join(dir, "ca.crl")
+	os.WriteFile(crlFile, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl}), 0600)
+
+	var downloads atomic.Int32
+	distributionPoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Write(crl)
+	}))
+	defer distributionPoint.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	newSigner := func(serialNumber int64) Signer {
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(serialNumber),
+			Subject:               pkix.Name{CommonName: "test"},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			CRLDistributionPoints: []string{distributionPoint.URL + "/ca.crl"},
+		}
+		der, _ := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+		certificate, _ := x509.ParseCertificate(der)
+		signer, _, err := NewCryptoSigner(key, certificate, []*x509.Certificate{ca})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signer
+	}
+
+	cacheDir := filepath.Join(dir, "cache")
+	for _, tc := range []struct {
+		name     string
+		serial   int64
+		mode     string
+		crlFile  string
+		rejected bool
+	}{
+		{"good", 3, CRLCheckEnforce, "", false},
+		{"revoked", 2, CRLCheckEnforce, "", true},
+		{"revoked-warn", 2, CRLCheckWarn, "", false},
+		{"revoked-file", 2, CRLCheckEnforce, crlFile, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signer := newSigner(tc.serial)
+			defer signer.Close()
+			opts := CredentialsOpts{
+				TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+				ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+				RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				SessionDuration:   900,
+				Endpoint:          server.URL,
+				CRLCheck:          tc.mode,
+				CRLFile:           tc.crlFile,
+				CRLCacheDir:       cacheDir,
+			}
+			sent := requests.Load()
+			_, err := GenerateCredentials(&opts, signer, "SHA256")
+			if errors.Is(err, ErrCertificateRevoked) != tc.rejected {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if (requests.Load() == sent) != tc.rejected {
+				t.Errorf("expected CreateSession to be called only if the certificate isn't rejected")
+			}
+		})
+	}
+	if downloads.Load() != 1 {
+		t.Errorf("expected the CRL to be downloaded once, but it was downloaded %d times", downloads.Load())
+	}
+
+	// Another process reuses the CRL from the cache directory
+	revocationLists.Lock()
+	revocationLists.lists = nil
+	revocationLists.Unlock()
+	signer := newSigner(2)
+	defer signer.Close()
+	opts := CredentialsOpts{CRLCheck: CRLCheckEnforce, CRLCacheDir: cacheDir}
+	if err = checkRevocation(context.Background(), &opts, signer, time.Now()); !errors.Is(err, ErrCertificateRevoked) {
+		t.Errorf("expected the certificate to be rejected, got %v", err)
+	}
+	if downloads.Load() != 1 {
+		t.Error("expected the cached CRL to be reused")
+	}
+}
@@ -0,0 +1,336 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// How long each network check of Diagnose waits for a response
+const diagnoseTimeout = 15 * time.Second
+
+// Results of the checks that Diagnose ran, along with what they were run
+// with, for support tickets. Secrets are redacted from all of it.
+type DiagnosticReport struct {
+	Time     time.Time `json:"Time"`
+	Platform string    `json:"Platform"`
+	Backends []string  `json:"Backends"`
+	FIPS     bool      `json:"FIPS"`
+	// URL of the Roles Anywhere endpoint, and of the proxy that requests to it
+	// go through (if there's one)
+	Endpoint string `json:"Endpoint,omitempty"`
+	Proxy    string `json:"Proxy,omitempty"`
+	// AWS_ and proxy environment variables
+	Environment map[string]string  `json:"Environment"`
+	Results     []ValidationResult `json:"Results"`
+	// PEM-encoded certificate and chain of the signer (which are public)
+	Certificates string `json:"-"`
+	// Debug log messages that were logged while the checks ran
+	Log string `json:"-"`
+	// Error returned by CreateSession, if it failed
+	CreateSessionError error `json:"-"`
+}
+
+// Whether all of the checks of the report passed
+func (report *DiagnosticReport) Passed() bool {
+	for _, result := range report.Results {
+		if !result.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Runs the checks of ValidateIdentity, and checks the permissions of the
+// private key, the DNS resolution of the Roles Anywhere endpoint, the proxy
+// that's used to reach it, the TLS connection to it, the system clock
+// (against the Date header of its response), and finally that CreateSession
+// succeeds (the credentials themselves are discarded). Failed checks are
+// reported through the results, rather than returned, so that the report
+// can be shared as a whole.
+func Diagnose(ctx context.Context, opts *CredentialsOpts) DiagnosticReport {
+	report := DiagnosticReport{
+		Time:        time.Now().UTC(),
+		Platform:    runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:    Backends(),
+		FIPS:        FIPSEnabled(),
+		Environment: diagnosticEnvironment(),
+	}
+	report.Log = captureDebugLogs(func() {
+		report.diagnose(ctx, opts)
+	})
+	return report
+}
+
+func (report *DiagnosticReport) diagnose(ctx context.Context, opts *CredentialsOpts) {
+	results, err := ValidateIdentity(opts, time.Now())
+	if err != nil {
+		report.Results = append(report.Results, ValidationResult{Check: "identity material can be loaded",
+			Message: Redact(err.Error())})
+	}
+	report.Results = append(report.Results, results...)
+	report.Results = append(report.Results, diagnosePermissions(opts)...)
+
+	endpoint, err := createSessionEndpoint(ctx, opts)
+	if err != nil {
+		report.Results = append(report.Results, ValidationResult{Check: "endpoint is known",
+			Message: fmt.Sprintf("unable to determine the Roles Anywhere endpoint: %s", Redact(err.Error()))})
+	} else {
+		report.Endpoint = endpoint
+		report.diagnoseEndpoint(ctx, opts, endpoint)
+	}
+
+	report.diagnoseCreateSession(ctx, opts)
+}
+
+// Checks that the files that hold the private key are only accessible by
+// their owner
+func diagnosePermissions(opts *CredentialsOpts) []ValidationResult {
+	path := opts.PrivateKeyId
+	if path == "" {
+		// PKCS#12 files hold the private key along with the certificate
+		path = opts.CertificateId
+	}
+	if path == "" || path == StdinIdentityId {
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+		// PKCS#11 URIs, TPM handles, and certificate store selectors
+		return nil
+	}
+	result := ValidationResult{Check: "private key file is only accessible by its owner"}
+	if err := checkOwnerOnlyPermissions(path); err != nil {
+		result.Message = err.Error()
+		return []ValidationResult{result}
+	}
+	result.Passed = true
+	return []ValidationResult{result}
+}
+
+// Checks that the host name of the endpoint resolves (unless a proxy resolves
+// it), which proxy is used, that a TLS connection to the endpoint can be
+// established, and that the system clock agrees with that of the endpoint
+func (report *DiagnosticReport) diagnoseEndpoint(ctx context.Context, opts *CredentialsOpts, endpoint string) {
+	endpointURL, err := url.Parse(endpoint)
+	if err != nil {
+		report.Results = append(report.Results, ValidationResult{Check: "endpoint is known",
+			Message: fmt.Sprintf("%q isn't a valid URL", endpoint)})
+		return
+	}
+
+	proxy := ValidationResult{Check: "proxy settings are valid"}
+	var proxyURL *url.URL
+	if opts.WithProxy {
+		proxyURL, err = http.ProxyFromEnvironment(&http.Request{URL: endpointURL})
+	}
+	switch {
+	case err != nil:
+		proxy.Message = fmt.Sprintf("unable to determine the proxy: %s", Redact(err.Error()))
+	case proxyURL != nil:
+		proxy.Passed = true
+		report.Proxy = Redact(proxyURL.String())
+		proxy.Message = fmt.Sprintf("requests to %s go through the proxy %s", endpointURL.Host, report.Proxy)
+	case opts.WithProxy:
+		proxy.Passed = true
+		proxy.Message = fmt.Sprintf("no proxy is used for %s (through HTTPS_PROXY and NO_PROXY)", endpointURL.Host)
+	case os.Getenv("HTTPS_PROXY") != "" || os.Getenv("https_proxy") != "":
+		proxy.Passed = true
+		proxy.Message = "HTTPS_PROXY is set, but isn't used without --with-proxy"
+	default:
+		proxy.Passed = true
+		proxy.Message = "no proxy is used"
+	}
+	report.Results = append(report.Results, proxy)
+
+	// With a proxy, the proxy resolves the host name (which may not resolve
+	// locally)
+	if proxyURL == nil {
+		dns := ValidationResult{Check: "endpoint host name resolves"}
+		lookupCtx, cancel := context.WithTimeout(ctx, diagnoseTimeout)
+		addresses, err := net.DefaultResolver.LookupHost(lookupCtx, endpointURL.Hostname())
+		cancel()
+		if err != nil {
+			dns.Message = err.Error()
+		} else {
+			dns.Passed = true
+			dns.Message = fmt.Sprintf("%s resolves to %s", endpointURL.Hostname(), strings.Join(addresses, ", "))
+		}
+		report.Results = append(report.Results, dns)
+	}
+
+	connection := ValidationResult{Check: "endpoint is reachable"}
+	clock := ValidationResult{Check: "system clock agrees with Roles Anywhere"}
+	response, err := diagnoseConnection(ctx, opts, endpoint)
+	if err != nil {
+		connection.Message = Redact(err.Error())
+		clock.Message = "unable to check, since the endpoint isn't reachable"
+		report.Results = append(report.Results, connection, clock)
+		return
+	}
+	connection.Passed = true
+	connection.Message = fmt.Sprintf("connected to %s with %s", endpointURL.Host, response.Proto)
+	if response.TLS != nil {
+		connection.Message += fmt.Sprintf(" over %s", tls.VersionName(response.TLS.Version))
+	}
+
+	serverTime, err := http.ParseTime(response.Header.Get("Date"))
+	if err != nil {
+		clock.Passed = true
+		clock.Message = "unable to check, since the response has no Date header"
+	} else {
+		// The Date header only has a resolution of seconds
+		skew := serverTime.Sub(time.Now()).Round(time.Second)
+		clock.Message = fmt.Sprintf("the system clock is %s behind Roles Anywhere", skew)
+		if skew < 0 {
+			clock.Message = fmt.Sprintf("the system clock is %s ahead of Roles Anywhere", -skew)
+		}
+		clock.Passed = skew < clockSkewThreshold && skew > -clockSkewThreshold
+		if !clock.Passed {
+			clock.Message += "; synchronize it (for example, through NTP)"
+		}
+	}
+	report.Results = append(report.Results, connection, clock)
+}
+
+// Sends a HEAD request to the endpoint, with the client that CreateSession
+// is called with, and returns the response (whose body is closed)
+func diagnoseConnection(ctx context.Context, opts *CredentialsOpts, endpoint string) (*http.Response, error) {
+	client, err := createSessionClient(opts)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, diagnoseTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	return response, nil
+}
+
+// Calls CreateSession with the signer of the options, and records its
+// certificates
+func (report *DiagnosticReport) diagnoseCreateSession(ctx context.Context, opts *CredentialsOpts) {
+	result := ValidationResult{Check: "CreateSession succeeds"}
+	defer func() {
+		report.Results = append(report.Results, result)
+	}()
+
+	signer, signatureAlgorithm, err := GetSigner(opts)
+	if err != nil {
+		report.CreateSessionError = err
+		result.Message = fmt.Sprintf("unable to create the signer: %s", Redact(err.Error()))
+		return
+	}
+	defer signer.Close()
+	report.Certificates = encodeDiagnosticCertificates(signer)
+
+	ctx, cancel := context.WithTimeout(ctx, diagnoseTimeout)
+	defer cancel()
+	output, err := GenerateCredentialsWithContext(ctx, opts, signer, signatureAlgorithm)
+	if err != nil {
+		report.CreateSessionError = err
+		result.Message = Redact(err.Error())
+		if requestId := ErrorRequestId(err); requestId != "" {
+			result.Message += fmt.Sprintf(" (request ID %s)", requestId)
+		}
+		return
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("obtained credentials for %s, which expire at %s", opts.RoleArn, output.Expiration)
+	if output.Metadata != nil && output.Metadata.RequestId != "" {
+		result.Message += fmt.Sprintf(" (request ID %s)", output.Metadata.RequestId)
+	}
+}
+
+// Returns the certificate and chain of the signer, PEM-encoded
+func encodeDiagnosticCertificates(signer Signer) string {
+	var buf bytes.Buffer
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+	}
+	if chain, err := signer.CertificateChain(); err == nil {
+		for _, certificate := range chain {
+			pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+		}
+	}
+	return buf.String()
+}
+
+// Returns the AWS_ and proxy environment variables, with the values of
+// those that hold secrets redacted
+func diagnosticEnvironment() map[string]string {
+	environment := make(map[string]string)
+	for _, variable := range os.Environ() {
+		name, value, _ := strings.Cut(variable, "=")
+		upper := strings.ToUpper(name)
+		switch {
+		case strings.HasPrefix(upper, "AWS_"):
+		case upper == "HTTP_PROXY", upper == "HTTPS_PROXY", upper == "NO_PROXY":
+		default:
+			continue
+		}
+		for _, secret := range []string{"SECRET", "TOKEN", "PASSWORD", "PIN"} {
+			if strings.Contains(upper, secret) {
+				value = redacted
+			}
+		}
+		environment[name] = Redact(value)
+	}
+	return environment
+}
+
+// Runs the function with debug logging enabled, and returns the messages
+// that were logged meanwhile (instead of logging them)
+func captureDebugLogs(run func()) string {
+	var buf bytes.Buffer
+	logOutput.Lock()
+	destination, writer, debug := logDestination, log.Writer(), Debug
+	logDestination, Debug = nil, true
+	log.SetOutput(&buf)
+	logOutput.Unlock()
+	defer func() {
+		logOutput.Lock()
+		logDestination, Debug = destination, debug
+		log.SetOutput(writer)
+		logOutput.Unlock()
+	}()
+
+	run()
+	return buf.String()
+}
+
+// Formats the results of the report as lines of text, as the validate
+// command prints them
+func (report *DiagnosticReport) Summary() string {
+	var lines []string
+	for _, result := range report.Results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		if result.Message != "" {
+			lines = append(lines, fmt.Sprintf("[%s] %s: %s", status, result.Check, result.Message))
+		} else {
+			lines = append(lines, fmt.Sprintf("[%s] %s", status, result.Check))
+		}
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,90 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"io"
+)
+
+// Options for Signer.Sign that mark the data that's passed as a digest that
+// has already been computed with the hash function, as with crypto.Signer.
+// With other options, Signer.Sign hashes the data (the payload) itself.
+type PrehashedOpts struct {
+	Hash crypto.Hash
+}
+
+func (opts PrehashedOpts) HashFunc() crypto.Hash {
+	return opts.Hash
+}
+
+// Signs a payload, which the signer hashes with the hash function
+func SignPayload(signer Signer, rand io.Reader, payload []byte, hash crypto.Hash) ([]byte, error) {
+	return signer.Sign(rand, payload, hash)
+}
+
+// Signs a digest that has already been computed with the hash function
+func SignDigest(signer Signer, rand io.Reader, digest []byte, hash crypto.Hash) ([]byte, error) {
+	return signer.Sign(rand, digest, PrehashedOpts{hash})
+}
+
+// crypto.Signer that signs digests, as specified by the crypto.Signer
+// contract
+type digestSigner struct {
+	signer Signer
+}
+
+// Returns a crypto.Signer for the signer that follows the crypto.Signer
+// contract (its Sign method is passed digests rather than payloads), for use
+// with packages such as crypto/tls and crypto/x509
+func AsCryptoSigner(signer Signer) crypto.Signer {
+	return digestSigner{signer}
+}
+
+func (s digestSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+func (s digestSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if opts == nil {
+		return nil, ErrUnsupportedHash
+	}
+	return s.signer.Sign(rand, digest, PrehashedOpts{opts.HashFunc()})
+}
+
+// Returns whether the data passed to Signer.Sign is a digest
+func isPrehashed(opts crypto.SignerOpts) bool {
+	_, ok := opts.(PrehashedOpts)
+	return ok
+}
+
+// Returns the digest to sign for the data passed to Signer.Sign: the data
+// itself if it's a digest, and otherwise its hash. Only SHA-256, SHA-384, and
+// SHA-512 are supported.
+func signatureDigest(data []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	switch hash {
+	case crypto.SHA256, crypto.SHA384, crypto.SHA512:
+	default:
+		return nil, ErrUnsupportedHash
+	}
+
+	if isPrehashed(opts) {
+		if len(data) != hash.Size() {
+			return nil, fmt.Errorf("digest is %d bytes long, but %s digests are %d bytes long", len(data), hash, hash.Size())
+		}
+		return data, nil
+	}
+	switch hash {
+	case crypto.SHA256:
+		sum := sha256.Sum256(data)
+		return sum[:], nil
+	case crypto.SHA384:
+		sum := sha512.Sum384(data)
+		return sum[:], nil
+	default:
+		sum := sha512.Sum512(data)
+		return sum[:], nil
+	}
+}
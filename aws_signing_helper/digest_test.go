@@ -0,0 +1,69 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"testing"
+)
+
+func TestPrehashedSign(t *testing.T) {
+	message := []byte("test message")
+	digest := sha256.Sum256(message)
+
+	for _, keyName := range []string{"rsa-2048", "ec-prime256v1"} {
+		signer, _, err := GetSigner(&CredentialsOpts{
+			CertificateId: fmt.Sprintf("../tst/certs/%s-sha256-cert.pem", keyName),
+			PrivateKeyId:  fmt.Sprintf("../tst/certs/%s-key.pem", keyName),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer signer.Close()
+
+		// Payloads and digests result in signatures over the same digest
+		payloadSignature, err := SignPayload(signer, rand.Reader, message, crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		digestSignature, err := SignDigest(signer, rand.Reader, digest[:], crypto.SHA256)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, signature := range [][]byte{payloadSignature, digestSignature} {
+			var valid bool
+			switch publicKey := signer.Public().(type) {
+			case *rsa.PublicKey:
+				valid = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature) == nil
+			case *ecdsa.PublicKey:
+				valid = ecdsa.VerifyASN1(publicKey, digest[:], signature)
+			}
+			if !valid {
+				t.Logf("invalid %s signature", keyName)
+				t.Fail()
+			}
+		}
+
+		if _, err = SignDigest(signer, rand.Reader, message, crypto.SHA256); err == nil {
+			t.Log("signed a digest of the wrong length")
+			t.Fail()
+		}
+
+		// The crypto.Signer can be used by packages that pass digests
+		template := &x509.CertificateRequest{Subject: pkix.Name{CommonName: "test"}}
+		der, err := x509.CreateCertificateRequest(rand.Reader, template, AsCryptoSigner(signer))
+		if err != nil {
+			t.Fatal(err)
+		}
+		csr, err := x509.ParseCertificateRequest(der)
+		if err != nil || csr.CheckSignature() != nil {
+			t.Logf("invalid %s certificate request: %v", keyName, err)
+			t.Fail()
+		}
+	}
+}
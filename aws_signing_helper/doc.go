@@ -0,0 +1,92 @@
+// Package aws_signing_helper obtains temporary AWS credentials from IAM Roles
+// Anywhere, by signing CreateSession requests with an X.509 certificate and
+// its private key. It's used by the aws_signing_helper command, and can be
+// imported by Go programs that need credentials in-process instead of running
+// the command.
+//
+// The following make up the stable API of the package, which only changes in
+// backwards-compatible ways within a major version:
+//
+//   - Credentialer, NewCredentialer, and NewCredentialerWithSigner, which
+//     obtain credentials, and CredentialerOptions and RoundTripperFunc,
+//     which customize the HTTP client, transport, endpoint resolver, retryer,
+//     and middleware of their calls
+//   - BuildCreateSessionRequest and ParseCreateSessionResponse, which sign
+//     the CreateSession request without sending it, so that it can be sent
+//     over another transport
+//   - Signer and GetSigner, which sign requests with the private key, wherever
+//     it's stored (files, PKCS#11 modules, TPMs, platform certificate
+//     stores, the X.509-SVIDs of the SPIFFE Workload API, and Kubernetes
+//     secrets), along with SignPayload, SignDigest, PrehashedOpts, and
+//     AsCryptoSigner
+//   - RegisterSigner, SignerFactory, and NewCryptoSigner, which plug in
+//     signers for keys that the built-in backends can't access
+//   - CredentialsOpts, CertIdentifier, and CredentialProcessOutput, which
+//     configure signers and hold credentials, CredentialMetadata, which
+//     describes the session and identity of credentials, and
+//     LoadCredentialsOptsFromConfigFileProfile, which reads the options from
+//     the rolesanywhere_ settings of a profile in the AWS config file
+//   - CredentialCache, CredentialCacheKey, NewMemoryCredentialCache,
+//     NewFileCredentialCache, and NewNoCredentialCache, which let
+//     Credentialers reuse credentials (including across processes)
+//   - Hooks and its events, which report refreshes, signatures, errors,
+//     cache hits, and certificates that expire soon
+//   - Metrics, MetricsHooks, NewExpvarMetrics, NewStatsdMetrics, and the
+//     Metric names, which record the events as counters and gauges, and
+//     EMFHooks and EMFOptions, which write them as CloudWatch Embedded Metric
+//     Format records
+//   - NewWebhook, WebhookHooks, and WebhookEvent, which notify a URL of
+//     failing refreshes and expiring certificates
+//   - CredentialsOpts.TracerProvider, which records spans of key loads,
+//     signatures, and CreateSession calls
+//   - ParseECRRegistry and GetECRAuthorizationToken, which exchange
+//     credentials for the authorization tokens of private Amazon ECR
+//     registries
+//   - ProvisionDevice and CredentialsOpts.FleetProvisioning, which obtain
+//     the certificate of a device from AWS IoT fleet provisioning with a
+//     claim certificate
+//   - EnrollACME and CredentialsOpts.ACME, which enroll (and renew) the
+//     certificate with an ACME server
+//   - NewPodInjector and PodInjectorOptions, a mutating admission webhook
+//     that injects the sidecar into annotated Kubernetes pods
+//   - WithCorrelationId, ErrorCorrelationId, and ErrorRequestId, which tie
+//     log messages, errors, and CreateSession requests to each other
+//   - ErrInvalidArn, ErrCertificateExpired, ErrUnsupportedAlgorithm,
+//     ErrThrottled, ErrEndpointUnreachable, ErrBackendUnavailable,
+//     ErrKeyCertificateMismatch, ErrCertificateKeyUsage, ErrWeakKey,
+//     ErrCertificateRevoked, ErrInsecurePermissions, ErrUntrustedCertificate,
+//     ErrClockNotSynchronized, and ErrUnsupportedHash,
+//     which returned errors wrap (they can be checked for with errors.Is),
+//     and ParseExtKeyUsage, which parses the names of the extended key
+//     usages that certificates are required to allow
+//
+// The PKCS#11, TPM, and certificate store backends can be left out of the
+// build with the nopkcs11, notpm, and nocertstore build tags, so that the
+// package builds without cgo or their dependencies (the PKCS#11 and
+// certificate store backends are also left out when cgo is disabled).
+// Backends returns the backends that were compiled in. When a FIPS
+// 140-validated module is in use (with GOEXPERIMENT=boringcrypto, or the Go
+// Cryptographic Module in FIPS mode), the package only accepts FIPS-approved
+// key material; FIPSEnabled reports whether it is.
+//
+// Other exported identifiers are used by the aws_signing_helper command (for
+// example, to implement the serve and update commands), and may change in
+// minor releases. Fields of CredentialsOpts that are documented as only
+// being used by a command are ignored by the stable API.
+//
+// For example:
+//
+//	credentialer, err := aws_signing_helper.NewCredentialer(&aws_signing_helper.CredentialsOpts{
+//		CertificateId:     "/etc/rolesanywhere/cert.pem",
+//		PrivateKeyId:      "/etc/rolesanywhere/key.pem",
+//		TrustAnchorArnStr: trustAnchorArn,
+//		ProfileArnStr:     profileArn,
+//		RoleArn:           roleArn,
+//		SessionDuration:   3600,
+//	})
+//	if err != nil {
+//		return err
+//	}
+//	defer credentialer.Close()
+//	credentials, err := credentialer.Credentials(ctx)
+package aws_signing_helper
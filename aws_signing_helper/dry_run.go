@@ -0,0 +1,120 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Returned by the middleware that captures the request in a dry run, to stop
+// the request from being sent
+var errDryRun = errors.New("dry run")
+
+// The prepared CreateSession request, as it would have been sent
+type DryRunOutput struct {
+	Method           string
+	Endpoint         string
+	Headers          []DryRunHeader
+	CanonicalRequest string
+	SignedHeaders    string
+	StringToSign     string
+	Body             string
+	// Sizes of the headers, in bytes, since a long certificate chain can make
+	// the request exceed the limits on header sizes. HeadersSize is the total
+	// size of the headers (before redaction), as they would be sent over
+	// HTTP/1.1.
+	HeadersSize                int
+	CertificateHeaderSize      int
+	CertificateChainHeaderSize int
+	CertificateChainLength     int
+}
+
+type DryRunHeader struct {
+	Name  string
+	Value string
+}
+
+// Builds and signs the CreateSession request without sending it, and returns
+// it, so that signature and certificate chain issues can be debugged offline.
+// The signature in the Authorization header is redacted, since the signed
+// request could otherwise be replayed.
+func DryRunCreateSession(opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (DryRunOutput, error) {
+	var output DryRunOutput
+	var captureErr error
+
+	captureRequest := func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("DryRun", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			req, ok := in.Request.(*smithyhttp.Request)
+			if !ok {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected request middleware type %T", in.Request)
+			}
+			output, captureErr = describeSignedRequest(req, v4.GetPayloadHash(ctx), opts.Region, signatureAlgorithm)
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, errDryRun
+		}), middleware.After)
+	}
+
+	_, err := createSession(context.Background(), opts, signer, signatureAlgorithm, CredentialerOptions{
+		APIOptions: []func(*middleware.Stack) error{captureRequest},
+	})
+	if !errors.Is(err, errDryRun) {
+		if err == nil {
+			err = errors.New("request was sent during a dry run")
+		}
+		return DryRunOutput{}, err
+	}
+	return output, captureErr
+}
+
+// Describes a request that has been signed with SigV4-X509
+func describeSignedRequest(req *smithyhttp.Request, payloadHash string, signingRegion string, signatureAlgorithm string) (DryRunOutput, error) {
+	output := DryRunOutput{
+		Method:   req.Method,
+		Endpoint: req.URL.String(),
+	}
+
+	if stream := req.GetStream(); stream != nil {
+		body, err := io.ReadAll(stream)
+		if err != nil {
+			return DryRunOutput{}, err
+		}
+		output.Body = string(body)
+	}
+
+	names := make([]string, 0, len(req.Header))
+	for name := range req.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, value := range req.Header.Values(name) {
+			output.Headers = append(output.Headers, DryRunHeader{name, Redact(value)})
+			output.HeadersSize += len(name) + len(": ") + len(value) + len("\r\n")
+		}
+	}
+	output.CertificateHeaderSize = len(req.Header.Get(x_amz_x509))
+	if chain := req.Header.Get(x_amz_x509_chain); chain != "" {
+		output.CertificateChainHeaderSize = len(chain)
+		output.CertificateChainLength = strings.Count(chain, ",") + 1
+	}
+
+	signingTime, err := time.Parse(timeFormat, req.Header.Get(x_amz_date))
+	if err != nil {
+		return DryRunOutput{}, errors.New("unable to determine the signing time of the request")
+	}
+	signerParams := SignerParams{signingTime, signingRegion, ROLESANYWHERE_SIGNING_NAME, signatureAlgorithm}
+	output.CanonicalRequest, output.SignedHeaders = buildCanonicalRequest(req.Request, payloadHash)
+	hashedCanonicalRequest, _ := createCanonicalRequest(req.Request, payloadHash)
+	output.StringToSign = CreateStringToSign(hashedCanonicalRequest, signerParams)
+
+	return output, nil
+}
@@ -0,0 +1,63 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDryRunCreateSession(t *testing.T) {
+	requestSent := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestSent = true
+	}))
+	defer server.Close()
+
+	opts := CredentialsOpts{
+		CertificateId:       "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:        "../tst/certs/rsa-2048-key.pem",
+		CertificateBundleId: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+		TrustAnchorArnStr:   "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:       "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:             "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:     900,
+		Endpoint:            server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	output, err := DryRunCreateSession(&opts, signer, signatureAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requestSent {
+		t.Log("request was sent during a dry run")
+		t.Fail()
+	}
+
+	if output.Method != "POST" || !strings.HasPrefix(output.Endpoint, server.URL+"/sessions") {
+		t.Log("unexpected endpoint:", output.Method, output.Endpoint)
+		t.Fail()
+	}
+	if output.CertificateHeaderSize == 0 || output.CertificateChainLength != 1 || output.CertificateChainHeaderSize == 0 {
+		t.Log("unexpected certificate header sizes:", output.CertificateHeaderSize, output.CertificateChainHeaderSize)
+		t.Fail()
+	}
+	if !strings.HasPrefix(output.CanonicalRequest, "POST\n/sessions\n") ||
+		!strings.Contains(output.SignedHeaders, "x-amz-x509-chain") ||
+		!strings.HasPrefix(output.StringToSign, signatureAlgorithm+"\n") ||
+		!strings.Contains(output.Body, `"durationSeconds":900`) {
+		t.Log("unexpected prepared request:", output)
+		t.Fail()
+	}
+	for _, header := range output.Headers {
+		if header.Name == "Authorization" && !strings.HasSuffix(header.Value, "Signature="+redacted) {
+			t.Log("signature wasn't redacted:", header.Value)
+			t.Fail()
+		}
+	}
+}
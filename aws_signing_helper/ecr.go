@@ -0,0 +1,195 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	v4 "github.com/aws/aws-sdk-go-v2/aws/signer/v4"
+)
+
+// How long GetAuthorizationToken calls may take
+const ecrRequestTimeout = 30 * time.Second
+
+// Target of the GetAuthorizationToken action of the ECR API
+const ecrGetAuthorizationTokenTarget = "AmazonEC2ContainerRegistry_V20150921.GetAuthorizationToken"
+
+// Host names of private ECR registries: the account, whether the endpoint is
+// a FIPS endpoint, the region, and the domain of the partition (on.aws for
+// dual-stack endpoints)
+var ecrRegistryHostPattern = regexp.MustCompile(`^([0-9]{12})\.dkr[.-]ecr(-fips)?\.([a-z0-9-]+)\.(amazonaws\.com|amazonaws\.com\.cn|on\.aws)$`)
+
+// Private Amazon ECR registry, as identified by its host name
+type ECRRegistry struct {
+	Host      string
+	AccountId string
+	Region    string
+	FIPS      bool
+	// Whether the registry is reached through its dual-stack endpoint
+	DualStack bool
+}
+
+// Authorization token of ECR, which is valid for all the registries that the
+// credentials it was obtained with can access
+type ECRAuthorizationToken struct {
+	Username string
+	Password string
+	// URL of the registry the token was obtained for
+	ProxyEndpoint string
+	ExpiresAt     time.Time
+}
+
+// Configuration of GetECRAuthorizationToken
+type ECRTokenOptions struct {
+	// Endpoint of the ECR API (such as that of a VPC endpoint). By default,
+	// the endpoint of the region of the registry is used.
+	Endpoint string
+	// Whether the request is sent through the proxy of the environment
+	WithProxy bool
+	// Client that the request is sent with, instead of one that's created
+	// according to WithProxy
+	HTTPClient *http.Client
+}
+
+// Parses the server URL of a private ECR registry (such as
+// 123456789012.dkr.ecr.us-east-1.amazonaws.com, with or without a scheme,
+// port, or path), as it's passed to Docker credential helpers
+func ParseECRRegistry(serverURL string) (ECRRegistry, error) {
+	host := strings.TrimSpace(serverURL)
+	if strings.Contains(host, "://") {
+		parsed, err := url.Parse(host)
+		if err != nil {
+			return ECRRegistry{}, fmt.Errorf("invalid registry URL %s: %w", serverURL, err)
+		}
+		host = parsed.Hostname()
+	} else {
+		host, _, _ = strings.Cut(host, "/")
+		host, _, _ = strings.Cut(host, ":")
+	}
+	host = strings.ToLower(host)
+	match := ecrRegistryHostPattern.FindStringSubmatch(host)
+	if match == nil {
+		return ECRRegistry{}, fmt.Errorf("%s isn't a private Amazon ECR registry", serverURL)
+	}
+	return ECRRegistry{
+		Host:      host,
+		AccountId: match[1],
+		Region:    match[3],
+		FIPS:      match[2] != "",
+		DualStack: match[4] == "on.aws",
+	}, nil
+}
+
+// Returns the endpoint of the ECR API in the region of the registry
+func (registry ECRRegistry) APIEndpoint() string {
+	switch {
+	case registry.DualStack && registry.FIPS:
+		return "https://ecr-fips." + registry.Region + ".api.aws"
+	case registry.DualStack:
+		return "https://ecr." + registry.Region + ".api.aws"
+	case registry.FIPS:
+		return "https://ecr-fips." + registry.Region + ".amazonaws.com"
+	case strings.HasSuffix(registry.Host, ".cn"):
+		return "https://api.ecr." + registry.Region + ".amazonaws.com.cn"
+	}
+	return "https://api.ecr." + registry.Region + ".amazonaws.com"
+}
+
+// Calls GetAuthorizationToken in the region of the registry with the
+// credentials, and returns the user name and password that the registry
+// accepts until the token expires
+func GetECRAuthorizationToken(ctx context.Context, credentials CredentialProcessOutput, registry ECRRegistry, options ECRTokenOptions) (ECRAuthorizationToken, error) {
+	endpoint := options.Endpoint
+	if endpoint == "" {
+		endpoint = registry.APIEndpoint()
+	}
+	client := options.HTTPClient
+	if client == nil {
+		transport := &http.Transport{}
+		if options.WithProxy {
+			transport.Proxy = http.ProxyFromEnvironment
+		}
+		client = &http.Client{Transport: transport, Timeout: ecrRequestTimeout}
+	}
+
+	body := []byte("{}")
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return ECRAuthorizationToken{}, fmt.Errorf("invalid ECR endpoint %s: %w", endpoint, err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", ecrGetAuthorizationTokenTarget)
+	payloadHash := sha256.Sum256(body)
+	err = v4.NewSigner().SignHTTP(ctx, aws.Credentials{
+		AccessKeyID:     credentials.AccessKeyId,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+	}, req, hex.EncodeToString(payloadHash[:]), "ecr", registry.Region, time.Now())
+	if err != nil {
+		return ECRAuthorizationToken{}, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return ECRAuthorizationToken{}, fmt.Errorf("%w: unable to call GetAuthorizationToken: %w", ErrEndpointUnreachable, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return ECRAuthorizationToken{}, fmt.Errorf("unable to read the response of GetAuthorizationToken: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.Unmarshal(respBody, &failure)
+		_, errorType, _ := strings.Cut(failure.Type, "#")
+		if errorType == "" {
+			errorType = failure.Type
+		}
+		return ECRAuthorizationToken{}, fmt.Errorf("GetAuthorizationToken failed with status %d: %s: %s", resp.StatusCode,
+			errorType, failure.Message)
+	}
+
+	var output struct {
+		AuthorizationData []struct {
+			AuthorizationToken string  `json:"authorizationToken"`
+			ExpiresAt          float64 `json:"expiresAt"`
+			ProxyEndpoint      string  `json:"proxyEndpoint"`
+		} `json:"authorizationData"`
+	}
+	if err = json.Unmarshal(respBody, &output); err != nil {
+		return ECRAuthorizationToken{}, fmt.Errorf("invalid response of GetAuthorizationToken: %w", err)
+	}
+	if len(output.AuthorizationData) == 0 {
+		return ECRAuthorizationToken{}, errors.New("GetAuthorizationToken returned no authorization token")
+	}
+	data := output.AuthorizationData[0]
+	decoded, err := base64.StdEncoding.DecodeString(data.AuthorizationToken)
+	if err != nil {
+		return ECRAuthorizationToken{}, fmt.Errorf("invalid authorization token: %w", err)
+	}
+	username, password, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return ECRAuthorizationToken{}, errors.New("invalid authorization token: it has no password")
+	}
+	return ECRAuthorizationToken{
+		Username:      username,
+		Password:      password,
+		ProxyEndpoint: data.ProxyEndpoint,
+		ExpiresAt:     time.Unix(0, int64(data.ExpiresAt*float64(time.Second))).UTC(),
+	}, nil
+}
@@ -0,0 +1,80 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestECRAuthorizationToken(t *testing.T) {
+	registries := []struct {
+		serverURL   string
+		region      string
+		apiEndpoint string
+	}{
+		{"123456789012.dkr.ecr.us-east-1.amazonaws.com", "us-east-1", "https://api.ecr.us-east-1.amazonaws.com"},
+		{"https://123456789012.dkr.ecr.eu-west-1.amazonaws.com/v2/", "eu-west-1", "https://api.ecr.eu-west-1.amazonaws.com"},
+		{"123456789012.dkr.ecr-fips.us-gov-west-1.amazonaws.com", "us-gov-west-1", "https://ecr-fips.us-gov-west-1.amazonaws.com"},
+		{"123456789012.dkr.ecr.cn-north-1.amazonaws.com.cn:443", "cn-north-1", "https://api.ecr.cn-north-1.amazonaws.com.cn"},
+		{"123456789012.dkr-ecr.us-west-2.on.aws", "us-west-2", "https://ecr.us-west-2.api.aws"},
+	}
+	for _, registry := range registries {
+		parsed, err := ParseECRRegistry(registry.serverURL)
+		if err != nil {
+			t.Errorf("unable to parse %s: %s", registry.serverURL, err)
+			continue
+		}
+		if parsed.AccountId != "123456789012" || parsed.Region != registry.region || parsed.APIEndpoint() != registry.apiEndpoint {
+			t.Errorf("unexpected registry for %s: %+v (%s)", registry.serverURL, parsed, parsed.APIEndpoint())
+		}
+	}
+	for _, serverURL := range []string{"index.docker.io", "public.ecr.aws", "12345.dkr.ecr.us-east-1.amazonaws.com",
+		"123456789012.dkr.ecr.us-east-1.amazonaws.com.example.com"} {
+		if _, err := ParseECRRegistry(serverURL); err == nil {
+			t.Errorf("%s was parsed as an ECR registry", serverURL)
+		}
+	}
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	var denied atomic.Bool
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Amz-Target") != ecrGetAuthorizationTokenTarget ||
+			!strings.Contains(r.Header.Get("Authorization"), "/us-east-1/ecr/aws4_request") ||
+			r.Header.Get("X-Amz-Security-Token") != "sessionToken" {
+			t.Errorf("unexpected request headers: %v", r.Header)
+		}
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		if denied.Load() {
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, `{"__type":"com.amazonaws.ecr#AccessDeniedException","message":"not authorized"}`)
+			return
+		}
+		fmt.Fprintf(w, `{"authorizationData":[{"authorizationToken":%q,"expiresAt":%d.5,"proxyEndpoint":"https://123456789012.dkr.ecr.us-east-1.amazonaws.com"}]}`,
+			base64.StdEncoding.EncodeToString([]byte("AWS:password")), expiresAt.Unix())
+	}))
+	defer server.Close()
+
+	registry, _ := ParseECRRegistry("123456789012.dkr.ecr.us-east-1.amazonaws.com")
+	credentials := CredentialProcessOutput{AccessKeyId: "accessKeyId", SecretAccessKey: "secretAccessKey", SessionToken: "sessionToken"}
+	options := ECRTokenOptions{Endpoint: server.URL, HTTPClient: server.Client()}
+	token, err := GetECRAuthorizationToken(context.Background(), credentials, registry, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Username != "AWS" || token.Password != "password" || !token.ExpiresAt.Truncate(time.Second).Equal(expiresAt) {
+		t.Errorf("unexpected token: %+v", token)
+	}
+
+	denied.Store(true)
+	_, err = GetECRAuthorizationToken(context.Background(), credentials, registry, options)
+	if err == nil || !strings.Contains(err.Error(), "AccessDeniedException: not authorized") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,136 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Default namespace of the metrics of EMF records
+const DefaultEMFNamespace = "RolesAnywhere"
+
+// Names of the metrics of EMF records
+const (
+	emfRefreshSuccess           = "RefreshSuccess"
+	emfRefreshFailure           = "RefreshFailure"
+	emfRefreshDuration          = "RefreshDuration"
+	emfCredentialsExpiryMargin  = "CredentialsExpiryMargin"
+	emfCertificateDaysRemaining = "CertificateDaysRemaining"
+)
+
+// Configuration of the EMF records that EMFHooks writes
+type EMFOptions struct {
+	// CloudWatch namespace of the metrics (DefaultEMFNamespace if it's empty)
+	Namespace string
+	// Dimensions of the metrics (such as the role ARN), which should only
+	// take few distinct values across a fleet, since each combination is a
+	// separate CloudWatch metric
+	Dimensions map[string]string
+}
+
+// Writer of EMF records, of which each is written in a single call
+type emfWriter struct {
+	mu         sync.Mutex
+	w          io.Writer
+	namespace  string
+	dimensions map[string]string
+	host       string
+}
+
+// Metric of an EMF record
+type emfMetric struct {
+	name  string
+	unit  string
+	value float64
+}
+
+// Returns hooks that write a CloudWatch Embedded Metric Format record (a JSON
+// line) to the writer for each refresh, each failed refresh, and each
+// warning about a certificate that expires soon, and then call the hooks
+// (whose callbacks can be nil). The CloudWatch agent, Lambda, and the
+// CloudWatch Logs pipelines of containers extract the metrics of the records
+// that they forward: RefreshSuccess and RefreshFailure (counts),
+// RefreshDuration (milliseconds), CredentialsExpiryMargin (the seconds until
+// the credentials expire), and CertificateDaysRemaining.
+func EMFHooks(w io.Writer, options EMFOptions, hooks Hooks) Hooks {
+	emf := &emfWriter{w: w, namespace: options.Namespace, dimensions: options.Dimensions}
+	if emf.namespace == "" {
+		emf.namespace = DefaultEMFNamespace
+	}
+	emf.host, _ = os.Hostname()
+	return Hooks{
+		OnRefresh: func(event RefreshEvent) {
+			metrics := []emfMetric{
+				{emfRefreshSuccess, "Count", 1},
+				{emfRefreshFailure, "Count", 0},
+				{emfRefreshDuration, "Milliseconds", float64(event.Duration.Milliseconds())},
+				{emfCredentialsExpiryMargin, "Seconds", time.Until(event.Expiration).Seconds()},
+			}
+			if event.Certificate != nil {
+				metrics = append(metrics, emfMetric{emfCertificateDaysRemaining, "None",
+					time.Until(event.Certificate.NotAfter).Hours() / 24})
+			}
+			emf.write(metrics, nil)
+			hooks.refreshed(event)
+		},
+		OnSign:     hooks.OnSign,
+		OnCacheHit: hooks.OnCacheHit,
+		OnError: func(event ErrorEvent) {
+			if event.Operation == OperationCreateSession {
+				emf.write([]emfMetric{{emfRefreshSuccess, "Count", 0}, {emfRefreshFailure, "Count", 1}},
+					map[string]any{"Error": Redact(event.Err.Error())})
+			}
+			hooks.failed(event)
+		},
+		OnCertificateExpiring: func(event CertificateExpiryEvent) {
+			emf.write([]emfMetric{{emfCertificateDaysRemaining, "None", event.Remaining.Hours() / 24}}, nil)
+			hooks.certificateExpiring(event)
+		},
+	}
+}
+
+// Writes an EMF record of the metrics, with the dimensions and the
+// properties (which are searchable in CloudWatch Logs, but not metrics).
+// Failures are logged, since the events that are recorded already happened.
+func (emf *emfWriter) write(metrics []emfMetric, properties map[string]any) {
+	record := map[string]any{}
+	for name, value := range properties {
+		record[name] = value
+	}
+	if emf.host != "" {
+		record["Host"] = emf.host
+	}
+	dimensions := make([]string, 0, len(emf.dimensions))
+	for name, value := range emf.dimensions {
+		dimensions = append(dimensions, name)
+		record[name] = value
+	}
+	sort.Strings(dimensions)
+	definitions := make([]map[string]string, 0, len(metrics))
+	for _, metric := range metrics {
+		definitions = append(definitions, map[string]string{"Name": metric.name, "Unit": metric.unit})
+		record[metric.name] = metric.value
+	}
+	record["_aws"] = map[string]any{
+		"Timestamp": time.Now().UnixMilli(),
+		"CloudWatchMetrics": []any{map[string]any{
+			"Namespace":  emf.namespace,
+			"Dimensions": [][]string{dimensions},
+			"Metrics":    definitions,
+		}},
+	}
+	line, err := json.Marshal(record)
+	if err != nil {
+		generalLog.warnf("unable to write the EMF record: %s", err)
+		return
+	}
+
+	emf.mu.Lock()
+	defer emf.mu.Unlock()
+	if _, err = emf.w.Write(append(line, '\n')); err != nil {
+		generalLog.warnf("unable to write the EMF record: %s", err)
+	}
+}
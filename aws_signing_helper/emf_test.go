@@ -0,0 +1,69 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEMFHooks(t *testing.T) {
+	var output bytes.Buffer
+	var refreshes int
+	hooks := EMFHooks(&output, EMFOptions{Dimensions: map[string]string{"RoleArn": "arn:aws:iam::000000000000:role/Role"}},
+		Hooks{OnRefresh: func(RefreshEvent) { refreshes++ }})
+	certificate := &x509.Certificate{NotAfter: time.Now().Add(10*24*time.Hour + time.Minute)}
+	hooks.OnRefresh(RefreshEvent{Expiration: time.Now().Add(time.Hour), Duration: 250 * time.Millisecond,
+		Certificate: certificate})
+	hooks.OnError(ErrorEvent{OperationCreateSession, errors.New("AccessDeniedException")})
+	hooks.OnError(ErrorEvent{OperationCredentialCache, errors.New("unable to cache credentials")})
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected records: %q", lines)
+	}
+	type record struct {
+		Aws struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []struct{ Name, Unit string }
+			}
+		} `json:"_aws"`
+		RoleArn                  string
+		RefreshSuccess           float64
+		RefreshFailure           float64
+		RefreshDuration          float64
+		CredentialsExpiryMargin  float64
+		CertificateDaysRemaining float64
+		Error                    string
+	}
+	var success, failure record
+	if err := json.Unmarshal([]byte(lines[0]), &success); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(lines[1]), &failure); err != nil {
+		t.Fatal(err)
+	}
+	if len(success.Aws.CloudWatchMetrics) != 1 || success.Aws.CloudWatchMetrics[0].Namespace != DefaultEMFNamespace ||
+		!reflect.DeepEqual(success.Aws.CloudWatchMetrics[0].Dimensions, [][]string{{"RoleArn"}}) ||
+		len(success.Aws.CloudWatchMetrics[0].Metrics) != 5 || success.Aws.Timestamp == 0 {
+		t.Errorf("unexpected metadata: %s", lines[0])
+	}
+	if success.RoleArn != "arn:aws:iam::000000000000:role/Role" || success.RefreshSuccess != 1 ||
+		success.RefreshFailure != 0 || success.RefreshDuration != 250 || int(success.CertificateDaysRemaining) != 10 ||
+		success.CredentialsExpiryMargin < 3500 || success.CredentialsExpiryMargin > 3600 {
+		t.Errorf("unexpected metrics: %s", lines[0])
+	}
+	if failure.RefreshSuccess != 0 || failure.RefreshFailure != 1 || failure.Error != "AccessDeniedException" {
+		t.Errorf("unexpected metrics: %s", lines[1])
+	}
+	if refreshes != 1 {
+		t.Error("the hooks weren't called:", refreshes)
+	}
+}
@@ -0,0 +1,321 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"hash"
+	"os"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/pkcs12"
+)
+
+var errIncorrectKeyPassword = errors.New("incorrect private key password")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidHMACWithSHA384 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 10}
+	oidHMACWithSHA512 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 11}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidDESEDE3CBC     = asn1.ObjectIdentifier{1, 2, 840, 113549, 3, 7}
+)
+
+// ASN.1 structures of encrypted PKCS#8 private keys (RFC 5208 and RFC 8018)
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// Returns whether the PEM block holds an encrypted private key, either as
+// encrypted PKCS#8 or in the legacy OpenSSL format (with a DEK-Info header)
+func isEncryptedPrivateKeyBlock(block *pem.Block) bool {
+	return block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block)
+}
+
+// Reads the encrypted private key block referenced by `privateKeyId`. If
+// the private key isn't encrypted, nil is returned.
+func readEncryptedPrivateKeyBlock(privateKeyId string) (*pem.Block, error) {
+	data, err := readPEMData(privateKeyId, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+	// Unencrypted private keys are read again by the caller
+	defer zeroizeBytes(data)
+
+	var block *pem.Block
+	for rest := data; len(rest) > 0; {
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if isEncryptedPrivateKeyBlock(block) {
+			return block, nil
+		}
+		zeroizeBytes(block.Bytes)
+	}
+	return nil, nil
+}
+
+// In FIPS mode, returns an error if the private key block is encrypted with
+// an algorithm that isn't FIPS-approved: the legacy OpenSSL format (whose key
+// is derived with MD5) or 3DES
+func checkPrivateKeyEncryptionFIPSApproved(block *pem.Block) error {
+	if !fipsMode {
+		return nil
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		return checkFIPSApproved("legacy OpenSSL private key encryption")
+	}
+	var (
+		keyInfo encryptedPrivateKeyInfo
+		params  pbes2Params
+	)
+	if _, err := asn1.Unmarshal(block.Bytes, &keyInfo); err != nil {
+		return nil
+	}
+	if _, err := asn1.Unmarshal(keyInfo.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil
+	}
+	if params.EncryptionScheme.Algorithm.Equal(oidDESEDE3CBC) {
+		return checkFIPSApproved("3DES private key encryption")
+	}
+	return nil
+}
+
+// Decrypts an encrypted private key block, and returns a block that holds
+// the decrypted private key. errIncorrectKeyPassword is returned if the
+// password is incorrect.
+func decryptPrivateKeyBlock(block *pem.Block, password string) (*pem.Block, error) {
+	if err := checkPrivateKeyEncryptionFIPSApproved(block); err != nil {
+		return nil, err
+	}
+	if block.Type != "ENCRYPTED PRIVATE KEY" {
+		// The legacy format is deprecated, since it's insecure, but keys are
+		// still commonly encrypted this way
+		der, err := x509.DecryptPEMBlock(block, []byte(password))
+		if err != nil {
+			return nil, errIncorrectKeyPassword
+		}
+		decrypted := &pem.Block{Type: block.Type, Bytes: der}
+		if _, err = parsePrivateKeyBlock(decrypted); err != nil {
+			return nil, errIncorrectKeyPassword
+		}
+		return decrypted, nil
+	}
+
+	var keyInfo encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &keyInfo); err != nil {
+		return nil, errors.New("unable to parse encrypted private key")
+	}
+	if !keyInfo.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		return nil, errors.New("unsupported private key encryption algorithm; only PBES2 is supported")
+	}
+	var params pbes2Params
+	if _, err := asn1.Unmarshal(keyInfo.EncryptionAlgorithm.Parameters.FullBytes, &params); err != nil {
+		return nil, errors.New("unable to parse private key encryption parameters")
+	}
+	if !params.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, errors.New("unsupported private key derivation function; only PBKDF2 is supported")
+	}
+	var kdfParams pbkdf2Params
+	if _, err := asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams); err != nil {
+		return nil, errors.New("unable to parse private key derivation parameters")
+	}
+
+	var prf func() hash.Hash
+	switch algorithm := kdfParams.PRF.Algorithm; {
+	case len(algorithm) == 0 || algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	case algorithm.Equal(oidHMACWithSHA384):
+		prf = sha512.New384
+	case algorithm.Equal(oidHMACWithSHA512):
+		prf = sha512.New
+	default:
+		return nil, errors.New("unsupported private key derivation PRF")
+	}
+
+	var (
+		keyLength int
+		newCipher func([]byte) (cipher.Block, error)
+	)
+	switch algorithm := params.EncryptionScheme.Algorithm; {
+	case algorithm.Equal(oidAES128CBC):
+		keyLength, newCipher = 16, aes.NewCipher
+	case algorithm.Equal(oidAES192CBC):
+		keyLength, newCipher = 24, aes.NewCipher
+	case algorithm.Equal(oidAES256CBC):
+		keyLength, newCipher = 32, aes.NewCipher
+	case algorithm.Equal(oidDESEDE3CBC):
+		keyLength, newCipher = 24, des.NewTripleDESCipher
+	default:
+		return nil, errors.New("unsupported private key encryption scheme")
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		return nil, errors.New("unable to parse private key encryption IV")
+	}
+
+	key := pbkdf2.Key([]byte(password), kdfParams.Salt, kdfParams.IterationCount, keyLength, prf)
+	defer zeroizeBytes(key)
+	blockCipher, err := newCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	blockSize := blockCipher.BlockSize()
+	if len(iv) != blockSize || len(keyInfo.EncryptedData) == 0 || len(keyInfo.EncryptedData)%blockSize != 0 {
+		return nil, errors.New("invalid encrypted private key")
+	}
+	der := make([]byte, len(keyInfo.EncryptedData))
+	cipher.NewCBCDecrypter(blockCipher, iv).CryptBlocks(der, keyInfo.EncryptedData)
+
+	// Remove the PKCS#7 padding. If it's invalid, the password is incorrect.
+	padding := int(der[len(der)-1])
+	if padding == 0 || padding > blockSize || !bytes.Equal(der[len(der)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		zeroizeBytes(der)
+		return nil, errIncorrectKeyPassword
+	}
+	decrypted := &pem.Block{Type: "PRIVATE KEY", Bytes: der[:len(der)-padding]}
+	privateKey, err := parsePrivateKeyBlock(decrypted)
+	if err != nil {
+		zeroizeBytes(der)
+		return nil, errIncorrectKeyPassword
+	}
+	// Only the block is needed, to check the password
+	zeroizePrivateKey(privateKey)
+	return decrypted, nil
+}
+
+// Parses an unencrypted private key block
+func parsePrivateKeyBlock(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, errors.New("could not parse private key")
+		}
+		switch privateKey.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			return privateKey, nil
+		}
+		return nil, errors.New("could not parse PKCS#8 private key")
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+	return nil, errors.New("unable to parse private key")
+}
+
+// Loads the private key referenced by `privateKeyId`, decrypting it with the
+// password if it's encrypted
+func readPrivateKeyDataWithPassword(privateKeyId string, password string) (crypto.PrivateKey, error) {
+	block, err := readEncryptedPrivateKeyBlock(privateKeyId)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return ReadPrivateKeyData(privateKeyId)
+	}
+	if password == "" {
+		return nil, errors.New("private key is encrypted, but no password was provided")
+	}
+
+	decrypted, err := decryptPrivateKeyBlock(block, password)
+	if err != nil {
+		return nil, err
+	}
+	defer zeroizeBytes(decrypted.Bytes)
+	return parsePrivateKeyBlock(decrypted)
+}
+
+// Determines the password for the private key referenced by `privateKeyId`.
+// If the private key isn't encrypted, an empty password is returned. If it
+// is, and no password was provided, the user is prompted for one on the
+// terminal (never on stdout, since that's where credentials are written).
+func resolvePrivateKeyPassword(privateKeyId string, password string) (string, error) {
+	block, err := readEncryptedPrivateKeyBlock(privateKeyId)
+	if err != nil || block == nil {
+		return "", err
+	}
+	// The password would otherwise be prompted for, and then rejected
+	if err = checkPrivateKeyEncryptionFIPSApproved(block); err != nil {
+		return "", err
+	}
+
+	password, _, err = PasswordPrompt(PasswordPromptProps{
+		InitialPassword: password,
+		CheckPassword: func(password string) (interface{}, error) {
+			return decryptPrivateKeyBlock(block, password)
+		},
+		IncorrectPasswordMsg:               errIncorrectKeyPassword.Error(),
+		Prompt:                             "Please enter the password for the private key:",
+		Reprompt:                           "Incorrect password. Please re-enter the password for the private key:",
+		ParseErrMsg:                        "private key is encrypted, and its password couldn't be read from the terminal; pass it through --key-password",
+		CheckPasswordAuthorizationErrorMsg: errIncorrectKeyPassword.Error(),
+	})
+	return password, err
+}
+
+// Determines the password for the PKCS#12 file referenced by
+// `certificateId`. If the file isn't protected by a password, an empty
+// password is returned. If it is, and no password was provided, the user is
+// prompted for one on the terminal.
+func resolvePKCS12Password(certificateId string, password string) (string, error) {
+	if err := checkFIPSApproved("PKCS#12 encryption"); err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(certificateId)
+	if err != nil {
+		return "", err
+	}
+	if password == "" {
+		if _, err = pkcs12.ToPEM(data, ""); err != pkcs12.ErrIncorrectPassword {
+			return "", err
+		}
+	}
+
+	password, _, err = PasswordPrompt(PasswordPromptProps{
+		InitialPassword: password,
+		CheckPassword: func(password string) (interface{}, error) {
+			return pkcs12.ToPEM(data, password)
+		},
+		IncorrectPasswordMsg:               pkcs12.ErrIncorrectPassword.Error(),
+		Prompt:                             "Please enter the password for the PKCS#12 file:",
+		Reprompt:                           "Incorrect password. Please re-enter the password for the PKCS#12 file:",
+		ParseErrMsg:                        "PKCS#12 file is protected by a password, which couldn't be read from the terminal; pass it through --key-password",
+		CheckPasswordAuthorizationErrorMsg: pkcs12.ErrIncorrectPassword.Error(),
+	})
+	return password, err
+}
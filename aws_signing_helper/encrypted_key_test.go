@@ -0,0 +1,43 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/rand"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedPrivateKeys(t *testing.T) {
+	fixtures := []struct {
+		cert string
+		key  string
+	}{
+		{"../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key-encrypted.pem"},
+		{"../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key-pkcs8-encrypted.pem"},
+		{"../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-2048-key-encrypted.pem"},
+		{"../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-2048-key-pkcs8-encrypted.pem"},
+		{"../tst/certs/ec-prime256v1-sha256-pass.p12", ""},
+		{"../tst/certs/rsa-2048-sha256-pass.p12", ""},
+	}
+
+	for _, fixture := range fixtures {
+		opts := CredentialsOpts{CertificateId: fixture.cert, PrivateKeyId: fixture.key, KeyPassword: "test"}
+		signer, _, err := GetSigner(&opts)
+		if err != nil {
+			t.Log("failed to get signer for", fixture, err)
+			t.Fail()
+			continue
+		}
+		if _, err = signer.Sign(rand.Reader, []byte("test"), crypto.SHA256); err != nil {
+			t.Log("failed to sign with", fixture, err)
+			t.Fail()
+		}
+		signer.Close()
+
+		opts.KeyPassword = "incorrect"
+		if _, _, err = GetSigner(&opts); err == nil || !strings.Contains(err.Error(), "incorrect") {
+			t.Log("expected incorrect password to be rejected for", fixture, err)
+			t.Fail()
+		}
+	}
+}
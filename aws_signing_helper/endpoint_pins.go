@@ -0,0 +1,77 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Prefix of pins, as in HTTP Public Key Pinning and curl's --pinnedpubkey
+const endpointPinPrefix = "sha256/"
+
+// Parses a pin of the Roles Anywhere endpoint: the base64-encoded SHA-256
+// hash of the DER-encoded SubjectPublicKeyInfo of one of the certificates of
+// its chain, optionally prefixed by "sha256/" (or "sha256//")
+func ParseEndpointPin(pin string) ([]byte, error) {
+	encoded := strings.TrimPrefix(strings.TrimPrefix(pin, endpointPinPrefix), "/")
+	hash, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(hash) != sha256.Size {
+		return nil, fmt.Errorf("invalid endpoint pin %q (it should be the base64-encoded SHA-256 hash of a "+
+			"SubjectPublicKeyInfo)", pin)
+	}
+	return hash, nil
+}
+
+// Returns the SHA-256 hash of the SubjectPublicKeyInfo of the certificate, as
+// it's pinned
+func endpointPin(certificate *x509.Certificate) []byte {
+	hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	return hash[:]
+}
+
+// Returns a function for tls.Config.VerifyConnection that fails the handshake
+// unless a certificate of the verified chain of the server matches one of the
+// pins. Other certificates that the server sent aren't matched, since anyone
+// who intercepts the connection can send them; only if the chain isn't
+// verified (with --no-verify-ssl) are the certificates that it sent matched.
+// Several pins can be passed, so that the current and the next key (or keys
+// of several CAs) can be pinned while they're rotated.
+func verifyEndpointPins(pins []string) (func(tls.ConnectionState) error, error) {
+	hashes := make([][]byte, 0, len(pins))
+	for _, pin := range pins {
+		hash, err := ParseEndpointPin(pin)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return func(state tls.ConnectionState) error {
+		var certificates []*x509.Certificate
+		for _, chain := range state.VerifiedChains {
+			certificates = append(certificates, chain...)
+		}
+		if len(state.VerifiedChains) == 0 {
+			certificates = state.PeerCertificates
+		}
+		for _, certificate := range certificates {
+			pin := endpointPin(certificate)
+			for _, hash := range hashes {
+				if bytes.Equal(pin, hash) {
+					return nil
+				}
+			}
+		}
+		var presented []string
+		for _, certificate := range state.PeerCertificates {
+			presented = append(presented, fmt.Sprintf("%s%s (%q)", endpointPinPrefix,
+				base64.StdEncoding.EncodeToString(endpointPin(certificate)), certificate.Subject.String()))
+		}
+		return fmt.Errorf("none of the certificates of %s matches the endpoint pins, which can mean that the connection "+
+			"is intercepted (it presented %s)", state.ServerName, strings.Join(presented, ", "))
+	}, nil
+}
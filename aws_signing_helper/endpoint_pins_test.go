@@ -0,0 +1,117 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestEndpointPins(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	pin := "sha256/" + base64.StdEncoding.EncodeToString(endpointPin(server.Certificate()))
+	otherPin := base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for _, tc := range []struct {
+		name string
+		pins []string
+		ok   bool
+	}{
+		{"pinned", []string{pin}, true},
+		{"rotated", []string{otherPin, pin}, true},
+		{"not pinned", []string{otherPin}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tlsConfig(&CredentialsOpts{NoVerifySSL: true})
+			var err error
+			if config.VerifyConnection, err = verifyEndpointPins(tc.pins); err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+			response, err := client.Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err == nil) != tc.ok {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"sha256/notbase64!", base64.StdEncoding.EncodeToString([]byte("short"))} {
+		if _, err := ParseEndpointPin(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+// Certificates that the server sends beyond its verified chain (as a proxy
+// that intercepts the connection could) don't match pins
+func TestEndpointPinsVerifiedChain(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leaf, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverCertificate, _ := x509.ParseCertificate(leaf)
+	_, extra, err := ReadCertificateData("../credential-process-data/client-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leaf, extra.Raw}, PrivateKey: key}}}
+	server.StartTLS()
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(serverCertificate)
+
+	for _, tc := range []struct {
+		name        string
+		pinned      *x509.Certificate
+		noVerifySSL bool
+		ok          bool
+	}{
+		{"verified chain", serverCertificate, false, true},
+		{"extra certificate", extra, false, false},
+		{"extra certificate without verification", extra, true, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tlsConfig(&CredentialsOpts{NoVerifySSL: tc.noVerifySSL})
+			config.RootCAs = roots
+			if config.VerifyConnection, err = verifyEndpointPins([]string{base64.StdEncoding.EncodeToString(endpointPin(tc.pinned))}); err != nil {
+				t.Fatal(err)
+			}
+			client := &http.Client{Transport: &http.Transport{TLSClientConfig: config}}
+			response, err := client.Get(server.URL)
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err == nil) != tc.ok {
+				t.Errorf("unexpected result: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Errors that are wrapped by the errors that the package returns, so that
+// callers can check for them with errors.Is
+var (
+	// The certificate (or one of its issuers) has expired or isn't valid yet,
+	// either according to Roles Anywhere or to the system clock
+	ErrCertificateExpired = errors.New("certificate expired")
+	// The type of the private key (or the algorithm of the TPM key) isn't
+	// supported for signing
+	ErrUnsupportedAlgorithm = errors.New("unsupported algorithm")
+	// Roles Anywhere throttled the request; it can be retried with backoff
+	ErrThrottled = errors.New("request throttled")
+	// The request couldn't be sent to the Roles Anywhere endpoint (for
+	// example, because of DNS, connection, or TLS errors)
+	ErrEndpointUnreachable = errors.New("endpoint unreachable")
+	// The private key or certificate is held by a backend (such as PKCS#11,
+	// a TPM, or a platform certificate store) that wasn't compiled into the
+	// binary
+	ErrBackendUnavailable = errors.New("signing backend unavailable")
+	// The private key isn't the key of the certificate (its public key
+	// doesn't match the SubjectPublicKeyInfo of the certificate), so Roles
+	// Anywhere would reject the signature
+	ErrKeyCertificateMismatch = errors.New("private key doesn't match the certificate")
+	// The key usage or extended key usage extension of the certificate
+	// doesn't allow it to be used for client authentication
+	ErrCertificateKeyUsage = errors.New("certificate key usage doesn't allow client authentication")
+	// The private key is too weak (an RSA key under 2048 bits, or a key on a
+	// deprecated elliptic curve), and weak keys weren't allowed
+	ErrWeakKey = errors.New("weak key")
+	// The OCSP responder or the CRL of the certificate reported that it has
+	// been revoked
+	ErrCertificateRevoked = errors.New("certificate revoked")
+	// The private key file can be accessed by users other than its owner, and
+	// strict permissions were required
+	ErrInsecurePermissions = errors.New("insecure private key file permissions")
+	// The certificate chain doesn't lead to the trust anchor's CA
+	// certificate, so Roles Anywhere wouldn't trust it
+	ErrUntrustedCertificate = errors.New("untrusted certificate")
+	// The system clock reads a time that's too early to be right (such as
+	// before the binary was built), so it has to be synchronized
+	ErrClockNotSynchronized = errors.New("system clock isn't synchronized")
+)
+
+// Checks that the public key is the public key of the certificate
+func checkKeyMatchesCertificate(publicKey crypto.PublicKey, certificate *x509.Certificate) error {
+	key, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !key.Equal(certificate.PublicKey) {
+		return fmt.Errorf("%w (certificate with serial number %s, issued to %s)", ErrKeyCertificateMismatch,
+			certificate.SerialNumber, certificate.Subject)
+	}
+	return nil
+}
+
+// Error that wraps one of the errors above, without changing the message of
+// the underlying error
+type sentinelError struct {
+	sentinel error
+	err      error
+}
+
+func (e *sentinelError) Error() string   { return e.err.Error() }
+func (e *sentinelError) Unwrap() []error { return []error{e.sentinel, e.err} }
+
+// Wraps an error of the CreateSession call with the error above that
+// describes it, if there is one
+func wrapCreateSessionError(err error) error {
+	var (
+		apiErr      smithy.APIError
+		responseErr *smithyhttp.ResponseError
+		sendErr     *smithyhttp.RequestSendError
+		opErr       *net.OpError
+		dnsErr      *net.DNSError
+	)
+
+	var sentinel error
+	switch {
+	case err == nil, errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return err
+	case errors.As(err, &apiErr):
+		switch apiErr.ErrorCode() {
+		case "AccessDeniedException":
+			if strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "expired") {
+				sentinel = ErrCertificateExpired
+			}
+		case "ThrottlingException", "TooManyRequestsException":
+			sentinel = ErrThrottled
+		}
+	// Errors that occurred while sending the request are wrapped in a
+	// ResponseError as well (without a status code), so they're checked first
+	case errors.As(err, &sendErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		sentinel = ErrEndpointUnreachable
+	case errors.As(err, &responseErr) && responseErr.HTTPStatusCode() == http.StatusTooManyRequests:
+		sentinel = ErrThrottled
+	}
+	if sentinel == nil {
+		return err
+	}
+	return &sentinelError{sentinel, err}
+}
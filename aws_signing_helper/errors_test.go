@@ -0,0 +1,71 @@
+package aws_signing_helper
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCreateSessionErrors(t *testing.T) {
+	// Throttled requests would otherwise be retried with backoff
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	errorServer := func(statusCode int, errorType string, message string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Amzn-ErrorType", errorType)
+			w.WriteHeader(statusCode)
+			w.Write([]byte(fmt.Sprintf(`{"message":%q}`, message)))
+		}))
+	}
+	unreachableServer := httptest.NewServer(http.NotFoundHandler())
+	unreachableServer.Close()
+
+	testTable := []struct {
+		server   *httptest.Server
+		sentinel error
+	}{
+		{errorServer(http.StatusForbidden, "AccessDeniedException", "Certificate expired"), ErrCertificateExpired},
+		{errorServer(http.StatusTooManyRequests, "ThrottlingException", "Rate exceeded"), ErrThrottled},
+		{unreachableServer, ErrEndpointUnreachable},
+		{errorServer(http.StatusForbidden, "AccessDeniedException", "Untrusted signing certificate"), nil},
+	}
+	for _, testCase := range testTable {
+		defer testCase.server.Close()
+		opts := CredentialsOpts{
+			CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+			PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+			TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+			ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+			RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+			SessionDuration:   900,
+			Endpoint:          testCase.server.URL,
+		}
+		signer, signatureAlgorithm, err := GetSigner(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = GenerateCredentials(&opts, signer, signatureAlgorithm)
+		signer.Close()
+		if err == nil {
+			t.Log("expected CreateSession to fail")
+			t.Fail()
+			continue
+		}
+		for _, sentinel := range []error{ErrCertificateExpired, ErrThrottled, ErrEndpointUnreachable} {
+			if errors.Is(err, sentinel) != (sentinel == testCase.sentinel) {
+				t.Logf("unexpected result of errors.Is(%q, %q)", err, sentinel)
+				t.Fail()
+			}
+		}
+	}
+
+	_, privateKey, _ := ed25519.GenerateKey(rand.Reader)
+	_, certificate, _ := ReadCertificateData("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if _, _, err := NewCryptoSigner(privateKey, certificate, nil); !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Log("unexpected error for an Ed25519 key:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,82 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"time"
+)
+
+// Default source of the events that the commands write to the Windows Event
+// Log
+const DefaultEventLogSource = "aws_signing_helper"
+
+// IDs of the events that are written to the Windows Event Log, which don't
+// change across releases, so that monitoring tools can alert on them
+const (
+	EventIdServiceStarted      uint32 = 1
+	EventIdServiceStopped      uint32 = 2
+	EventIdRefreshSucceeded    uint32 = 10
+	EventIdRefreshFailed       uint32 = 11
+	EventIdCertificateExpiring uint32 = 20
+)
+
+// Writes events to the Windows Event Log (see OpenEventLog)
+type EventLog struct {
+	writer eventLogWriter
+}
+
+// Event log of the platform (an eventlog.Log on Windows)
+type eventLogWriter interface {
+	Info(eid uint32, msg string) error
+	Warning(eid uint32, msg string) error
+	Error(eid uint32, msg string) error
+	Close() error
+}
+
+// Records that the command (such as serve) started
+func (eventLog *EventLog) ServiceStarted(command string) {
+	eventLog.write(eventLog.writer.Info, EventIdServiceStarted, fmt.Sprintf("the %s command started", command))
+}
+
+// Records that the command stopped
+func (eventLog *EventLog) ServiceStopped(command string) {
+	eventLog.write(eventLog.writer.Info, EventIdServiceStopped, fmt.Sprintf("the %s command stopped", command))
+}
+
+func (eventLog *EventLog) Close() error {
+	return eventLog.writer.Close()
+}
+
+// Writes the event. Failures are logged, since the events that are recorded
+// already happened.
+func (eventLog *EventLog) write(write func(uint32, string) error, eid uint32, message string) {
+	if err := write(eid, Redact(message)); err != nil {
+		generalLog.warnf("unable to write to the event log: %s", err)
+	}
+}
+
+// Returns hooks that write an event to the event log for each refresh, each
+// failed refresh, and each warning about a certificate that expires soon,
+// and then call the hooks (whose callbacks can be nil)
+func EventLogHooks(eventLog *EventLog, hooks Hooks) Hooks {
+	return Hooks{
+		OnRefresh: func(event RefreshEvent) {
+			eventLog.write(eventLog.writer.Info, EventIdRefreshSucceeded, fmt.Sprintf("obtained credentials for %s "+
+				"that expire at %s", event.RoleArn, event.Expiration.UTC().Format(time.RFC3339)))
+			hooks.refreshed(event)
+		},
+		OnSign:     hooks.OnSign,
+		OnCacheHit: hooks.OnCacheHit,
+		OnError: func(event ErrorEvent) {
+			if event.Operation == OperationCreateSession {
+				eventLog.write(eventLog.writer.Error, EventIdRefreshFailed, fmt.Sprintf("unable to obtain credentials: %s",
+					event.Err))
+			}
+			hooks.failed(event)
+		},
+		OnCertificateExpiring: func(event CertificateExpiryEvent) {
+			eventLog.write(eventLog.writer.Warning, EventIdCertificateExpiring, fmt.Sprintf("the certificate %q expires "+
+				"at %s", event.Certificate.Subject.String(), event.NotAfter.UTC().Format(time.RFC3339)))
+			hooks.certificateExpiring(event)
+		},
+	}
+}
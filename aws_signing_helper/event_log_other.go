@@ -0,0 +1,10 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import "errors"
+
+// Opens the Windows Event Log, which is only available on Windows
+func OpenEventLog(source string) (*EventLog, error) {
+	return nil, errors.New("the event log is only available on Windows")
+}
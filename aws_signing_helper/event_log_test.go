@@ -0,0 +1,70 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// Records the events that are written to it
+type recordingEventLog struct {
+	events []string
+}
+
+func (l *recordingEventLog) Info(eid uint32, msg string) error {
+	return l.record("info", eid, msg)
+}
+
+func (l *recordingEventLog) Warning(eid uint32, msg string) error {
+	return l.record("warning", eid, msg)
+}
+
+func (l *recordingEventLog) Error(eid uint32, msg string) error {
+	return l.record("error", eid, msg)
+}
+
+func (l *recordingEventLog) Close() error {
+	return nil
+}
+
+func (l *recordingEventLog) record(level string, eid uint32, msg string) error {
+	l.events = append(l.events, fmt.Sprintf("%s %d %s", level, eid, msg))
+	return nil
+}
+
+func TestEventLogHooks(t *testing.T) {
+	writer := &recordingEventLog{}
+	eventLog := &EventLog{writer}
+	var failures int
+	hooks := EventLogHooks(eventLog, Hooks{OnError: func(ErrorEvent) { failures++ }})
+	expiration := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	eventLog.ServiceStarted("serve")
+	hooks.OnRefresh(RefreshEvent{RoleArn: "arn:aws:iam::000000000000:role/Role", Expiration: expiration})
+	hooks.OnError(ErrorEvent{OperationCreateSession, errors.New("AccessDeniedException")})
+	hooks.OnError(ErrorEvent{OperationCredentialCache, errors.New("unable to cache credentials")})
+	hooks.OnCertificateExpiring(CertificateExpiryEvent{&x509.Certificate{Subject: pkix.Name{CommonName: "client"}},
+		expiration, time.Hour})
+	eventLog.ServiceStopped("serve")
+
+	expected := []string{
+		"info 1 the serve command started",
+		"info 10 obtained credentials for arn:aws:iam::000000000000:role/Role that expire at 2030-01-01T00:00:00Z",
+		"error 11 unable to obtain credentials: AccessDeniedException",
+		"warning 20 the certificate \"CN=client\" expires at 2030-01-01T00:00:00Z",
+		"info 2 the serve command stopped",
+	}
+	if !reflect.DeepEqual(writer.events, expected) {
+		t.Errorf("unexpected events: %q", writer.events)
+	}
+	if failures != 2 {
+		t.Error("the hooks weren't called:", failures)
+	}
+	if _, err := OpenEventLog(DefaultEventLogSource); runtime.GOOS != "windows" && err == nil {
+		t.Error("the event log was opened on", runtime.GOOS)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build windows
+
+package aws_signing_helper
+
+import "golang.org/x/sys/windows/svc/eventlog"
+
+// Opens the Windows Event Log, with the source, which is registered (with
+// EventCreate.exe as its message file, so that the messages of the events
+// are displayed) if it isn't yet and the process is allowed to
+func OpenEventLog(source string) (*EventLog, error) {
+	// Fails if the source is already registered (or if the process isn't
+	// allowed to register it)
+	if err := eventlog.InstallAsEventCreate(source, eventlog.Error|eventlog.Warning|eventlog.Info); err != nil {
+		generalLog.debugf("unable to register the event log source %s: %s", source, err)
+	}
+	writer, err := eventlog.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	return &EventLog{writer}, nil
+}
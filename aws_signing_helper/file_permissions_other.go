@@ -0,0 +1,42 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"fmt"
+	"os"
+)
+
+// Restricts access to the file (or directory) to its owner. On Unix-like
+// systems, the file mode is sufficient for this.
+func setOwnerOnlyPermissions(path string) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return os.Chmod(path, 0700)
+	}
+	return os.Chmod(path, 0600)
+}
+
+// Flushes the directory entry, so that a preceding rename is durable
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Checks that only the owner of the file can access it, as OpenSSH does for
+// private keys: the file mustn't be readable or writable by its group or by
+// other users
+func checkOwnerOnlyPermissions(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if mode := info.Mode().Perm(); mode&0077 != 0 {
+		return fmt.Errorf("%w: permissions %04o for %s are too open; it should only be accessible by its owner "+
+			"(for example, chmod 600 %s)", ErrInsecurePermissions, mode, path, path)
+	}
+	return nil
+}
@@ -0,0 +1,104 @@
+//go:build windows
+
+package aws_signing_helper
+
+import (
+	"fmt"
+	"os"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Restricts access to the file (or directory) to its owner. On Windows, the
+// file mode bits don't control access, so the file is given a protected DACL
+// (which doesn't inherit entries from its parent directory) that only grants
+// access to the current user. The entry of a directory is inherited by the
+// files that are created in it.
+func setOwnerOnlyPermissions(path string) error {
+	tokenUser, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return err
+	}
+	inheritance := uint32(windows.NO_INHERITANCE)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		inheritance = windows.SUB_CONTAINERS_AND_OBJECTS_INHERIT
+	}
+
+	acl, err := windows.ACLFromEntries([]windows.EXPLICIT_ACCESS{
+		{
+			AccessPermissions: windows.GENERIC_ALL,
+			AccessMode:        windows.GRANT_ACCESS,
+			Inheritance:       inheritance,
+			Trustee: windows.TRUSTEE{
+				TrusteeForm:  windows.TRUSTEE_IS_SID,
+				TrusteeType:  windows.TRUSTEE_IS_USER,
+				TrusteeValue: windows.TrusteeValueFromSID(tokenUser.User.Sid),
+			},
+		},
+	}, nil)
+	if err != nil {
+		return err
+	}
+
+	return windows.SetNamedSecurityInfo(
+		path,
+		windows.SE_FILE_OBJECT,
+		windows.DACL_SECURITY_INFORMATION|windows.PROTECTED_DACL_SECURITY_INFORMATION,
+		nil,
+		nil,
+		acl,
+		nil,
+	)
+}
+
+// Directories can't be opened for syncing on Windows; MoveFileEx (which
+// os.Rename uses) is relied upon instead.
+func syncDir(dir string) error {
+	return nil
+}
+
+// Checks that only the owner of the file (along with SYSTEM and the
+// Administrators group, which OpenSSH for Windows allows as well) can read
+// it: no entry of its DACL may grant read access to anyone else
+func checkOwnerOnlyPermissions(path string) error {
+	sd, err := windows.GetNamedSecurityInfo(path, windows.SE_FILE_OBJECT,
+		windows.OWNER_SECURITY_INFORMATION|windows.DACL_SECURITY_INFORMATION)
+	if err != nil {
+		return err
+	}
+	owner, _, err := sd.Owner()
+	if err != nil {
+		return err
+	}
+	dacl, _, err := sd.DACL()
+	if err != nil {
+		return err
+	}
+	if dacl == nil {
+		return fmt.Errorf("%w: %s has no DACL, so everyone can access it", ErrInsecurePermissions, path)
+	}
+
+	const readAccess = windows.GENERIC_READ | windows.GENERIC_ALL | windows.FILE_READ_DATA
+	for i := uint32(0); i < uint32(dacl.AceCount); i++ {
+		var ace *windows.ACCESS_ALLOWED_ACE
+		if err = windows.GetAce(dacl, i, &ace); err != nil {
+			return err
+		}
+		if ace.Header.AceType != windows.ACCESS_ALLOWED_ACE_TYPE || ace.Mask&readAccess == 0 {
+			continue
+		}
+		sid := (*windows.SID)(unsafe.Pointer(&ace.SidStart))
+		if sid.Equals(owner) || sid.IsWellKnown(windows.WinLocalSystemSid) ||
+			sid.IsWellKnown(windows.WinBuiltinAdministratorsSid) {
+			continue
+		}
+		name := sid.String()
+		if account, domain, _, err := sid.LookupAccount(""); err == nil {
+			name = domain + "\\" + account
+		}
+		return fmt.Errorf("%w: %s can be read by %s; it should only be accessible by its owner "+
+			"(for example, icacls %s /inheritance:r /grant:r %%USERNAME%%:F)", ErrInsecurePermissions, path, name, path)
+	}
+	return nil
+}
@@ -4,147 +4,213 @@ import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/rsa"
-	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
 	"errors"
+	"fmt"
 	"io"
-	"log"
-	"os"
 )
 
+// Name of the backend, as returned by Backends
+const fileBackend = "file"
+
+func init() {
+	registerBackend(fileBackend)
+}
+
 type FileSystemSigner struct {
 	bundlePath     string
 	certPath       string
 	isPkcs12       bool
 	privateKeyPath string
+	// Password for the private key (or PKCS#12 file), if it's encrypted
+	password string
+	// Parsed certificates and public key, until their files change
+	certificates parsedFiles[parsedCertificates]
+	publicKey    parsedFiles[crypto.PublicKey]
 }
 
 func (fileSystemSigner *FileSystemSigner) Public() crypto.PublicKey {
-	privateKey, _, _ := fileSystemSigner.readCertFiles()
-	{
-		privateKey, ok := privateKey.(*ecdsa.PrivateKey)
-		if ok {
-			return &privateKey.PublicKey
-		}
-	}
-	{
-		privateKey, ok := privateKey.(*rsa.PrivateKey)
-		if ok {
-			return &privateKey.PublicKey
-		}
+	publicKey, err := fileSystemSigner.readPublicKey()
+	if err != nil {
+		signerLog.errorf("%s", err)
+		return nil
 	}
-	return nil
+	return publicKey
+}
+
+func (fileSystemSigner *FileSystemSigner) backendName() string {
+	return fileBackend
 }
 
 func (fileSystemSigner *FileSystemSigner) Close() {}
 
 func (fileSystemSigner *FileSystemSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
-	privateKey, _, _ := fileSystemSigner.readCertFiles()
-	var hash []byte
-	switch opts.HashFunc() {
-	case crypto.SHA256:
-		sum := sha256.Sum256(digest)
-		hash = sum[:]
-	case crypto.SHA384:
-		sum := sha512.Sum384(digest)
-		hash = sum[:]
-	case crypto.SHA512:
-		sum := sha512.Sum512(digest)
-		hash = sum[:]
-	default:
-		return nil, ErrUnsupportedHash
+	privateKey, err := fileSystemSigner.readPrivateKey()
+	if err != nil {
+		return nil, err
 	}
-
-	ecdsaPrivateKey, ok := privateKey.(*ecdsa.PrivateKey)
-	if ok {
-		sig, err := ecdsa.SignASN1(rand, ecdsaPrivateKey, hash[:])
-		if err == nil {
-			return sig, nil
-		}
+	// The key is read again for each signature, so it doesn't have to stay in
+	// memory
+	defer zeroizePrivateKey(privateKey)
+	signer, _, err := privateKeySigner(privateKey)
+	if err != nil {
+		return nil, err
 	}
-
-	rsaPrivateKey, ok := privateKey.(*rsa.PrivateKey)
-	if ok {
-		sig, err := rsa.SignPKCS1v15(rand, rsaPrivateKey, opts.HashFunc(), hash[:])
-		if err == nil {
-			return sig, nil
-		}
+	certificate, _, err := fileSystemSigner.readCertificates()
+	if err != nil {
+		return nil, err
 	}
-
-	log.Println("unsupported algorithm")
-	return nil, errors.New("unsupported algorithm")
+	// The files may have been rotated separately
+	if err = checkKeyMatchesCertificate(signer.Public(), certificate); err != nil {
+		return nil, err
+	}
+	hash, err := signatureDigest(digest, opts)
+	if err != nil {
+		return nil, err
+	}
+	// RSA keys sign with PKCS#1 v1.5 when they're passed a hash function,
+	// and ECDSA keys return ASN.1 signatures, as SigV4-X509 expects
+	return signer.Sign(rand, hash, opts.HashFunc())
 }
 
 func (fileSystemSigner *FileSystemSigner) Certificate() (*x509.Certificate, error) {
-	_, cert, _ := fileSystemSigner.readCertFiles()
-	return cert, nil
+	cert, _, err := fileSystemSigner.readCertificates()
+	return cert, err
 }
 
 func (fileSystemSigner *FileSystemSigner) CertificateChain() ([]*x509.Certificate, error) {
-	_, _, certChain := fileSystemSigner.readCertFiles()
-	return certChain, nil
+	_, certChain, err := fileSystemSigner.readCertificates()
+	return certChain, err
 }
 
 // GetFileSystemSigner returns a FileSystemSigner, that signs a payload using the private key passed in
 func GetFileSystemSigner(privateKeyPath string, certPath string, bundlePath string, isPkcs12 bool) (signer Signer, signingAlgorithm string, err error) {
-	fsSigner := &FileSystemSigner{bundlePath: bundlePath, certPath: certPath, isPkcs12: isPkcs12, privateKeyPath: privateKeyPath}
-	privateKey, _, _ := fsSigner.readCertFiles()
-	// Find the signing algorithm
-	_, isRsaKey := privateKey.(*rsa.PrivateKey)
-	if isRsaKey {
-		signingAlgorithm = aws4_x509_rsa_sha256
+	return getFileSystemSigner(privateKeyPath, certPath, bundlePath, isPkcs12, "")
+}
+
+// Returns a FileSystemSigner for a private key (or PKCS#12 file) that's
+// encrypted with the specified password
+func getFileSystemSigner(privateKeyPath string, certPath string, bundlePath string, isPkcs12 bool, password string) (signer Signer, signingAlgorithm string, err error) {
+	fsSigner := &FileSystemSigner{bundlePath: bundlePath, certPath: certPath, isPkcs12: isPkcs12, privateKeyPath: privateKeyPath, password: password}
+	var privateKey crypto.PrivateKey
+	if isPkcs12 {
+		privateKey, _, _, err = fsSigner.readCertFiles()
+	} else {
+		// The certificates (which may be a long chain) are parsed while the
+		// private key is (which may have to be decrypted), and kept for later
+		certificatesErr := make(chan error, 1)
+		go func() {
+			_, _, err := fsSigner.readCertificates()
+			certificatesErr <- err
+		}()
+		privateKey, err = fsSigner.readPrivateKey()
+		if certErr := <-certificatesErr; err == nil {
+			err = certErr
+		}
 	}
-	_, isEcKey := privateKey.(*ecdsa.PrivateKey)
-	if isEcKey {
-		signingAlgorithm = aws4_x509_ecdsa_sha256
+	if err != nil {
+		zeroizePrivateKey(privateKey)
+		return nil, "", err
 	}
-	if signingAlgorithm == "" {
-		log.Println("unsupported algorithm")
-		return nil, "", errors.New("unsupported algorithm")
+	defer zeroizePrivateKey(privateKey)
+	_, signingAlgorithm, err = privateKeySigner(privateKey)
+	if err != nil {
+		return nil, "", err
 	}
 
 	return fsSigner, signingAlgorithm, nil
 }
 
-func (fileSystemSigner *FileSystemSigner) readCertFiles() (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate) {
+// Returns the crypto.Signer for a private key, along with its signature
+// algorithm. RSA and ECDSA keys are accepted both as pointers and as values
+// (as some libraries return them), as is any other crypto.Signer (such as a
+// key that's held by a KMS or HSM abstraction) whose public key is an RSA or
+// ECDSA key.
+func privateKeySigner(privateKey crypto.PrivateKey) (crypto.Signer, string, error) {
+	switch key := privateKey.(type) {
+	case rsa.PrivateKey:
+		privateKey = &key
+	case ecdsa.PrivateKey:
+		privateKey = &key
+	}
+	signer, ok := privateKey.(crypto.Signer)
+	if !ok {
+		return nil, "", fmt.Errorf("%w: private key of type %T can't sign", ErrUnsupportedAlgorithm, privateKey)
+	}
+	switch publicKey := signer.Public().(type) {
+	case *rsa.PublicKey:
+		return signer, aws4_x509_rsa_sha256, nil
+	case *ecdsa.PublicKey:
+		return signer, aws4_x509_ecdsa_sha256, nil
+	default:
+		return nil, "", fmt.Errorf("%w: public key of type %T", ErrUnsupportedAlgorithm, publicKey)
+	}
+}
+
+// Reads the private key, certificate, and certificate chain of the signer.
+// The private key is read each time that it's needed, so that it doesn't
+// have to stay in memory, and so that rotated files are picked up without
+// restarting the credential helper (the certificates are cached until their
+// files change, by readCertificates).
+func (fileSystemSigner *FileSystemSigner) readCertFiles() (crypto.PrivateKey, *x509.Certificate, []*x509.Certificate, error) {
 	if fileSystemSigner.isPkcs12 {
-		chain, privateKey, err := ReadPKCS12Data(fileSystemSigner.certPath)
+		chain, privateKey, err := readPKCS12DataWithPassword(fileSystemSigner.certPath, fileSystemSigner.password)
 		if err != nil {
-			log.Printf("Failed to read PKCS12 certificate: %s\n", err)
-			os.Exit(1)
+			return nil, nil, nil, fmt.Errorf("failed to read PKCS12 certificate: %w", err)
 		}
-		return privateKey, chain[0], chain
-	} else {
-		privateKey, err := ReadPrivateKeyData(fileSystemSigner.privateKeyPath)
+		return privateKey, chain[0], chain, nil
+	}
+	privateKey, err := fileSystemSigner.readPrivateKey()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, chain, err := fileSystemSigner.readCertificateFiles()
+	if err != nil {
+		zeroizePrivateKey(privateKey)
+		return nil, nil, nil, err
+	}
+	return privateKey, cert, chain, nil
+}
+
+// Reads the private key of the signer (from the PKCS#12 file, if it's one)
+func (fileSystemSigner *FileSystemSigner) readPrivateKey() (crypto.PrivateKey, error) {
+	if fileSystemSigner.isPkcs12 {
+		privateKey, _, _, err := fileSystemSigner.readCertFiles()
+		return privateKey, err
+	}
+	privateKey, err := readPrivateKeyDataWithPassword(fileSystemSigner.privateKeyPath, fileSystemSigner.password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+	return privateKey, nil
+}
+
+// Reads the certificate and certificate bundle of a signer that doesn't use
+// a PKCS#12 file
+func (fileSystemSigner *FileSystemSigner) readCertificateFiles() (*x509.Certificate, []*x509.Certificate, error) {
+	var chain []*x509.Certificate
+	var err error
+	if fileSystemSigner.bundlePath != "" {
+		chain, err = GetCertChain(fileSystemSigner.bundlePath)
 		if err != nil {
-			log.Printf("Failed to read private key: %s\n", err)
-			os.Exit(1)
-		}
-		var chain []*x509.Certificate
-		if fileSystemSigner.bundlePath != "" {
-			chain, err = GetCertChain(fileSystemSigner.bundlePath)
-			if err != nil {
-				privateKey = nil
-				log.Printf("Failed to read certificate bundle: %s\n", err)
-				os.Exit(1)
-			}
+			return nil, nil, fmt.Errorf("failed to read certificate bundle: %w", err)
 		}
-		var cert *x509.Certificate
-		if fileSystemSigner.certPath != "" {
-			_, cert, err = ReadCertificateData(fileSystemSigner.certPath)
-			if err != nil {
-				privateKey = nil
-				log.Printf("Failed to read certificate: %s\n", err)
-				os.Exit(1)
-			}
-		} else if len(chain) > 0 {
-			cert = chain[0]
-		} else {
-			log.Println("No certificate path or certificate bundle path provided")
-			os.Exit(1)
+	}
+	var cert *x509.Certificate
+	if fileSystemSigner.certPath != "" {
+		_, cert, err = ReadCertificateData(fileSystemSigner.certPath)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read certificate: %w", err)
 		}
-
-		return privateKey, cert, chain
+	} else if len(chain) > 0 {
+		cert = chain[0]
+	} else {
+		return nil, nil, errors.New("no certificate path or certificate bundle path provided")
+	}
+	// Files that hold the certificate followed by its intermediates (such
+	// as the tls.crt files of cert-manager) can be passed as both
+	if fileSystemSigner.bundlePath == fileSystemSigner.certPath && len(chain) > 0 && chain[0].Equal(cert) {
+		chain = chain[1:]
 	}
+	return cert, chain, nil
 }
@@ -0,0 +1,140 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// crypto.Signer that hides the type of its key, as KMS and HSM abstractions
+// do
+type opaqueSigner struct {
+	signer crypto.Signer
+}
+
+func (s opaqueSigner) Public() crypto.PublicKey { return s.signer.Public() }
+
+func (s opaqueSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return s.signer.Sign(rand, digest, opts)
+}
+
+func TestPrivateKeySigner(t *testing.T) {
+	key, err := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := key.(*rsa.PrivateKey)
+	key, err = ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ecKey := key.(*ecdsa.PrivateKey)
+	_, ed25519Key, _ := ed25519.GenerateKey(rand.Reader)
+
+	for _, tc := range []struct {
+		name      string
+		key       crypto.PrivateKey
+		algorithm string
+	}{
+		{"RSA pointer", rsaKey, aws4_x509_rsa_sha256},
+		{"RSA value", *rsaKey, aws4_x509_rsa_sha256},
+		{"RSA crypto.Signer", opaqueSigner{rsaKey}, aws4_x509_rsa_sha256},
+		{"ECDSA pointer", ecKey, aws4_x509_ecdsa_sha256},
+		{"ECDSA value", *ecKey, aws4_x509_ecdsa_sha256},
+		{"ECDSA crypto.Signer", opaqueSigner{ecKey}, aws4_x509_ecdsa_sha256},
+		{"Ed25519", ed25519Key, ""},
+		{"Ed25519 crypto.Signer", opaqueSigner{ed25519Key}, ""},
+		{"not a signer", struct{}{}, ""},
+		{"nil", nil, ""},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			signer, algorithm, err := privateKeySigner(tc.key)
+			if tc.algorithm == "" {
+				if !errors.Is(err, ErrUnsupportedAlgorithm) {
+					t.Errorf("expected unsupported algorithm error, got %v", err)
+				}
+				return
+			}
+			if err != nil || algorithm != tc.algorithm {
+				t.Fatalf("unexpected signature algorithm %q: %v", algorithm, err)
+			}
+
+			digest := sha256.Sum256([]byte("payload"))
+			signature, err := signer.Sign(rand.Reader, digest[:], crypto.SHA256)
+			if err != nil {
+				t.Fatal(err)
+			}
+			switch publicKey := signer.Public().(type) {
+			case *rsa.PublicKey:
+				err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+			case *ecdsa.PublicKey:
+				if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+					err = errors.New("invalid signature")
+				}
+			}
+			if err != nil {
+				t.Errorf("signature can't be verified: %s", err)
+			}
+		})
+	}
+}
+
+func TestFileSystemSignerCachesCertificates(t *testing.T) {
+	dir := t.TempDir()
+	certPath := filepath.Join(dir, "cert.pem")
+	copyFile := func(source string, modTime time.Time) {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = os.WriteFile(certPath, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = os.Chtimes(certPath, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	copyFile("../tst/certs/ec-prime256v1-sha256-cert.pem", time.Now().Add(-time.Hour))
+
+	signer, _, err := GetFileSystemSigner("../tst/certs/ec-prime256v1-key.pem", certPath, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	first, err := signer.Certificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := signer.Certificate()
+	if err != nil || first != second {
+		t.Fatal("expected the parsed certificate to be reused:", err)
+	}
+	if _, err = signer.Sign(rand.Reader, []byte("payload"), crypto.SHA256); err != nil {
+		t.Fatal(err)
+	}
+
+	// A rotated certificate is parsed again (and no longer matches the key)
+	copyFile("../tst/certs/rsa-2048-sha256-cert.pem", time.Now().Add(-time.Minute))
+	rotated, err := signer.Certificate()
+	if err != nil || rotated.Equal(first) {
+		t.Fatal("expected the rotated certificate to be parsed:", err)
+	}
+	if _, err = signer.Sign(rand.Reader, []byte("payload"), crypto.SHA256); !errors.Is(err, ErrKeyCertificateMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Files that were just written aren't cached
+	copyFile("../tst/certs/ec-prime256v1-sha256-cert.pem", time.Now())
+	if current, _ := signer.Certificate(); !current.Equal(first) {
+		t.Error("expected the recently written certificate to be parsed")
+	}
+}
@@ -0,0 +1,31 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+)
+
+// Whether the binary uses a FIPS 140-validated cryptographic module, so
+// that only FIPS-approved algorithms are used. It's a variable so that tests
+// can apply the restrictions without such a module.
+var fipsMode = fipsEnabled()
+
+// Returns whether a FIPS 140-validated cryptographic module is in use:
+// BoringCrypto (in binaries built with GOEXPERIMENT=boringcrypto), or the Go
+// Cryptographic Module in FIPS mode (with Go 1.24 or later, through
+// GODEBUG=fips140=on or GOFIPS140). TLS is then restricted to FIPS-approved
+// settings, and private keys that are weak or encrypted with algorithms that
+// aren't FIPS-approved (such as PKCS#12 files and legacy OpenSSL encryption)
+// are rejected.
+func FIPSEnabled() bool {
+	return fipsMode
+}
+
+// Returns an error that wraps ErrUnsupportedAlgorithm if the binary uses a
+// FIPS 140-validated module, for algorithms that aren't FIPS-approved
+func checkFIPSApproved(algorithm string) error {
+	if fipsMode {
+		return fmt.Errorf("%w: %s isn't FIPS-approved, and the credential helper is running in FIPS mode",
+			ErrUnsupportedAlgorithm, algorithm)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build boringcrypto
+
+package aws_signing_helper
+
+import (
+	"crypto/boring"
+	// Restricts TLS to FIPS-approved versions, cipher suites, and curves
+	_ "crypto/tls/fipsonly"
+)
+
+func fipsEnabled() bool {
+	return boring.Enabled()
+}
@@ -0,0 +1,13 @@
+//go:build !boringcrypto && go1.24
+
+package aws_signing_helper
+
+import (
+	"crypto/fips140"
+)
+
+// The Go Cryptographic Module is used in FIPS mode if it's enabled at run
+// time (with GODEBUG=fips140=on) or at build time (with GOFIPS140)
+func fipsEnabled() bool {
+	return fips140.Enabled()
+}
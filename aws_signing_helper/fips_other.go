@@ -0,0 +1,7 @@
+//go:build !boringcrypto && !go1.24
+
+package aws_signing_helper
+
+func fipsEnabled() bool {
+	return false
+}
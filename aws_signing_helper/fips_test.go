@@ -0,0 +1,44 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFIPSMode(t *testing.T) {
+	defer func(enabled bool) { fipsMode = enabled }(fipsMode)
+	fipsMode = true
+
+	for _, opts := range []CredentialsOpts{
+		{CertificateId: "../tst/certs/rsa-2048-sha256.p12"},
+		{CertificateId: "../tst/certs/rsa-2048-sha256-cert.pem", PrivateKeyId: "../tst/certs/rsa-2048-key-encrypted.pem",
+			KeyPassword: "test"},
+	} {
+		if _, _, err := GetSigner(&opts); !errors.Is(err, ErrUnsupportedAlgorithm) || !strings.Contains(err.Error(), "FIPS") {
+			t.Errorf("expected %s to be rejected in FIPS mode, got %v", opts.CertificateId, err)
+		}
+	}
+
+	opts := CredentialsOpts{
+		CertificateId: "../tst/certs/rsa-1024-sha256-cert.pem",
+		PrivateKeyId:  "../tst/certs/rsa-1024-key.pem",
+		AllowWeakKeys: true,
+	}
+	if _, _, err := GetSigner(&opts); !errors.Is(err, ErrWeakKey) {
+		t.Errorf("expected weak keys to be rejected in FIPS mode, got %v", err)
+	}
+
+	for _, opts := range []CredentialsOpts{
+		{CertificateId: "../tst/certs/rsa-2048-sha256-cert.pem", PrivateKeyId: "../tst/certs/rsa-2048-key-pkcs8-encrypted.pem",
+			KeyPassword: "test"},
+		{CertificateId: "../tst/certs/ec-prime256v1-sha256-cert.pem", PrivateKeyId: "../tst/certs/ec-prime256v1-key.pem"},
+	} {
+		signer, _, err := GetSigner(&opts)
+		if err != nil {
+			t.Errorf("expected %s to be accepted in FIPS mode, got %v", opts.PrivateKeyId, err)
+			continue
+		}
+		signer.Close()
+	}
+}
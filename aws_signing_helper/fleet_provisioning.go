@@ -0,0 +1,233 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// How long fleet provisioning may take, from connecting to AWS IoT Core to
+// the registration of the thing
+var fleetProvisioningTimeout = 60 * time.Second
+
+// Port of MQTT over TLS, and the port (and ALPN protocol) on which AWS IoT
+// Core also serves MQTT to clients that negotiate it
+const (
+	mqttTLSPort      = "8883"
+	mqttALPNPort     = "443"
+	mqttALPNProtocol = "x-amzn-mqtt-ca"
+)
+
+// Topic of the CreateCertificateFromCsr API of AWS IoT Core
+const createCertificateFromCsrTopic = "$aws/certificates/create-from-csr/json"
+
+// Configuration of fleet provisioning by claim, through which a device that
+// only has a claim certificate obtains its own certificate from AWS IoT
+// Core, and is registered as a thing by a provisioning template
+type FleetProvisioningOptions struct {
+	// Endpoint of AWS IoT Core (such as
+	// abcdefghijklmn-ats.iot.us-east-1.amazonaws.com), with an optional
+	// port: 8883 by default, or 443 (with ALPN)
+	Endpoint string
+	// Files of the claim certificate and its private key
+	ClaimCertificate string
+	ClaimPrivateKey  string
+	// Name of the provisioning template, and the values of its parameters
+	// (such as SerialNumber)
+	TemplateName string
+	Parameters   map[string]string
+	// CAs that the certificate of the endpoint is verified against (by
+	// default, those of the system)
+	RootCAs *x509.CertPool
+}
+
+// Thing that a device was registered as by fleet provisioning
+type FleetProvisioningResult struct {
+	ThingName     string
+	CertificateId string
+	// Configuration that the provisioning template returns to the device
+	DeviceConfiguration map[string]string
+}
+
+// Response of the rejected topics of fleet provisioning
+type fleetProvisioningRejection struct {
+	StatusCode   int    `json:"statusCode"`
+	ErrorCode    string `json:"errorCode"`
+	ErrorMessage string `json:"errorMessage"`
+}
+
+// Obtains a certificate for a new private key from AWS IoT Core
+// (CreateCertificateFromCsr) with the claim certificate, registers the thing
+// with the provisioning template (RegisterThing), and writes the
+// certificate and the private key to the files. The private key never
+// leaves the device.
+func ProvisionDevice(ctx context.Context, options FleetProvisioningOptions, certificateFile string, privateKeyFile string) (FleetProvisioningResult, error) {
+	claim, err := tls.LoadX509KeyPair(options.ClaimCertificate, options.ClaimPrivateKey)
+	if err != nil {
+		return FleetProvisioningResult{}, fmt.Errorf("unable to read the claim certificate: %w", err)
+	}
+	defer zeroizePrivateKey(claim.PrivateKey)
+	address := options.Endpoint
+	if _, _, err = net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, mqttTLSPort)
+	}
+	host, port, _ := net.SplitHostPort(address)
+	tlsConfig := &tls.Config{
+		ServerName:   host,
+		RootCAs:      options.RootCAs,
+		Certificates: []tls.Certificate{claim},
+		MinVersion:   tls.VersionTLS12,
+	}
+	if port == mqttALPNPort {
+		tlsConfig.NextProtos = []string{mqttALPNProtocol}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return FleetProvisioningResult{}, err
+	}
+	defer zeroizePrivateKey(key)
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{}, key)
+	if err != nil {
+		return FleetProvisioningResult{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, fleetProvisioningTimeout)
+	defer cancel()
+	clientId := make([]byte, 8)
+	rand.Read(clientId)
+	client, err := dialMQTT(ctx, address, tlsConfig, "rolesanywhere-"+hex.EncodeToString(clientId))
+	if err != nil {
+		return FleetProvisioningResult{}, err
+	}
+	defer client.Close()
+	registerThingTopic := "$aws/provisioning-templates/" + options.TemplateName + "/provision/json"
+	err = client.subscribe(createCertificateFromCsrTopic+"/accepted", createCertificateFromCsrTopic+"/rejected",
+		registerThingTopic+"/accepted", registerThingTopic+"/rejected")
+	if err != nil {
+		return FleetProvisioningResult{}, err
+	}
+
+	var certificate struct {
+		CertificateId             string `json:"certificateId"`
+		CertificatePem            string `json:"certificatePem"`
+		CertificateOwnershipToken string `json:"certificateOwnershipToken"`
+	}
+	err = mqttRequest(client, createCertificateFromCsrTopic, map[string]string{
+		"certificateSigningRequest": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr})),
+	}, &certificate)
+	if err != nil {
+		return FleetProvisioningResult{}, fmt.Errorf("CreateCertificateFromCsr failed: %w", err)
+	}
+	certificates, err := parseCertificates([]byte(certificate.CertificatePem))
+	if err != nil || len(certificates) == 0 {
+		return FleetProvisioningResult{}, errors.New("CreateCertificateFromCsr returned no valid certificate")
+	}
+	if err = checkKeyMatchesCertificate(key.Public(), certificates[0]); err != nil {
+		return FleetProvisioningResult{}, err
+	}
+
+	parameters := options.Parameters
+	if parameters == nil {
+		parameters = map[string]string{}
+	}
+	var thing struct {
+		ThingName           string            `json:"thingName"`
+		DeviceConfiguration map[string]string `json:"deviceConfiguration"`
+	}
+	err = mqttRequest(client, registerThingTopic, map[string]interface{}{
+		"certificateOwnershipToken": certificate.CertificateOwnershipToken,
+		"parameters":                parameters,
+	}, &thing)
+	if err != nil {
+		return FleetProvisioningResult{}, fmt.Errorf("RegisterThing failed: %w", err)
+	}
+
+	// The certificate is written last, since its file tells whether the
+	// device was provisioned
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return FleetProvisioningResult{}, err
+	}
+	defer zeroizeBytes(der)
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	defer zeroizeBytes(keyPEM)
+	if err = writeFileAtomic(privateKeyFile, keyPEM); err != nil {
+		return FleetProvisioningResult{}, fmt.Errorf("unable to write the private key: %w", err)
+	}
+	if err = writeFileAtomic(certificateFile, []byte(certificate.CertificatePem)); err != nil {
+		return FleetProvisioningResult{}, fmt.Errorf("unable to write the certificate: %w", err)
+	}
+	return FleetProvisioningResult{ThingName: thing.ThingName, CertificateId: certificate.CertificateId,
+		DeviceConfiguration: thing.DeviceConfiguration}, nil
+}
+
+// Publishes the request on the topic of an API of AWS IoT Core, and decodes
+// the response of its accepted topic into the output (or returns the error
+// of its rejected topic)
+func mqttRequest(client *mqttClient, topic string, request interface{}, output interface{}) error {
+	payload, _ := json.Marshal(request)
+	if err := client.publish(topic, payload); err != nil {
+		return err
+	}
+	for {
+		message, err := client.next()
+		if err != nil {
+			return err
+		}
+		switch message.Topic {
+		case topic + "/accepted":
+			if err = json.Unmarshal(message.Payload, output); err != nil {
+				return fmt.Errorf("invalid response: %w", err)
+			}
+			return nil
+		case topic + "/rejected":
+			var rejection fleetProvisioningRejection
+			json.Unmarshal(message.Payload, &rejection)
+			return fmt.Errorf("%s (status %d): %s", rejection.ErrorCode, rejection.StatusCode, rejection.ErrorMessage)
+		}
+	}
+}
+
+// Provisions the device with the FleetProvisioning option, unless its
+// certificate file exists already (that is, unless it was provisioned
+// before)
+func provisionIfMissing(opts *CredentialsOpts) error {
+	if err := requireIdentityFiles(opts, "fleet provisioning"); err != nil {
+		return err
+	}
+	if _, err := os.Stat(opts.CertificateId); !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	signerLog.infof("%s doesn't exist, so the device is provisioned with the claim certificate %s",
+		opts.CertificateId, opts.FleetProvisioning.ClaimCertificate)
+	result, err := ProvisionDevice(context.Background(), *opts.FleetProvisioning, opts.CertificateId, opts.PrivateKeyId)
+	if err != nil {
+		return fmt.Errorf("fleet provisioning failed: %w", err)
+	}
+	signerLog.infof("the device was provisioned as thing %s (certificate %s)", result.ThingName, result.CertificateId)
+	return nil
+}
+
+// Returns an error unless the certificate and private key are files, which
+// the feature writes
+func requireIdentityFiles(opts *CredentialsOpts, feature string) error {
+	for _, id := range []string{opts.CertificateId, opts.PrivateKeyId} {
+		if id == "" || id == StdinIdentityId || strings.HasPrefix(id, "pkcs11:") {
+			return fmt.Errorf("%s requires the files of the certificate and private key", feature)
+		}
+	}
+	return nil
+}
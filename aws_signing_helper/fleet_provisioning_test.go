@@ -0,0 +1,204 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFleetProvisioning(t *testing.T) {
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Fleet CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	ca, _ := x509.ParseCertificate(caDER)
+
+	// Fake MQTT broker of AWS IoT Core, which issues certificates for the
+	// CSRs of devices that present a claim certificate, and rejects the
+	// registration of things with templates other than FleetTemplate
+	tlsServer := httptest.NewUnstartedServer(nil)
+	tlsServer.StartTLS()
+	defer tlsServer.Close()
+	listener, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: tlsServer.TLS.Certificates,
+		ClientAuth:   tls.RequireAnyClientCert,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	var connections atomic.Int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			connections.Add(1)
+			go func() {
+				defer conn.Close()
+				broker := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+				for {
+					packetType, _, body, err := broker.read()
+					if err != nil {
+						return
+					}
+					switch packetType {
+					case mqttConnect:
+						broker.write(mqttConnack<<4, []byte{0, 0})
+					case mqttSubscribe:
+						topics := 0
+						for rest := body[2:]; len(rest) > 0; topics++ {
+							_, rest, _ = readMQTTString(rest)
+							rest = rest[1:]
+						}
+						broker.write(mqttSuback<<4, append(body[:2:2], make([]byte, topics)...))
+					case mqttPublish:
+						topic, payload, _ := readMQTTString(body)
+						var response interface{}
+						switch topic {
+						case createCertificateFromCsrTopic:
+							var request struct {
+								CertificateSigningRequest string `json:"certificateSigningRequest"`
+							}
+							json.Unmarshal(payload, &request)
+							block, _ := pem.Decode([]byte(request.CertificateSigningRequest))
+							csr, err := x509.ParseCertificateRequest(block.Bytes)
+							if err != nil {
+								t.Error("invalid CSR:", err)
+								return
+							}
+							der, _ := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+								SerialNumber: big.NewInt(2),
+								Subject:      pkix.Name{CommonName: "AWS IoT Certificate"},
+								NotBefore:    time.Now().Add(-time.Hour),
+								NotAfter:     time.Now().Add(time.Hour),
+								KeyUsage:     x509.KeyUsageDigitalSignature,
+								ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+							}, ca, csr.PublicKey, caKey)
+							response = map[string]string{
+								"certificateId":             "device-certificate",
+								"certificatePem":            string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})),
+								"certificateOwnershipToken": "ownership-token",
+							}
+							topic += "/accepted"
+						case "$aws/provisioning-templates/FleetTemplate/provision/json":
+							var request struct {
+								CertificateOwnershipToken string            `json:"certificateOwnershipToken"`
+								Parameters                map[string]string `json:"parameters"`
+							}
+							json.Unmarshal(payload, &request)
+							if request.CertificateOwnershipToken != "ownership-token" || request.Parameters["SerialNumber"] != "1234" {
+								t.Errorf("unexpected RegisterThing request: %s", payload)
+							}
+							response = map[string]interface{}{"thingName": "device-1234",
+								"deviceConfiguration": map[string]string{"Fleet": "test"}}
+							topic += "/accepted"
+						default:
+							response = fleetProvisioningRejection{StatusCode: 404, ErrorCode: "ResourceNotFoundException",
+								ErrorMessage: "the provisioning template doesn't exist"}
+							topic += "/rejected"
+						}
+						// Responses are published with QoS 1, which the
+						// client acknowledges
+						payload, _ = json.Marshal(response)
+						message := binary.BigEndian.AppendUint16(appendMQTTString(nil, topic), 1)
+						broker.write(mqttPublish<<4|0x02, append(message, payload...))
+					case mqttDisconnect:
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(tlsServer.Certificate())
+	options := FleetProvisioningOptions{
+		Endpoint:         listener.Addr().String(),
+		ClaimCertificate: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+		ClaimPrivateKey:  "../tst/certs/ec-prime256v1-key.pem",
+		TemplateName:     "OtherTemplate",
+		Parameters:       map[string]string{"SerialNumber": "1234"},
+		RootCAs:          rootCAs,
+	}
+	dir := t.TempDir()
+	certificateFile := filepath.Join(dir, "device.pem")
+	privateKeyFile := filepath.Join(dir, "device.key")
+	_, err = ProvisionDevice(context.Background(), options, certificateFile, privateKeyFile)
+	if err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Fatal("expected the rejection of RegisterThing, got", err)
+	}
+	if _, err = os.Stat(certificateFile); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("expected no certificate to be written after a rejection")
+	}
+
+	// The device is provisioned the first time a signer is made, and its
+	// certificate is used from then on
+	options.TemplateName = "FleetTemplate"
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	opts := CredentialsOpts{
+		CertificateId:     certificateFile,
+		PrivateKeyId:      privateKeyFile,
+		FleetProvisioning: &options,
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	for i := 0; i < 2; i++ {
+		signer, _, err := GetSigner(&opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate, err := signer.Certificate()
+		signer.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if certificate.Issuer.CommonName != "Fleet CA" {
+			t.Errorf("unexpected certificate issued by %s", certificate.Issuer.CommonName)
+		}
+	}
+	if count := connections.Load(); count != 2 {
+		t.Errorf("expected the device to be provisioned once, but AWS IoT Core was connected to %d times", count-1)
+	}
+	if _, err = tls.LoadX509KeyPair(certificateFile, privateKeyFile); err != nil {
+		t.Error("invalid provisioned certificate and private key:", err)
+	}
+	if info, err := os.Stat(privateKeyFile); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Error("expected the private key to be owner-only:", err)
+	}
+
+	opts.CertificateId = StdinIdentityId
+	if _, _, err = GetSigner(&opts); err == nil {
+		t.Error("expected fleet provisioning to require certificate files")
+	}
+}
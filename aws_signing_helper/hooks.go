@@ -0,0 +1,99 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"time"
+)
+
+// Callbacks for events of the library, so that applications that embed it
+// can record metrics, audit signatures, and raise alerts. Any of them can be
+// nil. They're called synchronously, so they should return quickly (and they
+// may be called concurrently, by the serve command).
+type Hooks struct {
+	// Called after credentials were obtained from CreateSession
+	OnRefresh func(RefreshEvent)
+	// Called after a request was signed with the private key
+	OnSign func(SignEvent)
+	// Called when an operation failed
+	OnError func(ErrorEvent)
+	// Called when credentials that were obtained earlier were returned,
+	// instead of calling CreateSession
+	OnCacheHit func(CacheHitEvent)
+	// Called before CreateSession is called with a certificate that expires
+	// within CredentialsOpts.CertificateExpiryWarningWindow
+	OnCertificateExpiring func(CertificateExpiryEvent)
+}
+
+// Credentials were obtained from CreateSession
+type RefreshEvent struct {
+	RoleArn    string
+	Expiration time.Time
+	// How long the CreateSession call (including signing) took
+	Duration time.Duration
+	// Certificate that the call was signed with (nil if the signer doesn't
+	// have one)
+	Certificate *x509.Certificate
+}
+
+// A request was signed with the private key
+type SignEvent struct {
+	SignatureAlgorithm string
+	Certificate        *x509.Certificate
+	// How long signing the request took
+	Duration time.Duration
+}
+
+// Operations whose failures are reported through Hooks.OnError
+const (
+	OperationCreateSession   = "CreateSession"
+	OperationCredentialCache = "CredentialCache"
+)
+
+// An operation failed
+type ErrorEvent struct {
+	Operation string
+	Err       error
+}
+
+// Credentials that were obtained earlier were returned
+type CacheHitEvent struct {
+	Expiration time.Time
+}
+
+// The certificate expires soon
+type CertificateExpiryEvent struct {
+	Certificate *x509.Certificate
+	NotAfter    time.Time
+	// How long the certificate is still valid for
+	Remaining time.Duration
+}
+
+func (h *Hooks) refreshed(event RefreshEvent) {
+	if h.OnRefresh != nil {
+		h.OnRefresh(event)
+	}
+}
+
+func (h *Hooks) signed(event SignEvent) {
+	if h.OnSign != nil {
+		h.OnSign(event)
+	}
+}
+
+func (h *Hooks) failed(event ErrorEvent) {
+	if h.OnError != nil {
+		h.OnError(event)
+	}
+}
+
+func (h *Hooks) cacheHit(event CacheHitEvent) {
+	if h.OnCacheHit != nil {
+		h.OnCacheHit(event)
+	}
+}
+
+func (h *Hooks) certificateExpiring(event CertificateExpiryEvent) {
+	if h.OnCertificateExpiring != nil {
+		h.OnCertificateExpiring(event)
+	}
+}
@@ -0,0 +1,59 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	var (
+		refreshes []RefreshEvent
+		signs     []SignEvent
+		failures  []ErrorEvent
+	)
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+		Hooks: Hooks{
+			OnRefresh: func(event RefreshEvent) { refreshes = append(refreshes, event) },
+			OnSign:    func(event SignEvent) { signs = append(signs, event) },
+			OnError:   func(event ErrorEvent) { failures = append(failures, event) },
+		},
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Fatal(err)
+	}
+	if len(refreshes) != 1 || refreshes[0].RoleArn != opts.RoleArn || refreshes[0].Expiration.IsZero() {
+		t.Log("unexpected refresh events:", refreshes)
+		t.Fail()
+	}
+	if len(signs) != 1 || signs[0].SignatureAlgorithm != signatureAlgorithm || signs[0].Certificate == nil {
+		t.Log("unexpected sign events:", signs)
+		t.Fail()
+	}
+
+	server.Close()
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err == nil {
+		t.Fatal("expected CreateSession to fail")
+	}
+	if len(failures) != 1 || failures[0].Operation != OperationCreateSession || !errors.Is(failures[0].Err, ErrEndpointUnreachable) ||
+		len(refreshes) != 1 {
+		t.Log("unexpected error events:", failures)
+		t.Fail()
+	}
+}
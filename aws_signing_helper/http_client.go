@@ -0,0 +1,201 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere"
+)
+
+// How long idle connections to Roles Anywhere are kept open, as with
+// http.DefaultTransport
+const idleConnTimeout = 90 * time.Second
+
+// How long before credentials are refreshed a connection is established, with
+// the Preconnect option
+const preconnectLead = 10 * time.Second
+
+// HTTP versions of the connections to Roles Anywhere
+const (
+	// HTTP/2 is used if the endpoint negotiates it (through ALPN), and
+	// HTTP/1.1 otherwise
+	HTTPVersionAuto = "auto"
+	// HTTP/1.1 is always used
+	HTTPVersion1 = "1.1"
+	// HTTP/2 is required, and connections to endpoints that don't negotiate
+	// it fail
+	HTTPVersion2 = "2"
+)
+
+// Clients for CreateSession calls, by the options that configure their
+// transport, so that the serve and update commands (and Credentialers) reuse
+// connections and TLS sessions across refreshes, rather than going through the
+// TCP and TLS handshakes each time
+var createSessionClients struct {
+	sync.Mutex
+	clients map[string]*http.Client
+}
+
+// Returns the client for CreateSession calls with the proxy and TLS settings of
+// the options, which is shared by all calls with the same settings
+func createSessionClient(opts *CredentialsOpts) (*http.Client, error) {
+	key := fmt.Sprint(opts.WithProxy, opts.NoVerifySSL, opts.TLSMinVersion, opts.TLSCipherSuites,
+		opts.TLSCurvePreferences, opts.EndpointPins, opts.HTTPVersion)
+	createSessionClients.Lock()
+	defer createSessionClients.Unlock()
+	if client, ok := createSessionClients.clients[key]; ok {
+		return client, nil
+	}
+
+	tlsClientConfig := tlsConfig(opts)
+	if len(opts.EndpointPins) > 0 {
+		var err error
+		if tlsClientConfig.VerifyConnection, err = verifyEndpointPins(opts.EndpointPins); err != nil {
+			return nil, err
+		}
+	}
+	if opts.HTTPVersion == HTTPVersion2 {
+		tlsClientConfig.VerifyConnection = requireHTTP2(tlsClientConfig.VerifyConnection)
+	}
+	// Sessions are resumed when connections have been closed for being idle,
+	// which skips the verification of the certificate chain
+	tlsClientConfig.ClientSessionCache = tls.NewLRUClientSessionCache(0)
+	transport := &http.Transport{
+		TLSClientConfig:     tlsClientConfig,
+		TLSHandshakeTimeout: 10 * time.Second,
+		MaxIdleConnsPerHost: 2,
+		IdleConnTimeout:     idleConnTimeout,
+	}
+	switch opts.HTTPVersion {
+	case HTTPVersion1:
+		// A non-nil map disables HTTP/2
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+	default:
+		// HTTP/2 isn't attempted by default with a custom TLS configuration.
+		// Concurrent CreateSession calls (such as those of the roles that
+		// are served) are multiplexed over a single HTTP/2 connection.
+		transport.ForceAttemptHTTP2 = true
+	}
+	if opts.WithProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	client := &http.Client{Transport: transport}
+	if createSessionClients.clients == nil {
+		createSessionClients.clients = make(map[string]*http.Client)
+	}
+	createSessionClients.clients[key] = client
+	return client, nil
+}
+
+// Fails TLS connections that didn't negotiate HTTP/2, after the verification
+// of the connection (if there's one)
+func requireHTTP2(verify func(tls.ConnectionState) error) func(tls.ConnectionState) error {
+	return func(state tls.ConnectionState) error {
+		if state.NegotiatedProtocol != "h2" {
+			return fmt.Errorf("the endpoint %s doesn't support HTTP/2 (use --http-version auto or 1.1)", state.ServerName)
+		}
+		if verify == nil {
+			return nil
+		}
+		return verify(state)
+	}
+}
+
+// Parses the HTTP version of the connections to Roles Anywhere (auto, 1.1,
+// or 2)
+func ParseHTTPVersion(name string) (string, error) {
+	switch strings.TrimPrefix(strings.ToLower(name), "http/") {
+	case "", HTTPVersionAuto:
+		return HTTPVersionAuto, nil
+	case HTTPVersion1:
+		return HTTPVersion1, nil
+	case HTTPVersion2, "2.0":
+		return HTTPVersion2, nil
+	default:
+		return "", fmt.Errorf("unsupported HTTP version %q (one of auto, 1.1, and 2)", name)
+	}
+}
+
+// Establishes a connection to the Roles Anywhere endpoint (with a HEAD
+// request, whose response is discarded), which is then kept open for
+// the next CreateSession call. Failures are only logged, since the
+// CreateSession call reports them.
+func preconnect(ctx context.Context, opts *CredentialsOpts) {
+	url, err := createSessionEndpoint(ctx, opts)
+	if err != nil {
+		transportLog.debugf("unable to establish a connection ahead of the refresh: %s", err)
+		return
+	}
+	client, err := createSessionClient(opts)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, preconnectLead)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+	if err != nil {
+		return
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		transportLog.debugf("unable to establish a connection ahead of the refresh: %s", err)
+		return
+	}
+	io.Copy(io.Discard, response.Body)
+	response.Body.Close()
+	transportLog.debugf("established a connection to %s ahead of the refresh", url)
+}
+
+// Returns the URL of the Roles Anywhere endpoint that CreateSession is called
+// on: the Endpoint option, or the endpoint of the region
+func createSessionEndpoint(ctx context.Context, opts *CredentialsOpts) (string, error) {
+	if opts.Endpoint != "" {
+		return opts.Endpoint, nil
+	}
+	region := opts.Region
+	if region == "" {
+		trustAnchorArn, err := arn.Parse(opts.TrustAnchorArnStr)
+		if err != nil {
+			return "", err
+		}
+		region = trustAnchorArn.Region
+	}
+	endpoint, err := rolesanywhere.NewDefaultEndpointResolverV2().ResolveEndpoint(ctx,
+		rolesanywhere.EndpointParameters{Region: aws.String(region)})
+	if err != nil {
+		return "", err
+	}
+	return endpoint.URI.String(), nil
+}
+
+// Timer of the serve command that establishes a connection before
+// credentials are next refreshed
+var preconnectTimer struct {
+	sync.Mutex
+	timer *time.Timer
+}
+
+// Establishes a connection to Roles Anywhere shortly before the refresh time
+// (replacing a connection that was scheduled earlier), if the Preconnect
+// option is set
+func schedulePreconnect(opts *CredentialsOpts, refreshTime time.Time) {
+	if !opts.Preconnect {
+		return
+	}
+	preconnectTimer.Lock()
+	defer preconnectTimer.Unlock()
+	if preconnectTimer.timer != nil {
+		preconnectTimer.timer.Stop()
+	}
+	preconnectTimer.timer = time.AfterFunc(time.Until(refreshTime.Add(-preconnectLead)), func() {
+		preconnect(context.Background(), opts)
+	})
+}
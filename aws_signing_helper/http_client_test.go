@@ -0,0 +1,117 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCreateSessionConnectionReuse(t *testing.T) {
+	server := httptest.NewUnstartedServer(mockedCreateSessionHandler())
+	var connections atomic.Int32
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+	opts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		// Keeps the client of this test apart from those of other tests
+		TLSCurvePreferences: []tls.CurveID{tls.X25519},
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// The connection that's established ahead of the refresh is reused by
+	// the CreateSession calls
+	preconnect(context.Background(), &opts)
+	for i := 0; i < 3; i++ {
+		if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := connections.Load(); n != 1 {
+		t.Errorf("unexpected number of connections: %d", n)
+	}
+
+	client, _ := createSessionClient(&opts)
+	opts.WithProxy = true
+	if other, _ := createSessionClient(&opts); other == client {
+		t.Error("clients with different settings were shared")
+	}
+}
+
+func TestHTTPVersion(t *testing.T) {
+	newServer := func(http2 bool) *httptest.Server {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Proto)
+		}))
+		server.EnableHTTP2 = http2
+		server.StartTLS()
+		return server
+	}
+	http2Server, http1Server := newServer(true), newServer(false)
+	defer http2Server.Close()
+	defer http1Server.Close()
+
+	for _, test := range []struct {
+		version string
+		server  *httptest.Server
+		proto   string
+	}{
+		{HTTPVersionAuto, http2Server, "HTTP/2.0"},
+		{HTTPVersionAuto, http1Server, "HTTP/1.1"},
+		{HTTPVersion1, http2Server, "HTTP/1.1"},
+		{HTTPVersion2, http2Server, "HTTP/2.0"},
+		{HTTPVersion2, http1Server, ""},
+	} {
+		// The curves keep the clients of this test apart from those of other
+		// tests
+		client, err := createSessionClient(&CredentialsOpts{NoVerifySSL: true, HTTPVersion: test.version,
+			TLSCurvePreferences: []tls.CurveID{tls.CurveP384}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		response, err := client.Get(test.server.URL)
+		if test.proto == "" {
+			if err == nil || !strings.Contains(err.Error(), "HTTP/2") {
+				t.Errorf("HTTP/2 wasn't required with HTTP version %s: %v", test.version, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(response.Body)
+		response.Body.Close()
+		if string(body) != test.proto {
+			t.Errorf("unexpected protocol with HTTP version %s: %s", test.version, body)
+		}
+	}
+
+	for name, expected := range map[string]string{"": HTTPVersionAuto, "HTTP/1.1": HTTPVersion1, "2.0": HTTPVersion2} {
+		if version, err := ParseHTTPVersion(name); err != nil || version != expected {
+			t.Errorf("unexpected HTTP version for %q: %q (%v)", name, version, err)
+		}
+	}
+	if _, err := ParseHTTPVersion("3"); err == nil {
+		t.Error("unsupported HTTP version was accepted")
+	}
+}
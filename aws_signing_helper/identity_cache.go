@@ -0,0 +1,114 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Files that were modified more recently than this aren't cached, since a
+// later write within the resolution of their modification time (which is two
+// seconds on FAT file systems) wouldn't be noticed
+const identityCacheMinAge = 2 * time.Second
+
+// Version of a file, which changes when it's rewritten (or replaced)
+type fileVersion struct {
+	path    string
+	modTime int64
+	size    int64
+}
+
+// Value that's parsed from files, and reused until one of them changes
+type parsedFiles[T any] struct {
+	mu       sync.Mutex
+	versions []fileVersion
+	value    T
+}
+
+// Certificate and chain of a FileSystemSigner
+type parsedCertificates struct {
+	certificate *x509.Certificate
+	chain       []*x509.Certificate
+}
+
+// Returns the value that was parsed from the files, if none of them changed
+// since, and parses them again otherwise. Identity material that's read from
+// stdin (which is only read once anyway) isn't cached.
+func (cache *parsedFiles[T]) get(parse func() (T, error), paths ...string) (T, error) {
+	versions, ok := currentFileVersions(paths)
+	if !ok {
+		return parse()
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	if cache.versions != nil && slices.Equal(cache.versions, versions) {
+		return cache.value, nil
+	}
+	value, err := parse()
+	if err != nil {
+		return value, err
+	}
+	cache.versions, cache.value = versions, value
+	signerLog.debugf("parsed %v", paths)
+	return value, nil
+}
+
+// Returns the versions of the files, and whether they can be cached
+func currentFileVersions(paths []string) ([]fileVersion, bool) {
+	versions := make([]fileVersion, 0, len(paths))
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if path == StdinIdentityId {
+			return nil, false
+		}
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < identityCacheMinAge {
+			return nil, false
+		}
+		versions = append(versions, fileVersion{path, info.ModTime().UnixNano(), info.Size()})
+	}
+	return versions, true
+}
+
+// Returns the certificate and chain of the signer, which are only parsed
+// again when their files change
+func (fileSystemSigner *FileSystemSigner) readCertificates() (*x509.Certificate, []*x509.Certificate, error) {
+	certificates, err := fileSystemSigner.certificates.get(func() (parsedCertificates, error) {
+		if fileSystemSigner.isPkcs12 {
+			privateKey, certificate, chain, err := fileSystemSigner.readCertFiles()
+			zeroizePrivateKey(privateKey)
+			return parsedCertificates{certificate, chain}, err
+		}
+		certificate, chain, err := fileSystemSigner.readCertificateFiles()
+		return parsedCertificates{certificate, chain}, err
+	}, fileSystemSigner.certPath, fileSystemSigner.bundlePath)
+	return certificates.certificate, certificates.chain, err
+}
+
+// Returns the public key of the signer, which is only derived from the
+// private key again when its file changes. The private key itself isn't
+// cached.
+func (fileSystemSigner *FileSystemSigner) readPublicKey() (crypto.PublicKey, error) {
+	path := fileSystemSigner.privateKeyPath
+	if fileSystemSigner.isPkcs12 {
+		path = fileSystemSigner.certPath
+	}
+	return fileSystemSigner.publicKey.get(func() (crypto.PublicKey, error) {
+		privateKey, err := fileSystemSigner.readPrivateKey()
+		if err != nil {
+			return nil, err
+		}
+		defer zeroizePrivateKey(privateKey)
+		signer, _, err := privateKeySigner(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}, path)
+}
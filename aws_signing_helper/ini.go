@@ -0,0 +1,169 @@
+package aws_signing_helper
+
+import (
+	"strings"
+)
+
+// A single key/value pair to be written into a section of an INI file
+type iniKeyValue struct {
+	Key   string
+	Value string
+}
+
+// Returns whether the line is a comment line in an INI file
+func isINIComment(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, ";")
+}
+
+// Parses the name of the section if the line is a section header. Whitespace
+// surrounding the name and any trailing comment after the closing bracket are
+// ignored, so that `[ default ] # comment` is treated as the `default` section.
+func parseINISectionName(line string) (string, bool) {
+	trimmed := strings.TrimSpace(line)
+	if !strings.HasPrefix(trimmed, "[") {
+		return "", false
+	}
+	end := strings.Index(trimmed, "]")
+	if end < 0 {
+		return "", false
+	}
+	return strings.TrimSpace(trimmed[1:end]), true
+}
+
+// Parses the name of the key if the line is a key/value pair
+func parseINIKey(line string) (string, bool) {
+	if isINIComment(line) {
+		return "", false
+	}
+	sep := strings.Index(line, "=")
+	if sep < 0 {
+		return "", false
+	}
+	key := strings.TrimSpace(line[:sep])
+	if key == "" {
+		return "", false
+	}
+	return key, true
+}
+
+// Sets the given keys within the first section named `sectionName`, returning
+// the new lines of the file (without line terminators). Keys that already exist
+// in the section have their values replaced in place, and keys that don't are
+// added either before the next managed key (so that managed keys stay in the
+// order given) or after the last key/value pair in the section. Every other line of the
+// file (other sections, comments, blank lines, and unrelated keys) is preserved
+// as-is and in its original order. If the section doesn't exist, it is appended
+// to the end of the file, followed by a blank line.
+func setINISectionKeys(lines []string, sectionName string, keyValues []iniKeyValue) []string {
+	var (
+		sectionStart = -1
+		sectionEnd   = len(lines)
+	)
+
+	for i, line := range lines {
+		name, ok := parseINISectionName(line)
+		if !ok {
+			continue
+		}
+		if sectionStart >= 0 {
+			sectionEnd = i
+			break
+		}
+		if name == sectionName {
+			sectionStart = i
+		}
+	}
+
+	formatKeyValue := func(keyValue iniKeyValue) string {
+		return keyValue.Key + " = " + keyValue.Value
+	}
+
+	// If the section doesn't exist, append it to the end of the file
+	if sectionStart < 0 {
+		newLines := append([]string{}, lines...)
+		newLines = append(newLines, "["+sectionName+"]")
+		for _, keyValue := range keyValues {
+			newLines = append(newLines, formatKeyValue(keyValue))
+		}
+		return append(newLines, "")
+	}
+
+	pending := make(map[string]int, len(keyValues))
+	for i, keyValue := range keyValues {
+		pending[keyValue.Key] = i
+	}
+	written := make(map[string]bool, len(keyValues))
+
+	// Find where keys that aren't already present should be inserted, so that
+	// comments and blank lines preceding the next section stay where they are.
+	insertAt := sectionStart + 1
+	for i := sectionStart + 1; i < sectionEnd; i++ {
+		if _, ok := parseINIKey(lines[i]); ok {
+			insertAt = i + 1
+		}
+	}
+
+	newLines := make([]string, 0, len(lines)+len(keyValues))
+	newLines = append(newLines, lines[:sectionStart+1]...)
+	for i := sectionStart + 1; i < sectionEnd; i++ {
+		if i == insertAt {
+			newLines = appendMissingKeys(newLines, keyValues, written, formatKeyValue)
+		}
+		key, ok := parseINIKey(lines[i])
+		if index, managed := pending[key]; ok && managed {
+			// Drop duplicate definitions of managed keys, since they would
+			// otherwise shadow (or be shadowed by) the refreshed value.
+			if !written[key] {
+				// Keep managed keys in the order they were given in
+				newLines = appendMissingKeys(newLines, keyValues[:index], written, formatKeyValue)
+				newLines = append(newLines, formatKeyValue(keyValues[index]))
+				written[key] = true
+			}
+			continue
+		}
+		newLines = append(newLines, lines[i])
+	}
+	if insertAt == sectionEnd {
+		newLines = appendMissingKeys(newLines, keyValues, written, formatKeyValue)
+	}
+	newLines = append(newLines, lines[sectionEnd:]...)
+
+	return newLines
+}
+
+// Appends the keys that haven't been written yet, while marking them as written
+func appendMissingKeys(lines []string, keyValues []iniKeyValue, written map[string]bool, format func(iniKeyValue) string) []string {
+	for _, keyValue := range keyValues {
+		if !written[keyValue.Key] {
+			lines = append(lines, format(keyValue))
+			written[keyValue.Key] = true
+		}
+	}
+	return lines
+}
+
+// Returns the key/value pairs within the first section named `sectionName`
+// (with surrounding whitespace trimmed from keys and values), and whether the
+// section exists
+func getINISectionValues(lines []string, sectionName string) (map[string]string, bool) {
+	values := make(map[string]string)
+	found, inSection := false, false
+	for _, line := range lines {
+		if name, ok := parseINISectionName(line); ok {
+			if inSection {
+				break
+			}
+			inSection = name == sectionName
+			found = found || inSection
+			continue
+		}
+		if !inSection {
+			continue
+		}
+		if key, ok := parseINIKey(line); ok {
+			values[key] = strings.TrimSpace(line[strings.Index(line, "=")+1:])
+		}
+	}
+	return values, found
+}
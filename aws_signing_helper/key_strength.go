@@ -0,0 +1,32 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"fmt"
+)
+
+// Smallest RSA modulus and elliptic curve accepted, unless weak keys are
+// allowed: RSA keys under 2048 bits and curves under 256 bits (such as
+// P-224) are deprecated by NIST SP 800-131A
+const (
+	minRSAKeyBits   = 2048
+	minECDSAKeyBits = 256
+)
+
+// Checks that the key is strong enough to be used as an identity
+func checkKeyStrength(publicKey crypto.PublicKey) error {
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if bits := key.N.BitLen(); bits < minRSAKeyBits {
+			return fmt.Errorf("%w: the RSA key has %d bits, and at least %d are required", ErrWeakKey, bits, minRSAKeyBits)
+		}
+	case *ecdsa.PublicKey:
+		if params := key.Curve.Params(); params.BitSize < minECDSAKeyBits {
+			return fmt.Errorf("%w: the ECDSA key is on the deprecated curve %s, and a curve of at least %d bits "+
+				"(such as P-256) is required", ErrWeakKey, params.Name, minECDSAKeyBits)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestWeakKeys(t *testing.T) {
+	opts := CredentialsOpts{
+		CertificateId: "../tst/certs/rsa-1024-sha256-cert.pem",
+		PrivateKeyId:  "../tst/certs/rsa-1024-key.pem",
+	}
+	if _, _, err := GetSigner(&opts); !errors.Is(err, ErrWeakKey) || !strings.Contains(err.Error(), "1024 bits") {
+		t.Errorf("expected a 1024-bit RSA key to be rejected, got %v", err)
+	}
+	opts.AllowWeakKeys = true
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.Close()
+
+	for _, tc := range []struct {
+		curve elliptic.Curve
+		weak  bool
+	}{
+		{elliptic.P224(), true},
+		{elliptic.P256(), false},
+		{elliptic.P384(), false},
+	} {
+		key, _ := ecdsa.GenerateKey(tc.curve, rand.Reader)
+		if err := checkKeyStrength(key.Public()); errors.Is(err, ErrWeakKey) != tc.weak {
+			t.Errorf("unexpected result for %s: %v", tc.curve.Params().Name, err)
+		}
+	}
+}
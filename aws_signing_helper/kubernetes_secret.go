@@ -0,0 +1,320 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Directory that the service account token, the CA certificate of the API
+// server, and the namespace are mounted in, in pods
+var serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// How long GetKubernetesSecretSigner waits for the secret (for example,
+// while cert-manager issues the certificate of a new Certificate resource)
+var kubernetesSecretTimeout = 30 * time.Second
+
+// How long to wait before the secret is read again, after reading or
+// watching it failed
+var kubernetesRetryInterval = 5 * time.Second
+
+// How long requests to the API server (other than watches) may take
+const kubernetesRequestTimeout = 30 * time.Second
+
+// How long a watch of the secret lasts, before it's started again (as the
+// API server would otherwise end it at an arbitrary time)
+const kubernetesWatchTimeout = 10 * time.Minute
+
+// Keys of the certificate, private key, and CA certificate in secrets of
+// type kubernetes.io/tls, as cert-manager writes them
+const (
+	kubernetesTLSCertificateKey = "tls.crt"
+	kubernetesTLSPrivateKeyKey  = "tls.key"
+	kubernetesCACertificateKey  = "ca.crt"
+)
+
+// Client of the Kubernetes API server, with the credentials of the service
+// account of the pod
+type kubernetesClient struct {
+	baseURL   string
+	client    *http.Client
+	tokenFile string
+}
+
+// Secret, as the API server returns it. Data values are base64-encoded,
+// which encoding/json decodes.
+type kubernetesSecret struct {
+	Metadata struct {
+		ResourceVersion string `json:"resourceVersion"`
+	} `json:"metadata"`
+	Data map[string][]byte `json:"data"`
+}
+
+// Event of a watch of the secret. On ERROR events, the object is a Status.
+type kubernetesWatchEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// Status that the API server returns along with failures
+type kubernetesStatus struct {
+	Message string `json:"message"`
+	Reason  string `json:"reason,omitempty"`
+	Code    int    `json:"code"`
+}
+
+// Creates a client of the API server of the cluster that the pod runs in,
+// from the environment variables and service account mount that the
+// kubelet provides
+func newInClusterKubernetesClient() (*kubernetesClient, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, errors.New("not running in a Kubernetes pod (KUBERNETES_SERVICE_HOST and KUBERNETES_SERVICE_PORT aren't set)")
+	}
+	caData, err := os.ReadFile(filepath.Join(serviceAccountDir, "ca.crt"))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the CA certificate of the API server: %w", err)
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(caData) {
+		return nil, errors.New("no CA certificate of the API server was found in the service account mount")
+	}
+	transport := &http.Transport{
+		TLSClientConfig:     &tls.Config{RootCAs: roots, MinVersion: tls.VersionTLS12},
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+	return &kubernetesClient{
+		baseURL:   "https://" + net.JoinHostPort(host, port),
+		client:    &http.Client{Transport: transport},
+		tokenFile: filepath.Join(serviceAccountDir, "token"),
+	}, nil
+}
+
+// Sends a GET request to the API server, and returns the response if its
+// status is 200. The token is read for each request, since the kubelet
+// rotates bound service account tokens.
+func (client *kubernetesClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	token, err := os.ReadFile(client.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the service account token: %w", err)
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, client.baseURL+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	request.Header.Set("Accept", "application/json")
+	response, err := client.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode != http.StatusOK {
+		defer response.Body.Close()
+		var status kubernetesStatus
+		body, _ := io.ReadAll(io.LimitReader(response.Body, 64<<10))
+		if json.Unmarshal(body, &status) != nil || status.Message == "" {
+			status.Message = strings.TrimSpace(string(body))
+		}
+		return nil, fmt.Errorf("the Kubernetes API server responded with %s: %s", response.Status, status.Message)
+	}
+	return response, nil
+}
+
+// Signer whose identity is the certificate and private key of a secret of
+// type kubernetes.io/tls (such as the secret of a cert-manager Certificate),
+// which is read through the Kubernetes API and watched, so that renewals are
+// used as soon as they're written, without mounting the secret
+type KubernetesSecretSigner struct {
+	rotatingSigner
+	client    *kubernetesClient
+	namespace string
+	name      string
+}
+
+// Reads the secret ("<namespace>/<name>", or the name of a secret in the
+// namespace of the pod) through the API server of the cluster that the pod
+// runs in, and watches it. The service account of the pod needs the get,
+// list, and watch permissions on the secret.
+func GetKubernetesSecretSigner(secret string) (signer Signer, signingAlgorithm string, err error) {
+	namespace, name, ok := strings.Cut(secret, "/")
+	if !ok {
+		name = secret
+		data, err := os.ReadFile(filepath.Join(serviceAccountDir, "namespace"))
+		if err != nil {
+			return nil, "", fmt.Errorf("unable to read the namespace of the pod (pass <namespace>/%s instead): %w", secret, err)
+		}
+		namespace = strings.TrimSpace(string(data))
+	}
+	if namespace == "" || name == "" || strings.Contains(name, "/") {
+		return nil, "", fmt.Errorf("invalid Kubernetes secret %q: expected <namespace>/<name> or <name>", secret)
+	}
+	client, err := newInClusterKubernetesClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	secretSigner := &KubernetesSecretSigner{client: client, namespace: namespace, name: name}
+	secretSigner.start(secretSigner.watch)
+	signingAlgorithm, err = secretSigner.wait(kubernetesSecretTimeout)
+	if err != nil {
+		return nil, "", fmt.Errorf("unable to read the identity from the Kubernetes secret %s/%s within %s: %w",
+			namespace, name, kubernetesSecretTimeout, err)
+	}
+	return secretSigner, signingAlgorithm, nil
+}
+
+// Reads the secret, and watches it for changes, until the context is done.
+// Watches are started again from the last version of the secret that was
+// seen, and the secret is read again if that version is too old.
+func (secretSigner *KubernetesSecretSigner) watch(ctx context.Context) {
+	for {
+		err := secretSigner.follow(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if !secretSigner.setError(err) {
+			signerLog.warnf("unable to watch the Kubernetes secret %s/%s (retrying in %s): %s", secretSigner.namespace,
+				secretSigner.name, kubernetesRetryInterval, err)
+		} else {
+			signerLog.debugf("unable to read the Kubernetes secret %s/%s (retrying in %s): %s", secretSigner.namespace,
+				secretSigner.name, kubernetesRetryInterval, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(kubernetesRetryInterval):
+		}
+	}
+}
+
+// Reads the secret, and then applies the changes that watches of it report,
+// until a watch fails
+func (secretSigner *KubernetesSecretSigner) follow(ctx context.Context) error {
+	path := "/api/v1/namespaces/" + url.PathEscape(secretSigner.namespace) + "/secrets"
+	getCtx, cancel := context.WithTimeout(ctx, kubernetesRequestTimeout)
+	defer cancel()
+	response, err := secretSigner.client.get(getCtx, path+"/"+url.PathEscape(secretSigner.name), nil)
+	if err != nil {
+		return err
+	}
+	var secret kubernetesSecret
+	err = json.NewDecoder(response.Body).Decode(&secret)
+	response.Body.Close()
+	if err != nil {
+		return fmt.Errorf("unable to parse the secret: %w", err)
+	}
+	if err = secretSigner.update(secret); err != nil && !secretSigner.setError(err) {
+		signerLog.warnf("unable to use the Kubernetes secret %s/%s: %s", secretSigner.namespace, secretSigner.name, err)
+	}
+
+	resourceVersion := secret.Metadata.ResourceVersion
+	for {
+		query := url.Values{
+			"fieldSelector":   {"metadata.name=" + secretSigner.name},
+			"watch":           {"true"},
+			"resourceVersion": {resourceVersion},
+			"timeoutSeconds":  {fmt.Sprint(int(kubernetesWatchTimeout.Seconds()))},
+		}
+		response, err := secretSigner.client.get(ctx, path, query)
+		if err != nil {
+			return err
+		}
+		resourceVersion, err = secretSigner.applyEvents(response.Body, resourceVersion)
+		response.Body.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Applies the events of a watch until it ends, and returns the last version
+// of the secret that it reported
+func (secretSigner *KubernetesSecretSigner) applyEvents(events io.Reader, resourceVersion string) (string, error) {
+	decoder := json.NewDecoder(events)
+	for {
+		var event kubernetesWatchEvent
+		if err := decoder.Decode(&event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return resourceVersion, nil
+			}
+			return resourceVersion, err
+		}
+		switch event.Type {
+		case "ADDED", "MODIFIED":
+			var secret kubernetesSecret
+			if err := json.Unmarshal(event.Object, &secret); err != nil {
+				return resourceVersion, fmt.Errorf("unable to parse the secret: %w", err)
+			}
+			resourceVersion = secret.Metadata.ResourceVersion
+			if err := secretSigner.update(secret); err != nil && !secretSigner.setError(err) {
+				signerLog.warnf("unable to use the Kubernetes secret %s/%s: %s", secretSigner.namespace, secretSigner.name, err)
+			}
+		case "DELETED":
+			signerLog.warnf("the Kubernetes secret %s/%s was deleted; its last identity is used until it's recreated",
+				secretSigner.namespace, secretSigner.name)
+		case "ERROR":
+			// Usually, the version of the secret is too old to watch from
+			// (410 Gone), so the secret is read again
+			var status kubernetesStatus
+			json.Unmarshal(event.Object, &status)
+			return resourceVersion, fmt.Errorf("the watch of the secret failed: %s", status.Message)
+		}
+	}
+}
+
+// Switches to the certificate and private key of the secret
+func (secretSigner *KubernetesSecretSigner) update(secret kubernetesSecret) error {
+	defer zeroizeBytes(secret.Data[kubernetesTLSPrivateKeyKey])
+	description := fmt.Sprintf("certificate of the Kubernetes secret %s/%s", secretSigner.namespace, secretSigner.name)
+	certificateData, keyData := secret.Data[kubernetesTLSCertificateKey], secret.Data[kubernetesTLSPrivateKeyKey]
+	if len(certificateData) == 0 || len(keyData) == 0 {
+		// cert-manager creates the secret before the certificate is issued
+		return fmt.Errorf("the Kubernetes secret %s/%s has no %s and %s yet", secretSigner.namespace, secretSigner.name,
+			kubernetesTLSCertificateKey, kubernetesTLSPrivateKeyKey)
+	}
+	certificates, err := parseCertificates(certificateData)
+	if err != nil {
+		return fmt.Errorf("unable to parse the %s: %w", description, err)
+	}
+	// Blocks other than the private key (such as EC PARAMETERS) are skipped
+	var block *pem.Block
+	for rest := keyData; ; {
+		if block, rest = pem.Decode(rest); block == nil || strings.HasSuffix(block.Type, "PRIVATE KEY") {
+			break
+		}
+	}
+	if block == nil {
+		return fmt.Errorf("no private key found in the Kubernetes secret %s/%s", secretSigner.namespace, secretSigner.name)
+	}
+	defer zeroizeBytes(block.Bytes)
+	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		if privateKey, err = ReadPrivateKeyDataFromPEMBlock(block); err != nil {
+			return fmt.Errorf("unable to parse the private key of the Kubernetes secret %s/%s: %w", secretSigner.namespace,
+				secretSigner.name, err)
+		}
+	}
+	var cas []*x509.Certificate
+	if caData := secret.Data[kubernetesCACertificateKey]; len(caData) > 0 {
+		if cas, err = parseCertificates(caData); err != nil {
+			signerLog.warnf("unable to parse the %s of the Kubernetes secret %s/%s: %s", kubernetesCACertificateKey,
+				secretSigner.namespace, secretSigner.name, err)
+		}
+	}
+	return secretSigner.rotate(certificates, privateKey, cas, description)
+}
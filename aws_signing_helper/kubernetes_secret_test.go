@@ -0,0 +1,149 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKubernetesSecretSigner(t *testing.T) {
+	readFile := func(path string) []byte {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	secretJSON := func(resourceVersion string, certificateFile string, privateKeyFile string, caFile string) []byte {
+		secret, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]string{"name": "identity", "namespace": "workloads", "resourceVersion": resourceVersion},
+			"type":     "kubernetes.io/tls",
+			"data": map[string][]byte{
+				"tls.crt": readFile(certificateFile),
+				"tls.key": readFile(privateKeyFile),
+				"ca.crt":  readFile(caFile),
+			},
+		})
+		return secret
+	}
+
+	// Fake API server, which serves the secret and then streams the events
+	// that are sent to the channel to its watches
+	events := make(chan []byte, 4)
+	apiServer := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer service-account-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.URL.Path == "/api/v1/namespaces/workloads/secrets/identity":
+			w.Write(secretJSON("1", "../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key.pem",
+				"../tst/certs/ec-prime256v1-sha256-cert.pem"))
+		case r.URL.Path == "/api/v1/namespaces/workloads/secrets" && r.URL.Query().Get("watch") == "true":
+			if r.URL.Query().Get("fieldSelector") != "metadata.name=identity" || r.URL.Query().Get("resourceVersion") == "" {
+				t.Log("unexpected watch of the secret:", r.URL.RawQuery)
+				t.Fail()
+			}
+			w.(http.Flusher).Flush()
+			for {
+				select {
+				case event := <-events:
+					w.Write(append(event, '\n'))
+					w.(http.Flusher).Flush()
+				case <-r.Context().Done():
+					return
+				}
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"kind":"Status","message":"secrets \"other\" not found","reason":"NotFound","code":404}`))
+		}
+	}))
+	defer apiServer.Close()
+
+	dir := t.TempDir()
+	defer func(dir string) { serviceAccountDir = dir }(serviceAccountDir)
+	serviceAccountDir = dir
+	os.WriteFile(filepath.Join(dir, "token"), []byte("service-account-token\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "namespace"), []byte("workloads"), 0600)
+	os.WriteFile(filepath.Join(dir, "ca.crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: apiServer.Certificate().Raw}), 0600)
+	apiURL, _ := url.Parse(apiServer.URL)
+	t.Setenv("KUBERNETES_SERVICE_HOST", apiURL.Hostname())
+	t.Setenv("KUBERNETES_SERVICE_PORT", apiURL.Port())
+
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	opts := CredentialsOpts{
+		KubernetesSecret:  "identity",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	_, expected, _ := ReadCertificateData("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if certificate, _ := signer.Certificate(); certificate == nil || !certificate.Equal(expected) {
+		t.Log("the signer doesn't use the certificate of the secret")
+		t.Fail()
+	}
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Log("unable to obtain credentials with the secret:", err)
+		t.Fail()
+	}
+
+	// Renewals are used as soon as they're written to the secret, and the
+	// chain is verified against the ca.crt of the secret
+	waitForCertificate := func(certificateFile string) {
+		_, expected, _ := ReadCertificateData(certificateFile)
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if certificate, _ := signer.Certificate(); certificate != nil && certificate.Equal(expected) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("the signer didn't switch to the renewed certificate", certificateFile)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	event := func(secret []byte) []byte {
+		data, _ := json.Marshal(map[string]interface{}{"type": "MODIFIED", "object": json.RawMessage(secret)})
+		return data
+	}
+	events <- event(secretJSON("2", "../tst/certs/ec-secp384r1-sha256-cert.pem", "../tst/certs/ec-secp384r1-key-pkcs8.pem",
+		"../tst/certs/ec-secp384r1-sha256-cert.pem"))
+	waitForCertificate("../tst/certs/ec-secp384r1-sha256-cert.pem")
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Log("unable to obtain credentials with the renewed certificate:", err)
+		t.Fail()
+	}
+	events <- event(secretJSON("3", "../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key.pem",
+		"../tst/certs/rsa-2048-sha256-cert.pem"))
+	waitForCertificate("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); !errors.Is(err, ErrUntrustedCertificate) {
+		t.Log("expected the chain to be verified against the ca.crt of the secret:", err)
+		t.Fail()
+	}
+
+	// Missing secrets are reported once the timeout passes
+	defer func(timeout time.Duration) { kubernetesSecretTimeout = timeout }(kubernetesSecretTimeout)
+	kubernetesSecretTimeout = 500 * time.Millisecond
+	opts.KubernetesSecret = "workloads/other"
+	if _, _, err = GetSigner(&opts); err == nil || !strings.Contains(err.Error(), "secrets \"other\" not found") {
+		t.Log("unexpected error for a missing secret:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,26 @@
+package aws_signing_helper
+
+// Copies the private key material into memory that's locked into RAM (see
+// allocLockedMemory), and zeroizes the original. If the memory can't be
+// locked (for example, because RLIMIT_MEMLOCK is too low), the original is
+// returned, so that the key can still be used.
+func lockedCopy(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+	memory, err := allocLockedMemory(len(data))
+	if err != nil {
+		signerLog.debugf("unable to lock the memory of private key material: %s", err)
+		return data
+	}
+	copy(memory, data)
+	zeroizeBytes(data)
+	return memory
+}
+
+// Stops the process from writing core dumps (or, on Windows, crash dumps),
+// which would contain private key material that's in memory. It's meant to be
+// called by long-running processes, such as the serve and update commands.
+func DisableCoreDumps() error {
+	return disableCoreDumps()
+}
@@ -0,0 +1,19 @@
+//go:build linux
+
+package aws_signing_helper
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Excludes the memory from core dumps. This is best effort, since the memory
+// is also locked, and core dumps are disabled in daemon modes.
+func excludeFromCoreDumps(memory []byte) {
+	unix.Madvise(memory, unix.MADV_DONTDUMP)
+}
+
+// Marks the process as not dumpable, which also stops other processes of the
+// same user from attaching to it with ptrace
+func setNotDumpable() error {
+	return unix.Prctl(unix.PR_SET_DUMPABLE, 0, 0, 0, 0)
+}
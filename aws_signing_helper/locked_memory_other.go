@@ -0,0 +1,33 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Allocates memory outside of the Go heap, and locks it into RAM, so that it
+// isn't written to swap. The memory is also excluded from core dumps, where
+// the platform supports it.
+func allocLockedMemory(size int) ([]byte, error) {
+	memory, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, err
+	}
+	if err = unix.Mlock(memory); err != nil {
+		unix.Munmap(memory)
+		return nil, err
+	}
+	excludeFromCoreDumps(memory)
+	return memory, nil
+}
+
+// Stops the process from writing core dumps, by setting RLIMIT_CORE to zero
+// (and, on Linux, by marking the process as not dumpable, since core dumps
+// that are piped to a handler such as systemd-coredump ignore RLIMIT_CORE)
+func disableCoreDumps() error {
+	if err := unix.Setrlimit(unix.RLIMIT_CORE, &unix.Rlimit{Cur: 0, Max: 0}); err != nil {
+		return err
+	}
+	return setNotDumpable()
+}
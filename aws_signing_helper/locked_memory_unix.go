@@ -0,0 +1,11 @@
+//go:build !windows && !linux
+
+package aws_signing_helper
+
+// Other Unix-like systems don't have a portable way to exclude memory from
+// core dumps, so RLIMIT_CORE is relied on instead
+func excludeFromCoreDumps(memory []byte) {}
+
+func setNotDumpable() error {
+	return nil
+}
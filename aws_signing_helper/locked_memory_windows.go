@@ -0,0 +1,40 @@
+//go:build windows
+
+package aws_signing_helper
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var procWerRegisterExcludedMemoryBlock = windows.NewLazySystemDLL("kernel32.dll").NewProc("WerRegisterExcludedMemoryBlock")
+
+// Allocates memory outside of the Go heap, and locks it into RAM, so that it
+// isn't written to the page file. The memory is also excluded from Windows
+// Error Reporting dumps, where the version of Windows supports it.
+func allocLockedMemory(size int) ([]byte, error) {
+	address, err := windows.VirtualAlloc(0, uintptr(size), windows.MEM_COMMIT|windows.MEM_RESERVE, windows.PAGE_READWRITE)
+	if err != nil {
+		return nil, err
+	}
+	if err = windows.VirtualLock(address, uintptr(size)); err != nil {
+		windows.VirtualFree(address, 0, windows.MEM_RELEASE)
+		return nil, err
+	}
+	if procWerRegisterExcludedMemoryBlock.Find() == nil {
+		procWerRegisterExcludedMemoryBlock.Call(address, uintptr(size))
+	}
+	// The address is converted through a pointer to it, since the memory
+	// isn't managed by the Go runtime
+	return unsafe.Slice((*byte)(*(*unsafe.Pointer)(unsafe.Pointer(&address))), size), nil
+}
+
+// Stops Windows Error Reporting from handling crashes of the process (and
+// collecting dumps of it). The Go runtime sets the same error mode, unless
+// GOTRACEBACK=wer is set.
+func disableCoreDumps() error {
+	mode := windows.SetErrorMode(0)
+	windows.SetErrorMode(mode | windows.SEM_FAILCRITICALERRORS | windows.SEM_NOGPFAULTERRORBOX | windows.SEM_NOOPENFILEERRORBOX)
+	return nil
+}
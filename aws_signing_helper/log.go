@@ -0,0 +1,288 @@
+package aws_signing_helper
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Severity of log messages. Messages below the configured level aren't
+// logged.
+type LogLevel int
+
+const (
+	LogLevelDebug LogLevel = iota
+	LogLevelInfo
+	LogLevelWarn
+	LogLevelError
+)
+
+var logLevelNames = map[LogLevel]string{
+	LogLevelDebug: "debug",
+	LogLevelInfo:  "info",
+	LogLevelWarn:  "warn",
+	LogLevelError: "error",
+}
+
+var logLevel = LogLevelInfo
+
+// Formats of log messages
+const (
+	// Lines of the standard log package, with the date and time
+	LogFormatText = "text"
+	// JSON objects, one per line, with the time, level, and message, and the
+	// component that logged them and the role ARN, certificate fingerprint,
+	// and request ID that they concern
+	LogFormatJSON = "json"
+)
+
+var logFormat = LogFormatText
+
+// Fields of JSON log messages
+type logRecord struct {
+	Time    string `json:"time"`
+	Level   string `json:"level"`
+	Message string `json:"msg"`
+	logFields
+}
+
+// Fields that describe what a log message concerns
+type logFields struct {
+	// Component that logged the message (see componentLogger)
+	Component string `json:"component,omitempty"`
+	RoleArn   string `json:"roleArn,omitempty"`
+	// Hex-encoded SHA-256 hash of the DER-encoded certificate
+	CertificateFingerprint string `json:"certificateFingerprint,omitempty"`
+	// ID of the Roles Anywhere request
+	RequestId string `json:"requestId,omitempty"`
+	// Correlation ID of the credential request (see WithCorrelationId)
+	CorrelationId string `json:"correlationId,omitempty"`
+}
+
+// Role and certificate that credentials were last requested for, which
+// JSON log messages include, and the correlation ID of the request that's in
+// progress, which all log messages include
+var logIdentity atomic.Pointer[logFields]
+
+// Serializes log messages that are written without the log package (JSON
+// messages, and those of logDestination)
+var logOutput sync.Mutex
+
+func (level LogLevel) String() string {
+	return logLevelNames[level]
+}
+
+// Returns the names of the log levels, from most to least verbose
+func LogLevelNames() []string {
+	return []string{"debug", "info", "warn", "error"}
+}
+
+// Parses the name of a log level (such as "warn")
+func ParseLogLevel(name string) (LogLevel, error) {
+	for level, levelName := range logLevelNames {
+		if strings.EqualFold(name, levelName) {
+			return level, nil
+		}
+	}
+	return LogLevelInfo, fmt.Errorf("invalid log level %s; must be one of %s", name, strings.Join(LogLevelNames(), ", "))
+}
+
+// Sets the minimum level of the messages that are logged. Debug messages are
+// also logged if Debug is set.
+func SetLogLevel(level LogLevel) {
+	logLevel = level
+}
+
+// Returns whether messages at the specified level are logged
+func LogEnabled(level LogLevel) bool {
+	return generalLog.enabled(level)
+}
+
+// Components whose messages can be logged at a level of their own
+const (
+	// Signers and the identity material that they read
+	LogComponentSigner = "signer"
+	// Connections to Roles Anywhere, and the calls of the AWS SDK
+	LogComponentTransport = "transport"
+	// Caches of credentials and CRLs
+	LogComponentCache = "cache"
+	// Local server of the serve command
+	LogComponentServer = "server"
+)
+
+// Logger of a component, whose messages are logged at the level of the
+// component, if one was set, and at the general level otherwise. The general
+// logger has no component.
+type componentLogger string
+
+const (
+	generalLog   componentLogger = ""
+	signerLog    componentLogger = LogComponentSigner
+	transportLog componentLogger = LogComponentTransport
+	cacheLog     componentLogger = LogComponentCache
+	serverLog    componentLogger = LogComponentServer
+)
+
+// Levels of the components that don't log at the general level
+var componentLogLevels = map[componentLogger]LogLevel{}
+
+// Returns the names of the components whose level can be set
+func LogComponentNames() []string {
+	return []string{LogComponentSigner, LogComponentTransport, LogComponentCache, LogComponentServer}
+}
+
+// Sets the minimum level of the messages of the component (one of
+// LogComponentNames) that are logged, regardless of the general level
+func SetComponentLogLevel(component string, level LogLevel) error {
+	for _, name := range LogComponentNames() {
+		if strings.EqualFold(component, name) {
+			componentLogLevels[componentLogger(name)] = level
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid log component %s; must be one of %s", component, strings.Join(LogComponentNames(), ", "))
+}
+
+func (c componentLogger) enabled(level LogLevel) bool {
+	if level == LogLevelDebug && Debug {
+		return true
+	}
+	if componentLevel, ok := componentLogLevels[c]; ok {
+		return level >= componentLevel
+	}
+	return level >= logLevel
+}
+
+func (c componentLogger) debugf(format string, v ...interface{}) {
+	logFieldsf(LogLevelDebug, logFields{Component: string(c)}, format, v...)
+}
+
+func (c componentLogger) infof(format string, v ...interface{}) {
+	logFieldsf(LogLevelInfo, logFields{Component: string(c)}, format, v...)
+}
+
+func (c componentLogger) warnf(format string, v ...interface{}) {
+	logFieldsf(LogLevelWarn, logFields{Component: string(c)}, format, v...)
+}
+
+func (c componentLogger) errorf(format string, v ...interface{}) {
+	logFieldsf(LogLevelError, logFields{Component: string(c)}, format, v...)
+}
+
+// Sets the format of log messages (LogFormatText or LogFormatJSON)
+func SetLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("invalid log format %s; must be one of %s and %s", format, LogFormatText, LogFormatJSON)
+	}
+	logFormat = format
+	return nil
+}
+
+func logf(level LogLevel, format string, v ...interface{}) {
+	logFieldsf(level, logFields{}, format, v...)
+}
+
+// Logs the message, with the fields (and those of logIdentity) if messages
+// are logged as JSON
+func logFieldsf(level LogLevel, fields logFields, format string, v ...interface{}) {
+	if !componentLogger(fields.Component).enabled(level) {
+		return
+	}
+	message := Redact(fmt.Sprintf(format, v...))
+	record := logRecord{Time: time.Now().UTC().Format(time.RFC3339Nano), Level: level.String(), Message: message,
+		logFields: fields}
+	if identity := logIdentity.Load(); identity != nil {
+		record.RoleArn = identity.RoleArn
+		record.CertificateFingerprint = identity.CertificateFingerprint
+		if record.CorrelationId == "" {
+			record.CorrelationId = identity.CorrelationId
+		}
+	}
+	line := message
+	if record.CorrelationId != "" {
+		line = "[" + record.CorrelationId + "] " + message
+	}
+	if logFormat == LogFormatJSON {
+		encoded, _ := json.Marshal(record)
+		line = string(encoded)
+	}
+
+	logOutput.Lock()
+	defer logOutput.Unlock()
+	if logDestination != nil && logDestination.write(level, record, line) == nil {
+		return
+	}
+	if logFormat != LogFormatJSON {
+		log.Print(line)
+		return
+	}
+	log.Writer().Write([]byte(line + "\n"))
+}
+
+// Records the role and certificate that credentials are requested for, so
+// that JSON log messages (and journal entries) include them, and the
+// correlation ID of the request, until it's cleared
+func setLogIdentity(opts *CredentialsOpts, signer Signer, correlationId string) {
+	fields := logFields{RoleArn: opts.RoleArn, CorrelationId: correlationId}
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		fingerprint := sha256.Sum256(certificate.Raw)
+		fields.CertificateFingerprint = hex.EncodeToString(fingerprint[:])
+	}
+	logIdentity.Store(&fields)
+}
+
+// Clears the correlation ID of the request that completed from log messages
+func clearLogCorrelationId() {
+	if identity := logIdentity.Load(); identity != nil {
+		fields := *identity
+		fields.CorrelationId = ""
+		logIdentity.Store(&fields)
+	}
+}
+
+// Logs the error that caused an operation to fail, with the ID of the Roles
+// Anywhere request that returned it (if one did) and the correlation ID of
+// the credential request (if it's known)
+func LogError(err error) {
+	fields := logFields{RequestId: ErrorRequestId(err), CorrelationId: ErrorCorrelationId(err)}
+	logFieldsf(LogLevelError, fields, "%s", err)
+}
+
+// Logger for the errors of HTTP servers (such as the panics of their
+// handlers), which logs them as other messages are
+func serverErrorLog() *log.Logger {
+	return log.New(serverErrorWriter{}, "", 0)
+}
+
+type serverErrorWriter struct{}
+
+func (serverErrorWriter) Write(p []byte) (int, error) {
+	LogErrorf("%s", strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
+
+// Logs details that are only useful when troubleshooting
+func LogDebugf(format string, v ...interface{}) {
+	logf(LogLevelDebug, format, v...)
+}
+
+// Logs the progress of long-running commands (such as serve and update)
+func LogInfof(format string, v ...interface{}) {
+	logf(LogLevelInfo, format, v...)
+}
+
+// Logs problems that the credential helper recovered from
+func LogWarnf(format string, v ...interface{}) {
+	logf(LogLevelWarn, format, v...)
+}
+
+// Logs problems that caused an operation to fail
+func LogErrorf(format string, v ...interface{}) {
+	logf(LogLevelError, format, v...)
+}
@@ -0,0 +1,73 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+// Destinations of log messages
+const (
+	LogTargetStderr   = "stderr"
+	LogTargetFile     = "file"
+	LogTargetSyslog   = "syslog"
+	LogTargetJournald = "journald"
+)
+
+// Identifier of the process in syslog and the journal
+const logTargetIdentifier = "aws_signing_helper"
+
+// Destination of log messages other than the writer of the log package
+// (stderr, or a file), such as syslog or the journal
+type logSink interface {
+	// Writes the message, which is line in the configured format. Messages
+	// are written to the writer of the log package instead if it fails.
+	write(level LogLevel, record logRecord, line string) error
+}
+
+// Destination of log messages, or nil if they're written with the log package
+var logDestination logSink
+
+// Returns the names of the destinations of log messages
+func LogTargetNames() []string {
+	return []string{LogTargetStderr, LogTargetFile, LogTargetSyslog, LogTargetJournald}
+}
+
+// Sets the destination of log messages: stderr (the default), a file (which
+// is appended to), syslog, or the systemd journal. The path is only used
+// for files.
+func SetLogTarget(target string, path string) error {
+	target = strings.ToLower(target)
+	if (target == LogTargetFile) != (path != "") {
+		return fmt.Errorf("the log file is required for (and only used by) the %s log target", LogTargetFile)
+	}
+	switch target {
+	case LogTargetStderr:
+		log.SetOutput(os.Stderr)
+		logDestination = nil
+	case LogTargetFile:
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			return fmt.Errorf("unable to open the log file: %w", err)
+		}
+		RepairOwnerOnlyPermissions(path)
+		log.SetOutput(file)
+		logDestination = nil
+	case LogTargetSyslog:
+		sink, err := newSyslogSink()
+		if err != nil {
+			return fmt.Errorf("unable to connect to syslog: %w", err)
+		}
+		logDestination = sink
+	case LogTargetJournald:
+		sink, err := newJournaldSink()
+		if err != nil {
+			return fmt.Errorf("unable to connect to the journal: %w", err)
+		}
+		logDestination = sink
+	default:
+		return fmt.Errorf("invalid log target %s; must be one of %s", target, strings.Join(LogTargetNames(), ", "))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log/syslog"
+	"net"
+	"strings"
+)
+
+// Socket of the native protocol of the systemd journal
+var journaldSocket = "/run/systemd/journal/socket"
+
+// Writes log messages to the local syslog daemon, at the priority of their
+// level (in the daemon facility)
+type syslogSink struct {
+	writer *syslog.Writer
+}
+
+func newSyslogSink() (logSink, error) {
+	writer, err := syslog.New(syslog.LOG_DAEMON|syslog.LOG_INFO, logTargetIdentifier)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogSink{writer}, nil
+}
+
+func (sink *syslogSink) write(level LogLevel, record logRecord, line string) error {
+	switch level {
+	case LogLevelDebug:
+		return sink.writer.Debug(line)
+	case LogLevelInfo:
+		return sink.writer.Info(line)
+	case LogLevelWarn:
+		return sink.writer.Warning(line)
+	default:
+		return sink.writer.Err(line)
+	}
+}
+
+// Writes log messages to the systemd journal, through its native protocol,
+// with the fields of the message (such as the role ARN) as journal fields,
+// so that they can be filtered on with journalctl
+type journaldSink struct {
+	conn *net.UnixConn
+}
+
+func newJournaldSink() (logSink, error) {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journaldSink{conn}, nil
+}
+
+// Syslog priorities of the log levels
+var journaldPriorities = map[LogLevel]string{
+	LogLevelDebug: "7",
+	LogLevelInfo:  "6",
+	LogLevelWarn:  "4",
+	LogLevelError: "3",
+}
+
+func (sink *journaldSink) write(level LogLevel, record logRecord, line string) error {
+	var entry bytes.Buffer
+	for _, field := range [][2]string{
+		{"MESSAGE", line},
+		{"PRIORITY", journaldPriorities[level]},
+		{"SYSLOG_IDENTIFIER", logTargetIdentifier},
+		{"COMPONENT", record.Component},
+		{"ROLE_ARN", record.RoleArn},
+		{"CERTIFICATE_FINGERPRINT", record.CertificateFingerprint},
+		{"REQUEST_ID", record.RequestId},
+		{"CORRELATION_ID", record.CorrelationId},
+	} {
+		writeJournaldField(&entry, field[0], field[1])
+	}
+	_, err := sink.conn.Write(entry.Bytes())
+	return err
+}
+
+// Appends the field to the entry. Values with newlines are length-prefixed,
+// as the protocol requires. Empty values are left out.
+func writeJournaldField(entry *bytes.Buffer, name string, value string) {
+	if value == "" {
+		return
+	}
+	entry.WriteString(name)
+	if !strings.Contains(value, "\n") {
+		entry.WriteByte('=')
+		entry.WriteString(value)
+	} else {
+		entry.WriteByte('\n')
+		binary.Write(entry, binary.LittleEndian, uint64(len(value)))
+		entry.WriteString(value)
+	}
+	entry.WriteByte('\n')
+}
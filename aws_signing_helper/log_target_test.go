@@ -0,0 +1,68 @@
+package aws_signing_helper
+
+import (
+	"encoding/binary"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogTargets(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the journal isn't available on Windows")
+	}
+	defer SetLogTarget(LogTargetStderr, "")
+	logIdentity.Store(nil)
+
+	path := filepath.Join(t.TempDir(), "helper.log")
+	if err := SetLogTarget(LogTargetFile, path); err != nil {
+		t.Fatal(err)
+	}
+	LogWarnf("written to the file")
+	if data, err := os.ReadFile(path); err != nil || !strings.Contains(string(data), "written to the file") {
+		t.Errorf("the message wasn't written to the log file: %q, %v", data, err)
+	}
+	if err := SetLogTarget(LogTargetFile, ""); err == nil {
+		t.Error("the file target was accepted without a file")
+	}
+	if err := SetLogTarget("eventlog", ""); err == nil {
+		t.Error("an unknown log target was accepted")
+	}
+
+	// Unix socket paths are limited to about 100 bytes, which temporary
+	// directories of tests may exceed
+	dir, err := os.MkdirTemp("", "journal")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(socket string) { journaldSocket = socket }(journaldSocket)
+	journaldSocket = filepath.Join(dir, "socket")
+	journal, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: journaldSocket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer journal.Close()
+	if err = SetLogTarget(LogTargetJournald, ""); err != nil {
+		t.Fatal(err)
+	}
+	logFieldsf(LogLevelWarn, logFields{Component: LogComponentCache, RequestId: "request"}, "first line\nsecond line")
+	entry := make([]byte, 4096)
+	journal.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := journal.Read(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := "first line\nsecond line"
+	length := make([]byte, 8)
+	binary.LittleEndian.PutUint64(length, uint64(len(message)))
+	expected := "MESSAGE\n" + string(length) + message + "\nPRIORITY=4\nSYSLOG_IDENTIFIER=aws_signing_helper\n" +
+		"COMPONENT=cache\nREQUEST_ID=request\n"
+	if string(entry[:n]) != expected {
+		t.Errorf("unexpected journal entry: %q", entry[:n])
+	}
+}
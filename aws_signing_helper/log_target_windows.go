@@ -0,0 +1,16 @@
+//go:build windows
+
+package aws_signing_helper
+
+import "errors"
+
+// Path of the socket of the systemd journal, which Windows doesn't have
+var journaldSocket string
+
+func newSyslogSink() (logSink, error) {
+	return nil, errors.New("syslog isn't available on Windows")
+}
+
+func newJournaldSink() (logSink, error) {
+	return nil, errors.New("the systemd journal isn't available on Windows")
+}
@@ -0,0 +1,138 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetLogLevel(LogLevelInfo)
+
+	level, err := ParseLogLevel("WARN")
+	if err != nil || level != LogLevelWarn {
+		t.Fatal("unable to parse log level:", err)
+	}
+	if _, err = ParseLogLevel("verbose"); err == nil {
+		t.Log("expected invalid log level to be rejected")
+		t.Fail()
+	}
+
+	SetLogLevel(level)
+	LogDebugf("debug message")
+	LogInfof("info message")
+	LogWarnf("warn message")
+	LogErrorf("error message")
+	output := buf.String()
+	for message, expected := range map[string]bool{
+		"debug message": false,
+		"info message":  false,
+		"warn message":  true,
+		"error message": true,
+	} {
+		if strings.Contains(output, message) != expected {
+			t.Logf("unexpected output for %q at level warn: %s", message, output)
+			t.Fail()
+		}
+	}
+}
+
+func TestJSONLogs(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	if err := SetLogFormat(LogFormatJSON); err != nil {
+		t.Fatal(err)
+	}
+	defer SetLogFormat(LogFormatText)
+	defer logIdentity.Store(nil)
+
+	opts := CredentialsOpts{
+		PrivateKeyId:  "../credential-process-data/client-key.pem",
+		CertificateId: "../credential-process-data/client-cert.pem",
+		RoleArn:       "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+	}
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	certificate, _ := signer.Certificate()
+	fingerprint := sha256.Sum256(certificate.Raw)
+
+	setLogIdentity(&opts, signer, "")
+	LogError(&awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusForbidden}},
+			Err:      errors.New("access denied"),
+		},
+		RequestID: "f2e2b3e1-0000-4000-8000-000000000000",
+	})
+	var record logRecord
+	if err = json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log message isn't a JSON object: %s (%s)", buf.String(), err)
+	}
+	if record.Level != "error" || !strings.Contains(record.Message, "access denied") ||
+		record.RoleArn != opts.RoleArn || record.CertificateFingerprint != hex.EncodeToString(fingerprint[:]) ||
+		record.RequestId != "f2e2b3e1-0000-4000-8000-000000000000" {
+		t.Errorf("unexpected log message: %s", buf.String())
+	}
+	if _, err = time.Parse(time.RFC3339Nano, record.Time); err != nil {
+		t.Error("unexpected time:", record.Time)
+	}
+
+	if err = SetLogFormat("xml"); err == nil {
+		t.Error("unsupported log format was accepted")
+	}
+}
+
+func TestComponentLogLevels(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	SetLogLevel(LogLevelWarn)
+	defer SetLogLevel(LogLevelInfo)
+	defer clear(componentLogLevels)
+
+	if err := SetComponentLogLevel("Signer", LogLevelDebug); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetComponentLogLevel(LogComponentServer, LogLevelError); err != nil {
+		t.Fatal(err)
+	}
+	signerLog.debugf("signer debug")
+	transportLog.debugf("transport debug")
+	transportLog.warnf("transport warn")
+	serverLog.warnf("server warn")
+	LogInfof("general info")
+	output := buf.String()
+	for message, logged := range map[string]bool{
+		"signer debug":    true,
+		"transport debug": false,
+		"transport warn":  true,
+		"server warn":     false,
+		"general info":    false,
+	} {
+		if strings.Contains(output, message) != logged {
+			t.Errorf("%q was logged: %t", message, !logged)
+		}
+	}
+
+	if err := SetComponentLogLevel("tpm", LogLevelDebug); err == nil {
+		t.Error("unknown log component was accepted")
+	}
+}
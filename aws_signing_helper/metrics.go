@@ -0,0 +1,110 @@
+package aws_signing_helper
+
+import (
+	"expvar"
+	"sync"
+)
+
+// Names of the metrics that MetricsHooks records
+const (
+	// Counters of the credentials that were obtained from CreateSession, and
+	// of the calls that failed
+	MetricRefreshes       = "refreshes"
+	MetricRefreshFailures = "refresh_failures"
+	// Gauge of how long the last CreateSession call (including signing)
+	// took, in seconds, and counter of how long all of them took, in
+	// milliseconds
+	MetricRefreshDurationSeconds     = "refresh_duration_seconds"
+	MetricRefreshDurationMillisTotal = "refresh_duration_millis_total"
+	// Gauge of when the last credentials expire, in seconds since the epoch
+	MetricCredentialsExpiration = "credentials_expiration_seconds"
+	// Counter of the signatures made with the private key, and gauge of how
+	// long the last one took, in seconds
+	MetricSignatures          = "signatures"
+	MetricSignDurationSeconds = "sign_duration_seconds"
+	// Counters of the credentials that were returned from the credential
+	// cache, and of the failures of the cache
+	MetricCacheHits     = "cache_hits"
+	MetricCacheFailures = "cache_failures"
+	// Gauge of how long the certificate is still valid for, in seconds, once
+	// it's within CredentialsOpts.CertificateExpiryWarningWindow
+	MetricCertificateRemainingSeconds = "certificate_remaining_seconds"
+)
+
+// Counters and gauges that the library records metrics with (see
+// MetricsHooks), so that applications that embed it can surface refreshes,
+// their failures, and their latencies in their own metrics systems. They
+// may be called concurrently.
+type Metrics interface {
+	// Adds the delta to the counter
+	AddCounter(name string, delta int64)
+	// Sets the gauge to the value
+	SetGauge(name string, value float64)
+}
+
+// Returns hooks that record the events of the library in the metrics, and
+// then call the hooks (whose callbacks can be nil)
+func MetricsHooks(metrics Metrics, hooks Hooks) Hooks {
+	return Hooks{
+		OnRefresh: func(event RefreshEvent) {
+			metrics.AddCounter(MetricRefreshes, 1)
+			metrics.SetGauge(MetricRefreshDurationSeconds, event.Duration.Seconds())
+			metrics.AddCounter(MetricRefreshDurationMillisTotal, event.Duration.Milliseconds())
+			metrics.SetGauge(MetricCredentialsExpiration, float64(event.Expiration.Unix()))
+			hooks.refreshed(event)
+		},
+		OnSign: func(event SignEvent) {
+			metrics.AddCounter(MetricSignatures, 1)
+			metrics.SetGauge(MetricSignDurationSeconds, event.Duration.Seconds())
+			hooks.signed(event)
+		},
+		OnError: func(event ErrorEvent) {
+			switch event.Operation {
+			case OperationCreateSession:
+				metrics.AddCounter(MetricRefreshFailures, 1)
+			case OperationCredentialCache:
+				metrics.AddCounter(MetricCacheFailures, 1)
+			}
+			hooks.failed(event)
+		},
+		OnCacheHit: func(event CacheHitEvent) {
+			metrics.AddCounter(MetricCacheHits, 1)
+			hooks.cacheHit(event)
+		},
+		OnCertificateExpiring: func(event CertificateExpiryEvent) {
+			metrics.SetGauge(MetricCertificateRemainingSeconds, event.Remaining.Seconds())
+			hooks.certificateExpiring(event)
+		},
+	}
+}
+
+// Metrics that are published through expvar, as a map with the name (which
+// is served under /debug/vars by expvar's handler)
+type expvarMetrics struct {
+	values *expvar.Map
+}
+
+// Serializes the creation of expvar maps, since expvar panics on names that
+// are published twice
+var expvarMetricsMu sync.Mutex
+
+// Returns metrics that publish their values through expvar, as a map with
+// the name. Metrics with the same name share the map.
+func NewExpvarMetrics(name string) Metrics {
+	expvarMetricsMu.Lock()
+	defer expvarMetricsMu.Unlock()
+	if values, ok := expvar.Get(name).(*expvar.Map); ok {
+		return expvarMetrics{values}
+	}
+	return expvarMetrics{expvar.NewMap(name)}
+}
+
+func (m expvarMetrics) AddCounter(name string, delta int64) {
+	m.values.Add(name, delta)
+}
+
+func (m expvarMetrics) SetGauge(name string, value float64) {
+	gauge := new(expvar.Float)
+	gauge.Set(value)
+	m.values.Set(name, gauge)
+}
@@ -0,0 +1,57 @@
+package aws_signing_helper
+
+import (
+	"testing"
+)
+
+func TestMetricsHooks(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	var refreshes int
+	metrics := NewExpvarMetrics("rolesanywhere_test_metrics")
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+		Hooks:             MetricsHooks(metrics, Hooks{OnRefresh: func(RefreshEvent) { refreshes++ }}),
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err == nil {
+		t.Fatal("expected CreateSession to fail")
+	}
+
+	values := metrics.(expvarMetrics).values
+	for name, expected := range map[string]string{
+		MetricRefreshes:       "1",
+		MetricRefreshFailures: "1",
+		MetricSignatures:      "2",
+	} {
+		if value := values.Get(name); value == nil || value.String() != expected {
+			t.Errorf("unexpected value of %s: %v", name, value)
+		}
+	}
+	if values.Get(MetricRefreshDurationSeconds) == nil || values.Get(MetricCredentialsExpiration) == nil {
+		t.Error("gauges weren't recorded")
+	}
+	if refreshes != 1 {
+		t.Error("the hooks weren't called:", refreshes)
+	}
+	if NewExpvarMetrics("rolesanywhere_test_metrics").(expvarMetrics).values != values {
+		t.Error("metrics with the same name didn't share their map")
+	}
+}
@@ -0,0 +1,217 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+// Types of the MQTT 3.1.1 control packets that the client sends and receives
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttSubscribe  = 8
+	mqttSuback     = 9
+	mqttDisconnect = 14
+)
+
+// Seconds after which the broker closes connections that are idle. Sessions
+// end long before, since they only last for a few requests.
+const mqttKeepAlive = 60
+
+// Largest packet that's read (AWS IoT Core allows 128 KB)
+const mqttMaxPacketSize = 128 << 10
+
+// Minimal MQTT 3.1.1 client, for the request and response exchanges of AWS
+// IoT Core (such as those of fleet provisioning): messages are published
+// with QoS 0, and subscriptions are made with QoS 0
+type mqttClient struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetId uint16
+}
+
+// Message that was published on a topic that the client subscribed to
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// Connects to the MQTT broker at the address over TLS, with the client ID.
+// The connection is closed once the context is done.
+func dialMQTT(ctx context.Context, address string, tlsConfig *tls.Config, clientId string) (*mqttClient, error) {
+	dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: 10 * time.Second}, Config: tlsConfig}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unable to connect to %s: %w", ErrEndpointUnreachable, address, err)
+	}
+	context.AfterFunc(ctx, func() { conn.Close() })
+	client := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+
+	var connect []byte
+	connect = appendMQTTString(connect, "MQTT")
+	// Protocol level 4 (3.1.1), with a clean session
+	connect = append(connect, 4, 0x02)
+	connect = binary.BigEndian.AppendUint16(connect, mqttKeepAlive)
+	connect = appendMQTTString(connect, clientId)
+	if err = client.write(mqttConnect<<4, connect); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	packetType, _, body, err := client.read()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if packetType != mqttConnack || len(body) != 2 {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected MQTT packet of type %d instead of CONNACK", packetType)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return nil, fmt.Errorf("the MQTT broker refused the connection (return code %d)", body[1])
+	}
+	return client, nil
+}
+
+// Subscribes to the topics, and waits for the broker to acknowledge them
+func (client *mqttClient) subscribe(topics ...string) error {
+	client.packetId++
+	packetId := client.packetId
+	subscribe := binary.BigEndian.AppendUint16(nil, packetId)
+	for _, topic := range topics {
+		subscribe = appendMQTTString(subscribe, topic)
+		subscribe = append(subscribe, 0)
+	}
+	if err := client.write(mqttSubscribe<<4|0x02, subscribe); err != nil {
+		return err
+	}
+	for {
+		packetType, _, body, err := client.read()
+		if err != nil {
+			return err
+		}
+		if packetType != mqttSuback || len(body) < 2 || binary.BigEndian.Uint16(body) != packetId {
+			continue
+		}
+		for i, code := range body[2:] {
+			if code&0x80 != 0 && i < len(topics) {
+				return fmt.Errorf("the MQTT broker refused the subscription to %s", topics[i])
+			}
+		}
+		return nil
+	}
+}
+
+// Publishes the payload on the topic
+func (client *mqttClient) publish(topic string, payload []byte) error {
+	return client.write(mqttPublish<<4, append(appendMQTTString(nil, topic), payload...))
+}
+
+// Waits for the next message on the topics that the client subscribed to
+func (client *mqttClient) next() (mqttMessage, error) {
+	for {
+		packetType, flags, body, err := client.read()
+		if err != nil {
+			return mqttMessage{}, err
+		}
+		if packetType != mqttPublish {
+			continue
+		}
+		qos := flags >> 1 & 0x03
+		topic, rest, err := readMQTTString(body)
+		if err != nil {
+			return mqttMessage{}, err
+		}
+		if qos > 0 {
+			if len(rest) < 2 {
+				return mqttMessage{}, errors.New("invalid MQTT PUBLISH packet")
+			}
+			if err = client.write(mqttPuback<<4, rest[:2]); err != nil {
+				return mqttMessage{}, err
+			}
+			rest = rest[2:]
+		}
+		return mqttMessage{Topic: topic, Payload: rest}, nil
+	}
+}
+
+// Disconnects from the broker, and closes the connection
+func (client *mqttClient) Close() error {
+	client.write(mqttDisconnect<<4, nil)
+	return client.conn.Close()
+}
+
+// Writes the packet with the first byte of the fixed header (the type and
+// flags) and the body
+func (client *mqttClient) write(header byte, body []byte) error {
+	packet := []byte{header}
+	for length := len(body); ; {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	_, err := client.conn.Write(append(packet, body...))
+	return err
+}
+
+// Reads the next packet, and returns its type, the flags of its fixed header,
+// and its body
+func (client *mqttClient) read() (packetType byte, flags byte, body []byte, err error) {
+	header, err := client.reader.ReadByte()
+	if err != nil {
+		return 0, 0, nil, fmt.Errorf("the MQTT connection was closed: %w", err)
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := client.reader.ReadByte()
+		if err != nil {
+			return 0, 0, nil, fmt.Errorf("the MQTT connection was closed: %w", err)
+		}
+		length += int(digit&0x7F) * multiplier
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, 0, nil, errors.New("invalid MQTT packet length")
+		}
+		multiplier *= 128
+	}
+	if length > mqttMaxPacketSize {
+		return 0, 0, nil, fmt.Errorf("MQTT packet of %d bytes is too large", length)
+	}
+	body = make([]byte, length)
+	if _, err = io.ReadFull(client.reader, body); err != nil {
+		return 0, 0, nil, fmt.Errorf("the MQTT connection was closed: %w", err)
+	}
+	return header >> 4, header & 0x0F, body, nil
+}
+
+// Appends the length-prefixed UTF-8 string
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// Reads a length-prefixed UTF-8 string, and returns what follows it
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 || len(b) < 2+int(binary.BigEndian.Uint16(b)) {
+		return "", nil, errors.New("invalid MQTT string")
+	}
+	length := int(binary.BigEndian.Uint16(b))
+	return string(b[2 : 2+length]), b[2+length:], nil
+}
@@ -0,0 +1,98 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Whether the OCSP responder of the certificate is queried before
+// CreateSession is called, and what happens if the certificate is revoked
+const (
+	// The OCSP responder isn't queried
+	OCSPCheckOff = revocationCheckOff
+	// A warning is logged if the certificate is revoked
+	OCSPCheckWarn = revocationCheckWarn
+	// An error is returned if the certificate is revoked
+	OCSPCheckEnforce = revocationCheckEnforce
+)
+
+// Responses of OCSP responders, by the serial number and issuer of the
+// certificate, which are reused until their NextUpdate time, so that the
+// responder isn't queried on each refresh
+var ocspResponses struct {
+	sync.Mutex
+	responses map[string]*ocsp.Response
+}
+
+// Queries the OCSP responder of the certificate, and returns an error that
+// wraps ErrCertificateRevoked if the certificate has been revoked. If the
+// revocation status can't be determined (because the certificate doesn't
+// name an OCSP responder, or the responder can't be reached), a warning is
+// logged and the certificate is used, since an unreachable responder would
+// otherwise stop credentials from being issued.
+func checkOCSPStatus(ctx context.Context, opts *CredentialsOpts, certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) error {
+	response, err := ocspStatus(ctx, opts, certificate, issuer, now)
+	if err != nil {
+		LogWarnf("unable to determine through OCSP whether the certificate with serial number %s has been revoked: %s",
+			certificate.SerialNumber, err)
+		return nil
+	}
+	switch response.Status {
+	case ocsp.Revoked:
+		return revokedCertificateError(certificate, response.RevokedAt)
+	case ocsp.Unknown:
+		LogWarnf("the OCSP responder doesn't know the certificate with serial number %s", certificate.SerialNumber)
+	}
+	return nil
+}
+
+// Returns the OCSP response for the certificate, from the cache or from its
+// OCSP responder
+func ocspStatus(ctx context.Context, opts *CredentialsOpts, certificate *x509.Certificate, issuer *x509.Certificate, now time.Time) (*ocsp.Response, error) {
+	if len(certificate.OCSPServer) == 0 {
+		return nil, errors.New("the certificate doesn't name an OCSP responder")
+	}
+
+	key := string(issuer.RawSubjectPublicKeyInfo) + certificate.SerialNumber.String()
+	ocspResponses.Lock()
+	response, ok := ocspResponses.responses[key]
+	ocspResponses.Unlock()
+	if ok && now.Before(response.NextUpdate) {
+		return response, nil
+	}
+
+	request, err := ocsp.CreateRequest(certificate, issuer, &ocsp.RequestOptions{Hash: crypto.SHA256})
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetchRevocationData(ctx, opts, http.MethodPost, certificate.OCSPServer[0], "application/ocsp-request",
+		request, 1<<20)
+	if err != nil {
+		return nil, err
+	}
+	response, err = ocsp.ParseResponseForCert(body, certificate, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if now.Before(response.ThisUpdate.Add(-clockSkewThreshold)) ||
+		(!response.NextUpdate.IsZero() && now.After(response.NextUpdate)) {
+		return nil, errors.New("the OCSP response isn't current")
+	}
+
+	if !response.NextUpdate.IsZero() {
+		ocspResponses.Lock()
+		if ocspResponses.responses == nil {
+			ocspResponses.responses = make(map[string]*ocsp.Response)
+		}
+		ocspResponses.responses[key] = response
+		ocspResponses.Unlock()
+	}
+	return response, nil
+}
@@ -0,0 +1,126 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestOCSPCheck(t *testing.T) {
+	t.Setenv("AWS_MAX_ATTEMPTS", "1")
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDer, _ := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, caKey.Public(), caKey)
+	ca, _ := x509.ParseCertificate(caDer)
+
+	var revoked sync.Map
+	var queries atomic.Int32
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		queries.Add(1)
+		body, _ := io.ReadAll(r.Body)
+		request, err := ocsp.ParseRequest(body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		template := ocsp.Response{
+			Status:       ocsp.Good,
+			SerialNumber: request.SerialNumber,
+			ThisUpdate:   time.Now().Add(-time.Minute),
+			NextUpdate:   time.Now().Add(time.Hour),
+		}
+		if isRevoked, _ := revoked.Load(request.SerialNumber.String()); isRevoked == true {
+			template.Status = ocsp.Revoked
+			template.RevokedAt = time.Now().Add(-time.Minute)
+		}
+		response, _ := ocsp.CreateResponse(ca, ca, template, caKey)
+		w.Write(response)
+	}))
+	defer responder.Close()
+
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	for i, tc := range []struct {
+		name      string
+		mode      string
+		revoked   bool
+		responder string
+		rejected  bool
+	}{
+		{"good", OCSPCheckEnforce, false, responder.URL, false},
+		{"revoked", OCSPCheckEnforce, true, responder.URL, true},
+		{"revoked-warn", OCSPCheckWarn, true, responder.URL, false},
+		{"revoked-off", OCSPCheckOff, true, responder.URL, false},
+		{"unreachable", OCSPCheckEnforce, true, "http://127.0.0.1:1", false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			serialNumber := big.NewInt(int64(100 + i))
+			revoked.Store(serialNumber.String(), tc.revoked)
+			template := &x509.Certificate{
+				SerialNumber: serialNumber,
+				Subject:      pkix.Name{CommonName: tc.name},
+				NotBefore:    time.Now().Add(-time.Hour),
+				NotAfter:     time.Now().Add(time.Hour),
+				OCSPServer:   []string{tc.responder},
+			}
+			der, _ := x509.CreateCertificate(rand.Reader, template, ca, key.Public(), caKey)
+			certificate, _ := x509.ParseCertificate(der)
+			signer, _, err := NewCryptoSigner(key, certificate, []*x509.Certificate{ca})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer signer.Close()
+
+			opts := CredentialsOpts{
+				TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+				ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+				RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+				SessionDuration:   900,
+				Endpoint:          server.URL,
+				OCSPCheck:         tc.mode,
+			}
+			sent := requests.Load()
+			_, err = GenerateCredentials(&opts, signer, "SHA256")
+			if errors.Is(err, ErrCertificateRevoked) != tc.rejected {
+				t.Errorf("unexpected error: %v", err)
+			}
+			if (requests.Load() == sent) != tc.rejected {
+				t.Errorf("expected CreateSession to be called only if the certificate isn't rejected")
+			}
+
+			// Responses are reused until their NextUpdate time
+			queried := queries.Load()
+			GenerateCredentials(&opts, signer, "SHA256")
+			if tc.mode != OCSPCheckOff && queries.Load() != queried {
+				t.Errorf("expected the OCSP response to be reused")
+			}
+		})
+	}
+}
@@ -0,0 +1,313 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/smithy-go/tracing"
+)
+
+// How long exports of spans to the OTLP endpoint may take
+const otlpExportTimeout = 5 * time.Second
+
+// Matches W3C traceparent values (version 00), with the trace ID and parent
+// span ID as submatches
+var traceParentPattern = regexp.MustCompile(`^00-([0-9a-f]{32})-([0-9a-f]{16})-[0-9a-f]{2}$`)
+
+// Configuration of an OTLPTracerProvider
+type OTLPTracerOptions struct {
+	// URL of the OTLP/HTTP traces endpoint that spans are exported to (such
+	// as http://localhost:4318/v1/traces)
+	Endpoint string
+	// Headers of the export requests (for example, for authentication)
+	Headers map[string]string
+	// service.name of the resource of the spans
+	ServiceName string
+	// W3C traceparent of the span that the spans of the process are children
+	// of, if they aren't children of another span of the process (for
+	// example, one passed in through the TRACEPARENT environment variable by
+	// the program that runs the command)
+	TraceParent string
+}
+
+// Tracer provider that exports spans to an OTLP/HTTP endpoint (with the JSON
+// encoding), for the command, which doesn't depend on the OpenTelemetry SDK.
+// Spans are exported when a span without a parent in the process ends, and
+// by Shutdown. Applications that use the OpenTelemetry SDK can adapt its
+// tracer provider for CredentialsOpts.TracerProvider instead.
+type OTLPTracerProvider struct {
+	options       OTLPTracerOptions
+	client        *http.Client
+	parentTraceId string
+	parentSpanId  string
+
+	mu      sync.Mutex
+	pending []*otlpSpan
+	exports sync.WaitGroup
+}
+
+type otlpTracer struct {
+	provider *OTLPTracerProvider
+	scope    string
+}
+
+// Span of an OTLPTracerProvider
+type otlpSpan struct {
+	provider     *OTLPTracerProvider
+	scope        string
+	name         string
+	kind         tracing.SpanKind
+	traceId      string
+	spanId       string
+	parentSpanId string
+	// Whether the parent of the span is another span of the process
+	localParent bool
+	start       time.Time
+
+	mu         sync.Mutex
+	end        time.Time
+	status     tracing.SpanStatus
+	attributes map[string]any
+	events     []otlpEvent
+}
+
+type otlpEvent struct {
+	name string
+	time time.Time
+}
+
+// Returns a tracer provider that exports spans to the OTLP endpoint of the
+// options
+func NewOTLPTracerProvider(options OTLPTracerOptions) (*OTLPTracerProvider, error) {
+	if options.Endpoint == "" {
+		return nil, errors.New("the OTLP endpoint is required")
+	}
+	if options.ServiceName == "" {
+		options.ServiceName = "aws_signing_helper"
+	}
+	provider := &OTLPTracerProvider{options: options, client: &http.Client{Timeout: otlpExportTimeout}}
+	if options.TraceParent != "" {
+		match := traceParentPattern.FindStringSubmatch(options.TraceParent)
+		if match == nil {
+			return nil, fmt.Errorf("invalid traceparent %q", options.TraceParent)
+		}
+		provider.parentTraceId, provider.parentSpanId = match[1], match[2]
+	}
+	return provider, nil
+}
+
+func (p *OTLPTracerProvider) Tracer(scope string, opts ...tracing.TracerOption) tracing.Tracer {
+	return otlpTracer{p, scope}
+}
+
+func (t otlpTracer) StartSpan(ctx context.Context, name string, opts ...tracing.SpanOption) (context.Context, tracing.Span) {
+	var options tracing.SpanOptions
+	for _, opt := range opts {
+		opt(&options)
+	}
+	span := &otlpSpan{provider: t.provider, scope: t.scope, name: name, kind: options.Kind, spanId: randomHex(8),
+		start: time.Now(), attributes: map[string]any{}}
+	if parent, ok := tracing.GetSpan(ctx); ok {
+		if parent, ok := parent.(*otlpSpan); ok {
+			span.traceId, span.parentSpanId, span.localParent = parent.traceId, parent.spanId, true
+		}
+	}
+	if span.traceId == "" {
+		span.traceId, span.parentSpanId = t.provider.parentTraceId, t.provider.parentSpanId
+		if span.traceId == "" {
+			span.traceId = randomHex(16)
+		}
+	}
+	return tracing.WithSpan(ctx, span), span
+}
+
+func (s *otlpSpan) Name() string {
+	return s.name
+}
+
+func (s *otlpSpan) Context() tracing.SpanContext {
+	return tracing.SpanContext{TraceID: s.traceId, SpanID: s.spanId}
+}
+
+func (s *otlpSpan) AddEvent(name string, opts ...tracing.EventOption) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, otlpEvent{name, time.Now()})
+}
+
+func (s *otlpSpan) SetStatus(status tracing.SpanStatus) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+func (s *otlpSpan) SetProperty(k, v any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[fmt.Sprint(k)] = v
+}
+
+func (s *otlpSpan) End() {
+	s.mu.Lock()
+	if !s.end.IsZero() {
+		s.mu.Unlock()
+		return
+	}
+	s.end = time.Now()
+	s.mu.Unlock()
+
+	p := s.provider
+	p.mu.Lock()
+	p.pending = append(p.pending, s)
+	p.mu.Unlock()
+	if !s.localParent {
+		p.exports.Add(1)
+		go func() {
+			defer p.exports.Done()
+			ctx, cancel := context.WithTimeout(context.Background(), otlpExportTimeout)
+			defer cancel()
+			if err := p.export(ctx); err != nil {
+				transportLog.debugf("unable to export spans: %s", err)
+			}
+		}()
+	}
+}
+
+// Waits for the exports that are in progress, and exports the spans that
+// ended since
+func (p *OTLPTracerProvider) Shutdown(ctx context.Context) error {
+	p.exports.Wait()
+	return p.export(ctx)
+}
+
+// Exports the spans that ended, and aren't exported yet
+func (p *OTLPTracerProvider) export(ctx context.Context) error {
+	p.mu.Lock()
+	spans := p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+
+	body, err := json.Marshal(p.exportRequest(spans))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, p.options.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range p.options.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := p.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("the OTLP endpoint responded with status %s", response.Status)
+	}
+	return nil
+}
+
+// Returns the OTLP/HTTP JSON export request for the spans, grouped by their
+// instrumentation scope
+func (p *OTLPTracerProvider) exportRequest(spans []*otlpSpan) map[string]any {
+	var scopes []string
+	scopeSpans := map[string][]any{}
+	for _, span := range spans {
+		if _, ok := scopeSpans[span.scope]; !ok {
+			scopes = append(scopes, span.scope)
+		}
+		scopeSpans[span.scope] = append(scopeSpans[span.scope], span.otlp())
+	}
+	var groups []any
+	for _, scope := range scopes {
+		groups = append(groups, map[string]any{"scope": map[string]any{"name": scope}, "spans": scopeSpans[scope]})
+	}
+
+	resourceAttributes := map[string]any{"service.name": p.options.ServiceName}
+	if hostname, err := os.Hostname(); err == nil {
+		resourceAttributes["host.name"] = hostname
+	}
+	return map[string]any{
+		"resourceSpans": []any{map[string]any{
+			"resource":   map[string]any{"attributes": otlpAttributes(resourceAttributes)},
+			"scopeSpans": groups,
+		}},
+	}
+}
+
+// Returns the span in the OTLP JSON encoding, whose span kinds are offset by
+// one from those of smithy-go (0 is SPAN_KIND_UNSPECIFIED)
+func (s *otlpSpan) otlp() map[string]any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	span := map[string]any{
+		"traceId":           s.traceId,
+		"spanId":            s.spanId,
+		"name":              s.name,
+		"kind":              int(s.kind) + 1,
+		"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+		"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+		"attributes":        otlpAttributes(s.attributes),
+		"status":            map[string]any{"code": int(s.status)},
+	}
+	if s.parentSpanId != "" {
+		span["parentSpanId"] = s.parentSpanId
+	}
+	var events []any
+	for _, event := range s.events {
+		events = append(events, map[string]any{"name": event.name,
+			"timeUnixNano": strconv.FormatInt(event.time.UnixNano(), 10)})
+	}
+	if len(events) > 0 {
+		span["events"] = events
+	}
+	return span
+}
+
+// Returns the attributes in the OTLP JSON encoding
+func otlpAttributes(attributes map[string]any) []any {
+	list := make([]any, 0, len(attributes))
+	for key, value := range attributes {
+		var encoded map[string]any
+		switch value := value.(type) {
+		case bool:
+			encoded = map[string]any{"boolValue": value}
+		case int:
+			encoded = map[string]any{"intValue": strconv.Itoa(value)}
+		case int64:
+			encoded = map[string]any{"intValue": strconv.FormatInt(value, 10)}
+		case float64:
+			encoded = map[string]any{"doubleValue": value}
+		default:
+			encoded = map[string]any{"stringValue": fmt.Sprint(value)}
+		}
+		list = append(list, map[string]any{"key": key, "value": encoded})
+	}
+	return list
+}
+
+// Returns random bytes, hex-encoded
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
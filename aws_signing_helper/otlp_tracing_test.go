@@ -0,0 +1,125 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/aws/smithy-go/tracing"
+)
+
+func TestOTLPTracing(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	type exportedSpan struct {
+		TraceId      string `json:"traceId"`
+		SpanId       string `json:"spanId"`
+		ParentSpanId string `json:"parentSpanId"`
+		Name         string `json:"name"`
+		Status       struct {
+			Code int `json:"code"`
+		} `json:"status"`
+	}
+	var mu sync.Mutex
+	spans := map[string]exportedSpan{}
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			ResourceSpans []struct {
+				ScopeSpans []struct {
+					Spans []exportedSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+		if r.Header.Get("Authorization") != "token" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					spans[span.Name] = span
+				}
+			}
+		}
+	}))
+	defer collector.Close()
+
+	traceParent := "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01"
+	if _, err := NewOTLPTracerProvider(OTLPTracerOptions{Endpoint: collector.URL, TraceParent: "invalid"}); err == nil {
+		t.Error("an invalid traceparent was accepted")
+	}
+	provider, err := NewOTLPTracerProvider(OTLPTracerOptions{Endpoint: collector.URL,
+		Headers: map[string]string{"Authorization": "token"}, TraceParent: traceParent})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/ec-prime256v1-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/ec-prime256v1-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+		Cache:             NewMemoryCredentialCache(),
+		TracerProvider:    provider,
+	}
+	credentialer, err := NewCredentialer(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+	if _, err = credentialer.Credentials(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err = provider.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, parent := range map[string]string{
+		"LoadKey":                   "",
+		"Credentialer.Credentials":  "",
+		"CredentialCache.Get":       "Credentialer.Credentials",
+		"RolesAnywhere.Credentials": "Credentialer.Credentials",
+		"CredentialCache.Put":       "Credentialer.Credentials",
+	} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("the %s span wasn't exported", name)
+			continue
+		}
+		if span.TraceId != "0af7651916cd43dd8448eb211c80319c" {
+			t.Errorf("the %s span isn't part of the trace of the traceparent: %s", name, span.TraceId)
+		}
+		if parent == "" && span.ParentSpanId != "b7ad6b7169203331" {
+			t.Errorf("the %s span isn't a child of the traceparent: %s", name, span.ParentSpanId)
+		} else if parent != "" && span.ParentSpanId != spans[parent].SpanId {
+			t.Errorf("the %s span isn't a child of the %s span", name, parent)
+		}
+		if span.Status.Code != int(tracing.SpanStatusOK) {
+			t.Errorf("unexpected status of the %s span: %d", name, span.Status.Code)
+		}
+	}
+
+	// The signature is nested in the spans of the CreateSession call of the
+	// SDK, within the credentials span
+	byId := map[string]exportedSpan{}
+	for _, span := range spans {
+		byId[span.SpanId] = span
+	}
+	span, nested := spans["SignX509"], false
+	for depth := 0; depth < 10 && !nested; depth++ {
+		span = byId[span.ParentSpanId]
+		nested = span.Name == "RolesAnywhere.Credentials"
+	}
+	if !nested {
+		t.Error("the SignX509 span isn't nested in the credentials span")
+	}
+}
@@ -0,0 +1,65 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// Checks that only the owner of each of the files and directories (those that
+// exist) can access it, and restricts it to its owner if not, with a warning.
+// Files that the credential helper writes are created that way, but files
+// that already existed (for example, a credentials file or AWS CLI cache
+// that was written by another tool) keep their permissions until they're
+// replaced, and logs are only appended to.
+func RepairOwnerOnlyPermissions(paths ...string) {
+	for _, path := range paths {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		if err := checkOwnerOnlyPermissions(path); !errors.Is(err, ErrInsecurePermissions) {
+			continue
+		}
+		if err := setOwnerOnlyPermissions(path); err != nil {
+			LogWarnf("unable to restrict the permissions of %s to its owner: %s", path, err)
+		} else {
+			LogWarnf("restricted the permissions of %s to its owner, since other users could access it", path)
+		}
+	}
+}
+
+// Repairs the permissions of the files that the update command writes
+// credentials to (the credentials file or the AWS CLI cache entry, and its
+// directory), before it writes to them
+func repairUpdateTargetPermissions(opts *CredentialsOpts) {
+	switch opts.UpdateTarget {
+	case UpdateTargetCLICache:
+		cacheDir, err := GetCLICacheDir()
+		if err != nil {
+			return
+		}
+		cacheKey, err := GetCLICacheKey(opts)
+		if err != nil {
+			return
+		}
+		RepairOwnerOnlyPermissions(cacheDir, filepath.Join(cacheDir, cacheKey+".json"))
+	case UpdateTargetCredentialsFile, "":
+		if path, err := GetCredentialsFilePath(); err == nil {
+			RepairOwnerOnlyPermissions(path)
+		}
+	}
+}
+
+// Repairs the permissions of the directory of the credential cache, and of
+// its entries
+func (c *fileCredentialCache) repairPermissions() {
+	paths := []string{c.dir}
+	entries, _ := os.ReadDir(c.dir)
+	for _, entry := range entries {
+		paths = append(paths, filepath.Join(c.dir, entry.Name()))
+	}
+	RepairOwnerOnlyPermissions(paths...)
+}
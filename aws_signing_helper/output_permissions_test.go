@@ -0,0 +1,31 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRepairOwnerOnlyPermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes don't control access on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "cache")
+	os.Mkdir(dir, 0755)
+	os.Chmod(dir, 0755)
+	entryPath := filepath.Join(dir, "entry.json")
+	os.WriteFile(entryPath, []byte("{}"), 0644)
+	os.Chmod(entryPath, 0644)
+
+	NewFileCredentialCache(dir)
+	for path, expected := range map[string]os.FileMode{dir: 0700, entryPath: 0600} {
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if mode := info.Mode().Perm(); mode != expected {
+			t.Errorf("permissions of %s are %04o, not %04o", path, mode, expected)
+		}
+	}
+}
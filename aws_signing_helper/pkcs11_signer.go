@@ -1,3 +1,5 @@
+//go:build cgo && !nopkcs11
+
 package aws_signing_helper
 
 // RFC7512 defines a standard URI format for referencing PKCS#11 objects.
@@ -34,12 +36,10 @@ import (
 	"crypto/elliptic"
 	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/sha512"
 	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"os"
 	"runtime"
 	"strconv"
@@ -50,9 +50,20 @@ import (
 	pkcs11uri "github.com/stefanberger/go-pkcs11uri"
 )
 
+// Name of the backend, as returned by Backends
+const pkcs11Backend = "pkcs11"
+
+func init() {
+	registerBackend(pkcs11Backend)
+}
+
 var PKCS11_TEST_VERSION int16 = 1
 var MAX_OBJECT_LIMIT int = 1000
 
+// Largest number of sessions that a PKCS11Signer keeps open (and logged in)
+// between signatures
+const pkcs11MaxIdleSessions = 2
+
 // In our list of certs, we want to remember the CKA_ID/CKA_LABEL too.
 type CertObjInfo struct {
 	id         []byte
@@ -76,8 +87,10 @@ type SlotIdInfo struct {
 }
 
 type PKCS11Signer struct {
-	cert               *x509.Certificate
-	certChain          []*x509.Certificate
+	cert      *x509.Certificate
+	certChain []*x509.Certificate
+	// Provider library, which module is loaded from
+	lib                string
 	module             *pkcs11.Ctx
 	userPin            string
 	alwaysAuth         uint
@@ -85,6 +98,18 @@ type PKCS11Signer struct {
 	certUri            *pkcs11uri.Pkcs11URI
 	keyUri             *pkcs11uri.Pkcs11URI
 	reusePin           bool
+	// Sessions that are logged in, and in which the private key was found,
+	// which are reused by later signatures
+	sessions chan pkcs11Session
+}
+
+// Session of a PKCS11Signer, along with the private key object that it signs
+// with
+type pkcs11Session struct {
+	handle        pkcs11.SessionHandle
+	privateKeyObj KeyObjInfo
+	keySlot       SlotIdInfo
+	keyType       uint
 }
 
 // Initialize a PKCS#11 module.
@@ -137,18 +162,14 @@ func enumerateSlotsInPKCS11Module(module *pkcs11.Ctx) (slots []SlotIdInfo, err e
 		slotIdInfo.id = slotId
 		slotIdInfo.info, slotErr = module.GetSlotInfo(slotId)
 		if slotErr != nil {
-			if Debug {
-				log.Printf("unable to get slot info for slot %d"+
-					" (%s)\n", slotId, slotErr)
-			}
+			signerLog.debugf("unable to get slot info for slot %d"+
+				" (%s)", slotId, slotErr)
 			continue
 		}
 		slotIdInfo.tokInfo, slotErr = module.GetTokenInfo(slotId)
 		if slotErr != nil {
-			if Debug {
-				log.Printf("unable to get token info for slot %d"+
-					" (%s)\n", slotId, slotErr)
-			}
+			signerLog.debugf("unable to get token info for slot %d"+
+				" (%s)", slotId, slotErr)
 			continue
 		}
 
@@ -335,10 +356,8 @@ func getMatchingCerts(module *pkcs11.Ctx, slots []SlotIdInfo, uri *pkcs11uri.Pkc
 	for _, slot := range slots {
 		curSession, err := module.OpenSession(slot.id, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKS_RO_PUBLIC_SESSION)
 		if err != nil {
-			if Debug {
-				log.Printf("unable to open session in slot %d"+
-					" (%s)\n", slot.id, err)
-			}
+			signerLog.debugf("unable to open session in slot %d"+
+				" (%s)", slot.id, err)
 			module.CloseSession(curSession)
 			continue
 		}
@@ -380,7 +399,7 @@ func getMatchingCerts(module *pkcs11.Ctx, slots []SlotIdInfo, uri *pkcs11uri.Pkc
 				goto fail
 			}
 
-			err = module.Login(curSession, pkcs11.CKU_USER, userPin)
+			err = pkcs11Login(module, curSession, userPin)
 			if err != nil {
 				err = errNoMatchingCerts
 				goto fail
@@ -522,6 +541,10 @@ func (pkcs11Signer *PKCS11Signer) Public() crypto.PublicKey {
 	return nil
 }
 
+func (pkcs11Signer *PKCS11Signer) backendName() string {
+	return pkcs11Backend
+}
+
 // Closes this PKCS11Signer.
 func (pkcs11Signer *PKCS11Signer) Close() {
 	var module *pkcs11.Ctx
@@ -529,6 +552,10 @@ func (pkcs11Signer *PKCS11Signer) Close() {
 	module = pkcs11Signer.module
 
 	if module != nil {
+		for len(pkcs11Signer.sessions) > 0 {
+			session := <-pkcs11Signer.sessions
+			module.CloseSession(session.handle)
+		}
 		module.Finalize()
 		module.Destroy()
 	}
@@ -536,6 +563,115 @@ func (pkcs11Signer *PKCS11Signer) Close() {
 	pkcs11Signer.module = nil
 }
 
+// Loads the PKCS#11 module, if it hasn't been loaded yet. The first session
+// is opened at the same time, so that a private key that doesn't match the
+// certificate (or a PIN that's wrong) is reported right away.
+func (pkcs11Signer *PKCS11Signer) initialize() error {
+	if pkcs11Signer.module != nil {
+		return nil
+	}
+	module, err := initializePKCS11Module(pkcs11Signer.lib)
+	if err != nil {
+		return err
+	}
+	pkcs11Signer.module = module
+	session, err := pkcs11Signer.openSession()
+	if err != nil {
+		module.Finalize()
+		module.Destroy()
+		pkcs11Signer.module = nil
+		return err
+	}
+	pkcs11Signer.putSession(session)
+	return nil
+}
+
+// Returns a session to sign with: one that's kept open from an earlier
+// signature if it's still logged in, or a new one otherwise
+func (pkcs11Signer *PKCS11Signer) getSession() (pkcs11Session, error) {
+	for {
+		select {
+		case session := <-pkcs11Signer.sessions:
+			// The token may have closed the session (for example, if it was
+			// removed, or logged out by another session of the process)
+			info, err := pkcs11Signer.module.GetSessionInfo(session.handle)
+			if err == nil && (info.State == pkcs11.CKS_RO_USER_FUNCTIONS || info.State == pkcs11.CKS_RW_USER_FUNCTIONS) {
+				return session, nil
+			}
+			signerLog.debugf("discarding PKCS#11 session that's no longer logged in")
+			pkcs11Signer.module.CloseSession(session.handle)
+		default:
+			return pkcs11Signer.openSession()
+		}
+	}
+}
+
+// Keeps the session open for later signatures, unless enough sessions are
+// already kept open
+func (pkcs11Signer *PKCS11Signer) putSession(session pkcs11Session) {
+	select {
+	case pkcs11Signer.sessions <- session:
+	default:
+		pkcs11Signer.module.CloseSession(session.handle)
+	}
+}
+
+// Opens a session in the slot of the private key, logs in to it, and finds
+// the private key (which is checked against the certificate)
+func (pkcs11Signer *PKCS11Signer) openSession() (pkcs11Session, error) {
+	var (
+		module     *pkcs11.Ctx
+		session    pkcs11.SessionHandle
+		certObj    CertObjInfo
+		certSlot   SlotIdInfo
+		certSlotNr uint
+		slots      []SlotIdInfo
+		loggedIn   bool
+		opened     pkcs11Session
+		err        error
+	)
+
+	module = pkcs11Signer.module
+
+	// If a PKCS#11 URI was provided for the certificate, use it.
+	if pkcs11Signer.certUri != nil {
+		certSlot, slots, session, loggedIn, certObj, err = getCertificate(module, pkcs11Signer.certUri, pkcs11Signer.userPin)
+		if err != nil {
+			return pkcs11Session{}, err
+		}
+		certSlotNr = certSlot.id
+	} else {
+		// Otherwise, enumerate slots, and match the key against the
+		// certificate that was found in a file.
+		slots, err = enumerateSlotsInPKCS11Module(module)
+		if err != nil {
+			return pkcs11Session{}, err
+		}
+		certObj = CertObjInfo{nil, nil, pkcs11Signer.cert, 0}
+	}
+
+	certSession := session
+	opened.handle, pkcs11Signer.userPin, pkcs11Signer.keyUri, opened.keyType, opened.privateKeyObj, opened.keySlot, pkcs11Signer.alwaysAuth, pkcs11Signer.contextSpecificPin, err = getPKCS11Key(module, session, loggedIn, pkcs11Signer.certUri, pkcs11Signer.keyUri, false, certSlotNr, certObj, pkcs11Signer.userPin, pkcs11Signer.contextSpecificPin, pkcs11Signer.reusePin, slots)
+	if err != nil {
+		if certSession != 0 {
+			module.CloseSession(certSession)
+		}
+		return pkcs11Session{}, err
+	}
+	return opened, nil
+}
+
+// Logs in to the token as the user. Sessions of the same token share their
+// login state, so a token that's already logged in (by another session that's
+// kept open) is fine.
+func pkcs11Login(module *pkcs11.Ctx, session pkcs11.SessionHandle, userPin string) error {
+	err := module.Login(session, pkcs11.CKU_USER, userPin)
+	if err == pkcs11.Error(pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return nil
+	}
+	return err
+}
+
 // Does PIN prompting until the password has been received.
 // This method is used both for prompting for the user PIN and the
 // context-specific PIN. Note that finalAuthErrMsg should contain a
@@ -595,8 +731,17 @@ func pkcs11PasswordPrompt(module *pkcs11.Ctx, session pkcs11.SessionHandle, user
 	return "", fmt.Errorf("unexpected error when prompting for %s", passwordName)
 }
 
+// DER encodings of the DigestInfo structure (without the digest) for each
+// hash function, which are prepended to digests that are signed with
+// CKM_RSA_PKCS
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
 // Helper function to sign a digest using a PKCS#11 private key handle.
-func signHelper(module *pkcs11.Ctx, session pkcs11.SessionHandle, privateKeyObj KeyObjInfo, slot SlotIdInfo, userPin string, alwaysAuth uint, contextSpecificPin string, reusePin bool, keyType uint, digest []byte, hashFunc crypto.Hash) (_contextSpecificPin string, signature []byte, err error) {
+func signHelper(module *pkcs11.Ctx, session pkcs11.SessionHandle, privateKeyObj KeyObjInfo, slot SlotIdInfo, userPin string, alwaysAuth uint, contextSpecificPin string, reusePin bool, keyType uint, digest []byte, opts crypto.SignerOpts) (_contextSpecificPin string, signature []byte, err error) {
 	// XXX: If you use this outside the context of IAM RA, be aware that
 	// you'll want to use something other than SHA256 in many cases.
 	// For TLSv1.3 the hash needs to precisely match the bit size of the
@@ -610,22 +755,22 @@ func signHelper(module *pkcs11.Ctx, session pkcs11.SessionHandle, privateKeyObj
 	)
 
 	if keyType == pkcs11.CKK_EC {
-		switch hashFunc {
-		case crypto.SHA256:
-			hash := sha256.Sum256(digest)
-			digest = hash[:]
-		case crypto.SHA384:
-			hash := sha512.Sum384(digest)
-			digest = hash[:]
-		case crypto.SHA512:
-			hash := sha512.Sum512(digest)
-			digest = hash[:]
-		default:
-			return "", nil, ErrUnsupportedHash
+		digest, err = signatureDigest(digest, opts)
+		if err != nil {
+			return "", nil, err
 		}
 		mechanism = pkcs11.CKM_ECDSA
+	} else if isPrehashed(opts) {
+		// The module can't hash digests again, so the DigestInfo is built
+		// here, and signed with raw PKCS #1 v1.5
+		digest, err = signatureDigest(digest, opts)
+		if err != nil {
+			return "", nil, err
+		}
+		digest = append(append([]byte{}, digestInfoPrefixes[opts.HashFunc()]...), digest...)
+		mechanism = pkcs11.CKM_RSA_PKCS
 	} else {
-		switch hashFunc {
+		switch opts.HashFunc() {
 		case crypto.SHA256:
 			mechanism = pkcs11.CKM_SHA256_RSA_PKCS
 		case crypto.SHA384:
@@ -655,9 +800,7 @@ func signHelper(module *pkcs11.Ctx, session pkcs11.SessionHandle, privateKeyObj
 			if err == nil {
 				goto afterContextSpecificLogin
 			} else {
-				if Debug {
-					log.Printf("user re-authentication attempt failed (%s)\n", err.Error())
-				}
+				signerLog.debugf("user re-authentication attempt failed (%s)", err.Error())
 			}
 		}
 
@@ -745,9 +888,7 @@ func getPKCS11Key(module *pkcs11.Ctx, session pkcs11.SessionHandle, loggedIn boo
 			session = 0
 		}
 	} else {
-		if Debug {
-			log.Printf("Found %d matching slots for the PKCS#11 key\n", len(slots))
-		}
+		signerLog.debugf("Found %d matching slots for the PKCS#11 key", len(slots))
 		// If the URI matched multiple slots *but* one of them is the
 		// one (certSlotNr) that the certificate was found in, then use
 		// that.
@@ -780,7 +921,7 @@ got_slot:
 				goto fail
 			}
 		} else {
-			err = module.Login(session, pkcs11.CKU_USER, userPin)
+			err = pkcs11Login(module, session, userPin)
 			if err != nil {
 				goto fail
 			}
@@ -894,11 +1035,9 @@ retry_search:
 			if noKeyUri {
 				_, keyHadLabel := keyUri.GetPathAttribute("object", false)
 				if keyHadLabel {
-					if Debug {
-						log.Println("unable to find private key with CKA_LABEL;" +
-							" repeating the search using CKA_ID of the certificate" +
-							" without requiring a CKA_LABEL match")
-					}
+					signerLog.debugf("unable to find private key with CKA_LABEL;" +
+						" repeating the search using CKA_ID of the certificate" +
+						" without requiring a CKA_LABEL match")
 					keyUri.RemovePathAttribute("object")
 					keyUri.SetPathAttribute("id", escapeAll(certObj.id))
 					goto retry_search
@@ -950,74 +1089,31 @@ func getCertificate(module *pkcs11.Ctx, certUri *pkcs11uri.Pkcs11URI, userPin st
 // Implements the crypto.Signer interface and signs the passed in digest
 func (pkcs11Signer *PKCS11Signer) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error) {
 	var (
-		module             *pkcs11.Ctx
-		session            pkcs11.SessionHandle
-		certUri            *pkcs11uri.Pkcs11URI
-		keyUri             *pkcs11uri.Pkcs11URI
-		userPin            string
+		session            pkcs11Session
 		contextSpecificPin string
-		privateKeyObj      KeyObjInfo
-		keySlot            SlotIdInfo
-		keyType            uint
-		certSlotNr         uint
-		certObj            CertObjInfo
-		slots              []SlotIdInfo
-		loggedIn           bool
-		reusePin           bool
-		alwaysAuth         uint
-		certSlot           SlotIdInfo
 	)
 
-	hashFunc := opts.HashFunc()
-
-	module = pkcs11Signer.module
-	userPin = pkcs11Signer.userPin
-	alwaysAuth = pkcs11Signer.alwaysAuth
-	contextSpecificPin = pkcs11Signer.contextSpecificPin
-	certUri = pkcs11Signer.certUri
-	keyUri = pkcs11Signer.keyUri
-	reusePin = pkcs11Signer.reusePin
-
-	// If a PKCS#11 URI was provided for the certificate, use it.
-	if certUri != nil {
-		certSlot, slots, session, loggedIn, certObj, err = getCertificate(module, certUri, userPin)
-		if err != nil {
-			goto cleanUp
-		}
-		certSlotNr = certSlot.id
-	}
-
-	// Otherwise, if the certificate's PKCS#11 URI wasn't provided, enumerate slots.
-	if certUri == nil {
-		slots, err = enumerateSlotsInPKCS11Module(module)
-		if err != nil {
-			goto cleanUp
-		}
+	if err = pkcs11Signer.initialize(); err != nil {
+		return nil, err
 	}
-
-	session, userPin, keyUri, keyType, privateKeyObj, keySlot, alwaysAuth, contextSpecificPin, err = getPKCS11Key(module, session, loggedIn, certUri, keyUri, false, certSlotNr, certObj, userPin, contextSpecificPin, reusePin, slots)
+	session, err = pkcs11Signer.getSession()
 	if err != nil {
-		goto cleanUp
+		return nil, err
 	}
 
-	contextSpecificPin, signature, err = signHelper(module, session, privateKeyObj, keySlot, userPin, alwaysAuth, contextSpecificPin, reusePin, keyType, digest, hashFunc)
+	contextSpecificPin, signature, err = signHelper(pkcs11Signer.module, session.handle, session.privateKeyObj, session.keySlot, pkcs11Signer.userPin, pkcs11Signer.alwaysAuth, pkcs11Signer.contextSpecificPin, pkcs11Signer.reusePin, session.keyType, digest, opts)
 	if err != nil {
-		goto cleanUp
-	} else {
-		pkcs11Signer.contextSpecificPin = contextSpecificPin
+		// The session isn't reused, in case it's what failed
+		pkcs11Signer.module.CloseSession(session.handle)
+		return nil, err
 	}
+	pkcs11Signer.contextSpecificPin = contextSpecificPin
 
-	// Note that the session should be logged out of and closed even if there
-	// are no errors after the signing operation.
-cleanUp:
-	if session != 0 {
-		if loggedIn {
-			module.Logout(session)
-		}
-		module.CloseSession(session)
-	}
+	// Rather than being logged out of and closed, the session is kept open,
+	// so that later signatures don't have to find the key and log in again.
+	pkcs11Signer.putSession(session)
 
-	return signature, err
+	return signature, nil
 }
 
 // Gets the *x509.Certificate associated with this PKCS11Signer.
@@ -1211,8 +1307,36 @@ func GetPKCS11Signer(libPkcs11 string, cert *x509.Certificate, certChain []*x509
 		slots              []SlotIdInfo
 		certSlot           SlotIdInfo
 		noKeyUri           bool
+		privateKeyObj      KeyObjInfo
+		keySlot            SlotIdInfo
+		pkcs11Signer       *PKCS11Signer
 	)
 
+	// If the certificate was found in a file, the key is found (and checked
+	// against the certificate) in the first session of the signer, so that a
+	// key that doesn't match, or a wrong PIN, is reported here.
+	if cert != nil && privateKeyId != "" {
+		keyUri = pkcs11uri.New()
+		if err = keyUri.Parse(privateKeyId); err != nil {
+			return nil, "", err
+		}
+		userPin, _ = keyUri.GetQueryAttribute("pin-value", false)
+		switch cert.PublicKey.(type) {
+		case *ecdsa.PublicKey:
+			signingAlgorithm = aws4_x509_ecdsa_sha256
+		case *rsa.PublicKey:
+			signingAlgorithm = aws4_x509_rsa_sha256
+		default:
+			return nil, "", ErrUnsupportedAlgorithm
+		}
+		pkcs11Signer = &PKCS11Signer{cert: cert, certChain: certChain, lib: libPkcs11, userPin: userPin, keyUri: keyUri,
+			reusePin: reusePin, sessions: make(chan pkcs11Session, pkcs11MaxIdleSessions)}
+		if err = pkcs11Signer.initialize(); err != nil {
+			return nil, "", err
+		}
+		return pkcs11Signer, signingAlgorithm, nil
+	}
+
 	module, err = initializePKCS11Module(libPkcs11)
 	if err != nil {
 		goto fail
@@ -1289,7 +1413,7 @@ func GetPKCS11Signer(libPkcs11 string, cert *x509.Certificate, certChain []*x509
 		}
 	}
 
-	session, userPin, keyUri, keyType, _, _, alwaysAuth, contextSpecificPin, err = getPKCS11Key(module, session, loggedIn, certUri, keyUri, noKeyUri, certSlotNr, certObj, userPin, "", reusePin, slots)
+	session, userPin, keyUri, keyType, privateKeyObj, keySlot, alwaysAuth, contextSpecificPin, err = getPKCS11Key(module, session, loggedIn, certUri, keyUri, noKeyUri, certSlotNr, certObj, userPin, "", reusePin, slots)
 	if err != nil {
 		goto fail
 	}
@@ -1300,17 +1424,17 @@ func GetPKCS11Signer(libPkcs11 string, cert *x509.Certificate, certChain []*x509
 	case pkcs11.CKK_RSA:
 		signingAlgorithm = aws4_x509_rsa_sha256
 	default:
-		return nil, "", errors.New("unsupported algorithm")
+		return nil, "", ErrUnsupportedAlgorithm
 	}
 
-	if session != 0 {
-		if loggedIn {
-			module.Logout(session)
-		}
-		module.CloseSession(session)
-	}
+	// The session that the key was found in is kept open for the first
+	// signature
+	pkcs11Signer = &PKCS11Signer{cert: cert, certChain: certChain, lib: libPkcs11, module: module, userPin: userPin,
+		alwaysAuth: alwaysAuth, contextSpecificPin: contextSpecificPin, certUri: certUri, keyUri: keyUri,
+		reusePin: reusePin, sessions: make(chan pkcs11Session, pkcs11MaxIdleSessions)}
+	pkcs11Signer.putSession(pkcs11Session{session, privateKeyObj, keySlot, keyType})
 
-	return &PKCS11Signer{cert, certChain, module, userPin, alwaysAuth, contextSpecificPin, certUri, keyUri, reusePin}, signingAlgorithm, nil
+	return pkcs11Signer, signingAlgorithm, nil
 
 fail:
 	if module != nil {
@@ -0,0 +1,19 @@
+//go:build !cgo || nopkcs11
+
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"fmt"
+)
+
+// The PKCS#11 backend requires cgo, and is left out by the nopkcs11 tag
+var errPKCS11Unavailable = fmt.Errorf("%w: PKCS#11 isn't supported in this build", ErrBackendUnavailable)
+
+func GetMatchingPKCSCerts(uriStr string, lib string) ([]CertificateContainer, error) {
+	return nil, errPKCS11Unavailable
+}
+
+func GetPKCS11Signer(libPkcs11 string, cert *x509.Certificate, certChain []*x509.Certificate, privateKeyId string, certificateId string, reusePin bool) (signer Signer, signingAlgorithm string, err error) {
+	return nil, "", errPKCS11Unavailable
+}
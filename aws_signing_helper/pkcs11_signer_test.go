@@ -1,6 +1,10 @@
+//go:build cgo && !nopkcs11
+
 package aws_signing_helper
 
 import (
+	"crypto"
+	"crypto/rand"
 	"fmt"
 	"testing"
 )
@@ -108,3 +112,28 @@ func TestPKCS11SignerCreationFails(t *testing.T) {
 		}
 	}
 }
+
+func TestPKCS11SignerReusesSessions(t *testing.T) {
+	_, cert, err := ReadCertificateData("../tst/certs/rsa-2048-sha256-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, _, err := GetPKCS11Signer("", cert, nil, "pkcs11:token=credential-helper-test;object=rsa-2048?pin-value=1234", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	pkcs11Signer := signer.(*PKCS11Signer)
+	if n := len(pkcs11Signer.sessions); n != 1 {
+		t.Errorf("expected the session that the key was found in to be kept open, but %d are", n)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err = signer.Sign(rand.Reader, []byte("test message"), crypto.SHA256); err != nil {
+			t.Fatal(err)
+		}
+		if n := len(pkcs11Signer.sessions); n != 1 {
+			t.Errorf("unexpected number of open sessions: %d", n)
+		}
+	}
+}
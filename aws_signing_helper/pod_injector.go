@@ -0,0 +1,368 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Prefix of the annotations that configure the injection of the sidecar
+// into pods
+const PodInjectorAnnotationPrefix = "rolesanywhere.amazonaws.com/"
+
+// Annotations of pods that the PodInjector reads (after
+// PodInjectorAnnotationPrefix)
+const (
+	// "true" to inject the sidecar
+	podAnnotationInject = "inject"
+	// ARNs that override those of PodInjectorOptions
+	podAnnotationTrustAnchorArn = "trust-anchor-arn"
+	podAnnotationProfileArn     = "profile-arn"
+	podAnnotationRoleArn        = "role-arn"
+	// Identity of the sidecar: a TLS secret that's mounted as a volume, a
+	// TLS secret that's read through the Kubernetes API, or an issuer of
+	// cert-manager's CSI driver (which overrides that of PodInjectorOptions)
+	podAnnotationIdentitySecret   = "identity-secret"
+	podAnnotationKubernetesSecret = "kubernetes-secret"
+	podAnnotationCSIIssuer        = "csi-issuer"
+	podAnnotationCSIIssuerKind    = "csi-issuer-kind"
+	// Comma-separated names of the containers that are given credentials
+	// (by default, all of them)
+	podAnnotationContainers = "containers"
+)
+
+// Names of the container and volumes that are injected
+const (
+	injectedContainerName      = "rolesanywhere"
+	injectedIdentityVolumeName = "rolesanywhere-identity"
+	injectedTokenVolumeName    = "rolesanywhere-token"
+)
+
+// Where the volumes are mounted in the containers
+const (
+	injectedIdentityDir = "/var/run/rolesanywhere/identity"
+	injectedTokenDir    = "/var/run/rolesanywhere/token"
+)
+
+// Largest AdmissionReview that's read
+const maxAdmissionReviewSize = 8 << 20
+
+// Configuration of a PodInjector
+type PodInjectorOptions struct {
+	// Image of the sidecar, whose entry point is aws_signing_helper
+	Image string
+	// ARNs of the pods that don't annotate their own
+	TrustAnchorArn string
+	ProfileArn     string
+	RoleArn        string
+	// Issuer (and its kind, Issuer by default) of cert-manager's CSI driver
+	// that issues the certificates of pods that don't annotate their
+	// identity. Without one, pods have to annotate it.
+	CSIIssuer     string
+	CSIIssuerKind string
+	// Port of the local endpoint of the sidecar (DefaultPort by default)
+	Port int
+}
+
+// Mutating admission webhook that injects the sidecar into the pods that are
+// annotated with rolesanywhere.amazonaws.com/inject: "true", along with the
+// environment variables and volumes that let their containers obtain
+// credentials from it
+type PodInjector struct {
+	options PodInjectorOptions
+}
+
+// Operation of a JSON patch (RFC 6902), as admission webhooks respond with
+type jsonPatchOperation struct {
+	Op    string      `json:"op"`
+	Path  string      `json:"path"`
+	Value interface{} `json:"value,omitempty"`
+}
+
+// Parts of the AdmissionReview (admission.k8s.io/v1) that the PodInjector
+// reads and writes
+type admissionReview struct {
+	APIVersion string             `json:"apiVersion"`
+	Kind       string             `json:"kind"`
+	Request    *admissionRequest  `json:"request,omitempty"`
+	Response   *admissionResponse `json:"response,omitempty"`
+}
+
+type admissionRequest struct {
+	UID       string          `json:"uid"`
+	Namespace string          `json:"namespace"`
+	Object    json.RawMessage `json:"object"`
+}
+
+type admissionResponse struct {
+	UID       string            `json:"uid"`
+	Allowed   bool              `json:"allowed"`
+	PatchType string            `json:"patchType,omitempty"`
+	Patch     []byte            `json:"patch,omitempty"`
+	Result    *kubernetesStatus `json:"status,omitempty"`
+}
+
+// Parts of a pod that the PodInjector reads
+type injectedPod struct {
+	Metadata struct {
+		Annotations map[string]string `json:"annotations"`
+	} `json:"metadata"`
+	Spec struct {
+		InitContainers []injectedContainer `json:"initContainers"`
+		Containers     []injectedContainer `json:"containers"`
+		Volumes        []struct {
+			Name string `json:"name"`
+		} `json:"volumes"`
+	} `json:"spec"`
+}
+
+type injectedContainer struct {
+	Name string `json:"name"`
+	Env  []struct {
+		Name string `json:"name"`
+	} `json:"env"`
+	VolumeMounts []struct {
+		Name string `json:"name"`
+	} `json:"volumeMounts"`
+}
+
+// Creates a PodInjector
+func NewPodInjector(options PodInjectorOptions) (*PodInjector, error) {
+	if options.Image == "" {
+		return nil, errors.New("the image of the sidecar is required")
+	}
+	if options.Port == 0 {
+		options.Port = DefaultPort
+	}
+	if options.CSIIssuerKind == "" {
+		options.CSIIssuerKind = "Issuer"
+	}
+	return &PodInjector{options: options}, nil
+}
+
+// Responds to the AdmissionReview of a pod with the patch that injects the
+// sidecar (if the pod is annotated for it). Pods whose annotations are
+// invalid are denied, so that the error is reported.
+func (injector *PodInjector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxAdmissionReviewSize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var review admissionReview
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(w, "invalid AdmissionReview", http.StatusBadRequest)
+		return
+	}
+
+	response := &admissionResponse{UID: review.Request.UID, Allowed: true}
+	patch, err := injector.mutate(review.Request.Object)
+	if err != nil {
+		LogWarnf("denied a pod in namespace %s: %s", review.Request.Namespace, err)
+		response.Allowed = false
+		response.Result = &kubernetesStatus{Message: err.Error(), Code: http.StatusBadRequest}
+	} else if patch != nil {
+		response.PatchType = "JSONPatch"
+		response.Patch, _ = json.Marshal(patch)
+		LogInfof("injected the sidecar into a pod in namespace %s", review.Request.Namespace)
+	}
+	buf, _ := json.Marshal(admissionReview{APIVersion: review.APIVersion, Kind: review.Kind, Response: response})
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(buf)
+}
+
+// Returns the JSON patch that injects the sidecar into the pod, or nil if
+// the pod isn't annotated for it (or already has it)
+func (injector *PodInjector) mutate(object []byte) ([]jsonPatchOperation, error) {
+	var pod injectedPod
+	if err := json.Unmarshal(object, &pod); err != nil {
+		return nil, fmt.Errorf("invalid pod: %w", err)
+	}
+	annotation := func(name string) string {
+		return pod.Metadata.Annotations[PodInjectorAnnotationPrefix+name]
+	}
+	if inject, _ := strconv.ParseBool(annotation(podAnnotationInject)); !inject {
+		return nil, nil
+	}
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		if container.Name == injectedContainerName {
+			return nil, nil
+		}
+	}
+
+	arns := []struct {
+		flag, annotation, value string
+	}{
+		{"trust-anchor-arn", podAnnotationTrustAnchorArn, injector.options.TrustAnchorArn},
+		{"profile-arn", podAnnotationProfileArn, injector.options.ProfileArn},
+		{"role-arn", podAnnotationRoleArn, injector.options.RoleArn},
+	}
+	args := []string{"sidecar", "--token-file", injectedTokenDir + "/token", "--port", strconv.Itoa(injector.options.Port)}
+	for _, arn := range arns {
+		value := annotation(arn.annotation)
+		if value == "" {
+			value = arn.value
+		}
+		if value == "" {
+			return nil, fmt.Errorf("the pod has no %s%s annotation, and the injector has no default", PodInjectorAnnotationPrefix,
+				arn.annotation)
+		}
+		args = append(args, "--"+arn.flag, value)
+	}
+
+	identityVolume, secretArgs, err := injector.identity(annotation)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, secretArgs...)
+
+	tokenMount := map[string]interface{}{"name": injectedTokenVolumeName, "mountPath": injectedTokenDir, "readOnly": true}
+	sidecarMounts := []interface{}{map[string]interface{}{"name": injectedTokenVolumeName, "mountPath": injectedTokenDir}}
+	volumes := []interface{}{map[string]interface{}{"name": injectedTokenVolumeName,
+		"emptyDir": map[string]interface{}{"medium": "Memory"}}}
+	if identityVolume != nil {
+		volumes = append(volumes, identityVolume)
+		sidecarMounts = append(sidecarMounts, map[string]interface{}{"name": injectedIdentityVolumeName,
+			"mountPath": injectedIdentityDir, "readOnly": true})
+	}
+	sidecar := map[string]interface{}{
+		"name":          injectedContainerName,
+		"image":         injector.options.Image,
+		"args":          args,
+		"restartPolicy": "Always",
+		"env": []interface{}{
+			map[string]interface{}{"name": "POD_NAME", "valueFrom": map[string]interface{}{
+				"fieldRef": map[string]interface{}{"fieldPath": "metadata.name"}}},
+			map[string]interface{}{"name": "POD_NAMESPACE", "valueFrom": map[string]interface{}{
+				"fieldRef": map[string]interface{}{"fieldPath": "metadata.namespace"}}},
+		},
+		"volumeMounts": sidecarMounts,
+		"securityContext": map[string]interface{}{
+			"allowPrivilegeEscalation": false,
+			"readOnlyRootFilesystem":   true,
+		},
+	}
+
+	var patch []jsonPatchOperation
+	// The sidecar is started before the other init containers, so that they
+	// can obtain credentials as well
+	if len(pod.Spec.InitContainers) == 0 {
+		patch = append(patch, jsonPatchOperation{"add", "/spec/initContainers", []interface{}{sidecar}})
+	} else {
+		patch = append(patch, jsonPatchOperation{"add", "/spec/initContainers/0", sidecar})
+	}
+	patch = appendJSONPatch(patch, "/spec/volumes", pod.Spec.Volumes != nil, volumes)
+
+	selected := map[string]bool{}
+	for _, name := range strings.Split(annotation(podAnnotationContainers), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			selected[name] = true
+		}
+	}
+	for i, container := range pod.Spec.Containers {
+		if len(selected) > 0 && !selected[container.Name] {
+			continue
+		}
+		delete(selected, container.Name)
+		hasEnv := map[string]bool{}
+		for _, variable := range container.Env {
+			hasEnv[variable.Name] = true
+		}
+		var env []interface{}
+		for _, variable := range []struct{ name, value string }{
+			{"AWS_CONTAINER_CREDENTIALS_FULL_URI", fmt.Sprintf("http://127.0.0.1:%d%s", injector.options.Port, ContainerCredentialsPath)},
+			{"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", injectedTokenDir + "/token"},
+		} {
+			// Containers that set the variables obtain credentials in their
+			// own way
+			if !hasEnv[variable.name] {
+				env = append(env, map[string]interface{}{"name": variable.name, "value": variable.value})
+			}
+		}
+		path := fmt.Sprintf("/spec/containers/%d", i)
+		patch = appendJSONPatch(patch, path+"/env", container.Env != nil, env)
+		patch = appendJSONPatch(patch, path+"/volumeMounts", container.VolumeMounts != nil, []interface{}{tokenMount})
+	}
+	if len(selected) > 0 {
+		var missing []string
+		for name := range selected {
+			missing = append(missing, name)
+		}
+		sort.Strings(missing)
+		return nil, fmt.Errorf("the pod has no container named %s (in its %s%s annotation)", strings.Join(missing, ", "),
+			PodInjectorAnnotationPrefix, podAnnotationContainers)
+	}
+	return patch, nil
+}
+
+// Appends the operations that add the values to the array at the path, which
+// is created if the object doesn't have it
+func appendJSONPatch(patch []jsonPatchOperation, path string, exists bool, values []interface{}) []jsonPatchOperation {
+	if len(values) == 0 {
+		return patch
+	}
+	if !exists {
+		return append(patch, jsonPatchOperation{"add", path, values})
+	}
+	for _, value := range values {
+		patch = append(patch, jsonPatchOperation{"add", path + "/-", value})
+	}
+	return patch
+}
+
+// Returns the volume of the identity of the sidecar (if it's mounted) and the
+// flags that select it, from the annotations of the pod (or the default CSI
+// issuer)
+func (injector *PodInjector) identity(annotation func(string) string) (map[string]interface{}, []string, error) {
+	var set []string
+	for _, name := range []string{podAnnotationIdentitySecret, podAnnotationKubernetesSecret, podAnnotationCSIIssuer} {
+		if annotation(name) != "" {
+			set = append(set, PodInjectorAnnotationPrefix+name)
+		}
+	}
+	if len(set) > 1 {
+		return nil, nil, fmt.Errorf("the pod has more than one identity annotation (%s)", strings.Join(set, ", "))
+	}
+
+	certificateDir := []string{"--certificate-dir", injectedIdentityDir}
+	if secret := annotation(podAnnotationIdentitySecret); secret != "" {
+		return map[string]interface{}{"name": injectedIdentityVolumeName,
+			"secret": map[string]interface{}{"secretName": secret}}, certificateDir, nil
+	}
+	if secret := annotation(podAnnotationKubernetesSecret); secret != "" {
+		return nil, []string{"--kubernetes-secret", secret}, nil
+	}
+	issuer, issuerKind := annotation(podAnnotationCSIIssuer), annotation(podAnnotationCSIIssuerKind)
+	if issuer == "" {
+		issuer = injector.options.CSIIssuer
+		if issuerKind == "" {
+			issuerKind = injector.options.CSIIssuerKind
+		}
+	}
+	if issuer == "" {
+		return nil, nil, fmt.Errorf("the pod has no identity annotation (%s%s, %s%s, or %s%s), and the injector has no "+
+			"default CSI issuer", PodInjectorAnnotationPrefix, podAnnotationIdentitySecret, PodInjectorAnnotationPrefix,
+			podAnnotationKubernetesSecret, PodInjectorAnnotationPrefix, podAnnotationCSIIssuer)
+	}
+	if issuerKind == "" {
+		issuerKind = "Issuer"
+	}
+	return map[string]interface{}{"name": injectedIdentityVolumeName, "csi": map[string]interface{}{
+		"driver":   "csi.cert-manager.io",
+		"readOnly": true,
+		"volumeAttributes": map[string]interface{}{
+			"csi.cert-manager.io/issuer-name": issuer,
+			"csi.cert-manager.io/issuer-kind": issuerKind,
+			"csi.cert-manager.io/common-name": "${SERVICE_ACCOUNT_NAME}.${POD_NAMESPACE}",
+		},
+	}}, certificateDir, nil
+}
@@ -0,0 +1,174 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// Applies the add operations of a JSON patch to the object, as the API
+// server would
+func applyTestJSONPatch(t *testing.T, object interface{}, patch []jsonPatchOperation) interface{} {
+	var add func(node interface{}, path []string, value interface{}) interface{}
+	add = func(node interface{}, path []string, value interface{}) interface{} {
+		switch node := node.(type) {
+		case map[string]interface{}:
+			if len(path) == 1 {
+				node[path[0]] = value
+			} else {
+				node[path[0]] = add(node[path[0]], path[1:], value)
+			}
+			return node
+		case []interface{}:
+			if path[0] == "-" && len(path) == 1 {
+				return append(node, value)
+			}
+			i, err := strconv.Atoi(path[0])
+			if err != nil || i > len(node) {
+				t.Fatalf("invalid index %s", path[0])
+			}
+			if len(path) == 1 {
+				return append(node[:i], append([]interface{}{value}, node[i:]...)...)
+			}
+			node[i] = add(node[i], path[1:], value)
+			return node
+		}
+		t.Fatalf("no parent for %v", path)
+		return nil
+	}
+	for _, operation := range patch {
+		if operation.Op != "add" {
+			t.Fatalf("unexpected operation: %v", operation)
+		}
+		// Values are compared after a round trip through JSON, as the API
+		// server receives them
+		buf, _ := json.Marshal(operation.Value)
+		var value interface{}
+		json.Unmarshal(buf, &value)
+		object = add(object, strings.Split(operation.Path, "/")[1:], value)
+	}
+	return object
+}
+
+func TestPodInjector(t *testing.T) {
+	injector, err := NewPodInjector(PodInjectorOptions{Image: "example.com/aws_signing_helper:1.4.0",
+		TrustAnchorArn: "arn:aws:rolesanywhere:us-east-1:123456789012:trust-anchor/ta",
+		ProfileArn:     "arn:aws:rolesanywhere:us-east-1:123456789012:profile/profile",
+		CSIIssuer:      "rolesanywhere-ca", CSIIssuerKind: "ClusterIssuer"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	review := func(pod string) admissionReview {
+		body := `{"apiVersion":"admission.k8s.io/v1","kind":"AdmissionReview","request":{"uid":"uid","namespace":"ns",` +
+			`"object":` + pod + `}}`
+		recorder := httptest.NewRecorder()
+		injector.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/mutate", strings.NewReader(body)))
+		var response admissionReview
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil || response.Response == nil {
+			t.Fatalf("invalid response: %s", recorder.Body.String())
+		}
+		if response.Response.UID != "uid" || response.Kind != "AdmissionReview" {
+			t.Errorf("unexpected response: %s", recorder.Body.String())
+		}
+		return response
+	}
+
+	pod := `{"metadata":{"annotations":{"rolesanywhere.amazonaws.com/inject":"true",` +
+		`"rolesanywhere.amazonaws.com/role-arn":"arn:aws:iam::123456789012:role/app"}},` +
+		`"spec":{"initContainers":[{"name":"migrate"}],"containers":[{"name":"app","env":[{"name":"A","value":"b"}]},` +
+		`{"name":"proxy","volumeMounts":[{"name":"config","mountPath":"/etc/proxy"}]}],"volumes":[{"name":"config"}]}}`
+	response := review(pod)
+	if !response.Response.Allowed || response.Response.PatchType != "JSONPatch" {
+		t.Fatalf("unexpected response: %+v", response.Response)
+	}
+	var patch []jsonPatchOperation
+	if err := json.Unmarshal(response.Response.Patch, &patch); err != nil {
+		t.Fatal(err)
+	}
+	var object interface{}
+	json.Unmarshal([]byte(pod), &object)
+	object = applyTestJSONPatch(t, object, patch)
+	var patched struct {
+		Spec struct {
+			InitContainers []struct {
+				Name          string   `json:"name"`
+				Args          []string `json:"args"`
+				RestartPolicy string   `json:"restartPolicy"`
+			} `json:"initContainers"`
+			Containers []struct {
+				Name string `json:"name"`
+				Env  []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"env"`
+				VolumeMounts []struct {
+					Name string `json:"name"`
+				} `json:"volumeMounts"`
+			} `json:"containers"`
+			Volumes []struct {
+				Name string `json:"name"`
+				CSI  struct {
+					VolumeAttributes map[string]string `json:"volumeAttributes"`
+				} `json:"csi"`
+			} `json:"volumes"`
+		} `json:"spec"`
+	}
+	buf, _ := json.Marshal(object)
+	json.Unmarshal(buf, &patched)
+	spec := patched.Spec
+	if len(spec.InitContainers) != 2 || spec.InitContainers[0].Name != "rolesanywhere" ||
+		spec.InitContainers[0].RestartPolicy != "Always" || spec.InitContainers[1].Name != "migrate" {
+		t.Fatalf("unexpected init containers: %s", buf)
+	}
+	args := strings.Join(spec.InitContainers[0].Args, " ")
+	for _, arg := range []string{"sidecar ", "--role-arn arn:aws:iam::123456789012:role/app",
+		"--trust-anchor-arn arn:aws:rolesanywhere:us-east-1:123456789012:trust-anchor/ta",
+		"--certificate-dir /var/run/rolesanywhere/identity", "--token-file /var/run/rolesanywhere/token/token"} {
+		if !strings.Contains(args, arg) {
+			t.Errorf("the arguments of the sidecar don't have %s: %s", arg, args)
+		}
+	}
+	if len(spec.Volumes) != 3 || spec.Volumes[2].CSI.VolumeAttributes["csi.cert-manager.io/issuer-kind"] != "ClusterIssuer" {
+		t.Errorf("unexpected volumes: %s", buf)
+	}
+	for _, container := range spec.Containers {
+		var env []string
+		for _, variable := range container.Env {
+			env = append(env, variable.Name+"="+variable.Value)
+		}
+		if !slices.Contains(env, "AWS_CONTAINER_CREDENTIALS_FULL_URI=http://127.0.0.1:9911/v1/credentials") ||
+			!slices.Contains(env, "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=/var/run/rolesanywhere/token/token") ||
+			container.VolumeMounts[len(container.VolumeMounts)-1].Name != "rolesanywhere-token" {
+			t.Errorf("container %s wasn't given credentials: %s", container.Name, buf)
+		}
+	}
+
+	// Pods that aren't annotated, and those that have the sidecar already
+	// (when the webhook is invoked again), are left as they are
+	for _, pod := range []string{`{"spec":{"containers":[{"name":"app"}]}}`,
+		`{"metadata":{"annotations":{"rolesanywhere.amazonaws.com/inject":"true"}},"spec":{"initContainers":[{"name":"rolesanywhere"}],"containers":[{"name":"app"}]}}`} {
+		if response := review(pod); !response.Response.Allowed || response.Response.Patch != nil {
+			t.Errorf("unexpected response for %s: %+v", pod, response.Response)
+		}
+	}
+
+	for _, c := range []struct {
+		annotations string
+		message     string
+	}{
+		{`"rolesanywhere.amazonaws.com/inject":"true"`, "no rolesanywhere.amazonaws.com/role-arn annotation"},
+		{`"rolesanywhere.amazonaws.com/inject":"true","rolesanywhere.amazonaws.com/role-arn":"arn","rolesanywhere.amazonaws.com/identity-secret":"tls","rolesanywhere.amazonaws.com/kubernetes-secret":"tls"`,
+			"more than one identity annotation"},
+		{`"rolesanywhere.amazonaws.com/inject":"true","rolesanywhere.amazonaws.com/role-arn":"arn","rolesanywhere.amazonaws.com/containers":"other"`,
+			"no container named other"},
+	} {
+		response := review(`{"metadata":{"annotations":{` + c.annotations + `}},"spec":{"containers":[{"name":"app"}]}}`)
+		if response.Response.Allowed || response.Response.Result == nil || !strings.Contains(response.Response.Result.Message, c.message) {
+			t.Errorf("unexpected response for %s: %+v", c.annotations, response.Response)
+		}
+	}
+}
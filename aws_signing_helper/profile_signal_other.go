@@ -0,0 +1,11 @@
+//go:build !windows
+
+package aws_signing_helper
+
+import (
+	"os"
+	"syscall"
+)
+
+// Signal on which the serve and update commands dump profiles to PprofDir
+var profileDumpSignal os.Signal = syscall.SIGUSR2
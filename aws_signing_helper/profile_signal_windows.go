@@ -0,0 +1,8 @@
+//go:build windows
+
+package aws_signing_helper
+
+import "os"
+
+// Windows doesn't have a signal that profiles could be dumped on
+var profileDumpSignal os.Signal
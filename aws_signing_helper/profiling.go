@@ -0,0 +1,129 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	runtimepprof "runtime/pprof"
+	"strings"
+	"time"
+)
+
+// How long the CPU profile that's dumped on profileDumpSignal covers
+const cpuProfileDumpDuration = 30 * time.Second
+
+// Prefix of PprofAddress for Unix domain sockets
+const unixSocketPrefix = "unix:"
+
+// Starts the pprof endpoints and the profile dumps that the options enable,
+// for the serve and update commands
+func startProfiling(opts *CredentialsOpts) error {
+	if opts.PprofAddress != "" {
+		listener, err := listenPprof(opts.PprofAddress)
+		if err != nil {
+			return fmt.Errorf("unable to listen for profiling requests: %w", err)
+		}
+		server := &http.Server{
+			Handler:  pprofHandler(),
+			ErrorLog: serverErrorLog(),
+		}
+		go server.Serve(listener)
+		LogInfof("serving pprof endpoints on %s", opts.PprofAddress)
+	}
+	if opts.PprofDir != "" {
+		if profileDumpSignal == nil {
+			return fmt.Errorf("profiles can't be dumped on a signal on %s (use the pprof address instead)", runtime.GOOS)
+		}
+		if err := os.MkdirAll(opts.PprofDir, 0700); err != nil {
+			return fmt.Errorf("unable to create the profile directory: %w", err)
+		}
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, profileDumpSignal)
+		go func() {
+			for range signals {
+				dumpProfiles(opts.PprofDir)
+			}
+		}()
+	}
+	return nil
+}
+
+// Returns the handler of the pprof endpoints, under /debug/pprof/. The
+// command line isn't served, since it can hold the key password or PIN.
+func pprofHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/debug/pprof/cmdline" {
+			http.NotFound(w, r)
+			return
+		}
+		pprof.Index(w, r)
+	})
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// Listens on a Unix domain socket (unix:/path) that only the current user
+// can connect to, or on a loopback address and port. Profiles reveal the
+// internals of the process, so other hosts can't be allowed to fetch them.
+func listenPprof(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, unixSocketPrefix); ok {
+		// A socket that's left over from an earlier process is replaced
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		listener, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err = os.Chmod(path, 0600); err != nil {
+			listener.Close()
+			return nil, err
+		}
+		return listener, nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !isLoopbackAddress(host) {
+		return nil, errors.New("the pprof address must be a loopback address or a Unix domain socket (unix:/path)")
+	}
+	return net.Listen("tcp", address)
+}
+
+// Writes a heap profile, and a CPU profile of the next
+// cpuProfileDumpDuration, to the directory. Failures are logged, since
+// they're only diagnostics.
+func dumpProfiles(dir string) {
+	timestamp := time.Now().UTC().Format("20060102T150405Z")
+	LogInfof("writing a heap profile, and a CPU profile of the next %s, to %s", cpuProfileDumpDuration, dir)
+	var heap bytes.Buffer
+	if err := runtimepprof.Lookup("heap").WriteTo(&heap, 0); err != nil {
+		LogWarnf("unable to write the heap profile: %s", err)
+	} else if err = writeFileAtomic(filepath.Join(dir, "heap-"+timestamp+".pprof"), heap.Bytes()); err != nil {
+		LogWarnf("unable to write the heap profile: %s", err)
+	}
+
+	var cpu bytes.Buffer
+	if err := runtimepprof.StartCPUProfile(&cpu); err != nil {
+		LogWarnf("unable to start the CPU profile: %s", err)
+		return
+	}
+	time.AfterFunc(cpuProfileDumpDuration, func() {
+		runtimepprof.StopCPUProfile()
+		if err := writeFileAtomic(filepath.Join(dir, "cpu-"+timestamp+".pprof"), cpu.Bytes()); err != nil {
+			LogWarnf("unable to write the CPU profile: %s", err)
+		}
+	})
+}
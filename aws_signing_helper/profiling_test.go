@@ -0,0 +1,54 @@
+package aws_signing_helper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestPprofEndpoints(t *testing.T) {
+	if _, err := listenPprof("0.0.0.0:0"); err == nil {
+		t.Error("pprof endpoints were served on an address that isn't a loopback address")
+	}
+
+	listener, err := listenPprof("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewUnstartedServer(pprofHandler())
+	server.Listener.Close()
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+	for path, status := range map[string]int{
+		"/debug/pprof/":                  http.StatusOK,
+		"/debug/pprof/heap":              http.StatusOK,
+		"/debug/pprof/goroutine?debug=1": http.StatusOK,
+		"/debug/pprof/cmdline":           http.StatusNotFound,
+	} {
+		response, err := http.Get(server.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		response.Body.Close()
+		if response.StatusCode != status {
+			t.Errorf("unexpected status for %s: %d", path, response.StatusCode)
+		}
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	path := filepath.Join(t.TempDir(), "pprof.sock")
+	listener, err = listenPprof(unixSocketPrefix + path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("unexpected permissions of the socket: %v (%v)", info.Mode(), err)
+	}
+}
@@ -0,0 +1,120 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/aws/smithy-go/logging"
+)
+
+const redacted = "REDACTED"
+
+// Patterns that match secrets within debug output, along with what they are
+// replaced with. Certificates aren't redacted, since they are public and are
+// usually needed to troubleshoot authentication failures.
+var redactions = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	// Credentials in JSON (such as the CreateSession response body, and the
+	// responses of the local server of the serve command)
+	{regexp.MustCompile(`(?i)("(?:secretAccessKey|sessionToken|token)"\s*:\s*)"[^"]*"`), `${1}"` + redacted + `"`},
+	// Credentials in environment variables and in the AWS credentials file
+	{regexp.MustCompile(`(?im)^((?:export |\$env:)?AWS_(?:SECRET_ACCESS_KEY|SESSION_TOKEN)\s*=\s*)\S*`), "${1}" + redacted},
+	{regexp.MustCompile(`(?im)^(\s*aws_(?:secret_access_key|session_token)\s*=\s*)\S*`), "${1}" + redacted},
+	// PINs in PKCS#11 URIs, and session tokens in query strings
+	{regexp.MustCompile(`(?i)(pin-value=)[^&;\s"']*`), "${1}" + redacted},
+	{regexp.MustCompile(`(?i)(X-Amz-Security-Token=)[^&\s"']*`), "${1}" + redacted},
+	// Passwords in URLs (such as those of proxies)
+	{regexp.MustCompile(`(?i)(\b[a-z][a-z0-9+.-]*://[^/\s:@]+:)[^/\s@]+@`), "${1}" + redacted + "@"},
+	// Signatures in the Authorization header
+	{regexp.MustCompile(`(Signature=)[0-9a-fA-F]+`), "${1}" + redacted},
+	// Session tokens in headers
+	{regexp.MustCompile(`(?im)^(X-Amz-Security-Token:[ \t]*)[^\r\n]*`), "${1}" + redacted},
+	// Private keys, in case they end up in an error message
+	{regexp.MustCompile(`(?s)-----BEGIN ([A-Z ]*)PRIVATE KEY-----.*?-----END ([A-Z ]*)PRIVATE KEY-----`), "-----BEGIN ${1}PRIVATE KEY-----\n" + redacted + "\n-----END ${2}PRIVATE KEY-----"},
+}
+
+// Secrets shorter than this aren't redacted verbatim, since too much else
+// would match them
+const minimumRedactedSecretLength = 4
+
+// Passwords and PINs that were passed in or prompted for, which are redacted
+// wherever they appear, since they don't follow a pattern
+var secretValues struct {
+	sync.RWMutex
+	values []string
+}
+
+// Registers a password or PIN, so that Redact redacts it
+func registerSecret(secret string) {
+	if len(secret) < minimumRedactedSecretLength {
+		return
+	}
+	secretValues.Lock()
+	defer secretValues.Unlock()
+	for _, value := range secretValues.values {
+		if value == secret {
+			return
+		}
+	}
+	secretValues.values = append(secretValues.values, secret)
+	// Longer secrets are redacted first, in case they contain shorter ones
+	sort.Slice(secretValues.values, func(i, j int) bool {
+		return len(secretValues.values[i]) > len(secretValues.values[j])
+	})
+}
+
+// Redacts secrets (temporary credentials, signatures, key material, and the
+// passwords and PINs that are in use) from the string, so that debug output
+// can be shared when troubleshooting. Log messages and errors that the
+// command reports are redacted.
+func Redact(s string) string {
+	for _, redaction := range redactions {
+		s = redaction.pattern.ReplaceAllString(s, redaction.replacement)
+	}
+	secretValues.RLock()
+	defer secretValues.RUnlock()
+	for _, value := range secretValues.values {
+		s = strings.ReplaceAll(s, value, redacted)
+	}
+	return s
+}
+
+// Writer that redacts what's written to it, for loggers that don't log
+// through the functions of this package (such as that of net/http servers)
+type redactingWriter struct {
+	w io.Writer
+}
+
+func (w redactingWriter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(w.w, Redact(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Reports a panic with its value and stack trace redacted, and exits with
+// status 2 (as the Go runtime does). It's meant to be deferred by main and
+// by goroutines whose panics could carry secrets.
+func RedactPanic() {
+	if r := recover(); r != nil {
+		fmt.Fprintf(os.Stderr, "panic: %s\n\n%s", Redact(fmt.Sprint(r)), Redact(string(debug.Stack())))
+		ZeroizeSecrets()
+		os.Exit(2)
+	}
+}
+
+// Logger for the SDK that redacts secrets from the requests and responses
+// that are logged when debugging is enabled
+type redactingLogger struct{}
+
+func (redactingLogger) Logf(classification logging.Classification, format string, v ...interface{}) {
+	transportLog.debugf("SDK %s %s", classification, Redact(fmt.Sprintf(format, v...)))
+}
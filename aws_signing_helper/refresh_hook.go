@@ -0,0 +1,40 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"time"
+)
+
+// Environment variables that are set for the command run after each refresh
+const (
+	RefreshHookProfileEnvVarName    = "ROLESANYWHERE_REFRESH_PROFILE"
+	RefreshHookExpirationEnvVarName = "ROLESANYWHERE_REFRESH_EXPIRATION"
+)
+
+// Runs the command specified through `--on-refresh` after credentials have
+// been refreshed. The command is run through the platform's shell, with the
+// profile that was updated (if any), the expiration of the new credentials,
+// and the credentials themselves made available through the environment, so
+// that it can reload or reconfigure whatever consumes the credentials.
+func RunRefreshHook(command string, profile string, cred *TemporaryCredential) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd", "/C", command)
+	} else {
+		cmd = exec.Command("/bin/sh", "-c", command)
+	}
+
+	cmd.Env = append(os.Environ(),
+		RefreshHookProfileEnvVarName+"="+profile,
+		RefreshHookExpirationEnvVarName+"="+cred.Expiration.UTC().Format(time.RFC3339),
+		"AWS_ACCESS_KEY_ID="+cred.AccessKeyId,
+		"AWS_SECRET_ACCESS_KEY="+cred.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+cred.SessionToken, // nosemgrep
+	)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
@@ -0,0 +1,44 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdateOnRefresh(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("on-refresh test command requires a POSIX shell")
+	}
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	tmpDir := t.TempDir()
+	hookOutputPath := filepath.Join(tmpDir, "hook-output")
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		OnRefresh: "echo \"$" + RefreshHookProfileEnvVarName + " $" + RefreshHookExpirationEnvVarName +
+			" $AWS_ACCESS_KEY_ID\" > '" + hookOutputPath + "'",
+	}
+	t.Setenv(AwsSharedCredentialsFileEnvVarName, filepath.Join(tmpDir, "credentials"))
+
+	Update(credentialsOpts, "test profile", true)
+
+	fileByteContents, err := os.ReadFile(hookOutputPath)
+	if err != nil {
+		t.Log("on-refresh command wasn't run")
+		t.Fail()
+		return
+	}
+	expected := "test profile 2022-07-27T04:36:55Z accessKeyId\n"
+	if string(fileByteContents) != expected {
+		t.Log("unexpected on-refresh command environment:", string(fileByteContents))
+		t.Fail()
+	}
+}
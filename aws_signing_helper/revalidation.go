@@ -0,0 +1,71 @@
+package aws_signing_helper
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// Fingerprints (see revalidationFingerprint) of the inputs that credentials
+// were obtained with, and whose certificate chain therefore was verified
+var validatedIdentities sync.Map
+
+// Returns the fingerprint of the inputs that the verification of the
+// certificate chain depends on (the certificate, its chain, and the version
+// of the trust anchor certificate file), and whether the chain has to be
+// verified, because credentials weren't obtained with them yet. The
+// fingerprint is empty if the inputs can't be fingerprinted (for example,
+// because the trust anchor certificate file was just written), in which case
+// the chain is always verified. The validity period, revocation status, and
+// (when the signer is created) key usages of the certificates are still
+// checked each time.
+func revalidationFingerprint(opts *CredentialsOpts, signer Signer) (string, bool) {
+	if opts.TrustAnchorCertificate == "" {
+		return "", true
+	}
+	certificate, err := signer.Certificate()
+	if err != nil || certificate == nil {
+		return "", true
+	}
+	chain, err := signer.CertificateChain()
+	if err != nil {
+		return "", true
+	}
+
+	digest := sha256.New()
+	writeFingerprintField(digest, []byte(opts.TrustAnchorCertificate))
+	id := opts.TrustAnchorCertificate
+	if !strings.HasPrefix(id, "http://") && !strings.HasPrefix(id, "https://") {
+		// Downloaded trust anchor certificates are only downloaded once per
+		// process anyway
+		versions, ok := currentFileVersions([]string{id})
+		if !ok {
+			return "", true
+		}
+		for _, version := range versions {
+			writeFingerprintField(digest, binary.BigEndian.AppendUint64(nil, uint64(version.modTime)))
+			writeFingerprintField(digest, binary.BigEndian.AppendUint64(nil, uint64(version.size)))
+		}
+	}
+	if opts.NoCertificateValidityCheck {
+		writeFingerprintField(digest, []byte("no-certificate-validity-check"))
+	}
+	writeFingerprintField(digest, certificate.Raw)
+	for _, issuer := range chain {
+		writeFingerprintField(digest, issuer.Raw)
+	}
+
+	fingerprint := hex.EncodeToString(digest.Sum(nil))
+	_, validated := validatedIdentities.Load(fingerprint)
+	return fingerprint, !validated
+}
+
+// Writes the field to the digest, prefixed with its length, so that the
+// boundaries between fields are part of the fingerprint
+func writeFingerprintField(digest hash.Hash, field []byte) {
+	digest.Write(binary.BigEndian.AppendUint32(nil, uint32(len(field))))
+	digest.Write(field)
+}
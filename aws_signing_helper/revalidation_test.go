@@ -0,0 +1,60 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRevalidationFingerprint(t *testing.T) {
+	opts := CredentialsOpts{
+		PrivateKeyId:     "../credential-process-data/client-key.pem",
+		CertificateId:    "../credential-process-data/client-cert.pem",
+		SkipRevalidation: true,
+	}
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// Without a trust anchor certificate, there's no chain to verify
+	if fingerprint, _ := revalidationFingerprint(&opts, signer); fingerprint != "" {
+		t.Errorf("unexpected fingerprint without a trust anchor certificate: %q", fingerprint)
+	}
+
+	data, err := os.ReadFile("../credential-process-data/root-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts.TrustAnchorCertificate = filepath.Join(t.TempDir(), "root-cert.pem")
+	os.WriteFile(opts.TrustAnchorCertificate, data, 0600)
+	backdate := func(modTime time.Time) {
+		if err := os.Chtimes(opts.TrustAnchorCertificate, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A file that was just written isn't fingerprinted
+	if fingerprint, revalidate := revalidationFingerprint(&opts, signer); fingerprint != "" || !revalidate {
+		t.Errorf("a trust anchor certificate that was just written was fingerprinted: %q", fingerprint)
+	}
+
+	backdate(time.Now().Add(-time.Hour))
+	fingerprint, revalidate := revalidationFingerprint(&opts, signer)
+	if fingerprint == "" || !revalidate {
+		t.Fatal("the chain wasn't verified the first time")
+	}
+	validatedIdentities.Store(fingerprint, struct{}{})
+	defer validatedIdentities.Delete(fingerprint)
+	if again, revalidate := revalidationFingerprint(&opts, signer); again != fingerprint || revalidate {
+		t.Error("the unchanged chain was verified again")
+	}
+
+	// A trust anchor certificate file that was rewritten is verified against
+	backdate(time.Now().Add(-time.Minute))
+	if again, revalidate := revalidationFingerprint(&opts, signer); again == fingerprint || !revalidate {
+		t.Error("the chain wasn't verified against the rewritten trust anchor certificate")
+	}
+}
@@ -0,0 +1,115 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Modes of the revocation checks (see OCSPCheckOff and CRLCheckOff)
+const (
+	revocationCheckOff     = ""
+	revocationCheckWarn    = "warn"
+	revocationCheckEnforce = "enforce"
+)
+
+// How long fetching an OCSP response or a CRL can take
+const revocationTimeout = 10 * time.Second
+
+// Checks whether the certificate of the signer has been revoked, through its
+// OCSP responder and its CRL (as the options specify), and returns an error
+// that wraps ErrCertificateRevoked if it has (or only logs a warning, if the
+// check isn't enforced). The issuer of the certificate has to be in the
+// chain, since OCSP requests identify the certificate by its issuer, and
+// both OCSP responses and CRLs are signed by it.
+func checkRevocation(ctx context.Context, opts *CredentialsOpts, signer Signer, now time.Time) error {
+	if opts.OCSPCheck == revocationCheckOff && opts.CRLCheck == revocationCheckOff {
+		return nil
+	}
+	certificate, err := signer.Certificate()
+	if err != nil || certificate == nil {
+		return nil
+	}
+	chain, _ := signer.CertificateChain()
+	var issuer *x509.Certificate
+	for _, candidate := range chain {
+		if bytes.Equal(candidate.RawSubject, certificate.RawIssuer) && certificate.CheckSignatureFrom(candidate) == nil {
+			issuer = candidate
+			break
+		}
+	}
+	if issuer == nil {
+		LogWarnf("unable to determine whether the certificate with serial number %s has been revoked, since its "+
+			"issuer isn't in the certificate chain", certificate.SerialNumber)
+		return nil
+	}
+
+	checks := []struct {
+		mode  string
+		check func(context.Context, *CredentialsOpts, *x509.Certificate, *x509.Certificate, time.Time) error
+	}{
+		{opts.OCSPCheck, checkOCSPStatus},
+		{opts.CRLCheck, checkCRL},
+	}
+	for _, check := range checks {
+		if check.mode == revocationCheckOff {
+			continue
+		}
+		if err = check.check(ctx, opts, certificate, issuer, now); err != nil {
+			if check.mode == revocationCheckEnforce {
+				return err
+			}
+			LogWarnf("%s", err)
+		}
+	}
+	return nil
+}
+
+func revokedCertificateError(certificate *x509.Certificate, revokedAt time.Time) error {
+	return fmt.Errorf("%w: the certificate with serial number %s, issued to %s, was revoked at %s",
+		ErrCertificateRevoked, certificate.SerialNumber, certificate.Subject, revokedAt.UTC().Format(time.RFC3339))
+}
+
+// Sends a request for an OCSP response or a CRL (or for a trust anchor
+// certificate), and returns the body of the response, which is at most limit
+// bytes
+func fetchRevocationData(ctx context.Context, opts *CredentialsOpts, method string, url string, contentType string,
+	body []byte, limit int64) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, revocationTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	// Server certificates are always verified, since responses that can be
+	// tampered with would defeat the check
+	config := tlsConfig(opts)
+	config.InsecureSkipVerify = false
+	transport := &http.Transport{TLSClientConfig: config}
+	if opts.WithProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	response, err := (&http.Client{Transport: transport}).Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d", url, response.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(response.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("the response of %s is larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
@@ -0,0 +1,185 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// Signer whose certificate and private key are pushed to it by a source that
+// it watches (the SPIFFE Workload API, or a Kubernetes secret), rather than
+// read from files, so that rotated identities are used as soon as they're
+// issued
+type rotatingSigner struct {
+	mu sync.Mutex
+	// Signer of the current identity
+	current            *cryptoSigner
+	signatureAlgorithm string
+	// CA certificates that the source provides along with the identity, if
+	// any
+	cas []*x509.Certificate
+	// Why no identity could be used yet, if none has been
+	err error
+
+	ready     chan struct{}
+	readyOnce sync.Once
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// Runs the function that watches the source until the signer is closed
+func (rotating *rotatingSigner) start(watch func(ctx context.Context)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	rotating.ready = make(chan struct{})
+	rotating.cancel = cancel
+	rotating.done = make(chan struct{})
+	go func() {
+		defer close(rotating.done)
+		watch(ctx)
+	}()
+}
+
+// Waits for the first identity, and returns its signature algorithm. If
+// none is received within the timeout, the signer is closed, and the error
+// that kept it from being used (if any) is returned.
+func (rotating *rotatingSigner) wait(timeout time.Duration) (string, error) {
+	select {
+	case <-rotating.ready:
+	case <-time.After(timeout):
+		rotating.mu.Lock()
+		err := rotating.err
+		rotating.mu.Unlock()
+		rotating.Close()
+		if err == nil {
+			err = errors.New("no response")
+		}
+		return "", err
+	}
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	return rotating.signatureAlgorithm, nil
+}
+
+// Records why no identity could be used, until one can, and returns whether
+// none has been used yet
+func (rotating *rotatingSigner) setError(err error) bool {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current != nil {
+		return false
+	}
+	rotating.err = err
+	return true
+}
+
+// Switches to the certificate (followed by its chain) and private key, which
+// the description names in messages, along with the CA certificates of the
+// source. The key type of the identities that replace the first one can't
+// change, since the signature algorithm was returned along with the signer.
+func (rotating *rotatingSigner) rotate(certificates []*x509.Certificate, privateKey crypto.PrivateKey, cas []*x509.Certificate, description string) error {
+	key, ok := privateKey.(crypto.Signer)
+	if !ok {
+		zeroizePrivateKey(privateKey)
+		return fmt.Errorf("%w: private key of type %T can't sign", ErrUnsupportedAlgorithm, privateKey)
+	}
+	if len(certificates) == 0 {
+		zeroizePrivateKey(privateKey)
+		return fmt.Errorf("the %s has no certificate", description)
+	}
+	signer, signatureAlgorithm, err := NewCryptoSigner(key, certificates[0], certificates[1:])
+	if err != nil {
+		zeroizePrivateKey(privateKey)
+		return err
+	}
+
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	rotating.cas = cas
+	previous := rotating.current
+	if previous != nil {
+		if previous.certificate.Equal(certificates[0]) {
+			// Something else about the source changed (such as the CA
+			// bundle, or the metadata of a secret)
+			zeroizePrivateKey(privateKey)
+			return nil
+		}
+		if signatureAlgorithm != rotating.signatureAlgorithm {
+			zeroizePrivateKey(privateKey)
+			return fmt.Errorf("the rotated %s has a key of another type", description)
+		}
+		zeroizePrivateKey(previous.signer)
+		signerLog.infof("received the rotated %s (serial number %s, expires at %s)", description,
+			certificates[0].SerialNumber, certificates[0].NotAfter.UTC().Format(time.RFC3339))
+	} else {
+		signerLog.debugf("received the %s (serial number %s)", description, certificates[0].SerialNumber)
+	}
+	rotating.current = signer.(*cryptoSigner)
+	rotating.signatureAlgorithm = signatureAlgorithm
+	rotating.err = nil
+	rotating.readyOnce.Do(func() { close(rotating.ready) })
+	return nil
+}
+
+// Returns the CA certificates that the source provides along with the
+// identity, which the chain is verified against (unless a trust anchor
+// certificate is set)
+func (rotating *rotatingSigner) caCertificates() []*x509.Certificate {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	return rotating.cas
+}
+
+func (rotating *rotatingSigner) Public() crypto.PublicKey {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current == nil {
+		return nil
+	}
+	return rotating.current.Public()
+}
+
+// Signs with the current private key. The lock is held while signing, since
+// the previous key is zeroized once it's rotated.
+func (rotating *rotatingSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current == nil {
+		return nil, errors.New("the signer was closed")
+	}
+	return rotating.current.Sign(rand, digest, opts)
+}
+
+func (rotating *rotatingSigner) Certificate() (*x509.Certificate, error) {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current == nil {
+		return nil, errors.New("the signer was closed")
+	}
+	return rotating.current.Certificate()
+}
+
+func (rotating *rotatingSigner) CertificateChain() ([]*x509.Certificate, error) {
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current == nil {
+		return nil, errors.New("the signer was closed")
+	}
+	return rotating.current.CertificateChain()
+}
+
+// Stops watching the source, and zeroizes the private key
+func (rotating *rotatingSigner) Close() {
+	rotating.cancel()
+	<-rotating.done
+	rotating.mu.Lock()
+	defer rotating.mu.Unlock()
+	if rotating.current != nil {
+		zeroizePrivateKey(rotating.current.signer)
+		rotating.current = nil
+	}
+}
@@ -0,0 +1,101 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"errors"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+)
+
+// Files (and directories) that the serve command needs after it has
+// entered the sandbox, and whether they're written to
+type sandboxPath struct {
+	path  string
+	write bool
+}
+
+// Returned (wrapped) when the sandbox can't be entered on this platform
+var errSandboxUnsupported = errors.New("sandboxing isn't supported on this platform")
+
+// Loads what's loaded lazily from files that the sandbox doesn't allow
+// access to (the system root certificates and the local time zone), so
+// that it's cached before the sandbox is entered, and creates the CRL cache
+// directory
+func prepareSandbox(opts *CredentialsOpts) {
+	x509.SystemCertPool()
+	time.Now().Local().Zone()
+	if opts.CRLCacheDir != "" && opts.CRLCheck != CRLCheckOff && opts.CRLFile == "" {
+		os.MkdirAll(opts.CRLCacheDir, 0700)
+	}
+}
+
+// Returns the files that the serve command keeps reading (and writing) after
+// it has entered the sandbox: the identity material (which is read each time
+// that credentials are refreshed), the CRL and its cache, the files of the
+// AWS SDK and the DNS resolver, and TPM devices. Paths that don't exist
+// (including PKCS#11 URIs and TPM handles) are left out.
+func sandboxPaths(opts *CredentialsOpts) []sandboxPath {
+	var paths []sandboxPath
+	add := func(path string, write bool) {
+		if path == "" || path == StdinIdentityId {
+			return
+		}
+		if _, err := os.Stat(path); err == nil {
+			paths = append(paths, sandboxPath{path, write})
+		}
+	}
+
+	add(opts.CertificateId, false)
+	add(opts.PrivateKeyId, false)
+	add(opts.CertificateBundleId, false)
+	if network, path, err := parseWorkloadAPIAddress(opts.SpiffeEndpointSocket); err == nil && network == "unix" {
+		// Connecting to the socket of the Workload API requires write access
+		// to it, as far as unveil is concerned
+		add(path, true)
+	}
+	if opts.KubernetesSecret != "" {
+		// The service account token is read for each request to the API
+		// server
+		add(serviceAccountDir, false)
+	}
+	add(opts.TrustAnchorCertificate, false)
+	if opts.CRLCheck != CRLCheckOff {
+		add(opts.CRLFile, false)
+		if opts.CRLFile == "" {
+			add(opts.CRLCacheDir, true)
+		}
+	}
+	add(config.DefaultSharedConfigFilename(), false)
+	add(config.DefaultSharedCredentialsFilename(), false)
+	for _, name := range []string{"AWS_CONFIG_FILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CA_BUNDLE"} {
+		add(os.Getenv(name), false)
+	}
+	for _, path := range []string{"/etc/resolv.conf", "/etc/hosts", "/etc/nsswitch.conf"} {
+		add(path, false)
+	}
+	if usesTPM(opts) {
+		add("/dev/tpmrm0", true)
+		add("/dev/tpm0", true)
+	}
+	return paths
+}
+
+// Whether the signer is backed by a TPM (through a persistent handle or a
+// TSS2 key file)
+func usesTPM(opts *CredentialsOpts) bool {
+	if strings.HasPrefix(opts.PrivateKeyId, "handle:") {
+		return true
+	}
+	_, err := parseDERFromPEM(opts.PrivateKeyId, "TSS2 PRIVATE KEY")
+	return opts.PrivateKeyId != "" && err == nil
+}
+
+// Whether the signer is backed by a PKCS#11 module, whose file accesses
+// can't be known in advance
+func usesPKCS11(opts *CredentialsOpts) bool {
+	return opts.LibPkcs11 != "" || strings.HasPrefix(opts.PrivateKeyId, "pkcs11:") ||
+		strings.HasPrefix(opts.CertificateId, "pkcs11:")
+}
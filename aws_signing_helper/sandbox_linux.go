@@ -0,0 +1,186 @@
+//go:build linux
+
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// System calls that the serve command makes after it has entered the sandbox
+// (those of the Go runtime, networking, and reading identity material), on
+// all architectures. Others fail with EPERM; in particular, processes can't
+// be executed or traced.
+var sandboxSyscalls = []uintptr{
+	unix.SYS_READ, unix.SYS_WRITE, unix.SYS_READV, unix.SYS_WRITEV, unix.SYS_PREAD64, unix.SYS_PWRITE64,
+	unix.SYS_OPENAT, unix.SYS_CLOSE, unix.SYS_FSTAT, unix.SYS_NEWFSTATAT, unix.SYS_STATX, unix.SYS_LSEEK,
+	unix.SYS_FCNTL, unix.SYS_IOCTL, unix.SYS_DUP, unix.SYS_DUP3, unix.SYS_PIPE2, unix.SYS_GETDENTS64,
+	unix.SYS_READLINKAT, unix.SYS_FACCESSAT, unix.SYS_FACCESSAT2, unix.SYS_GETCWD, unix.SYS_FSYNC,
+	unix.SYS_FDATASYNC, unix.SYS_FTRUNCATE, unix.SYS_MKDIRAT, unix.SYS_RENAMEAT2,
+	unix.SYS_UNLINKAT, unix.SYS_FCHMOD, unix.SYS_FCHMODAT, unix.SYS_UTIMENSAT, unix.SYS_UMASK,
+	unix.SYS_MMAP, unix.SYS_MUNMAP, unix.SYS_MPROTECT, unix.SYS_MREMAP, unix.SYS_MADVISE, unix.SYS_BRK,
+	unix.SYS_MLOCK, unix.SYS_MUNLOCK, unix.SYS_MINCORE, unix.SYS_MEMBARRIER,
+	unix.SYS_RT_SIGACTION, unix.SYS_RT_SIGPROCMASK, unix.SYS_RT_SIGRETURN, unix.SYS_SIGALTSTACK,
+	unix.SYS_TGKILL, unix.SYS_TKILL, unix.SYS_GETPID, unix.SYS_GETTID, unix.SYS_GETPPID,
+	unix.SYS_CLONE, unix.SYS_CLONE3, unix.SYS_SET_ROBUST_LIST, unix.SYS_SET_TID_ADDRESS, unix.SYS_RSEQ,
+	unix.SYS_EXIT, unix.SYS_EXIT_GROUP, unix.SYS_FUTEX, unix.SYS_NANOSLEEP, unix.SYS_CLOCK_NANOSLEEP,
+	unix.SYS_CLOCK_GETTIME, unix.SYS_CLOCK_GETRES, unix.SYS_GETTIMEOFDAY, unix.SYS_SCHED_YIELD,
+	unix.SYS_SCHED_GETAFFINITY, unix.SYS_GETRANDOM, unix.SYS_RESTART_SYSCALL, unix.SYS_UNAME,
+	unix.SYS_SYSINFO, unix.SYS_PRLIMIT64, unix.SYS_GETRUSAGE, unix.SYS_GETUID, unix.SYS_GETEUID,
+	unix.SYS_GETGID, unix.SYS_GETEGID, unix.SYS_GETGROUPS,
+	unix.SYS_EPOLL_CREATE1, unix.SYS_EPOLL_CTL, unix.SYS_EPOLL_PWAIT, unix.SYS_EPOLL_PWAIT2,
+	unix.SYS_EVENTFD2, unix.SYS_PPOLL, unix.SYS_PSELECT6, unix.SYS_SOCKET, unix.SYS_CONNECT,
+	unix.SYS_BIND, unix.SYS_LISTEN, unix.SYS_ACCEPT4, unix.SYS_GETSOCKNAME, unix.SYS_GETPEERNAME,
+	unix.SYS_SETSOCKOPT, unix.SYS_GETSOCKOPT, unix.SYS_SENDTO, unix.SYS_RECVFROM, unix.SYS_SENDMSG,
+	unix.SYS_RECVMSG, unix.SYS_SENDMMSG, unix.SYS_RECVMMSG, unix.SYS_SHUTDOWN,
+}
+
+// Access rights of Landlock ABI version 1, which are all restricted
+const landlockAccessFS = 1<<13 - 1
+
+// Rights that are granted to files that are read, and to those that are
+// written (directories are also granted the rights to list, create, and
+// remove files)
+const (
+	landlockReadFile  = unix.LANDLOCK_ACCESS_FS_READ_FILE
+	landlockWriteFile = landlockReadFile | unix.LANDLOCK_ACCESS_FS_WRITE_FILE
+	landlockReadDir   = landlockReadFile | unix.LANDLOCK_ACCESS_FS_READ_DIR
+	landlockWriteDir  = landlockReadDir | unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+		unix.LANDLOCK_ACCESS_FS_MAKE_REG | unix.LANDLOCK_ACCESS_FS_REMOVE_FILE
+)
+
+// Confines the process: Landlock restricts the files that it can access to
+// those that it needs, and a seccomp filter restricts its system calls.
+// Landlock is skipped (with a warning) if the kernel doesn't support it, if
+// the binary was built with cgo (since it can then only be applied to the
+// calling thread), or for PKCS#11 modules.
+func enterSandbox(opts *CredentialsOpts) error {
+	if sandboxAuditArch == 0 {
+		return fmt.Errorf("%w (%s)", errSandboxUnsupported, runtime.GOARCH)
+	}
+	prepareSandbox(opts)
+
+	if usesPKCS11(opts) {
+		LogWarnf("file access isn't restricted, since the files that the PKCS#11 module accesses aren't known")
+	} else if err := restrictFileAccess(sandboxPaths(opts)); err != nil {
+		LogWarnf("file access isn't restricted: %s", err)
+	}
+	return restrictSyscalls()
+}
+
+// Restricts file access to the paths with Landlock, on all threads
+func restrictFileAccess(paths []sandboxPath) error {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return fmt.Errorf("Landlock isn't supported by the kernel: %w", errno)
+	}
+	LogDebugf("Landlock ABI version %d", abi)
+
+	attr := unix.LandlockRulesetAttr{Access_fs: landlockAccessFS}
+	ruleset, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return errno
+	}
+	defer unix.Close(int(ruleset))
+
+	for _, path := range paths {
+		if err := addLandlockRule(int(ruleset), path); err != nil {
+			return fmt.Errorf("unable to allow access to %s: %w", path.path, err)
+		}
+	}
+
+	if _, _, errno = syscall.AllThreadsSyscall(unix.SYS_PRCTL, unix.PR_SET_NO_NEW_PRIVS, 1, 0); errno != 0 {
+		if errno == syscall.ENOTSUP {
+			return errors.New("Landlock can't be applied to all threads of binaries that are built with cgo")
+		}
+		return errno
+	}
+	if _, _, errno = syscall.AllThreadsSyscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Allows access to the file, or to the files beneath the directory
+func addLandlockRule(ruleset int, path sandboxPath) error {
+	var info unix.Stat_t
+	if err := unix.Stat(path.path, &info); err != nil {
+		return err
+	}
+	directory := info.Mode&unix.S_IFMT == unix.S_IFDIR
+	var access uint64
+	switch {
+	case directory && path.write:
+		access = landlockWriteDir
+	case directory:
+		access = landlockReadDir
+	case path.write:
+		access = landlockWriteFile
+	default:
+		access = landlockReadFile
+	}
+
+	fd, err := unix.Open(path.path, unix.O_PATH|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	attr := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+	_, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, uintptr(ruleset), unix.LANDLOCK_RULE_PATH_BENEATH,
+		uintptr(unsafe.Pointer(&attr)), 0, 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// Installs a seccomp filter on all threads, which only allows the system
+// calls of sandboxSyscalls (and those of the architecture). Other system
+// calls fail with EPERM, and system calls of other architectures (such as
+// 32-bit system calls on amd64) kill the process.
+func restrictSyscalls() error {
+	syscalls := append(append([]uintptr{}, sandboxSyscalls...), sandboxArchSyscalls...)
+	filter := []unix.SockFilter{
+		bpfStatement(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 4), // seccomp_data.arch
+		bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, sandboxAuditArch, 1, 0),
+		bpfStatement(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_KILL_PROCESS),
+		bpfStatement(unix.BPF_LD|unix.BPF_W|unix.BPF_ABS, 0), // seccomp_data.nr
+	}
+	for _, nr := range syscalls {
+		filter = append(filter,
+			bpfJump(unix.BPF_JMP|unix.BPF_JEQ|unix.BPF_K, uint32(nr), 0, 1),
+			bpfStatement(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ALLOW))
+	}
+	filter = append(filter, bpfStatement(unix.BPF_RET|unix.BPF_K, unix.SECCOMP_RET_ERRNO|uint32(unix.EPERM)))
+	program := unix.SockFprog{Len: uint16(len(filter)), Filter: &filter[0]}
+
+	// The filter can only be installed by a thread that can't gain
+	// privileges, and it's synchronized from that thread to the others
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return err
+	}
+	result, _, errno := unix.Syscall(unix.SYS_SECCOMP, unix.SECCOMP_SET_MODE_FILTER, unix.SECCOMP_FILTER_FLAG_TSYNC,
+		uintptr(unsafe.Pointer(&program)))
+	if errno != 0 {
+		return fmt.Errorf("unable to install the seccomp filter: %w", errno)
+	}
+	if result != 0 {
+		return fmt.Errorf("unable to install the seccomp filter on thread %d", result)
+	}
+	return nil
+}
+
+func bpfStatement(code uint16, k uint32) unix.SockFilter {
+	return unix.SockFilter{Code: code, K: k}
+}
+
+func bpfJump(code uint16, k uint32, jt uint8, jf uint8) unix.SockFilter {
+	return unix.SockFilter{Code: code, Jt: jt, Jf: jf, K: k}
+}
@@ -0,0 +1,17 @@
+package aws_signing_helper
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Architecture of the system calls that the seccomp filter allows
+const sandboxAuditArch = unix.AUDIT_ARCH_X86_64
+
+// System calls that the sandbox allows that only exist on amd64 (which the
+// Go runtime and the C library use instead of their newer equivalents)
+var sandboxArchSyscalls = []uintptr{
+	unix.SYS_OPEN, unix.SYS_STAT, unix.SYS_LSTAT, unix.SYS_ACCESS, unix.SYS_READLINK, unix.SYS_PIPE,
+	unix.SYS_DUP2, unix.SYS_POLL, unix.SYS_SELECT, unix.SYS_EPOLL_CREATE, unix.SYS_EPOLL_WAIT,
+	unix.SYS_MKDIR, unix.SYS_RENAME, unix.SYS_UNLINK, unix.SYS_CHMOD, unix.SYS_TIME, unix.SYS_ARCH_PRCTL,
+	unix.SYS_GETRLIMIT, unix.SYS_ACCEPT, unix.SYS_RENAMEAT,
+}
@@ -0,0 +1,13 @@
+package aws_signing_helper
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Architecture of the system calls that the seccomp filter allows
+const sandboxAuditArch = unix.AUDIT_ARCH_AARCH64
+
+// System calls that the sandbox allows that only exist on arm64
+var sandboxArchSyscalls = []uintptr{
+	unix.SYS_GETRLIMIT, unix.SYS_ACCEPT,
+}
@@ -0,0 +1,8 @@
+//go:build linux && !amd64 && !arm64
+
+package aws_signing_helper
+
+// The seccomp filter is only defined for amd64 and arm64
+const sandboxAuditArch = 0
+
+var sandboxArchSyscalls []uintptr
@@ -0,0 +1,40 @@
+//go:build openbsd
+
+package aws_signing_helper
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// Confines the process: unveil restricts the files that it can access to
+// those that it needs, and pledge restricts it to networking and file
+// access, so that it can't execute processes. Files aren't unveiled for
+// PKCS#11 modules, whose file accesses aren't known, and they're also
+// allowed to use Unix domain sockets (for example, to reach pcscd), as is a
+// Workload API that's reached through one.
+func enterSandbox(opts *CredentialsOpts) error {
+	prepareSandbox(opts)
+
+	promises := "stdio rpath wpath cpath inet dns"
+	network, _, err := parseWorkloadAPIAddress(opts.SpiffeEndpointSocket)
+	if usesPKCS11(opts) || (err == nil && network == "unix") {
+		promises += " unix"
+	}
+	if usesPKCS11(opts) {
+		LogWarnf("file access isn't restricted, since the files that the PKCS#11 module accesses aren't known")
+	} else {
+		for _, path := range sandboxPaths(opts) {
+			permissions := "r"
+			if path.write {
+				permissions = "rwc"
+			}
+			if err := unix.Unveil(path.path, permissions); err != nil {
+				return err
+			}
+		}
+		if err := unix.UnveilBlock(); err != nil {
+			return err
+		}
+	}
+	return unix.PledgePromises(promises)
+}
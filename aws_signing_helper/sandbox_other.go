@@ -0,0 +1,14 @@
+//go:build !linux && !openbsd
+
+package aws_signing_helper
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// The sandbox is only implemented with seccomp and Landlock on Linux, and
+// with pledge and unveil on OpenBSD
+func enterSandbox(opts *CredentialsOpts) error {
+	return fmt.Errorf("%w (%s)", errSandboxUnsupported, runtime.GOOS)
+}
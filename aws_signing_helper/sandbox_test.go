@@ -0,0 +1,46 @@
+package aws_signing_helper
+
+import (
+	"net"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// The sandbox can't be left, so it's entered by a copy of the test binary
+func TestSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("the sandbox is only tested on Linux")
+	}
+	opts := CredentialsOpts{
+		PrivateKeyId:  "../credential-process-data/client-key.pem",
+		CertificateId: "../credential-process-data/client-cert.pem",
+	}
+
+	if os.Getenv("TEST_ENTER_SANDBOX") == "" {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestSandbox$", "-test.v")
+		cmd.Env = append(os.Environ(), "TEST_ENTER_SANDBOX=1")
+		output, err := cmd.CombinedOutput()
+		if err != nil || !strings.Contains(string(output), "--- PASS") {
+			t.Fatalf("test in the sandbox failed: %v\n%s", err, output)
+		}
+		return
+	}
+
+	if err := enterSandbox(&opts); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadPrivateKeyData(opts.PrivateKeyId); err != nil {
+		t.Error("unable to read the private key in the sandbox:", err)
+	}
+	if err := exec.Command("/bin/true").Run(); err == nil {
+		t.Error("executed a process in the sandbox")
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("unable to listen in the sandbox:", err)
+	}
+	listener.Close()
+}
@@ -0,0 +1,58 @@
+package aws_signing_helper
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	// Update target that writes credentials to the OS secret store
+	UpdateTargetSecretStore = "secret-store"
+
+	// Service name under which entries are stored in the OS secret store
+	SecretStoreService = "rolesanywhere-credential-helper"
+)
+
+var ErrSecretStoreEntryNotFound = errors.New("secret store entry not found")
+
+// Writes the temporary credential to the OS secret store (Windows Credential
+// Manager, the macOS Keychain, or the Secret Service through libsecret on
+// Linux), under the specified entry name.
+func WriteSecretStoreEntry(entryName string, cred *TemporaryCredential) error {
+	if entryName == "" {
+		return errors.New("invalid secret store entry name")
+	}
+
+	buf, err := json.Marshal(CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     cred.AccessKeyId,
+		SecretAccessKey: cred.SecretAccessKey,
+		SessionToken:    cred.SessionToken, // nosemgrep
+		Expiration:      cred.Expiration.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	return storeSecret(SecretStoreService, entryName, buf)
+}
+
+// Reads the credentials stored under the specified entry name from the OS
+// secret store, in the format used for external credential processes. If the
+// entry doesn't exist, ErrSecretStoreEntryNotFound is returned.
+func ReadSecretStoreEntry(entryName string) (CredentialProcessOutput, error) {
+	var credentialProcessOutput CredentialProcessOutput
+
+	if entryName == "" {
+		return credentialProcessOutput, errors.New("invalid secret store entry name")
+	}
+
+	buf, err := loadSecret(SecretStoreService, entryName)
+	if err != nil {
+		return credentialProcessOutput, err
+	}
+	if err = json.Unmarshal(buf, &credentialProcessOutput); err != nil {
+		return credentialProcessOutput, errors.New("unable to parse secret store entry")
+	}
+	return credentialProcessOutput, nil
+}
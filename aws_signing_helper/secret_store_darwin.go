@@ -0,0 +1,71 @@
+//go:build darwin
+
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Exit status of `security` when the item couldn't be found in the keychain
+// (errSecItemNotFound)
+const securityItemNotFoundExitCode = 44
+
+// Stores the secret as a generic password in the user's default keychain. The
+// `add-generic-password` command is passed to `security` in interactive mode
+// through stdin, rather than as arguments, so that the secret isn't visible in
+// the process list.
+func storeSecret(service string, account string, secret []byte) error {
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n",
+		quoteSecurityArg(service), quoteSecurityArg(account), hex.EncodeToString(secret))
+
+	cmd := exec.Command("/usr/bin/security", "-i")
+	cmd.Stdin = strings.NewReader(command)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return securityError(err, stderr.String())
+	}
+	// In interactive mode, failures of individual commands don't affect the
+	// exit status, so they have to be detected through the output
+	if msg := strings.TrimSpace(stderr.String()); msg != "" {
+		return fmt.Errorf("unable to add keychain item: %s", msg)
+	}
+	return nil
+}
+
+// Looks up the generic password in the user's keychains
+func loadSecret(service string, account string) ([]byte, error) {
+	cmd := exec.Command("/usr/bin/security", "find-generic-password", "-s", service, "-a", account, "-w")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == securityItemNotFoundExitCode {
+			return nil, ErrSecretStoreEntryNotFound
+		}
+		return nil, securityError(err, stderr.String())
+	}
+	return bytes.TrimSuffix(stdout.Bytes(), []byte("\n")), nil
+}
+
+// Quotes an argument for `security` in interactive mode, which splits
+// commands on whitespace unless it appears within double quotes
+func quoteSecurityArg(arg string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	return `"` + replacer.Replace(arg) + `"`
+}
+
+func securityError(err error, stderr string) error {
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("security failed: %s", msg)
+	}
+	return fmt.Errorf("security failed: %w", err)
+}
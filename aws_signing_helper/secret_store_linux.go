@@ -0,0 +1,60 @@
+//go:build linux
+
+package aws_signing_helper
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// Stores the secret through the Secret Service API (GNOME Keyring, KWallet,
+// etc.) using libsecret's `secret-tool`. The secret is passed on stdin, so that
+// it isn't visible in the process list.
+func storeSecret(service string, account string, secret []byte) error {
+	cmd := exec.Command("secret-tool", "store",
+		"--label="+service+" ("+account+")",
+		"service", service,
+		"account", account)
+	cmd.Stdin = bytes.NewReader(secret)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return secretToolError(err, stderr.String())
+	}
+	return nil
+}
+
+// Looks up the secret through the Secret Service API using `secret-tool`
+func loadSecret(service string, account string) ([]byte, error) {
+	cmd := exec.Command("secret-tool", "lookup",
+		"service", service,
+		"account", account)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		// `secret-tool lookup` exits with a non-zero status and doesn't
+		// print anything when there is no matching item
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stdout.Len() == 0 && stderr.Len() == 0 {
+			return nil, ErrSecretStoreEntryNotFound
+		}
+		return nil, secretToolError(err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
+
+func secretToolError(err error, stderr string) error {
+	if errors.Is(err, exec.ErrNotFound) {
+		return errors.New("unable to find secret-tool (part of libsecret), which is required to use the secret store on linux")
+	}
+	if msg := strings.TrimSpace(stderr); msg != "" {
+		return fmt.Errorf("secret-tool failed: %s", msg)
+	}
+	return fmt.Errorf("secret-tool failed: %w", err)
+}
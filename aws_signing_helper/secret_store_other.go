@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !windows
+
+package aws_signing_helper
+
+import "errors"
+
+// Returned when there's no OS secret store on this platform
+var errSecretStoreUnsupported = errors.New("the secret store is only available on Linux, macOS, and Windows")
+
+func storeSecret(service string, account string, secret []byte) error {
+	return errSecretStoreUnsupported
+}
+
+func loadSecret(service string, account string) ([]byte, error) {
+	return nil, errSecretStoreUnsupported
+}
@@ -0,0 +1,65 @@
+package aws_signing_helper
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestUpdateSecretStore(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("test uses a fake secret-tool, which is only used on linux")
+	}
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	credentialsOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+		UpdateTarget:      UpdateTargetSecretStore,
+	}
+
+	// Fake secret-tool that keeps secrets in files named after their attributes
+	binDir := t.TempDir()
+	storeDir := t.TempDir()
+	fakeSecretTool := `#!/bin/sh
+op=$1; shift
+[ "$op" = store ] && shift
+f="` + storeDir + `/$2-$4"
+case $op in
+store) cat > "$f" ;;
+lookup) [ -f "$f" ] || exit 1; cat "$f" ;;
+esac
+`
+	if err := os.WriteFile(filepath.Join(binDir, "secret-tool"), []byte(fakeSecretTool), 0700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	if _, err := ReadSecretStoreEntry("test profile"); err != ErrSecretStoreEntryNotFound {
+		t.Log("expected secret store entry to not exist, got:", err)
+		t.Fail()
+	}
+
+	Update(credentialsOpts, "test profile", true)
+
+	credentialProcessOutput, err := ReadSecretStoreEntry("test profile")
+	if err != nil {
+		t.Log("unable to read secret store entry:", err)
+		t.Fail()
+		return
+	}
+	if credentialProcessOutput.Version != 1 ||
+		credentialProcessOutput.AccessKeyId != "accessKeyId" ||
+		credentialProcessOutput.SecretAccessKey != "secretAccessKey" ||
+		credentialProcessOutput.SessionToken != "sessionToken" ||
+		credentialProcessOutput.Expiration != "2022-07-27T04:36:55Z" {
+		t.Log("unexpected secret store entry contents")
+		t.Fail()
+	}
+}
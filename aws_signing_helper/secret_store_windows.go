@@ -0,0 +1,101 @@
+//go:build windows
+
+package aws_signing_helper
+
+import (
+	"errors"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const (
+	credTypeGeneric         = 1
+	credPersistLocalMachine = 2
+	// CRED_MAX_CREDENTIAL_BLOB_SIZE
+	credMaxCredentialBlobSize = 5 * 512
+)
+
+var (
+	modadvapi32   = windows.NewLazySystemDLL("advapi32.dll")
+	procCredWrite = modadvapi32.NewProc("CredWriteW")
+	procCredRead  = modadvapi32.NewProc("CredReadW")
+	procCredFree  = modadvapi32.NewProc("CredFree")
+)
+
+// Mirrors the CREDENTIALW structure from wincred.h
+type credential struct {
+	Flags              uint32
+	Type               uint32
+	TargetName         *uint16
+	Comment            *uint16
+	LastWritten        windows.Filetime
+	CredentialBlobSize uint32
+	CredentialBlob     *byte
+	Persist            uint32
+	AttributeCount     uint32
+	Attributes         uintptr
+	TargetAlias        *uint16
+	UserName           *uint16
+}
+
+// Returns the target name of the generic credential in Credential Manager
+func credentialTargetName(service string, account string) string {
+	return service + ":" + account
+}
+
+// Stores the secret as a generic credential in Windows Credential Manager,
+// which is persisted for the current user on the local machine.
+func storeSecret(service string, account string, secret []byte) error {
+	if len(secret) == 0 {
+		return errors.New("secret store entry is empty")
+	}
+	if len(secret) > credMaxCredentialBlobSize {
+		return errors.New("credentials are too large to be stored in Windows Credential Manager")
+	}
+
+	targetName, err := windows.UTF16PtrFromString(credentialTargetName(service, account))
+	if err != nil {
+		return err
+	}
+	userName, err := windows.UTF16PtrFromString(account)
+	if err != nil {
+		return err
+	}
+
+	cred := credential{
+		Type:               credTypeGeneric,
+		TargetName:         targetName,
+		CredentialBlobSize: uint32(len(secret)),
+		CredentialBlob:     &secret[0],
+		Persist:            credPersistLocalMachine,
+		UserName:           userName,
+	}
+	ret, _, err := procCredWrite.Call(uintptr(unsafe.Pointer(&cred)), 0)
+	if ret == 0 {
+		return err
+	}
+	return nil
+}
+
+// Reads the generic credential from Windows Credential Manager
+func loadSecret(service string, account string) ([]byte, error) {
+	targetName, err := windows.UTF16PtrFromString(credentialTargetName(service, account))
+	if err != nil {
+		return nil, err
+	}
+
+	var pcred *credential
+	ret, _, err := procCredRead.Call(uintptr(unsafe.Pointer(targetName)), credTypeGeneric, 0, uintptr(unsafe.Pointer(&pcred)))
+	if ret == 0 {
+		if errors.Is(err, windows.ERROR_NOT_FOUND) {
+			return nil, ErrSecretStoreEntryNotFound
+		}
+		return nil, err
+	}
+	defer procCredFree.Call(uintptr(unsafe.Pointer(pcred)))
+
+	secret := make([]byte, pcred.CredentialBlobSize)
+	copy(secret, unsafe.Slice(pcred.CredentialBlob, pcred.CredentialBlobSize))
+	return secret, nil
+}
@@ -0,0 +1,58 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// Payload that's prefixed to the random bytes that are signed by the
+// self-test, so that its signatures can't be mistaken for request signatures
+const selfTestPayloadPrefix = "aws_signing_helper self-test "
+
+// Signs a random payload with the signer, and verifies the signature against
+// the public key of its certificate, as SigV4-X509 signatures are verified by
+// Roles Anywhere. This goes through the whole signing stack (such as the
+// PKCS#11 module or the TPM, and the PIN or password of the key), so that
+// locked tokens or keys that don't match the certificate are caught when a
+// long-running command starts, rather than when credentials are first
+// refreshed.
+func selfTestSigner(signer Signer) error {
+	certificate, err := signer.Certificate()
+	if err != nil || certificate == nil {
+		return err
+	}
+
+	payload := make([]byte, len(selfTestPayloadPrefix)+32)
+	copy(payload, selfTestPayloadPrefix)
+	if _, err = rand.Read(payload[len(selfTestPayloadPrefix):]); err != nil {
+		return err
+	}
+	signature, err := SignPayload(signer, rand.Reader, payload, crypto.SHA256)
+	if err != nil {
+		return fmt.Errorf("the self-test signature failed: %w", err)
+	}
+	digest := sha256.Sum256(payload)
+
+	switch publicKey := certificate.PublicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			err = errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+	default:
+		LogDebugf("skipped the verification of the self-test signature, since the key type isn't supported")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%w: the self-test signature doesn't verify against the public key of the certificate (%s); "+
+			"the private key (or the token that holds it) signs with another key", ErrKeyCertificateMismatch, err)
+	}
+	LogDebugf("the self-test signature was verified")
+	return nil
+}
@@ -0,0 +1,36 @@
+package aws_signing_helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestSelfTestSigner(t *testing.T) {
+	for _, tc := range []struct{ cert, key string }{
+		{"../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key.pem"},
+		{"../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-2048-key.pem"},
+	} {
+		signer, _, err := GetFileSystemSigner(tc.key, tc.cert, "", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = selfTestSigner(signer); err != nil {
+			t.Errorf("self-test of %s failed: %v", tc.key, err)
+		}
+		signer.Close()
+	}
+
+	// A token that signs with another key than the one that it reports
+	_, certificate, err := ReadCertificateData("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	signer := &cryptoSigner{signer: otherKey, certificate: certificate}
+	if err = selfTestSigner(signer); !errors.Is(err, ErrKeyCertificateMismatch) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
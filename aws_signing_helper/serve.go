@@ -1,16 +1,15 @@
 package aws_signing_helper
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"net/http"
-	"os"
 	"strconv"
 	"strings"
 	"sync"
@@ -68,12 +67,20 @@ func GenerateToken(length int) (string, error) {
 		msg := "invalid token length"
 		return "", errors.New(msg)
 	}
-	randomBytes := make([]byte, 128)
+	// The random bytes and their encoding are written to a pooled buffer, so
+	// that only the token itself is allocated
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+	encodedLength := base64.StdEncoding.EncodedLen(128)
+	buffer.Grow(128 + encodedLength)
+	scratch := buffer.AvailableBuffer()[:128+encodedLength]
+	randomBytes, encoded := scratch[:128], scratch[128:]
 	_, err := rand.Read(randomBytes)
 	if err != nil {
 		return "", err
 	}
-	return base64.StdEncoding.EncodeToString(randomBytes)[:length], nil
+	base64.StdEncoding.Encode(encoded, randomBytes)
+	return string(encoded[:length]), nil
 }
 
 // Removes the token that expires the earliest
@@ -90,7 +97,7 @@ func InsertToken(token string, expirationTime time.Time) error {
 		}
 
 		delete(tokenMap, earliestExpiringToken)
-		log.Printf("evicting earliest expiring token: %s", earliestExpiringToken)
+		serverLog.warnf("evicting earliest expiring token: %s", earliestExpiringToken)
 	}
 	tokenMap[token] = expirationTime
 	mutex.Unlock()
@@ -149,6 +156,10 @@ func FindTokenTTLSeconds(r *http.Request) (string, error) {
 }
 
 func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (http.HandlerFunc, http.HandlerFunc, http.HandlerFunc) {
+	return allIssuesHandlers(&servedCredentials{cred: cred}, roleName, opts, signer, signatureAlgorithm)
+}
+
+func allIssuesHandlers(served *servedCredentials, roleName string, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (http.HandlerFunc, http.HandlerFunc, http.HandlerFunc) {
 	// Handles PUT requests to /latest/api/token/
 	putTokenHandler := func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "PUT" {
@@ -220,89 +231,211 @@ func AllIssuesHandlers(cred *RefreshableCred, roleName string, opts *Credentials
 
 		err := CheckValidToken(w, r)
 		if err != nil {
-			log.Printf("Token validation received error: %s\n", err)
+			serverLog.warnf("Token validation received error: %s", err)
 			return
 		}
 
-		var nextRefreshTime = cred.Expiration.Add(-RefreshTime)
-		if time.Until(nextRefreshTime) < RefreshTime {
-			if Debug {
-				log.Println("Generating credentials")
-			}
-			credentialProcessOutput, gcErr := GenerateCredentials(opts, signer, signatureAlgorithm)
-			if gcErr != nil {
-				log.Printf("Error generating credentials: %s\n", gcErr)
-			}
-			cred.AccessKeyId = credentialProcessOutput.AccessKeyId
-			cred.SecretAccessKey = credentialProcessOutput.SecretAccessKey
-			cred.Token = credentialProcessOutput.SessionToken
-			cred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
-			cred.Code = REFRESHABLE_CRED_CODE
-			cred.LastUpdated = time.Now()
-			cred.Type = REFRESHABLE_CRED_TYPE
-			err := json.NewEncoder(w).Encode(cred)
-
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				io.WriteString(w, "failed to encode credentials")
-				return
-			}
-		} else {
-			if Debug {
-				log.Println("Using previously obtained credentials")
-			}
-			err := json.NewEncoder(w).Encode(cred)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				io.WriteString(w, "failed to encode credentials")
-				return
-			}
+		// The correlation ID of the request (which the client may pass in)
+		// is sent back, and is that of the refresh that the request starts
+		correlationId := requestCorrelationId(r.Header.Get(CorrelationIdHeader))
+		w.Header().Set(CorrelationIdHeader, correlationId)
+		r = r.WithContext(WithCorrelationId(r.Context(), correlationId))
+		current, ok := served.get(r, opts, signer, signatureAlgorithm)
+		if !ok {
+			return
+		}
+		// The credentials are encoded into a pooled buffer, and written at once
+		buffer := getBuffer()
+		defer putBuffer(buffer)
+		err = json.NewEncoder(buffer).Encode(current)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "failed to encode credentials")
+			return
 		}
 
+		// Since the body is buffered, the TTL header is sent along with it
 		tokenTTL, err := FindTokenTTLSeconds(r)
 		if err != nil {
 			w.WriteHeader(http.StatusUnauthorized)
 			return
 		}
 		w.Header().Set(EC2_METADATA_TOKEN_TTL_HEADER, tokenTTL)
+		w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+		w.Write(buffer.Bytes())
 	}
 
 	return putTokenHandler, getRoleNameHandler, getCredentialsHandler
 }
 
-func Serve(port int, credentialsOptions CredentialsOpts) {
+// Refresh of the credentials of the local endpoint that's in progress.
+// Requests that arrive while it is wait for it, and are all served the
+// credentials that it obtains, so that a burst of requests (for example, from
+// many local consumers whose credentials expired at the same time) only
+// makes one CreateSession call.
+type credentialsRefresh struct {
+	done chan struct{}
+	cred RefreshableCred
+}
+
+// Credentials of the local endpoint, and the refresh that's in progress (if
+// any)
+type servedCredentials struct {
+	mu      sync.Mutex
+	cred    *RefreshableCred
+	refresh *credentialsRefresh
+}
+
+// Returns the credentials that the request is served, which are refreshed
+// first if they're due to be. It returns false if the request was canceled
+// while it waited for a refresh that another request started.
+func (served *servedCredentials) get(r *http.Request, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) (RefreshableCred, bool) {
+	cred := served.cred
+	served.mu.Lock()
+	if time.Until(cred.Expiration.Add(-RefreshTime)) >= RefreshTime {
+		current := *cred
+		served.mu.Unlock()
+		serverLog.debugf("Using previously obtained credentials")
+		opts.Hooks.cacheHit(CacheHitEvent{current.Expiration})
+		return current, true
+	}
+	if flight := served.refresh; flight != nil {
+		served.mu.Unlock()
+		serverLog.debugf("Waiting for the credentials that are being obtained")
+		select {
+		case <-flight.done:
+			return flight.cred, true
+		case <-r.Context().Done():
+			return RefreshableCred{}, false
+		}
+	}
+	flight := &credentialsRefresh{done: make(chan struct{})}
+	served.refresh = flight
+	served.mu.Unlock()
+
+	// The refresh isn't canceled when the client that started it goes away,
+	// since other requests may be waiting for it
+	serverLog.debugf("Generating credentials")
+	ctx := withAuditRemoteAddr(context.Background(), r.RemoteAddr)
+	ctx = WithCorrelationId(ctx, CorrelationIdFromContext(r.Context()))
+	credentialProcessOutput, gcErr := GenerateCredentialsWithContext(ctx, opts, signer, signatureAlgorithm)
+	if gcErr != nil {
+		serverLog.errorf("Error generating credentials: %s", gcErr)
+	}
+
+	served.mu.Lock()
+	cred.update(credentialProcessOutput)
+	flight.cred = *cred
+	served.refresh = nil
+	served.mu.Unlock()
+	close(flight.done)
+
+	if gcErr == nil {
+		go runServeRefreshHook(opts, flight.cred)
+		schedulePreconnect(opts, flight.cred.Expiration.Add(-2*RefreshTime))
+	}
+	return flight.cred, true
+}
+
+// Replaces the credentials with those that CreateSession returned
+func (cred *RefreshableCred) update(output CredentialProcessOutput) {
+	cred.AccessKeyId = output.AccessKeyId
+	cred.SecretAccessKey = output.SecretAccessKey
+	cred.Token = output.SessionToken
+	cred.Expiration, _ = time.Parse(time.RFC3339, output.Expiration)
+	cred.Code = REFRESHABLE_CRED_CODE
+	cred.LastUpdated = time.Now()
+	cred.Type = REFRESHABLE_CRED_TYPE
+}
+
+// Runs the on-refresh command (if one was specified) for credentials that are
+// vended through the local endpoint. Since credentials aren't associated with
+// a profile in this case, the profile is left empty.
+func runServeRefreshHook(opts *CredentialsOpts, cred RefreshableCred) {
+	if opts.OnRefresh == "" {
+		return
+	}
+	tmpCred := TemporaryCredential{
+		AccessKeyId:     cred.AccessKeyId,
+		SecretAccessKey: cred.SecretAccessKey,
+		SessionToken:    cred.Token, // nosemgrep
+		Expiration:      cred.Expiration,
+	}
+	if err := RunRefreshHook(opts.OnRefresh, "", &tmpCred); err != nil {
+		serverLog.warnf("on-refresh command failed: %s", err)
+	}
+}
+
+// Serves credentials through a local endpoint that's compatible with IMDSv2.
+// Returns an error if the endpoint couldn't be started, or stopped serving.
+func Serve(port int, credentialsOptions CredentialsOpts) error {
 	var refreshableCred = RefreshableCred{}
 
 	roleArn, err := arn.Parse(credentialsOptions.RoleArn)
 	if err != nil {
-		log.Println("invalid role ARN")
-		os.Exit(1)
+		return fmt.Errorf("%w %q for the role: %s", ErrInvalidArn, credentialsOptions.RoleArn, err)
 	}
 
+	if credentialsOptions.Sandbox && credentialsOptions.OnRefresh != "" {
+		return errors.New("the on-refresh command can't be run in the sandbox, since it doesn't allow processes to be executed")
+	}
+	if credentialsOptions.Sandbox && credentialsOptions.ACME != nil {
+		return errors.New("the certificate can't be renewed with ACME in the sandbox, since it doesn't allow the " +
+			"certificate to be written")
+	}
+	if credentialsOptions.Sandbox && credentialsOptions.AuditLogMaxSize > 0 {
+		return errors.New("the audit log can't be rotated in the sandbox, since it doesn't allow the audit log to be " +
+			"renamed")
+	}
+	if credentialsOptions.Sandbox && (credentialsOptions.PprofAddress != "" || credentialsOptions.PprofDir != "") {
+		return errors.New("profiling isn't possible in the sandbox, since it doesn't allow the system calls of the profiler")
+	}
+	if err = startProfiling(&credentialsOptions); err != nil {
+		return err
+	}
+
+	Preload(&credentialsOptions)
 	signer, signatureAlgorithm, err := GetSigner(&credentialsOptions)
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		return err
 	}
 	defer signer.Close()
+	if err = selfTestSigner(signer); err != nil {
+		return err
+	}
 
-	credentialProcessOutput, _ := GenerateCredentials(&credentialsOptions, signer, signatureAlgorithm)
-	refreshableCred.AccessKeyId = credentialProcessOutput.AccessKeyId
-	refreshableCred.SecretAccessKey = credentialProcessOutput.SecretAccessKey
-	refreshableCred.Token = credentialProcessOutput.SessionToken
-	refreshableCred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
-	refreshableCred.Code = REFRESHABLE_CRED_CODE
-	refreshableCred.LastUpdated = time.Now()
-	refreshableCred.Type = REFRESHABLE_CRED_TYPE
+	credentialProcessOutput, err := GenerateCredentials(&credentialsOptions, signer, signatureAlgorithm)
+	refreshableCred.update(credentialProcessOutput)
+	if err == nil {
+		go runServeRefreshHook(&credentialsOptions, refreshableCred)
+		schedulePreconnect(&credentialsOptions, refreshableCred.Expiration.Add(-2*RefreshTime))
+	}
 	endpoint := &Endpoint{PortNum: port, TmpCred: refreshableCred}
-	endpoint.Server = &http.Server{}
+	// The handlers aren't registered on http.DefaultServeMux, which
+	// net/http/pprof registers its endpoints on
+	mux := http.NewServeMux()
+	endpoint.Server = &http.Server{
+		Handler: validateHost(mux, credentialsOptions.ServerBindAddress),
+		// Panics of handlers are logged (with their stack traces) here
+		ErrorLog: serverErrorLog(),
+	}
 	roleResourceParts := strings.Split(roleArn.Resource, "/")
 	roleName := roleResourceParts[len(roleResourceParts)-1] // Find role name without path
-	putTokenHandler, getRoleNameHandler, getCredentialsHandler := AllIssuesHandlers(&endpoint.TmpCred, roleName, &credentialsOptions, signer, signatureAlgorithm)
+	served := &servedCredentials{cred: &endpoint.TmpCred}
+	putTokenHandler, getRoleNameHandler, getCredentialsHandler := allIssuesHandlers(served, roleName, &credentialsOptions, signer, signatureAlgorithm)
+	if credentialsOptions.ACME != nil {
+		// Credentials are obtained with the renewed certificate right away,
+		// rather than once the current ones are refreshed
+		go renewACMECertificate(context.Background(), &credentialsOptions, func() {
+			if err := served.rotate(context.Background(), &credentialsOptions, signer, signatureAlgorithm); err != nil {
+				serverLog.warnf("unable to obtain credentials with the renewed certificate: %s", err)
+			}
+		})
+	}
 
-	http.HandleFunc(TOKEN_RESOURCE_PATH, putTokenHandler)
-	http.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNameHandler)
-	http.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH+roleName, getCredentialsHandler)
+	mux.HandleFunc(TOKEN_RESOURCE_PATH, putTokenHandler)
+	mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH, getRoleNameHandler)
+	mux.HandleFunc(SECURITY_CREDENTIALS_RESOURCE_PATH+roleName, getCredentialsHandler)
 
 	// Background thread that cleans up expired tokens
 	ticker := time.NewTicker(5 * time.Second)
@@ -313,7 +446,7 @@ func Serve(port int, credentialsOptions CredentialsOpts) {
 			for key, value := range tokenMap {
 				if curTime.After(value) {
 					delete(tokenMap, key)
-					log.Printf("removed expired token: %s", key)
+					serverLog.debugf("removed expired token: %s", key)
 				}
 			}
 			mutex.Unlock()
@@ -321,18 +454,67 @@ func Serve(port int, credentialsOptions CredentialsOpts) {
 	}()
 
 	// Start the credentials endpoint
-	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", LocalHostAddress, endpoint.PortNum))
+	bindAddress := credentialsOptions.ServerBindAddress
+	if bindAddress == "" {
+		bindAddress = LocalHostAddress
+	}
+	if !isLoopbackAddress(bindAddress) {
+		serverLog.warnf("the local server listens on %s, which isn't a loopback address, so credentials can be "+
+			"retrieved by other hosts that can reach it", bindAddress)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(endpoint.PortNum)))
 	if err != nil {
-		log.Println("failed to create listener")
-		os.Exit(1)
+		return fmt.Errorf("failed to create listener: %w", err)
 	}
 	listener = NewListenerWithTTL(listener, credentialsOptions.ServerTTL)
 	endpoint.PortNum = listener.Addr().(*net.TCPAddr).Port
-	log.Println("Local server started on port:", endpoint.PortNum)
-	log.Println("Make it available to the sdk by running:")
-	log.Printf("export AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s:%d/", LocalHostAddress, endpoint.PortNum)
+	if credentialsOptions.Sandbox {
+		if err = enterSandbox(&credentialsOptions); err != nil {
+			listener.Close()
+			return fmt.Errorf("unable to enter the sandbox: %w", err)
+		}
+		serverLog.debugf("Entered the sandbox")
+	}
+	serverLog.infof("Local server started on port: %d", endpoint.PortNum)
+	serverLog.infof("Make it available to the sdk by running:")
+	if ip := net.ParseIP(bindAddress); ip == nil || ip.IsUnspecified() {
+		bindAddress = LocalHostAddress
+	}
+	serverLog.infof("export AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s/", net.JoinHostPort(bindAddress, strconv.Itoa(endpoint.PortNum)))
 	if err := endpoint.Server.Serve(listener); err != nil {
-		log.Println("Httpserver: ListenAndServe() error")
-		os.Exit(1)
+		return fmt.Errorf("Httpserver: ListenAndServe() error: %w", err)
+	}
+	return nil
+}
+
+// Whether the address (an IP address or a host name) only accepts
+// connections from the local host
+func isLoopbackAddress(address string) bool {
+	if strings.EqualFold(address, "localhost") {
+		return true
 	}
+	ip := net.ParseIP(address)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Rejects requests whose Host header names a host other than an IP address,
+// localhost, or the address that the server is bound to. Requests that
+// browsers send after a DNS rebinding attack carry the attacker's host name,
+// so web pages can't read credentials from the local server.
+func validateHost(handler http.Handler, bindAddress string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		host = strings.TrimSuffix(strings.TrimPrefix(host, "["), "]")
+		if host != "" && net.ParseIP(host) == nil && !strings.EqualFold(host, "localhost") &&
+			!strings.EqualFold(host, bindAddress) {
+			serverLog.warnf("rejected a request from %s with Host header %q", r.RemoteAddr, r.Host)
+			w.WriteHeader(http.StatusBadRequest)
+			io.WriteString(w, "unexpected Host header")
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
 }
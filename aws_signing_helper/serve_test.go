@@ -0,0 +1,164 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestValidateHost(t *testing.T) {
+	handler := validateHost(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "credentials.internal")
+
+	for _, tc := range []struct {
+		host   string
+		status int
+	}{
+		{"127.0.0.1:9911", http.StatusOK},
+		{"[::1]:9911", http.StatusOK},
+		{"localhost:9911", http.StatusOK},
+		{"LOCALHOST", http.StatusOK},
+		{"credentials.internal:9911", http.StatusOK},
+		{"attacker.example.com:9911", http.StatusBadRequest},
+		{"localhost.attacker.example.com", http.StatusBadRequest},
+	} {
+		request := httptest.NewRequest(http.MethodGet, SECURITY_CREDENTIALS_RESOURCE_PATH, nil)
+		request.Host = tc.host
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != tc.status {
+			t.Errorf("unexpected status for Host %q: %d", tc.host, recorder.Code)
+		}
+	}
+
+	if !isLoopbackAddress("127.0.0.2") || !isLoopbackAddress("::1") || isLoopbackAddress("0.0.0.0") ||
+		isLoopbackAddress("192.168.1.10") {
+		t.Error("unexpected loopback classification")
+	}
+}
+
+func TestServedCredentialsSingleFlight(t *testing.T) {
+	var calls atomic.Int32
+	started := make(chan struct{})
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			close(started)
+		}
+		<-release
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"credentialSet":[{"credentials":{"accessKeyId":"accessKeyId","expiration":"2099-01-01T00:00:00Z",` +
+			`"secretAccessKey":"secretAccessKey","sessionToken":"sessionToken"}}]}`))
+	}))
+	defer server.Close()
+	opts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		Endpoint:          server.URL,
+		SessionDuration:   900,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	// The first request starts the refresh, and those that arrive while it's
+	// in progress wait for it
+	served := &servedCredentials{cred: &RefreshableCred{}}
+	results := make(chan RefreshableCred, 10)
+	get := func() {
+		request := httptest.NewRequest(http.MethodGet, SECURITY_CREDENTIALS_RESOURCE_PATH, nil)
+		cred, ok := served.get(request, &opts, signer, signatureAlgorithm)
+		if !ok {
+			t.Error("request was canceled")
+		}
+		results <- cred
+	}
+	go get()
+	<-started
+	for i := 1; i < cap(results); i++ {
+		go get()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < cap(results); i++ {
+		if cred := <-results; cred.AccessKeyId != "accessKeyId" {
+			t.Errorf("unexpected credentials: %+v", cred)
+		}
+	}
+	if n := calls.Load(); n != 1 {
+		t.Errorf("unexpected number of CreateSession calls: %d", n)
+	}
+}
+
+func TestServeCredentialsHandler(t *testing.T) {
+	cred := &RefreshableCred{AccessKeyId: "accessKeyId", SecretAccessKey: "secretAccessKey", Token: "sessionToken",
+		Code: REFRESHABLE_CRED_CODE, Type: REFRESHABLE_CRED_TYPE, Expiration: time.Now().Add(time.Hour).UTC()}
+	putTokenHandler, _, getCredentialsHandler := AllIssuesHandlers(cred, "role", &CredentialsOpts{}, nil, "")
+
+	request := httptest.NewRequest(http.MethodPut, TOKEN_RESOURCE_PATH, nil)
+	request.Header.Set(EC2_METADATA_TOKEN_TTL_HEADER, "60")
+	recorder := httptest.NewRecorder()
+	putTokenHandler(recorder, request)
+	token := recorder.Body.String()
+	if len(token) != 100 {
+		t.Fatalf("unexpected token: %q", token)
+	}
+
+	// Responses are written from pooled buffers, which mustn't leak from
+	// one response into the next
+	for i := 0; i < 3; i++ {
+		request = httptest.NewRequest(http.MethodGet, SECURITY_CREDENTIALS_RESOURCE_PATH+"role", nil)
+		request.Header.Set(EC2_METADATA_TOKEN_HEADER, token)
+		recorder = httptest.NewRecorder()
+		getCredentialsHandler(recorder, request)
+		var served RefreshableCred
+		if err := json.Unmarshal(recorder.Body.Bytes(), &served); err != nil {
+			t.Fatal(err)
+		}
+		if served.AccessKeyId != cred.AccessKeyId || served.Token != cred.Token {
+			t.Errorf("unexpected credentials: %+v", served)
+		}
+		if recorder.Header().Get(EC2_METADATA_TOKEN_TTL_HEADER) == "" ||
+			recorder.Header().Get("Content-Length") != strconv.Itoa(recorder.Body.Len()) {
+			t.Errorf("unexpected headers: %v", recorder.Header())
+		}
+	}
+
+	// Correlation IDs of clients are sent back
+	request = httptest.NewRequest(http.MethodGet, SECURITY_CREDENTIALS_RESOURCE_PATH+"role", nil)
+	request.Header.Set(EC2_METADATA_TOKEN_HEADER, token)
+	request.Header.Set(CorrelationIdHeader, "client-1")
+	recorder = httptest.NewRecorder()
+	getCredentialsHandler(recorder, request)
+	if id := recorder.Header().Get(CorrelationIdHeader); id != "client-1" {
+		t.Errorf("unexpected correlation ID: %q", id)
+	}
+
+	large := getBuffer()
+	large.Grow(2 * maxPooledBufferSize)
+	putBuffer(large)
+	if buffer := getBuffer(); buffer == large || buffer.Len() != 0 {
+		t.Error("expected a new, empty buffer")
+	}
+
+	// Buffers are zeroed before they're returned to the pool
+	buffer := getBuffer()
+	buffer.WriteString(`{"SecretAccessKey":"secret"}`)
+	contents := buffer.Bytes()[:buffer.Cap()]
+	buffer.Next(4)
+	putBuffer(buffer)
+	if !bytes.Equal(contents, make([]byte, len(contents))) {
+		t.Error("expected the buffer to be zeroed")
+	}
+}
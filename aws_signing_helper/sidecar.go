@@ -0,0 +1,332 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Path of the local endpoint of the sidecar, which is compatible with the
+// container credential providers of the AWS SDKs (through
+// AWS_CONTAINER_CREDENTIALS_FULL_URI)
+const ContainerCredentialsPath = "/v1/credentials"
+
+// Path that reports whether the sidecar has credentials to serve, for the
+// readiness and liveness probes of the pod
+const ContainerHealthPath = "/healthz"
+
+// How often the sidecar checks whether the certificate, private key, and
+// intermediates were rotated, by default
+const DefaultCertificateWatchInterval = 10 * time.Second
+
+// File that holds the namespace of the pod, in pods whose service account
+// token is mounted
+var podNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+
+// Characters that aren't allowed in role session names
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// Longest role session name
+const maxRoleSessionNameLength = 64
+
+// Pod that the sidecar runs in
+type podEnvironment struct {
+	Namespace string
+	Name      string
+}
+
+// Detects whether the process runs in a Kubernetes pod, and which one: the
+// namespace is read from the service account mount or POD_NAMESPACE, and
+// the name from POD_NAME (as the downward API would set them) or the host
+// name (which is the name of the pod, unless the pod spec overrides it)
+func detectPod() (podEnvironment, bool) {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return podEnvironment{}, false
+	}
+	pod := podEnvironment{Namespace: os.Getenv("POD_NAMESPACE"), Name: os.Getenv("POD_NAME")}
+	if pod.Namespace == "" {
+		if namespace, err := os.ReadFile(podNamespaceFile); err == nil {
+			pod.Namespace = strings.TrimSpace(string(namespace))
+		}
+	}
+	if pod.Name == "" {
+		pod.Name, _ = os.Hostname()
+	}
+	return pod, true
+}
+
+// Returns the role session name that identifies the pod (in CloudTrail),
+// which is <namespace>.<name>
+func (pod podEnvironment) roleSessionName() string {
+	name := strings.Trim(pod.Namespace+"."+pod.Name, ".")
+	name = invalidRoleSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxRoleSessionNameLength {
+		name = name[:maxRoleSessionNameLength]
+	}
+	return name
+}
+
+// Returns the authorization token of the local endpoint: that of the token
+// file, if it exists (for example, a Kubernetes secret), and a new random
+// token otherwise, which is written to the token file, so that the
+// application container can read it (through
+// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE, from a volume that both containers
+// mount)
+func loadContainerToken(path string) (string, error) {
+	if path == "" {
+		return "", errors.New("a token file is required, for the application container to read the authorization token from")
+	}
+	data, err := os.ReadFile(path)
+	if err == nil && strings.TrimSpace(string(data)) != "" {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+	token, err := GenerateToken(64)
+	if err != nil {
+		return "", err
+	}
+	if err = writeFileAtomic(path, []byte(token)); err != nil {
+		return "", fmt.Errorf("unable to write the token file: %w", err)
+	}
+	// The application container usually runs as another user, so the file
+	// is readable by everyone who can reach the volume that it's on
+	if err = os.Chmod(path, 0644); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Handles GET requests to ContainerCredentialsPath, whose Authorization
+// header has to be the token
+func containerCredentialsHandler(served *servedCredentials, token string, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			serverLog.warnf("rejected a request from %s without a valid authorization token", r.RemoteAddr)
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "invalid authorization token")
+			return
+		}
+
+		correlationId := requestCorrelationId(r.Header.Get(CorrelationIdHeader))
+		w.Header().Set(CorrelationIdHeader, correlationId)
+		r = r.WithContext(WithCorrelationId(r.Context(), correlationId))
+		current, ok := served.get(r, opts, signer, signatureAlgorithm)
+		if !ok {
+			return
+		}
+		buffer := getBuffer()
+		defer putBuffer(buffer)
+		if err := json.NewEncoder(buffer).Encode(current); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			io.WriteString(w, "failed to encode credentials")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Length", strconv.Itoa(buffer.Len()))
+		w.Write(buffer.Bytes())
+	}
+}
+
+// Handles requests to ContainerHealthPath: the sidecar is healthy while it
+// has credentials that haven't expired
+func containerHealthHandler(served *servedCredentials) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		served.mu.Lock()
+		expiration := served.cred.Expiration
+		served.mu.Unlock()
+		if time.Now().After(expiration) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, "no valid credentials\n")
+			return
+		}
+		io.WriteString(w, "ok\n")
+	}
+}
+
+// Obtains new credentials (after the identity material was rotated), while
+// the current ones keep being served. They're only replaced if the refresh
+// succeeds.
+func (served *servedCredentials) rotate(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string) error {
+	output, err := GenerateCredentialsWithContext(ctx, opts, signer, signatureAlgorithm)
+	if err != nil {
+		return err
+	}
+	served.mu.Lock()
+	served.cred.update(output)
+	current := *served.cred
+	served.mu.Unlock()
+	go runServeRefreshHook(opts, current)
+	return nil
+}
+
+// Checks the certificate, private key, and intermediate files on each tick,
+// and obtains new credentials with them once they
+// were rotated (as the volumes of cert-manager's CSI driver and projected
+// volumes are updated, by swapping a symbolic link). Files that were just
+// modified are only considered once they've settled, and new credentials
+// are only requested once the private key matches the certificate again,
+// since the certificate and key may be updated one after the other. If the
+// refresh fails, it's retried on the next check, and the current
+// credentials are served meanwhile. X.509-SVIDs of the SPIFFE Workload API
+// and Kubernetes secrets are watched through the certificate of the signer
+// instead.
+func watchIdentityFiles(ctx context.Context, served *servedCredentials, opts *CredentialsOpts, signer Signer, signatureAlgorithm string, ticks <-chan time.Time) {
+	paths := []string{opts.CertificateId, opts.PrivateKeyId, opts.CertificateBundleId}
+	identityVersions := func() ([]fileVersion, bool) { return currentFileVersions(paths) }
+	if opts.SpiffeEndpointSocket != "" || opts.KubernetesSecret != "" {
+		// The signer receives rotated identities from the Workload API (or
+		// the watch of the secret) itself, so it's the certificate that's
+		// watched, rather than files
+		identityVersions = func() ([]fileVersion, bool) {
+			certificate, err := signer.Certificate()
+			if err != nil || certificate == nil {
+				return nil, false
+			}
+			return []fileVersion{{path: certificate.SerialNumber.String(), modTime: certificate.NotBefore.UnixNano()}}, true
+		}
+	}
+	// Files that were modified just before the sidecar started are only
+	// taken as the baseline once they've settled
+	last, _ := identityVersions()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticks:
+		}
+		versions, ok := identityVersions()
+		if !ok || slices.Equal(versions, last) {
+			continue
+		}
+		if last == nil {
+			last = versions
+			continue
+		}
+		certificate, err := signer.Certificate()
+		if err != nil || certificate == nil {
+			signerLog.debugf("the rotated certificate can't be read yet: %v", err)
+			continue
+		}
+		if key, ok := signer.Public().(interface{ Equal(crypto.PublicKey) bool }); !ok || !key.Equal(certificate.PublicKey) {
+			signerLog.debugf("the rotated private key doesn't match the certificate yet")
+			continue
+		}
+		if err = served.rotate(ctx, opts, signer, signatureAlgorithm); err != nil {
+			signerLog.warnf("unable to obtain credentials with the rotated certificate (retrying on the next "+
+				"check): %s", err)
+			continue
+		}
+		last = versions
+		signerLog.infof("obtained credentials with the rotated certificate %s (expires at %s)",
+			certificate.SerialNumber, certificate.NotAfter.UTC().Format(time.RFC3339))
+	}
+}
+
+// Serves credentials to the other containers of a pod, as a sidecar, through
+// an endpoint that's compatible with the container credential providers of
+// the AWS SDKs. Requests have to carry the authorization token of the token
+// file (see loadContainerToken). The identity files are watched, and new
+// credentials are obtained as soon as they're rotated. In a Kubernetes pod,
+// the role session name defaults to the namespace and name of the pod.
+// Returns an error if the endpoint couldn't be started, or stopped serving.
+func ServeContainerCredentials(port int, tokenFile string, credentialsOptions CredentialsOpts) error {
+	if pod, ok := detectPod(); ok {
+		serverLog.infof("running in pod %s/%s", pod.Namespace, pod.Name)
+		if credentialsOptions.RoleSessionName == "" {
+			credentialsOptions.RoleSessionName = pod.roleSessionName()
+		}
+	}
+	token, err := loadContainerToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	Preload(&credentialsOptions)
+	signer, signatureAlgorithm, err := GetSigner(&credentialsOptions)
+	if err != nil {
+		return err
+	}
+	defer signer.Close()
+	if err = selfTestSigner(signer); err != nil {
+		return err
+	}
+
+	refreshableCred := RefreshableCred{}
+	output, err := GenerateCredentials(&credentialsOptions, signer, signatureAlgorithm)
+	if err != nil {
+		// The pod isn't ready until credentials are obtained, which is
+		// retried by the next request (or once the identity is rotated)
+		serverLog.errorf("unable to obtain credentials: %s", err)
+	} else {
+		refreshableCred.update(output)
+		go runServeRefreshHook(&credentialsOptions, refreshableCred)
+	}
+	served := &servedCredentials{cred: &refreshableCred}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(ContainerCredentialsPath, containerCredentialsHandler(served, token, &credentialsOptions, signer, signatureAlgorithm))
+	mux.HandleFunc(ContainerHealthPath, containerHealthHandler(served))
+	server := &http.Server{
+		Handler:  validateHost(mux, credentialsOptions.ServerBindAddress),
+		ErrorLog: serverErrorLog(),
+	}
+
+	bindAddress := credentialsOptions.ServerBindAddress
+	if bindAddress == "" {
+		bindAddress = LocalHostAddress
+	}
+	if !isLoopbackAddress(bindAddress) {
+		serverLog.warnf("the local server listens on %s, which isn't a loopback address, so credentials can be "+
+			"retrieved by other hosts that can reach it (with the token)", bindAddress)
+	}
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, strconv.Itoa(port)))
+	if err != nil {
+		return fmt.Errorf("failed to create listener: %w", err)
+	}
+	port = listener.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interval := credentialsOptions.CertificateWatchInterval
+	if interval <= 0 {
+		interval = DefaultCertificateWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	go watchIdentityFiles(ctx, served, &credentialsOptions, signer, signatureAlgorithm, ticker.C)
+	if credentialsOptions.ACME != nil {
+		// Renewed certificates are picked up by the watch of the files
+		go renewACMECertificate(ctx, &credentialsOptions, nil)
+	}
+
+	serverLog.infof("Local server started on port: %d", port)
+	serverLog.infof("Make it available to the sdk by setting, in the application container:")
+	if ip := net.ParseIP(bindAddress); ip == nil || ip.IsUnspecified() {
+		bindAddress = LocalHostAddress
+	}
+	serverLog.infof("AWS_CONTAINER_CREDENTIALS_FULL_URI=http://%s%s", net.JoinHostPort(bindAddress, strconv.Itoa(port)),
+		ContainerCredentialsPath)
+	serverLog.infof("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=%s", tokenFile)
+	if err := server.Serve(listener); err != nil {
+		return fmt.Errorf("Httpserver: ListenAndServe() error: %w", err)
+	}
+	return nil
+}
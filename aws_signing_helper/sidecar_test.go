@@ -0,0 +1,142 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSidecar(t *testing.T) {
+	dir := t.TempDir()
+	tokenPath := filepath.Join(dir, "token")
+	token, err := loadContainerToken(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reloaded, err := loadContainerToken(tokenPath); err != nil || reloaded != token {
+		t.Errorf("the token wasn't read from the token file: %q, %v", reloaded, err)
+	}
+	if _, err = loadContainerToken(""); err == nil {
+		t.Error("a token file wasn't required")
+	}
+
+	var requests atomic.Int32
+	createSession := GetMockedCreateSessionResponseServer()
+	defer createSession.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		createSession.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	// The identity is mounted as a volume whose files are replaced when the
+	// certificate is rotated
+	identity := filepath.Join(dir, "identity")
+	os.Mkdir(identity, 0700)
+	settled := time.Now().Add(-time.Minute)
+	install := func(name string, source string, modTime time.Time) {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(identity, name)
+		if err = os.WriteFile(path, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+	install("tls.crt", "../credential-process-data/client-cert.pem", settled)
+	install("tls.key", "../credential-process-data/client-key.pem", settled)
+	opts := CredentialsOpts{
+		CertificateId:       filepath.Join(identity, "tls.crt"),
+		PrivateKeyId:        filepath.Join(identity, "tls.key"),
+		CertificateBundleId: filepath.Join(identity, "tls.crt"),
+		RoleArn:             "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:       "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr:   "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		SessionDuration:     900,
+		Endpoint:            server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if chain, err := signer.CertificateChain(); err != nil || len(chain) != 0 {
+		t.Errorf("the certificate was included in its own chain: %d, %v", len(chain), err)
+	}
+
+	served := &servedCredentials{cred: &RefreshableCred{}}
+	handler := containerCredentialsHandler(served, token, &opts, signer, signatureAlgorithm)
+	recorder := httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest(http.MethodGet, ContainerCredentialsPath, nil))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("a request without the token was served: %d", recorder.Code)
+	}
+	request := httptest.NewRequest(http.MethodGet, ContainerCredentialsPath, nil)
+	request.Header.Set("Authorization", token)
+	recorder = httptest.NewRecorder()
+	handler(recorder, request)
+	var credentials RefreshableCred
+	if err = json.Unmarshal(recorder.Body.Bytes(), &credentials); err != nil || credentials.AccessKeyId != "accessKeyId" {
+		t.Errorf("unexpected credentials: %s, %v", recorder.Body.String(), err)
+	}
+
+	health := containerHealthHandler(served)
+	recorder = httptest.NewRecorder()
+	health(recorder, httptest.NewRequest(http.MethodGet, ContainerHealthPath, nil))
+	// The credentials of the mocked server have expired
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("unexpected health status: %d", recorder.Code)
+	}
+
+	// The checks are driven by the test: a tick is only received once the
+	// check of the previous one is done
+	ticks := make(chan time.Time)
+	check := func() {
+		ticks <- time.Now()
+		ticks <- time.Now()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		watchIdentityFiles(ctx, served, &opts, signer, signatureAlgorithm, ticks)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	// Credentials aren't requested while the key doesn't match the rotated
+	// certificate
+	check()
+	before := requests.Load()
+	rotated := settled.Add(30 * time.Second)
+	install("tls.crt", "../tst/certs/rsa-2048-sha256-cert.pem", rotated)
+	check()
+	if requests.Load() != before {
+		t.Error("credentials were requested with a key that doesn't match the certificate")
+	}
+	install("tls.key", "../tst/certs/rsa-2048-key.pem", rotated)
+	check()
+	if requests.Load() == before {
+		t.Fatal("credentials weren't requested with the rotated certificate")
+	}
+
+	t.Setenv("KUBERNETES_SERVICE_HOST", "10.0.0.1")
+	t.Setenv("POD_NAME", "web-7d9f8 (canary)")
+	defer func(path string) { podNamespaceFile = path }(podNamespaceFile)
+	podNamespaceFile = filepath.Join(dir, "namespace")
+	os.WriteFile(podNamespaceFile, []byte("payments\n"), 0600)
+	pod, ok := detectPod()
+	if !ok || pod.Namespace != "payments" || pod.roleSessionName() != "payments.web-7d9f8--canary-" {
+		t.Errorf("unexpected pod: %+v, %q", pod, pod.roleSessionName())
+	}
+}
@@ -0,0 +1,155 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/rolesanywhere-credential-helper/rolesanywhere/types"
+	"github.com/aws/smithy-go"
+	"github.com/aws/smithy-go/middleware"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Returned by the middleware that captures the signed request, to stop the
+// request from being sent
+var errRequestBuilt = errors.New("request built")
+
+// Builds the CreateSession request, signed with SigV4-X509, without sending
+// it, so that it can be sent over another transport (such as a custom mTLS
+// stack or a request queue) or recorded for tests. The endpoint, headers,
+// and body are the same as those that NewCredentialer would send with the
+// same options; the HTTPClient and Retryer options have no effect. The
+// request is signed at the current time, so it has to be sent within five
+// minutes. Its response can be parsed with ParseCreateSessionResponse.
+func BuildCreateSessionRequest(ctx context.Context, opts *CredentialsOpts, signer Signer, signatureAlgorithm string, optFns ...func(*CredentialerOptions)) (*http.Request, error) {
+	var clientOptions CredentialerOptions
+	for _, fn := range optFns {
+		fn(&clientOptions)
+	}
+
+	var request *http.Request
+	var buildErr error
+	captureRequest := func(stack *middleware.Stack) error {
+		return stack.Finalize.Add(middleware.FinalizeMiddlewareFunc("CaptureSignedRequest", func(
+			ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler,
+		) (middleware.FinalizeOutput, middleware.Metadata, error) {
+			req, ok := in.Request.(*smithyhttp.Request)
+			if !ok {
+				return middleware.FinalizeOutput{}, middleware.Metadata{}, fmt.Errorf("unexpected request middleware type %T", in.Request)
+			}
+			request, buildErr = buildHTTPRequest(ctx, req)
+			return middleware.FinalizeOutput{}, middleware.Metadata{}, errRequestBuilt
+		}), middleware.After)
+	}
+	clientOptions.APIOptions = append(append([]func(*middleware.Stack) error{}, clientOptions.APIOptions...), captureRequest)
+
+	localOpts := *opts
+	_, err := createSession(ctx, &localOpts, signer, signatureAlgorithm, clientOptions)
+	if !errors.Is(err, errRequestBuilt) {
+		if err == nil {
+			err = errors.New("request was sent while building it")
+		}
+		return nil, err
+	}
+	if buildErr != nil {
+		return nil, buildErr
+	}
+	return request, nil
+}
+
+// Converts the signed request into an http.Request whose body can be read
+// again (through GetBody), so that it can be retried
+func buildHTTPRequest(ctx context.Context, req *smithyhttp.Request) (*http.Request, error) {
+	var body []byte
+	if stream := req.GetStream(); stream != nil {
+		var err error
+		if body, err = io.ReadAll(stream); err != nil {
+			return nil, err
+		}
+	}
+	request := req.Build(ctx)
+	request.Body = io.NopCloser(bytes.NewReader(body))
+	request.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(body)), nil
+	}
+	request.ContentLength = int64(len(body))
+	return request, nil
+}
+
+// Parses the response to a CreateSession request that was built by
+// BuildCreateSessionRequest. Error responses are returned as errors that wrap
+// the same exported errors (such as ErrThrottled) as those of Credentialers.
+// The body of the response is read, but not closed.
+func ParseCreateSessionResponse(response *http.Response) (CredentialProcessOutput, error) {
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return CredentialProcessOutput{}, fmt.Errorf("unable to read CreateSession response: %w", err)
+	}
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		var errorBody struct {
+			Message      string `json:"message"`
+			LegacyFormat string `json:"Message"`
+		}
+		json.Unmarshal(body, &errorBody)
+		if errorBody.Message == "" {
+			errorBody.Message = errorBody.LegacyFormat
+		}
+		// The error type may be followed by the URI of its documentation
+		errorType, _, _ := strings.Cut(response.Header.Get("X-Amzn-ErrorType"), ":")
+		if errorType == "" {
+			errorType = http.StatusText(response.StatusCode)
+		}
+		return CredentialProcessOutput{}, wrapCreateSessionError(fmt.Errorf("CreateSession failed with status %d: %w",
+			response.StatusCode, &smithy.GenericAPIError{Code: errorType, Message: errorBody.Message}))
+	}
+
+	var output struct {
+		CredentialSet []struct {
+			AssumedRoleUser struct {
+				Arn           *string `json:"arn"`
+				AssumedRoleId *string `json:"assumedRoleId"`
+			} `json:"assumedRoleUser"`
+			Credentials struct {
+				AccessKeyId     string `json:"accessKeyId"`
+				SecretAccessKey string `json:"secretAccessKey"`
+				SessionToken    string `json:"sessionToken"`
+				Expiration      string `json:"expiration"`
+			} `json:"credentials"`
+			RoleArn        *string `json:"roleArn"`
+			SourceIdentity *string `json:"sourceIdentity"`
+		} `json:"credentialSet"`
+	}
+	if err = json.Unmarshal(body, &output); err != nil {
+		return CredentialProcessOutput{}, fmt.Errorf("unable to parse CreateSession response: %w", err)
+	}
+	if len(output.CredentialSet) == 0 {
+		return CredentialProcessOutput{}, errors.New("unable to obtain temporary security credentials from CreateSession")
+	}
+	credentialSet := output.CredentialSet[0]
+	credentials := credentialSet.Credentials
+	// The signer isn't known, so the metadata doesn't describe it
+	metadata := credentialResponseMetadata(types.CredentialResponse{
+		AssumedRoleUser: &types.AssumedRoleUser{
+			Arn:           credentialSet.AssumedRoleUser.Arn,
+			AssumedRoleId: credentialSet.AssumedRoleUser.AssumedRoleId,
+		},
+		RoleArn:        credentialSet.RoleArn,
+		SourceIdentity: credentialSet.SourceIdentity,
+	}, time.Now().UTC())
+	return CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     credentials.AccessKeyId,
+		SecretAccessKey: credentials.SecretAccessKey,
+		SessionToken:    credentials.SessionToken,
+		Expiration:      credentials.Expiration,
+		Metadata:        metadata,
+	}, nil
+}
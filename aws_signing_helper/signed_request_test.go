@@ -0,0 +1,70 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBuildCreateSessionRequest(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+
+	opts := CredentialsOpts{
+		CertificateId:     "../tst/certs/rsa-2048-sha256-cert.pem",
+		PrivateKeyId:      "../tst/certs/rsa-2048-key.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	request, err := BuildCreateSessionRequest(context.Background(), &opts, signer, signatureAlgorithm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.Method != http.MethodPost || !strings.HasPrefix(request.URL.String(), server.URL+"/sessions?") ||
+		!strings.HasPrefix(request.Header.Get("Authorization"), signatureAlgorithm+" Credential=") ||
+		request.Header.Get(x_amz_x509) == "" {
+		t.Fatalf("unexpected request: %s %s %v", request.Method, request.URL, request.Header)
+	}
+	bodyReader, _ := request.GetBody()
+	body, _ := io.ReadAll(bodyReader)
+	if !strings.Contains(string(body), `"durationSeconds":900`) {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	// The request is sent over a transport of the caller
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer response.Body.Close()
+	credentials, err := ParseCreateSessionResponse(response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if credentials.AccessKeyId != "accessKeyId" || credentials.Version != 1 ||
+		credentials.Metadata == nil || credentials.Metadata.AssumedRoleId != "assumedRoleId" {
+		t.Errorf("unexpected credentials: %+v", credentials)
+	}
+
+	recorder := httptest.NewRecorder()
+	recorder.Header().Set("X-Amzn-ErrorType", "ThrottlingException:http://internal.amazon.com/coral/com.amazon.coral.availability/")
+	recorder.WriteHeader(http.StatusTooManyRequests)
+	recorder.WriteString(`{"message":"Rate exceeded"}`)
+	if _, err = ParseCreateSessionResponse(recorder.Result()); !errors.Is(err, ErrThrottled) ||
+		!strings.Contains(err.Error(), "Rate exceeded") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
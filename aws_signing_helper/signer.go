@@ -16,7 +16,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"math/big"
 	"net/http"
 	"os"
@@ -27,6 +26,7 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws/signer/v4"
 	"github.com/aws/smithy-go/middleware"
+	"github.com/aws/smithy-go/tracing"
 	smithyhttp "github.com/aws/smithy-go/transport/http"
 	"golang.org/x/crypto/pkcs12"
 	"golang.org/x/term"
@@ -64,8 +64,12 @@ var (
 	ROLESANYWHERE_SIGNING_NAME = "rolesanywhere"
 )
 
-// Interface that all signers will have to implement
-// (as a result, they will also implement crypto.Signer)
+// Interface that all signers will have to implement. Unlike crypto.Signer,
+// Sign hashes the data it's passed with the hash function of the options,
+// unless the options are PrehashedOpts (as used by SignDigest and
+// AsCryptoSigner), in which case the data is a digest. Implementations don't
+// need to be safe for concurrent use, since GetSigner and
+// NewCredentialerWithSigner serialize the calls to them.
 type Signer interface {
 	Public() crypto.PublicKey
 	Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) (signature []byte, err error)
@@ -101,6 +105,10 @@ type CredentialProcessOutput struct {
 	SessionToken string `json:"SessionToken"`
 	// ISO8601 timestamp for when the credentials expire
 	Expiration string `json:"Expiration"`
+	// Describes the session that the credentials were obtained for (it's
+	// nil for credentials that weren't obtained from CreateSession). It's
+	// left out of the output of the credential-process command.
+	Metadata *CredentialMetadata `json:"-"`
 }
 
 type CertificateContainer struct {
@@ -144,6 +152,7 @@ func GetPassword(ttyReadFile *os.File, ttyWriteFile *os.File, prompt string, par
 
 	password := string(passwordBytes[:])
 	strings.Replace(password, "\r", "", -1) // Remove CR
+	registerSecret(password)
 	return password, nil
 }
 
@@ -185,6 +194,27 @@ func PasswordPrompt(passwordPromptInput PasswordPromptProps) (string, interface{
 	checkPassword = passwordPromptInput.CheckPassword
 	checkPasswordAuthorizationErrorMsg = passwordPromptInput.CheckPasswordAuthorizationErrorMsg
 
+	// If no password is required
+	if noPassword {
+		checkPasswordResult, err = checkPassword("")
+		if err != nil {
+			return "", nil, err
+		}
+		return "", checkPasswordResult, nil
+	}
+
+	// If the password was provided explicitly, beforehand
+	if password != "" {
+		checkPasswordResult, err = checkPassword(password)
+		if err != nil {
+			return "", nil, errors.New(incorrectPasswordMsg)
+		}
+		return password, checkPasswordResult, nil
+	}
+
+	// The key has a password, so prompt for it on the terminal. The terminal is
+	// only opened at this point, so that a password can be provided (or not be
+	// required) when there's no terminal, for example when running as a service.
 	ttyReadPath = "/dev/tty"
 	ttyWritePath = ttyReadPath
 	if runtime.GOOS == "windows" {
@@ -204,25 +234,6 @@ func PasswordPrompt(passwordPromptInput PasswordPromptProps) (string, interface{
 	}
 	defer ttyWriteFile.Close()
 
-	// If no password is required
-	if noPassword {
-		checkPasswordResult, err = checkPassword("")
-		if err != nil {
-			return "", nil, err
-		}
-		return "", checkPasswordResult, nil
-	}
-
-	// If the password was provided explicitly, beforehand
-	if password != "" {
-		checkPasswordResult, err = checkPassword(password)
-		if err != nil {
-			return "", nil, errors.New(incorrectPasswordMsg)
-		}
-		return password, checkPasswordResult, nil
-	}
-
-	// The key has a password, so prompt for it
 	password, err = GetPassword(ttyReadFile, ttyWriteFile, prompt, parseErrMsg)
 	if err != nil {
 		return "", nil, err
@@ -286,43 +297,127 @@ func encodeEcdsaSigValue(signature []byte) (out []byte, err error) {
 		big.NewInt(0).SetBytes(signature[sigLen:])})
 }
 
-// GetSigner gets the Signer based on the flags passed in by the user (from which the CredentialsOpts structure is derived)
+// GetSigner gets the Signer based on the flags passed in by the user (from which the CredentialsOpts structure is derived).
+// The signer is safe for concurrent use; calls to it are serialized.
 func GetSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string, err error) {
+	_, span := startSpan(context.Background(), opts, "LoadKey")
+	defer func() { endSpan(span, err) }()
+	signer, signatureAlgorithm, err = getSigner(opts)
+	if err != nil {
+		return nil, "", err
+	}
+	// Catches mismatched keys before a request is signed, since Roles
+	// Anywhere only reports them as signature validation failures, and
+	// certificates whose key usages don't allow client authentication.
+	// Signers that don't know their public key (such as PKCS#11 signers
+	// without a certificate object) aren't checked for mismatched keys.
+	if certificate, err := signer.Certificate(); err == nil && certificate != nil {
+		if publicKey := signer.Public(); publicKey != nil {
+			if err = checkKeyMatchesCertificate(publicKey, certificate); err != nil {
+				signer.Close()
+				return nil, "", err
+			}
+		}
+		if !opts.NoKeyUsageCheck {
+			if err = checkCertificateKeyUsage(certificate, opts.RequiredExtKeyUsages); err != nil {
+				signer.Close()
+				return nil, "", err
+			}
+		}
+	}
+	if !opts.AllowWeakKeys || fipsMode {
+		publicKey := signer.Public()
+		if certificate, err := signer.Certificate(); publicKey == nil && err == nil && certificate != nil {
+			publicKey = certificate.PublicKey
+		}
+		if err = checkKeyStrength(publicKey); err != nil {
+			signer.Close()
+			return nil, "", err
+		}
+	}
+	if signer, err = auditSigner(opts, signer); err != nil {
+		signer.Close()
+		return nil, "", fmt.Errorf("unable to open the audit log: %w", err)
+	}
+	return signer, signatureAlgorithm, nil
+}
+
+func getSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string, err error) {
 	var (
 		certificate      *x509.Certificate
 		certificateChain []*x509.Certificate
 	)
 
+	registerSecret(opts.KeyPassword)
+	registerSecret(opts.TpmKeyPassword)
+
+	if opts.SpiffeEndpointSocket != "" {
+		if opts.PrivateKeyId != "" || opts.CertificateId != "" || opts.CertificateBundleId != "" {
+			return nil, "", errors.New("the X.509-SVID of the SPIFFE Workload API can't be combined with a " +
+				"certificate, private key, or intermediates")
+		}
+		signerLog.debugf("attempting to use SpiffeSigner")
+		return GetSpiffeSigner(opts.SpiffeEndpointSocket, opts.SpiffeId)
+	}
+	if opts.KubernetesSecret != "" {
+		if opts.PrivateKeyId != "" || opts.CertificateId != "" || opts.CertificateBundleId != "" {
+			return nil, "", errors.New("the identity of a Kubernetes secret can't be combined with a " +
+				"certificate, private key, or intermediates")
+		}
+		signerLog.debugf("attempting to use KubernetesSecretSigner")
+		return GetKubernetesSecretSigner(opts.KubernetesSecret)
+	}
+	if opts.FleetProvisioning != nil {
+		if err = provisionIfMissing(opts); err != nil {
+			return nil, "", err
+		}
+	}
+	if opts.ACME != nil {
+		if err = enrollACMEIfDue(opts); err != nil {
+			return nil, "", err
+		}
+	}
+
 	privateKeyId := opts.PrivateKeyId
 	if privateKeyId == "" {
 		if opts.CertificateId == "" {
-			if Debug {
-				log.Println("attempting to use CertStoreSigner")
-			}
+			signerLog.debugf("attempting to use CertStoreSigner")
 			return GetCertStoreSigner(opts.CertIdentifier)
 		}
 		privateKeyId = opts.CertificateId
 	}
+	if factory, ok := registeredSignerFactory(privateKeyId); ok {
+		signerLog.debugf("attempting to use the registered signer for %s", privateKeyId)
+		return factory(opts)
+	}
 
 	if opts.CertificateId != "" && !strings.HasPrefix(opts.CertificateId, "pkcs11:") {
 		_, cert, err := ReadCertificateData(opts.CertificateId)
 		if err == nil {
 			certificate = cert
 		} else if opts.PrivateKeyId == "" {
-			if Debug {
-				log.Println("not a PEM certificate, so trying PKCS#12")
-			}
+			signerLog.debugf("not a PEM certificate, so trying PKCS#12")
 			if opts.CertificateBundleId != "" {
 				return nil, "", errors.New("can't specify certificate chain when" +
 					" using PKCS#12 files; certificate bundle should be provided" +
 					" within the PKCS#12 file")
 			}
 			// Not a PEM certificate? Try PKCS#12
-			_, _, err = ReadPKCS12Data(opts.CertificateId)
+			if opts.CertificateId == StdinIdentityId {
+				return nil, "", errors.New("PKCS#12 files can't be read from stdin")
+			}
+			password, err := resolvePKCS12Password(opts.CertificateId, opts.KeyPassword)
 			if err != nil {
 				return nil, "", err
 			}
-			return GetFileSystemSigner(opts.PrivateKeyId, opts.CertificateId, opts.CertificateBundleId, true)
+			_, _, err = readPKCS12DataWithPassword(opts.CertificateId, password)
+			if err != nil {
+				return nil, "", err
+			}
+			if err = checkPrivateKeyFilePermissions(opts, opts.CertificateId); err != nil {
+				return nil, "", err
+			}
+			return getFileSystemSigner(opts.PrivateKeyId, opts.CertificateId, opts.CertificateBundleId, true, password)
 		} else {
 			return nil, "", err
 		}
@@ -336,17 +431,13 @@ func GetSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string,
 	}
 
 	if strings.HasPrefix(privateKeyId, "pkcs11:") {
-		if Debug {
-			log.Println("attempting to use PKCS11Signer")
-		}
+		signerLog.debugf("attempting to use PKCS11Signer")
 		if certificate != nil {
 			opts.CertificateId = ""
 		}
 		return GetPKCS11Signer(opts.LibPkcs11, certificate, certificateChain, opts.PrivateKeyId, opts.CertificateId, opts.ReusePin)
 	} else if strings.HasPrefix(privateKeyId, "handle:") {
-		if Debug {
-			log.Println("attempting to use TPMv2Signer")
-		}
+		signerLog.debugf("attempting to use TPMv2Signer")
 		return GetTPMv2Signer(
 			GetTPMv2SignerOpts{
 				certificate,
@@ -360,9 +451,7 @@ func GetSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string,
 	} else {
 		tpmKey, err := parseDERFromPEM(privateKeyId, "TSS2 PRIVATE KEY")
 		if err == nil {
-			if Debug {
-				log.Println("attempting to use TPMv2Signer")
-			}
+			signerLog.debugf("attempting to use TPMv2Signer")
 			return GetTPMv2Signer(
 				GetTPMv2SignerOpts{
 					certificate,
@@ -375,7 +464,11 @@ func GetSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string,
 			)
 		}
 
-		_, err = ReadPrivateKeyData(privateKeyId)
+		password, err := resolvePrivateKeyPassword(privateKeyId, opts.KeyPassword)
+		if err != nil {
+			return nil, "", err
+		}
+		_, err = readPrivateKeyDataWithPassword(privateKeyId, password)
 		if err != nil {
 			return nil, "", err
 		}
@@ -383,11 +476,32 @@ func GetSigner(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string,
 		if certificate == nil {
 			return nil, "", errors.New("undefined certificate value")
 		}
-		if Debug {
-			log.Println("attempting to use FileSystemSigner")
+		if err = checkPrivateKeyFilePermissions(opts, privateKeyId); err != nil {
+			return nil, "", err
 		}
-		return GetFileSystemSigner(privateKeyId, opts.CertificateId, opts.CertificateBundleId, false)
+		signerLog.debugf("attempting to use FileSystemSigner")
+		return getFileSystemSigner(privateKeyId, opts.CertificateId, opts.CertificateBundleId, false, password)
+	}
+}
+
+// Checks that a file that holds a private key is only accessible by its
+// owner, and logs a warning if it isn't (or returns an error, if strict
+// permissions are required)
+func checkPrivateKeyFilePermissions(opts *CredentialsOpts, path string) error {
+	if path == StdinIdentityId {
+		return nil
+	}
+	err := checkOwnerOnlyPermissions(path)
+	switch {
+	case err == nil:
+	case opts.StrictPermissions:
+		return err
+	case errors.Is(err, ErrInsecurePermissions):
+		signerLog.warnf("%s", err)
+	default:
+		signerLog.debugf("unable to check the permissions of %s: %s", path, err)
 	}
+	return nil
 }
 
 // Obtain the date-time, formatted as specified by SigV4
@@ -420,9 +534,18 @@ func certificateToString(certificate *x509.Certificate) string {
 
 // Convert certificate chain to string, so that it can be pressent in the HTTP request header
 func certificateChainToString(certificateChain []*x509.Certificate) string {
+	// The certificates are encoded into a header that's allocated once, at
+	// its final size
 	var x509ChainString strings.Builder
+	size := len(certificateChain)
+	for _, certificate := range certificateChain {
+		size += base64.StdEncoding.EncodedLen(len(certificate.Raw))
+	}
+	x509ChainString.Grow(size)
 	for i, certificate := range certificateChain {
-		x509ChainString.WriteString(certificateToString(certificate))
+		encoder := base64.NewEncoder(base64.StdEncoding, &x509ChainString)
+		encoder.Write(certificate.Raw)
+		encoder.Close()
 		if i != len(certificateChain)-1 {
 			x509ChainString.WriteString(",")
 		}
@@ -431,6 +554,12 @@ func certificateChainToString(certificateChain []*x509.Certificate) string {
 }
 
 func CreateRequestSignFinalizeFunction(signer crypto.Signer, signingRegion string, signingAlgorithm string, certificate *x509.Certificate, certificateChain []*x509.Certificate) func(context.Context, middleware.FinalizeInput, middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
+	return createRequestSignFinalizeFunction(signer, signingRegion, signingAlgorithm, certificate, certificateChain, nil)
+}
+
+// Same as CreateRequestSignFinalizeFunction, but onSign (if it isn't nil) is
+// called after each request is signed
+func createRequestSignFinalizeFunction(signer crypto.Signer, signingRegion string, signingAlgorithm string, certificate *x509.Certificate, certificateChain []*x509.Certificate, onSign func(SignEvent)) func(context.Context, middleware.FinalizeInput, middleware.FinalizeHandler) (middleware.FinalizeOutput, middleware.Metadata, error) {
 	return func(ctx context.Context, in middleware.FinalizeInput, next middleware.FinalizeHandler) (out middleware.FinalizeOutput, metadata middleware.Metadata, err error) {
 		req, ok := in.Request.(*smithyhttp.Request)
 		if !ok {
@@ -438,14 +567,29 @@ func CreateRequestSignFinalizeFunction(signer crypto.Signer, signingRegion strin
 		}
 
 		payloadHash := v4.GetPayloadHash(ctx)
-		signRequest(signer, signingRegion, signingAlgorithm, certificate, certificateChain, req.Request, payloadHash)
+		start := time.Now()
+		// The span is started with the tracer of the operation, so that it's
+		// a child of the span of the CreateSession call
+		_, span := tracing.StartSpan(ctx, "SignX509")
+		span.SetProperty("aws.rolesanywhere.signing_algorithm", signingAlgorithm)
+		err = signRequest(ctx, signer, signingRegion, signingAlgorithm, certificate, certificateChain, req.Request, payloadHash)
+		endSpan(span, err)
+		if err != nil {
+			return out, metadata, err
+		}
+		if onSign != nil {
+			onSign(SignEvent{signingAlgorithm, certificate, time.Since(start)})
+		}
 
 		return next.HandleFinalize(ctx, in)
 	}
 }
 
-func signRequest(signer crypto.Signer, signingRegion string, signingAlgorithm string, certificate *x509.Certificate, certificateChain []*x509.Certificate, req *http.Request, payloadHash string) {
-	signerParams := SignerParams{time.Now(), signingRegion, ROLESANYWHERE_SIGNING_NAME, signingAlgorithm}
+// Signs the request with SigV4-X509. Signers (such as PKCS#11 modules and
+// TPMs) can't be interrupted while they compute the signature, so the context
+// is checked before and after signing.
+func signRequest(ctx context.Context, signer crypto.Signer, signingRegion string, signingAlgorithm string, certificate *x509.Certificate, certificateChain []*x509.Certificate, req *http.Request, payloadHash string) error {
+	signerParams := SignerParams{signingTime(), signingRegion, ROLESANYWHERE_SIGNING_NAME, signingAlgorithm}
 
 	// Set headers that are necessary for signing
 	req.Header.Set(host, req.URL.Host)
@@ -458,14 +602,26 @@ func signRequest(signer crypto.Signer, signingRegion string, signingAlgorithm st
 	canonicalRequest, signedHeadersString := createCanonicalRequest(req, payloadHash)
 
 	stringToSign := CreateStringToSign(canonicalRequest, signerParams)
+	if signerLog.enabled(LogLevelDebug) {
+		fullCanonicalRequest, _ := buildCanonicalRequest(req, payloadHash)
+		signerLog.debugf("Canonical request:\n%s", fullCanonicalRequest)
+		signerLog.debugf("Signed headers: %s", signedHeadersString)
+		signerLog.debugf("String to sign:\n%s", stringToSign)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
 	signatureBytes, err := signer.Sign(rand.Reader, []byte(stringToSign), crypto.SHA256)
 	if err != nil {
-		log.Println("could not sign request", err)
-		os.Exit(1)
+		return fmt.Errorf("could not sign request: %w", err)
+	}
+	if err = ctx.Err(); err != nil {
+		return err
 	}
 	signature := hex.EncodeToString(signatureBytes)
 
 	req.Header.Set(authorization, BuildAuthorizationHeader(req, signedHeadersString, signature, certificate, signerParams))
+	return nil
 }
 
 // Create the canonical query string.
@@ -550,7 +706,26 @@ func stripExcessSpaces(vals []string) {
 
 // Create the canonical request.
 func createCanonicalRequest(r *http.Request, contentSha256 string) (string, string) {
+	// The canonical request (which holds the certificate headers) is hashed
+	// in a pooled buffer, rather than being built as a string and copied
+	buffer := getBuffer()
+	defer putBuffer(buffer)
+	signedHeadersString := writeCanonicalRequest(buffer, r, contentSha256)
+	canonicalRequestStringHashBytes := sha256.Sum256(buffer.Bytes())
+	return hex.EncodeToString(canonicalRequestStringHashBytes[:]), signedHeadersString
+}
+
+// Builds the canonical request (before it's hashed) and the list of signed
+// headers
+func buildCanonicalRequest(r *http.Request, contentSha256 string) (string, string) {
 	var canonicalRequestStrBuilder strings.Builder
+	signedHeadersString := writeCanonicalRequest(&canonicalRequestStrBuilder, r, contentSha256)
+	return canonicalRequestStrBuilder.String(), signedHeadersString
+}
+
+// Writes the canonical request to the writer, and returns the list of signed
+// headers
+func writeCanonicalRequest(canonicalRequestStrBuilder io.StringWriter, r *http.Request, contentSha256 string) string {
 	canonicalHeaderString, signedHeadersString := createCanonicalHeaderString(r)
 	canonicalRequestStrBuilder.WriteString("POST")
 	canonicalRequestStrBuilder.WriteString("\n")
@@ -563,9 +738,7 @@ func createCanonicalRequest(r *http.Request, contentSha256 string) (string, stri
 	canonicalRequestStrBuilder.WriteString(signedHeadersString)
 	canonicalRequestStrBuilder.WriteString("\n")
 	canonicalRequestStrBuilder.WriteString(contentSha256)
-	canonicalRequestString := canonicalRequestStrBuilder.String()
-	canonicalRequestStringHashBytes := sha256.Sum256([]byte(canonicalRequestString))
-	return hex.EncodeToString(canonicalRequestStringHashBytes[:]), signedHeadersString
+	return signedHeadersString
 }
 
 // Create the string to sign.
@@ -610,10 +783,13 @@ func encodeDer(der []byte) (string, error) {
 }
 
 func parseDERFromPEM(pemDataId string, blockType string) (*pem.Block, error) {
-	bytes, err := os.ReadFile(pemDataId)
+	bytes, err := readPEMData(pemDataId, blockType)
 	if err != nil {
 		return nil, err
 	}
+	// The data may include a private key, and the block is decoded into a
+	// separate buffer
+	defer zeroizeBytes(bytes)
 
 	var block *pem.Block
 	for len(bytes) > 0 {
@@ -630,7 +806,7 @@ func parseDERFromPEM(pemDataId string, blockType string) (*pem.Block, error) {
 
 // Reads certificate bundle data from a file, whose path is provided
 func ReadCertificateBundleData(certificateBundleId string) ([]*x509.Certificate, error) {
-	bytes, err := os.ReadFile(certificateBundleId)
+	bytes, err := readPEMData(certificateBundleId, certificateChainBlockType)
 	if err != nil {
 		return nil, err
 	}
@@ -657,6 +833,7 @@ func readECPrivateKey(privateKeyId string) (*ecdsa.PrivateKey, error) {
 	if err != nil {
 		return nil, errors.New("could not parse PEM data")
 	}
+	defer zeroizeBytes(block.Bytes)
 
 	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
 	if err != nil {
@@ -671,6 +848,7 @@ func readRSAPrivateKey(privateKeyId string) (*rsa.PrivateKey, error) {
 	if err != nil {
 		return nil, errors.New("could not parse PEM data")
 	}
+	defer zeroizeBytes(block.Bytes)
 
 	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
 	if err != nil {
@@ -685,6 +863,7 @@ func readPKCS8PrivateKey(privateKeyId string) (crypto.PrivateKey, error) {
 	if err != nil {
 		return nil, errors.New("could not parse PEM data")
 	}
+	defer zeroizeBytes(block.Bytes)
 
 	privateKey, err := x509.ParsePKCS8PrivateKey(block.Bytes)
 	if err != nil {
@@ -714,6 +893,12 @@ func readPKCS8PrivateKey(privateKeyId string) (crypto.PrivateKey, error) {
 // also not guaranteed that those certificates form a chain with the
 // end-entity certificate either.
 func ReadPKCS12Data(certificateId string) (certChain []*x509.Certificate, privateKey crypto.PrivateKey, err error) {
+	return readPKCS12DataWithPassword(certificateId, "")
+}
+
+// Reads and parses a PKCS#12 file that's protected by the specified password
+// (see ReadPKCS12Data)
+func readPKCS12DataWithPassword(certificateId string, password string) (certChain []*x509.Certificate, privateKey crypto.PrivateKey, err error) {
 	var (
 		bytes               []byte
 		pemBlocks           []*pem.Block
@@ -722,15 +907,29 @@ func ReadPKCS12Data(certificateId string) (certChain []*x509.Certificate, privat
 		endEntityFoundIndex int
 	)
 
+	if certificateId == StdinIdentityId {
+		return nil, nil, errors.New("PKCS#12 files can't be read from stdin")
+	}
+	// PKCS#12 files are encrypted with 3DES or RC2, and keys derived with
+	// the PKCS#12 KDF
+	if err = checkFIPSApproved("PKCS#12 encryption"); err != nil {
+		return nil, nil, err
+	}
 	bytes, err = os.ReadFile(certificateId)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	pemBlocks, err = pkcs12.ToPEM(bytes, "")
+	pemBlocks, err = pkcs12.ToPEM(bytes, password)
+	zeroizeBytes(bytes)
 	if err != nil {
 		return nil, "", err
 	}
+	defer func() {
+		for _, block := range pemBlocks {
+			zeroizeBytes(block.Bytes)
+		}
+	}()
 
 	for _, block := range pemBlocks {
 		cert, err := x509.ParseCertificate(block.Bytes)
@@ -745,9 +944,7 @@ func ReadPKCS12Data(certificateId string) (certChain []*x509.Certificate, privat
 		}
 		// If neither a certificate nor a private key could be parsed from the
 		// Block, ignore it and continue.
-		if Debug {
-			log.Println("unable to parse PEM block in PKCS#12 file - skipping")
-		}
+		signerLog.debugf("unable to parse PEM block in PKCS#12 file - skipping")
 	}
 
 	certMap = make(map[string]*x509.Certificate)
@@ -767,9 +964,7 @@ func ReadPKCS12Data(certificateId string) (certChain []*x509.Certificate, privat
 			break
 		}
 	}
-	if Debug {
-		log.Println("no end-entity certificate found in PKCS#12 file")
-	}
+	signerLog.debugf("no end-entity certificate found in PKCS#12 file")
 
 	for i, cert := range parsedCerts {
 		if i != endEntityFoundIndex {
@@ -0,0 +1,119 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Creates the signer for a private key of a registered backend, along with
+// its signature algorithm. The private key ID (opts.PrivateKeyId, or
+// opts.CertificateId if it isn't set) includes the "<scheme>:" prefix.
+type SignerFactory func(opts *CredentialsOpts) (signer Signer, signatureAlgorithm string, err error)
+
+var (
+	signerFactoriesMu sync.RWMutex
+	signerFactories   = map[string]SignerFactory{}
+
+	// Schemes of private key IDs that the built-in backends handle
+	reservedSignerSchemes = map[string]bool{"pkcs11": true, "handle": true, "file": true}
+	// At least two characters, so that Windows paths (such as C:\key.pem)
+	// aren't mistaken for keys of a backend
+	signerSchemePattern = regexp.MustCompile(`^[a-z][a-z0-9+.-]+$`)
+)
+
+// Registers a backend for private keys whose IDs start with "<scheme>:" (such
+// as "myhsm:key-1"), so that GetSigner, NewCredentialer, and the commands of
+// programs that embed the credential helper use the factory to create their
+// signer. NewCryptoSigner can be used to build the signer around a
+// crypto.Signer.
+func RegisterSigner(scheme string, factory SignerFactory) error {
+	if !signerSchemePattern.MatchString(scheme) {
+		return fmt.Errorf("invalid signer scheme %q", scheme)
+	}
+	if reservedSignerSchemes[scheme] {
+		return fmt.Errorf("signer scheme %q is used by a built-in backend", scheme)
+	}
+
+	signerFactoriesMu.Lock()
+	defer signerFactoriesMu.Unlock()
+	if _, ok := signerFactories[scheme]; ok {
+		return fmt.Errorf("signer scheme %q is already registered", scheme)
+	}
+	signerFactories[scheme] = factory
+	return nil
+}
+
+// Returns the factory that's registered for the scheme of the private key ID,
+// if there is one
+func registeredSignerFactory(privateKeyId string) (SignerFactory, bool) {
+	scheme, _, ok := strings.Cut(privateKeyId, ":")
+	if !ok {
+		return nil, false
+	}
+	signerFactoriesMu.RLock()
+	defer signerFactoriesMu.RUnlock()
+	factory, ok := signerFactories[scheme]
+	return factory, ok
+}
+
+// Signer that's backed by a crypto.Signer
+type cryptoSigner struct {
+	signer           crypto.Signer
+	certificate      *x509.Certificate
+	certificateChain []*x509.Certificate
+}
+
+// Builds a Signer around a crypto.Signer (such as a key held in an HSM
+// abstraction of the application) and the certificate for its public key. The
+// signature algorithm is determined by the type of the key, which must be an
+// RSA or ECDSA key.
+func NewCryptoSigner(signer crypto.Signer, certificate *x509.Certificate, certificateChain []*x509.Certificate) (Signer, string, error) {
+	if certificate == nil {
+		return nil, "", errors.New("undefined certificate value")
+	}
+	_, signatureAlgorithm, err := privateKeySigner(signer)
+	if err != nil {
+		return nil, "", err
+	}
+	if err = checkKeyMatchesCertificate(signer.Public(), certificate); err != nil {
+		return nil, "", err
+	}
+	return &cryptoSigner{signer, certificate, certificateChain}, signatureAlgorithm, nil
+}
+
+func (s *cryptoSigner) Public() crypto.PublicKey {
+	return s.signer.Public()
+}
+
+// Hashes the message (unless it's a digest already), since crypto.Signer
+// implementations sign digests
+func (s *cryptoSigner) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	digest, err := signatureDigest(message, opts)
+	if err != nil {
+		return nil, err
+	}
+	return s.signer.Sign(rand, digest, opts.HashFunc())
+}
+
+func (s *cryptoSigner) Certificate() (*x509.Certificate, error) {
+	return s.certificate, nil
+}
+
+func (s *cryptoSigner) CertificateChain() ([]*x509.Certificate, error) {
+	return s.certificateChain, nil
+}
+
+// Closes the crypto.Signer, if it can be closed
+func (s *cryptoSigner) Close() {
+	if closer, ok := s.signer.(interface{ Close() }); ok {
+		closer.Close()
+	} else if closer, ok := s.signer.(io.Closer); ok {
+		closer.Close()
+	}
+}
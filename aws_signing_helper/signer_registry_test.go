@@ -0,0 +1,73 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto"
+	"testing"
+)
+
+func TestRegisterSigner(t *testing.T) {
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	defer func() {
+		signerFactoriesMu.Lock()
+		delete(signerFactories, "testhsm")
+		signerFactoriesMu.Unlock()
+	}()
+
+	// The factory plays the part of an HSM abstraction of the application,
+	// whose keys are only available as a crypto.Signer
+	keyIds := []string{}
+	err := RegisterSigner("testhsm", func(opts *CredentialsOpts) (Signer, string, error) {
+		keyIds = append(keyIds, opts.PrivateKeyId)
+		privateKey, err := ReadPrivateKeyData("../tst/certs/ec-prime256v1-key.pem")
+		if err != nil {
+			return nil, "", err
+		}
+		_, certificate, err := ReadCertificateData(opts.CertificateId)
+		if err != nil {
+			return nil, "", err
+		}
+		return NewCryptoSigner(privateKey.(crypto.Signer), certificate, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"testhsm", "pkcs11", "c", "Not A Scheme"} {
+		if err = RegisterSigner(scheme, nil); err == nil {
+			t.Log("registered a signer for the scheme", scheme)
+			t.Fail()
+		}
+	}
+
+	opts := CredentialsOpts{
+		PrivateKeyId:      "testhsm:slot-1/key-1",
+		CertificateId:     "../tst/certs/ec-prime256v1-sha256-cert.pem",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:   900,
+		Endpoint:          server.URL,
+	}
+	credentialer, err := NewCredentialer(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer credentialer.Close()
+	if _, err = credentialer.Credentials(context.Background()); err != nil {
+		t.Log("unable to obtain credentials with the registered signer:", err)
+		t.Fail()
+	}
+	if len(keyIds) != 1 || keyIds[0] != "testhsm:slot-1/key-1" {
+		t.Log("unexpected calls of the factory:", keyIds)
+		t.Fail()
+	}
+
+	// The certificate has to match the key of the signer
+	privateKey, _ := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	_, certificate, _ := ReadCertificateData("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if _, _, err = NewCryptoSigner(privateKey.(crypto.Signer), certificate, nil); err == nil {
+		t.Log("built a signer for a certificate that doesn't match its key")
+		t.Fail()
+	}
+}
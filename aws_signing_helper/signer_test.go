@@ -2,6 +2,10 @@ package aws_signing_helper
 
 import (
 	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
@@ -10,6 +14,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"runtime"
 	"strings"
 	"testing"
 	"time"
@@ -150,7 +156,10 @@ func TestBuildAuthorizationHeader(t *testing.T) {
 	}
 	signingRegion := "us-west-2"
 	emptyStringSHA256 := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
-	signRequest(signer, signingRegion, signingAlgorithm, certificate, certificateChain, testRequest, emptyStringSHA256)
+	if err = signRequest(context.Background(), signer, signingRegion, signingAlgorithm, certificate, certificateChain, testRequest, emptyStringSHA256); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
 
 	certificateList2, _ := ReadCertificateBundleData("../tst/certs/rsa-4096-sha256-cert.pem")
 	certificate2 := certificateList2[0]
@@ -178,7 +187,10 @@ func TestBuildAuthorizationHeader(t *testing.T) {
 	}
 	os.Rename("../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-4096-sha256-cert.pem")
 	os.Rename("../tst/certs/rsa-2048-sha256-cert.pem.bak", "../tst/certs/rsa-2048-sha256-cert.pem")
-	signRequest(signer, signingRegion, signingAlgorithm, certificate, certificateChain, testRequest, emptyStringSHA256)
+	if err = signRequest(context.Background(), signer, signingRegion, signingAlgorithm, certificate, certificateChain, testRequest, emptyStringSHA256); err != nil {
+		t.Log(err)
+		t.Fail()
+	}
 }
 
 func TestSign(t *testing.T) {
@@ -224,30 +236,36 @@ func TestSign(t *testing.T) {
 
 	for _, digest := range rsa_digests {
 		for _, keylen := range rsa_key_lengths {
+			// 1024-bit keys are rejected unless weak keys are allowed
+			allowWeakKeys := keylen == "1024"
 			cert := fmt.Sprintf("../tst/certs/rsa-%s-%s-cert.pem",
 				keylen, digest)
 			key := fmt.Sprintf("../tst/certs/rsa-%s-key.pem", keylen)
 			testTable = append(testTable, CredentialsOpts{
 				CertificateId: cert,
 				PrivateKeyId:  key,
+				AllowWeakKeys: allowWeakKeys,
 			})
 
 			key = fmt.Sprintf("../tst/certs/rsa-%s-key-pkcs8.pem", keylen)
 			testTable = append(testTable, CredentialsOpts{
 				CertificateId: cert,
 				PrivateKeyId:  key,
+				AllowWeakKeys: allowWeakKeys,
 			})
 
 			cert = fmt.Sprintf("../tst/certs/rsa-%s-%s.p12",
 				keylen, digest)
 			testTable = append(testTable, CredentialsOpts{
 				CertificateId: cert,
+				AllowWeakKeys: allowWeakKeys,
 			})
 
 			cert = fmt.Sprintf("../tst/certs/rsa-%s-%s-combo.pem",
 				keylen, digest)
 			testTable = append(testTable, CredentialsOpts{
 				CertificateId: cert,
+				AllowWeakKeys: allowWeakKeys,
 			})
 		}
 	}
@@ -518,6 +536,32 @@ aws_access_key_id = test
 [test]
 aws_secret_access_key = test`,
 		},
+		{
+			name:   "test-preserves-comments-and-trailing-keys",
+			server: GetMockedCreateSessionResponseServer(),
+			inputFileContents: `# Managed by hand
+[other]
+aws_access_key_id = other ; keep me
+
+[ test ] # refreshed by the credential helper
+# rotated automatically
+aws_access_key_id=test
+region = us-east-1
+aws_access_key_id = duplicate
+output = json`,
+			profile: "test",
+			expectedFileContents: `# Managed by hand
+[other]
+aws_access_key_id = other ; keep me
+
+[ test ] # refreshed by the credential helper
+# rotated automatically
+aws_access_key_id = accessKeyId
+region = us-east-1
+output = json
+aws_secret_access_key = secretAccessKey
+aws_session_token = sessionToken`,
+		},
 	}
 	for _, tc := range testTable {
 		credentialsOpts := CredentialsOpts{
@@ -695,7 +739,13 @@ func trimLastChar(s string) string {
 }
 
 func GetMockedCreateSessionResponseServer() *httptest.Server {
-	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	return httptest.NewServer(mockedCreateSessionHandler())
+}
+
+// Handler of the mocked CreateSession server, for tests that configure the
+// server before it's started
+func mockedCreateSessionHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusCreated)
 		w.Write([]byte(`{
 			"credentialSet":[
@@ -717,5 +767,74 @@ func GetMockedCreateSessionResponseServer() *httptest.Server {
 			],
 			"subjectArn": "arn:aws:rolesanywhere:us-east-1:000000000000:subject/41cl0bae-6783-40d4-ab20-65dc5d922e45"
 		  }`))
-	}))
+	})
+}
+
+func TestKeyCertificateMismatch(t *testing.T) {
+	opts := CredentialsOpts{
+		PrivateKeyId:  "../tst/certs/rsa-2048-key.pem",
+		CertificateId: "../credential-process-data/client-cert.pem",
+	}
+	if _, _, err := GetSigner(&opts); !errors.Is(err, ErrKeyCertificateMismatch) {
+		t.Errorf("expected mismatch error from GetSigner, got %v", err)
+	}
+
+	key, _ := ReadPrivateKeyData("../tst/certs/rsa-2048-key.pem")
+	_, certificate, _ := ReadCertificateData("../credential-process-data/client-cert.pem")
+	if _, _, err := NewCryptoSigner(key.(crypto.Signer), certificate, nil); !errors.Is(err, ErrKeyCertificateMismatch) {
+		t.Errorf("expected mismatch error from NewCryptoSigner, got %v", err)
+	}
+
+	// The private key file is rotated without the certificate
+	dir := t.TempDir()
+	for source, destination := range map[string]string{
+		"../credential-process-data/client-key.pem":  "key.pem",
+		"../credential-process-data/client-cert.pem": "cert.pem",
+	} {
+		data, _ := os.ReadFile(source)
+		os.WriteFile(filepath.Join(dir, destination), data, 0600)
+	}
+	opts = CredentialsOpts{PrivateKeyId: filepath.Join(dir, "key.pem"), CertificateId: filepath.Join(dir, "cert.pem")}
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	data, _ := os.ReadFile("../tst/certs/rsa-2048-key.pem")
+	os.WriteFile(filepath.Join(dir, "key.pem"), data, 0600)
+	if _, err = signer.Sign(rand.Reader, []byte("test"), crypto.SHA256); !errors.Is(err, ErrKeyCertificateMismatch) {
+		t.Errorf("expected mismatch error after rotation, got %v", err)
+	}
+}
+
+func TestPrivateKeyFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes don't control access on Windows")
+	}
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "key.pem")
+	data, _ := os.ReadFile("../credential-process-data/client-key.pem")
+	os.WriteFile(keyPath, data, 0600)
+	os.Chmod(keyPath, 0644)
+	opts := CredentialsOpts{
+		PrivateKeyId:  keyPath,
+		CertificateId: "../credential-process-data/client-cert.pem",
+	}
+
+	// Open permissions only cause a warning by default
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.Close()
+
+	opts.StrictPermissions = true
+	if _, _, err = GetSigner(&opts); !errors.Is(err, ErrInsecurePermissions) || !strings.Contains(err.Error(), "0644") {
+		t.Errorf("expected open permissions to be rejected, got %v", err)
+	}
+	os.Chmod(keyPath, 0600)
+	if signer, _, err = GetSigner(&opts); err != nil {
+		t.Fatal(err)
+	}
+	signer.Close()
 }
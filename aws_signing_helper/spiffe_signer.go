@@ -0,0 +1,125 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// How long GetSpiffeSigner waits for the first X.509-SVID (for example,
+// while the SPIRE agent attests the workload after it started)
+var spiffeFetchTimeout = 30 * time.Second
+
+// How long to wait before reconnecting to the Workload API, after the
+// stream of X.509-SVIDs was interrupted
+var spiffeRetryInterval = 5 * time.Second
+
+// Signer whose identity is the X.509-SVID of the workload, which is fetched
+// from the SPIFFE Workload API (such as the socket of a SPIRE agent). The
+// stream of X.509-SVIDs is kept open, so that rotated SVIDs are used as soon
+// as they're issued, without files.
+type SpiffeSigner struct {
+	rotatingSigner
+	spiffeId string
+}
+
+// Connects to the SPIFFE Workload API at the address (unix:///path/to/socket
+// or tcp://IP:port, as SPIFFE_ENDPOINT_SOCKET is set), and waits for the
+// X.509-SVID of the workload. If the workload has more than one, the one of
+// the SPIFFE ID is used (or, without a SPIFFE ID, the first one, which is its
+// default).
+func GetSpiffeSigner(address string, spiffeId string) (signer Signer, signingAlgorithm string, err error) {
+	network, path, err := parseWorkloadAPIAddress(address)
+	if err != nil {
+		return nil, "", err
+	}
+	spiffeSigner := &SpiffeSigner{spiffeId: spiffeId}
+	spiffeSigner.start(func(ctx context.Context) { spiffeSigner.watch(ctx, network, path) })
+	signingAlgorithm, err = spiffeSigner.wait(spiffeFetchTimeout)
+	if err != nil {
+		return nil, "", fmt.Errorf("no X.509-SVID was received from the SPIFFE Workload API at %s within %s: %w",
+			address, spiffeFetchTimeout, err)
+	}
+	return spiffeSigner, signingAlgorithm, nil
+}
+
+// Fetches the X.509-SVIDs of the workload until the context is done,
+// reconnecting whenever the stream is interrupted
+func (spiffeSigner *SpiffeSigner) watch(ctx context.Context, network string, path string) {
+	for {
+		err := spiffeSigner.fetch(ctx, network, path)
+		if ctx.Err() != nil {
+			return
+		}
+		if !spiffeSigner.setError(err) {
+			signerLog.warnf("the stream of X.509-SVIDs from the SPIFFE Workload API was interrupted (reconnecting in %s): %s",
+				spiffeRetryInterval, err)
+		} else {
+			signerLog.debugf("unable to fetch the X.509-SVID from the SPIFFE Workload API (retrying in %s): %s",
+				spiffeRetryInterval, err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(spiffeRetryInterval):
+		}
+	}
+}
+
+// Opens a stream of X.509-SVIDs, and uses each one that's received, until
+// the stream ends
+func (spiffeSigner *SpiffeSigner) fetch(ctx context.Context, network string, path string) error {
+	stream, err := openX509SVIDStream(ctx, network, path)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for {
+		svids, err := stream.next()
+		if err != nil {
+			return err
+		}
+		if err = spiffeSigner.update(svids); err != nil {
+			// The Workload API sends the next X.509-SVIDs once they're
+			// rotated, so the current one is kept in the meantime
+			if !spiffeSigner.setError(err) {
+				signerLog.warnf("unable to use the X.509-SVID from the SPIFFE Workload API: %s", err)
+			}
+		}
+	}
+}
+
+// Switches to the X.509-SVID of the SPIFFE ID (or the first one) among those
+// that were received
+func (spiffeSigner *SpiffeSigner) update(svids []x509SVID) error {
+	defer func() {
+		for _, svid := range svids {
+			zeroizeBytes(svid.PrivateKey)
+		}
+	}()
+	var svid *x509SVID
+	for i := range svids {
+		if spiffeSigner.spiffeId == "" || svids[i].SpiffeId == spiffeSigner.spiffeId {
+			svid = &svids[i]
+			break
+		}
+	}
+	if svid == nil {
+		if spiffeSigner.spiffeId == "" {
+			return errors.New("the workload has no X.509-SVID")
+		}
+		return fmt.Errorf("the workload has no X.509-SVID for %s", spiffeSigner.spiffeId)
+	}
+
+	certificates, err := x509.ParseCertificates(svid.Certificates)
+	if err != nil {
+		return fmt.Errorf("unable to parse the X.509-SVID of %s: %w", svid.SpiffeId, err)
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(svid.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("unable to parse the private key of the X.509-SVID of %s: %w", svid.SpiffeId, err)
+	}
+	return spiffeSigner.rotate(certificates, privateKey, nil, "X.509-SVID of "+svid.SpiffeId)
+}
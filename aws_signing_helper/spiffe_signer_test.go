@@ -0,0 +1,101 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSpiffeSigner(t *testing.T) {
+	for address, expected := range map[string]string{
+		"unix:///run/spire/sockets/agent.sock": "unix /run/spire/sockets/agent.sock",
+		"unix:/tmp/agent.sock":                 "unix /tmp/agent.sock",
+		"tcp://127.0.0.1:8081":                 "tcp 127.0.0.1:8081",
+		"/run/spire/sockets/agent.sock":        "",
+		"unix://agent/run/agent.sock":          "",
+		"tcp://localhost:8081":                 "",
+		"tcp://127.0.0.1":                      "",
+		"npipe:spire-agent":                    "",
+	} {
+		network, path, err := parseWorkloadAPIAddress(address)
+		if (err == nil) != (expected != "") || (err == nil && network+" "+path != expected) {
+			t.Logf("unexpected address of %s: %s %s (%v)", address, network, path, err)
+			t.Fail()
+		}
+	}
+
+	responses := make(chan []x509SVID, 4)
+	defer close(responses)
+	address := startFakeWorkloadAPI(t, responses)
+
+	other := readTestSVID(t, "spiffe://example.org/other", "../tst/certs/rsa-2048-sha256-cert.pem", "../tst/certs/rsa-2048-key-pkcs8.pem")
+	workload := readTestSVID(t, "spiffe://example.org/workload", "../tst/certs/ec-prime256v1-sha256-cert.pem", "../tst/certs/ec-prime256v1-key-pkcs8.pem")
+	responses <- []x509SVID{other, workload}
+
+	server := GetMockedCreateSessionResponseServer()
+	defer server.Close()
+	opts := CredentialsOpts{
+		SpiffeEndpointSocket: address,
+		SpiffeId:             "spiffe://example.org/workload",
+		TrustAnchorArnStr:    "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a8864d16-6d82-4f6d-a5ee-45ee8b7e3c68",
+		ProfileArnStr:        "arn:aws:rolesanywhere:us-east-1:000000000000:profile/6f4943fb-13d4-4242-89c4-be367595c380",
+		RoleArn:              "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		SessionDuration:      900,
+		Endpoint:             server.URL,
+	}
+	signer, signatureAlgorithm, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if signatureAlgorithm != aws4_x509_ecdsa_sha256 {
+		t.Log("unexpected signature algorithm:", signatureAlgorithm)
+		t.Fail()
+	}
+	if certificate, _ := signer.Certificate(); certificate == nil || !bytes.Equal(certificate.Raw, workload.Certificates) {
+		t.Log("the signer doesn't use the X.509-SVID of the SPIFFE ID")
+		t.Fail()
+	}
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Log("unable to obtain credentials with the X.509-SVID:", err)
+		t.Fail()
+	}
+
+	// Rotated X.509-SVIDs are used as soon as they're received
+	rotated := readTestSVID(t, "spiffe://example.org/workload", "../tst/certs/ec-secp384r1-sha256-cert.pem", "../tst/certs/ec-secp384r1-key-pkcs8.pem")
+	responses <- []x509SVID{other, rotated}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if certificate, _ := signer.Certificate(); certificate != nil && bytes.Equal(certificate.Raw, rotated.Certificates) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the signer didn't switch to the rotated X.509-SVID")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = GenerateCredentials(&opts, signer, signatureAlgorithm); err != nil {
+		t.Log("unable to obtain credentials with the rotated X.509-SVID:", err)
+		t.Fail()
+	}
+
+	// The workload has no X.509-SVID for other SPIFFE IDs
+	defer func(timeout time.Duration) { spiffeFetchTimeout = timeout }(spiffeFetchTimeout)
+	spiffeFetchTimeout = 500 * time.Millisecond
+	otherResponses := make(chan []x509SVID, 1)
+	defer close(otherResponses)
+	otherResponses <- []x509SVID{other, rotated}
+	opts.SpiffeEndpointSocket = startFakeWorkloadAPI(t, otherResponses)
+	opts.SpiffeId = "spiffe://example.org/unknown"
+	if _, _, err = GetSigner(&opts); err == nil || !strings.Contains(err.Error(), "no X.509-SVID for spiffe://example.org/unknown") {
+		t.Log("unexpected error for an unknown SPIFFE ID:", err)
+		t.Fail()
+	}
+	opts.SpiffeId = ""
+	opts.CertificateId = "../tst/certs/ec-prime256v1-sha256-cert.pem"
+	if _, _, err = GetSigner(&opts); err == nil {
+		t.Log("combined the X.509-SVID with a certificate")
+		t.Fail()
+	}
+}
@@ -0,0 +1,24 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/x509"
+	"strings"
+)
+
+// Starts loading, in the background, what obtaining credentials needs but
+// doesn't depend on the signer, so that it's loaded while the signer is
+// initialized (which may parse long certificate chains, decrypt the private
+// key, or talk to a TPM or PKCS#11 module) rather than afterwards: the system
+// root certificates (which the connection to Roles Anywhere is verified
+// with), the trust anchor certificate (if it's downloaded), and, with the
+// Preconnect option, the connection to Roles Anywhere.
+func Preload(opts *CredentialsOpts) {
+	go x509.SystemCertPool()
+	if strings.HasPrefix(opts.TrustAnchorCertificate, "http://") || strings.HasPrefix(opts.TrustAnchorCertificate, "https://") {
+		go readTrustAnchorCertificates(context.Background(), opts)
+	}
+	if opts.Preconnect {
+		go preconnect(context.Background(), opts)
+	}
+}
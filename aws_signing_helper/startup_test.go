@@ -0,0 +1,46 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestPreload(t *testing.T) {
+	data, err := os.ReadFile("../tst/certs/rsa-2048-sha256-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var downloads atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads.Add(1)
+		w.Write(data)
+	}))
+	defer server.Close()
+	opts := CredentialsOpts{TrustAnchorCertificate: server.URL + "/preload-ca.pem"}
+	defer trustAnchorCertificateCache.Delete(opts.TrustAnchorCertificate)
+
+	// The trust anchor certificate is downloaded in the background, and
+	// reused when the chain is checked
+	Preload(&opts)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, ok := trustAnchorCertificateCache.Load(opts.TrustAnchorCertificate); ok {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the trust anchor certificate wasn't preloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err = readTrustAnchorCertificates(context.Background(), &opts); err != nil {
+		t.Fatal(err)
+	}
+	if n := downloads.Load(); n != 1 {
+		t.Errorf("unexpected number of downloads: %d", n)
+	}
+}
@@ -0,0 +1,66 @@
+package aws_signing_helper
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Prefix of the names of statsd metrics, if none is given
+const DefaultStatsdPrefix = "rolesanywhere"
+
+// Metrics that are sent to a statsd server (or a Datadog agent, which also
+// accepts tags), one datagram per update. Gauges of durations are sent as
+// timers, in milliseconds, so that the server aggregates their percentiles.
+type statsdMetrics struct {
+	mu     sync.Mutex
+	conn   net.Conn
+	prefix string
+	// Datadog tags of every metric, already formatted
+	tags string
+}
+
+// Returns metrics that are sent to the statsd server at the address (a UDP
+// host and port, such as 127.0.0.1:8125, or unix:/path for the Unix domain
+// datagram socket of a Datadog agent), with the prefix (DefaultStatsdPrefix,
+// if it's empty) and Datadog tags (such as "env:prod"), which plain statsd
+// servers ignore
+func NewStatsdMetrics(address string, prefix string, tags []string) (Metrics, error) {
+	network := "udp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unixgram", path
+	}
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	if prefix == "" {
+		prefix = DefaultStatsdPrefix
+	}
+	metrics := &statsdMetrics{conn: conn, prefix: strings.TrimSuffix(prefix, ".") + "."}
+	if len(tags) > 0 {
+		metrics.tags = "|#" + strings.Join(tags, ",")
+	}
+	return metrics, nil
+}
+
+func (m *statsdMetrics) AddCounter(name string, delta int64) {
+	m.send(name, strconv.FormatInt(delta, 10), "c")
+}
+
+func (m *statsdMetrics) SetGauge(name string, value float64) {
+	if seconds, ok := strings.CutSuffix(name, "_duration_seconds"); ok {
+		m.send(seconds+"_duration", strconv.FormatFloat(value*1000, 'f', -1, 64), "ms")
+		return
+	}
+	m.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g")
+}
+
+// Sends the update. Failures (such as an agent that isn't running) are
+// ignored, as statsd clients do, since metrics are best-effort.
+func (m *statsdMetrics) send(name string, value string, kind string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.conn.Write([]byte(m.prefix + name + ":" + value + "|" + kind + m.tags))
+}
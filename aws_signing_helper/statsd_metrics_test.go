@@ -0,0 +1,44 @@
+package aws_signing_helper
+
+import (
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestStatsdMetrics(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer server.Close()
+	metrics, err := NewStatsdMetrics(server.LocalAddr().String(), "", []string{"env:test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	hooks := MetricsHooks(metrics, Hooks{})
+	hooks.OnRefresh(RefreshEvent{Expiration: time.Unix(1700000000, 0), Duration: 1500 * time.Millisecond})
+	hooks.OnCacheHit(CacheHitEvent{})
+
+	var datagrams []string
+	buf := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(datagrams) < 5 {
+		n, _, err := server.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datagrams = append(datagrams, string(buf[:n]))
+	}
+	expected := []string{
+		"rolesanywhere.refreshes:1|c|#env:test",
+		"rolesanywhere.refresh_duration:1500|ms|#env:test",
+		"rolesanywhere.refresh_duration_millis_total:1500|c|#env:test",
+		"rolesanywhere.credentials_expiration_seconds:1700000000|g|#env:test",
+		"rolesanywhere.cache_hits:1|c|#env:test",
+	}
+	if !reflect.DeepEqual(datagrams, expected) {
+		t.Errorf("unexpected datagrams: %q", datagrams)
+	}
+}
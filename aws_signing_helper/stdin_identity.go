@@ -0,0 +1,117 @@
+package aws_signing_helper
+
+import (
+	"encoding/pem"
+	"errors"
+	"io"
+	"os"
+	"sync"
+)
+
+// Identifier that can be passed instead of a path for the certificate,
+// private key, or certificate chain, to read them from stdin instead
+const StdinIdentityId = "-"
+
+// Pseudo block type that refers to all of the certificates on stdin that
+// follow the end-entity certificate
+const certificateChainBlockType = "CERTIFICATE CHAIN"
+
+// Identity material read from stdin, as PEM data. Stdin can only be read
+// once, but the certificate and private key are read multiple times (for
+// example, each time that credentials are refreshed), so it's cached.
+var stdinIdentity struct {
+	once        sync.Once
+	certificate []byte
+	privateKey  []byte
+	chain       []byte
+	err         error
+	// Guards the private key, which ZeroizeSecrets overwrites
+	mu       sync.Mutex
+	zeroized bool
+}
+
+// Stdin is read through a variable, so that tests can substitute it
+var stdinReader io.Reader = os.Stdin
+
+// Reads the identity material from stdin. The framing convention is a
+// sequence of PEM blocks: the first CERTIFICATE block is the end-entity
+// certificate, any subsequent CERTIFICATE blocks form the certificate chain
+// (ordered from the issuer of the end-entity certificate upwards), and the
+// private key is a PRIVATE KEY, EC PRIVATE KEY, RSA PRIVATE KEY, or
+// ENCRYPTED PRIVATE KEY block.
+// Text between blocks is ignored, as is the case for PEM files.
+func readStdinIdentity() error {
+	stdinIdentity.once.Do(func() {
+		data, err := io.ReadAll(stdinReader)
+		if err != nil {
+			stdinIdentity.err = err
+			return
+		}
+		defer zeroizeBytes(data)
+
+		for len(data) > 0 {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			encoded := pem.EncodeToMemory(block)
+
+			switch block.Type {
+			case "CERTIFICATE":
+				if stdinIdentity.certificate == nil {
+					stdinIdentity.certificate = encoded
+				} else {
+					stdinIdentity.chain = append(stdinIdentity.chain, encoded...)
+				}
+			case "PRIVATE KEY", "EC PRIVATE KEY", "RSA PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+				if stdinIdentity.privateKey != nil {
+					stdinIdentity.err = errors.New("more than one private key found on stdin")
+					return
+				}
+				// The private key is kept in locked memory, so that it
+				// isn't written to swap
+				stdinIdentity.privateKey = lockedCopy(encoded)
+				zeroizeBytes(block.Bytes)
+			default:
+				stdinIdentity.err = errors.New("unexpected PEM block of type " + block.Type + " found on stdin")
+				return
+			}
+		}
+	})
+	return stdinIdentity.err
+}
+
+// Reads PEM data from the file at the specified path or, if the path is
+// StdinIdentityId, the part of the identity material on stdin that contains
+// the specified block type
+func readPEMData(pemDataId string, blockType string) ([]byte, error) {
+	if pemDataId != StdinIdentityId {
+		return os.ReadFile(pemDataId)
+	}
+
+	if err := readStdinIdentity(); err != nil {
+		return nil, err
+	}
+
+	// The data is copied, since callers zeroize it once they've parsed it
+	var data []byte
+	switch blockType {
+	case "CERTIFICATE":
+		data = stdinIdentity.certificate
+	case certificateChainBlockType:
+		// The chain is optional, so it may be empty
+		return append([]byte{}, stdinIdentity.chain...), nil
+	default:
+		stdinIdentity.mu.Lock()
+		defer stdinIdentity.mu.Unlock()
+		if stdinIdentity.zeroized {
+			return nil, errors.New("the private key that was read from stdin has been zeroized")
+		}
+		data = stdinIdentity.privateKey
+	}
+	if data == nil {
+		return nil, errors.New("no PEM block of type " + blockType + " found on stdin")
+	}
+	return append([]byte{}, data...), nil
+}
@@ -0,0 +1,63 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"os"
+	"testing"
+)
+
+func TestStdinIdentity(t *testing.T) {
+	var stdinData []byte
+	for _, path := range []string{
+		"../credential-process-data/client-key.pem",
+		"../credential-process-data/client-cert.pem",
+		"../credential-process-data/root-cert.pem",
+	} {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		stdinData = append(stdinData, data...)
+	}
+	stdinReader = bytes.NewReader(stdinData)
+	defer func() { stdinReader = os.Stdin }()
+
+	opts := CredentialsOpts{
+		PrivateKeyId:        StdinIdentityId,
+		CertificateId:       StdinIdentityId,
+		CertificateBundleId: StdinIdentityId,
+	}
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	_, expectedCert, _ := ReadCertificateData("../credential-process-data/client-cert.pem")
+	_, expectedRootCert, _ := ReadCertificateData("../credential-process-data/root-cert.pem")
+	// Read the identity material more than once, as is done when refreshing
+	for i := 0; i < 2; i++ {
+		cert, _ := signer.Certificate()
+		chain, _ := signer.CertificateChain()
+		if !cert.Equal(expectedCert) || len(chain) != 1 || !chain[0].Equal(expectedRootCert) {
+			t.Log("unexpected certificate or chain read from stdin")
+			t.Fail()
+		}
+		if _, err := signer.Sign(rand.Reader, []byte("test"), crypto.SHA256); err != nil {
+			t.Log("unable to sign with private key read from stdin:", err)
+			t.Fail()
+		}
+	}
+
+	ZeroizeSecrets()
+	for _, b := range stdinIdentity.privateKey {
+		if b != 0 {
+			t.Fatal("private key read from stdin wasn't zeroized")
+		}
+	}
+	if _, err := signer.Sign(rand.Reader, []byte("test"), crypto.SHA256); err == nil {
+		t.Error("signed with a zeroized private key")
+	}
+}
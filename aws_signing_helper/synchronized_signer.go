@@ -0,0 +1,61 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"io"
+	"sync"
+)
+
+// Signer that serializes the calls to the signer it wraps. PKCS#11 sessions,
+// TPM contexts, and the handles of platform certificate stores aren't safe
+// for concurrent use (and neither are all crypto.Signer implementations of
+// registered backends), so the signers that GetSigner returns are wrapped in
+// it. That way, a single signer can back the local server of the serve
+// command, or a credentials provider that's shared between goroutines.
+// Signatures are also recorded in the audit log, if there is one.
+type synchronizedSigner struct {
+	mu     sync.Mutex
+	signer Signer
+	audit  *auditLog
+}
+
+// Wraps the signer so that it's safe for concurrent use
+func synchronizeSigner(signer Signer) Signer {
+	if _, ok := signer.(*synchronizedSigner); ok || signer == nil {
+		return signer
+	}
+	return &synchronizedSigner{signer: signer}
+}
+
+func (s *synchronizedSigner) Public() crypto.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signer.Public()
+}
+
+func (s *synchronizedSigner) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	signature, err := s.signer.Sign(rand, digest, opts)
+	s.audit.recordSignature(s.signer, digest, opts, err)
+	return signature, err
+}
+
+func (s *synchronizedSigner) Certificate() (*x509.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signer.Certificate()
+}
+
+func (s *synchronizedSigner) CertificateChain() ([]*x509.Certificate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.signer.CertificateChain()
+}
+
+func (s *synchronizedSigner) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signer.Close()
+}
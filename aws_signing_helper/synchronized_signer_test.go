@@ -0,0 +1,75 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/rand"
+	"io"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Signer that fails the test if its methods are called concurrently
+type exclusiveSigner struct {
+	Signer
+	t      *testing.T
+	active atomic.Int32
+}
+
+func (s *exclusiveSigner) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if s.active.Add(1) != 1 {
+		s.t.Error("signer was called concurrently")
+	}
+	defer s.active.Add(-1)
+	time.Sleep(time.Millisecond)
+	return s.Signer.Sign(rand, message, opts)
+}
+
+func TestSynchronizedSigner(t *testing.T) {
+	defer func() {
+		signerFactoriesMu.Lock()
+		delete(signerFactories, "exclusive")
+		signerFactoriesMu.Unlock()
+	}()
+	err := RegisterSigner("exclusive", func(opts *CredentialsOpts) (Signer, string, error) {
+		signer, signatureAlgorithm, err := GetSigner(&CredentialsOpts{
+			PrivateKeyId:  "../tst/certs/ec-prime256v1-key.pem",
+			CertificateId: opts.CertificateId,
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return &exclusiveSigner{Signer: signer, t: t}, signatureAlgorithm, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, _, err := GetSigner(&CredentialsOpts{
+		PrivateKeyId:  "exclusive:key-1",
+		CertificateId: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	if synchronizeSigner(signer) != signer {
+		t.Error("synchronized signer was wrapped again")
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := signer.Sign(rand.Reader, []byte("message"), crypto.SHA256); err != nil {
+				t.Error(err)
+			}
+			if _, err := signer.Certificate(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,48 @@
+package aws_signing_helper
+
+import (
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Earliest time that the system clock can plausibly read, since it's before
+// this version of the package was written. Devices without a battery-backed
+// clock typically boot with their clock at (or shortly after) the epoch.
+var minimumSystemTime = time.Date(2025, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Time of the commit that the binary was built from (or the zero time, if
+// it isn't known), which the system clock can't read an earlier time than.
+// A day of slack is allowed for commits whose time was skewed itself.
+var buildTime = sync.OnceValue(func() time.Time {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return time.Time{}
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.time" {
+			if commitTime, err := time.Parse(time.RFC3339, setting.Value); err == nil {
+				return commitTime.Add(-24 * time.Hour)
+			}
+		}
+	}
+	return time.Time{}
+})
+
+// Checks that the system clock (with the compensation for its skew, once
+// it's known) doesn't read a time before this binary was built, which means
+// that it was never synchronized. Requests signed at such a time are only
+// rejected by Roles Anywhere as having an invalid signature.
+func checkSystemClock(now time.Time) error {
+	earliest, reason := minimumSystemTime, "this version of the credential helper was released"
+	if built := buildTime(); built.After(earliest) {
+		earliest, reason = built, "this binary was built"
+	}
+	if now.Before(earliest) {
+		return fmt.Errorf("%w: the system clock reads %s, which is before %s (%s); synchronize the clock (for "+
+			"example, through NTP) before requesting credentials", ErrClockNotSynchronized,
+			now.UTC().Format(time.RFC3339), reason, earliest.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCheckSystemClock(t *testing.T) {
+	if err := checkSystemClock(time.Now()); err != nil {
+		t.Error("unexpected error:", err)
+	}
+	err := checkSystemClock(time.Unix(0, 0))
+	if !errors.Is(err, ErrClockNotSynchronized) || !strings.Contains(err.Error(), "NTP") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err = checkSystemClock(minimumSystemTime.Add(-time.Hour)); !errors.Is(err, ErrClockNotSynchronized) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package aws_signing_helper
+
+import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+)
+
+// Names of the TLS versions that can be required, as passed to
+// ParseTLSVersion
+var tlsVersionNames = map[uint16]string{
+	tls.VersionTLS12: "1.2",
+	tls.VersionTLS13: "1.3",
+}
+
+// Names of the elliptic curves that key exchanges can use, as passed to
+// ParseTLSCurve
+var tlsCurveNames = map[tls.CurveID]string{
+	tls.X25519:    "X25519",
+	tls.CurveP256: "P-256",
+	tls.CurveP384: "P-384",
+	tls.CurveP521: "P-521",
+}
+
+// Returns the TLS configuration of outbound connections (to Roles Anywhere,
+// and to OCSP responders and CRL distribution points), which enforces the
+// TLS policy of the options. By default, TLS 1.2 or later is required, and
+// the cipher suites and curves of the Go standard library are used.
+func tlsConfig(opts *CredentialsOpts) *tls.Config {
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		CipherSuites:       opts.TLSCipherSuites,
+		CurvePreferences:   opts.TLSCurvePreferences,
+		InsecureSkipVerify: opts.NoVerifySSL,
+	}
+	if opts.TLSMinVersion > config.MinVersion {
+		config.MinVersion = opts.TLSMinVersion
+	}
+	return config
+}
+
+// Parses the minimum TLS version (1.2 or 1.3)
+func ParseTLSVersion(name string) (uint16, error) {
+	name = strings.TrimPrefix(strings.ToLower(name), "tls")
+	for version, versionName := range tlsVersionNames {
+		if name == versionName {
+			return version, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported TLS version %q (one of 1.2 and 1.3)", name)
+}
+
+// Parses the name of a TLS 1.2 cipher suite (such as
+// TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384). Only the cipher suites that the
+// Go standard library considers secure are accepted. TLS 1.3 cipher suites
+// can't be configured.
+func ParseTLSCipherSuite(name string) (uint16, error) {
+	var names []string
+	for _, suite := range tls.CipherSuites() {
+		if strings.EqualFold(name, suite.Name) {
+			for _, version := range suite.SupportedVersions {
+				if version == tls.VersionTLS12 {
+					return suite.ID, nil
+				}
+			}
+		}
+		names = append(names, suite.Name)
+	}
+	return 0, fmt.Errorf("unsupported TLS 1.2 cipher suite %q (one of %s)", name, strings.Join(names, ", "))
+}
+
+// Parses the name of an elliptic curve for key exchanges (X25519, P-256,
+// P-384, or P-521)
+func ParseTLSCurve(name string) (tls.CurveID, error) {
+	for curve, curveName := range tlsCurveNames {
+		if strings.EqualFold(name, curveName) || strings.EqualFold(name, strings.ReplaceAll(curveName, "-", "")) {
+			return curve, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported curve %q (one of X25519, P-256, P-384, and P-521)", name)
+}
@@ -0,0 +1,56 @@
+package aws_signing_helper
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestTLSPolicy(t *testing.T) {
+	version, err := ParseTLSVersion("1.3")
+	if err != nil || version != tls.VersionTLS13 {
+		t.Fatal("unable to parse TLS version:", err)
+	}
+	if _, err = ParseTLSVersion("1.1"); err == nil {
+		t.Error("expected TLS 1.1 to be rejected")
+	}
+	suite, err := ParseTLSCipherSuite("tls_ecdhe_ecdsa_with_aes_256_gcm_sha384")
+	if err != nil || suite != tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384 {
+		t.Fatal("unable to parse cipher suite:", err)
+	}
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_AES_128_GCM_SHA256"} {
+		if _, err = ParseTLSCipherSuite(name); err == nil {
+			t.Errorf("expected %s to be rejected", name)
+		}
+	}
+	curve, err := ParseTLSCurve("P384")
+	if err != nil || curve != tls.CurveP384 {
+		t.Fatal("unable to parse curve:", err)
+	}
+
+	if config := tlsConfig(&CredentialsOpts{}); config.MinVersion != tls.VersionTLS12 {
+		t.Errorf("unexpected default minimum version: %x", config.MinVersion)
+	}
+
+	// A server that only supports TLS 1.2 can't be connected to when TLS
+	// 1.3 is required
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+	for _, tc := range []struct {
+		minVersion uint16
+		ok         bool
+	}{{tls.VersionTLS12, true}, {tls.VersionTLS13, false}} {
+		opts := &CredentialsOpts{NoVerifySSL: true, TLSMinVersion: tc.minVersion}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig(opts)}}
+		response, err := client.Get(server.URL)
+		if err == nil {
+			response.Body.Close()
+		}
+		if (err == nil) != tc.ok {
+			t.Errorf("unexpected result with minimum version %x: %v", tc.minVersion, err)
+		}
+	}
+}
@@ -1,10 +1,11 @@
+//go:build !notpm
+
 package aws_signing_helper
 
 import (
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/sha1"
-	"crypto/sha256"
 	"crypto/sha512"
 	"crypto/x509"
 	"encoding/asn1"
@@ -20,6 +21,13 @@ import (
 	tpmutil "github.com/google/go-tpm/tpmutil"
 )
 
+// Name of the backend, as returned by Backends
+const tpmBackend = "tpm"
+
+func init() {
+	registerBackend(tpmBackend)
+}
+
 type tpm2_TPMPolicy struct {
 	CommandCode   int    `asn1:"explicit,tag:0"`
 	CommandPolicy []byte `asn1:"explicit,tag:1"`
@@ -94,6 +102,10 @@ func (tpmv2Signer *TPMv2Signer) Public() crypto.PublicKey {
 	return ret
 }
 
+func (tpmv2Signer *TPMv2Signer) backendName() string {
+	return tpmBackend
+}
+
 // Closes this TPMv2Signer
 func (tpmv2Signer *TPMv2Signer) Close() {
 	tpmv2Signer.password = ""
@@ -106,8 +118,7 @@ func checkCapability(rw io.ReadWriter, algo tpm2.Algorithm) error {
 		return errors.New(errMsg)
 	}
 	if tpm2.Algorithm(descs[0].(tpm2.AlgorithmDescription).ID) != algo {
-		errMsg := fmt.Sprintf("unsupported algorithm (%s) for TPM", algo)
-		return errors.New(errMsg)
+		return fmt.Errorf("%w (%s) for TPM", ErrUnsupportedAlgorithm, algo)
 	}
 
 	return nil
@@ -145,21 +156,17 @@ func (tpmv2Signer *TPMv2Signer) Sign(rand io.Reader, digest []byte, opts crypto.
 		defer tpm2.FlushContext(rw, keyHandle)
 	}
 
+	shadigest, err := signatureDigest(digest, opts)
+	if err != nil {
+		return nil, err
+	}
 	var algo tpm2.Algorithm
-	var shadigest []byte
-
 	switch opts.HashFunc() {
 	case crypto.SHA256:
-		sha256digest := sha256.Sum256(digest)
-		shadigest = sha256digest[:]
 		algo = tpm2.AlgSHA256
 	case crypto.SHA384:
-		sha384digest := sha512.Sum384(digest)
-		shadigest = sha384digest[:]
 		algo = tpm2.AlgSHA384
 	case crypto.SHA512:
-		sha512digest := sha512.Sum512(digest)
-		shadigest = sha512digest[:]
 		algo = tpm2.AlgSHA512
 	}
 
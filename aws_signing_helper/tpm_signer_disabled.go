@@ -0,0 +1,25 @@
+//go:build notpm
+
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+)
+
+// The TPM backend is left out by the notpm tag
+var errTPMUnavailable = fmt.Errorf("%w: TPM keys aren't supported in this build", ErrBackendUnavailable)
+
+type GetTPMv2SignerOpts struct {
+	certificate      *x509.Certificate
+	certificateChain []*x509.Certificate
+	keyPem           *pem.Block
+	password         string
+	emptyAuth        bool
+	handle           string
+}
+
+func GetTPMv2Signer(opts GetTPMv2SignerOpts) (signer Signer, signingAlgorithm string, err error) {
+	return nil, "", errTPMUnavailable
+}
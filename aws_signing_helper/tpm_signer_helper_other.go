@@ -1,4 +1,4 @@
-//go:build !windows
+//go:build !windows && !notpm
 
 package aws_signing_helper
 
@@ -1,9 +1,9 @@
-//go:build windows
+//go:build windows && !notpm
 
 package aws_signing_helper
 
 import (
-	tpm2 "github.com/google/go-tpm/tpm2"
+	tpm2 "github.com/google/go-tpm/legacy/tpm2"
 	"io"
 )
 
@@ -1,3 +1,5 @@
+//go:build !notpm
+
 package aws_signing_helper
 
 import (
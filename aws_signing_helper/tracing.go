@@ -0,0 +1,38 @@
+package aws_signing_helper
+
+import (
+	"context"
+
+	"github.com/aws/smithy-go/tracing"
+)
+
+// Instrumentation scope of the spans of the library
+const tracerScope = "github.com/aws/rolesanywhere-credential-helper"
+
+// Attributes of the spans of the library
+const (
+	spanAttributeRoleArn = "aws.rolesanywhere.role_arn"
+	spanAttributeError   = "error.message"
+)
+
+// Starts a span with the tracer provider of the options, as a child of the
+// span of the context (if it has one). Without a tracer provider, the span is
+// a no-op.
+func startSpan(ctx context.Context, opts *CredentialsOpts, name string) (context.Context, tracing.Span) {
+	var provider tracing.TracerProvider = tracing.NopTracerProvider{}
+	if opts != nil && opts.TracerProvider != nil {
+		provider = opts.TracerProvider
+	}
+	return provider.Tracer(tracerScope).StartSpan(ctx, name)
+}
+
+// Ends the span, with the status (and redacted message) of the error
+func endSpan(span tracing.Span, err error) {
+	if err != nil {
+		span.SetStatus(tracing.SpanStatusError)
+		span.SetProperty(spanAttributeError, Redact(err.Error()))
+	} else {
+		span.SetStatus(tracing.SpanStatusOK)
+	}
+	span.End()
+}
@@ -0,0 +1,247 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Largest trust anchor certificate file that's downloaded
+const maxTrustAnchorCertificateSize = 1 << 20
+
+// Trust anchor certificates that were downloaded, by URL, so that they're
+// only downloaded once per process
+var trustAnchorCertificateCache sync.Map
+
+// Checks that the certificate chain of the signer leads to the trust
+// anchor's CA certificate (or one of them, if the file holds a bundle), as
+// Roles Anywhere does, so that untrusted chains (which Roles Anywhere only
+// reports as "AccessDeniedException: Untrusted certificate") are diagnosed
+// before CreateSession is called. The returned error wraps
+// ErrUntrustedCertificate.
+func checkTrustAnchorChain(ctx context.Context, opts *CredentialsOpts, signer Signer, now time.Time) error {
+	roots := signerCACertificates(signer)
+	if opts.TrustAnchorCertificate == "" && roots == nil {
+		return nil
+	}
+	certificate, err := signer.Certificate()
+	if err != nil || certificate == nil {
+		return err
+	}
+	chain, err := signer.CertificateChain()
+	if err != nil {
+		return err
+	}
+	if opts.TrustAnchorCertificate != "" {
+		if roots, err = readTrustAnchorCertificates(ctx, opts); err != nil {
+			return fmt.Errorf("unable to read the trust anchor certificate: %w", err)
+		}
+	}
+	if opts.NoCertificateValidityCheck {
+		// The chain is verified at a time at which all of its certificates
+		// are valid, since the clock isn't trusted
+		now = certificate.NotBefore
+		for _, issuer := range chain {
+			if issuer.NotBefore.After(now) {
+				now = issuer.NotBefore
+			}
+		}
+	}
+	return verifyTrustAnchorChain(certificate, chain, roots, now)
+}
+
+// Returns the CA certificates that the source of the signer's identity
+// provides along with it (the ca.crt of a Kubernetes secret), which the
+// chain is verified against when no trust anchor certificate is set
+func signerCACertificates(signer Signer) []*x509.Certificate {
+	if synchronized, ok := signer.(*synchronizedSigner); ok {
+		signer = synchronized.signer
+	}
+	if source, ok := signer.(interface{ caCertificates() []*x509.Certificate }); ok {
+		return source.caCertificates()
+	}
+	return nil
+}
+
+// Verifies the chain against the CA certificates, and explains why it isn't
+// trusted if it isn't
+func verifyTrustAnchorChain(certificate *x509.Certificate, chain []*x509.Certificate, roots []*x509.Certificate, now time.Time) error {
+	rootPool := x509.NewCertPool()
+	for _, root := range roots {
+		rootPool.AddCert(root)
+	}
+	intermediates := x509.NewCertPool()
+	for _, intermediate := range chain {
+		intermediates.AddCert(intermediate)
+	}
+	_, err := certificate.Verify(x509.VerifyOptions{
+		Roots:         rootPool,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		// Extended key usages are checked separately
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err == nil {
+		return nil
+	}
+
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	switch {
+	case errors.As(err, &unknownAuthorityErr):
+		return fmt.Errorf("%w: the certificate chain doesn't lead to the trust anchor's CA (%s):\n%s",
+			ErrUntrustedCertificate, describeCertificateSubjects(roots),
+			strings.Join(explainTrustAnchorChain(certificate, chain, roots), "\n"))
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.Expired:
+		return fmt.Errorf("%w: %s", ErrCertificateExpired, invalidErr.Error())
+	case errors.As(err, &invalidErr) && invalidErr.Reason == x509.NotAuthorizedToSign:
+		return fmt.Errorf("%w: %q isn't a CA certificate (it needs the basic constraints CA flag and the keyCertSign "+
+			"key usage), so it can't issue %q", ErrUntrustedCertificate, invalidErr.Cert.Subject.String(),
+			certificate.Subject.String())
+	default:
+		return fmt.Errorf("%w: %s", ErrUntrustedCertificate, err)
+	}
+}
+
+// Follows the chain from the certificate towards the trust anchor's CA, one
+// issuer at a time, and explains where it breaks off, as a diff between the
+// chain that was presented and the one that Roles Anywhere expects: lines
+// that start with "  " are links of the chain that are in place, and lines
+// that start with "- " are problems (a missing intermediate, an issuer that
+// has the expected name but didn't sign the certificate, or intermediates
+// that aren't part of the chain).
+func explainTrustAnchorChain(certificate *x509.Certificate, chain []*x509.Certificate, roots []*x509.Certificate) []string {
+	var lines []string
+	used := make([]bool, len(chain))
+	current := certificate
+	for {
+		if root, named := findIssuer(current, roots); root != nil {
+			lines = append(lines, fmt.Sprintf("  %q is issued by the trust anchor's CA %q", current.Subject.String(),
+				root.Subject.String()))
+			break
+		} else if named != nil {
+			lines = append(lines, fmt.Sprintf("- wrong issuer: %q names the trust anchor's CA %q as its issuer, but "+
+				"wasn't signed by its key (the CA may have been reissued with a new key, or another CA has the "+
+				"same name)", current.Subject.String(), named.Subject.String()))
+			break
+		}
+
+		issuer, named := findIssuer(current, chain)
+		index := -1
+		for i, intermediate := range chain {
+			if intermediate == issuer && !used[i] {
+				index = i
+			}
+		}
+		if index < 0 {
+			if named != nil {
+				lines = append(lines, fmt.Sprintf("- wrong issuer: %q in --intermediates has the name of the issuer "+
+					"of %q, but didn't sign it", named.Subject.String(), current.Subject.String()))
+			} else {
+				lines = append(lines, fmt.Sprintf("- missing intermediate: %q is issued by %q, which isn't in "+
+					"--intermediates", current.Subject.String(), current.Issuer.String()))
+			}
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %q is issued by %q", current.Subject.String(), issuer.Subject.String()))
+		used[index] = true
+		current = issuer
+	}
+
+	for i, intermediate := range chain {
+		// Some backends include the certificate itself in the chain
+		if !used[i] && !intermediate.Equal(certificate) {
+			lines = append(lines, fmt.Sprintf("- unused: %q in --intermediates isn't part of the chain",
+				intermediate.Subject.String()))
+		}
+	}
+	return lines
+}
+
+// Returns the candidate that issued (and signed) the certificate, if there's
+// one. Otherwise, it returns a candidate whose name is that of the issuer of
+// the certificate (but that didn't sign it), if there's one.
+func findIssuer(certificate *x509.Certificate, candidates []*x509.Certificate) (issuer *x509.Certificate, named *x509.Certificate) {
+	for _, candidate := range candidates {
+		if !bytes.Equal(certificate.RawIssuer, candidate.RawSubject) {
+			continue
+		}
+		err := candidate.CheckSignature(certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature)
+		if err == nil {
+			return candidate, nil
+		}
+		named = candidate
+	}
+	return nil, named
+}
+
+// Returns the subjects of the certificates, for error messages
+func describeCertificateSubjects(certificates []*x509.Certificate) string {
+	subjects := make([]string, 0, len(certificates))
+	for _, certificate := range certificates {
+		subjects = append(subjects, fmt.Sprintf("%q", certificate.Subject.String()))
+	}
+	return strings.Join(subjects, ", ")
+}
+
+// Reads the trust anchor's CA certificates from the file or, if it's an HTTP
+// or HTTPS URL, downloads them
+func readTrustAnchorCertificates(ctx context.Context, opts *CredentialsOpts) ([]*x509.Certificate, error) {
+	id := opts.TrustAnchorCertificate
+	if !strings.HasPrefix(id, "http://") && !strings.HasPrefix(id, "https://") {
+		data, err := os.ReadFile(id)
+		if err != nil {
+			return nil, err
+		}
+		return parseCertificates(data)
+	}
+
+	if certificates, ok := trustAnchorCertificateCache.Load(id); ok {
+		return certificates.([]*x509.Certificate), nil
+	}
+	data, err := fetchRevocationData(ctx, opts, http.MethodGet, id, "", nil, maxTrustAnchorCertificateSize)
+	if err != nil {
+		return nil, err
+	}
+	certificates, err := parseCertificates(data)
+	if err != nil {
+		return nil, err
+	}
+	trustAnchorCertificateCache.Store(id, certificates)
+	return certificates, nil
+}
+
+// Parses the certificates, which are either PEM blocks or DER-encoded
+func parseCertificates(data []byte) ([]*x509.Certificate, error) {
+	if !bytes.Contains(data, []byte("-----BEGIN")) {
+		return x509.ParseCertificates(data)
+	}
+	var certificates []*x509.Certificate
+	for len(data) > 0 {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		certificate, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certificates = append(certificates, certificate)
+	}
+	if len(certificates) == 0 {
+		return nil, errors.New("no certificates found")
+	}
+	return certificates, nil
+}
@@ -0,0 +1,113 @@
+package aws_signing_helper
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTrustAnchorChain(t *testing.T) {
+	opts := CredentialsOpts{
+		PrivateKeyId:  "../credential-process-data/client-key.pem",
+		CertificateId: "../credential-process-data/client-cert.pem",
+	}
+	signer, _, err := GetSigner(&opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+
+	opts.TrustAnchorCertificate = "../credential-process-data/root-cert.pem"
+	if err = checkTrustAnchorChain(context.Background(), &opts, signer, time.Now()); err != nil {
+		t.Error("chain wasn't trusted by the CA that issued it:", err)
+	}
+
+	// A CA that didn't issue the certificate
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Other CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, _ := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	opts.TrustAnchorCertificate = filepath.Join(t.TempDir(), "other-ca.der")
+	os.WriteFile(opts.TrustAnchorCertificate, der, 0600)
+	err = checkTrustAnchorChain(context.Background(), &opts, signer, time.Now())
+	if !errors.Is(err, ErrUntrustedCertificate) || !strings.Contains(err.Error(), "Other CA") {
+		t.Error("chain was trusted by a CA that didn't issue it:", err)
+	}
+}
+
+func TestExplainTrustAnchorChain(t *testing.T) {
+	issue := func(name string, issuer *x509.Certificate, issuerKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: name},
+			NotBefore:             time.Now().Add(-time.Hour),
+			NotAfter:              time.Now().Add(time.Hour),
+			IsCA:                  true,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		if issuer == nil {
+			issuer, issuerKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, issuer, key.Public(), issuerKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		certificate, _ := x509.ParseCertificate(der)
+		return certificate, key
+	}
+	root, rootKey := issue("Root", nil, nil)
+	intermediate, intermediateKey := issue("Intermediate", root, rootKey)
+	leaf, _ := issue("Leaf", intermediate, intermediateKey)
+	impostor, _ := issue("Intermediate", nil, nil)
+	reissuedRoot, _ := issue("Root", nil, nil)
+	other, _ := issue("Other", nil, nil)
+
+	for _, tc := range []struct {
+		name     string
+		chain    []*x509.Certificate
+		roots    []*x509.Certificate
+		expected string
+	}{
+		{"trusted", []*x509.Certificate{intermediate}, []*x509.Certificate{root}, ""},
+		{"missing intermediate", nil, []*x509.Certificate{root}, `- missing intermediate: "CN=Leaf" is issued by "CN=Intermediate"`},
+		{"wrong intermediate", []*x509.Certificate{impostor}, []*x509.Certificate{root}, `- wrong issuer: "CN=Intermediate" in --intermediates`},
+		{"reissued root", []*x509.Certificate{intermediate}, []*x509.Certificate{reissuedRoot}, `- wrong issuer: "CN=Intermediate" names the trust anchor's CA "CN=Root"`},
+		{"unused intermediate", []*x509.Certificate{other, intermediate}, []*x509.Certificate{root}, `- unused: "CN=Other"`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyTrustAnchorChain(leaf, tc.chain, tc.roots, time.Now())
+			if tc.expected == "" {
+				if err != nil {
+					t.Error("unexpected error:", err)
+				}
+				return
+			}
+			if err == nil {
+				// Verification succeeds despite unused intermediates
+				err = errors.New(strings.Join(explainTrustAnchorChain(leaf, tc.chain, tc.roots), "\n"))
+			}
+			if !strings.Contains(err.Error(), tc.expected) {
+				t.Errorf("unexpected explanation: %v", err)
+			}
+		})
+	}
+}
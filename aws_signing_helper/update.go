@@ -2,7 +2,9 @@ package aws_signing_helper
 
 import (
 	"bufio"
-	"log"
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,9 +12,14 @@ import (
 )
 
 const UpdateRefreshTime = time.Minute * time.Duration(5)
+const UpdateMinRefreshInterval = time.Second * time.Duration(30)
 const AwsSharedCredentialsFileEnvVarName = "AWS_SHARED_CREDENTIALS_FILE"
 const BufferSize = 49152
 
+// How long prewarms wait before they first retry, and at most between retries
+const prewarmInitialRetryDelay = time.Second
+const prewarmMaxRetryDelay = 30 * time.Second
+
 // Structure to contain a temporary credential
 type TemporaryCredential struct {
 	AccessKeyId     string
@@ -21,22 +28,77 @@ type TemporaryCredential struct {
 	Expiration      time.Time
 }
 
-// Updates credentials in the credentials file for the specified profile
-func Update(credentialsOptions CredentialsOpts, profile string, once bool) {
+// Updates credentials in the credentials file for the specified profile. An
+// error is returned if credentials couldn't be obtained or written.
+func Update(credentialsOptions CredentialsOpts, profile string, once bool) error {
 	var refreshableCred = TemporaryCredential{}
 	var nextRefreshTime time.Time
 
-	signer, signatureAlgorithm, err := GetSigner(&credentialsOptions)
+	if !once {
+		if err := startProfiling(&credentialsOptions); err != nil {
+			return err
+		}
+	}
+	Preload(&credentialsOptions)
+	var prewarmDeadline time.Time
+	if credentialsOptions.PrewarmTimeout > 0 {
+		prewarmDeadline = time.Now().Add(credentialsOptions.PrewarmTimeout)
+	}
+	var signer Signer
+	var signatureAlgorithm string
+	err := retryPrewarm(prewarmDeadline, "initialize the signer", func() (err error) {
+		signer, signatureAlgorithm, err = GetSigner(&credentialsOptions)
+		return err
+	})
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		return err
 	}
 	defer signer.Close()
+	if !once {
+		if err = selfTestSigner(signer); err != nil {
+			return err
+		}
+	}
+	repairUpdateTargetPermissions(&credentialsOptions)
+	// The AWS CLI reads the cache entry through the SSO settings of the
+	// profile, unless the entry is named after a cache key of its own
+	var cacheKey string
+	var cacheProfile CLICacheProfile
+	if credentialsOptions.UpdateTarget == UpdateTargetCLICache {
+		if cacheKey, err = GetCLICacheKey(&credentialsOptions); err != nil {
+			return err
+		}
+		cacheProfile, _ = GetCLICacheProfile(&credentialsOptions)
+		if credentialsOptions.CLICacheKey == "" {
+			configPath, err := WriteCLICacheProfile(profile, cacheProfile)
+			if err != nil {
+				return fmt.Errorf("unable to write to AWS config file: %w", err)
+			}
+			LogInfof("Profile %s in %s reads credentials from the AWS CLI cache", profile, configPath)
+		}
+	}
+	// Credentials are obtained with renewed certificates right away, rather
+	// than once the current ones are refreshed
+	var renewed chan struct{}
+	if !once && credentialsOptions.ACME != nil {
+		renewed = make(chan struct{}, 1)
+		go renewACMECertificate(context.Background(), &credentialsOptions, func() {
+			select {
+			case renewed <- struct{}{}:
+			default:
+			}
+		})
+	}
 
 	for {
-		credentialProcessOutput, err := GenerateCredentials(&credentialsOptions, signer, signatureAlgorithm)
+		var credentialProcessOutput CredentialProcessOutput
+		err := retryPrewarm(prewarmDeadline, "obtain credentials", func() (err error) {
+			credentialProcessOutput, err = GenerateCredentials(&credentialsOptions, signer, signatureAlgorithm)
+			return err
+		})
+		prewarmDeadline = time.Time{}
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 
 		// Assign credential values
@@ -45,53 +107,141 @@ func Update(credentialsOptions CredentialsOpts, profile string, once bool) {
 		refreshableCred.SessionToken = credentialProcessOutput.SessionToken // nosemgrep
 		refreshableCred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
 		if (refreshableCred == TemporaryCredential{}) {
-			log.Println("no credentials created")
-			os.Exit(1)
+			return errors.New("no credentials created")
 		}
 
-		// Get credentials file contents
-		lines, err := GetCredentialsFileContents()
-		if err != nil {
-			log.Println("unable to get credentials file contents")
-			os.Exit(1)
+		switch credentialsOptions.UpdateTarget {
+		case UpdateTargetCLICache:
+			cachePath, err := WriteCLICacheEntry(cacheKey, cacheProfile.AccountId, &refreshableCred)
+			if err != nil {
+				return fmt.Errorf("unable to write to AWS CLI cache: %w", err)
+			}
+			cacheLog.debugf("wrote credentials to %s", cachePath)
+		case UpdateTargetSecretStore:
+			err := WriteSecretStoreEntry(profile, &refreshableCred)
+			if err != nil {
+				return fmt.Errorf("unable to write to secret store: %w", err)
+			}
+		default:
+			// Get credentials file contents
+			lines, err := GetCredentialsFileContents()
+			if err != nil {
+				return fmt.Errorf("unable to get credentials file contents: %w", err)
+			}
+
+			// Write to credentials file
+			err = WriteTo(profile, lines, &refreshableCred)
+			if err != nil {
+				return fmt.Errorf("unable to write to AWS credentials file: %w", err)
+			}
 		}
 
-		// Write to credentials file
-		err = WriteTo(profile, lines, &refreshableCred)
-		if err != nil {
-			log.Println("unable to write to AWS credentials file")
-			os.Exit(1)
+		if credentialsOptions.OnRefresh != "" {
+			if err := RunRefreshHook(credentialsOptions.OnRefresh, profile, &refreshableCred); err != nil {
+				LogWarnf("on-refresh command failed: %s", err)
+			}
 		}
 
 		if once {
-			break
+			return nil
+		}
+		refreshBuffer := UpdateRefreshTime
+		if credentialsOptions.RefreshBuffer > 0 {
+			refreshBuffer = credentialsOptions.RefreshBuffer
+		}
+		if credentialsOptions.UpdateTarget == UpdateTargetCLICache {
+			refreshBuffer = max(refreshBuffer, cliCacheExpiryWindow+UpdateRefreshTime)
+		}
+		nextRefreshTime = NextRefreshTime(refreshableCred.Expiration, refreshBuffer, time.Now())
+		LogInfof("Credentials will be refreshed at %s", nextRefreshTime.String())
+		if credentialsOptions.Preconnect && time.Until(nextRefreshTime) > preconnectLead {
+			time.Sleep(time.Until(nextRefreshTime.Add(-preconnectLead)))
+			preconnect(context.Background(), &credentialsOptions)
+		}
+		timer := time.NewTimer(time.Until(nextRefreshTime))
+		select {
+		case <-timer.C:
+		case <-renewed:
+			timer.Stop()
+			LogInfof("Credentials are refreshed with the renewed certificate")
 		}
-		nextRefreshTime = refreshableCred.Expiration.Add(-UpdateRefreshTime)
-		log.Println("Credentials will be refreshed at", nextRefreshTime.String())
-		time.Sleep(time.Until(nextRefreshTime))
 	}
 }
 
-// Assume that the credentials file is located in the default path: `~/.aws/credentials`
-func GetCredentialsFileContents() ([]string, error) {
+// Calls the function until it succeeds, fails with an error that isn't
+// transient while a host boots (the network, the clock, or the backend of
+// the key not being ready yet), or the deadline passes, with exponential
+// backoff between attempts. Without a deadline, the function is only called
+// once.
+func retryPrewarm(deadline time.Time, operation string, f func() error) error {
+	delay := prewarmInitialRetryDelay
+	for {
+		err := f()
+		if err == nil || deadline.IsZero() || !isPrewarmRetryable(err) {
+			return err
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return fmt.Errorf("unable to %s before the prewarm timed out: %w", operation, err)
+		}
+		LogInfof("unable to %s (retrying in %s): %s", operation, delay, err)
+		time.Sleep(delay)
+		delay = min(2*delay, prewarmMaxRetryDelay)
+	}
+}
+
+// Whether the error is one that goes away once a host has finished booting
+func isPrewarmRetryable(err error) bool {
+	return errors.Is(err, ErrEndpointUnreachable) || errors.Is(err, ErrThrottled) ||
+		errors.Is(err, ErrClockNotSynchronized) || errors.Is(err, ErrBackendUnavailable)
+}
+
+// Returns when credentials that expire at the specified time should next be
+// refreshed, which is the refresh buffer before they expire. If the credentials
+// are valid for less time than the buffer, they are refreshed halfway through
+// their remaining lifetime instead, and they are never refreshed sooner than
+// UpdateMinRefreshInterval from now, so that CreateSession isn't called in a
+// tight loop when the returned expiration is already in the past.
+func NextRefreshTime(expiration time.Time, refreshBuffer time.Duration, now time.Time) time.Time {
+	nextRefreshTime := expiration.Add(-refreshBuffer)
+	if nextRefreshTime.Before(now) {
+		nextRefreshTime = now.Add(expiration.Sub(now) / 2)
+	}
+	if minRefreshTime := now.Add(UpdateMinRefreshInterval); nextRefreshTime.Before(minRefreshTime) {
+		nextRefreshTime = minRefreshTime
+	}
+	return nextRefreshTime
+}
+
+// Returns the path to the credentials file, which is either specified through
+// the environment or located in the default path: `~/.aws/credentials`
+func GetCredentialsFilePath() (string, error) {
+	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
+	if awsCredentialsPath != "" {
+		return awsCredentialsPath, nil
+	}
+
 	homeDir, err := os.UserHomeDir()
 	if err != nil {
-		log.Println("unable to locate the home directory")
-		return nil, err
+		LogErrorf("unable to locate the home directory")
+		return "", err
 	}
+	return filepath.Join(homeDir, ".aws", "credentials"), nil
+}
 
-	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
-	if awsCredentialsPath == "" {
-		awsCredentialsPath = filepath.Join(homeDir, ".aws", "credentials")
+// Reads the lines of the credentials file, creating it if it doesn't exist
+func GetCredentialsFileContents() ([]string, error) {
+	awsCredentialsPath, err := GetCredentialsFilePath()
+	if err != nil {
+		return nil, err
 	}
-	if err = os.MkdirAll(filepath.Dir(awsCredentialsPath), 0600); err != nil {
-		log.Println("unable to create credentials file")
+	if err = os.MkdirAll(filepath.Dir(awsCredentialsPath), 0700); err != nil {
+		LogErrorf("unable to create credentials file")
 		return nil, err
 	}
 
 	readOnlyCredentialsFile, err := os.OpenFile(awsCredentialsPath, os.O_RDONLY|os.O_CREATE, 0600)
 	if err != nil {
-		log.Println("unable to get or create read-only AWS credentials file")
+		LogErrorf("unable to get or create read-only AWS credentials file")
 		os.Exit(1)
 	}
 	defer readOnlyCredentialsFile.Close()
@@ -108,99 +258,49 @@ func GetCredentialsFileContents() ([]string, error) {
 // Assume that the credentials file exists already and open it for write operations
 // that will overwrite the existing contents of the file
 func GetWriteOnlyCredentialsFile() (*os.File, error) {
-	homeDir, _ := os.UserHomeDir()
-	awsCredentialsPath := os.Getenv(AwsSharedCredentialsFileEnvVarName)
-	if awsCredentialsPath == "" {
-		awsCredentialsPath = filepath.Join(homeDir, ".aws", "credentials")
+	awsCredentialsPath, err := GetCredentialsFilePath()
+	if err != nil {
+		return nil, err
 	}
 	return os.OpenFile(awsCredentialsPath, os.O_WRONLY|os.O_TRUNC, 0200)
 }
 
-// Function that will get the new conents of the credentials file after a
-// refresh has been done
+// Function that will get the new contents of the credentials file after a
+// refresh has been done. Only the credential keys within the profile's section
+// are rewritten; other profiles, comments, and unrelated keys are left intact.
 func GetNewCredentialsFileContents(profileName string, readLines []string, cred *TemporaryCredential) []string {
-	var profileExist = false
-	var profileSection = "[" + profileName + "]"
-	// A variable that checks whether or not required fields are written to the destination file
-	newCredVisit := map[string]bool{"aws_access_key_id": false, "aws_secret_access_key": false, "aws_session_token": false}
-	accessKey := "aws_access_key_id = " + cred.AccessKeyId + "\n"
-	secretKey := "aws_secret_access_key = " + cred.SecretAccessKey + "\n"
-	sessionToken := "aws_session_token = " + cred.SessionToken + "\n"
-	var writeLines = make([]string, 0)
-	for readLinesIndex := 0; readLinesIndex < len(readLines); readLinesIndex++ {
-		if !profileExist && readLines[readLinesIndex] == profileSection {
-			writeLines = append(writeLines[:], profileSection+"\n")
-			readLinesIndex += 1
-			for ; readLinesIndex < len(readLines); readLinesIndex++ {
-				// If the last line of the credentials file is reached
-				// OR the next profile section is reached
-				if readLinesIndex == len(readLines)-1 || strings.HasPrefix(readLines[readLinesIndex], "[") {
-					if !newCredVisit["aws_access_key_id"] {
-						writeLines = append(writeLines[:], accessKey)
-					}
-					if !newCredVisit["aws_secret_access_key"] {
-						writeLines = append(writeLines[:], secretKey)
-					}
-					if !newCredVisit["aws_session_token"] {
-						writeLines = append(writeLines[:], sessionToken)
-
-					}
-					if readLinesIndex != len(readLines)-1 {
-						readLinesIndex -= 1
-					}
-					profileExist = true
-					break
-				} else if strings.HasPrefix(readLines[readLinesIndex], "aws_access_key_id") {
-					// replace "aws_access_key_id"
-					writeLines = append(writeLines[:], accessKey)
-					newCredVisit["aws_access_key_id"] = true
-				} else if strings.HasPrefix(readLines[readLinesIndex], "aws_secret_access_key") {
-					// replace "aws_secret_access_key"
-					writeLines = append(writeLines[:], secretKey)
-					newCredVisit["aws_secret_access_key"] = true
-				} else if strings.HasPrefix(readLines[readLinesIndex], "aws_session_token") {
-					// replace "aws_session_token"
-					writeLines = append(writeLines[:], sessionToken)
-					newCredVisit["aws_session_token"] = true
-				} else {
-					// write other keys
-					writeLines = append(writeLines[:], readLines[readLinesIndex]+"\n")
-				}
-			}
-		} else {
-			writeLines = append(writeLines[:], readLines[readLinesIndex]+"\n")
-		}
-	}
+	newLines := setINISectionKeys(readLines, profileName, []iniKeyValue{
+		{"aws_access_key_id", cred.AccessKeyId},
+		{"aws_secret_access_key", cred.SecretAccessKey},
+		{"aws_session_token", cred.SessionToken},
+	})
 
-	// If the chosen profile does not exist
-	if !profileExist {
-		writeCredential := profileSection + "\n" + accessKey + secretKey + sessionToken
-		writeLines = append(writeLines[:], writeCredential+"\n")
+	writeLines := make([]string, 0, len(newLines))
+	for _, line := range newLines {
+		writeLines = append(writeLines, line+"\n")
 	}
-
 	return writeLines
 }
 
-// Function to write existing credentials and newly-created credentials to a destination file
+// Function to write existing credentials and newly-created credentials to a destination file.
+// The file is replaced atomically, so that a failure part-way through a refresh never leaves
+// a truncated credentials file behind, and it is only accessible by the current user.
 func WriteTo(profileName string, readLines []string, cred *TemporaryCredential) error {
-	destFile, err := GetWriteOnlyCredentialsFile()
+	awsCredentialsPath, err := GetCredentialsFilePath()
 	if err != nil {
-		log.Println("unable to get write-only AWS credentials file")
-		os.Exit(1)
+		return err
 	}
-	defer destFile.Close()
 
-	// Create buffered writer
-	destFileWriter := bufio.NewWriterSize(destFile, BufferSize)
+	var contents strings.Builder
+	contents.Grow(BufferSize)
 	for _, line := range GetNewCredentialsFileContents(profileName, readLines, cred) {
-		_, err := destFileWriter.WriteString(line)
-		if err != nil {
-			log.Println("unable to write to credentials file")
-			os.Exit(1)
-		}
+		contents.WriteString(line)
 	}
 
-	// Flush the contents of the buffer
-	destFileWriter.Flush()
+	err = writeFileAtomic(awsCredentialsPath, []byte(contents.String()))
+	if err != nil {
+		LogErrorf("unable to write to credentials file: %s", err)
+		return err
+	}
 	return nil
 }
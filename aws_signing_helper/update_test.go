@@ -0,0 +1,76 @@
+package aws_signing_helper
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNextRefreshTime(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	testTable := []struct {
+		name     string
+		lifetime time.Duration
+		buffer   time.Duration
+		expected time.Duration
+	}{
+		{"buffer-before-expiration", time.Hour, 5 * time.Minute, 55 * time.Minute},
+		{"custom-buffer", time.Hour, 20 * time.Minute, 40 * time.Minute},
+		{"lifetime-shorter-than-buffer", 4 * time.Minute, 5 * time.Minute, 2 * time.Minute},
+		{"already-expired", -time.Hour, 5 * time.Minute, UpdateMinRefreshInterval},
+		{"about-to-expire", 10 * time.Second, 5 * time.Minute, UpdateMinRefreshInterval},
+	}
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			nextRefreshTime := NextRefreshTime(now.Add(tc.lifetime), tc.buffer, now)
+			if !nextRefreshTime.Equal(now.Add(tc.expected)) {
+				t.Log("unexpected next refresh time:", nextRefreshTime)
+				t.Fail()
+			}
+		})
+	}
+}
+
+func TestRetryPrewarm(t *testing.T) {
+	// Without a deadline, failures aren't retried
+	attempts := 0
+	err := retryPrewarm(time.Time{}, "obtain credentials", func() error {
+		attempts++
+		return ErrEndpointUnreachable
+	})
+	if !errors.Is(err, ErrEndpointUnreachable) || attempts != 1 {
+		t.Errorf("failure was retried without a deadline: %d attempts (%v)", attempts, err)
+	}
+
+	// Transient failures are retried until they go away
+	attempts = 0
+	err = retryPrewarm(time.Now().Add(time.Minute), "obtain credentials", func() error {
+		if attempts++; attempts == 1 {
+			return fmt.Errorf("%w: network is unreachable", ErrEndpointUnreachable)
+		}
+		return nil
+	})
+	if err != nil || attempts != 2 {
+		t.Errorf("transient failure wasn't retried: %d attempts (%v)", attempts, err)
+	}
+
+	// Others aren't
+	attempts = 0
+	err = retryPrewarm(time.Now().Add(time.Minute), "obtain credentials", func() error {
+		attempts++
+		return ErrCertificateExpired
+	})
+	if !errors.Is(err, ErrCertificateExpired) || attempts != 1 {
+		t.Errorf("permanent failure was retried: %d attempts (%v)", attempts, err)
+	}
+
+	// Nor are transient failures once the deadline would pass
+	err = retryPrewarm(time.Now().Add(prewarmInitialRetryDelay/2), "obtain credentials", func() error {
+		return ErrClockNotSynchronized
+	})
+	if !errors.Is(err, ErrClockNotSynchronized) || !strings.Contains(err.Error(), "prewarm timed out") {
+		t.Error("unexpected error after the deadline:", err)
+	}
+}
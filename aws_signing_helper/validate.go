@@ -0,0 +1,267 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+)
+
+// Result of a single check performed when validating identity material
+type ValidationResult struct {
+	Check   string
+	Passed  bool
+	Message string
+}
+
+// Validates the identity material (private key, certificate, and certificate
+// chain) and the ARNs in the specified options against the requirements of
+// IAM Roles Anywhere, without making any network calls (other than to
+// download the trust anchor certificate, if it's a URL). An error is only
+// returned if the identity material couldn't be loaded at all; failed checks
+// are reported through the results.
+func ValidateIdentity(opts *CredentialsOpts, now time.Time) ([]ValidationResult, error) {
+	// GetSigner fails if the private key doesn't match the certificate, while
+	// this reports it as a failed check
+	signer, _, err := getSigner(opts)
+	if err != nil {
+		return nil, err
+	}
+	defer signer.Close()
+
+	cert, err := signer.Certificate()
+	if err != nil {
+		return nil, err
+	}
+	if cert == nil {
+		return nil, fmt.Errorf("no certificate found")
+	}
+	chain, err := signer.CertificateChain()
+	if err != nil {
+		return nil, err
+	}
+	// Some backends (such as for PKCS#12 files) include the end-entity
+	// certificate in the chain
+	if len(chain) > 0 && chain[0].Equal(cert) {
+		chain = chain[1:]
+	}
+
+	var results []ValidationResult
+	results = append(results, validateKeyMatchesCertificate(signer.Public(), cert))
+	// Signing with a key that's known not to match fails as well, so it's
+	// only tried with keys that do
+	if results[len(results)-1].Passed {
+		results = append(results, validateSelfTestSignature(signer))
+	}
+	results = append(results, validateKeyStrength(cert.PublicKey, opts.AllowWeakKeys))
+	results = append(results, validateCertificateValidity(cert, chain, now))
+	results = append(results, validateEndEntityCertificate(cert, opts.RequiredExtKeyUsages)...)
+	results = append(results, validateCertificateChain(cert, chain))
+	if opts.TrustAnchorCertificate != "" {
+		results = append(results, validateTrustAnchorChain(opts, cert, chain, now))
+	}
+	results = append(results, validateARNs(opts)...)
+	return results, nil
+}
+
+func validateKeyMatchesCertificate(publicKey crypto.PublicKey, cert *x509.Certificate) ValidationResult {
+	result := ValidationResult{Check: "private key matches certificate"}
+
+	key, ok := publicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || publicKey == nil {
+		result.Message = "unable to determine the public key of the private key"
+		return result
+	}
+	if !key.Equal(cert.PublicKey) {
+		result.Message = "the private key doesn't correspond to the public key in the certificate; " +
+			"check that --private-key and --certificate refer to the same identity"
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// Checks that the private key can sign, and that its signatures verify against
+// the certificate
+func validateSelfTestSignature(signer Signer) ValidationResult {
+	result := ValidationResult{Check: "private key signs a test payload that verifies against the certificate"}
+	if err := selfTestSigner(signer); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+func validateKeyStrength(publicKey crypto.PublicKey, allowWeakKeys bool) ValidationResult {
+	result := ValidationResult{Check: "key is at least 2048-bit RSA or on a 256-bit or larger curve"}
+
+	if err := checkKeyStrength(publicKey); err != nil {
+		result.Message = err.Error()
+		if allowWeakKeys {
+			result.Passed = true
+			result.Message += " (allowed by --allow-weak-keys)"
+		}
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+func validateCertificateValidity(cert *x509.Certificate, chain []*x509.Certificate, now time.Time) ValidationResult {
+	result := ValidationResult{Check: "certificates are within their validity period"}
+
+	for _, c := range append([]*x509.Certificate{cert}, chain...) {
+		if now.Before(c.NotBefore) {
+			result.Message = fmt.Sprintf("certificate %q isn't valid until %s; check the system clock",
+				c.Subject.String(), c.NotBefore.UTC().Format(time.RFC3339))
+			return result
+		}
+		if now.After(c.NotAfter) {
+			result.Message = fmt.Sprintf("certificate %q expired at %s; a new certificate has to be issued",
+				c.Subject.String(), c.NotAfter.UTC().Format(time.RFC3339))
+			return result
+		}
+	}
+	result.Passed = true
+	result.Message = fmt.Sprintf("end-entity certificate expires at %s", cert.NotAfter.UTC().Format(time.RFC3339))
+	return result
+}
+
+// Checks the requirements that IAM Roles Anywhere has for end-entity
+// certificates, and that the certificate allows the required extended key
+// usages (by default, clientAuth)
+func validateEndEntityCertificate(cert *x509.Certificate, requiredExtKeyUsages []x509.ExtKeyUsage) []ValidationResult {
+	var results []ValidationResult
+
+	result := ValidationResult{Check: "certificate is an X.509v3 end-entity certificate"}
+	switch {
+	case cert.Version != 3:
+		result.Message = fmt.Sprintf("certificate is X.509v%d", cert.Version)
+	case cert.IsCA:
+		result.Message = "certificate has basic constraints with CA:TRUE; a CA certificate can't be used to authenticate"
+	default:
+		result.Passed = true
+	}
+	results = append(results, result)
+
+	result = ValidationResult{Check: "certificate key usage allows digital signatures"}
+	if cert.KeyUsage != 0 && cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		result.Message = "the key usage extension doesn't include digitalSignature"
+	} else {
+		result.Passed = true
+	}
+	results = append(results, result)
+
+	result = ValidationResult{Check: "certificate extended key usage allows client authentication"}
+	if requiredExtKeyUsages == nil {
+		requiredExtKeyUsages = defaultRequiredExtKeyUsages
+	}
+	if missing := missingExtKeyUsages(cert, requiredExtKeyUsages); len(missing) > 0 {
+		result.Message = "the extended key usage extension doesn't include " + formatExtKeyUsages(missing)
+	} else {
+		result.Passed = true
+	}
+	results = append(results, result)
+
+	result = ValidationResult{Check: "certificate signature algorithm is SHA-256 or stronger"}
+	switch cert.SignatureAlgorithm {
+	case x509.MD2WithRSA, x509.MD5WithRSA, x509.SHA1WithRSA, x509.DSAWithSHA1, x509.ECDSAWithSHA1:
+		result.Message = fmt.Sprintf("certificate is signed with %s, which isn't accepted", cert.SignatureAlgorithm.String())
+	default:
+		result.Passed = true
+	}
+	results = append(results, result)
+
+	return results
+}
+
+// Checks that each certificate in the chain is issued by the one that follows
+// it, starting from the end-entity certificate
+func validateCertificateChain(cert *x509.Certificate, chain []*x509.Certificate) ValidationResult {
+	result := ValidationResult{Check: "certificate chain is ordered and complete"}
+
+	current := cert
+	for i, issuer := range chain {
+		if !bytes.Equal(current.RawIssuer, issuer.RawSubject) || current.CheckSignatureFrom(issuer) != nil {
+			result.Message = fmt.Sprintf("certificate %d in --intermediates (%q) didn't issue %q; intermediates have to be "+
+				"ordered from the issuer of the end-entity certificate up to the trust anchor", i+1, issuer.Subject.String(),
+				current.Subject.String())
+			return result
+		}
+		current = issuer
+	}
+
+	result.Passed = true
+	if bytes.Equal(current.RawIssuer, current.RawSubject) {
+		result.Message = "chain ends with a self-signed certificate"
+	} else {
+		result.Message = fmt.Sprintf("chain ends with a certificate issued by %q, which has to be the trust anchor's CA "+
+			"(or issued by it)", current.Issuer.String())
+	}
+	return result
+}
+
+// Checks that the certificate chain leads to the trust anchor's CA
+// certificate
+func validateTrustAnchorChain(opts *CredentialsOpts, cert *x509.Certificate, chain []*x509.Certificate, now time.Time) ValidationResult {
+	result := ValidationResult{Check: "certificate chain leads to the trust anchor's CA"}
+	roots, err := readTrustAnchorCertificates(context.Background(), opts)
+	if err != nil {
+		result.Message = fmt.Sprintf("unable to read the trust anchor certificate: %s", err)
+		return result
+	}
+	if err = verifyTrustAnchorChain(cert, chain, roots, now); err != nil {
+		result.Message = err.Error()
+		return result
+	}
+	result.Passed = true
+	return result
+}
+
+// Checks that the ARNs are well-formed and that the trust anchor, the profile,
+// and the signing region (if one was specified) are in the same region
+func validateARNs(opts *CredentialsOpts) []ValidationResult {
+	var results []ValidationResult
+
+	parse := func(check string, arnStr string, service string, resourcePrefix string) (arn.ARN, bool) {
+		result := ValidationResult{Check: check}
+		parsed, err := arn.Parse(arnStr)
+		switch {
+		case arnStr == "":
+			result.Message = "no ARN specified"
+		case err != nil:
+			result.Message = fmt.Sprintf("%q isn't a valid ARN", arnStr)
+		case parsed.Service != service || !strings.HasPrefix(parsed.Resource, resourcePrefix):
+			result.Message = fmt.Sprintf("%q isn't the ARN of a %s %s", arnStr, service, strings.TrimSuffix(resourcePrefix, "/"))
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+		return parsed, result.Passed
+	}
+
+	trustAnchorArn, trustAnchorOk := parse("trust anchor ARN is valid", opts.TrustAnchorArnStr, "rolesanywhere", "trust-anchor/")
+	profileArn, profileOk := parse("profile ARN is valid", opts.ProfileArnStr, "rolesanywhere", "profile/")
+	parse("role ARN is valid", opts.RoleArn, "iam", "role/")
+
+	if trustAnchorOk {
+		result := ValidationResult{Check: "trust anchor region matches"}
+		switch {
+		case profileOk && profileArn.Region != trustAnchorArn.Region:
+			result.Message = fmt.Sprintf("the trust anchor is in %s, but the profile is in %s", trustAnchorArn.Region, profileArn.Region)
+		case opts.Region != "" && opts.Region != trustAnchorArn.Region:
+			result.Message = fmt.Sprintf("the trust anchor is in %s, but --region is %s", trustAnchorArn.Region, opts.Region)
+		default:
+			result.Passed = true
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
@@ -0,0 +1,66 @@
+package aws_signing_helper
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateIdentity(t *testing.T) {
+	baseOpts := CredentialsOpts{
+		PrivateKeyId:      "../credential-process-data/client-key.pem",
+		CertificateId:     "../credential-process-data/client-cert.pem",
+		RoleArn:           "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		ProfileArnStr:     "arn:aws:rolesanywhere:us-east-1:000000000000:profile/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+		TrustAnchorArnStr: "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/41cl0bae-6783-40d4-ab20-65dc5d922e45",
+	}
+	testTable := []struct {
+		name         string
+		modify       func(opts *CredentialsOpts)
+		failedChecks []string
+	}{
+		{"valid-identity", func(opts *CredentialsOpts) {}, nil},
+		{"valid-identity-with-root", func(opts *CredentialsOpts) {
+			opts.CertificateBundleId = "../credential-process-data/root-cert.pem"
+		}, nil},
+		{"mismatched-key", func(opts *CredentialsOpts) {
+			opts.PrivateKeyId = "../tst/certs/rsa-2048-key.pem"
+		}, []string{"private key matches certificate"}},
+		{"misordered-chain", func(opts *CredentialsOpts) {
+			opts.CertificateBundleId = "../tst/certs/rsa-2048-sha256-cert.pem"
+		}, []string{"certificate chain is ordered and complete"}},
+		{"ca-certificate", func(opts *CredentialsOpts) {
+			opts.CertificateId = "../tst/certs/rsa-2048-sha1-cert.pem"
+			opts.PrivateKeyId = "../tst/certs/rsa-2048-key.pem"
+		}, []string{"certificate is an X.509v3 end-entity certificate", "certificate signature algorithm is SHA-256 or stronger"}},
+		{"region-mismatch", func(opts *CredentialsOpts) {
+			opts.Region = "us-west-2"
+		}, []string{"trust anchor region matches"}},
+		{"weak-key", func(opts *CredentialsOpts) {
+			opts.CertificateId = "../tst/certs/rsa-1024-sha256-cert.pem"
+			opts.PrivateKeyId = "../tst/certs/rsa-1024-key.pem"
+		}, []string{"key is at least 2048-bit RSA or on a 256-bit or larger curve", "certificate is an X.509v3 end-entity certificate"}},
+	}
+	for _, tc := range testTable {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := baseOpts
+			tc.modify(&opts)
+
+			results, err := ValidateIdentity(&opts, time.Now())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var failedChecks []string
+			for _, result := range results {
+				if !result.Passed {
+					failedChecks = append(failedChecks, result.Check)
+				}
+			}
+			if strings.Join(failedChecks, ", ") != strings.Join(tc.failedChecks, ", ") {
+				t.Log("unexpected failed checks:", failedChecks)
+				t.Fail()
+			}
+		})
+	}
+}
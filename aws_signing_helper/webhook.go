@@ -0,0 +1,235 @@
+package aws_signing_helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// How long webhook notifications may take to be delivered
+const webhookTimeout = 10 * time.Second
+
+// How often notifications about the same certificate are repeated, while it
+// stays within the expiry window
+const webhookExpiryRepeatInterval = 24 * time.Hour
+
+// Header with the hex-encoded HMAC-SHA256 of the body of webhook
+// notifications, keyed with WebhookOptions.Secret, so that receivers can
+// verify that they were sent by the credential helper
+const WebhookSignatureHeader = "X-Rolesanywhere-Signature-256"
+
+// Kinds of webhook notifications
+const (
+	WebhookEventRefreshFailing      = "RefreshFailing"
+	WebhookEventCertificateExpiring = "CertificateExpiring"
+)
+
+// Configuration of a Webhook
+type WebhookOptions struct {
+	// URL that notifications are POSTed to
+	URL string
+	// Key of the HMAC-SHA256 signatures of the notifications (by default,
+	// they aren't signed)
+	Secret string
+	// Number of consecutive failed refreshes after which a notification is
+	// sent (1 if it's lower). No other notification is sent until a refresh
+	// succeeds.
+	FailureThreshold int
+	// A notification is sent when credentials are obtained with a
+	// certificate that expires within this window (and again every day
+	// while it does). By default, none is.
+	CertificateExpiryWindow time.Duration
+	// Role that credentials are obtained for, which notifications of
+	// failures name
+	RoleArn string
+	// Whether notifications are sent through the proxy of the environment
+	WithProxy bool
+}
+
+// Notification that's POSTed to the URL of a Webhook, as JSON. Its text can
+// be displayed by Slack (and compatible) incoming webhooks as is.
+type WebhookEvent struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Text    string    `json:"text"`
+	Host    string    `json:"host,omitempty"`
+	RoleArn string    `json:"roleArn,omitempty"`
+	// Number of consecutive failed refreshes, and the (redacted) error of
+	// the last one
+	ConsecutiveFailures int    `json:"consecutiveFailures,omitempty"`
+	Error               string `json:"error,omitempty"`
+	// Certificate that expires soon
+	CertificateSubject      string     `json:"certificateSubject,omitempty"`
+	CertificateSerialNumber string     `json:"certificateSerialNumber,omitempty"`
+	NotAfter                *time.Time `json:"notAfter,omitempty"`
+	DaysRemaining           int        `json:"daysRemaining,omitempty"`
+}
+
+// Sends notifications about failing refreshes and certificates that expire
+// soon to a URL (see WebhookHooks)
+type Webhook struct {
+	options WebhookOptions
+	client  *http.Client
+	host    string
+
+	mu                  sync.Mutex
+	consecutiveFailures int
+	// When the last notification about each certificate (by serial
+	// number) was sent
+	expiryNotified map[string]time.Time
+	pending        sync.WaitGroup
+}
+
+// Returns a webhook that sends notifications to the URL of the options
+func NewWebhook(options WebhookOptions) (*Webhook, error) {
+	if options.URL == "" {
+		return nil, errors.New("the webhook URL is required")
+	}
+	if options.FailureThreshold < 1 {
+		options.FailureThreshold = 1
+	}
+	transport := &http.Transport{}
+	if options.WithProxy {
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+	webhook := &Webhook{options: options, client: &http.Client{Transport: transport, Timeout: webhookTimeout},
+		expiryNotified: map[string]time.Time{}}
+	webhook.host, _ = os.Hostname()
+	return webhook, nil
+}
+
+// Returns hooks that notify the webhook when refreshes fail repeatedly, and
+// when credentials are obtained with a certificate that expires soon, and
+// then call the hooks (whose callbacks can be nil). Notifications are sent
+// in the background; Close waits for them.
+func WebhookHooks(webhook *Webhook, hooks Hooks) Hooks {
+	return Hooks{
+		OnRefresh: func(event RefreshEvent) {
+			webhook.refreshed(event.RoleArn, event.Certificate, time.Now())
+			hooks.refreshed(event)
+		},
+		OnSign:     hooks.OnSign,
+		OnCacheHit: hooks.OnCacheHit,
+		OnError: func(event ErrorEvent) {
+			if event.Operation == OperationCreateSession {
+				webhook.failed(event.Err)
+			}
+			hooks.failed(event)
+		},
+		OnCertificateExpiring: hooks.OnCertificateExpiring,
+	}
+}
+
+// Resets the count of consecutive failures, and notifies the webhook if the
+// certificate expires within the window
+func (webhook *Webhook) refreshed(roleArn string, certificate *x509.Certificate, now time.Time) {
+	webhook.mu.Lock()
+	defer webhook.mu.Unlock()
+	webhook.consecutiveFailures = 0
+	window := webhook.options.CertificateExpiryWindow
+	if certificate == nil || window <= 0 || certificate.NotAfter.Sub(now) > window {
+		return
+	}
+	serial := certificate.SerialNumber.String()
+	if last, ok := webhook.expiryNotified[serial]; ok && now.Sub(last) < webhookExpiryRepeatInterval {
+		return
+	}
+	webhook.expiryNotified[serial] = now
+
+	notAfter := certificate.NotAfter.UTC()
+	days := int(notAfter.Sub(now).Hours() / 24)
+	webhook.send(WebhookEvent{
+		Event: WebhookEventCertificateExpiring,
+		Text: fmt.Sprintf("The certificate %q that %s obtains credentials for %s with expires in %d days, at %s",
+			certificate.Subject.String(), webhook.host, roleArn, days, notAfter.Format(time.RFC3339)),
+		RoleArn:                 roleArn,
+		CertificateSubject:      certificate.Subject.String(),
+		CertificateSerialNumber: serial,
+		NotAfter:                &notAfter,
+		DaysRemaining:           days,
+	})
+}
+
+// Counts the failure, and notifies the webhook when the count reaches the
+// threshold
+func (webhook *Webhook) failed(err error) {
+	webhook.mu.Lock()
+	defer webhook.mu.Unlock()
+	webhook.consecutiveFailures++
+	if webhook.consecutiveFailures != webhook.options.FailureThreshold {
+		return
+	}
+	message := Redact(err.Error())
+	webhook.send(WebhookEvent{
+		Event: WebhookEventRefreshFailing,
+		Text: fmt.Sprintf("%s failed to obtain credentials for %s %d times in a row: %s", webhook.host,
+			webhook.options.RoleArn, webhook.consecutiveFailures, message),
+		RoleArn:             webhook.options.RoleArn,
+		ConsecutiveFailures: webhook.consecutiveFailures,
+		Error:               message,
+	})
+}
+
+// Sends the notification in the background
+func (webhook *Webhook) send(event WebhookEvent) {
+	event.Time = time.Now().UTC()
+	event.Host = webhook.host
+	webhook.pending.Add(1)
+	go func() {
+		defer webhook.pending.Done()
+		if err := webhook.post(event); err != nil {
+			generalLog.warnf("unable to send the webhook notification: %s", err)
+		}
+	}()
+}
+
+func (webhook *Webhook) post(event WebhookEvent) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.options.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if webhook.options.Secret != "" {
+		request.Header.Set(WebhookSignatureHeader, "sha256="+WebhookSignature(webhook.options.Secret, body))
+	}
+	response, err := webhook.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+	if response.StatusCode/100 != 2 {
+		return fmt.Errorf("the webhook responded with status %s", response.Status)
+	}
+	return nil
+}
+
+// Returns the hex-encoded HMAC-SHA256 of the body, keyed with the secret,
+// which receivers compare to the signature header of notifications
+func WebhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Waits for the notifications that are being sent
+func (webhook *Webhook) Close() {
+	webhook.pending.Wait()
+}
@@ -0,0 +1,73 @@
+package aws_signing_helper
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookHooks(t *testing.T) {
+	var mu sync.Mutex
+	var events []WebhookEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Header.Get(WebhookSignatureHeader) != "sha256="+WebhookSignature("secret", body) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var event WebhookEvent
+		if err := json.Unmarshal(body, &event); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, event)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhook(WebhookOptions{URL: server.URL, Secret: "secret", FailureThreshold: 2,
+		CertificateExpiryWindow: 14 * 24 * time.Hour, RoleArn: "arn:aws:iam::000000000000:role/Role"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var failures int
+	hooks := WebhookHooks(webhook, Hooks{OnError: func(ErrorEvent) { failures++ }})
+	for i := 0; i < 3; i++ {
+		hooks.OnError(ErrorEvent{OperationCreateSession, errors.New("AccessDeniedException")})
+	}
+	certificate := &x509.Certificate{Subject: pkix.Name{CommonName: "client"}, SerialNumber: big.NewInt(42),
+		NotAfter: time.Now().Add(7*24*time.Hour + time.Hour)}
+	for i := 0; i < 2; i++ {
+		hooks.OnRefresh(RefreshEvent{RoleArn: "arn:aws:iam::000000000000:role/Role", Certificate: certificate})
+	}
+	hooks.OnError(ErrorEvent{OperationCreateSession, errors.New("AccessDeniedException")})
+	webhook.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	sort.Slice(events, func(i, j int) bool { return events[i].Event > events[j].Event })
+	if len(events) != 2 {
+		t.Fatalf("unexpected events: %+v", events)
+	}
+	if events[0].Event != WebhookEventRefreshFailing || events[0].ConsecutiveFailures != 2 ||
+		events[0].Error != "AccessDeniedException" || events[0].RoleArn != "arn:aws:iam::000000000000:role/Role" {
+		t.Errorf("unexpected failure event: %+v", events[0])
+	}
+	if events[1].Event != WebhookEventCertificateExpiring || events[1].DaysRemaining != 7 ||
+		events[1].CertificateSerialNumber != "42" || events[1].NotAfter == nil || events[1].Text == "" {
+		t.Errorf("unexpected expiry event: %+v", events[1])
+	}
+	if failures != 4 {
+		t.Error("the hooks weren't called:", failures)
+	}
+}
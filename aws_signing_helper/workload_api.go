@@ -0,0 +1,413 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// The SPIFFE Workload API is a gRPC service, which is spoken here directly
+// over HTTP/2 (without TLS, on the socket of the SPIRE agent), since only
+// its FetchX509SVID method is needed. Only the parts of HTTP/2 that a
+// client of a single stream needs are implemented.
+
+// Method that streams the X.509-SVIDs of the workload, a new response being
+// sent each time that they're rotated
+const fetchX509SVIDPath = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+// Header that the Workload API requires on every request, so that it can't
+// be called by browsers (through server-side request forgery)
+const workloadAPIHeader = "workload.spiffe.io"
+
+// How long connecting to the Workload API may take
+const workloadAPIDialTimeout = 10 * time.Second
+
+const (
+	http2ClientPreface = "PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n"
+	// Largest frame that peers may send, since a larger one isn't
+	// advertised
+	http2MaxFrameSize = 16384
+	// Largest gRPC message that's accepted
+	grpcMaxMessageSize = 4 << 20
+
+	http2FrameData         = 0x0
+	http2FrameHeaders      = 0x1
+	http2FrameRSTStream    = 0x3
+	http2FrameSettings     = 0x4
+	http2FramePing         = 0x6
+	http2FrameGoAway       = 0x7
+	http2FrameWindowUpdate = 0x8
+	http2FrameContinuation = 0x9
+
+	http2FlagEndStream  = 0x1
+	http2FlagAck        = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+
+	http2SettingEnablePush = 0x2
+)
+
+// X.509-SVID of the workload, as the Workload API returns it
+type x509SVID struct {
+	SpiffeId string
+	// Certificate, followed by its intermediates, as concatenated DER
+	Certificates []byte
+	// Private key, as PKCS#8 DER
+	PrivateKey []byte
+}
+
+// Returns the network and address of the Workload API, from its SPIFFE
+// endpoint address: unix:///path/to/socket (or unix:/path/to/socket) or
+// tcp://IP:port, as SPIFFE_ENDPOINT_SOCKET is set
+func parseWorkloadAPIAddress(address string) (network string, path string, err error) {
+	endpoint, err := url.Parse(address)
+	if err != nil {
+		return "", "", fmt.Errorf("invalid SPIFFE Workload API address %q: %w", address, err)
+	}
+	switch endpoint.Scheme {
+	case "unix":
+		if endpoint.Opaque != "" || endpoint.Host != "" || endpoint.Path == "" || endpoint.RawQuery != "" {
+			return "", "", fmt.Errorf("invalid SPIFFE Workload API address %q: expected unix:///path/to/socket", address)
+		}
+		return "unix", endpoint.Path, nil
+	case "tcp":
+		ip := net.ParseIP(endpoint.Hostname())
+		if ip == nil || endpoint.Port() == "" || (endpoint.Path != "" && endpoint.Path != "/") || endpoint.RawQuery != "" {
+			return "", "", fmt.Errorf("invalid SPIFFE Workload API address %q: expected tcp://IP:port", address)
+		}
+		return "tcp", endpoint.Host, nil
+	default:
+		return "", "", fmt.Errorf("invalid SPIFFE Workload API address %q: the scheme must be unix or tcp", address)
+	}
+}
+
+// Stream of FetchX509SVID responses
+type x509SVIDStream struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	decoder *hpack.Decoder
+	// Whether the response headers were received
+	responded bool
+	// Received part of the next gRPC message
+	pending []byte
+	// Stops closing the connection once the context is done
+	stop func() bool
+}
+
+// Connects to the Workload API and calls FetchX509SVID. The connection is
+// closed once the context is done.
+func openX509SVIDStream(ctx context.Context, network string, address string) (*x509SVIDStream, error) {
+	dialer := net.Dialer{Timeout: workloadAPIDialTimeout}
+	conn, err := dialer.DialContext(ctx, network, address)
+	if err != nil {
+		return nil, err
+	}
+	stream := &x509SVIDStream{conn: conn, reader: bufio.NewReader(conn), decoder: hpack.NewDecoder(4096, nil)}
+	stream.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	if err = stream.request(); err != nil {
+		stream.Close()
+		return nil, err
+	}
+	return stream, nil
+}
+
+// Sends the connection preface and the request, whose message is empty
+// (X509SVIDRequest has no fields)
+func (stream *x509SVIDStream) request() error {
+	var headers bytes.Buffer
+	encoder := hpack.NewEncoder(&headers)
+	for _, field := range []hpack.HeaderField{
+		{Name: ":method", Value: "POST"},
+		{Name: ":scheme", Value: "http"},
+		{Name: ":authority", Value: "localhost"},
+		{Name: ":path", Value: fetchX509SVIDPath},
+		{Name: "content-type", Value: "application/grpc"},
+		{Name: "te", Value: "trailers"},
+		{Name: workloadAPIHeader, Value: "true"},
+	} {
+		if err := encoder.WriteField(field); err != nil {
+			return err
+		}
+	}
+
+	settings := binary.BigEndian.AppendUint16(nil, http2SettingEnablePush)
+	settings = binary.BigEndian.AppendUint32(settings, 0)
+	request := []byte(http2ClientPreface)
+	request = appendHTTP2Frame(request, http2FrameSettings, 0, 0, settings)
+	request = appendHTTP2Frame(request, http2FrameHeaders, http2FlagEndHeaders, 1, headers.Bytes())
+	request = appendHTTP2Frame(request, http2FrameData, http2FlagEndStream, 1, make([]byte, 5))
+	_, err := stream.conn.Write(request)
+	return err
+}
+
+// Appends an HTTP/2 frame to the buffer
+func appendHTTP2Frame(buffer []byte, frameType byte, flags byte, streamId uint32, payload []byte) []byte {
+	buffer = append(buffer, byte(len(payload)>>16), byte(len(payload)>>8), byte(len(payload)), frameType, flags)
+	buffer = binary.BigEndian.AppendUint32(buffer, streamId)
+	return append(buffer, payload...)
+}
+
+// Reads the next HTTP/2 frame
+func readHTTP2Frame(reader io.Reader) (frameType byte, flags byte, streamId uint32, payload []byte, err error) {
+	var header [9]byte
+	if _, err = io.ReadFull(reader, header[:]); err != nil {
+		return 0, 0, 0, nil, err
+	}
+	length := int(header[0])<<16 | int(header[1])<<8 | int(header[2])
+	if length > http2MaxFrameSize {
+		return 0, 0, 0, nil, fmt.Errorf("HTTP/2 frame of %d bytes exceeds the maximum frame size", length)
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(reader, payload); err != nil {
+		return 0, 0, 0, nil, err
+	}
+	return header[3], header[4], binary.BigEndian.Uint32(header[5:]) & 0x7fffffff, payload, nil
+}
+
+// Returns the payload of a DATA or HEADERS frame without its padding (and
+// priority fields)
+func unpadHTTP2Frame(frameType byte, flags byte, payload []byte) ([]byte, error) {
+	if flags&http2FlagPadded != 0 {
+		if len(payload) == 0 || int(payload[0]) >= len(payload) {
+			return nil, errors.New("invalid padding of HTTP/2 frame")
+		}
+		payload = payload[1 : len(payload)-int(payload[0])]
+	}
+	if frameType == http2FrameHeaders && flags&http2FlagPriority != 0 {
+		if len(payload) < 5 {
+			return nil, errors.New("invalid priority of HTTP/2 frame")
+		}
+		payload = payload[5:]
+	}
+	return payload, nil
+}
+
+// Reads the next response of the stream and returns its X.509-SVIDs. Returns
+// an error once the stream ends, with the status of the Workload API if it
+// failed.
+func (stream *x509SVIDStream) next() ([]x509SVID, error) {
+	for {
+		if svids, ok, err := stream.nextMessage(); ok || err != nil {
+			return svids, err
+		}
+
+		frameType, flags, streamId, payload, err := readHTTP2Frame(stream.reader)
+		if err != nil {
+			return nil, err
+		}
+		switch frameType {
+		case http2FrameSettings:
+			if flags&http2FlagAck == 0 {
+				err = stream.write(http2FrameSettings, http2FlagAck, 0, nil)
+			}
+		case http2FramePing:
+			if flags&http2FlagAck == 0 {
+				err = stream.write(http2FramePing, http2FlagAck, 0, payload)
+			}
+		case http2FrameGoAway:
+			return nil, errors.New("the SPIFFE Workload API closed the connection")
+		case http2FrameRSTStream:
+			if streamId == 1 && len(payload) == 4 {
+				return nil, fmt.Errorf("the SPIFFE Workload API reset the stream (error code %d)", binary.BigEndian.Uint32(payload))
+			}
+		case http2FrameHeaders:
+			if streamId == 1 {
+				err = stream.readHeaders(flags, payload)
+			}
+		case http2FrameData:
+			if streamId != 1 {
+				break
+			}
+			var data []byte
+			if data, err = unpadHTTP2Frame(frameType, flags, payload); err != nil {
+				return nil, err
+			}
+			if len(stream.pending)+len(data) > grpcMaxMessageSize+5 {
+				return nil, errors.New("the response of the SPIFFE Workload API is too large")
+			}
+			stream.pending = append(stream.pending, data...)
+			zeroizeBytes(payload)
+			// The received data is acknowledged right away, so that the
+			// flow control window doesn't run out on a long-lived stream
+			if len(payload) > 0 {
+				increment := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+				if err = stream.write(http2FrameWindowUpdate, 0, 0, increment); err == nil {
+					err = stream.write(http2FrameWindowUpdate, 0, 1, increment)
+				}
+			}
+			if err == nil && flags&http2FlagEndStream != 0 {
+				err = errors.New("the SPIFFE Workload API ended the stream without status")
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns the next gRPC message, if it was received in full
+func (stream *x509SVIDStream) nextMessage() ([]x509SVID, bool, error) {
+	if len(stream.pending) < 5 {
+		return nil, false, nil
+	}
+	if stream.pending[0] != 0 {
+		return nil, false, errors.New("the SPIFFE Workload API sent a compressed message")
+	}
+	length := int(binary.BigEndian.Uint32(stream.pending[1:5]))
+	if length > grpcMaxMessageSize {
+		return nil, false, errors.New("the response of the SPIFFE Workload API is too large")
+	}
+	if len(stream.pending) < 5+length {
+		return nil, false, nil
+	}
+	message := stream.pending[5 : 5+length]
+	svids, err := parseX509SVIDResponse(message)
+	// The private keys are copied out of the message, which is zeroized
+	zeroizeBytes(stream.pending[:5+length])
+	stream.pending = append([]byte{}, stream.pending[5+length:]...)
+	return svids, true, err
+}
+
+// Reads a header block (which may continue in CONTINUATION frames): the
+// response headers, whose status has to be 200, or the trailers, which end
+// the stream with the gRPC status
+func (stream *x509SVIDStream) readHeaders(flags byte, payload []byte) error {
+	block, err := unpadHTTP2Frame(http2FrameHeaders, flags, payload)
+	if err != nil {
+		return err
+	}
+	endStream := flags&http2FlagEndStream != 0
+	for flags&http2FlagEndHeaders == 0 {
+		var frameType byte
+		if frameType, flags, _, payload, err = readHTTP2Frame(stream.reader); err != nil {
+			return err
+		}
+		if frameType != http2FrameContinuation {
+			return errors.New("the SPIFFE Workload API sent an incomplete header block")
+		}
+		block = append(block, payload...)
+	}
+	fields, err := stream.decoder.DecodeFull(block)
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{}
+	for _, field := range fields {
+		headers[field.Name] = field.Value
+	}
+
+	if !stream.responded {
+		stream.responded = true
+		if status := headers[":status"]; status != "200" {
+			return fmt.Errorf("the SPIFFE Workload API responded with HTTP status %s", status)
+		}
+	}
+	if !endStream {
+		return nil
+	}
+	code, _ := strconv.Atoi(headers["grpc-status"])
+	message, _ := url.PathUnescape(headers["grpc-message"])
+	if code == 0 {
+		return errors.New("the SPIFFE Workload API ended the stream")
+	}
+	return fmt.Errorf("the SPIFFE Workload API returned gRPC status %d: %s", code, strings.TrimSpace(message))
+}
+
+// Writes an HTTP/2 frame to the connection
+func (stream *x509SVIDStream) write(frameType byte, flags byte, streamId uint32, payload []byte) error {
+	_, err := stream.conn.Write(appendHTTP2Frame(nil, frameType, flags, streamId, payload))
+	return err
+}
+
+func (stream *x509SVIDStream) Close() {
+	stream.stop()
+	stream.conn.Close()
+	zeroizeBytes(stream.pending)
+}
+
+// Calls the function with the number and value of each length-delimited
+// field of the protobuf message (since the other fields of the messages of
+// the Workload API aren't needed)
+func protobufFields(message []byte, field func(number uint64, value []byte) error) error {
+	errInvalid := errors.New("invalid protobuf message")
+	for len(message) > 0 {
+		key, n := binary.Uvarint(message)
+		if n <= 0 {
+			return errInvalid
+		}
+		message = message[n:]
+		switch key & 7 {
+		case 0:
+			if _, n = binary.Uvarint(message); n <= 0 {
+				return errInvalid
+			}
+			message = message[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(message) < size {
+				return errInvalid
+			}
+			message = message[size:]
+		case 2:
+			length, n := binary.Uvarint(message)
+			if n <= 0 || length > uint64(len(message)-n) {
+				return errInvalid
+			}
+			value := message[n : n+int(length)]
+			message = message[n+int(length):]
+			if err := field(key>>3, value); err != nil {
+				return err
+			}
+		default:
+			return errInvalid
+		}
+	}
+	return nil
+}
+
+// Parses an X509SVIDResponse, whose first field holds the X.509-SVIDs (with
+// the SPIFFE ID, certificates, and private key as their first three fields)
+func parseX509SVIDResponse(message []byte) ([]x509SVID, error) {
+	var svids []x509SVID
+	err := protobufFields(message, func(number uint64, value []byte) error {
+		if number != 1 {
+			return nil
+		}
+		var svid x509SVID
+		err := protobufFields(value, func(number uint64, value []byte) error {
+			switch number {
+			case 1:
+				svid.SpiffeId = string(value)
+			case 2:
+				svid.Certificates = append([]byte{}, value...)
+			case 3:
+				svid.PrivateKey = append([]byte{}, value...)
+			}
+			return nil
+		})
+		svids = append(svids, svid)
+		return err
+	})
+	if err != nil {
+		for _, svid := range svids {
+			zeroizeBytes(svid.PrivateKey)
+		}
+		return nil, err
+	}
+	return svids, nil
+}
@@ -0,0 +1,109 @@
+package aws_signing_helper
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"golang.org/x/net/http2/hpack"
+)
+
+// Starts a fake SPIFFE Workload API, which streams the X.509-SVIDs that are
+// sent to the channel to its client, and returns its address
+func startFakeWorkloadAPI(t *testing.T, responses <-chan []x509SVID) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go serveFakeWorkloadAPI(t, listener, responses)
+	return "tcp://" + listener.Addr().String()
+}
+
+func serveFakeWorkloadAPI(t *testing.T, listener net.Listener, responses <-chan []x509SVID) {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			preface := make([]byte, len(http2ClientPreface))
+			if _, err := io.ReadFull(reader, preface); err != nil || string(preface) != http2ClientPreface {
+				t.Log("invalid HTTP/2 client preface")
+				return
+			}
+			decoder := hpack.NewDecoder(4096, nil)
+			for {
+				frameType, flags, _, payload, err := readHTTP2Frame(reader)
+				if err != nil {
+					return
+				}
+				if frameType == http2FrameHeaders {
+					fields, _ := decoder.DecodeFull(payload)
+					headers := map[string]string{}
+					for _, field := range fields {
+						headers[field.Name] = field.Value
+					}
+					if headers[":path"] != fetchX509SVIDPath || headers[workloadAPIHeader] != "true" {
+						t.Log("unexpected request headers:", headers)
+					}
+				}
+				if frameType == http2FrameData && flags&http2FlagEndStream != 0 {
+					break
+				}
+			}
+			// Acknowledgements and window updates are discarded
+			go io.Copy(io.Discard, reader)
+
+			var headers bytes.Buffer
+			encoder := hpack.NewEncoder(&headers)
+			encoder.WriteField(hpack.HeaderField{Name: ":status", Value: "200"})
+			encoder.WriteField(hpack.HeaderField{Name: "content-type", Value: "application/grpc"})
+			response := appendHTTP2Frame(nil, http2FrameSettings, 0, 0, nil)
+			response = appendHTTP2Frame(response, http2FrameHeaders, http2FlagEndHeaders, 1, headers.Bytes())
+			if _, err := conn.Write(response); err != nil {
+				return
+			}
+			for svids := range responses {
+				var message []byte
+				for _, svid := range svids {
+					var fields []byte
+					for number, value := range [][]byte{[]byte(svid.SpiffeId), svid.Certificates, svid.PrivateKey} {
+						fields = binary.AppendUvarint(fields, uint64(number+1)<<3|2)
+						fields = binary.AppendUvarint(fields, uint64(len(value)))
+						fields = append(fields, value...)
+					}
+					message = binary.AppendUvarint(message, 1<<3|2)
+					message = binary.AppendUvarint(message, uint64(len(fields)))
+					message = append(message, fields...)
+				}
+				data := binary.BigEndian.AppendUint32([]byte{0}, uint32(len(message)))
+				if _, err := conn.Write(appendHTTP2Frame(nil, http2FrameData, 0, 1, append(data, message...))); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Reads the X.509-SVID of the SPIFFE ID from a certificate and PKCS#8
+// private key file
+func readTestSVID(t *testing.T, spiffeId string, certificateFile string, privateKeyFile string) x509SVID {
+	_, certificate, err := ReadCertificateData(certificateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM, err := os.ReadFile(privateKeyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(keyPEM)
+	return x509SVID{SpiffeId: spiffeId, Certificates: certificate.Raw, PrivateKey: block.Bytes}
+}
@@ -0,0 +1,71 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"math/big"
+)
+
+// Overwrites the bytes with zeros
+func zeroizeBytes(data []byte) {
+	clear(data)
+}
+
+// Overwrites the words of the integer with zeros, and sets it to zero
+func zeroizeBigInt(n *big.Int) {
+	if n == nil {
+		return
+	}
+	clear(n.Bits())
+	n.SetInt64(0)
+}
+
+// Overwrites the secret parts of an RSA or ECDSA private key (the private
+// exponent, primes, and CRT values, or the scalar) with zeros, so that they
+// don't linger in freed memory. The public key is left intact. This is best
+// effort: the Go runtime may have copied the values (for example, while
+// growing the heap), and crypto/rsa keeps precomputed values that can't be
+// reached. Other keys (such as crypto.Signers of other libraries) are left
+// alone.
+func zeroizePrivateKey(privateKey crypto.PrivateKey) {
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if key == nil {
+			return
+		}
+		zeroizeBigInt(key.D)
+		for _, prime := range key.Primes {
+			zeroizeBigInt(prime)
+		}
+		zeroizeBigInt(key.Precomputed.Dp)
+		zeroizeBigInt(key.Precomputed.Dq)
+		zeroizeBigInt(key.Precomputed.Qinv)
+		for _, value := range key.Precomputed.CRTValues {
+			zeroizeBigInt(value.Exp)
+			zeroizeBigInt(value.Coeff)
+			zeroizeBigInt(value.R)
+		}
+	case rsa.PrivateKey:
+		zeroizePrivateKey(&key)
+	case *ecdsa.PrivateKey:
+		if key != nil {
+			zeroizeBigInt(key.D)
+		}
+	case ecdsa.PrivateKey:
+		zeroizePrivateKey(&key)
+	}
+}
+
+// Overwrites the private key material that's kept for the lifetime of the
+// process (the private key that was read from stdin) with zeros. It's meant to
+// be called when the process exits; private keys can't be read from stdin
+// afterwards. Keys that are read from files are zeroized after each use, and
+// keys that are held by PKCS#11 modules, TPMs, and platform certificate stores
+// never leave them.
+func ZeroizeSecrets() {
+	stdinIdentity.mu.Lock()
+	defer stdinIdentity.mu.Unlock()
+	zeroizeBytes(stdinIdentity.privateKey)
+	stdinIdentity.zeroized = true
+}
@@ -0,0 +1,48 @@
+package aws_signing_helper
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"math/big"
+	"testing"
+)
+
+func TestZeroizePrivateKey(t *testing.T) {
+	for _, path := range []string{"../tst/certs/rsa-2048-key.pem", "../tst/certs/ec-prime256v1-key.pem"} {
+		key, err := ReadPrivateKeyData(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var secrets []*big.Int
+		var publicKey crypto.PublicKey
+		switch key := key.(type) {
+		case *rsa.PrivateKey:
+			secrets = append([]*big.Int{key.D, key.Precomputed.Dp, key.Precomputed.Dq, key.Precomputed.Qinv}, key.Primes...)
+			publicKey = &rsa.PublicKey{N: new(big.Int).Set(key.N), E: key.E}
+		case *ecdsa.PrivateKey:
+			secrets = []*big.Int{key.D}
+			publicKey = &ecdsa.PublicKey{Curve: key.Curve, X: new(big.Int).Set(key.X), Y: new(big.Int).Set(key.Y)}
+		}
+		var words [][]big.Word
+		for _, secret := range secrets {
+			words = append(words, secret.Bits())
+		}
+
+		zeroizePrivateKey(key)
+		for i, secret := range secrets {
+			if secret.Sign() != 0 {
+				t.Errorf("%s: secret %d wasn't zeroized", path, i)
+			}
+			for _, word := range words[i] {
+				if word != 0 {
+					t.Errorf("%s: memory of secret %d wasn't overwritten", path, i)
+					break
+				}
+			}
+		}
+		if !key.(crypto.Signer).Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(publicKey) {
+			t.Errorf("%s: public key was modified", path)
+		}
+	}
+}
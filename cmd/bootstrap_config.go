@@ -0,0 +1,142 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Flags of the bootstrap-config and wrap commands that aren't passed through
+// to the credential-process command that they generate
+var generatorOnlyFlags = map[string]bool{
+	"profile": true,
+	"format":  true,
+	"port":    true,
+}
+
+// Flags that refer to files, whose values are made absolute so that the
+// credential-process command works regardless of the working directory
+var pathFlags = map[string]bool{
+	"certificate":   true,
+	"private-key":   true,
+	"intermediates": true,
+	"config":        true,
+}
+
+// Whether the value of --certificate or --private-key refers to an object
+// that isn't a file: a PKCS#11 URI, or a TPM handle
+func isKeyReference(value string) bool {
+	return strings.HasPrefix(value, "pkcs11:") || strings.HasPrefix(value, "handle:")
+}
+
+// Whether the value of --certificate or --private-key is a PKCS#11 URI that
+// carries the user PIN in its pin-value query attribute
+func hasPkcs11PinValue(value string) bool {
+	if !strings.HasPrefix(value, "pkcs11:") {
+		return false
+	}
+	_, query, _ := strings.Cut(value, "?")
+	for _, attribute := range strings.Split(query, "&") {
+		if name, _, _ := strings.Cut(attribute, "="); name == "pin-value" {
+			return true
+		}
+	}
+	return false
+}
+
+func init() {
+	initCredentialsSubCommand(bootstrapConfigCmd)
+	bootstrapConfigCmd.PersistentFlags().StringVar(&profile, "profile", "default", "Profile in the AWS config file to write "+
+		"the credential_process setting into")
+	addIdentityProfileFlag(bootstrapConfigCmd)
+}
+
+var bootstrapConfigCmd = &cobra.Command{
+	Use:   "bootstrap-config [flags]",
+	Short: "Writes a profile that uses credential-process into the AWS config file",
+	Long: `Writes a profile into the AWS config file (~/.aws/config, or the file
+specified through AWS_CONFIG_FILE) whose credential_process setting runs
+the credential-process command with the flags that were passed to this
+command. Paths are made absolute, and arguments are quoted as required by
+the current platform. If a configuration file is used, the credential-process
+command refers to it (and to the identity profile, if one was selected)
+instead of repeating the values from the file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to determine the path to the credential helper: %w", err))
+		}
+
+		credentialProcessArgs, err := buildCredentialProcessArgs(cmd.Flags())
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		command := helper.BuildCredentialProcessCommand(executable, credentialProcessArgs)
+
+		configPath, err := helper.WriteCredentialProcessProfile(profile, command)
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to write to AWS config file: %w", err))
+		}
+		fmt.Printf("Wrote profile %s to %s:\ncredential_process = %s\n", profile, configPath, command)
+	},
+}
+
+// Builds the arguments of the credential-process command from the flags that
+// were explicitly set. Values from the configuration file, the AWS profile and
+// the environment are left out, since the credential-process command reads
+// them itself. Secrets are refused rather than written into the AWS config
+// file in plaintext.
+func buildCredentialProcessArgs(flags *pflag.FlagSet) ([]string, error) {
+	args := []string{"credential-process"}
+	var err error
+
+	flags.Visit(func(f *pflag.Flag) {
+		if err != nil || generatorOnlyFlags[f.Name] || isSetFromConfigFile(f) || isSetFromAWSProfile(f) ||
+			isSetFromEnvironment(f) {
+			return
+		}
+		name := f.Name
+		if secretFlags[name] {
+			err = fmt.Errorf("--%s can't be written into the AWS config file; supply it at runtime through %s "+
+				"or the configuration file instead", name, flagEnvVarName(name))
+			return
+		}
+
+		value := f.Value.String()
+		if f.Value.Type() == "bool" {
+			if value == "true" {
+				args = append(args, "--"+name)
+			} else {
+				args = append(args, "--"+name+"="+value)
+			}
+			return
+		}
+
+		switch {
+		case pathFlags[f.Name] && hasPkcs11PinValue(value):
+			err = fmt.Errorf("the PIN in the pin-value attribute of --%s can't be written into the AWS config file; "+
+				"supply the URI at runtime through %s or the configuration file instead", f.Name, flagEnvVarName(f.Name))
+		case pathFlags[f.Name] && value == helper.StdinIdentityId:
+			err = fmt.Errorf("--%s can't be read from stdin in a credential_process command", f.Name)
+		case pathFlags[f.Name] && !isKeyReference(value):
+			value, err = filepath.Abs(value)
+		case f.Name == "cert-selector" && strings.HasPrefix(value, "file://"):
+			var path string
+			path, err = filepath.Abs(strings.TrimPrefix(value, "file://"))
+			value = "file://" + path
+		}
+		args = append(args, "--"+name, value)
+	})
+
+	return args, err
+}
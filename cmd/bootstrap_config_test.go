@@ -0,0 +1,119 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestBuildCredentialProcessArgs(t *testing.T) {
+	flags := pflag.NewFlagSet("bootstrap-config", pflag.ContinueOnError)
+	flags.String("profile", "default", "")
+	flags.String("identity-profile", "", "")
+	flags.String("certificate", "", "")
+	flags.String("private-key", "", "")
+	flags.String("role-arn", "", "")
+	flags.String("region", "", "")
+	flags.String("cert-selector", "", "")
+	flags.Bool("with-proxy", false, "")
+	flags.Bool("no-verify-ssl", false, "")
+	err := flags.Parse([]string{
+		"--profile", "test",
+		"--identity-profile", "edge-router",
+		"--certificate", "cert.pem",
+		"--private-key", "handle:0x81000001",
+		"--role-arn", "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		"--cert-selector", "file://selector.json",
+		"--with-proxy",
+		"--no-verify-ssl=false",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args, err := buildCredentialProcessArgs(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	workingDir, _ := os.Getwd()
+	expectedArgs := []string{
+		"credential-process",
+		"--cert-selector", "file://" + filepath.Join(workingDir, "selector.json"),
+		"--certificate", filepath.Join(workingDir, "cert.pem"),
+		"--identity-profile", "edge-router",
+		"--no-verify-ssl=false",
+		"--private-key", "handle:0x81000001",
+		"--role-arn", "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		"--with-proxy",
+	}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Log("unexpected credential-process arguments:", args)
+		t.Fail()
+	}
+}
+
+func TestBuildCredentialProcessArgsSecrets(t *testing.T) {
+	newFlags := func() *pflag.FlagSet {
+		flags := pflag.NewFlagSet("bootstrap-config", pflag.ContinueOnError)
+		flags.String("private-key", "", "")
+		flags.String("role-arn", "", "")
+		flags.String("key-password", "", "")
+		flags.String("tpm-key-password", "", "")
+		return flags
+	}
+
+	// Values from the environment are left out, secrets included
+	flags := newFlags()
+	for name, value := range map[string]string{
+		"role-arn":     "arn:aws:iam::000000000000:role/ExampleS3WriteRole",
+		"key-password": "secret",
+	} {
+		flags.Set(name, value)
+		flags.SetAnnotation(name, environmentAnnotation, []string{flagEnvVarName(name)})
+	}
+	args, err := buildCredentialProcessArgs(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(args, []string{"credential-process"}) {
+		t.Log("unexpected credential-process arguments:", args)
+		t.Fail()
+	}
+
+	// Secrets on the command line are refused
+	fixtures := [][]string{
+		{"--key-password", "secret"},
+		{"--tpm-key-password", "secret"},
+		{"--private-key", "pkcs11:object=key?pin-value=1234"},
+		{"--private-key", "pkcs11:object=key?module-path=/usr/lib/p11.so&pin-value=1234"},
+	}
+	for _, fixture := range fixtures {
+		flags := newFlags()
+		if err := flags.Parse(fixture); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := buildCredentialProcessArgs(flags); err == nil {
+			t.Log("expected an error for arguments:", fixture)
+			t.Fail()
+		}
+	}
+
+	// A PKCS#11 URI without a PIN is passed through
+	flags = newFlags()
+	if err := flags.Parse([]string{"--private-key", "pkcs11:object=key?module-path=/usr/lib/p11.so"}); err != nil {
+		t.Fatal(err)
+	}
+	args, err = buildCredentialProcessArgs(flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedArgs := []string{"credential-process", "--private-key", "pkcs11:object=key?module-path=/usr/lib/p11.so"}
+	if !reflect.DeepEqual(args, expectedArgs) {
+		t.Log("unexpected credential-process arguments:", args)
+		t.Fail()
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Regions in which IAM Roles Anywhere is available, which are offered as
+// completions for the `--region` flag
+var rolesAnywhereRegions = []string{
+	"af-south-1",
+	"ap-east-1",
+	"ap-northeast-1",
+	"ap-northeast-2",
+	"ap-northeast-3",
+	"ap-south-1",
+	"ap-south-2",
+	"ap-southeast-1",
+	"ap-southeast-2",
+	"ap-southeast-3",
+	"ap-southeast-4",
+	"ca-central-1",
+	"ca-west-1",
+	"cn-north-1",
+	"cn-northwest-1",
+	"eu-central-1",
+	"eu-central-2",
+	"eu-north-1",
+	"eu-south-1",
+	"eu-south-2",
+	"eu-west-1",
+	"eu-west-2",
+	"eu-west-3",
+	"il-central-1",
+	"me-central-1",
+	"me-south-1",
+	"sa-east-1",
+	"us-east-1",
+	"us-east-2",
+	"us-gov-east-1",
+	"us-gov-west-1",
+	"us-west-1",
+	"us-west-2",
+}
+
+// Flags whose values are paths to files
+var fileFlags = []string{
+	"certificate",
+	"private-key",
+	"intermediates",
+	"pkcs11-lib",
+	"config",
+}
+
+// Registers completions for flag values with every command. Since this is
+// based on the flag definitions, it has to be done once all commands have been
+// initialized. The `completion` command itself is provided by cobra, and
+// generates scripts for bash, zsh, fish, and PowerShell.
+func registerFlagCompletions(cmd *cobra.Command) {
+	register := func(flags *pflag.FlagSet) {
+		flags.VisitAll(func(f *pflag.Flag) {
+			if _, ok := cmd.GetFlagCompletionFunc(f.Name); ok {
+				return
+			}
+
+			var completions []string
+			switch {
+			case f.Name == "region":
+				completions = rolesAnywhereRegions
+			case f.Name == "system-store-name":
+				completions = helper.SystemStoreNames
+			default:
+				if e, ok := f.Value.(*enum); ok {
+					completions = e.Allowed
+				}
+			}
+			if completions != nil {
+				cmd.RegisterFlagCompletionFunc(f.Name, cobra.FixedCompletions(completions, cobra.ShellCompDirectiveNoFileComp))
+			}
+		})
+	}
+	register(cmd.LocalNonPersistentFlags())
+	register(cmd.PersistentFlags())
+
+	for _, name := range fileFlags {
+		if cmd.PersistentFlags().Lookup(name) != nil {
+			cmd.MarkPersistentFlagFilename(name)
+		}
+	}
+
+	for _, subCmd := range cmd.Commands() {
+		registerFlagCompletions(subCmd)
+	}
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+func TestFlagCompletions(t *testing.T) {
+	registerFlagCompletions(rootCmd)
+
+	testTable := []struct {
+		cmd      *cobra.Command
+		flag     string
+		expected string
+	}{
+		{credentialProcessCmd, "region", "us-east-1"},
+		{signStringCmd, "digest", "SHA384"},
+		{signStringCmd, "format", "text"},
+		{updateCmd, "target", helper.UpdateTargetCLICache},
+	}
+	for _, tc := range testTable {
+		completionFunc, ok := tc.cmd.GetFlagCompletionFunc(tc.flag)
+		if !ok {
+			t.Logf("no completions registered for --%s of %s", tc.flag, tc.cmd.Name())
+			t.Fail()
+			continue
+		}
+		completions, _ := completionFunc(tc.cmd, nil, "")
+		found := false
+		for _, completion := range completions {
+			found = found || completion == tc.expected
+		}
+		if !found {
+			t.Logf("expected %s in completions for --%s of %s", tc.expected, tc.flag, tc.cmd.Name())
+			t.Fail()
+		}
+	}
+}
@@ -0,0 +1,368 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// Prefix of the environment variables that provide values for flags
+	envVarPrefix = "AWS_ROLESANYWHERE_"
+
+	// Key in the configuration file under which named identity profiles are defined
+	identitiesConfigKey = "identities"
+
+	// Annotations for flags whose values were set from the configuration file
+	// or the environment
+	configFileAnnotation  = "rolesanywhere_config_file"
+	environmentAnnotation = "rolesanywhere_environment"
+	awsProfileAnnotation  = "rolesanywhere_aws_profile"
+
+	// Flag that selects a named identity profile from the configuration file
+	identityProfileFlag = "identity-profile"
+)
+
+var (
+	configFilePath string
+	// Name of the identity profile in the configuration file to use
+	identityProfile string
+	// Commands that support identity profiles
+	identityProfileCommands = make(map[*cobra.Command]bool)
+	// Name of the profile in the AWS config file whose settings to use
+	awsConfigProfile string
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&configFilePath, "config", "", "Path to a YAML configuration file that provides "+
+		"values for any of the command's flags. Flags passed on the command line (and environment variables) override values "+
+		"from the file")
+	rootCmd.PersistentFlags().StringVar(&awsConfigProfile, "aws-profile", "", "Name of a profile in the AWS config file "+
+		"whose "+helper.ConfigFileSettingPrefix+" settings (such as "+helper.ConfigFileSettingPrefix+"trust_anchor_arn) "+
+		"provide values for the command's flags. They override values from the configuration file")
+	rootCmd.PersistentPreRun = func(cmd *cobra.Command, args []string) {
+		if err := loadConfiguration(cmd); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		if err := applyLogLevel(cmd); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		if err := checkRequireFIPS(); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		// Errors that cobra encounters from here on (such as for mutually
+		// exclusive flags) are reported through exitWithError instead, so that
+		// they don't break the JSON error output
+		if errorFormat.String() == "json" {
+			cmd.SilenceErrors = true
+			cmd.SilenceUsage = true
+		}
+	}
+}
+
+// Adds the flag that selects a named identity profile from the configuration
+// file to the command. It's named --identity-profile on every command, since
+// --profile refers to a profile in the AWS config or credentials file.
+func addIdentityProfileFlag(cmd *cobra.Command) {
+	cmd.PersistentFlags().StringVar(&identityProfile, identityProfileFlag, "", "Name of the identity profile (under "+
+		"identities in the configuration file) that provides values for the command's flags")
+	identityProfileCommands[cmd] = true
+}
+
+// Reads the YAML configuration file at the specified path. Top-level keys are
+// flag names that apply to every command, and mappings named after a command
+// (for example, `update` or `serve`) hold values that only apply to that
+// command, which take precedence over top-level values:
+//
+//	certificate: /etc/rolesanywhere/cert.pem
+//	private-key: /etc/rolesanywhere/key.pem
+//	role-arn: arn:aws:iam::000000000000:role/ExampleRole
+//	serve:
+//	  port: 9912
+//
+// Named identity profiles can be defined under `identities`, each of which
+// holds values that apply to any command, and which take precedence over both
+// top-level values and values for the command:
+//
+//	identities:
+//	  edge-router:
+//	    certificate: /etc/rolesanywhere/edge-router/cert.pem
+//	    private-key: /etc/rolesanywhere/edge-router/key.pem
+//	    role-arn: arn:aws:iam::000000000000:role/EdgeRouter
+//
+// Returns the values that apply to the specified command and identity profile
+// (if one is specified), keyed by flag name.
+func readConfigFile(path string, cmd *cobra.Command, identityName string) (map[string][]string, error) {
+	values, _, err := readConfigFileSections(path, cmd, identityName)
+	return values, err
+}
+
+// Reads the configuration file, as readConfigFile does, and also returns the
+// section of the file that each value comes from (such as "identity profile
+// edge-router"), keyed by flag name
+func readConfigFileSections(path string, cmd *cobra.Command, identityName string) (map[string][]string, map[string]string, error) {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to read configuration file: %w", err)
+	}
+
+	var document map[string]interface{}
+	if err = yaml.Unmarshal(contents, &document); err != nil {
+		return nil, nil, fmt.Errorf("unable to parse configuration file: %w", err)
+	}
+
+	commandNames := make(map[string]bool)
+	for _, subCmd := range rootCmd.Commands() {
+		commandNames[subCmd.Name()] = true
+	}
+
+	values := make(map[string][]string)
+	sections := make(map[string]string)
+	var commandSection, identitySection map[string]interface{}
+	identityFound := false
+	for key, value := range document {
+		if key == identitiesConfigKey {
+			identities, ok := value.(map[string]interface{})
+			if !ok && value != nil {
+				return nil, nil, fmt.Errorf("%s in the configuration file must be a mapping", identitiesConfigKey)
+			}
+			var identity interface{}
+			if identity, identityFound = identities[identityName]; identityFound {
+				if identitySection, ok = identity.(map[string]interface{}); !ok && identity != nil {
+					return nil, nil, fmt.Errorf("identity profile %s must be a mapping", identityName)
+				}
+			}
+			continue
+		}
+		if !commandNames[key] {
+			if err = addConfigValue(values, key, value); err != nil {
+				return nil, nil, err
+			}
+			sections[key] = "top level"
+			continue
+		}
+
+		section, ok := value.(map[string]interface{})
+		if !ok && value != nil {
+			return nil, nil, fmt.Errorf("configuration for the %s command must be a mapping", key)
+		}
+		if key == cmd.Name() {
+			commandSection = section
+		}
+	}
+	for i, section := range []map[string]interface{}{commandSection, identitySection} {
+		for key, value := range section {
+			delete(values, key)
+			if err = addConfigValue(values, key, value); err != nil {
+				return nil, nil, err
+			}
+			if i == 0 {
+				sections[key] = cmd.Name() + " section"
+			} else {
+				sections[key] = "identity profile " + identityName
+			}
+		}
+	}
+	if identityName != "" && !identityFound {
+		return nil, nil, fmt.Errorf("identity profile %s not found in the configuration file", identityName)
+	}
+	return values, sections, nil
+}
+
+// Converts a configuration value to the string representations that are used
+// to set the flag. Lists are only allowed for flags that can be repeated.
+func addConfigValue(values map[string][]string, key string, value interface{}) error {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		return fmt.Errorf("invalid value for configuration key %s", key)
+	case []interface{}:
+		for _, item := range v {
+			switch item.(type) {
+			case map[string]interface{}, []interface{}:
+				return fmt.Errorf("invalid value for configuration key %s", key)
+			}
+			values[key] = append(values[key], fmt.Sprint(item))
+		}
+	default:
+		values[key] = append(values[key], fmt.Sprint(v))
+	}
+	return nil
+}
+
+// Sets flags that weren't passed on the command line from the specified
+// values. Keys that aren't flags of the command are accepted as long as they
+// are flags of some other command, so that a single file can be shared by all
+// commands; any other key is reported as an error, since it's likely a typo.
+// Flags that are set this way are marked as changed, so that flag validation
+// (such as for mutually exclusive flags) treats them the same way as flags
+// passed on the command line.
+func applyFlagValues(cmd *cobra.Command, values map[string][]string, source string) error {
+	flags := cmd.Flags()
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		f := flags.Lookup(key)
+		if f == nil {
+			if !isFlagOfAnyCommand(key) {
+				return fmt.Errorf("unknown option %s in %s", key, source)
+			}
+			continue
+		}
+		if f.Changed {
+			continue
+		}
+		for _, value := range values[key] {
+			if err := flags.Set(key, value); err != nil {
+				return fmt.Errorf("invalid value for option %s in %s: %w", key, source, err)
+			}
+		}
+		switch source {
+		case configFilePath:
+			flags.SetAnnotation(key, configFileAnnotation, []string{source})
+		case "environment":
+			flags.SetAnnotation(key, environmentAnnotation, []string{flagEnvVarName(key)})
+		case awsProfileSource(awsConfigProfile):
+			flags.SetAnnotation(key, awsProfileAnnotation, []string{awsConfigProfile})
+		}
+	}
+	return nil
+}
+
+// Returns whether the value of the flag was set from the configuration file
+func isSetFromConfigFile(f *pflag.Flag) bool {
+	_, ok := f.Annotations[configFileAnnotation]
+	return ok
+}
+
+// Returns whether the value of the flag was set from an environment variable
+func isSetFromEnvironment(f *pflag.Flag) bool {
+	_, ok := f.Annotations[environmentAnnotation]
+	return ok
+}
+
+// Returns whether the value of the flag was set from the profile in the AWS
+// config file
+func isSetFromAWSProfile(f *pflag.Flag) bool {
+	_, ok := f.Annotations[awsProfileAnnotation]
+	return ok
+}
+
+// Returns whether any command of the credential helper has a flag with the
+// specified name
+func isFlagOfAnyCommand(name string) bool {
+	if rootCmd.PersistentFlags().Lookup(name) != nil {
+		return true
+	}
+	for _, subCmd := range rootCmd.Commands() {
+		if subCmd.Flags().Lookup(name) != nil || subCmd.PersistentFlags().Lookup(name) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the name of the environment variable that provides a value for the
+// flag, which is the flag name in upper case, with dashes replaced by
+// underscores, and prefixed by `AWS_ROLESANYWHERE_` (for example,
+// `AWS_ROLESANYWHERE_TRUST_ANCHOR_ARN` for `--trust-anchor-arn`)
+func flagEnvVarName(flagName string) string {
+	return envVarPrefix + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// Returns the values for the command's flags that are set in the environment
+func readEnvironment(cmd *cobra.Command) map[string][]string {
+	values := make(map[string][]string)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+		if value, ok := os.LookupEnv(flagEnvVarName(f.Name)); ok {
+			values[f.Name] = []string{value}
+		}
+	})
+	return values
+}
+
+// Describes the profile in the AWS config file as the source of values
+func awsProfileSource(profileName string) string {
+	return "profile " + profileName + " of the AWS config file"
+}
+
+// Returns the values for flags from the settings of the profile in the AWS
+// config file, keyed by flag name (rolesanywhere_trust_anchor_arn sets
+// --trust-anchor-arn)
+func readAWSConfigProfile(profileName string) (map[string][]string, error) {
+	settings, err := helper.ReadConfigFileProfileSettings(profileName)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string][]string)
+	for name, value := range settings {
+		key := strings.ReplaceAll(name, "_", "-")
+		switch key {
+		case "config", "aws-profile":
+			return nil, fmt.Errorf("%s%s can't be set in the AWS config file", helper.ConfigFileSettingPrefix, name)
+		}
+		values[key] = []string{value}
+	}
+	return values, nil
+}
+
+// Applies values from the environment, the profile in the AWS config file,
+// and the configuration file (if they were specified) to the flags of the
+// command that is being run. Flags passed on the command line take
+// precedence over the environment, which takes precedence over the profile,
+// which takes precedence over the configuration file.
+func loadConfiguration(cmd *cobra.Command) error {
+	if err := applyFlagValues(cmd, readEnvironment(cmd), "environment"); err != nil {
+		return err
+	}
+	if awsConfigProfile != "" {
+		values, err := readAWSConfigProfile(awsConfigProfile)
+		if err != nil {
+			return err
+		}
+		if _, ok := values[identityProfileFlag]; ok && identityProfileCommands[cmd] {
+			return fmt.Errorf("identity profiles can't be selected in the AWS config file; pass --%s instead", identityProfileFlag)
+		}
+		if err = applyFlagValues(cmd, values, awsProfileSource(awsConfigProfile)); err != nil {
+			return err
+		}
+	}
+
+	if configFilePath == "" {
+		if identityProfile != "" {
+			return errors.New("identity profiles can only be used with a configuration file")
+		}
+		return nil
+	}
+
+	values, err := readConfigFile(configFilePath, cmd, identityProfile)
+	if err != nil {
+		return err
+	}
+	if _, ok := values["config"]; ok {
+		return errors.New("configuration files can't refer to other configuration files")
+	}
+	if _, ok := values["aws-profile"]; ok {
+		return errors.New("profiles of the AWS config file can't be selected in the configuration file; pass --aws-profile instead")
+	}
+	if _, ok := values[identityProfileFlag]; ok && identityProfileCommands[cmd] {
+		return fmt.Errorf("identity profiles can't be selected in the configuration file; pass --%s instead", identityProfileFlag)
+	}
+	return applyFlagValues(cmd, values, configFilePath)
+}
@@ -0,0 +1,247 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+func TestConfigFile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContents := `certificate: /etc/rolesanywhere/cert.pem
+role-arn: arn:aws:iam::000000000000:role/FileRole
+session-duration: 900
+port: 9912
+update:
+  profile: file-profile
+  once: true
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		testCertificate     string
+		testRoleArn         string
+		testSessionDuration int
+		testProfile         string
+		testOnce            bool
+	)
+	testCmd := &cobra.Command{Use: "update"}
+	testCmd.Flags().StringVar(&testCertificate, "certificate", "", "")
+	testCmd.Flags().StringVar(&testRoleArn, "role-arn", "", "")
+	testCmd.Flags().IntVar(&testSessionDuration, "session-duration", 3600, "")
+	testCmd.Flags().StringVar(&testProfile, "profile", "default", "")
+	testCmd.Flags().BoolVar(&testOnce, "once", false, "")
+	if err := testCmd.Flags().Parse([]string{"--role-arn", "arn:aws:iam::000000000000:role/FlagRole"}); err != nil {
+		t.Fatal(err)
+	}
+
+	values, err := readConfigFile(configPath, testCmd, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = applyFlagValues(testCmd, values, configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	if testCertificate != "/etc/rolesanywhere/cert.pem" ||
+		testRoleArn != "arn:aws:iam::000000000000:role/FlagRole" ||
+		testSessionDuration != 900 ||
+		testProfile != "file-profile" ||
+		!testOnce {
+		t.Log("unexpected flag values after applying configuration file")
+		t.Fail()
+	}
+
+	if err = applyFlagValues(testCmd, map[string][]string{"role-arm": {"typo"}}, configPath); err == nil {
+		t.Log("expected unknown configuration key to be rejected")
+		t.Fail()
+	}
+}
+
+func TestEnvironmentVariables(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContents := `region: us-west-2
+session-duration: 900
+trust-anchor-arn: arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/file
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_ROLESANYWHERE_SESSION_DURATION", "1800")
+	t.Setenv("AWS_ROLESANYWHERE_TRUST_ANCHOR_ARN", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/env")
+
+	var (
+		testRegion          string
+		testSessionDuration int
+		testTrustAnchorArn  string
+	)
+	testCmd := &cobra.Command{Use: "credential-process"}
+	testCmd.Flags().StringVar(&testRegion, "region", "", "")
+	testCmd.Flags().IntVar(&testSessionDuration, "session-duration", 3600, "")
+	testCmd.Flags().StringVar(&testTrustAnchorArn, "trust-anchor-arn", "", "")
+	if err := testCmd.Flags().Parse([]string{"--trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	configFilePath = configPath
+	defer func() { configFilePath = "" }()
+	if err := loadConfiguration(testCmd); err != nil {
+		t.Fatal(err)
+	}
+
+	if testRegion != "us-west-2" ||
+		testSessionDuration != 1800 ||
+		testTrustAnchorArn != "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag" {
+		t.Log("unexpected precedence between flags, environment variables, and configuration file")
+		t.Fail()
+	}
+}
+
+func TestConfigFileIdentityProfile(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContents := `role-arn: arn:aws:iam::000000000000:role/FileRole
+session-duration: 900
+credential-process:
+  session-duration: 1800
+identities:
+  edge-router:
+    certificate: /etc/rolesanywhere/edge-router/cert.pem
+    role-arn: arn:aws:iam::000000000000:role/EdgeRouter
+  sensor:
+    certificate: /etc/rolesanywhere/sensor/cert.pem
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	testCmd := &cobra.Command{Use: "credential-process"}
+	values, err := readConfigFile(configPath, testCmd, "edge-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedValues := map[string][]string{
+		"certificate":      {"/etc/rolesanywhere/edge-router/cert.pem"},
+		"role-arn":         {"arn:aws:iam::000000000000:role/EdgeRouter"},
+		"session-duration": {"1800"},
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Log("unexpected values for identity profile:", values)
+		t.Fail()
+	}
+
+	values, err = readConfigFile(configPath, testCmd, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := values["certificate"]; ok {
+		t.Log("expected identity profiles to be ignored when none is selected")
+		t.Fail()
+	}
+
+	if _, err = readConfigFile(configPath, testCmd, "missing"); err == nil {
+		t.Log("expected unknown identity profile to be rejected")
+		t.Fail()
+	}
+}
+
+// --profile names a profile in the AWS config or credentials file (for
+// commands such as update), so a top-level value for it doesn't select an
+// identity profile for the other commands
+func TestConfigFileProfileKeys(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	defer func() { configFilePath = "" }()
+
+	configFilePath = configPath
+	if err := os.WriteFile(configPath, []byte("profile: developer\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfiguration(credentialProcessCmd); err != nil {
+		t.Error("unexpected error for a top-level profile:", err)
+	}
+
+	if err := os.WriteFile(configPath, []byte("identity-profile: edge-router\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadConfiguration(credentialProcessCmd); err == nil || !strings.Contains(err.Error(), "--identity-profile") {
+		t.Error("expected identity profiles to be rejected in the configuration file, but got:", err)
+	}
+}
+
+func TestAWSConfigProfile(t *testing.T) {
+	dir := t.TempDir()
+	awsConfigPath := filepath.Join(dir, "config")
+	awsConfigContents := `[profile edge-router]
+region = eu-west-1
+rolesanywhere_certificate = /etc/rolesanywhere/cert.pem
+rolesanywhere_role_arn = arn:aws:iam::000000000000:role/ProfileRole
+rolesanywhere_session_duration = 1800
+rolesanywhere_trust_anchor_arn = arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/profile
+
+[profile other]
+rolesanywhere_role_arn = arn:aws:iam::000000000000:role/OtherRole
+`
+	if err := os.WriteFile(awsConfigPath, []byte(awsConfigContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(helper.AwsConfigFileEnvVarName, awsConfigPath)
+	configPath := filepath.Join(dir, "config.yaml")
+	configContents := `region: us-west-2
+session-duration: 900
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_ROLESANYWHERE_ROLE_ARN", "arn:aws:iam::000000000000:role/env")
+
+	testCmd := &cobra.Command{Use: "credential-process"}
+	for _, name := range []string{"certificate", "region", "role-arn", "trust-anchor-arn"} {
+		testCmd.Flags().String(name, "", "")
+	}
+	testCmd.Flags().Int("session-duration", 3600, "")
+	if err := testCmd.Flags().Parse([]string{"--trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	configFilePath, awsConfigProfile = configPath, "edge-router"
+	defer func() { configFilePath, awsConfigProfile = "", "" }()
+	if err := loadConfiguration(testCmd); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := describeConfiguration(testCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEntries := []configEntry{
+		{"certificate", "/etc/rolesanywhere/cert.pem", "profile edge-router of the AWS config file"},
+		{"region", "us-west-2", "configuration file " + configPath + " (top level)"},
+		{"role-arn", "arn:aws:iam::000000000000:role/env", "environment variable AWS_ROLESANYWHERE_ROLE_ARN"},
+		{"session-duration", "1800", "profile edge-router of the AWS config file"},
+		{"trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag", "command line"},
+	}
+	if !reflect.DeepEqual(entries, expectedEntries) {
+		t.Errorf("unexpected configuration: %+v", entries)
+	}
+
+	// Values from the profile aren't repeated in generated commands
+	args, err := buildCredentialProcessArgs(testCmd.Flags())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, arg := range args {
+		if arg == "--certificate" || arg == "--session-duration" {
+			t.Errorf("value from the AWS config file was passed as %s", arg)
+		}
+	}
+
+	awsConfigProfile = "does-not-exist"
+	if err = loadConfiguration(&cobra.Command{Use: "credential-process"}); err == nil {
+		t.Error("loaded a profile that doesn't exist")
+	}
+}
@@ -0,0 +1,503 @@
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Descriptions of the signing backends, as they're offered by the configure
+// command
+var keySourceDescriptions = map[string]string{
+	"file":               "Certificate and private key files (PEM or PKCS#12)",
+	"pkcs11":             "PKCS#11 module (such as a smart card or HSM)",
+	"tpm":                "TPM 2.0 key",
+	"darwin-keychain":    "macOS keychain",
+	"windows-cert-store": "Windows certificate store",
+}
+
+func init() {
+	initCredentialsSubCommand(configureCmd)
+	configureCmd.PersistentFlags().StringVar(&profile, "profile", "default", "Default for the profile in the AWS config file to "+
+		"write the credential_process setting into")
+}
+
+var configureCmd = &cobra.Command{
+	Use:   "configure [flags]",
+	Short: "Interactively creates a configuration file and an AWS config profile",
+	Long: `Walks through choosing a key source, locating the certificate, and entering the
+trust anchor, profile, and role ARNs, validates the resulting identity (as the
+validate command does), and then writes the configuration file and a profile
+whose credential_process setting refers to it into the AWS config file. Flags
+that are passed (and values from the configuration file passed through
+--config) are offered as defaults.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		wizard := &configureWizard{
+			in:    bufio.NewReader(cmd.InOrStdin()),
+			out:   cmd.OutOrStdout(),
+			flags: cmd.Flags(),
+		}
+		if err := wizard.run(); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+	},
+}
+
+// Value for a flag that was collected by the configure command
+type configureValue struct {
+	name  string
+	value string
+}
+
+type configureWizard struct {
+	in    *bufio.Reader
+	out   io.Writer
+	flags *pflag.FlagSet
+	// Values for the configuration file, in the order in which they were
+	// collected
+	values []configureValue
+}
+
+func (w *configureWizard) run() error {
+	if err := w.askKeySource(); err != nil {
+		return err
+	}
+	if err := w.askArns(); err != nil {
+		return err
+	}
+	if _, err := w.askFlag("session-duration", "Session duration, in seconds", true, validateSessionDuration); err != nil {
+		return err
+	}
+
+	if ok, err := w.validate(); err != nil || !ok {
+		return err
+	}
+
+	defaultConfigPath := configFilePath
+	if defaultConfigPath == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		defaultConfigPath = filepath.Join(home, ".aws", "rolesanywhere.yaml")
+	}
+	configPath, err := w.ask("Path of the configuration file to write", defaultConfigPath, validateRequired)
+	if err != nil {
+		return err
+	}
+	if configPath, err = filepath.Abs(configPath); err != nil {
+		return err
+	}
+	identityName, err := w.ask("Name of the identity profile to write the settings under (leave empty to write them at the "+
+		"top level of the configuration file)", "", nil)
+	if err != nil {
+		return err
+	}
+	if err = writeConfigureValues(configPath, identityName, w.values); err != nil {
+		return fmt.Errorf("unable to write the configuration file: %w", err)
+	}
+	fmt.Fprintf(w.out, "Wrote the configuration to %s\n", configPath)
+
+	write, err := w.confirm("Write a profile that uses the configuration into the AWS config file?", true)
+	if err != nil || !write {
+		return err
+	}
+	profileName, err := w.ask("Name of the profile in the AWS config file", profile, validateRequired)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to determine the path to the credential helper: %w", err)
+	}
+	credentialProcessArgs := []string{"credential-process", "--config", configPath}
+	if identityName != "" {
+		credentialProcessArgs = append(credentialProcessArgs, "--identity-profile", identityName)
+	}
+	command := helper.BuildCredentialProcessCommand(executable, credentialProcessArgs)
+	awsConfigPath, err := helper.WriteCredentialProcessProfile(profileName, command)
+	if err != nil {
+		return fmt.Errorf("unable to write to AWS config file: %w", err)
+	}
+	fmt.Fprintf(w.out, "Wrote profile %s to %s:\ncredential_process = %s\n", profileName, awsConfigPath, command)
+	return nil
+}
+
+// Asks for the source of the private key and certificate, and for the
+// settings that it requires
+func (w *configureWizard) askKeySource() error {
+	sources := helper.Backends()
+	defaultSource := "file"
+	switch {
+	case w.flags.Changed("cert-selector"):
+		for _, source := range sources {
+			if source == "darwin-keychain" || source == "windows-cert-store" {
+				defaultSource = source
+			}
+		}
+	case w.flags.Changed("pkcs11-lib"):
+		defaultSource = "pkcs11"
+	}
+
+	fmt.Fprintln(w.out, "Where are the private key and certificate stored?")
+	for i, source := range sources {
+		fmt.Fprintf(w.out, "  %d. %s\n", i+1, keySourceDescriptions[source])
+	}
+	var defaultChoice string
+	for i, source := range sources {
+		if source == defaultSource {
+			defaultChoice = strconv.Itoa(i + 1)
+		}
+	}
+	choice, err := w.ask("Key source", defaultChoice, func(choice string) error {
+		if n, err := strconv.Atoi(choice); err != nil || n < 1 || n > len(sources) {
+			return fmt.Errorf("enter a number between 1 and %d", len(sources))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	n, _ := strconv.Atoi(choice)
+
+	switch sources[n-1] {
+	case "file":
+		certificatePath, err := w.askFlag("certificate", "Path to the certificate (or PKCS#12 file)", true, validateFileExists)
+		if err != nil {
+			return err
+		}
+		if ext := strings.ToLower(filepath.Ext(certificatePath)); ext == ".p12" || ext == ".pfx" {
+			return nil
+		}
+		if _, err = w.askFlag("private-key", "Path to the private key", true, validateFileExists); err != nil {
+			return err
+		}
+		_, err = w.askFlag("intermediates", "Path to the intermediate certificate bundle (optional)", false, validateFileExists)
+		return err
+	case "pkcs11":
+		if _, err = w.askFlag("pkcs11-lib", "Path to the PKCS#11 module", true, validateFileExists); err != nil {
+			return err
+		}
+		if _, err = w.askFlag("certificate", "PKCS#11 URI of the certificate (or path to the certificate)", true, validateURIOrFileExists); err != nil {
+			return err
+		}
+		_, err = w.askFlag("private-key", "PKCS#11 URI of the private key (optional, if it can be found from the certificate)", false, nil)
+		return err
+	case "tpm":
+		if _, err = w.askFlag("certificate", "Path to the certificate", true, validateFileExists); err != nil {
+			return err
+		}
+		privateKey, err := w.askFlag("private-key", "Path to the TPM key file, or handle of the key (such as handle:0x81000001)", true,
+			validateURIOrFileExists)
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(privateKey, "handle:") {
+			hasPassword, err := w.confirm("Does the TPM key have a password?", !noTpmKeyPassword)
+			if err != nil {
+				return err
+			}
+			if !hasPassword {
+				return w.setFlag("no-tpm-key-password", "true")
+			}
+		}
+		return nil
+	default:
+		return w.askCertSelector(sources[n-1] == "windows-cert-store")
+	}
+}
+
+// Asks for the attributes of the certificate to select from the OS
+// certificate store
+func (w *configureWizard) askCertSelector(isWindows bool) error {
+	if isWindows {
+		if _, err := w.askFlag("system-store-name", "Name of the system store", true, validateRequired); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(w.out, "Enter the attributes of the certificate to use (at least one is required).")
+	var selector []string
+	for _, attribute := range []struct{ key, prompt string }{
+		{X509_SUBJECT_KEY, "Subject of the certificate (such as CN=Subject)"},
+		{X509_ISSUER_KEY, "Issuer of the certificate (such as CN=Issuer)"},
+		{X509_SERIAL_KEY, "Serial number of the certificate, in hex"},
+	} {
+		value, err := w.ask(attribute.prompt, "", func(value string) error {
+			if strings.Contains(value, " ") {
+				return errors.New("values with spaces must be passed through a cert selector file (see --cert-selector)")
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if value != "" {
+			selector = append(selector, "Key="+attribute.key+",Value="+value)
+		}
+	}
+	if len(selector) == 0 {
+		return errors.New("no attributes of the certificate were entered")
+	}
+	return w.setFlag("cert-selector", strings.Join(selector, " "))
+}
+
+// Asks for the trust anchor, profile, and role ARNs
+func (w *configureWizard) askArns() error {
+	trustAnchorArn, err := w.askFlag("trust-anchor-arn", "Trust anchor ARN", true, arnValidator("rolesanywhere", "trust-anchor/"))
+	if err != nil {
+		return err
+	}
+	trustAnchorRegion := ""
+	if parsed, err := arn.Parse(trustAnchorArn); err == nil {
+		trustAnchorRegion = parsed.Region
+	}
+	_, err = w.askFlag("profile-arn", "Profile ARN", true, func(value string) error {
+		if err := arnValidator("rolesanywhere", "profile/")(value); err != nil {
+			return err
+		}
+		if parsed, _ := arn.Parse(value); parsed.Region != trustAnchorRegion {
+			return fmt.Errorf("the profile must be in the same region as the trust anchor (%s)", trustAnchorRegion)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.askFlag("role-arn", "Role ARN", true, arnValidator("iam", "role/"))
+	return err
+}
+
+// Validates the identity that was configured, and reports the results.
+// Returns whether the configuration should be written.
+func (w *configureWizard) validate() (bool, error) {
+	if err := PopulateCredentialsOptions(); err != nil {
+		return false, err
+	}
+
+	fmt.Fprintln(w.out, "Validating the identity...")
+	failed := false
+	results, err := helper.ValidateIdentity(&credentialsOptions, time.Now())
+	if err != nil {
+		fmt.Fprintf(w.out, "[FAIL] %s\n", err)
+		failed = true
+	}
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+			failed = true
+		}
+		if result.Message != "" {
+			fmt.Fprintf(w.out, "[%s] %s: %s\n", status, result.Check, result.Message)
+		} else {
+			fmt.Fprintf(w.out, "[%s] %s\n", status, result.Check)
+		}
+	}
+	if !failed {
+		return true, nil
+	}
+
+	write, err := w.confirm("Validation failed. Write the configuration anyway?", false)
+	if err == nil && !write {
+		err = errors.New("validation failed, so the configuration wasn't written")
+	}
+	return write, err
+}
+
+// Asks for the value of the flag, offering its current value as the
+// default, and records it for the configuration file. Optional values that
+// are left empty aren't recorded (nor validated).
+func (w *configureWizard) askFlag(name string, prompt string, required bool, validate func(string) error) (string, error) {
+	if validate == nil {
+		validate = func(string) error { return nil }
+	}
+	validator := func(value string) error {
+		if value == "" {
+			if required {
+				return errors.New("a value is required")
+			}
+			return nil
+		}
+		return validate(value)
+	}
+
+	value, err := w.ask(prompt, w.flags.Lookup(name).Value.String(), validator)
+	if err != nil || value == "" {
+		return value, err
+	}
+	// Paths are made absolute, so that the configuration file can be used
+	// regardless of the working directory
+	if (pathFlags[name] || name == "pkcs11-lib") && validateFileExists(value) == nil {
+		if value, err = filepath.Abs(value); err != nil {
+			return "", err
+		}
+	}
+	return value, w.setFlag(name, value)
+}
+
+// Sets the flag (so that the identity can be validated), and records its
+// value for the configuration file
+func (w *configureWizard) setFlag(name string, value string) error {
+	if err := w.flags.Set(name, value); err != nil {
+		return err
+	}
+	w.values = append(w.values, configureValue{name, value})
+	return nil
+}
+
+// Asks the question until a valid answer is given. If the answer is left
+// empty, the default is used.
+func (w *configureWizard) ask(prompt string, defaultValue string, validate func(string) error) (string, error) {
+	for {
+		if defaultValue != "" {
+			fmt.Fprintf(w.out, "%s [%s]: ", prompt, defaultValue)
+		} else {
+			fmt.Fprintf(w.out, "%s: ", prompt)
+		}
+
+		line, err := w.in.ReadString('\n')
+		if err != nil && (err != io.EOF || line == "") {
+			if err == io.EOF {
+				return "", errors.New("input ended before the configuration was complete")
+			}
+			return "", err
+		}
+		answer := strings.TrimSpace(line)
+		if answer == "" {
+			answer = defaultValue
+		}
+		if validate == nil {
+			return answer, nil
+		}
+		if err = validate(answer); err == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "Invalid value: %s\n", err)
+	}
+}
+
+// Asks a yes or no question
+func (w *configureWizard) confirm(prompt string, defaultValue bool) (bool, error) {
+	defaultAnswer := "n"
+	if defaultValue {
+		defaultAnswer = "y"
+	}
+	answer, err := w.ask(prompt+" (y/n)", defaultAnswer, func(answer string) error {
+		switch strings.ToLower(answer) {
+		case "y", "yes", "n", "no":
+			return nil
+		}
+		return errors.New("answer y or n")
+	})
+	if err != nil {
+		return false, err
+	}
+	return strings.HasPrefix(strings.ToLower(answer), "y"), nil
+}
+
+// Writes the values into the configuration file at the specified path,
+// either under the named identity profile or at the top level. Settings in
+// an existing configuration file that aren't overwritten are preserved
+// (although comments aren't).
+func writeConfigureValues(path string, identityName string, values []configureValue) error {
+	document := make(map[string]interface{})
+	contents, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err = yaml.Unmarshal(contents, &document); err != nil {
+		return err
+	}
+	if document == nil {
+		document = make(map[string]interface{})
+	}
+
+	section := document
+	if identityName != "" {
+		identities, ok := document[identitiesConfigKey].(map[string]interface{})
+		if !ok {
+			if document[identitiesConfigKey] != nil {
+				return fmt.Errorf("%s in the configuration file must be a mapping", identitiesConfigKey)
+			}
+			identities = make(map[string]interface{})
+			document[identitiesConfigKey] = identities
+		}
+		// The identity profile is replaced as a whole, so that settings for a
+		// different key source don't linger
+		section = make(map[string]interface{})
+		identities[identityName] = section
+	}
+	for _, value := range values {
+		if n, err := strconv.Atoi(value.value); err == nil {
+			section[value.name] = n
+		} else if b, err := strconv.ParseBool(value.value); err == nil && value.value == strconv.FormatBool(b) {
+			section[value.name] = b
+		} else {
+			section[value.name] = value.value
+		}
+	}
+
+	contents, err = yaml.Marshal(document)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	helper.RepairOwnerOnlyPermissions(path)
+	return os.WriteFile(path, contents, 0600)
+}
+
+func validateRequired(value string) error {
+	if value == "" {
+		return errors.New("a value is required")
+	}
+	return nil
+}
+
+func validateFileExists(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("unable to find %s", path)
+	}
+	return nil
+}
+
+// Accepts PKCS#11 URIs and TPM handles, as well as paths to files that exist
+func validateURIOrFileExists(value string) error {
+	if isKeyReference(value) {
+		return nil
+	}
+	return validateFileExists(value)
+}
+
+func validateSessionDuration(value string) error {
+	duration, err := strconv.Atoi(value)
+	if err != nil || duration < 900 || duration > 43200 {
+		return errors.New("session duration must be a number of seconds between 900 and 43200")
+	}
+	return nil
+}
+
+// Returns a validator for ARNs of the specified service and resource type
+func arnValidator(service string, resourcePrefix string) func(string) error {
+	return func(value string) error {
+		parsed, err := arn.Parse(value)
+		if err != nil || parsed.Service != service || !strings.HasPrefix(parsed.Resource, resourcePrefix) {
+			return fmt.Errorf("expected an ARN of the form arn:aws:%s:...:%s...", service, resourcePrefix)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"bufio"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfigureWizard(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	answers := []string{
+		"1", // Certificate and private key files
+		"../tst/certs/rsa-2048-sha256-cert.pem",
+		"/nonexistent/key.pem", // Rejected, since it doesn't exist
+		"../tst/certs/rsa-2048-key.pem",
+		"",
+		"arn:aws:iam::000000000000:role/NotATrustAnchor", // Rejected, since it's not a trust anchor
+		"arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a",
+		"arn:aws:rolesanywhere:us-west-2:000000000000:profile/b", // Rejected, since the regions don't match
+		"arn:aws:rolesanywhere:us-east-1:000000000000:profile/b",
+		"arn:aws:iam::000000000000:role/c",
+		"900",
+		"y", // The fixture is a CA certificate, so validation fails
+		configPath,
+		"edge-router",
+		"n",
+	}
+	var out strings.Builder
+	wizard := &configureWizard{
+		in:    bufio.NewReader(strings.NewReader(strings.Join(answers, "\n") + "\n")),
+		out:   &out,
+		flags: configureCmd.Flags(),
+	}
+	if err := wizard.run(); err != nil {
+		t.Log(out.String())
+		t.Fatal(err)
+	}
+
+	values, err := readConfigFile(configPath, &cobra.Command{Use: "credential-process"}, "edge-router")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certificatePath, _ := filepath.Abs("../tst/certs/rsa-2048-sha256-cert.pem")
+	privateKeyPath, _ := filepath.Abs("../tst/certs/rsa-2048-key.pem")
+	expectedValues := map[string][]string{
+		"certificate":      {certificatePath},
+		"private-key":      {privateKeyPath},
+		"trust-anchor-arn": {"arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/a"},
+		"profile-arn":      {"arn:aws:rolesanywhere:us-east-1:000000000000:profile/b"},
+		"role-arn":         {"arn:aws:iam::000000000000:role/c"},
+		"session-duration": {"900"},
+	}
+	if !reflect.DeepEqual(values, expectedValues) {
+		t.Log("unexpected values in the configuration file:", values)
+		t.Fail()
+	}
+	if strings.Count(out.String(), "Invalid value") != 3 {
+		t.Log("expected invalid answers to be rejected:", out.String())
+		t.Fail()
+	}
+}
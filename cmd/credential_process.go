@@ -2,16 +2,38 @@ package cmd
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
+	"strings"
+	"time"
 
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	secretStoreEntry string
+	dryRun           bool
+	outputFormat     *enum
 )
 
 func init() {
 	initCredentialsSubCommand(credentialProcessCmd)
+	addIdentityProfileFlag(credentialProcessCmd)
+	credentialProcessCmd.PersistentFlags().StringVar(&secretStoreEntry, "secret-store-entry", "", "Name of the OS secret store entry "+
+		"(written by `update --target secret-store`) to read credentials from. New credentials are only requested (and stored "+
+		"in the entry) if the entry doesn't exist or the credentials in it are about to expire")
+	credentialProcessCmd.PersistentFlags().BoolVar(&dryRun, "dry-run", false, "Build and sign the CreateSession request, and "+
+		"print it (including the canonical request and the sizes of the certificate headers) instead of sending it")
+	credentialProcessCmd.PersistentFlags().BoolVar(&preconnect, "preconnect", false, "Establish the connection to Roles "+
+		"Anywhere while the private key and certificate are loaded, so that CreateSession doesn't wait for the TCP and TLS "+
+		"handshakes. The connection is established with a HEAD request to the endpoint")
+	credentialProcessCmd.MarkFlagsMutuallyExclusive("dry-run", "secret-store-entry")
+	outputFormat = newEnum([]string{"json", "env", "ini", "yaml"}, "json")
+	credentialProcessCmd.PersistentFlags().Var(outputFormat, "output", "Format of the credentials. One of json (as "+
+		"expected by credential_process), env (shell commands that export the credentials as environment variables), ini "+
+		"(a profile for the AWS credentials file), and yaml")
 }
 
 var credentialProcessCmd = &cobra.Command{
@@ -23,24 +45,114 @@ found at: https://docs.aws.amazon.com/cli/latest/userguide/cli-configure-sourcin
 	Run: func(cmd *cobra.Command, args []string) {
 		err := PopulateCredentialsOptions()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
 		}
 
 		helper.Debug = credentialsOptions.Debug
 
+		if dryRun {
+			signer, signingAlgorithm, err := helper.GetSigner(&credentialsOptions)
+			if err != nil {
+				exitWithError(withErrorCode(errorCodeIdentity, err))
+			}
+			defer signer.Close()
+			dryRunOutput, err := helper.DryRunCreateSession(&credentialsOptions, signer, signingAlgorithm)
+			if err != nil {
+				exitWithError(err)
+			}
+			printDryRunOutput(dryRunOutput)
+			return
+		}
+
+		if secretStoreEntry != "" {
+			credentialProcessOutput, err := helper.ReadSecretStoreEntry(secretStoreEntry)
+			if err == nil {
+				expiration, err := time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+				if err == nil && time.Until(expiration) > helper.UpdateRefreshTime {
+					fmt.Print(formatCredentials(credentialProcessOutput, outputFormat.String()))
+					return
+				}
+			} else if !errors.Is(err, helper.ErrSecretStoreEntryNotFound) {
+				helper.LogWarnf("unable to read from secret store: %s", err)
+			}
+		}
+
+		// What doesn't depend on the signer is loaded while it's initialized
+		credentialsOptions.Preconnect = preconnect
+		helper.Preload(&credentialsOptions)
 		signer, signingAlgorithm, err := helper.GetSigner(&credentialsOptions)
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeIdentity, err))
 		}
 		defer signer.Close()
 		credentialProcessOutput, err := helper.GenerateCredentials(&credentialsOptions, signer, signingAlgorithm)
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(err)
 		}
-		buf, _ := json.Marshal(credentialProcessOutput)
-		fmt.Print(string(buf[:]))
+		if secretStoreEntry != "" {
+			cred := helper.TemporaryCredential{
+				AccessKeyId:     credentialProcessOutput.AccessKeyId,
+				SecretAccessKey: credentialProcessOutput.SecretAccessKey,
+				SessionToken:    credentialProcessOutput.SessionToken, // nosemgrep
+			}
+			cred.Expiration, _ = time.Parse(time.RFC3339, credentialProcessOutput.Expiration)
+			if err = helper.WriteSecretStoreEntry(secretStoreEntry, &cred); err != nil {
+				helper.LogWarnf("unable to write to secret store: %s", err)
+			}
+		}
+		fmt.Print(formatCredentials(credentialProcessOutput, outputFormat.String()))
 	},
 }
+
+// Formats the credentials in the specified format. JSON is printed without a
+// trailing newline, as it always has been.
+func formatCredentials(output helper.CredentialProcessOutput, format string) string {
+	switch format {
+	case "env":
+		var b strings.Builder
+		for _, variable := range []struct{ name, value string }{
+			{"AWS_ACCESS_KEY_ID", output.AccessKeyId},
+			{"AWS_SECRET_ACCESS_KEY", output.SecretAccessKey},
+			{"AWS_SESSION_TOKEN", output.SessionToken},
+			{"AWS_CREDENTIAL_EXPIRATION", output.Expiration},
+		} {
+			fmt.Fprintf(&b, "export %s='%s'\n", variable.name, strings.ReplaceAll(variable.value, "'", `'\''`))
+		}
+		return b.String()
+	case "ini":
+		return fmt.Sprintf("[default]\naws_access_key_id = %s\naws_secret_access_key = %s\naws_session_token = %s\n",
+			output.AccessKeyId, output.SecretAccessKey, output.SessionToken)
+	case "yaml":
+		buf, _ := yaml.Marshal(struct {
+			Version         int    `yaml:"Version"`
+			AccessKeyId     string `yaml:"AccessKeyId"`
+			SecretAccessKey string `yaml:"SecretAccessKey"`
+			SessionToken    string `yaml:"SessionToken"`
+			Expiration      string `yaml:"Expiration"`
+		}{output.Version, output.AccessKeyId, output.SecretAccessKey, output.SessionToken, output.Expiration})
+		return string(buf)
+	}
+	buf, _ := json.Marshal(output)
+	return string(buf)
+}
+
+// Prints the prepared CreateSession request of a dry run
+func printDryRunOutput(output helper.DryRunOutput) {
+	fmt.Printf("Endpoint: %s %s\n\n", output.Method, output.Endpoint)
+	fmt.Println("Headers:")
+	for _, header := range output.Headers {
+		fmt.Printf("%s: %s\n", header.Name, header.Value)
+	}
+	fmt.Printf("\nTotal header size: %d bytes\n", output.HeadersSize)
+	fmt.Printf("X-Amz-X509 header size: %d bytes\n", output.CertificateHeaderSize)
+	if output.CertificateChainLength > 0 {
+		fmt.Printf("X-Amz-X509-Chain header size: %d bytes (%d certificates)\n", output.CertificateChainHeaderSize,
+			output.CertificateChainLength)
+	} else {
+		fmt.Println("No X-Amz-X509-Chain header (no intermediate certificates)")
+	}
+	fmt.Printf("\nSigned headers: %s\n\n", output.SignedHeaders)
+	fmt.Printf("Canonical request:\n%s\n\n", output.CanonicalRequest)
+	fmt.Printf("String to sign:\n%s\n\n", output.StringToSign)
+	fmt.Printf("Body:\n%s\n", output.Body)
+}
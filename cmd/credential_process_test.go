@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+func TestFormatCredentials(t *testing.T) {
+	output := helper.CredentialProcessOutput{
+		Version:         1,
+		AccessKeyId:     "accessKeyId",
+		SecretAccessKey: "secret'AccessKey",
+		SessionToken:    "sessionToken",
+		Expiration:      "2022-07-27T04:36:55Z",
+	}
+
+	testTable := []struct {
+		format   string
+		expected string
+	}{
+		{"json", `{"Version":1,"AccessKeyId":"accessKeyId","SecretAccessKey":"secret'AccessKey","SessionToken":"sessionToken","Expiration":"2022-07-27T04:36:55Z"}`},
+		{"env", "export AWS_ACCESS_KEY_ID='accessKeyId'\n" +
+			"export AWS_SECRET_ACCESS_KEY='secret'\\''AccessKey'\n" +
+			"export AWS_SESSION_TOKEN='sessionToken'\n" +
+			"export AWS_CREDENTIAL_EXPIRATION='2022-07-27T04:36:55Z'\n"},
+		{"ini", "[default]\naws_access_key_id = accessKeyId\naws_secret_access_key = secret'AccessKey\naws_session_token = sessionToken\n"},
+		{"yaml", "Version: 1\nAccessKeyId: accessKeyId\nSecretAccessKey: secret'AccessKey\nSessionToken: sessionToken\nExpiration: \"2022-07-27T04:36:55Z\"\n"},
+	}
+	for _, testCase := range testTable {
+		if formatted := formatCredentials(output, testCase.format); formatted != testCase.expected {
+			t.Logf("unexpected %s output: %s", testCase.format, formatted)
+			t.Fail()
+		}
+	}
+}
@@ -1,14 +1,22 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"math/big"
+	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -30,10 +38,52 @@ var (
 	certSelector        string
 	systemStoreName     string
 
+	spiffeEndpointSocket string
+	spiffeId             string
+	kubernetesSecret     string
+	greengrassRoot       string
+
+	fleetProvisioningTemplate   string
+	fleetProvisioningParameters map[string]string
+	iotEndpoint                 string
+	claimCertificate            string
+	claimPrivateKey             string
+
 	libPkcs11 string
 
 	tpmKeyPassword   string
 	noTpmKeyPassword bool
+	keyPassword      string
+
+	certExpiryWarning   time.Duration
+	noCertValidityCheck bool
+	requiredEkus        []string
+	noKeyUsageCheck     bool
+	allowWeakKeys       bool
+	strictPermissions   bool
+	ocspCheck           = newEnum([]string{"off", "warn", "enforce"}, "off")
+	crlCheck            = newEnum([]string{"off", "warn", "enforce"}, "off")
+	crlFile             string
+	crlCacheDir         string
+	auditLogFile        string
+	auditLogMaxSize     int64
+	auditLogMaxBackups  int
+	trustAnchorCert     string
+	tlsMinVersion       string
+	httpVersion         string
+	tlsCipherSuites     []string
+	tlsCurves           []string
+	endpointPins        []string
+	emfFile             string
+	emfNamespace        string
+	webhookURL          string
+	webhookFailures     int
+	webhookExpiryDays   int
+	statsdAddress       string
+	statsdPrefix        string
+	statsdTags          []string
+	// Files that EMF records are appended to, by path
+	emfFiles = map[string]*os.File{}
 
 	credentialsOptions helper.CredentialsOpts
 
@@ -48,6 +98,28 @@ var (
 	}
 )
 
+// Values of CredentialsOpts.OCSPCheck and CRLCheck, by the value of
+// --ocsp-check and --crl-check
+var revocationChecks = map[string]string{
+	"off":     helper.OCSPCheckOff,
+	"warn":    helper.OCSPCheckWarn,
+	"enforce": helper.OCSPCheckEnforce,
+}
+
+// Environment variable with the key of the signatures of webhook events,
+// which is kept off the command line
+const webhookSecretEnv = "AWS_ROLESANYWHERE_WEBHOOK_SECRET"
+
+// Adds --audit-log and its rotation flags, which sign-string also accepts
+func addAuditLogFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&auditLogFile, "audit-log", "", "File that every signature made with the private key, and all "+
+		"credentials that are obtained, are appended to as JSON lines, for auditing (by default, they aren't recorded)")
+	flags.Int64Var(&auditLogMaxSize, "audit-log-max-size", 0, "Size in bytes beyond which --audit-log is rotated "+
+		"(renamed with a .1 suffix, while earlier rotated files are renamed to .2 and so on). By default, it's never "+
+		"rotated")
+	flags.IntVar(&auditLogMaxBackups, "audit-log-max-backups", 5, "Number of rotated audit log files that are kept")
+}
+
 type MapEntry struct {
 	Key   string
 	Value string
@@ -65,13 +137,37 @@ func initCredentialsSubCommand(subCmd *cobra.Command) {
 	subCmd.PersistentFlags().BoolVar(&noVerifySSL, "no-verify-ssl", false, "To disable SSL verification")
 	subCmd.PersistentFlags().BoolVar(&withProxy, "with-proxy", false, "To make the CreateSession call with a proxy")
 	subCmd.PersistentFlags().BoolVar(&debug, "debug", false, "To print debug output")
-	subCmd.PersistentFlags().StringVar(&certificateId, "certificate", "", "Path to certificate file")
-	subCmd.PersistentFlags().StringVar(&privateKeyId, "private-key", "", "Path to private key file")
-	subCmd.PersistentFlags().StringVar(&certificateBundleId, "intermediates", "", "Path to intermediate certificate bundle file")
+	subCmd.PersistentFlags().StringVar(&certificateId, "certificate", "", "Path to certificate file, or - to read it from stdin")
+	subCmd.PersistentFlags().StringVar(&privateKeyId, "private-key", "", "Path to private key file, or - to read it from stdin")
+	subCmd.PersistentFlags().StringVar(&certificateBundleId, "intermediates", "", "Path to intermediate certificate bundle file, or - to read it from stdin")
 	subCmd.PersistentFlags().StringVar(&certSelector, "cert-selector", "", "JSON structure to identify a certificate from a certificate store. "+
 		"Can be passed in either as string or a file name (prefixed by \"file://\")")
 	subCmd.PersistentFlags().StringVar(&systemStoreName, "system-store-name", "MY", "Name of the system store to search for within the "+
 		"CERT_SYSTEM_STORE_CURRENT_USER context. Note that this flag is only relevant for Windows certificate stores and will be ignored otherwise")
+	subCmd.PersistentFlags().StringVar(&spiffeEndpointSocket, "spiffe-endpoint-socket", "", "Address of the SPIFFE "+
+		"Workload API (such as unix:///run/spire/sockets/agent.sock, as SPIFFE_ENDPOINT_SOCKET is set) whose X.509-SVID "+
+		"is used as the identity, instead of a certificate and private key. Rotated SVIDs are used as they're issued")
+	subCmd.PersistentFlags().StringVar(&spiffeId, "spiffe-id", "", "SPIFFE ID of the X.509-SVID to use, if the "+
+		"workload has more than one (by default, the first one)")
+	subCmd.PersistentFlags().StringVar(&kubernetesSecret, "kubernetes-secret", "", "Kubernetes secret of type "+
+		"kubernetes.io/tls (<namespace>/<name>, or the name of a secret in the namespace of the pod), such as that of a "+
+		"cert-manager Certificate, whose tls.crt and tls.key are used as the identity. The secret is read through the "+
+		"API server of the cluster that the pod runs in, and watched for renewals")
+	subCmd.PersistentFlags().StringVar(&greengrassRoot, "greengrass-root", "", "Root directory of an AWS IoT "+
+		"Greengrass (v2) core device (such as /greengrass/v2), whose certificate and private key (as set in "+
+		"config/effectiveConfig.yaml, including PKCS#11 URIs of the PKCS#11 provider component) are used instead of "+
+		"--certificate and --private-key")
+	subCmd.PersistentFlags().StringVar(&fleetProvisioningTemplate, "fleet-provisioning-template", "", "Provisioning "+
+		"template of AWS IoT fleet provisioning, with which the device obtains its certificate (written to "+
+		"--certificate and --private-key) using --claim-certificate, unless --certificate exists already")
+	subCmd.PersistentFlags().StringToStringVar(&fleetProvisioningParameters, "fleet-provisioning-parameters", nil,
+		"Parameters of --fleet-provisioning-template (such as SerialNumber=1234)")
+	subCmd.PersistentFlags().StringVar(&iotEndpoint, "iot-endpoint", "", "Endpoint of AWS IoT Core for fleet "+
+		"provisioning (such as abcdefghijklmn-ats.iot.us-east-1.amazonaws.com), with the port 8883 by default, or 443")
+	subCmd.PersistentFlags().StringVar(&claimCertificate, "claim-certificate", "", "Claim certificate of fleet "+
+		"provisioning")
+	subCmd.PersistentFlags().StringVar(&claimPrivateKey, "claim-private-key", "", "Private key of --claim-certificate")
+	addACMEFlags(subCmd.PersistentFlags())
 	subCmd.PersistentFlags().StringVar(&libPkcs11, "pkcs11-lib", "", "Library for smart card / cryptographic device (OpenSC or vendor specific)")
 	subCmd.PersistentFlags().BoolVar(&reusePin, "reuse-pin", false, "Use the CKU_USER PIN as the CKU_CONTEXT_SPECIFIC PIN for "+
 		"private key objects, when they are first used to sign. If the CKU_USER PIN doesn't work as the CKU_CONTEXT_SPECIFIC PIN "+
@@ -79,13 +175,102 @@ func initCredentialsSubCommand(subCmd *cobra.Command) {
 	subCmd.PersistentFlags().StringVar(&tpmKeyPassword, "tpm-key-password", "", "Password for TPM key, if applicable")
 	subCmd.PersistentFlags().BoolVar(&noTpmKeyPassword, "no-tpm-key-password", false, "Required if the TPM key has no password and"+
 		"a handle is used to refer to the key")
+	subCmd.PersistentFlags().StringVar(&keyPassword, "key-password", "", "Password for an encrypted private key file or a "+
+		"password-protected PKCS#12 file. If it's required and not specified, it's prompted for on the terminal")
 	subCmd.PersistentFlags().StringVar(&roleSessionName, "role-session-name", "", "An identifier of a role session")
+	subCmd.PersistentFlags().DurationVar(&certExpiryWarning, "cert-expiry-warning", 720*time.Hour, "Warn when the certificate "+
+		"expires within this duration (0 disables the warning)")
+	subCmd.PersistentFlags().BoolVar(&noCertValidityCheck, "no-cert-validity-check", false, "Call CreateSession even if, "+
+		"according to the system clock, the certificate has expired or isn't valid yet")
+	subCmd.PersistentFlags().StringSliceVar(&requiredEkus, "required-eku", nil, "Extended key usages (such as "+
+		"clientAuth) that the certificate has to allow, if it has an extended key usage extension (default clientAuth)")
+	subCmd.PersistentFlags().BoolVar(&noKeyUsageCheck, "no-key-usage-check", false, "Use the certificate even if its "+
+		"key usage or extended key usage doesn't allow client authentication")
+	subCmd.PersistentFlags().BoolVar(&allowWeakKeys, "allow-weak-keys", false, "Use the private key even if it's an RSA "+
+		"key under 2048 bits or on a deprecated elliptic curve (such as P-224)")
+	subCmd.PersistentFlags().BoolVar(&strictPermissions, "strict-permissions", false, "Fail, instead of logging a "+
+		"warning, if the private key file can be accessed by users other than its owner")
+	subCmd.PersistentFlags().Var(ocspCheck, "ocsp-check", "Whether the OCSP responder of the certificate is queried "+
+		"before it's used. One of off, warn (a warning is logged if the certificate is revoked), and enforce (the "+
+		"certificate isn't used if it's revoked)")
+	subCmd.PersistentFlags().Var(crlCheck, "crl-check", "Whether the certificate is checked against the CRL of its "+
+		"issuer before it's used. One of off, warn, and enforce")
+	subCmd.PersistentFlags().StringVar(&crlFile, "crl-file", "", "CRL (PEM or DER) to check the certificate against, "+
+		"instead of downloading it from the CRL distribution points of the certificate")
+	subCmd.PersistentFlags().StringVar(&crlCacheDir, "crl-cache-dir", "", "Directory where downloaded CRLs are kept "+
+		"until their next update (by default, a directory in the cache directory of the user)")
+	addAuditLogFlags(subCmd.PersistentFlags())
+	subCmd.PersistentFlags().StringVar(&trustAnchorCert, "trust-anchor-certificate", "", "CA certificate (or bundle) of "+
+		"the trust anchor, as a PEM or DER file or an HTTP(S) URL to download it from. If it's specified, the certificate "+
+		"chain is verified against it before credentials are requested")
+	subCmd.PersistentFlags().StringVar(&tlsMinVersion, "tls-min-version", "1.2", "Minimum TLS version of the "+
+		"connections to Roles Anywhere (and to OCSP responders and CRL distribution points). One of 1.2 and 1.3")
+	subCmd.PersistentFlags().StringSliceVar(&tlsCipherSuites, "tls-cipher-suites", nil, "TLS 1.2 cipher suites (such as "+
+		"TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384) that the connections offer, in order of preference (by default, "+
+		"those that the Go standard library considers secure)")
+	subCmd.PersistentFlags().StringSliceVar(&tlsCurves, "tls-curves", nil, "Elliptic curves for key exchanges (X25519, "+
+		"P-256, P-384, or P-521) that the connections offer, in order of preference")
+	subCmd.PersistentFlags().StringVar(&httpVersion, "http-version", helper.HTTPVersionAuto, "HTTP version of the "+
+		"connections to Roles Anywhere. One of auto (HTTP/2 if the endpoint supports it), 1.1, and 2 (which fails if the "+
+		"endpoint doesn't support HTTP/2)")
+	subCmd.PersistentFlags().StringSliceVar(&endpointPins, "endpoint-pin", nil, "Base64-encoded SHA-256 hash of the "+
+		"SubjectPublicKeyInfo of a certificate of the chain of the Roles Anywhere endpoint (optionally prefixed by "+
+		"sha256/). If it's specified, CreateSession fails unless one of the pins matches. Can be repeated, to pin "+
+		"both the current and the next key while it's rotated")
+	subCmd.PersistentFlags().StringVar(&emfFile, "emf-file", "", "File that a CloudWatch Embedded Metric Format record "+
+		"(with the success or failure of the refresh, its duration, the seconds until the credentials expire, and the "+
+		"days until the certificate expires) is appended to for each refresh, for the CloudWatch agent to forward, or "+
+		"- to write the records to stderr")
+	subCmd.PersistentFlags().StringVar(&emfNamespace, "emf-namespace", helper.DefaultEMFNamespace, "CloudWatch "+
+		"namespace of the metrics of --emf-file")
+	subCmd.PersistentFlags().StringVar(&statsdAddress, "statsd-address", "", "Address of a statsd server or Datadog "+
+		"agent (a UDP host and port, such as 127.0.0.1:8125, or unix:/path for a Unix domain datagram socket) that "+
+		"refresh counts, failures, and latencies, signatures, and cache hits are sent to")
+	subCmd.PersistentFlags().StringVar(&statsdPrefix, "statsd-prefix", helper.DefaultStatsdPrefix, "Prefix of the "+
+		"names of the metrics of --statsd-address")
+	subCmd.PersistentFlags().StringSliceVar(&statsdTags, "statsd-tags", nil, "Datadog tags (such as env:prod) of the "+
+		"metrics of --statsd-address. Can be repeated")
+	subCmd.PersistentFlags().StringVar(&webhookURL, "webhook-url", "", "URL (such as a Slack incoming webhook, or a "+
+		"SIEM or webhook relay) that a JSON event is POSTed to when refreshes fail repeatedly, or when the certificate "+
+		"expires within --webhook-expiry-days. If "+webhookSecretEnv+" is set, events are signed with it (HMAC-SHA256, "+
+		"in the "+helper.WebhookSignatureHeader+" header)")
+	subCmd.PersistentFlags().IntVar(&webhookFailures, "webhook-failure-threshold", 3, "Number of consecutive failed "+
+		"refreshes after which --webhook-url is notified")
+	subCmd.PersistentFlags().IntVar(&webhookExpiryDays, "webhook-expiry-days", 14, "Notify --webhook-url when "+
+		"credentials are obtained with a certificate that expires within this many days (daily, while it does)")
 
 	subCmd.MarkFlagsMutuallyExclusive("certificate", "cert-selector")
 	subCmd.MarkFlagsMutuallyExclusive("certificate", "system-store-name")
 	subCmd.MarkFlagsMutuallyExclusive("private-key", "cert-selector")
 	subCmd.MarkFlagsMutuallyExclusive("private-key", "system-store-name")
 	subCmd.MarkFlagsMutuallyExclusive("cert-selector", "intermediates")
+	subCmd.MarkFlagsMutuallyExclusive("spiffe-endpoint-socket", "certificate")
+	subCmd.MarkFlagsMutuallyExclusive("spiffe-endpoint-socket", "private-key")
+	subCmd.MarkFlagsMutuallyExclusive("spiffe-endpoint-socket", "intermediates")
+	subCmd.MarkFlagsMutuallyExclusive("spiffe-endpoint-socket", "cert-selector")
+	subCmd.MarkFlagsMutuallyExclusive("kubernetes-secret", "certificate")
+	subCmd.MarkFlagsMutuallyExclusive("kubernetes-secret", "private-key")
+	subCmd.MarkFlagsMutuallyExclusive("kubernetes-secret", "intermediates")
+	subCmd.MarkFlagsMutuallyExclusive("kubernetes-secret", "cert-selector")
+	subCmd.MarkFlagsMutuallyExclusive("kubernetes-secret", "spiffe-endpoint-socket")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "certificate")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "private-key")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "cert-selector")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "spiffe-endpoint-socket")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "kubernetes-secret")
+	subCmd.MarkFlagsMutuallyExclusive("greengrass-root", "pkcs11-lib")
+	subCmd.MarkFlagsRequiredTogether("fleet-provisioning-template", "iot-endpoint", "claim-certificate", "claim-private-key")
+	subCmd.MarkFlagsMutuallyExclusive("fleet-provisioning-template", "cert-selector")
+	subCmd.MarkFlagsMutuallyExclusive("fleet-provisioning-template", "spiffe-endpoint-socket")
+	subCmd.MarkFlagsMutuallyExclusive("fleet-provisioning-template", "kubernetes-secret")
+	subCmd.MarkFlagsMutuallyExclusive("fleet-provisioning-template", "greengrass-root")
+	subCmd.MarkFlagsMutuallyExclusive("fleet-provisioning-template", "pkcs11-lib")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "cert-selector")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "spiffe-endpoint-socket")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "kubernetes-secret")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "greengrass-root")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "pkcs11-lib")
+	subCmd.MarkFlagsMutuallyExclusive("acme", "fleet-provisioning-template")
 	subCmd.MarkFlagsMutuallyExclusive("cert-selector", "reuse-pin")
 	subCmd.MarkFlagsMutuallyExclusive("system-store-name", "reuse-pin")
 	subCmd.MarkFlagsMutuallyExclusive("tpm-key-password", "cert-selector")
@@ -237,27 +422,180 @@ func PopulateCredentialsOptions() error {
 		return err
 	}
 
+	var requiredExtKeyUsages []x509.ExtKeyUsage
+	for _, name := range requiredEkus {
+		usage, err := helper.ParseExtKeyUsage(name)
+		if err != nil {
+			return err
+		}
+		requiredExtKeyUsages = append(requiredExtKeyUsages, usage)
+	}
+
+	tlsMinVersionId, err := helper.ParseTLSVersion(tlsMinVersion)
+	if err != nil {
+		return err
+	}
+	httpVersionName, err := helper.ParseHTTPVersion(httpVersion)
+	if err != nil {
+		return err
+	}
+	var tlsCipherSuiteIds []uint16
+	for _, name := range tlsCipherSuites {
+		suite, err := helper.ParseTLSCipherSuite(name)
+		if err != nil {
+			return err
+		}
+		tlsCipherSuiteIds = append(tlsCipherSuiteIds, suite)
+	}
+	if len(tlsCipherSuiteIds) > 0 && tlsMinVersionId == tls.VersionTLS13 {
+		return errors.New("--tls-cipher-suites only applies to TLS 1.2, so it can't be combined with --tls-min-version 1.3")
+	}
+	var tlsCurveIds []tls.CurveID
+	for _, name := range tlsCurves {
+		curve, err := helper.ParseTLSCurve(name)
+		if err != nil {
+			return err
+		}
+		tlsCurveIds = append(tlsCurveIds, curve)
+	}
+
+	for _, pin := range endpointPins {
+		if _, err := helper.ParseEndpointPin(pin); err != nil {
+			return err
+		}
+	}
+
+	if crlCacheDir == "" {
+		if cacheDir, err := os.UserCacheDir(); err == nil {
+			crlCacheDir = filepath.Join(cacheDir, "aws_signing_helper", "crl")
+		}
+	}
+
+	tracer, err := tracerProvider()
+	if err != nil {
+		return err
+	}
+	var hooks helper.Hooks
+	if emfFile != "" {
+		w, err := openEMFFile(emfFile)
+		if err != nil {
+			return err
+		}
+		hooks = helper.EMFHooks(w, helper.EMFOptions{Namespace: emfNamespace,
+			Dimensions: map[string]string{"RoleArn": roleArnStr}}, hooks)
+	}
+	if statsdAddress != "" {
+		metrics, err := helper.NewStatsdMetrics(statsdAddress, statsdPrefix, statsdTags)
+		if err != nil {
+			return fmt.Errorf("unable to connect to the statsd server: %w", err)
+		}
+		hooks = helper.MetricsHooks(metrics, hooks)
+	}
+	if webhookURL != "" {
+		webhook, err := helper.NewWebhook(helper.WebhookOptions{
+			URL:                     webhookURL,
+			Secret:                  os.Getenv(webhookSecretEnv),
+			FailureThreshold:        webhookFailures,
+			CertificateExpiryWindow: time.Duration(webhookExpiryDays) * 24 * time.Hour,
+			RoleArn:                 roleArnStr,
+			WithProxy:               withProxy,
+		})
+		if err != nil {
+			return err
+		}
+		hooks = helper.WebhookHooks(webhook, hooks)
+		atExit(webhook.Close)
+	}
+
+	identity := greengrassIdentity{certificate: certificateId, privateKey: privateKeyId, pkcs11Lib: libPkcs11}
+	if greengrassRoot != "" {
+		if identity, err = readGreengrassIdentity(greengrassRoot); err != nil {
+			return err
+		}
+	}
+
+	var fleetProvisioning *helper.FleetProvisioningOptions
+	if fleetProvisioningTemplate != "" {
+		fleetProvisioning = &helper.FleetProvisioningOptions{
+			Endpoint:         iotEndpoint,
+			ClaimCertificate: claimCertificate,
+			ClaimPrivateKey:  claimPrivateKey,
+			TemplateName:     fleetProvisioningTemplate,
+			Parameters:       fleetProvisioningParameters,
+		}
+	}
+
+	acme, err := acmeOptions()
+	if err != nil {
+		return err
+	}
+
 	credentialsOptions = helper.CredentialsOpts{
-		PrivateKeyId:        privateKeyId,
-		CertificateId:       certificateId,
-		CertificateBundleId: certificateBundleId,
-		CertIdentifier:      certIdentifier,
-		RoleArn:             roleArnStr,
-		ProfileArnStr:       profileArnStr,
-		TrustAnchorArnStr:   trustAnchorArnStr,
-		SessionDuration:     sessionDuration,
-		Region:              region,
-		Endpoint:            endpoint,
-		NoVerifySSL:         noVerifySSL,
-		WithProxy:           withProxy,
-		Debug:               debug,
-		Version:             Version,
-		LibPkcs11:           libPkcs11,
-		ReusePin:            reusePin,
-		TpmKeyPassword:      tpmKeyPassword,
-		NoTpmKeyPassword:    noTpmKeyPassword,
-		RoleSessionName:     roleSessionName,
+		PrivateKeyId:         identity.privateKey,
+		CertificateId:        identity.certificate,
+		CertificateBundleId:  certificateBundleId,
+		CertIdentifier:       certIdentifier,
+		SpiffeEndpointSocket: spiffeEndpointSocket,
+		SpiffeId:             spiffeId,
+		KubernetesSecret:     kubernetesSecret,
+		FleetProvisioning:    fleetProvisioning,
+		ACME:                 acme,
+		RoleArn:              roleArnStr,
+		ProfileArnStr:        profileArnStr,
+		TrustAnchorArnStr:    trustAnchorArnStr,
+		SessionDuration:      sessionDuration,
+		Region:               region,
+		Endpoint:             endpoint,
+		NoVerifySSL:          noVerifySSL,
+		WithProxy:            withProxy,
+		Debug:                debug,
+		Version:              Version,
+		LibPkcs11:            identity.pkcs11Lib,
+		ReusePin:             reusePin,
+		TpmKeyPassword:       tpmKeyPassword,
+		NoTpmKeyPassword:     noTpmKeyPassword,
+		KeyPassword:          keyPassword,
+		RoleSessionName:      roleSessionName,
+
+		CertificateExpiryWarningWindow: certExpiryWarning,
+		NoCertificateValidityCheck:     noCertValidityCheck,
+		RequiredExtKeyUsages:           requiredExtKeyUsages,
+		NoKeyUsageCheck:                noKeyUsageCheck,
+		AllowWeakKeys:                  allowWeakKeys,
+		StrictPermissions:              strictPermissions,
+		OCSPCheck:                      revocationChecks[ocspCheck.String()],
+		CRLCheck:                       revocationChecks[crlCheck.String()],
+		CRLFile:                        crlFile,
+		CRLCacheDir:                    crlCacheDir,
+		AuditLogFile:                   auditLogFile,
+		AuditLogMaxSize:                auditLogMaxSize,
+		AuditLogMaxBackups:             auditLogMaxBackups,
+		TrustAnchorCertificate:         trustAnchorCert,
+		TLSMinVersion:                  tlsMinVersionId,
+		HTTPVersion:                    httpVersionName,
+		TLSCipherSuites:                tlsCipherSuiteIds,
+		TLSCurvePreferences:            tlsCurveIds,
+		EndpointPins:                   endpointPins,
+		TracerProvider:                 tracer,
+		Hooks:                          hooks,
 	}
 
 	return nil
 }
+
+// Opens the file that EMF records are appended to, or returns stderr for -.
+// Files are opened once per process.
+func openEMFFile(path string) (io.Writer, error) {
+	if path == "-" {
+		return os.Stderr, nil
+	}
+	if file, ok := emfFiles[path]; ok {
+		return file, nil
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the EMF file: %w", err)
+	}
+	emfFiles[path] = file
+	return file, nil
+}
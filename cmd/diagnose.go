@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+var diagnoseOutput string
+
+// Contents of report.json in the support bundle
+type diagnosticBundleReport struct {
+	Build  BuildInfo               `json:"Build"`
+	Report helper.DiagnosticReport `json:"Report"`
+	Error  *ErrorOutput            `json:"Error,omitempty"`
+}
+
+func init() {
+	initCredentialsSubCommand(diagnoseCmd)
+	addIdentityProfileFlag(diagnoseCmd)
+	diagnoseCmd.PersistentFlags().StringVar(&diagnoseOutput, "output", "", "Path of the support bundle (a zip archive) "+
+		"that's written. Defaults to rolesanywhere-diagnostics-<time>.zip in the current directory")
+}
+
+var diagnoseCmd = &cobra.Command{
+	Use:   "diagnose [flags]",
+	Short: "Diagnoses why credentials can't be obtained, and writes a support bundle",
+	Long: `Runs the checks of the validate command, checks that the private key is only
+accessible by its owner, that the Roles Anywhere endpoint resolves and is
+reachable over TLS (through the proxy, with --with-proxy), and that the system
+clock agrees with that of Roles Anywhere, and calls CreateSession (the
+credentials are discarded). The results are printed, and written to a support
+bundle along with the build of the credential helper, its configuration, the
+AWS_ and proxy environment variables, the certificate chain, and the debug log
+of the checks. Secrets are redacted from the bundle. Exits with a non-zero
+status if any check fails. For example:
+
+  aws_signing_helper diagnose --config /etc/rolesanywhere/config.yaml --identity-profile edge-router`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		report := helper.Diagnose(context.Background(), &credentialsOptions)
+		fmt.Print(report.Summary())
+
+		path := diagnoseOutput
+		if path == "" {
+			path = fmt.Sprintf("rolesanywhere-diagnostics-%s.zip", report.Time.Format("20060102T150405Z"))
+		}
+		if err = writeDiagnosticBundle(cmd, path, report); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, fmt.Errorf("unable to write the support bundle: %w", err)))
+		}
+		fmt.Printf("\nWrote the support bundle to %s\n", path)
+
+		if !report.Passed() {
+			code := errorCodeIdentity
+			if report.CreateSessionError != nil {
+				code = classifyError(report.CreateSessionError).Code
+			}
+			exit(exitCodes[code])
+		}
+	},
+}
+
+// Writes the support bundle: the summary of the checks, the report (as
+// JSON), the configuration of the command (as print-config prints it), the
+// certificate chain, and the debug log. The archive is only readable by its
+// owner, since it names the ARNs and files that are in use.
+func writeDiagnosticBundle(cmd *cobra.Command, path string, report helper.DiagnosticReport) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	bundleReport := diagnosticBundleReport{Build: getBuildInfo(), Report: report}
+	if report.CreateSessionError != nil {
+		output := classifyError(report.CreateSessionError)
+		bundleReport.Error = &output
+	}
+	reportJSON, err := json.MarshalIndent(bundleReport, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	var configuration strings.Builder
+	if entries, err := describeConfiguration(cmd); err != nil {
+		fmt.Fprintf(&configuration, "unable to describe the configuration: %s\n", err)
+	} else {
+		writeConfiguration(&configuration, entries)
+	}
+
+	archive := zip.NewWriter(file)
+	for _, entry := range []struct {
+		name    string
+		content string
+	}{
+		{"summary.txt", report.Summary()},
+		{"report.json", string(reportJSON) + "\n"},
+		{"configuration.txt", configuration.String()},
+		{"certificates.pem", report.Certificates},
+		{"debug.log", report.Log},
+	} {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: report.Time})
+		if err != nil {
+			return err
+		}
+		if _, err = w.Write([]byte(helper.Redact(entry.content))); err != nil {
+			return err
+		}
+	}
+	if err = archive.Close(); err != nil {
+		return err
+	}
+	return file.Close()
+}
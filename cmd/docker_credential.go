@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+// Prefix of the names of Docker credential helpers, which the credential
+// helper is run as through a symbolic link (such as
+// docker-credential-rolesanywhere)
+const dockerCredentialHelperPrefix = "docker-credential-"
+
+// Message that tells Docker that the helper has no credentials for a server,
+// so that it falls back to anonymous access
+const dockerCredentialsNotFound = "credentials not found in native keychain"
+
+var ecrEndpoint string
+
+func init() {
+	initCredentialsSubCommand(dockerCredentialCmd)
+	addIdentityProfileFlag(dockerCredentialCmd)
+	dockerCredentialCmd.PersistentFlags().StringVar(&ecrEndpoint, "ecr-endpoint", "", "Endpoint of the ECR API that "+
+		"GetAuthorizationToken is called on (such as that of a VPC endpoint). By default, the endpoint of the region of "+
+		"the registry is used")
+}
+
+var dockerCredentialCmd = &cobra.Command{
+	Use:       "docker-credential get|store|erase|list",
+	Short:     "Docker credential helper that logs in to Amazon ECR with Roles Anywhere credentials",
+	ValidArgs: []string{"get", "store", "erase", "list"},
+	Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	Long: `Implements the protocol of Docker credential helpers: for get, the server URL
+of a private Amazon ECR registry is read from stdin, and an ECR authorization
+token is obtained with the credentials of the role (in the region of the
+registry), and written to stdout. Tokens are requested for each get, and
+nothing is stored, so store and erase do nothing, and list lists no
+registries. Docker runs the helper as docker-credential-<name>, without
+flags, so the credential helper behaves as this command when it's run through
+a symbolic link with such a name, and its flags are set by the configuration
+file (or by environment variables, such as AWS_ROLESANYWHERE_CONFIG). For
+example, with "credHelpers": {"123456789012.dkr.ecr.us-east-1.amazonaws.com":
+"rolesanywhere"} in ~/.docker/config.json:
+
+  ln -s /usr/local/bin/aws_signing_helper /usr/local/bin/docker-credential-rolesanywhere`,
+	Run: func(cmd *cobra.Command, args []string) {
+		switch args[0] {
+		case "get":
+			serverURL, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && err != io.EOF {
+				dockerCredentialFailure(err.Error())
+			}
+			serverURL = strings.TrimSpace(serverURL)
+			registry, err := helper.ParseECRRegistry(serverURL)
+			if err != nil {
+				helper.LogDebugf("%s", err)
+				dockerCredentialFailure(dockerCredentialsNotFound)
+			}
+			token, err := getECRAuthorizationToken(registry)
+			if err != nil {
+				dockerCredentialFailure(err.Error())
+			}
+			buf, _ := json.Marshal(struct {
+				ServerURL string `json:"ServerURL"`
+				Username  string `json:"Username"`
+				Secret    string `json:"Secret"`
+			}{serverURL, token.Username, token.Password})
+			fmt.Println(string(buf))
+		case "store", "erase":
+			// The input (credentials of docker login, or a server URL) is
+			// discarded, since tokens are obtained for each get
+			io.Copy(io.Discard, os.Stdin)
+		case "list":
+			fmt.Println("{}")
+		}
+	},
+}
+
+// Obtains credentials, and the ECR authorization token for the registry with
+// them
+func getECRAuthorizationToken(registry helper.ECRRegistry) (helper.ECRAuthorizationToken, error) {
+	if err := PopulateCredentialsOptions(); err != nil {
+		return helper.ECRAuthorizationToken{}, err
+	}
+	helper.Debug = credentialsOptions.Debug
+	helper.Preload(&credentialsOptions)
+	signer, signingAlgorithm, err := helper.GetSigner(&credentialsOptions)
+	if err != nil {
+		return helper.ECRAuthorizationToken{}, err
+	}
+	defer signer.Close()
+	output, err := helper.GenerateCredentials(&credentialsOptions, signer, signingAlgorithm)
+	if err != nil {
+		return helper.ECRAuthorizationToken{}, err
+	}
+	return helper.GetECRAuthorizationToken(context.Background(), output, registry, helper.ECRTokenOptions{
+		Endpoint:  ecrEndpoint,
+		WithProxy: withProxy,
+	})
+}
+
+// Writes the message to stdout, where Docker reads the errors of credential
+// helpers from, and exits
+func dockerCredentialFailure(message string) {
+	fmt.Println(message)
+	exit(1)
+}
+
+// Returns the arguments of the docker-credential command, if the credential
+// helper is run as a Docker credential helper (through a symbolic link whose
+// name starts with docker-credential-), or nil otherwise
+func dockerCredentialHelperArgs(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	name := strings.TrimSuffix(filepath.Base(args[0]), ".exe")
+	if !strings.HasPrefix(name, dockerCredentialHelperPrefix) {
+		return nil
+	}
+	return append([]string{dockerCredentialCmd.Name()}, args[1:]...)
+}
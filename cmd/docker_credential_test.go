@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestDockerCredentialHelperArgs(t *testing.T) {
+	cases := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"/usr/local/bin/docker-credential-rolesanywhere", "get"}, []string{"docker-credential", "get"}},
+		{[]string{`C:\bin\docker-credential-rolesanywhere.exe`, "list"}, []string{"docker-credential", "list"}},
+		{[]string{"/usr/local/bin/aws_signing_helper", "credential-process"}, nil},
+	}
+	for _, c := range cases {
+		if runtime.GOOS != "windows" && strings.Contains(c.args[0], `\`) {
+			continue
+		}
+		if args := dockerCredentialHelperArgs(c.args); !reflect.DeepEqual(args, c.expected) {
+			t.Errorf("unexpected arguments for %v: %v", c.args, args)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var (
+	acmeDirectory   string
+	acmeIdentifiers []string
+	acmeEmail       string
+	acmeAccountKey  string
+	acmeEABKeyId    string
+	acmeEABHMACKey  string
+	acmeHTTPAddress string
+	acmeCABundle    string
+	acmeRenewBefore time.Duration
+	enrollForce     bool
+)
+
+// Adds --acme and the flags of the ACME account and challenges, which the
+// enroll command and the commands that vend credentials accept
+func addACMEFlags(flags *pflag.FlagSet) {
+	flags.StringVar(&acmeDirectory, "acme", "", "Directory URL of an ACME server (such as that of a private CA) that "+
+		"the certificate is enrolled with, and renewed with before it expires, writing it to --certificate and "+
+		"--private-key")
+	flags.StringSliceVar(&acmeIdentifiers, "acme-identifiers", nil, "DNS names (or IP addresses) that the certificate "+
+		"is issued for, which are validated with http-01 challenges (by default, the host name)")
+	flags.StringVar(&acmeEmail, "acme-email", "", "Contact address of the ACME account")
+	flags.StringVar(&acmeAccountKey, "acme-account-key", "", "Private key of the ACME account, which is created (and "+
+		"the account registered) if it doesn't exist (by default, acme-account.key in the directory of --private-key)")
+	flags.StringVar(&acmeEABKeyId, "acme-eab-key-id", "", "Key ID of the external account binding that the ACME server "+
+		"requires to register accounts")
+	flags.StringVar(&acmeEABHMACKey, "acme-eab-hmac-key", "", "Base64url-encoded HMAC key of --acme-eab-key-id")
+	flags.StringVar(&acmeHTTPAddress, "acme-http-address", ":80", "Address that the http-01 challenges are served on "+
+		"while the certificate is enrolled")
+	flags.StringVar(&acmeCABundle, "acme-ca-bundle", "", "CA certificates that the certificate of the ACME server is "+
+		"verified against (by default, those of the system)")
+	flags.DurationVar(&acmeRenewBefore, "acme-renew-before", 0, "How long before the certificate expires it's renewed "+
+		"(by default, once two thirds of its validity period have passed)")
+}
+
+func init() {
+	rootCmd.AddCommand(enrollCmd)
+	enrollCmd.PersistentFlags().StringVar(&certificateId, "certificate", "", "File that the certificate (followed by "+
+		"its intermediates) is written to")
+	enrollCmd.PersistentFlags().StringVar(&privateKeyId, "private-key", "", "File that the private key is written to")
+	enrollCmd.PersistentFlags().BoolVar(&withProxy, "with-proxy", false, "To make the ACME requests with a proxy")
+	enrollCmd.PersistentFlags().BoolVar(&enrollForce, "force", false, "To enroll a new certificate even if the "+
+		"current one isn't due to be renewed yet")
+	enrollCmd.PersistentFlags().BoolVar(&debug, "debug", false, "To print debug output")
+	addACMEFlags(enrollCmd.PersistentFlags())
+	enrollCmd.MarkPersistentFlagRequired("acme")
+	enrollCmd.MarkPersistentFlagRequired("certificate")
+	enrollCmd.MarkPersistentFlagRequired("private-key")
+}
+
+var enrollCmd = &cobra.Command{
+	Use:   "enroll --acme <directory URL> [flags]",
+	Short: "Enrolls (or renews) the certificate with an ACME server",
+	Long: `Obtains a certificate for a new private key from an ACME server (such as that of
+a private CA), and writes them to --certificate and --private-key, unless the
+current certificate isn't due to be renewed yet. The identifiers of the
+certificate are validated with http-01 challenges, which are served on
+--acme-http-address. The serve, update, and sidecar commands enroll and renew
+the certificate themselves when they're passed --acme, and move onto renewed
+certificates right away.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		helper.Debug = debug
+		options, err := acmeOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		if !enrollForce {
+			if _, certificate, err := helper.ReadCertificateData(certificateId); err == nil {
+				renewal := helper.ACMERenewalTime(certificate, options.RenewBefore)
+				if time.Now().Before(renewal) {
+					helper.LogInfof("the certificate %s isn't due to be renewed until %s", certificate.SerialNumber,
+						renewal.UTC().Format(time.RFC3339))
+					return
+				}
+			}
+		}
+		certificate, err := helper.EnrollACME(context.Background(), *options, certificateId, privateKeyId)
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeIdentity, err))
+		}
+		helper.LogInfof("obtained the certificate %s (expires at %s)", certificate.SerialNumber,
+			certificate.NotAfter.UTC().Format(time.RFC3339))
+	},
+}
+
+// Returns the ACME options of the flags, or nil if --acme wasn't passed
+func acmeOptions() (*helper.ACMEOptions, error) {
+	if acmeDirectory == "" {
+		return nil, nil
+	}
+	if certificateId == "" || privateKeyId == "" {
+		return nil, errors.New("--acme requires --certificate and --private-key, which the certificate and private " +
+			"key are written to")
+	}
+	options := &helper.ACMEOptions{
+		DirectoryURL:   acmeDirectory,
+		Identifiers:    acmeIdentifiers,
+		Email:          acmeEmail,
+		AccountKeyFile: acmeAccountKey,
+		EABKeyId:       acmeEABKeyId,
+		HTTPAddress:    acmeHTTPAddress,
+		RenewBefore:    acmeRenewBefore,
+		WithProxy:      withProxy,
+	}
+	if len(options.Identifiers) == 0 {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("unable to determine the host name, so --acme-identifiers is required: %w", err)
+		}
+		options.Identifiers = []string{hostname}
+	}
+	if options.AccountKeyFile == "" {
+		options.AccountKeyFile = filepath.Join(filepath.Dir(privateKeyId), "acme-account.key")
+	}
+	if (acmeEABKeyId == "") != (acmeEABHMACKey == "") {
+		return nil, errors.New("--acme-eab-key-id and --acme-eab-hmac-key are required together")
+	}
+	if acmeEABHMACKey != "" {
+		key, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(acmeEABHMACKey, "="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid --acme-eab-hmac-key: %w", err)
+		}
+		options.EABHMACKey = key
+	}
+	if acmeCABundle != "" {
+		data, err := os.ReadFile(acmeCABundle)
+		if err != nil {
+			return nil, err
+		}
+		options.RootCAs = x509.NewCertPool()
+		if !options.RootCAs.AppendCertsFromPEM(data) {
+			return nil, fmt.Errorf("%s has no PEM certificates", acmeCABundle)
+		}
+	}
+	return options, nil
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestACMEOptions(t *testing.T) {
+	defer func(certificate, privateKey string) {
+		acmeDirectory, acmeEABKeyId, acmeEABHMACKey = "", "", ""
+		certificateId, privateKeyId = certificate, privateKey
+	}(certificateId, privateKeyId)
+	certificateId, privateKeyId = "", ""
+	if options, err := acmeOptions(); options != nil || err != nil {
+		t.Fatalf("expected no ACME options without --acme, got %v (%v)", options, err)
+	}
+
+	acmeDirectory = "https://ca.example.com/acme/acme/directory"
+	if _, err := acmeOptions(); err == nil {
+		t.Error("expected --acme to require --certificate and --private-key")
+	}
+	certificateId = filepath.Join("identity", "device.pem")
+	privateKeyId = filepath.Join("identity", "device.key")
+	options, err := acmeOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostname, _ := os.Hostname()
+	if !reflect.DeepEqual(options.Identifiers, []string{hostname}) {
+		t.Errorf("expected the host name to be the identifier, got %v", options.Identifiers)
+	}
+	if options.AccountKeyFile != filepath.Join("identity", "acme-account.key") {
+		t.Errorf("unexpected default account key %s", options.AccountKeyFile)
+	}
+
+	acmeEABKeyId = "eab-key"
+	if _, err = acmeOptions(); err == nil {
+		t.Error("expected --acme-eab-key-id to require --acme-eab-hmac-key")
+	}
+	acmeEABHMACKey = "c2VjcmV0LWtleQ"
+	if options, err = acmeOptions(); err != nil || string(options.EABHMACKey) != "secret-key" {
+		t.Errorf("unexpected EAB HMAC key %q (%v)", options.EABHMACKey, err)
+	}
+}
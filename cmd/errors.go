@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+// Codes that classify errors in the JSON error output. These are part of the
+// interface of the credential helper, so existing codes must not be changed.
+const (
+	errorCodeConfiguration      = "ConfigurationError"
+	errorCodeIdentity           = "IdentityError"
+	errorCodeCertificateExpired = "CertificateExpired"
+	errorCodeNetwork            = "NetworkError"
+	errorCodeAccessDenied       = "AccessDenied"
+	errorCodeThrottled          = "Throttled"
+	errorCodeService            = "ServiceError"
+	errorCodeCertificateRevoked = "CertificateRevoked"
+	errorCodeClock              = "ClockError"
+	errorCodeUnknown            = "UnknownError"
+)
+
+// Exit codes for each class of error, so that scripts and service managers
+// can decide whether to retry or alert. These are part of the interface of
+// the credential helper as well. 1 is used for errors that couldn't be
+// classified, as it was before the exit codes were introduced.
+var exitCodes = map[string]int{
+	errorCodeUnknown:            1,
+	errorCodeConfiguration:      2,
+	errorCodeIdentity:           3,
+	errorCodeCertificateExpired: 4,
+	errorCodeNetwork:            5,
+	errorCodeAccessDenied:       6,
+	errorCodeThrottled:          7,
+	errorCodeService:            8,
+	errorCodeCertificateRevoked: 9,
+	errorCodeClock:              10,
+}
+
+var errorHints = map[string]string{
+	errorCodeConfiguration:      "check the flags, environment variables, and configuration file that were passed",
+	errorCodeIdentity:           "check that the certificate, private key, and intermediates can be read and belong together; the validate command can help",
+	errorCodeCertificateExpired: "the certificate (or one of its issuers) has expired or isn't valid yet; issue a new certificate, or check the system clock",
+	errorCodeNetwork:            "check connectivity to the Roles Anywhere endpoint (and --with-proxy, if a proxy is required)",
+	errorCodeAccessDenied:       "check that the trust anchor, profile, and role ARNs are correct, that the trust anchor and profile are enabled, and that the role trusts Roles Anywhere",
+	errorCodeThrottled:          "the request was throttled; retry with backoff",
+	errorCodeService:            "Roles Anywhere returned a server error; retry with backoff",
+	errorCodeCertificateRevoked: "the certificate has been revoked, according to its OCSP responder or CRL; issue a new certificate",
+	errorCodeClock:              "the system clock is wrong; synchronize it (for example, through NTP), and retry",
+}
+
+var errorFormat *enum
+
+func init() {
+	errorFormat = newEnum([]string{"text", "json"}, "text")
+	rootCmd.PersistentFlags().Var(errorFormat, "error-format", "Format of errors written to stderr. One of text and json "+
+		"(a JSON object with the code, message, hint, and retryable fields, and the correlation and request IDs of failed "+
+		"credential requests)")
+}
+
+// Error written to stderr when --error-format is json
+type ErrorOutput struct {
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Hint      string `json:"hint,omitempty"`
+	Retryable bool   `json:"retryable"`
+	// Correlation ID of the credential request that failed, and ID of the
+	// Roles Anywhere request that returned the error (if one did)
+	CorrelationId string `json:"correlationId,omitempty"`
+	RequestId     string `json:"requestId,omitempty"`
+}
+
+// Error that has been classified by the command that encountered it, for
+// errors whose class can't be determined from the error itself (such as
+// invalid flag values)
+type codedError struct {
+	code string
+	err  error
+}
+
+func (e *codedError) Error() string { return e.err.Error() }
+func (e *codedError) Unwrap() error { return e.err }
+
+// Marks the error as being of the class with the specified code
+func withErrorCode(code string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &codedError{code, err}
+}
+
+// Classifies the error. Errors returned by Roles Anywhere (and errors that
+// occurred while sending the request) take precedence over the class that
+// the command assigned to the error.
+func classifyError(err error) ErrorOutput {
+	output := ErrorOutput{Code: errorCodeUnknown, Message: helper.Redact(err.Error()),
+		CorrelationId: helper.ErrorCorrelationId(err), RequestId: helper.ErrorRequestId(err)}
+
+	var (
+		apiErr      smithy.APIError
+		responseErr *smithyhttp.ResponseError
+		sendErr     *smithyhttp.RequestSendError
+		opErr       *net.OpError
+		dnsErr      *net.DNSError
+		certErr     x509.CertificateInvalidError
+		coded       *codedError
+	)
+	switch {
+	// Errors of the library wrap these, so they're checked first. Errors that
+	// don't come from the library (such as those of the SDK) are classified
+	// by the cases below.
+	case errors.Is(err, helper.ErrClockNotSynchronized):
+		output.Code = errorCodeClock
+	case errors.Is(err, helper.ErrCertificateExpired):
+		output.Code = errorCodeCertificateExpired
+	case errors.Is(err, helper.ErrCertificateRevoked):
+		output.Code = errorCodeCertificateRevoked
+	case errors.Is(err, helper.ErrThrottled):
+		output.Code = errorCodeThrottled
+	case errors.Is(err, helper.ErrEndpointUnreachable):
+		output.Code = errorCodeNetwork
+	case errors.Is(err, helper.ErrUnsupportedAlgorithm), errors.Is(err, helper.ErrUnsupportedHash),
+		errors.Is(err, helper.ErrKeyCertificateMismatch), errors.Is(err, helper.ErrCertificateKeyUsage), errors.Is(err, helper.ErrWeakKey),
+		errors.Is(err, helper.ErrInsecurePermissions), errors.Is(err, helper.ErrUntrustedCertificate):
+		output.Code = errorCodeIdentity
+	case errors.Is(err, helper.ErrBackendUnavailable):
+		output.Code = errorCodeConfiguration
+	case errors.As(err, &apiErr):
+		switch apiErr.ErrorCode() {
+		case "AccessDeniedException":
+			output.Code = errorCodeAccessDenied
+			if strings.Contains(strings.ToLower(apiErr.ErrorMessage()), "expired") {
+				output.Code = errorCodeCertificateExpired
+			}
+		case "ThrottlingException", "TooManyRequestsException":
+			output.Code = errorCodeThrottled
+		case "ValidationException", "ResourceNotFoundException":
+			output.Code = errorCodeConfiguration
+		default:
+			if errors.As(err, &responseErr) {
+				output.Code = classifyStatusCode(responseErr.HTTPStatusCode())
+			}
+		}
+	// Errors that occurred while sending the request are wrapped in a
+	// ResponseError as well (without a status code), so they're checked first.
+	// net.Error isn't used, since system call errors (such as for files that
+	// don't exist) implement it as well.
+	case errors.As(err, &sendErr), errors.As(err, &opErr), errors.As(err, &dnsErr):
+		output.Code = errorCodeNetwork
+	case errors.As(err, &responseErr):
+		output.Code = classifyStatusCode(responseErr.HTTPStatusCode())
+	case errors.Is(err, helper.ErrInvalidArn):
+		output.Code = errorCodeConfiguration
+	case errors.As(err, &certErr) && certErr.Reason == x509.Expired:
+		output.Code = errorCodeCertificateExpired
+	case errors.As(err, &coded):
+		output.Code = coded.code
+	}
+
+	output.Hint = errorHints[output.Code]
+	switch output.Code {
+	case errorCodeNetwork, errorCodeThrottled, errorCodeService, errorCodeClock:
+		output.Retryable = true
+	}
+	return output
+}
+
+// Classifies an error response from Roles Anywhere by its status code
+func classifyStatusCode(statusCode int) string {
+	switch {
+	case statusCode == http.StatusTooManyRequests:
+		return errorCodeThrottled
+	case statusCode == http.StatusForbidden || statusCode == http.StatusUnauthorized:
+		return errorCodeAccessDenied
+	case statusCode >= 500:
+		return errorCodeService
+	case statusCode >= 400:
+		return errorCodeConfiguration
+	}
+	return errorCodeUnknown
+}
+
+// Reports the error on stderr, in the format selected through --error-format,
+// and exits with the exit code of its class
+func exitWithError(err error) {
+	output := classifyError(err)
+	if errorFormat.String() == "json" {
+		buf, _ := json.Marshal(output)
+		fmt.Fprintln(os.Stderr, string(buf))
+	} else {
+		helper.LogError(err)
+	}
+	exit(exitCodes[output.Code])
+}
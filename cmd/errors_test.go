@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"syscall"
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+func TestClassifyError(t *testing.T) {
+	responseError := func(statusCode int, err error) error {
+		return &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{Response: &http.Response{StatusCode: statusCode}},
+			Err:      err,
+		}
+	}
+
+	testTable := []struct {
+		err       error
+		code      string
+		retryable bool
+	}{
+		{responseError(403, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "Untrusted signing certificate"}), errorCodeAccessDenied, false},
+		{responseError(403, &smithy.GenericAPIError{Code: "AccessDeniedException", Message: "Certificate expired"}), errorCodeCertificateExpired, false},
+		{responseError(429, &smithy.GenericAPIError{Code: "ThrottlingException"}), errorCodeThrottled, true},
+		{responseError(503, &smithy.GenericAPIError{Code: "InternalServerException"}), errorCodeService, true},
+		{responseError(0, &smithyhttp.RequestSendError{Err: errors.New("connection refused")}), errorCodeNetwork, true},
+		{fmt.Errorf("%w: trust anchor and profile regions don't match", helper.ErrInvalidArn), errorCodeConfiguration, false},
+		{x509.CertificateInvalidError{Reason: x509.Expired}, errorCodeCertificateExpired, false},
+		{withErrorCode(errorCodeIdentity, errors.New("could not parse PEM data")), errorCodeIdentity, false},
+		{&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, errorCodeNetwork, true},
+		{withErrorCode(errorCodeConfiguration, &fs.PathError{Op: "open", Path: "config.yaml", Err: syscall.ENOENT}), errorCodeConfiguration, false},
+		{fmt.Errorf("%w (RSA) for TPM", helper.ErrUnsupportedAlgorithm), errorCodeIdentity, false},
+		{fmt.Errorf("%w: PKCS#11 isn't supported in this build", helper.ErrBackendUnavailable), errorCodeConfiguration, false},
+		{fmt.Errorf("%w (certificate with serial number 2)", helper.ErrKeyCertificateMismatch), errorCodeIdentity, false},
+		{fmt.Errorf("%w: the key usage extension doesn't include digitalSignature", helper.ErrCertificateKeyUsage), errorCodeIdentity, false},
+		{fmt.Errorf("%w: the RSA key has 1024 bits, and at least 2048 are required", helper.ErrWeakKey), errorCodeIdentity, false},
+		{fmt.Errorf("%w: permissions 0644 for key.pem are too open", helper.ErrInsecurePermissions), errorCodeIdentity, false},
+		{fmt.Errorf("%w: the certificate chain doesn't lead to the trust anchor's CA", helper.ErrUntrustedCertificate), errorCodeIdentity, false},
+		{fmt.Errorf("%w: the certificate with serial number 2 was revoked", helper.ErrCertificateRevoked), errorCodeCertificateRevoked, false},
+		{fmt.Errorf("%w: the system clock reads 1970-01-01T00:00:00Z", helper.ErrClockNotSynchronized), errorCodeClock, true},
+		{fmt.Errorf("unable to refresh: %w", helper.ErrThrottled), errorCodeThrottled, true},
+		{errors.New("something else"), errorCodeUnknown, false},
+	}
+
+	for _, testCase := range testTable {
+		output := classifyError(testCase.err)
+		if output.Code != testCase.code || output.Retryable != testCase.retryable {
+			t.Logf("unexpected classification of %q: %+v", testCase.err, output)
+			t.Fail()
+		}
+		if output.Message != testCase.err.Error() {
+			t.Log("unexpected message:", output.Message)
+			t.Fail()
+		}
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	codes := []string{errorCodeConfiguration, errorCodeIdentity, errorCodeCertificateExpired, errorCodeNetwork,
+		errorCodeAccessDenied, errorCodeThrottled, errorCodeService, errorCodeCertificateRevoked, errorCodeClock,
+		errorCodeUnknown}
+	seen := map[int]string{}
+	for _, code := range codes {
+		exitCode, ok := exitCodes[code]
+		if !ok || exitCode == 0 {
+			t.Log("no exit code for", code)
+			t.Fail()
+		}
+		if other, ok := seen[exitCode]; ok {
+			t.Logf("%s and %s have the same exit code", code, other)
+			t.Fail()
+		}
+		seen[exitCode] = code
+	}
+}
@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+var eventLog bool
+
+// Usage of --event-log, which the serve and update commands share
+const eventLogUsage = "Write refreshes, failed refreshes, certificates that expire soon, and the start and stop of the " +
+	"command to the Windows Event Log (with the source " + helper.DefaultEventLogSource + "), with stable event IDs. " +
+	"Only supported on Windows"
+
+// Opens the event log, if --event-log is set, adds its hooks to the
+// credentials options, and records that the command started (and, once it
+// exits, that it stopped)
+func startEventLog(command string) error {
+	if !eventLog {
+		return nil
+	}
+	log, err := helper.OpenEventLog(helper.DefaultEventLogSource)
+	if err != nil {
+		return err
+	}
+	credentialsOptions.Hooks = helper.EventLogHooks(log, credentialsOptions.Hooks)
+	log.ServiceStarted(command)
+	atExit(func() {
+		log.ServiceStopped(command)
+		log.Close()
+	})
+	return nil
+}
@@ -0,0 +1,235 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+// How long the command is given to exit after it's asked to (before it's
+// restarted, or when the credential helper is terminated), before it's
+// killed
+const childStopTimeout = 10 * time.Second
+
+// How long to wait before credentials are requested again, after a refresh
+// failed while the command kept running
+const execRetryInterval = 30 * time.Second
+
+var restartChild bool
+
+// Command that's running, which is stopped if the credential helper exits
+// before it
+var execChild struct {
+	sync.Mutex
+	child *childProcess
+}
+
+// Environment variables that the credentials replace in the environment of
+// the command, along with those of secret flags
+var credentialEnvVars = []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN",
+	"AWS_CREDENTIAL_EXPIRATION"}
+
+func init() {
+	initCredentialsSubCommand(execCmd)
+	addIdentityProfileFlag(execCmd)
+	execCmd.PersistentFlags().BoolVar(&restartChild, "restart", false, "Restart the command with new credentials "+
+		"five minutes before its credentials expire (it's sent SIGTERM, and killed if it doesn't exit within 10 "+
+		"seconds). Otherwise, the command is run once")
+}
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] -- command [args...]",
+	Short: "Runs a command with AWS credentials in its environment",
+	Long: `Obtains credentials and runs the command with them in its environment, as
+AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, AWS_SESSION_TOKEN, and
+AWS_CREDENTIAL_EXPIRATION (along with AWS_REGION and AWS_DEFAULT_REGION, unless
+they're set already), for tools that only read credentials from environment
+variables. Signals that terminate the credential helper are forwarded to the
+command, and the credential helper exits with the exit code of the command.
+With --restart, the command is restarted with new credentials before its
+credentials expire. For example:
+
+  aws_signing_helper exec --config /etc/rolesanywhere/config.yaml --identity-profile backup -- restic backup /srv`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		helper.Debug = credentialsOptions.Debug
+		helper.Preload(&credentialsOptions)
+		signer, signingAlgorithm, err := helper.GetSigner(&credentialsOptions)
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeIdentity, err))
+		}
+		defer signer.Close()
+		output, err := helper.GenerateCredentials(&credentialsOptions, signer, signingAlgorithm)
+		if err != nil {
+			exitWithError(err)
+		}
+
+		atExit(func() {
+			execChild.Lock()
+			child := execChild.child
+			execChild.Unlock()
+			if child != nil {
+				child.stop()
+			}
+		})
+		for {
+			child, err := startChild(args, childEnvironment(os.Environ(), output, credentialsOptions.Region))
+			if err != nil {
+				exitWithError(withErrorCode(errorCodeConfiguration, err))
+			}
+			if !restartChild {
+				exit(child.wait())
+			}
+			output, err = refreshBeforeExpiry(child, output, signer, signingAlgorithm)
+			if err != nil {
+				// The command exited by itself
+				exit(child.wait())
+			}
+			helper.LogInfof("restarting %s with new credentials", args[0])
+			child.stop()
+		}
+	},
+}
+
+// Returns the environment with the credentials (replacing any that it had),
+// and the region, unless it's set already. Variables of secret flags (such
+// as key passwords) are left out.
+func childEnvironment(environ []string, output helper.CredentialProcessOutput, region string) []string {
+	removed := map[string]bool{}
+	for _, name := range credentialEnvVars {
+		removed[name] = true
+	}
+	for name := range secretFlags {
+		removed[flagEnvVarName(name)] = true
+	}
+
+	var env []string
+	hasRegion := map[string]bool{}
+	for _, variable := range environ {
+		name, _, _ := strings.Cut(variable, "=")
+		if removed[strings.ToUpper(name)] {
+			continue
+		}
+		if name == "AWS_REGION" || name == "AWS_DEFAULT_REGION" {
+			hasRegion[name] = true
+		}
+		env = append(env, variable)
+	}
+	env = append(env, "AWS_ACCESS_KEY_ID="+output.AccessKeyId, "AWS_SECRET_ACCESS_KEY="+output.SecretAccessKey,
+		"AWS_SESSION_TOKEN="+output.SessionToken, "AWS_CREDENTIAL_EXPIRATION="+output.Expiration)
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region != "" && !hasRegion[name] {
+			env = append(env, name+"="+region)
+		}
+	}
+	return env
+}
+
+// Command that's run with credentials
+type childProcess struct {
+	cmd      *exec.Cmd
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// Starts the command, with the standard streams of the credential helper.
+// Interrupts and terminations are forwarded to it.
+func startChild(args []string, env []string) (*childProcess, error) {
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("unable to run %s: %w", args[0], err)
+	}
+	child := &childProcess{cmd: cmd, done: make(chan struct{})}
+	go func() {
+		cmd.Wait()
+		close(child.done)
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		defer signal.Stop(signals)
+		select {
+		case sig := <-signals:
+			cmd.Process.Signal(sig)
+		case <-child.done:
+		}
+	}()
+	execChild.Lock()
+	execChild.child = child
+	execChild.Unlock()
+	return child, nil
+}
+
+// Waits for the command to exit, and returns its exit code
+func (child *childProcess) wait() int {
+	<-child.done
+	if code := child.cmd.ProcessState.ExitCode(); code >= 0 {
+		return code
+	}
+	// The command was terminated by a signal
+	return 1
+}
+
+// Asks the command to exit (with SIGTERM, where there are signals), and kills
+// it if it doesn't within childStopTimeout
+func (child *childProcess) stop() {
+	child.stopOnce.Do(func() {
+		select {
+		case <-child.done:
+			return
+		default:
+		}
+		if err := child.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+			child.cmd.Process.Kill()
+		}
+		select {
+		case <-child.done:
+		case <-time.After(childStopTimeout):
+			child.cmd.Process.Kill()
+			<-child.done
+		}
+	})
+}
+
+// Waits until the credentials are due to be refreshed, and obtains new ones
+// (retrying failures, while the command keeps running with the credentials
+// that it has). It returns an error if the command exits first.
+func refreshBeforeExpiry(child *childProcess, output helper.CredentialProcessOutput, signer helper.Signer, signingAlgorithm string) (helper.CredentialProcessOutput, error) {
+	expiration, err := time.Parse(time.RFC3339, output.Expiration)
+	if err != nil {
+		return output, err
+	}
+	refreshTime := expiration.Add(-helper.UpdateRefreshTime)
+	for {
+		timer := time.NewTimer(time.Until(refreshTime))
+		select {
+		case <-child.done:
+			timer.Stop()
+			return output, errors.New("the command exited")
+		case <-timer.C:
+		}
+		refreshed, err := helper.GenerateCredentials(&credentialsOptions, signer, signingAlgorithm)
+		if err == nil {
+			return refreshed, nil
+		}
+		helper.LogWarnf("unable to refresh the credentials of the command (retrying in %s): %s", execRetryInterval, err)
+		refreshTime = time.Now().Add(execRetryInterval)
+	}
+}
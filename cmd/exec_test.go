@@ -0,0 +1,41 @@
+package cmd
+
+import (
+	"reflect"
+	"runtime"
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+func TestExecEnvironment(t *testing.T) {
+	output := helper.CredentialProcessOutput{AccessKeyId: "accessKeyId", SecretAccessKey: "secretAccessKey",
+		SessionToken: "sessionToken", Expiration: "2022-07-27T04:36:55Z"}
+	env := childEnvironment([]string{"PATH=/usr/bin", "AWS_ACCESS_KEY_ID=stale", "AWS_REGION=eu-west-1",
+		"AWS_ROLESANYWHERE_KEY_PASSWORD=hunter22"}, output, "us-east-1")
+	expected := []string{"PATH=/usr/bin", "AWS_REGION=eu-west-1", "AWS_ACCESS_KEY_ID=accessKeyId",
+		"AWS_SECRET_ACCESS_KEY=secretAccessKey", "AWS_SESSION_TOKEN=sessionToken",
+		"AWS_CREDENTIAL_EXPIRATION=2022-07-27T04:36:55Z", "AWS_DEFAULT_REGION=us-east-1"}
+	if !reflect.DeepEqual(env, expected) {
+		t.Errorf("unexpected environment: %v", env)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	child, err := startChild([]string{"sh", "-c", `test "$AWS_SESSION_TOKEN" = sessionToken && exit 3`}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if code := child.wait(); code != 3 {
+		t.Errorf("unexpected exit code: %d", code)
+	}
+	child, err = startChild([]string{"sleep", "60"}, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	child.stop()
+	if code := child.wait(); code != 1 {
+		t.Errorf("unexpected exit code of a terminated command: %d", code)
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Functions that are run before the process exits (see atExit)
+var exitHandlers struct {
+	sync.Mutex
+	handlers []func()
+}
+
+// Registers the function to be run before the process exits, whether the
+// command returns, fails, or is terminated by a signal
+func atExit(f func()) {
+	exitHandlers.Lock()
+	defer exitHandlers.Unlock()
+	exitHandlers.handlers = append(exitHandlers.handlers, f)
+}
+
+// Runs the functions that were registered with atExit, in reverse order,
+// once
+func runExitHandlers() {
+	exitHandlers.Lock()
+	handlers := exitHandlers.handlers
+	exitHandlers.handlers = nil
+	exitHandlers.Unlock()
+	for i := len(handlers) - 1; i >= 0; i-- {
+		handlers[i]()
+	}
+}
+
+// Zeroizes private key material that's kept in memory, runs the exit
+// handlers, exports the spans that haven't been exported yet, and exits
+// with the exit code
+func exit(code int) {
+	helper.ZeroizeSecrets()
+	runExitHandlers()
+	flushTraces()
+	os.Exit(code)
+}
+
+// Zeroizes private key material (and runs the exit handlers) when the
+// process is interrupted or terminated (as long-running commands such as
+// serve and update are), and then terminates it as the signal would have
+func handleExitSignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		helper.ZeroizeSecrets()
+		runExitHandlers()
+		signal.Reset(os.Interrupt, syscall.SIGTERM)
+		if process, err := os.FindProcess(os.Getpid()); err == nil && process.Signal(sig) == nil {
+			// The signal is delivered asynchronously
+			time.Sleep(time.Second)
+		}
+		os.Exit(1)
+	}()
+}
@@ -0,0 +1,24 @@
+package cmd
+
+import (
+	"errors"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+var requireFIPS bool
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&requireFIPS, "require-fips", false, "Fail unless a FIPS 140-validated "+
+		"cryptographic module is in use (see make release-fips, or GODEBUG=fips140=on)")
+}
+
+// Fails if FIPS mode is required, but no FIPS 140-validated cryptographic
+// module is in use
+func checkRequireFIPS() error {
+	if requireFIPS && !helper.FIPSEnabled() {
+		return errors.New("FIPS mode is required, but no FIPS 140-validated cryptographic module is in use " +
+			"(build the credential helper with make release-fips, or set GODEBUG=fips140=on)")
+	}
+	return nil
+}
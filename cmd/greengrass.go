@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Component of Greengrass that provides keys and certificates that are
+// stored in PKCS#11 modules (such as HSMs)
+const greengrassPkcs11Provider = "aws.greengrass.crypto.Pkcs11Provider"
+
+// Parts of the effective configuration of a Greengrass (v2) core device that
+// identify its certificate and private key
+type greengrassConfig struct {
+	System struct {
+		CertificateFilePath string `yaml:"certificateFilePath"`
+		PrivateKeyPath      string `yaml:"privateKeyPath"`
+		RootPath            string `yaml:"rootpath"`
+	} `yaml:"system"`
+	Services map[string]struct {
+		Configuration struct {
+			Library string `yaml:"library"`
+			Slot    *int   `yaml:"slot"`
+			UserPin string `yaml:"userPin"`
+		} `yaml:"configuration"`
+	} `yaml:"services"`
+}
+
+// Certificate and private key of a Greengrass core device, as the
+// certificate and private-key flags would select them, along with the
+// PKCS#11 module they're stored in (if they are)
+type greengrassIdentity struct {
+	certificate string
+	privateKey  string
+	pkcs11Lib   string
+}
+
+// Reads the certificate and private key of the Greengrass core device from
+// config/effectiveConfig.yaml under its root directory (such as
+// /greengrass/v2). They're files, or objects of the PKCS#11 module of the
+// PKCS#11 provider component, whose slot and user PIN are added to their
+// URIs.
+func readGreengrassIdentity(root string) (greengrassIdentity, error) {
+	path := filepath.Join(root, "config", "effectiveConfig.yaml")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return greengrassIdentity{}, fmt.Errorf("%s has no Greengrass (v2) configuration at %s", root, path)
+		}
+		return greengrassIdentity{}, err
+	}
+	var config greengrassConfig
+	if err = yaml.Unmarshal(data, &config); err != nil {
+		return greengrassIdentity{}, fmt.Errorf("invalid Greengrass configuration %s: %w", path, err)
+	}
+	if config.System.CertificateFilePath == "" || config.System.PrivateKeyPath == "" {
+		return greengrassIdentity{}, fmt.Errorf("the Greengrass configuration %s has no certificateFilePath or "+
+			"privateKeyPath", path)
+	}
+	if config.System.RootPath != "" {
+		root = config.System.RootPath
+	}
+
+	provider := config.Services[greengrassPkcs11Provider].Configuration
+	var identity greengrassIdentity
+	for _, location := range []struct {
+		value  string
+		result *string
+	}{
+		{config.System.CertificateFilePath, &identity.certificate},
+		{config.System.PrivateKeyPath, &identity.privateKey},
+	} {
+		value := location.value
+		switch {
+		case strings.HasPrefix(value, "pkcs11:"):
+			if provider.Library == "" {
+				return greengrassIdentity{}, fmt.Errorf("the Greengrass configuration %s has PKCS#11 URIs, but no "+
+					"library in the configuration of %s", path, greengrassPkcs11Provider)
+			}
+			identity.pkcs11Lib = provider.Library
+			value = greengrassPkcs11URI(value, provider.Slot, provider.UserPin)
+		case strings.HasPrefix(value, "file://"):
+			parsed, err := url.Parse(value)
+			if err != nil {
+				return greengrassIdentity{}, fmt.Errorf("invalid path %s in the Greengrass configuration %s: %w", value,
+					path, err)
+			}
+			value = parsed.Path
+		case !filepath.IsAbs(value):
+			value = filepath.Join(root, value)
+		}
+		*location.result = value
+	}
+	return identity, nil
+}
+
+// Adds the slot and the user PIN of the PKCS#11 provider to the URI of an
+// object, unless it has them already
+func greengrassPkcs11URI(uri string, slot *int, userPin string) string {
+	path, query, _ := strings.Cut(strings.TrimPrefix(uri, "pkcs11:"), "?")
+	attributes := func(s, separator string) map[string]bool {
+		names := map[string]bool{}
+		for _, attribute := range strings.Split(s, separator) {
+			name, _, _ := strings.Cut(attribute, "=")
+			names[name] = true
+		}
+		return names
+	}
+	if slot != nil && !attributes(path, ";")["slot-id"] {
+		if path != "" {
+			path += ";"
+		}
+		path += fmt.Sprintf("slot-id=%d", *slot)
+	}
+	if userPin != "" && !attributes(query, "&")["pin-value"] {
+		if query != "" {
+			query += "&"
+		}
+		query += "pin-value=" + url.PathEscape(userPin)
+	}
+	uri = "pkcs11:" + path
+	if query != "" {
+		uri += "?" + query
+	}
+	return uri
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGreengrassIdentity(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	configs := []struct {
+		config   string
+		expected greengrassIdentity
+	}{
+		{"system:\n  certificateFilePath: \"" + filepath.ToSlash(filepath.Join(root, "thingCert.crt")) + "\"\n" +
+			"  privateKeyPath: \"privKey.key\"\n  rootpath: \"" + filepath.ToSlash(root) + "\"\n  thingName: \"core\"\n",
+			greengrassIdentity{certificate: filepath.Join(root, "thingCert.crt"), privateKey: filepath.Join(root, "privKey.key")}},
+		{"services:\n  aws.greengrass.crypto.Pkcs11Provider:\n    configuration:\n      name: \"softhsm\"\n" +
+			"      library: \"/usr/lib/softhsm/libsofthsm2.so\"\n      slot: 1\n      userPin: \"12 34\"\n" +
+			"system:\n  certificateFilePath: \"pkcs11:object=greengrass;type=cert\"\n" +
+			"  privateKeyPath: \"pkcs11:object=greengrass;type=private?pin-value=5678\"\n",
+			greengrassIdentity{certificate: "pkcs11:object=greengrass;type=cert;slot-id=1?pin-value=12%2034",
+				privateKey: "pkcs11:object=greengrass;type=private;slot-id=1?pin-value=5678",
+				pkcs11Lib:  "/usr/lib/softhsm/libsofthsm2.so"}},
+	}
+	for _, c := range configs {
+		if err := os.WriteFile(filepath.Join(root, "config", "effectiveConfig.yaml"), []byte(c.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		identity, err := readGreengrassIdentity(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if identity != c.expected {
+			t.Errorf("unexpected identity: %+v", identity)
+		}
+	}
+
+	if _, err := readGreengrassIdentity(t.TempDir()); err == nil || !strings.Contains(err.Error(), "no Greengrass (v2) configuration") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
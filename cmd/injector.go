@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+// How long in-flight AdmissionReviews are given to complete once the
+// injector is terminated
+const injectorShutdownTimeout = 10 * time.Second
+
+var (
+	injectorOptions     helper.PodInjectorOptions
+	injectorListen      string
+	injectorTLSCertFile string
+	injectorTLSKeyFile  string
+	injectorDebug       bool
+)
+
+func init() {
+	flags := injectorCmd.PersistentFlags()
+	flags.StringVar(&injectorListen, "listen", ":8443", "Address that the webhook listens on")
+	flags.StringVar(&injectorTLSCertFile, "tls-cert-file", "", "Certificate (followed by its intermediates) that the "+
+		"webhook serves, which is read again whenever it changes (such as when cert-manager renews it)")
+	flags.StringVar(&injectorTLSKeyFile, "tls-key-file", "", "Private key of --tls-cert-file")
+	flags.StringVar(&injectorOptions.Image, "image", "", "Image of the sidecar, whose entry point is aws_signing_helper")
+	flags.StringVar(&injectorOptions.TrustAnchorArn, "trust-anchor-arn", "", "Trust anchor of the pods that don't "+
+		"annotate their own")
+	flags.StringVar(&injectorOptions.ProfileArn, "profile-arn", "", "Profile of the pods that don't annotate their own")
+	flags.StringVar(&injectorOptions.RoleArn, "role-arn", "", "Role of the pods that don't annotate their own")
+	flags.StringVar(&injectorOptions.CSIIssuer, "csi-issuer", "", "Issuer of cert-manager's CSI driver that issues "+
+		"the certificates of the pods that don't annotate their identity")
+	flags.StringVar(&injectorOptions.CSIIssuerKind, "csi-issuer-kind", "Issuer", "Kind of --csi-issuer (Issuer or "+
+		"ClusterIssuer)")
+	flags.IntVar(&injectorOptions.Port, "sidecar-port", helper.DefaultPort, "Port of the local endpoint of the sidecar")
+	flags.BoolVar(&injectorDebug, "debug", false, "To print debug output")
+	injectorCmd.MarkPersistentFlagRequired("tls-cert-file")
+	injectorCmd.MarkPersistentFlagRequired("tls-key-file")
+	injectorCmd.MarkPersistentFlagRequired("image")
+}
+
+var injectorCmd = &cobra.Command{
+	Use:   "rolesanywhere_injector [flags]",
+	Short: "Mutating admission webhook that injects the credential helper sidecar into pods",
+	Long: `Injects the sidecar into the pods that are annotated with
+rolesanywhere.amazonaws.com/inject: "true", along with the environment
+variables (AWS_CONTAINER_CREDENTIALS_FULL_URI and
+AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE) and volumes that let their containers
+obtain credentials from it. AdmissionReviews are served on /mutate over TLS,
+and /healthz responds once the webhook is listening.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		helper.Debug = injectorDebug
+		injector, err := helper.NewPodInjector(injectorOptions)
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		certificate := &reloadingCertificate{certFile: injectorTLSCertFile, keyFile: injectorTLSKeyFile}
+		if _, err = certificate.get(nil); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		mux := http.NewServeMux()
+		mux.Handle("/mutate", injector)
+		mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		})
+		server := &http.Server{
+			Addr:              injectorListen,
+			Handler:           mux,
+			TLSConfig:         &tls.Config{MinVersion: tls.VersionTLS12, GetCertificate: certificate.get},
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		stop := make(chan os.Signal, 1)
+		signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+		go func() {
+			<-stop
+			ctx, cancel := context.WithTimeout(context.Background(), injectorShutdownTimeout)
+			defer cancel()
+			server.Shutdown(ctx)
+		}()
+
+		helper.LogInfof("the webhook is listening on %s", injectorListen)
+		if err = server.ListenAndServeTLS("", ""); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			exitWithError(err)
+		}
+	},
+}
+
+// Runs the injector, as the rolesanywhere_injector binary
+func ExecuteInjector() {
+	defer helper.RedactPanic()
+	if err := injectorCmd.Execute(); err != nil {
+		exitWithError(withErrorCode(errorCodeConfiguration, err))
+	}
+}
+
+// Certificate of the webhook, which is read again once its files change
+type reloadingCertificate struct {
+	certFile, keyFile string
+
+	mu          sync.Mutex
+	certificate *tls.Certificate
+	modTimes    [2]time.Time
+}
+
+func (reloading *reloadingCertificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	var modTimes [2]time.Time
+	var err error
+	for i, path := range []string{reloading.certFile, reloading.keyFile} {
+		var info os.FileInfo
+		if info, err = os.Stat(path); err != nil {
+			break
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	reloading.mu.Lock()
+	defer reloading.mu.Unlock()
+	if reloading.certificate != nil && modTimes == reloading.modTimes {
+		return reloading.certificate, nil
+	}
+	var certificate tls.Certificate
+	if err == nil {
+		certificate, err = tls.LoadX509KeyPair(reloading.certFile, reloading.keyFile)
+	}
+	if err != nil {
+		if reloading.certificate != nil {
+			// The files may be replaced one after the other
+			helper.LogWarnf("unable to reload the certificate of the webhook: %s", err)
+			return reloading.certificate, nil
+		}
+		return nil, fmt.Errorf("unable to load the certificate of the webhook: %w", err)
+	}
+	if reloading.certificate != nil {
+		helper.LogInfof("reloaded the certificate of the webhook")
+	}
+	reloading.certificate = &certificate
+	reloading.modTimes = modTimes
+	return reloading.certificate, nil
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	logLevel           *enum
+	logFormat          *enum
+	logTarget          *enum
+	logFile            string
+	quiet              bool
+	componentLogLevels []string
+)
+
+func init() {
+	logLevel = newEnum(helper.LogLevelNames(), "info")
+	rootCmd.PersistentFlags().Var(logLevel, "log-level", "Minimum level of the messages that are logged to stderr. One of "+
+		"debug, info, warn, and error. --debug implies debug")
+	logFormat = newEnum([]string{helper.LogFormatText, helper.LogFormatJSON}, helper.LogFormatText)
+	rootCmd.PersistentFlags().Var(logFormat, "log-format", "Format of the messages that are logged to stderr. One of "+
+		"text and json (one JSON object per line, with the time, level, message, role ARN, certificate fingerprint, and "+
+		"request ID)")
+	logTarget = newEnum(helper.LogTargetNames(), helper.LogTargetStderr)
+	rootCmd.PersistentFlags().Var(logTarget, "log-target", "Destination of log messages. One of stderr, file (the "+
+		"file of --log-file, which is appended to), syslog (the local syslog daemon, in the daemon facility), and "+
+		"journald (the systemd journal, with the role ARN, certificate fingerprint, and request ID as fields)")
+	rootCmd.PersistentFlags().StringVar(&logFile, "log-file", "", "File that log messages are appended to, with "+
+		"--log-target file")
+	rootCmd.PersistentFlags().StringSliceVar(&componentLogLevels, "component-log-level", nil, "Minimum level of the "+
+		"messages of a component, as component=level, which takes precedence over --log-level and --quiet. The "+
+		"components are signer, transport, cache, and server (for example, --component-log-level transport=debug). Can "+
+		"be repeated")
+	rootCmd.PersistentFlags().BoolVar(&quiet, "quiet", false, "Only log errors, which is the same as --log-level error")
+}
+
+// Applies the log level that was selected through --log-level or --quiet (and
+// those of components, through --component-log-level), the format that was
+// selected through --log-format, and the destination that was selected
+// through --log-target
+func applyLogLevel(cmd *cobra.Command) error {
+	if err := helper.SetLogFormat(logFormat.String()); err != nil {
+		return err
+	}
+	if cmd.Flags().Changed("log-target") || logFile != "" {
+		if err := helper.SetLogTarget(logTarget.String(), logFile); err != nil {
+			return err
+		}
+	}
+	if quiet && cmd.Flags().Changed("log-level") && logLevel.String() != "error" {
+		return errors.New("--quiet can't be combined with a --log-level other than error")
+	}
+	level, err := helper.ParseLogLevel(logLevel.String())
+	if err != nil {
+		return err
+	}
+	if quiet {
+		level = helper.LogLevelError
+	}
+	helper.SetLogLevel(level)
+
+	for _, componentLevel := range componentLogLevels {
+		component, name, ok := strings.Cut(componentLevel, "=")
+		if !ok {
+			return fmt.Errorf("invalid component log level %s; must be of the form component=level", componentLevel)
+		}
+		level, err := helper.ParseLogLevel(name)
+		if err != nil {
+			return err
+		}
+		if err = helper.SetComponentLogLevel(component, level); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Flags whose values are masked when the configuration is printed
+var secretFlags = map[string]bool{
+	"key-password":      true,
+	"tpm-key-password":  true,
+	"acme-eab-hmac-key": true,
+}
+
+// Setting of a command, along with where its value came from
+type configEntry struct {
+	name   string
+	value  string
+	source string
+}
+
+func init() {
+	rootCmd.AddCommand(printConfigCmd)
+}
+
+var printConfigCmd = &cobra.Command{
+	Use:   "print-config [command] [flags]",
+	Short: "Prints the effective configuration of a command",
+	Long: `Prints the value of each flag of a command (credential-process, if no command is
+specified), after merging the configuration file, environment variables, and
+flags that are passed, along with where the value came from. Passwords are
+masked. For example:
+
+  aws_signing_helper print-config serve --config /etc/rolesanywhere/config.yaml --identity-profile edge-router`,
+	DisableFlagParsing: true,
+	// The configuration is loaded for the command whose configuration is
+	// printed instead
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+	Run: func(cmd *cobra.Command, args []string) {
+		target, targetArgs, err := rootCmd.Find(args)
+		if err == nil && target == rootCmd {
+			target, targetArgs, err = rootCmd.Find(append([]string{credentialProcessCmd.Name()}, args...))
+		}
+		if err == nil && target == cmd {
+			err = errors.New("the configuration of print-config can't be printed")
+		}
+		if err == nil {
+			err = target.ParseFlags(targetArgs)
+		}
+		if errors.Is(err, pflag.ErrHelp) {
+			cmd.Help()
+			return
+		}
+		if err == nil {
+			err = loadConfiguration(target)
+		}
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		entries, err := describeConfiguration(target)
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		fmt.Printf("Effective configuration of the %s command:\n\n", target.Name())
+		writeConfiguration(os.Stdout, entries)
+	},
+}
+
+// Writes the configuration as a table
+func writeConfiguration(out io.Writer, entries []configEntry) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FLAG\tVALUE\tSOURCE")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", entry.name, entry.value, entry.source)
+	}
+	w.Flush()
+}
+
+// Describes the value of each flag of the command, once its configuration has
+// been loaded
+func describeConfiguration(cmd *cobra.Command) ([]configEntry, error) {
+	var sections map[string]string
+	if configFilePath != "" {
+		var err error
+		if _, sections, err = readConfigFileSections(configFilePath, cmd, identityProfile); err != nil {
+			return nil, err
+		}
+	}
+
+	var entries []configEntry
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		if f.Name == "help" {
+			return
+		}
+		entry := configEntry{name: f.Name, value: f.Value.String(), source: "default"}
+		if secretFlags[f.Name] && entry.value != "" {
+			entry.value = "********"
+		}
+		switch {
+		case isSetFromConfigFile(f):
+			entry.source = "configuration file " + configFilePath
+			if section, ok := sections[f.Name]; ok {
+				entry.source += " (" + section + ")"
+			}
+		case len(f.Annotations[environmentAnnotation]) > 0:
+			entry.source = "environment variable " + f.Annotations[environmentAnnotation][0]
+		case len(f.Annotations[awsProfileAnnotation]) > 0:
+			entry.source = awsProfileSource(f.Annotations[awsProfileAnnotation][0])
+		case f.Changed:
+			entry.source = "command line"
+		}
+		entries = append(entries, entry)
+	})
+	return entries, nil
+}
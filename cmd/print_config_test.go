@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestDescribeConfiguration(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	configContents := `region: us-west-2
+credential-process:
+  session-duration: 900
+identities:
+  edge-router:
+    key-password: secret
+`
+	if err := os.WriteFile(configPath, []byte(configContents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AWS_ROLESANYWHERE_ROLE_ARN", "arn:aws:iam::000000000000:role/env")
+
+	testCmd := &cobra.Command{Use: "credential-process"}
+	for _, name := range []string{"region", "role-arn", "key-password", "trust-anchor-arn", "endpoint"} {
+		testCmd.Flags().String(name, "", "")
+	}
+	testCmd.Flags().Int("session-duration", 3600, "")
+	if err := testCmd.Flags().Parse([]string{"--trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag"}); err != nil {
+		t.Fatal(err)
+	}
+
+	configFilePath = configPath
+	identityProfile = "edge-router"
+	defer func() { configFilePath, identityProfile = "", "" }()
+	if err := loadConfiguration(testCmd); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := describeConfiguration(testCmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEntries := []configEntry{
+		{"endpoint", "", "default"},
+		{"key-password", "********", "configuration file " + configPath + " (identity profile edge-router)"},
+		{"region", "us-west-2", "configuration file " + configPath + " (top level)"},
+		{"role-arn", "arn:aws:iam::000000000000:role/env", "environment variable AWS_ROLESANYWHERE_ROLE_ARN"},
+		{"session-duration", "900", "configuration file " + configPath + " (credential-process section)"},
+		{"trust-anchor-arn", "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/flag", "command line"},
+	}
+	if !reflect.DeepEqual(entries, expectedEntries) {
+		t.Logf("unexpected configuration: %+v", entries)
+		t.Fail()
+	}
+}
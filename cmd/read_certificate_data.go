@@ -4,9 +4,8 @@ import (
 	"crypto/sha1"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
 	"strings"
 
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
@@ -50,8 +49,7 @@ var readCertificateDataCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		certIdentifier, err := PopulateCertIdentifier(certSelector, systemStoreName)
 		if err != nil {
-			log.Println("unable to populate CertIdentifier")
-			os.Exit(1)
+			exitWithError(errors.New("unable to populate CertIdentifier"))
 		}
 
 		var certContainers []helper.CertificateContainer
@@ -64,29 +62,25 @@ var readCertificateDataCmd = &cobra.Command{
 		if strings.HasPrefix(certificateId, "pkcs11:") {
 			certContainers, err = helper.GetMatchingPKCSCerts(certificateId, libPkcs11)
 			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 		} else if certificateId != "" {
 			data, _, err := helper.ReadCertificateData(certificateId)
 			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 			buf, err := json.Marshal(data)
 			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 
 			fmt.Print(string(buf[:]))
 			// Exit after printing out the certificate data
-			os.Exit(0)
+			exit(0)
 		} else {
 			certContainers, err = helper.GetMatchingCerts(certIdentifier)
 			if err != nil {
-				log.Println(err)
-				os.Exit(1)
+				exitWithError(err)
 			}
 		}
 		if len(certContainers) == 0 {
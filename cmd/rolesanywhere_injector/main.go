@@ -0,0 +1,9 @@
+package main
+
+import (
+	"github.com/aws/rolesanywhere-credential-helper/cmd"
+)
+
+func main() {
+	cmd.ExecuteInjector()
+}
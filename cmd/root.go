@@ -1,9 +1,10 @@
 package cmd
 
 import (
-	"github.com/spf13/cobra"
-	"log"
 	"os"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
 )
 
 var rootCmd = &cobra.Command{
@@ -19,8 +20,17 @@ retrieval and rotation more convenient.`,
 }
 
 func Execute() {
+	defer helper.RedactPanic()
+	handleExitSignals()
+	startWindowsService()
+	registerFlagCompletions(rootCmd)
+	if args := dockerCredentialHelperArgs(os.Args); args != nil {
+		rootCmd.SetArgs(args)
+	}
 	if err := rootCmd.Execute(); err != nil {
-		log.Println(err)
-		os.Exit(1)
+		exitWithError(withErrorCode(errorCodeConfiguration, err))
 	}
+	helper.ZeroizeSecrets()
+	runExitHandlers()
+	flushTraces()
 }
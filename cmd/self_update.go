@@ -0,0 +1,358 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	defaultReleaseURL = "https://rolesanywhere.amazonaws.com/releases"
+	latestReleaseURL  = "https://api.github.com/repos/aws/rolesanywhere-credential-helper/releases/latest"
+	// Upper bound on the size of downloaded files, so that a misbehaving
+	// server can't exhaust memory
+	maxReleaseFileSize = 256 << 20
+)
+
+var (
+	// Base64-encoded (DER, PKIX) public key that release binaries are signed
+	// with. It's set at build time.
+	ReleaseSigningKey string
+
+	selfUpdateVersion         string
+	releaseURL                string
+	releasePublicKeyFile      string
+	skipSignatureVerification bool
+	forceSelfUpdate           bool
+)
+
+// Names of the platforms in release URLs
+var (
+	releaseOSNames   = map[string]string{"linux": "Linux", "darwin": "Darwin", "windows": "Windows"}
+	releaseArchNames = map[string]string{"amd64": "X86_64", "arm64": "Aarch64"}
+)
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+	selfUpdateCmd.PersistentFlags().StringVar(&selfUpdateVersion, "version", "", "Version to install (for example, 1.4.0). "+
+		"Defaults to the latest release")
+	selfUpdateCmd.PersistentFlags().StringVar(&releaseURL, "release-url", defaultReleaseURL, "Base URL that releases are "+
+		"downloaded from, for mirrors. The latest version is read from <release-url>/latest for URLs other than the default")
+	selfUpdateCmd.PersistentFlags().StringVar(&releasePublicKeyFile, "public-key", "", "File that contains the public key "+
+		"(PEM or base64-encoded DER) that releases are signed with, instead of the key that's built in")
+	selfUpdateCmd.PersistentFlags().BoolVar(&skipSignatureVerification, "skip-signature-verification", false, "To only "+
+		"verify the checksum of the release, and not its signature")
+	selfUpdateCmd.PersistentFlags().BoolVar(&forceSelfUpdate, "force", false, "To install the release even if it's the "+
+		"version that's already installed")
+}
+
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update [flags]",
+	Short: "Replaces the credential helper with the latest release",
+	Long: `Downloads a release of the credential helper for the current platform
+(the latest one, unless --version is specified), verifies its SHA-256 checksum
+and detached signature, checks that it runs, and atomically replaces the
+running binary with it.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		var publicKey crypto.PublicKey
+		if !skipSignatureVerification {
+			var err error
+			if publicKey, err = readReleaseSigningKey(); err != nil {
+				exitWithError(withErrorCode(errorCodeConfiguration, err))
+			}
+		}
+		executable, err := os.Executable()
+		if err == nil {
+			executable, err = filepath.EvalSymlinks(executable)
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to determine the path to the credential helper: %w", err))
+		}
+
+		client := &http.Client{Timeout: 5 * time.Minute}
+		version := selfUpdateVersion
+		if version == "" {
+			if version, err = fetchLatestVersion(client, releaseURL); err != nil {
+				exitWithError(err)
+			}
+			if !forceSelfUpdate && Version != "" && compareVersions(version, Version) <= 0 {
+				fmt.Printf("The credential helper is up to date (version %s)\n", Version)
+				return
+			}
+		} else if !forceSelfUpdate && version == Version {
+			fmt.Printf("Version %s of the credential helper is already installed\n", Version)
+			return
+		}
+
+		binaryURL, err := releaseBinaryURL(releaseURL, version, runtime.GOOS, runtime.GOARCH)
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		binary, err := downloadRelease(client, binaryURL, publicKey)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err = replaceExecutable(executable, binary, version); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Updated the credential helper at %s to version %s\n", executable, version)
+	},
+}
+
+// Reads the public key that releases are signed with, from --public-key if
+// it's specified, and otherwise from the key that's built in
+func readReleaseSigningKey() (crypto.PublicKey, error) {
+	data := []byte(ReleaseSigningKey)
+	if releasePublicKeyFile != "" {
+		var err error
+		if data, err = os.ReadFile(releasePublicKeyFile); err != nil {
+			return nil, fmt.Errorf("unable to read the release signing key: %w", err)
+		}
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.New("no release signing key is built in; specify one through --public-key, or only verify " +
+			"the checksum through --skip-signature-verification")
+	}
+	return parseReleaseSigningKey(data)
+}
+
+// Parses a public key, either PEM-encoded or as base64-encoded DER
+func parseReleaseSigningKey(data []byte) (crypto.PublicKey, error) {
+	der := data
+	if block, _ := pem.Decode(data); block != nil {
+		der = block.Bytes
+	} else {
+		var err error
+		if der, err = base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data))); err != nil {
+			return nil, fmt.Errorf("invalid release signing key: %w", err)
+		}
+	}
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("invalid release signing key: %w", err)
+	}
+	return publicKey, nil
+}
+
+// Determines the version of the latest release. Mirrors serve it (as plain
+// text) at <release-url>/latest.
+func fetchLatestVersion(client *http.Client, baseURL string) (string, error) {
+	if baseURL != defaultReleaseURL {
+		body, err := fetchReleaseFile(client, strings.TrimSuffix(baseURL, "/")+"/latest")
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(body)), nil
+	}
+
+	body, err := fetchReleaseFile(client, latestReleaseURL)
+	if err != nil {
+		return "", err
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err = json.Unmarshal(body, &release); err != nil || release.TagName == "" {
+		return "", fmt.Errorf("unable to determine the latest release from %s", latestReleaseURL)
+	}
+	return strings.TrimPrefix(release.TagName, "v"), nil
+}
+
+// Returns the URL of the release binary for the platform
+func releaseBinaryURL(baseURL, version, goos, goarch string) (string, error) {
+	osName, osOk := releaseOSNames[goos]
+	archName, archOk := releaseArchNames[goarch]
+	if !osOk || !archOk {
+		return "", fmt.Errorf("no releases are published for %s/%s", goos, goarch)
+	}
+	if version == "" || strings.ContainsAny(version, "/\\") {
+		return "", fmt.Errorf("invalid version %q", version)
+	}
+	name := "aws_signing_helper"
+	if goos == "windows" {
+		name += ".exe"
+	}
+	return strings.Join([]string{strings.TrimSuffix(baseURL, "/"), version, archName, osName, name}, "/"), nil
+}
+
+// Downloads the release binary, along with its checksum (<binary>.sha256)
+// and, if a public key is specified, its detached signature (<binary>.sig),
+// and verifies it
+func downloadRelease(client *http.Client, binaryURL string, publicKey crypto.PublicKey) ([]byte, error) {
+	binary, err := fetchReleaseFile(client, binaryURL)
+	if err != nil {
+		return nil, err
+	}
+	checksum, err := fetchReleaseFile(client, binaryURL+".sha256")
+	if err != nil {
+		return nil, err
+	}
+	var signature []byte
+	if publicKey != nil {
+		if signature, err = fetchReleaseFile(client, binaryURL+".sig"); err != nil {
+			return nil, err
+		}
+	}
+	if err = verifyRelease(binary, checksum, signature, publicKey); err != nil {
+		return nil, err
+	}
+	return binary, nil
+}
+
+func fetchReleaseFile(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, withErrorCode(classifyStatusCode(resp.StatusCode), fmt.Errorf("unable to download %s: %s", url, resp.Status))
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxReleaseFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to download %s: %w", url, err)
+	}
+	if len(body) > maxReleaseFileSize {
+		return nil, fmt.Errorf("unable to download %s: file is too large", url)
+	}
+	return body, nil
+}
+
+// Verifies the release binary against its checksum (in the format of
+// sha256sum) and, if a public key is specified, its signature. RSA (PKCS #1
+// v1.5) and ECDSA signatures are over the SHA-256 digest of the binary, and
+// Ed25519 signatures are over the binary itself.
+func verifyRelease(binary, checksum, signature []byte, publicKey crypto.PublicKey) error {
+	digest := sha256.Sum256(binary)
+	fields := strings.Fields(string(checksum))
+	if len(fields) == 0 {
+		return errors.New("release checksum is empty")
+	}
+	expected, err := hex.DecodeString(fields[0])
+	if err != nil || !bytes.Equal(expected, digest[:]) {
+		return errors.New("release binary doesn't match its checksum")
+	}
+
+	if publicKey == nil {
+		return nil
+	}
+	verified := false
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		verified = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	case *ecdsa.PublicKey:
+		verified = ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		verified = ed25519.Verify(key, binary, signature)
+	default:
+		return errors.New("unsupported release signing key type")
+	}
+	if !verified {
+		return errors.New("release binary doesn't match its signature")
+	}
+	return nil
+}
+
+// Orders versions (such as 1.4.0) numerically, component by component
+func compareVersions(a, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		var aPart, bPart int
+		if i < len(aParts) {
+			aPart, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bPart, _ = strconv.Atoi(bParts[i])
+		}
+		if aPart != bPart {
+			if aPart < bPart {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Replaces the executable with the release binary. The binary is written to a
+// temporary file in the same directory (so that it can be renamed over the
+// executable), and is run to check that it reports the expected version
+// before the executable is replaced.
+func replaceExecutable(executable string, binary []byte, version string) (err error) {
+	info, err := os.Stat(executable)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(executable)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(executable)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write the release binary: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer func() {
+		if err != nil {
+			os.Remove(tmpPath)
+		}
+	}()
+	if _, err = tmp.Write(binary); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmpPath, info.Mode().Perm()|0o100)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to write the release binary: %w", err)
+	}
+
+	output, err := exec.Command(tmpPath, "version").Output()
+	if err != nil {
+		return fmt.Errorf("release binary doesn't run: %w", err)
+	}
+	if reported := strings.TrimSpace(string(output)); reported != version {
+		return fmt.Errorf("release binary reports version %q instead of %q", reported, version)
+	}
+
+	// The running executable can't be overwritten on Windows, but it can be
+	// renamed
+	if runtime.GOOS == "windows" {
+		old := executable + ".old"
+		os.Remove(old)
+		if err = os.Rename(executable, old); err != nil {
+			return fmt.Errorf("unable to replace %s: %w", executable, err)
+		}
+		if err = os.Rename(tmpPath, executable); err != nil {
+			os.Rename(old, executable)
+			return fmt.Errorf("unable to replace %s: %w", executable, err)
+		}
+		return nil
+	}
+	if err = os.Rename(tmpPath, executable); err != nil {
+		return fmt.Errorf("unable to replace %s: %w", executable, err)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestSelfUpdate(t *testing.T) {
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&signingKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := parseReleaseSigningKey([]byte(base64.StdEncoding.EncodeToString(der)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binary := []byte("#!/bin/sh\necho 1.5.0\n")
+	digest := sha256.Sum256(binary)
+	signature, err := ecdsa.SignASN1(rand.Reader, signingKey, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"/releases/latest": []byte("1.5.0\n"),
+		"/releases/1.5.0/X86_64/Linux/aws_signing_helper":        binary,
+		"/releases/1.5.0/X86_64/Linux/aws_signing_helper.sha256": []byte(hex.EncodeToString(digest[:]) + "  aws_signing_helper\n"),
+		"/releases/1.5.0/X86_64/Linux/aws_signing_helper.sig":    signature,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(body)
+	}))
+	defer server.Close()
+	baseURL := server.URL + "/releases"
+
+	version, err := fetchLatestVersion(server.Client(), baseURL)
+	if err != nil || version != "1.5.0" || compareVersions(version, "1.4.0") <= 0 || compareVersions("1.10.0", version) <= 0 {
+		t.Log("unexpected latest version:", version, err)
+		t.Fail()
+	}
+	binaryURL, err := releaseBinaryURL(baseURL, version, "linux", "amd64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	downloaded, err := downloadRelease(server.Client(), binaryURL, publicKey)
+	if err != nil || !bytes.Equal(downloaded, binary) {
+		t.Log("unable to download the release:", err)
+		t.Fail()
+	}
+
+	// Tampered binaries and signatures are rejected
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err = verifyRelease(binary, files["/releases/1.5.0/X86_64/Linux/aws_signing_helper.sha256"], signature,
+		&otherKey.PublicKey); err == nil {
+		t.Log("accepted a signature by a different key")
+		t.Fail()
+	}
+	if err = verifyRelease(append(binary, '\n'), files["/releases/1.5.0/X86_64/Linux/aws_signing_helper.sha256"],
+		signature, nil); err == nil {
+		t.Log("accepted a binary that doesn't match its checksum")
+		t.Fail()
+	}
+	if _, err = downloadRelease(server.Client(), baseURL+"/1.6.0/X86_64/Linux/aws_signing_helper", nil); err == nil ||
+		classifyError(err).Code != errorCodeConfiguration {
+		t.Log("unexpected error for a release that doesn't exist:", err)
+		t.Fail()
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	executable := filepath.Join(t.TempDir(), "aws_signing_helper")
+	if err = os.WriteFile(executable, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err = replaceExecutable(executable, binary, "1.6.0"); err == nil {
+		t.Log("replaced the executable with a binary that reports a different version")
+		t.Fail()
+	}
+	if err = replaceExecutable(executable, binary, "1.5.0"); err != nil {
+		t.Fatal(err)
+	}
+	if content, _ := os.ReadFile(executable); !bytes.Equal(content, binary) {
+		t.Log("executable wasn't replaced")
+		t.Fail()
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(executable)); len(entries) != 1 {
+		t.Log("temporary files were left behind")
+		t.Fail()
+	}
+}
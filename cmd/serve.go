@@ -1,9 +1,6 @@
 package cmd
 
 import (
-	"log"
-	"os"
-
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 	"github.com/spf13/cobra"
 )
@@ -11,12 +8,39 @@ import (
 var (
 	port     int
 	hopLimit int
+	sandbox  bool
+
+	insecureBind string
 )
 
 func init() {
 	initCredentialsSubCommand(serveCmd)
+	addIdentityProfileFlag(serveCmd)
 	serveCmd.PersistentFlags().IntVar(&port, "port", helper.DefaultPort, "The port used to run the local server")
 	serveCmd.PersistentFlags().IntVar(&hopLimit, "hop-limit", helper.DefaultHopLimit, "The IP TTL to set on responses")
+	serveCmd.PersistentFlags().StringVar(&onRefresh, "on-refresh", "", "Command to run after each successful credential refresh. "+
+		"The command is run through the shell, with the profile and expiration of the new credentials in its environment")
+	serveCmd.PersistentFlags().BoolVar(&sandbox, "sandbox", false, "Once the local server is listening, restrict the "+
+		"system calls and files that the process can use (with seccomp and Landlock on Linux, and pledge and unveil on OpenBSD)")
+	serveCmd.PersistentFlags().StringVar(&insecureBind, "insecure-bind", "", "Address (other than "+helper.LocalHostAddress+
+		") for the local server to listen on. Addresses that aren't loopback addresses let other hosts that can reach "+
+		"the server retrieve credentials")
+	serveCmd.PersistentFlags().BoolVar(&preconnect, "preconnect", false, "Establish the connection to Roles Anywhere "+
+		"shortly before credentials are refreshed, so that the refresh doesn't wait for the TCP and TLS handshakes")
+	serveCmd.PersistentFlags().StringVar(&pprofAddress, "pprof-address", "", "Loopback address and port (such as "+
+		"127.0.0.1:6060), or Unix domain socket (unix:/path), on which to serve the net/http/pprof endpoints, for "+
+		"diagnosing performance issues")
+	serveCmd.PersistentFlags().StringVar(&pprofDir, "pprof-dir", "", "Directory to write a heap profile, and a CPU "+
+		"profile of the following 30 seconds, to when the process receives SIGUSR2 (not supported on Windows)")
+	serveCmd.PersistentFlags().BoolVar(&skipRevalidation, "skip-revalidation", false, "Don't verify the certificate "+
+		"chain against --trust-anchor-certificate again on refreshes, while the certificate, chain, and trust anchor "+
+		"certificate are unchanged since credentials were last obtained with them")
+	serveCmd.PersistentFlags().BoolVar(&eventLog, "event-log", false, eventLogUsage)
+	serveCmd.MarkFlagsMutuallyExclusive("sandbox", "on-refresh")
+	serveCmd.MarkFlagsMutuallyExclusive("sandbox", "acme")
+	serveCmd.MarkFlagsMutuallyExclusive("sandbox", "pprof-address")
+	serveCmd.MarkFlagsMutuallyExclusive("sandbox", "pprof-dir")
+	serveCmd.MarkFlagsMutuallyExclusive("sandbox", "audit-log-max-size")
 }
 
 var serveCmd = &cobra.Command{
@@ -26,13 +50,28 @@ var serveCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := PopulateCredentialsOptions()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
 		}
 
 		helper.Debug = credentialsOptions.Debug
+		if err = helper.DisableCoreDumps(); err != nil {
+			helper.LogWarnf("unable to disable core dumps: %s", err)
+		}
 		credentialsOptions.ServerTTL = hopLimit
+		credentialsOptions.OnRefresh = onRefresh
+		credentialsOptions.Preconnect = preconnect
+		credentialsOptions.SkipRevalidation = skipRevalidation
+		credentialsOptions.PprofAddress = pprofAddress
+		credentialsOptions.PprofDir = pprofDir
+		credentialsOptions.Sandbox = sandbox
+		credentialsOptions.ServerBindAddress = insecureBind
+		if err = startEventLog("serve"); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
 
-		helper.Serve(port, credentialsOptions)
+		err = helper.Serve(port, credentialsOptions)
+		if err != nil {
+			exitWithError(err)
+		}
 	},
 }
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"errors"
+	"path/filepath"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+var (
+	sidecarPort    int
+	tokenFile      string
+	certificateDir string
+	watchInterval  time.Duration
+)
+
+func init() {
+	initCredentialsSubCommand(sidecarCmd)
+	addIdentityProfileFlag(sidecarCmd)
+	sidecarCmd.PersistentFlags().IntVar(&sidecarPort, "port", helper.DefaultPort, "The port used to run the local server")
+	sidecarCmd.PersistentFlags().StringVar(&tokenFile, "token-file", "", "File with the authorization token of the local "+
+		"server, which the application container reads through AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE. A random token "+
+		"is written to it if it doesn't exist")
+	sidecarCmd.PersistentFlags().StringVar(&certificateDir, "certificate-dir", "", "Directory with the tls.crt and "+
+		"tls.key files of the identity (such as a volume of cert-manager's CSI driver, or a projected secret), "+
+		"instead of --certificate, --private-key, and --intermediates")
+	sidecarCmd.PersistentFlags().DurationVar(&watchInterval, "watch-interval", helper.DefaultCertificateWatchInterval, "How "+
+		"often to check whether the certificate and private key were rotated")
+	sidecarCmd.PersistentFlags().StringVar(&onRefresh, "on-refresh", "", "Command to run after each successful credential refresh. "+
+		"The command is run through the shell, with the profile and expiration of the new credentials in its environment")
+	sidecarCmd.PersistentFlags().StringVar(&insecureBind, "insecure-bind", "", "Address (other than "+helper.LocalHostAddress+
+		") for the local server to listen on. Addresses that aren't loopback addresses let other hosts that can reach "+
+		"the server retrieve credentials (with the token)")
+	sidecarCmd.MarkPersistentFlagRequired("token-file")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "certificate")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "private-key")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "intermediates")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "spiffe-endpoint-socket")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "kubernetes-secret")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "greengrass-root")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "fleet-provisioning-template")
+	sidecarCmd.MarkFlagsMutuallyExclusive("certificate-dir", "acme")
+}
+
+var sidecarCmd = &cobra.Command{
+	Use:   "sidecar [flags]",
+	Short: "Serve AWS credentials to the containers of a pod, as a sidecar",
+	Long: `Serve AWS credentials to the other containers of a pod (or task) through a
+local endpoint that is compatible with the container credential providers of
+the AWS SDKs, which the application container uses through
+AWS_CONTAINER_CREDENTIALS_FULL_URI and AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE.
+The certificate and private key (usually mounted from cert-manager's CSI
+driver or a projected volume) are watched, and new credentials are obtained
+once they're rotated. In a Kubernetes pod, the role session name defaults to
+the namespace and name of the pod. For example:
+
+  aws_signing_helper sidecar --certificate-dir /var/run/rolesanywhere/identity \
+    --token-file /var/run/rolesanywhere/token --trust-anchor-arn ... --profile-arn ... --role-arn ...`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if certificateDir != "" {
+			certificateId = filepath.Join(certificateDir, "tls.crt")
+			privateKeyId = filepath.Join(certificateDir, "tls.key")
+			// The intermediates follow the certificate in tls.crt
+			certificateBundleId = certificateId
+		}
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+		if watchInterval <= 0 {
+			exitWithError(withErrorCode(errorCodeConfiguration, errors.New("watch interval must be positive")))
+		}
+
+		helper.Debug = credentialsOptions.Debug
+		if err = helper.DisableCoreDumps(); err != nil {
+			helper.LogWarnf("unable to disable core dumps: %s", err)
+		}
+		credentialsOptions.CertificateWatchInterval = watchInterval
+		credentialsOptions.OnRefresh = onRefresh
+		credentialsOptions.ServerBindAddress = insecureBind
+
+		err = helper.ServeContainerCredentials(sidecarPort, tokenFile, credentialsOptions)
+		if err != nil {
+			exitWithError(err)
+		}
+	},
+}
@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bufio"
+	"bytes"
 	"crypto"
 	"crypto/ecdsa"
 	"crypto/elliptic"
@@ -9,12 +10,14 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
+	"encoding/base64"
 	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -24,15 +27,33 @@ import (
 )
 
 var (
-	format    *enum
-	digestArg *enum
+	format        *enum
+	digestArg     *enum
+	signInputPath string
+	batchPath     string
+	manifestPath  string
 )
 
+// Longest payload (or manifest path) that's read from a line of a batch
+const maxBatchLineSize = 1 << 20
+
 var (
 	SIGN_STRING_TEST_VERSION uint16 = 1
-	signFixedString          bool   = true
 )
 
+// Detailed output of the sign-string command, for use by external tooling
+type SignStringOutput struct {
+	// Signature algorithm, such as RSA-PKCS1-v1_5 or ECDSA
+	Algorithm string `json:"Algorithm"`
+	// Digest that was signed, such as SHA256
+	Digest string `json:"Digest"`
+	// Hex-encoded SHA-256 hash of the DER-encoded SubjectPublicKeyInfo of the
+	// key that produced the signature
+	KeyId string `json:"KeyId"`
+	// Hex-encoded signature
+	Signature string `json:"Signature"`
+}
+
 type enum struct {
 	Allowed []string
 	Value   string
@@ -71,7 +92,7 @@ func (a *enum) Type() string {
 
 func init() {
 	rootCmd.AddCommand(signStringCmd)
-	format = newEnum([]string{"json", "text", "bin"}, "json")
+	format = newEnum([]string{"json", "text", "bin", "base64", "json-detailed"}, "json")
 	digestArg = newEnum([]string{"SHA256", "SHA384", "SHA512"}, "SHA256")
 	signStringCmd.PersistentFlags().StringVar(&certificateId, "certificate", "", "PKCS#11 URI to identify the certificate")
 	signStringCmd.PersistentFlags().StringVar(&privateKeyId, "private-key", "", "Path to private key file or PKCS#11 URI to identify the private key")
@@ -87,9 +108,21 @@ func init() {
 	signStringCmd.PersistentFlags().StringVar(&tpmKeyPassword, "tpm-key-password", "", "Password for TPM key, if applicable")
 	signStringCmd.PersistentFlags().BoolVar(&noTpmKeyPassword, "no-tpm-key-password", false, "Required if the TPM key has no password and"+
 		"a handle is used to refer to the key")
-	signStringCmd.PersistentFlags().Var(format, "format", "Output format. One of json, text, and bin")
+	signStringCmd.PersistentFlags().StringVar(&keyPassword, "key-password", "", "Password for an encrypted private key file or a "+
+		"password-protected PKCS#12 file. If it's required and not specified, it's prompted for on the terminal")
+	signStringCmd.PersistentFlags().Var(format, "format", "Output format. One of json, text (hex-encoded signature), bin, "+
+		"base64, and json-detailed (which includes the algorithm and key ID)")
+	signStringCmd.PersistentFlags().StringVar(&signInputPath, "input", "", "Path to a file whose contents should be signed, "+
+		"instead of the fixed test string. Use - to read from stdin")
+	signStringCmd.PersistentFlags().StringVar(&batchPath, "batch", "", "Path to a file of newline-delimited payloads, "+
+		"each of which is signed, with one signature per line of output. Use - to read from stdin")
+	signStringCmd.PersistentFlags().StringVar(&manifestPath, "batch-manifest", "", "Path to a file of newline-delimited "+
+		"paths of files, the contents of each of which are signed, with one signature per line of output. Use - to read "+
+		"from stdin")
 	signStringCmd.PersistentFlags().Var(digestArg, "digest", "One of SHA256, SHA384, and SHA512")
+	addAuditLogFlags(signStringCmd.PersistentFlags())
 
+	signStringCmd.MarkFlagsMutuallyExclusive("input", "batch", "batch-manifest")
 	signStringCmd.MarkFlagsMutuallyExclusive("certificate", "cert-selector")
 	signStringCmd.MarkFlagsMutuallyExclusive("certificate", "system-store-name")
 	signStringCmd.MarkFlagsMutuallyExclusive("private-key", "cert-selector")
@@ -125,6 +158,30 @@ func getFixedStringToSign(publicKey crypto.PublicKey) string {
 	return fixedStringToSign
 }
 
+// Builds the detailed output for a signature produced by the key
+func getSignStringOutput(publicKey crypto.PublicKey, digestName string, sigBytes []byte) (SignStringOutput, error) {
+	publicKeyDer, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return SignStringOutput{}, fmt.Errorf("unable to encode public key: %w", err)
+	}
+	keyId := sha256.Sum256(publicKeyDer)
+
+	var algorithm string
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		algorithm = "RSA-PKCS1-v1_5"
+	case *ecdsa.PublicKey:
+		algorithm = "ECDSA"
+	}
+
+	return SignStringOutput{
+		Algorithm: algorithm,
+		Digest:    strings.ToUpper(digestName),
+		KeyId:     hex.EncodeToString(keyId[:]),
+		Signature: hex.EncodeToString(sigBytes),
+	}, nil
+}
+
 var signStringCmd = &cobra.Command{
 	Use:   "sign-string [flags]",
 	Short: "Signs a fixed string using the passed-in private key (or reference to private key)",
@@ -142,8 +199,7 @@ var signStringCmd = &cobra.Command{
 		}
 		err := PopulateCredentialsOptions()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
 		}
 
 		helper.Debug = credentialsOptions.Debug
@@ -151,40 +207,124 @@ var signStringCmd = &cobra.Command{
 		var signer helper.Signer
 		signer, _, err = helper.GetSigner(&credentialsOptions)
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeIdentity, err))
 		}
 		defer signer.Close()
 
+		if batchPath != "" || manifestPath != "" {
+			if strings.ToLower(format.String()) == "bin" {
+				exitWithError(withErrorCode(errorCodeConfiguration, errors.New("the bin format can't be used with --batch "+
+					"or --batch-manifest, since signatures can't be told apart")))
+			}
+			path, manifest := batchPath, false
+			if manifestPath != "" {
+				path, manifest = manifestPath, true
+			}
+			input := os.Stdin
+			if path != "-" {
+				if input, err = os.Open(path); err != nil {
+					exitWithError(fmt.Errorf("unable to read the batch to sign: %w", err))
+				}
+				defer input.Close()
+			}
+			output := bufio.NewWriter(os.Stdout)
+			err = signBatch(signer, digest, input, manifest, output)
+			if flushErr := output.Flush(); err == nil {
+				err = flushErr
+			}
+			if err != nil {
+				exitWithError(err)
+			}
+			return
+		}
+
 		var stringToSignBytes []byte
-		if signFixedString {
+		switch signInputPath {
+		case "":
 			stringToSign := getFixedStringToSign(signer.Public())
 			stringToSignBytes = []byte(stringToSign)
 
-			if credentialsOptions.Debug {
-				log.Println("Signing fixed string of the form: \"AWS Roles Anywhere " +
-					"Credential Helper Signing Test\" || SIGN_STRING_TEST_VERSION || SHA256(\"IAM RA\" || PUBLIC_KEY_BYTE_ARRAY)\"")
-			}
-		} else {
-			stringToSignBytes, _ = ioutil.ReadAll(bufio.NewReader(os.Stdin))
+			helper.LogDebugf("Signing fixed string of the form: \"AWS Roles Anywhere " +
+				"Credential Helper Signing Test\" || SIGN_STRING_TEST_VERSION || SHA256(\"IAM RA\" || PUBLIC_KEY_BYTE_ARRAY)\"")
+		case "-":
+			stringToSignBytes, err = ioutil.ReadAll(bufio.NewReader(os.Stdin))
+		default:
+			stringToSignBytes, err = os.ReadFile(signInputPath)
+		}
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to read input to sign: %w", err))
 		}
 
 		sigBytes, err := signer.Sign(rand.Reader, stringToSignBytes, digest)
 		if err != nil {
-			log.Println("unable to sign the digest:", err)
-			os.Exit(1)
+			exitWithError(fmt.Errorf("unable to sign the digest: %w", err))
 		}
-		sigStr := hex.EncodeToString(sigBytes)
-		switch strings.ToLower(format.String()) {
-		case "text":
-			fmt.Print(sigStr)
-		case "json":
-			buf, _ := json.Marshal(sigStr)
-			fmt.Print(string(buf[:]))
-		case "bin":
-			binary.Write(os.Stdout, binary.BigEndian, sigBytes[:])
-		default:
-			fmt.Print(sigStr)
+		if err = writeSignature(os.Stdout, signer.Public(), sigBytes); err != nil {
+			exitWithError(err)
 		}
 	},
 }
+
+// Writes the signature in the output format
+func writeSignature(w io.Writer, publicKey crypto.PublicKey, sigBytes []byte) error {
+	sigStr := hex.EncodeToString(sigBytes)
+	var err error
+	switch strings.ToLower(format.String()) {
+	case "text":
+		_, err = fmt.Fprint(w, sigStr)
+	case "json":
+		buf, _ := json.Marshal(sigStr)
+		_, err = w.Write(buf)
+	case "bin":
+		err = binary.Write(w, binary.BigEndian, sigBytes[:])
+	case "base64":
+		_, err = fmt.Fprint(w, base64.StdEncoding.EncodeToString(sigBytes))
+	case "json-detailed":
+		output, outputErr := getSignStringOutput(publicKey, digestArg.String(), sigBytes)
+		if outputErr != nil {
+			return outputErr
+		}
+		buf, _ := json.Marshal(output)
+		_, err = w.Write(buf)
+	default:
+		_, err = fmt.Fprint(w, sigStr)
+	}
+	return err
+}
+
+// Signs each line of the input (or, for a manifest, the contents of the file
+// at the path on each line), and writes one signature per line, in the order
+// of the input. Carriage returns that end lines are dropped. The key is
+// loaded once for the whole batch, so that pipelines don't pay for it for
+// every payload. Signing stops at the first payload that can't be signed.
+func signBatch(signer helper.Signer, digest crypto.Hash, r io.Reader, manifest bool, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBatchLineSize)
+	for line := 1; scanner.Scan(); line++ {
+		payload := bytes.TrimSuffix(scanner.Bytes(), []byte("\r"))
+		if manifest {
+			if len(payload) == 0 {
+				return fmt.Errorf("line %d of the batch manifest is empty", line)
+			}
+			data, err := os.ReadFile(string(payload))
+			if err != nil {
+				return fmt.Errorf("unable to read input to sign (line %d of the batch manifest): %w", line, err)
+			}
+			payload = data
+		}
+		sigBytes, err := signer.Sign(rand.Reader, payload, digest)
+		if err != nil {
+			return fmt.Errorf("unable to sign the digest (line %d of the batch): %w", line, err)
+		}
+		if err = writeSignature(w, signer.Public(), sigBytes); err != nil {
+			return err
+		}
+		if _, err = io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("unable to read the batch to sign: %w", err)
+	}
+	return nil
+}
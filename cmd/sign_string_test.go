@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+func TestSignStringOutput(t *testing.T) {
+	_, cert, err := helper.ReadCertificateData("../tst/certs/ec-prime256v1-sha256-cert.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKeyDer, _ := x509.MarshalPKIXPublicKey(cert.PublicKey)
+	expectedKeyId := sha256.Sum256(publicKeyDer)
+
+	output, err := getSignStringOutput(cert.PublicKey, "sha384", []byte{0x01, 0x02})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output.Algorithm != "ECDSA" ||
+		output.Digest != "SHA384" ||
+		output.KeyId != hex.EncodeToString(expectedKeyId[:]) ||
+		output.Signature != "0102" {
+		t.Log("unexpected sign-string output:", output)
+		t.Fail()
+	}
+}
+
+func TestSignBatch(t *testing.T) {
+	signer, _, err := helper.GetSigner(&helper.CredentialsOpts{
+		PrivateKeyId:  "../tst/certs/ec-prime256v1-key.pem",
+		CertificateId: "../tst/certs/ec-prime256v1-sha256-cert.pem",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer signer.Close()
+	defer format.Set(format.String())
+	format.Set("text")
+
+	payload := filepath.Join(t.TempDir(), "payload")
+	os.WriteFile(payload, []byte("third"), 0600)
+	for _, test := range []struct {
+		input    string
+		manifest bool
+		payloads []string
+	}{
+		{"first\nsecond\r\n\n", false, []string{"first", "second", ""}},
+		{payload + "\n", true, []string{"third"}},
+	} {
+		var output bytes.Buffer
+		if err = signBatch(signer, crypto.SHA256, strings.NewReader(test.input), test.manifest, &output); err != nil {
+			t.Fatal(err)
+		}
+		lines := strings.Split(strings.TrimSuffix(output.String(), "\n"), "\n")
+		if len(lines) != len(test.payloads) {
+			t.Fatalf("unexpected number of signatures: %q", output.String())
+		}
+		for i, line := range lines {
+			signature, _ := hex.DecodeString(line)
+			digest := sha256.Sum256([]byte(test.payloads[i]))
+			if !ecdsa.VerifyASN1(signer.Public().(*ecdsa.PublicKey), digest[:], signature) {
+				t.Errorf("signature %d doesn't verify against %q", i, test.payloads[i])
+			}
+		}
+	}
+
+	err = signBatch(signer, crypto.SHA256, strings.NewReader("\n"), true, io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "line 1") {
+		t.Error("an empty manifest line wasn't reported:", err)
+	}
+}
@@ -0,0 +1,80 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/aws/smithy-go/tracing"
+)
+
+// How long spans that haven't been exported yet are waited for on exit
+const tracesFlushTimeout = 2 * time.Second
+
+var (
+	otlpEndpoint string
+	// Tracer provider of the process, once it's created
+	otlpTracerProvider *helper.OTLPTracerProvider
+)
+
+func init() {
+	rootCmd.PersistentFlags().StringVar(&otlpEndpoint, "otlp-endpoint", defaultOTLPEndpoint(), "URL of an OTLP/HTTP "+
+		"traces endpoint (such as http://localhost:4318/v1/traces) that spans of key loads, signatures, CreateSession "+
+		"calls, and credential cache operations are exported to. Defaults to OTEL_EXPORTER_OTLP_TRACES_ENDPOINT, or "+
+		"OTEL_EXPORTER_OTLP_ENDPOINT followed by /v1/traces")
+}
+
+// Returns the traces endpoint of the OpenTelemetry environment variables
+func defaultOTLPEndpoint() string {
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+	}
+	return ""
+}
+
+// Returns the tracer provider that exports spans to --otlp-endpoint, with
+// the headers and service name of the OpenTelemetry environment variables,
+// and the parent span of the TRACEPARENT environment variable (if it's set).
+// It returns nil if there's no endpoint.
+func tracerProvider() (tracing.TracerProvider, error) {
+	if otlpEndpoint == "" {
+		return nil, nil
+	}
+	if otlpTracerProvider != nil {
+		return otlpTracerProvider, nil
+	}
+	headers := map[string]string{}
+	for _, header := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if name, value, ok := strings.Cut(header, "="); ok {
+			headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+		}
+	}
+	provider, err := helper.NewOTLPTracerProvider(helper.OTLPTracerOptions{
+		Endpoint:    otlpEndpoint,
+		Headers:     headers,
+		ServiceName: os.Getenv("OTEL_SERVICE_NAME"),
+		TraceParent: os.Getenv("TRACEPARENT"),
+	})
+	if err != nil {
+		return nil, err
+	}
+	otlpTracerProvider = provider
+	return provider, nil
+}
+
+// Exports the spans that haven't been exported yet
+func flushTraces() {
+	if otlpTracerProvider == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), tracesFlushTimeout)
+	defer cancel()
+	if err := otlpTracerProvider.Shutdown(ctx); err != nil {
+		helper.LogDebugf("unable to export spans: %s", err)
+	}
+}
@@ -1,22 +1,60 @@
 package cmd
 
 import (
-	"log"
-	"os"
+	"errors"
+	"time"
 
 	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 	"github.com/spf13/cobra"
 )
 
 var (
-	profile string
-	once    bool
+	profile          string
+	once             bool
+	updateTarget     *enum
+	cliCacheKey      string
+	onRefresh        string
+	refreshBuffer    time.Duration
+	preconnect       bool
+	skipRevalidation bool
+	prewarm          bool
+	prewarmTimeout   time.Duration
+	pprofAddress     string
+	pprofDir         string
 )
 
 func init() {
 	initCredentialsSubCommand(updateCmd)
+	updateTarget = newEnum([]string{helper.UpdateTargetCredentialsFile, helper.UpdateTargetCLICache, helper.UpdateTargetSecretStore},
+		helper.UpdateTargetCredentialsFile)
 	updateCmd.PersistentFlags().StringVar(&profile, "profile", "default", "profile to update")
+	addIdentityProfileFlag(updateCmd)
 	updateCmd.PersistentFlags().BoolVar(&once, "once", false, "to update the profile just once")
+	updateCmd.PersistentFlags().DurationVar(&refreshBuffer, "refresh-buffer", helper.UpdateRefreshTime, "How long before the "+
+		"credentials expire to refresh them (for example, 10m)")
+	updateCmd.PersistentFlags().Var(updateTarget, "target", "Where to write credentials. One of credentials-file, cli-cache, and "+
+		"secret-store (Windows Credential Manager, macOS Keychain, or libsecret on Linux, with the profile as the entry name)")
+	updateCmd.PersistentFlags().StringVar(&cliCacheKey, "cache-key", "", "Name of the cache entry (in ~/.aws/cli/cache) to write when the "+
+		"target is cli-cache. Defaults to the key that the AWS CLI looks up for the SSO settings that are written into the profile")
+	updateCmd.PersistentFlags().StringVar(&onRefresh, "on-refresh", "", "Command to run after each successful credential refresh. "+
+		"The command is run through the shell, with the profile and expiration of the new credentials in its environment")
+	updateCmd.PersistentFlags().BoolVar(&preconnect, "preconnect", false, "Establish the connection to Roles Anywhere "+
+		"shortly before credentials are refreshed, so that the refresh doesn't wait for the TCP and TLS handshakes")
+	updateCmd.PersistentFlags().BoolVar(&prewarm, "prewarm", false, "Update the profile once, as --once does, for "+
+		"a oneshot boot unit that runs before the services that need credentials. Failures that are transient while the "+
+		"host boots (the network, the system clock, or the backend of the key not being ready yet) are retried until "+
+		"--prewarm-timeout passes")
+	updateCmd.PersistentFlags().DurationVar(&prewarmTimeout, "prewarm-timeout", 5*time.Minute, "How long --prewarm "+
+		"retries for")
+	updateCmd.PersistentFlags().StringVar(&pprofAddress, "pprof-address", "", "Loopback address and port (such as "+
+		"127.0.0.1:6060), or Unix domain socket (unix:/path), on which to serve the net/http/pprof endpoints, for "+
+		"diagnosing performance issues")
+	updateCmd.PersistentFlags().StringVar(&pprofDir, "pprof-dir", "", "Directory to write a heap profile, and a CPU "+
+		"profile of the following 30 seconds, to when the process receives SIGUSR2 (not supported on Windows)")
+	updateCmd.PersistentFlags().BoolVar(&skipRevalidation, "skip-revalidation", false, "Don't verify the certificate "+
+		"chain against --trust-anchor-certificate again on refreshes, while the certificate, chain, and trust anchor "+
+		"certificate are unchanged since credentials were last obtained with them")
+	updateCmd.PersistentFlags().BoolVar(&eventLog, "event-log", false, eventLogUsage)
 }
 
 var updateCmd = &cobra.Command{
@@ -26,12 +64,37 @@ var updateCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		err := PopulateCredentialsOptions()
 		if err != nil {
-			log.Println(err)
-			os.Exit(1)
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		if prewarm && prewarmTimeout <= 0 {
+			exitWithError(withErrorCode(errorCodeConfiguration, errors.New("prewarm timeout must be positive")))
+		}
+		if refreshBuffer < 0 {
+			exitWithError(withErrorCode(errorCodeConfiguration, errors.New("refresh buffer can't be negative")))
 		}
 
 		helper.Debug = credentialsOptions.Debug
+		if err = helper.DisableCoreDumps(); err != nil {
+			helper.LogWarnf("unable to disable core dumps: %s", err)
+		}
+		credentialsOptions.UpdateTarget = updateTarget.String()
+		credentialsOptions.CLICacheKey = cliCacheKey
+		credentialsOptions.OnRefresh = onRefresh
+		credentialsOptions.Preconnect = preconnect
+		credentialsOptions.SkipRevalidation = skipRevalidation
+		credentialsOptions.PprofAddress = pprofAddress
+		credentialsOptions.PprofDir = pprofDir
+		credentialsOptions.RefreshBuffer = refreshBuffer
+		if prewarm {
+			credentialsOptions.PrewarmTimeout = prewarmTimeout
+		}
+		if err = startEventLog("update"); err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
 
-		helper.Update(credentialsOptions, profile, once)
+		if err = helper.Update(credentialsOptions, profile, once || prewarm); err != nil {
+			exitWithError(err)
+		}
 	},
 }
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	initCredentialsSubCommand(validateCmd)
+	addIdentityProfileFlag(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:   "validate [flags]",
+	Short: "Validates identity material before it's used to obtain credentials",
+	Long: `Validates the private key, certificate, and certificate chain (and the ARNs)
+that are passed in, without making any network calls. Checks that the private
+key matches the certificate (and signs a test payload that verifies against
+it), that the certificate chain is ordered and complete,
+that certificates are within their validity period, that the certificate meets
+the requirements of IAM Roles Anywhere, that the certificate chain leads to
+the CA certificate passed through --trust-anchor-certificate (if it is), and
+that the trust anchor is in the same region as the profile. Exits with a
+non-zero status if any check fails.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		helper.Debug = credentialsOptions.Debug
+
+		results, err := helper.ValidateIdentity(&credentialsOptions, time.Now())
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeIdentity, err))
+		}
+
+		failed := false
+		for _, result := range results {
+			status := "PASS"
+			if !result.Passed {
+				status = "FAIL"
+				failed = true
+			}
+			if result.Message != "" {
+				fmt.Printf("[%s] %s: %s\n", status, result.Check, result.Message)
+			} else {
+				fmt.Printf("[%s] %s\n", status, result.Check)
+			}
+		}
+		if failed {
+			exit(exitCodes[errorCodeIdentity])
+		}
+	},
+}
@@ -1,24 +1,91 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"runtime"
+	runtimedebug "runtime/debug"
+	"strings"
 
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
 	"github.com/spf13/cobra"
 )
 
 var (
 	Version string
+	// Git commit that the binary was built from. If it isn't set at build
+	// time, the revision recorded by the Go toolchain is used instead.
+	Commit string
+
+	versionFormat *enum
 )
 
+// Build metadata that is reported by the version command
+type BuildInfo struct {
+	Version   string   `json:"Version"`
+	Commit    string   `json:"Commit"`
+	GoVersion string   `json:"GoVersion"`
+	Platform  string   `json:"Platform"`
+	Backends  []string `json:"Backends"`
+	FIPS      bool     `json:"FIPS"`
+}
+
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	versionFormat = newEnum([]string{"short", "text", "json"}, "short")
+	versionCmd.PersistentFlags().Var(versionFormat, "format", "Output format. One of short (only the version number), "+
+		"text, and json")
 }
 
 var versionCmd = &cobra.Command{
 	Use:   "version",
 	Short: "Prints the version number of the credential helper",
-	Long:  "Prints the version number of the credential helper",
+	Long: `Prints the version number of the credential helper. With --format text or
+--format json, build metadata is also printed: the git commit, the Go version,
+the platform, the signing backends that were compiled in, and whether the
+binary uses a FIPS 140-validated cryptographic module.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		fmt.Println(Version)
+		buildInfo := getBuildInfo()
+
+		switch versionFormat.String() {
+		case "json":
+			buf, err := json.Marshal(buildInfo)
+			if err != nil {
+				exitWithError(err)
+			}
+			fmt.Println(string(buf[:]))
+		case "text":
+			fmt.Printf("Version:    %s\n", buildInfo.Version)
+			fmt.Printf("Commit:     %s\n", buildInfo.Commit)
+			fmt.Printf("Go version: %s\n", buildInfo.GoVersion)
+			fmt.Printf("Platform:   %s\n", buildInfo.Platform)
+			fmt.Printf("Backends:   %s\n", strings.Join(buildInfo.Backends, ", "))
+			fmt.Printf("FIPS:       %t\n", buildInfo.FIPS)
+		default:
+			fmt.Println(Version)
+		}
 	},
 }
+
+// Collects the build metadata of the running binary
+func getBuildInfo() BuildInfo {
+	commit := Commit
+	if commit == "" {
+		if info, ok := runtimedebug.ReadBuildInfo(); ok {
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" {
+					commit = setting.Value
+				}
+			}
+		}
+	}
+
+	return BuildInfo{
+		Version:   Version,
+		Commit:    commit,
+		GoVersion: runtime.Version(),
+		Platform:  runtime.GOOS + "/" + runtime.GOARCH,
+		Backends:  helper.Backends(),
+		FIPS:      helper.FIPSEnabled(),
+	}
+}
@@ -0,0 +1,34 @@
+package cmd
+
+import (
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+func TestBuildInfo(t *testing.T) {
+	buildInfo := getBuildInfo()
+	if buildInfo.GoVersion == "" || buildInfo.Platform == "" {
+		t.Log("missing Go version or platform in build info")
+		t.Fail()
+	}
+	found := false
+	for _, backend := range buildInfo.Backends {
+		found = found || backend == "file"
+	}
+	if !found {
+		t.Log("expected the file backend to be reported as compiled in")
+		t.Fail()
+	}
+	if buildInfo.FIPS != helper.FIPSEnabled() {
+		t.Log("unexpected FIPS status in build info")
+		t.Fail()
+	}
+
+	defer func() { requireFIPS = false }()
+	requireFIPS = true
+	if err := checkRequireFIPS(); (err == nil) != helper.FIPSEnabled() {
+		t.Log("unexpected result of --require-fips:", err)
+		t.Fail()
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !windows
+
+package cmd
+
+// Only Windows has services that report to a service control manager
+func startWindowsService() {}
@@ -0,0 +1,42 @@
+//go:build windows
+
+package cmd
+
+import (
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"golang.org/x/sys/windows/svc"
+)
+
+// Handles the requests of the service control manager
+type windowsService struct{}
+
+// Reports the process as running to the service control manager, if it was
+// started as a Windows service (for example, to run the serve command at
+// boot), and exits when the service is stopped
+func startWindowsService() {
+	isService, err := svc.IsWindowsService()
+	if err != nil || !isService {
+		return
+	}
+	go func() {
+		// The name is ignored for services that run in their own process
+		if err := svc.Run("", windowsService{}); err != nil {
+			helper.LogErrorf("unable to run as a Windows service: %s", err)
+		}
+	}()
+}
+
+func (windowsService) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	accepted := svc.AcceptStop | svc.AcceptShutdown
+	status <- svc.Status{State: svc.Running, Accepts: accepted}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			status <- svc.Status{State: svc.StopPending}
+			exit(0)
+		}
+	}
+	return false, 0
+}
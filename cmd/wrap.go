@@ -0,0 +1,127 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/spf13/cobra"
+)
+
+var wrapFormat *enum
+
+func init() {
+	initCredentialsSubCommand(wrapCmd)
+	wrapFormat = newEnum([]string{"all", "credential-process", "systemd", "docker"}, "all")
+	wrapCmd.PersistentFlags().Var(wrapFormat, "format", "Integration to generate. One of all, credential-process "+
+		"(a profile for the AWS config file), systemd (a unit that runs the serve command), and docker (a docker run "+
+		"command that passes credentials to a container)")
+	wrapCmd.PersistentFlags().StringVar(&profile, "profile", "default", "Profile in the AWS config file that the "+
+		"credential_process setting is generated for")
+	wrapCmd.PersistentFlags().IntVar(&port, "port", helper.DefaultPort, "Port of the local server that the systemd unit "+
+		"runs, and that containers get credentials from")
+	addIdentityProfileFlag(wrapCmd)
+}
+
+var wrapCmd = &cobra.Command{
+	Use:   "wrap [flags]",
+	Short: "Prints integration snippets for the current configuration",
+	Long: `Prints ready-to-paste snippets that integrate the credential helper, with the
+flags that were passed to this command: a profile for the AWS config file whose
+credential_process setting runs the credential-process command, a systemd unit
+that runs the serve command, and a docker run command that passes credentials
+to a container. As with bootstrap-config, paths are made absolute, and if a
+configuration file is used, the snippets refer to it instead of repeating the
+values from the file.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		err := PopulateCredentialsOptions()
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		executable, err := os.Executable()
+		if err != nil {
+			exitWithError(fmt.Errorf("unable to determine the path to the credential helper: %w", err))
+		}
+		credentialProcessArgs, err := buildCredentialProcessArgs(cmd.Flags())
+		if err != nil {
+			exitWithError(withErrorCode(errorCodeConfiguration, err))
+		}
+
+		var snippets []string
+		format := wrapFormat.String()
+		if format == "all" || format == "credential-process" {
+			snippets = append(snippets, credentialProcessSnippet(executable, credentialProcessArgs, profile))
+		}
+		if format == "all" || format == "systemd" {
+			snippets = append(snippets, systemdSnippet(executable, credentialProcessArgs, port))
+		}
+		if format == "all" || format == "docker" {
+			snippets = append(snippets, dockerSnippet(executable, credentialProcessArgs, port, sessionDuration))
+		}
+		fmt.Print(strings.Join(snippets, "\n"))
+	},
+}
+
+// Generates the profile for the AWS config file
+func credentialProcessSnippet(executable string, credentialProcessArgs []string, profileName string) string {
+	return fmt.Sprintf("# Profile for the AWS config file (~/.aws/config)\n[%s]\ncredential_process = %s\n",
+		helper.GetConfigFileSectionName(profileName), helper.BuildCredentialProcessCommand(executable, credentialProcessArgs))
+}
+
+// Generates a systemd unit that runs the serve command with the same
+// arguments as the credential-process command
+func systemdSnippet(executable string, credentialProcessArgs []string, port int) string {
+	serveArgs := append([]string{"serve"}, credentialProcessArgs[1:]...)
+	if port != helper.DefaultPort {
+		serveArgs = append(serveArgs, "--port", strconv.Itoa(port))
+	}
+	// Specifiers and environment variables are expanded in ExecStart, even
+	// within quotes
+	execStart := strings.NewReplacer("%", "%%", "$", "$$").Replace(helper.BuildPOSIXCommand(executable, serveArgs))
+
+	return fmt.Sprintf(`# systemd unit (such as /etc/systemd/system/rolesanywhere-credential-helper.service)
+[Unit]
+Description=AWS IAM Roles Anywhere credential helper
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=%s
+Restart=on-failure
+# Don't restart on configuration, identity, expired certificate, or access
+# denied errors, which won't go away by themselves
+RestartPreventExitStatus=%d %d %d %d
+
+[Install]
+WantedBy=multi-user.target
+`, execStart, exitCodes[errorCodeConfiguration], exitCodes[errorCodeIdentity], exitCodes[errorCodeCertificateExpired],
+		exitCodes[errorCodeAccessDenied])
+}
+
+// Generates docker run commands that pass credentials to a container, either
+// through environment variables or through the local server of the serve
+// command
+func dockerSnippet(executable string, credentialProcessArgs []string, port int, sessionDuration int) string {
+	envArgs := append(append([]string{}, credentialProcessArgs...), "--output", "env")
+	envCommand := helper.BuildPOSIXCommand(executable, envArgs)
+	return fmt.Sprintf(`# docker run, with credentials passed through environment variables (they expire
+# after %d seconds, and aren't refreshed)
+eval "$(%s)"
+docker run \
+  -e AWS_ACCESS_KEY_ID \
+  -e AWS_SECRET_ACCESS_KEY \
+  -e AWS_SESSION_TOKEN \
+  -e AWS_CREDENTIAL_EXPIRATION \
+  IMAGE
+
+# docker run, for long-running containers whose SDKs refresh credentials from
+# the local server of the serve command (such as run by the systemd unit)
+docker run \
+  --network host \
+  -e AWS_EC2_METADATA_SERVICE_ENDPOINT=http://%s:%d/ \
+  IMAGE
+`, sessionDuration, envCommand, helper.LocalHostAddress, port)
+}
@@ -0,0 +1,33 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+func TestWrapSnippets(t *testing.T) {
+	credentialProcessArgs := []string{"credential-process", "--config", "/etc/rolesanywhere/100%.yaml", "--identity-profile", "edge-router"}
+
+	snippet := credentialProcessSnippet("/usr/local/bin/aws_signing_helper", credentialProcessArgs, "developer")
+	if !strings.Contains(snippet, "[profile developer]\ncredential_process = /usr/local/bin/aws_signing_helper credential-process") {
+		t.Log("unexpected credential_process snippet:", snippet)
+		t.Fail()
+	}
+
+	snippet = systemdSnippet("/usr/local/bin/aws_signing_helper", credentialProcessArgs, 9912)
+	if !strings.Contains(snippet, "ExecStart=/usr/local/bin/aws_signing_helper serve --config /etc/rolesanywhere/100%%.yaml "+
+		"--identity-profile edge-router --port 9912\n") || !strings.Contains(snippet, "RestartPreventExitStatus=2 3 4 6\n") {
+		t.Log("unexpected systemd snippet:", snippet)
+		t.Fail()
+	}
+
+	snippet = dockerSnippet("/usr/local/bin/aws_signing_helper", credentialProcessArgs, helper.DefaultPort, 900)
+	if !strings.Contains(snippet, "--identity-profile edge-router --output env)\"") ||
+		!strings.Contains(snippet, "AWS_EC2_METADATA_SERVICE_ENDPOINT=http://127.0.0.1:9911/") ||
+		len(credentialProcessArgs) != 5 {
+		t.Log("unexpected docker snippet:", snippet)
+		t.Fail()
+	}
+}
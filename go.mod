@@ -3,12 +3,12 @@ module github.com/aws/rolesanywhere-credential-helper
 go 1.22.5
 
 require (
+	github.com/aws/aws-sdk-go v1.55.5
 	github.com/aws/aws-sdk-go-v2 v1.36.1
 	github.com/aws/aws-sdk-go-v2/config v1.29.6
 	github.com/aws/smithy-go v1.22.2
 	github.com/google/go-tpm v0.9.3
 	github.com/miekg/pkcs11 v1.1.1
-	github.com/spf13/cobra v1.8.1
 	github.com/stefanberger/go-pkcs11uri v0.0.0-20230803200340-78284954bff6
 	golang.org/x/crypto v0.31.0
 	golang.org/x/net v0.33.0
@@ -27,6 +27,4 @@ require (
 	github.com/aws/aws-sdk-go-v2/service/sso v1.24.15 // indirect
 	github.com/aws/aws-sdk-go-v2/service/ssooidc v1.28.14 // indirect
 	github.com/aws/aws-sdk-go-v2/service/sts v1.33.14 // indirect
-	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.5 // indirect
 )
@@ -0,0 +1,138 @@
+// Package provider implements aws.CredentialsProvider for IAM Roles Anywhere,
+// so that programs that use the AWS SDK for Go v2 can obtain credentials for
+// a role in-process:
+//
+//	credentials, err := provider.New(&aws_signing_helper.CredentialsOpts{ /* ... */ })
+//	if err != nil {
+//		return err
+//	}
+//	defer credentials.Close()
+//	cfg, err := config.LoadDefaultConfig(ctx, config.WithCredentialsProvider(credentials))
+//
+// Credentials are cached, and refreshed (through a new CreateSession call)
+// when they're about to expire.
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Source of the credentials returned by the provider
+const ProviderName = "RolesAnywhereProvider"
+
+// Options of the provider
+type Options struct {
+	// How long before the credentials expire to refresh them. Defaults to
+	// five minutes, as for the update command.
+	ExpiryWindow time.Duration
+	// Fraction of the expiry window (between 0 and 1) by which it's randomly
+	// shortened, so that many processes that started at the same time don't
+	// all refresh at once
+	ExpiryWindowJitterFrac float64
+	// Called when cached credentials are returned. New sets it to the
+	// OnCacheHit hook of the options it's passed.
+	OnCacheHit func(helper.CacheHitEvent)
+}
+
+// Provides credentials from Roles Anywhere, caching them until they're about
+// to expire. It's safe for concurrent use.
+type Provider struct {
+	credentialer helper.Credentialer
+	cache        *aws.CredentialsCache
+	retriever    *retriever
+	onCacheHit   func(helper.CacheHitEvent)
+}
+
+var _ aws.CredentialsProvider = (*Provider)(nil)
+
+// Creates a provider for the identity and role described by the options. The
+// private key and certificate are found in the same way as by the
+// credential-process command.
+func New(opts *helper.CredentialsOpts, optFns ...func(*Options)) (*Provider, error) {
+	credentialer, err := helper.NewCredentialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	optFns = append([]func(*Options){func(options *Options) {
+		options.OnCacheHit = opts.Hooks.OnCacheHit
+	}}, optFns...)
+	return NewFromCredentialer(credentialer, optFns...), nil
+}
+
+// Creates a provider that obtains credentials through the Credentialer (for
+// example, one with a custom signer). The provider takes ownership of the
+// Credentialer, and closes it when it's closed.
+func NewFromCredentialer(credentialer helper.Credentialer, optFns ...func(*Options)) *Provider {
+	options := Options{ExpiryWindow: helper.UpdateRefreshTime}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+
+	r := &retriever{credentialer: credentialer}
+	return &Provider{
+		credentialer: credentialer,
+		cache: aws.NewCredentialsCache(r, func(cacheOptions *aws.CredentialsCacheOptions) {
+			cacheOptions.ExpiryWindow = options.ExpiryWindow
+			cacheOptions.ExpiryWindowJitterFrac = options.ExpiryWindowJitterFrac
+		}),
+		retriever:  r,
+		onCacheHit: options.OnCacheHit,
+	}
+}
+
+// Returns the cached credentials, or obtains new ones if they're missing or
+// about to expire
+func (p *Provider) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	calls := p.retriever.calls.Load()
+	credentials, err := p.cache.Retrieve(ctx)
+	// Concurrent calls may refresh the credentials in the meantime, in which
+	// case cache hits aren't reported
+	if err == nil && p.onCacheHit != nil && p.retriever.calls.Load() == calls {
+		p.onCacheHit(helper.CacheHitEvent{Expiration: credentials.Expires})
+	}
+	return credentials, err
+}
+
+// Discards the cached credentials, so that new ones are obtained by the next
+// call to Retrieve
+func (p *Provider) Invalidate() {
+	p.cache.Invalidate()
+}
+
+// Releases the resources held by the signer (such as PKCS#11 sessions or TPM
+// handles). The provider can't be used afterwards.
+func (p *Provider) Close() {
+	p.credentialer.Close()
+}
+
+// Obtains new credentials on each call, for the cache
+type retriever struct {
+	credentialer helper.Credentialer
+	calls        atomic.Int64
+}
+
+func (r *retriever) Retrieve(ctx context.Context) (aws.Credentials, error) {
+	r.calls.Add(1)
+	output, err := r.credentialer.Credentials(ctx)
+	if err != nil {
+		return aws.Credentials{}, err
+	}
+	expires, err := time.Parse(time.RFC3339, output.Expiration)
+	if err != nil {
+		return aws.Credentials{}, fmt.Errorf("invalid expiration time %q: %w", output.Expiration, err)
+	}
+	return aws.Credentials{
+		AccessKeyID:     output.AccessKeyId,
+		SecretAccessKey: output.SecretAccessKey,
+		SessionToken:    output.SessionToken,
+		Source:          ProviderName,
+		CanExpire:       true,
+		Expires:         expires,
+	}, nil
+}
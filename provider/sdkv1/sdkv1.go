@@ -0,0 +1,96 @@
+// Package sdkv1 implements credentials.Provider of the AWS SDK for Go (v1)
+// for IAM Roles Anywhere, for services that haven't moved to v2 of the SDK:
+//
+//	provider, err := sdkv1.New(&aws_signing_helper.CredentialsOpts{ /* ... */ })
+//	if err != nil {
+//		return err
+//	}
+//	defer provider.Close()
+//	sess, err := session.NewSession(&aws.Config{Credentials: credentials.NewCredentials(provider)})
+//
+// credentials.Credentials caches the credentials, and calls the provider
+// again when they're about to expire.
+package sdkv1
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+	"github.com/aws/rolesanywhere-credential-helper/provider"
+)
+
+// Name of the provider in the credentials it returns
+const ProviderName = provider.ProviderName
+
+// Provides credentials from Roles Anywhere. It's meant to be wrapped by
+// credentials.NewCredentials, which serializes calls to it.
+type Provider struct {
+	credentials.Expiry
+
+	// How long before the credentials expire to consider them expired.
+	// Defaults to five minutes, as for the update command.
+	ExpiryWindow time.Duration
+
+	credentialer helper.Credentialer
+}
+
+var (
+	_ credentials.ProviderWithContext = (*Provider)(nil)
+	_ credentials.Expirer             = (*Provider)(nil)
+)
+
+// Creates a provider for the identity and role described by the options. The
+// private key and certificate are found in the same way as by the
+// credential-process command.
+func New(opts *helper.CredentialsOpts, options ...func(*Provider)) (*Provider, error) {
+	credentialer, err := helper.NewCredentialer(opts)
+	if err != nil {
+		return nil, err
+	}
+	return NewFromCredentialer(credentialer, options...), nil
+}
+
+// Creates a provider that obtains credentials through the Credentialer (for
+// example, one with a custom signer). The provider takes ownership of the
+// Credentialer, and closes it when it's closed.
+func NewFromCredentialer(credentialer helper.Credentialer, options ...func(*Provider)) *Provider {
+	p := &Provider{ExpiryWindow: helper.UpdateRefreshTime, credentialer: credentialer}
+	for _, option := range options {
+		option(p)
+	}
+	return p
+}
+
+// Obtains new credentials through a CreateSession call
+func (p *Provider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+// Same as Retrieve, but the CreateSession call is canceled when the context
+// is done
+func (p *Provider) RetrieveWithContext(ctx credentials.Context) (credentials.Value, error) {
+	output, err := p.credentialer.Credentials(ctx)
+	if err != nil {
+		return credentials.Value{ProviderName: ProviderName}, err
+	}
+	expires, err := time.Parse(time.RFC3339, output.Expiration)
+	if err != nil {
+		return credentials.Value{ProviderName: ProviderName}, fmt.Errorf("invalid expiration time %q: %w", output.Expiration, err)
+	}
+	p.SetExpiration(expires, p.ExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     output.AccessKeyId,
+		SecretAccessKey: output.SecretAccessKey,
+		SessionToken:    output.SessionToken,
+		ProviderName:    ProviderName,
+	}, nil
+}
+
+// Releases the resources held by the signer (such as PKCS#11 sessions or TPM
+// handles). The provider can't be used afterwards.
+func (p *Provider) Close() {
+	p.credentialer.Close()
+}
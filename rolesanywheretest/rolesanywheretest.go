@@ -0,0 +1,117 @@
+// Package rolesanywheretest provides test doubles for programs that obtain
+// credentials through the credential helper: a fake Roles Anywhere server, a
+// signer whose signatures are deterministic, and fixture certificates, so
+// that credential flows can be integration-tested without real keys or
+// network access (the server only listens on the loopback interface):
+//
+//	server := rolesanywheretest.NewServer()
+//	defer server.Close()
+//	opts := server.CredentialsOpts()
+//	signer, signatureAlgorithm := rolesanywheretest.NewSigner()
+//	credentialer := aws_signing_helper.NewCredentialerWithSigner(&opts, signer, signatureAlgorithm)
+//	defer credentialer.Close()
+//	credentials, err := credentialer.Credentials(ctx)
+//
+// The fixture key and certificates are only meant for tests: their private
+// keys are public.
+package rolesanywheretest
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	_ "embed"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Resources that the fake server accepts by default
+const (
+	TrustAnchorArn = "arn:aws:rolesanywhere:us-east-1:000000000000:trust-anchor/00000000-0000-0000-0000-000000000000"
+	ProfileArn     = "arn:aws:rolesanywhere:us-east-1:000000000000:profile/00000000-0000-0000-0000-000000000000"
+	RoleArn        = "arn:aws:iam::000000000000:role/rolesanywheretest"
+)
+
+var (
+	// CA that issued the fixture certificate, for which the fake server
+	// plays the part of the trust anchor
+	//go:embed testdata/ca-cert.pem
+	caCertificatePEM []byte
+	// Fixture certificate (for an RSA key), which is valid until 2124
+	//go:embed testdata/cert.pem
+	certificatePEM []byte
+	// PKCS#8 private key of the fixture certificate
+	//go:embed testdata/key.pem
+	privateKeyPEM []byte
+)
+
+// Parses the PEM-encoded certificate
+func parseCertificate(data []byte) *x509.Certificate {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		panic("rolesanywheretest: invalid fixture certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		panic(fmt.Sprintf("rolesanywheretest: invalid fixture certificate: %s", err))
+	}
+	return certificate
+}
+
+// Returns the CA certificate that issued the fixture certificate
+func CACertificate() *x509.Certificate {
+	return parseCertificate(caCertificatePEM)
+}
+
+// Returns the fixture certificate
+func Certificate() *x509.Certificate {
+	return parseCertificate(certificatePEM)
+}
+
+// Returns the private key of the fixture certificate
+func PrivateKey() *rsa.PrivateKey {
+	block, _ := pem.Decode(privateKeyPEM)
+	if block == nil {
+		panic("rolesanywheretest: invalid fixture private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		panic(fmt.Sprintf("rolesanywheretest: invalid fixture private key: %s", err))
+	}
+	return key.(*rsa.PrivateKey)
+}
+
+// Returns the PEM-encoded fixture certificate and private key
+func IdentityPEM() (certificate []byte, privateKey []byte) {
+	return append([]byte{}, certificatePEM...), append([]byte{}, privateKeyPEM...)
+}
+
+// Writes the fixture certificate and private key into the directory (such as
+// one returned by testing.T.TempDir), for tests that pass file paths (as with
+// the --certificate and --private-key flags). Returns the paths of the files.
+func WriteIdentity(dir string) (certificatePath string, privateKeyPath string, err error) {
+	certificatePath = filepath.Join(dir, "rolesanywheretest-cert.pem")
+	privateKeyPath = filepath.Join(dir, "rolesanywheretest-key.pem")
+	if err = os.WriteFile(certificatePath, certificatePEM, 0644); err != nil {
+		return "", "", err
+	}
+	if err = os.WriteFile(privateKeyPath, privateKeyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	return certificatePath, privateKeyPath, nil
+}
+
+// Creates a signer for the fixture private key and certificate, along with
+// its signature algorithm. Its signatures (RSASSA-PKCS1-v1_5) only depend on
+// the data that's signed, so that signed requests can be compared across
+// test runs when the signing time is fixed.
+func NewSigner() (helper.Signer, string) {
+	signer, signatureAlgorithm, err := helper.NewCryptoSigner(PrivateKey(), Certificate(), nil)
+	if err != nil {
+		panic(fmt.Sprintf("rolesanywheretest: unable to create signer: %s", err))
+	}
+	return signer, signatureAlgorithm
+}
@@ -0,0 +1,146 @@
+package rolesanywheretest
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/x509"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+// Signer whose signatures are corrupted
+type tamperingSigner struct {
+	helper.Signer
+}
+
+func (s tamperingSigner) Sign(rand io.Reader, message []byte, opts crypto.SignerOpts) ([]byte, error) {
+	signature, err := s.Signer.Sign(rand, message, opts)
+	if err == nil {
+		signature[0] ^= 0xff
+	}
+	return signature, err
+}
+
+// Obtains credentials from the server with the signer
+func credentials(server *Server, signer helper.Signer, signatureAlgorithm string, optFns ...func(*helper.CredentialsOpts)) (helper.CredentialProcessOutput, error) {
+	opts := server.CredentialsOpts()
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	credentialer := helper.NewCredentialerWithSigner(&opts, signer, signatureAlgorithm, func(o *helper.CredentialerOptions) {
+		o.Retryer = func() aws.Retryer { return aws.NopRetryer{} }
+	})
+	defer credentialer.Close()
+	return credentialer.Credentials(context.Background())
+}
+
+func TestServer(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	signer, signatureAlgorithm := NewSigner()
+
+	output, err := credentials(server, signer, signatureAlgorithm, func(opts *helper.CredentialsOpts) {
+		opts.RoleSessionName = "test-session"
+		opts.SessionDuration = 900
+	})
+	if err != nil {
+		t.Fatalf("unable to obtain credentials: %s", err)
+	}
+	if !strings.HasPrefix(output.AccessKeyId, "ASIA") || output.SecretAccessKey == "" || output.SessionToken == "" {
+		t.Errorf("unexpected credentials: %+v", output)
+	}
+
+	requests := server.Requests()
+	if len(requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(requests))
+	}
+	request := requests[0]
+	if request.TrustAnchorArn != TrustAnchorArn || request.ProfileArn != ProfileArn || request.RoleArn != RoleArn ||
+		request.RoleSessionName != "test-session" || request.DurationSeconds != 900 ||
+		request.SignatureAlgorithm != signatureAlgorithm || !request.Certificate.Equal(Certificate()) {
+		t.Errorf("unexpected request: %+v", request)
+	}
+}
+
+func TestServerRejections(t *testing.T) {
+	signer, signatureAlgorithm := NewSigner()
+	fixtureRoots := func(o *ServerOptions) {}
+	untrustedRoots := func(o *ServerOptions) { o.Roots = x509.NewCertPool() }
+	fixtureOpts := func(opts *helper.CredentialsOpts) {}
+
+	for _, tc := range []struct {
+		name      string
+		serverFn  func(*ServerOptions)
+		signer    helper.Signer
+		optsFn    func(*helper.CredentialsOpts)
+		errorCode string
+	}{
+		{"untrusted CA", untrustedRoots, signer, fixtureOpts, "AccessDeniedException"},
+		{"tampered signature", fixtureRoots, tamperingSigner{signer}, fixtureOpts, "AccessDeniedException"},
+		{"unknown role", fixtureRoots, signer, func(opts *helper.CredentialsOpts) {
+			opts.RoleArn = "arn:aws:iam::000000000000:role/other"
+		}, "AccessDeniedException"},
+		{"unknown profile", fixtureRoots, signer, func(opts *helper.CredentialsOpts) {
+			opts.ProfileArnStr = strings.Replace(ProfileArn, "00000000-", "11111111-", 1)
+		}, "ResourceNotFoundException"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := NewServer(tc.serverFn)
+			defer server.Close()
+			_, err := credentials(server, tc.signer, signatureAlgorithm, tc.optsFn)
+			if err == nil || !strings.Contains(err.Error(), tc.errorCode) {
+				t.Errorf("expected %s error, got %v", tc.errorCode, err)
+			}
+			if len(server.Requests()) != 0 {
+				t.Errorf("rejected request was recorded")
+			}
+		})
+	}
+}
+
+func TestServerFailNext(t *testing.T) {
+	server := NewServer()
+	defer server.Close()
+	signer, signatureAlgorithm := NewSigner()
+
+	server.FailNext(http.StatusTooManyRequests, "ThrottlingException", "Rate exceeded")
+	if _, err := credentials(server, signer, signatureAlgorithm); !errors.Is(err, helper.ErrThrottled) {
+		t.Errorf("expected throttling error, got %v", err)
+	}
+	if _, err := credentials(server, signer, signatureAlgorithm); err != nil {
+		t.Errorf("unable to obtain credentials after the failure: %s", err)
+	}
+}
+
+func TestSignerIsDeterministic(t *testing.T) {
+	signer, _ := NewSigner()
+	first, err := signer.Sign(rand.Reader, []byte("payload"), crypto.SHA256)
+	if err != nil {
+		t.Fatalf("unable to sign: %s", err)
+	}
+	second, _ := signer.Sign(rand.Reader, []byte("payload"), crypto.SHA256)
+	if string(first) != string(second) {
+		t.Errorf("signatures differ")
+	}
+}
+
+func TestWriteIdentity(t *testing.T) {
+	certificatePath, privateKeyPath, err := WriteIdentity(t.TempDir())
+	if err != nil {
+		t.Fatalf("unable to write identity: %s", err)
+	}
+	certificate, privateKey := IdentityPEM()
+	for path, expected := range map[string][]byte{certificatePath: certificate, privateKeyPath: privateKey} {
+		if data, err := os.ReadFile(path); err != nil || string(data) != string(expected) {
+			t.Errorf("unexpected contents of %s", path)
+		}
+	}
+}
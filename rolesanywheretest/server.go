@@ -0,0 +1,417 @@
+package rolesanywheretest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	helper "github.com/aws/rolesanywhere-credential-helper/aws_signing_helper"
+)
+
+const (
+	// Formats of the signing time and date in SigV4-X509 signatures
+	signingTimeFormat = "20060102T150405Z"
+	signingDateFormat = "20060102"
+	// Difference between the signing time and the clock of the server above
+	// which requests are rejected, as by Roles Anywhere
+	maxSigningTimeSkew = 5 * time.Minute
+)
+
+// Options of the fake server
+type ServerOptions struct {
+	// Trust anchor and profile that the server accepts. Default to
+	// TrustAnchorArn and ProfileArn.
+	TrustAnchorArn string
+	ProfileArn     string
+	// Roles that can be assumed through the profile. Defaults to RoleArn.
+	RoleArns []string
+	// CA certificates of the trust anchor, that the certificates of requests
+	// have to chain to. Defaults to the fixture CA certificate.
+	Roots *x509.CertPool
+	// Returns the current time, which certificates are validated at, signing
+	// times are compared with, and expiration times are based on. Defaults
+	// to time.Now.
+	Now func() time.Time
+}
+
+// CreateSession request that the server accepted
+type Request struct {
+	TrustAnchorArn   string
+	ProfileArn       string
+	RoleArn          string
+	RoleSessionName  string
+	DurationSeconds  int
+	Certificate      *x509.Certificate
+	CertificateChain []*x509.Certificate
+	// Algorithm of the SigV4-X509 signature, such as AWS4-X509-RSA-SHA256
+	SignatureAlgorithm string
+}
+
+// Error response that's returned instead of credentials
+type failure struct {
+	statusCode int
+	errorType  string
+	message    string
+}
+
+// Fake Roles Anywhere server, which validates CreateSession requests as Roles
+// Anywhere does (including their SigV4-X509 signatures and the certificate
+// chains), and returns credentials that are only valid for it. It's safe for
+// concurrent use.
+type Server struct {
+	// Base URL of the server, which is used as the endpoint of CreateSession
+	// calls
+	URL string
+
+	server   *httptest.Server
+	options  ServerOptions
+	mu       sync.Mutex
+	requests []Request
+	failures []failure
+}
+
+// Starts a fake server on the loopback interface. It has to be closed when
+// the test is done.
+func NewServer(optFns ...func(*ServerOptions)) *Server {
+	options := ServerOptions{
+		TrustAnchorArn: TrustAnchorArn,
+		ProfileArn:     ProfileArn,
+		RoleArns:       []string{RoleArn},
+		Now:            time.Now,
+	}
+	for _, fn := range optFns {
+		fn(&options)
+	}
+	if options.Roots == nil {
+		options.Roots = x509.NewCertPool()
+		options.Roots.AddCert(CACertificate())
+	}
+
+	s := &Server{options: options}
+	s.server = httptest.NewServer(http.HandlerFunc(s.handleCreateSession))
+	s.URL = s.server.URL
+	return s
+}
+
+// Shuts the server down
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// Returns options that obtain credentials from the server, for the trust
+// anchor, profile, and (first) role that it accepts. The identity (such as
+// CertificateId and PrivateKeyId) isn't set; NewSigner creates a signer for
+// the fixture identity.
+func (s *Server) CredentialsOpts() helper.CredentialsOpts {
+	opts := helper.CredentialsOpts{
+		TrustAnchorArnStr: s.options.TrustAnchorArn,
+		ProfileArnStr:     s.options.ProfileArn,
+		SessionDuration:   3600,
+		Endpoint:          s.URL,
+	}
+	if len(s.options.RoleArns) > 0 {
+		opts.RoleArn = s.options.RoleArns[0]
+	}
+	return opts
+}
+
+// Returns the requests that the server accepted, in the order in which they
+// were received
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// Makes the server fail the next request with the error (for example,
+// http.StatusTooManyRequests and "ThrottlingException"), instead of
+// validating it. Failures are queued, so that several requests in a row can
+// be failed.
+func (s *Server) FailNext(statusCode int, errorType string, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures = append(s.failures, failure{statusCode, errorType, message})
+}
+
+// Writes an error response, in the format of Roles Anywhere
+func writeError(w http.ResponseWriter, statusCode int, errorType string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Amzn-ErrorType", errorType)
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	// Clients compare the Date header with their clock to detect skew
+	now := s.options.Now()
+	w.Header().Set("Date", now.UTC().Format(http.TimeFormat))
+	if r.Method != http.MethodPost || r.URL.Path != "/sessions" {
+		writeError(w, http.StatusNotFound, "UnknownOperationException", "unknown operation")
+		return
+	}
+
+	s.mu.Lock()
+	if len(s.failures) > 0 {
+		f := s.failures[0]
+		s.failures = s.failures[1:]
+		s.mu.Unlock()
+		writeError(w, f.statusCode, f.errorType, f.message)
+		return
+	}
+	s.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationException", "unable to read request body")
+		return
+	}
+	var input struct {
+		DurationSeconds *int   `json:"durationSeconds"`
+		RoleSessionName string `json:"roleSessionName"`
+	}
+	if err = json.Unmarshal(body, &input); err != nil {
+		writeError(w, http.StatusBadRequest, "ValidationException", "invalid request body")
+		return
+	}
+
+	request, err := s.verifySignature(r, body, now)
+	if err != nil {
+		writeError(w, http.StatusForbidden, "AccessDeniedException", err.Error())
+		return
+	}
+	if err = s.verifyCertificate(request, now); err != nil {
+		writeError(w, http.StatusForbidden, "AccessDeniedException", err.Error())
+		return
+	}
+
+	query := r.URL.Query()
+	request.TrustAnchorArn = query.Get("trustAnchorArn")
+	request.ProfileArn = query.Get("profileArn")
+	request.RoleArn = query.Get("roleArn")
+	request.RoleSessionName = input.RoleSessionName
+	request.DurationSeconds = 3600
+	if input.DurationSeconds != nil {
+		request.DurationSeconds = *input.DurationSeconds
+	}
+	switch {
+	case request.TrustAnchorArn != s.options.TrustAnchorArn:
+		writeError(w, http.StatusNotFound, "ResourceNotFoundException", "Trust anchor not found")
+		return
+	case request.ProfileArn != s.options.ProfileArn:
+		writeError(w, http.StatusNotFound, "ResourceNotFoundException", "Profile not found")
+		return
+	case !s.canAssume(request.RoleArn):
+		writeError(w, http.StatusForbidden, "AccessDeniedException", "Role can't be assumed through the profile")
+		return
+	case request.DurationSeconds < 900 || request.DurationSeconds > 43200:
+		writeError(w, http.StatusBadRequest, "ValidationException", "durationSeconds must be between 900 and 43200")
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, request)
+	sessionNumber := len(s.requests)
+	s.mu.Unlock()
+
+	roleName := request.RoleArn[strings.LastIndex(request.RoleArn, "/")+1:]
+	sessionName := request.RoleSessionName
+	if sessionName == "" {
+		sessionName = request.Certificate.SerialNumber.Text(16)
+	}
+	accountId := strings.Split(request.RoleArn, ":")[4]
+	credentials := map[string]interface{}{
+		"accessKeyId":     fmt.Sprintf("ASIAROLESANYWHERE%03d", sessionNumber%1000),
+		"secretAccessKey": fmt.Sprintf("rolesanywheretest-secret-access-key-%d", sessionNumber),
+		"sessionToken":    fmt.Sprintf("rolesanywheretest-session-token-%d", sessionNumber),
+		"expiration":      now.Add(time.Duration(request.DurationSeconds) * time.Second).UTC().Format(time.RFC3339),
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"credentialSet": []interface{}{map[string]interface{}{
+			"assumedRoleUser": map[string]string{
+				"arn":           fmt.Sprintf("arn:aws:sts::%s:assumed-role/%s/%s", accountId, roleName, sessionName),
+				"assumedRoleId": fmt.Sprintf("AROAROLESANYWHERETEST:%s", sessionName),
+			},
+			"credentials":      credentials,
+			"packedPolicySize": 0,
+			"roleArn":          request.RoleArn,
+			"sourceIdentity":   request.Certificate.Subject.String(),
+		}},
+		"subjectArn": fmt.Sprintf("arn:aws:rolesanywhere:%s:%s:subject/%s", strings.Split(request.TrustAnchorArn, ":")[3],
+			strings.Split(request.TrustAnchorArn, ":")[4], request.Certificate.SerialNumber.Text(16)),
+	})
+}
+
+// Returns whether the role can be assumed through the profile
+func (s *Server) canAssume(roleArn string) bool {
+	for _, arn := range s.options.RoleArns {
+		if arn == roleArn {
+			return true
+		}
+	}
+	return false
+}
+
+// Verifies the SigV4-X509 signature of the request, and returns the
+// certificates and the signature algorithm of the request
+func (s *Server) verifySignature(r *http.Request, body []byte, now time.Time) (Request, error) {
+	var request Request
+	certificateDER, err := base64.StdEncoding.DecodeString(r.Header.Get("X-Amz-X509"))
+	if err != nil || len(certificateDER) == 0 {
+		return request, fmt.Errorf("Missing or invalid X-Amz-X509 header")
+	}
+	if request.Certificate, err = x509.ParseCertificate(certificateDER); err != nil {
+		return request, fmt.Errorf("Invalid certificate in the X-Amz-X509 header")
+	}
+	if chain := r.Header.Get("X-Amz-X509-Chain"); chain != "" {
+		for _, encoded := range strings.Split(chain, ",") {
+			der, err := base64.StdEncoding.DecodeString(encoded)
+			if err != nil {
+				return request, fmt.Errorf("Invalid certificate in the X-Amz-X509-Chain header")
+			}
+			certificate, err := x509.ParseCertificate(der)
+			if err != nil {
+				return request, fmt.Errorf("Invalid certificate in the X-Amz-X509-Chain header")
+			}
+			request.CertificateChain = append(request.CertificateChain, certificate)
+		}
+	}
+
+	// AWS4-X509-RSA-SHA256 Credential=<serial>/<date>/<region>/rolesanywhere/aws4_request, SignedHeaders=<headers>, Signature=<hex>
+	algorithm, parameters, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	fields := make(map[string]string)
+	for _, parameter := range strings.Split(parameters, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(parameter), "=")
+		fields[key] = value
+	}
+	credential := strings.Split(fields["Credential"], "/")
+	if len(credential) != 5 || credential[3] != "rolesanywhere" || credential[4] != "aws4_request" || fields["SignedHeaders"] == "" {
+		return request, fmt.Errorf("Missing or invalid Authorization header")
+	}
+	if credential[0] != request.Certificate.SerialNumber.String() {
+		return request, fmt.Errorf("Credential doesn't match the serial number of the certificate")
+	}
+	signature, err := hex.DecodeString(fields["Signature"])
+	if err != nil {
+		return request, fmt.Errorf("Invalid signature")
+	}
+
+	signingTime, err := time.Parse(signingTimeFormat, r.Header.Get("X-Amz-Date"))
+	if err != nil {
+		return request, fmt.Errorf("Missing or invalid X-Amz-Date header")
+	}
+	if skew := signingTime.Sub(now); skew > maxSigningTimeSkew || skew < -maxSigningTimeSkew {
+		return request, fmt.Errorf("Signature expired: the signing time is more than 5 minutes away from the current time")
+	}
+	if credential[1] != signingTime.Format(signingDateFormat) {
+		return request, fmt.Errorf("Credential doesn't match the signing date")
+	}
+
+	signedHeaders := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(signedHeaders) {
+		return request, fmt.Errorf("Signed headers aren't sorted")
+	}
+	for _, required := range []string{"host", "x-amz-date", "x-amz-x509"} {
+		if i := sort.SearchStrings(signedHeaders, required); i == len(signedHeaders) || signedHeaders[i] != required {
+			return request, fmt.Errorf("The %s header isn't signed", required)
+		}
+	}
+	var canonicalHeaders strings.Builder
+	for _, name := range signedHeaders {
+		var values []string
+		switch name {
+		case "host":
+			values = []string{r.Host}
+		case "content-length":
+			values = []string{strconv.FormatInt(r.ContentLength, 10)}
+		default:
+			values = r.Header.Values(name)
+		}
+		canonicalHeaders.WriteString(name + ":" + collapseSpaces(strings.Join(values, ",")) + "\n")
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.Path,
+		strings.ReplaceAll(r.URL.Query().Encode(), "+", "%20"),
+		canonicalHeaders.String(),
+		fields["SignedHeaders"],
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		algorithm,
+		r.Header.Get("X-Amz-Date"),
+		strings.Join(credential[1:], "/"),
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+	digest := sha256.Sum256([]byte(stringToSign))
+
+	switch publicKey := request.Certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		if algorithm != "AWS4-X509-RSA-SHA256" {
+			return request, fmt.Errorf("Signature algorithm doesn't match the key of the certificate")
+		}
+		err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if algorithm != "AWS4-X509-ECDSA-SHA256" {
+			return request, fmt.Errorf("Signature algorithm doesn't match the key of the certificate")
+		}
+		if !ecdsa.VerifyASN1(publicKey, digest[:], signature) {
+			err = fmt.Errorf("invalid signature")
+		}
+	default:
+		return request, fmt.Errorf("Unsupported key type of the certificate")
+	}
+	if err != nil {
+		return request, fmt.Errorf("Signature validation failed")
+	}
+	request.SignatureAlgorithm = algorithm
+	return request, nil
+}
+
+// Verifies that the certificate of the request chains to the CAs of the
+// trust anchor, and is valid at the current time
+func (s *Server) verifyCertificate(request Request, now time.Time) error {
+	intermediates := x509.NewCertPool()
+	for _, certificate := range request.CertificateChain {
+		intermediates.AddCert(certificate)
+	}
+	_, err := request.Certificate.Verify(x509.VerifyOptions{
+		Roots:         s.options.Roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if invalidErr, ok := err.(x509.CertificateInvalidError); ok && invalidErr.Reason == x509.Expired {
+		return fmt.Errorf("Certificate expired or not yet valid")
+	} else if err != nil {
+		return fmt.Errorf("Untrusted signing certificate")
+	}
+	return nil
+}
+
+// Trims the value and replaces runs of spaces within it with a single space,
+// as in canonical SigV4 headers
+func collapseSpaces(value string) string {
+	value = strings.Trim(value, " ")
+	for strings.Contains(value, "  ") {
+		value = strings.ReplaceAll(value, "  ", " ")
+	}
+	return value
+}